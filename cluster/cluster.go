@@ -0,0 +1,441 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package cluster runs two or more controllers sharing the database in the
+// active/standby mode. The members elect the leader, which is the only one that
+// serves the switches, and record their heartbeats in the database so that
+// each of them knows the others. A standby member takes over the leadership
+// when the leader has not updated the election within the expiration. The
+// leader also stores the snapshots of the replicas in the database, which are
+// restored by the next leader so that it does not start from scratch.
+//
+// In the sharding mode, the switches are shared among the members instead of
+// being served by the leader: each switch is served by its owner, which is
+// assigned explicitly or by the hash of its DPID. The switches of a member that
+// leaves the cluster are taken over by the others.
+package cluster
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/election"
+
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("cluster")
+)
+
+// Member is a controller in the cluster.
+type Member struct {
+	UID       string    `json:"uid"` // Unique ID in the election.
+	Name      string    `json:"name"`
+	Address   string    `json:"address"` // Address of the REST API, if advertised.
+	Leader    bool      `json:"leader"`
+	Timestamp time.Time `json:"timestamp"` // Last heartbeat.
+}
+
+type Database interface {
+	election.Database
+	// Heartbeat records the heartbeat of m, and then returns the members whose
+	// last heartbeats are within expiration, including m. The members whose
+	// heartbeats have expired are removed.
+	Heartbeat(m Member, expiration time.Duration) ([]Member, error)
+	// SaveState stores state of the replica specified by name.
+	SaveState(name string, state []byte) error
+	// State returns the state of the replica specified by name and when it has
+	// been stored. ok will be false if there is no such state.
+	State(name string) (state []byte, timestamp time.Time, ok bool, err error)
+}
+
+// Replica is the in-memory state of the leader that is replicated to the
+// other members.
+type Replica interface {
+	// Snapshot returns the current state.
+	Snapshot() ([]byte, error)
+	// Restore restores the state returned by Snapshot of the previous leader.
+	Restore(state []byte) error
+}
+
+type Config struct {
+	Name    string
+	Address string
+	// Expiration is the time after which a member, including the leader, is
+	// considered dead if it has not sent its heartbeat.
+	Expiration time.Duration
+	// ReplicationInterval is how often the leader stores the snapshots of
+	// the replicas. Default is the expiration.
+	ReplicationInterval time.Duration
+	// Sharding makes the members share the switches.
+	Sharding bool
+	// Assignments are the names of the members that own the switches, keyed
+	// by their DPIDs. The other switches are assigned by the hash.
+	Assignments map[uint64]string
+}
+
+type Cluster struct {
+	config   Config
+	db       Database
+	observer *election.Observer
+	// kick makes the heartbeat be sent immediately.
+	kick chan struct{}
+
+	mutex    sync.Mutex
+	members  []Member // Sorted by their names.
+	replicas map[string]Replica
+	// Last time the heartbeat has succeeded.
+	lastHeartbeat time.Time
+	rebalancers   []func()
+}
+
+func New(db Database, config Config) *Cluster {
+	if config.Expiration <= 0 {
+		config.Expiration = election.DefaultExpiration
+	}
+	if config.ReplicationInterval <= 0 {
+		config.ReplicationInterval = config.Expiration
+	}
+
+	c := &Cluster{
+		config:   config,
+		db:       db,
+		observer: election.New(db, config.Expiration),
+		kick:     make(chan struct{}, 1),
+		replicas: make(map[string]Replica),
+	}
+	// Let the others know the new leader as soon as possible.
+	c.observer.OnChange(func(bool) {
+		select {
+		case c.kick <- struct{}{}:
+		default:
+		}
+	})
+	// This is registered before the others so that the replicas are restored
+	// before the listeners take over the switches.
+	c.observer.OnChange(func(leader bool) {
+		if leader {
+			c.restore()
+		}
+	})
+
+	return c
+}
+
+// Run runs the election and the heartbeats until ctx is canceled. It returns
+// an error if the election fails, as the controller cannot know whether it is
+// the leader anymore.
+func (r *Cluster) Run(ctx context.Context) error {
+	logger.Infof("joining the cluster: name=%v, uid=%v", r.config.Name, r.observer.UID())
+
+	done := make(chan error, 1)
+	go func() { done <- r.observer.Run(ctx) }()
+
+	ticker := time.NewTicker(r.config.Expiration / 5)
+	defer ticker.Stop()
+	replication := time.NewTicker(r.config.ReplicationInterval)
+	defer replication.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-replication.C:
+			if r.IsLeader() {
+				r.replicate()
+			}
+			continue
+		case <-ticker.C:
+		case <-r.kick:
+		}
+		r.heartbeat()
+	}
+}
+
+// Replicate registers replica whose state is stored by the leader, and then
+// restored by the next leader. A replica registered after this controller has
+// become the leader is not restored until the next election.
+func (r *Cluster) Replicate(name string, replica Replica) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.replicas[name] = replica
+}
+
+func (r *Cluster) getReplicas() map[string]Replica {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	replicas := make(map[string]Replica, len(r.replicas))
+	for k, v := range r.replicas {
+		replicas[k] = v
+	}
+
+	return replicas
+}
+
+func (r *Cluster) replicate() {
+	for name, replica := range r.getReplicas() {
+		state, err := replica.Snapshot()
+		if err != nil {
+			logger.Errorf("failed to take the snapshot of %v: %v", name, err)
+			continue
+		}
+		if err := r.db.SaveState(name, state); err != nil {
+			logger.Errorf("failed to store the state of %v: %v", name, err)
+			continue
+		}
+		logger.Debugf("stored the state of %v: %v bytes", name, len(state))
+	}
+}
+
+// restore restores the replicas from the states stored by the previous leader.
+// The states older than a few replication intervals are ignored, as they are
+// stored by a leader that is long gone and do not reflect the network anymore.
+func (r *Cluster) restore() {
+	maxAge := r.config.Expiration + 2*r.config.ReplicationInterval
+	for name, replica := range r.getReplicas() {
+		state, timestamp, ok, err := r.db.State(name)
+		if err != nil {
+			logger.Errorf("failed to load the state of %v: %v", name, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if age := time.Since(timestamp); age > maxAge {
+			logger.Infof("ignoring the stale state of %v: age=%v", name, age)
+			continue
+		}
+		if err := replica.Restore(state); err != nil {
+			logger.Errorf("failed to restore the state of %v: %v", name, err)
+			continue
+		}
+		logger.Infof("restored the state of %v stored at %v", name, timestamp)
+	}
+}
+
+func (r *Cluster) heartbeat() {
+	members, err := r.db.Heartbeat(r.Self(), r.config.Expiration)
+	if err != nil {
+		logger.Errorf("failed to send the cluster heartbeat: %v", err)
+		r.expireMembers()
+		return
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Name != members[j].Name {
+			return members[i].Name < members[j].Name
+		}
+		return members[i].UID < members[j].UID
+	})
+
+	r.mutex.Lock()
+	prev := r.members
+	r.members = members
+	r.lastHeartbeat = time.Now()
+	r.mutex.Unlock()
+
+	joined, left := diff(members, prev), diff(prev, members)
+	// The first heartbeat has nothing to compare.
+	if prev != nil {
+		for _, v := range joined {
+			logger.Infof("cluster member has joined: name=%v, uid=%v, address=%v", v.Name, v.UID, v.Address)
+		}
+		for _, v := range left {
+			logger.Warningf("cluster member has left: name=%v, uid=%v, address=%v", v.Name, v.UID, v.Address)
+		}
+	}
+	if len(joined) > 0 || len(left) > 0 {
+		r.rebalance()
+	}
+}
+
+// expireMembers forgets the members if the heartbeat has failed for longer
+// than the expiration, as the others consider this controller dead and take
+// over its switches.
+func (r *Cluster) expireMembers() {
+	r.mutex.Lock()
+	expired := r.members != nil && time.Since(r.lastHeartbeat) > r.config.Expiration
+	if expired {
+		r.members = nil
+	}
+	r.mutex.Unlock()
+
+	if expired {
+		logger.Warning("forgetting the cluster members because the heartbeat has expired")
+		r.rebalance()
+	}
+}
+
+func (r *Cluster) rebalance() {
+	r.mutex.Lock()
+	rebalancers := make([]func(), len(r.rebalancers))
+	copy(rebalancers, r.rebalancers)
+	r.mutex.Unlock()
+
+	for _, f := range rebalancers {
+		f()
+	}
+}
+
+// diff returns the members in a but not in b.
+func diff(a, b []Member) []Member {
+	uids := make(map[string]bool)
+	for _, v := range b {
+		uids[v.UID] = true
+	}
+	result := []Member{}
+	for _, v := range a {
+		if !uids[v.UID] {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// IsLeader returns whether this controller is the leader.
+func (r *Cluster) IsLeader() bool {
+	return r.observer.IsMaster()
+}
+
+// OnLeaderChange registers f that is called whenever this controller becomes
+// the leader or loses the leadership. f should not block the election.
+func (r *Cluster) OnLeaderChange(f func(leader bool)) {
+	r.observer.OnChange(f)
+}
+
+// OnRebalance registers f that is called whenever the members have joined or
+// left the cluster, so that the owners of the switches may have changed. f
+// should not block the heartbeat.
+func (r *Cluster) OnRebalance(f func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rebalancers = append(r.rebalancers, f)
+}
+
+// IsSharded returns whether the switches are shared among the members.
+func (r *Cluster) IsSharded() bool {
+	return r.config.Sharding
+}
+
+// Owner returns the member that should serve the switch whose DPID is dpid,
+// which is the leader unless the switches are sharded. ok will be false if
+// there is no such member.
+func (r *Cluster) Owner(dpid uint64) (owner Member, ok bool) {
+	if !r.config.Sharding {
+		return r.Leader()
+	}
+
+	members := r.Members()
+	if name, ok := r.config.Assignments[dpid]; ok {
+		for _, v := range members {
+			if v.Name == name {
+				return v, true
+			}
+		}
+		// The assigned member is not alive.
+	}
+
+	return rendezvous(members, dpid)
+}
+
+// IsOwner returns whether this controller should serve the switch whose DPID is dpid.
+func (r *Cluster) IsOwner(dpid uint64) bool {
+	if !r.config.Sharding {
+		return r.IsLeader()
+	}
+	owner, ok := r.Owner(dpid)
+
+	return ok && owner.UID == r.observer.UID()
+}
+
+// rendezvous returns the member whose name hashed with dpid is the highest.
+// When a member leaves, only its switches are moved to the others, and a new
+// member only takes the switches that it owns from the others. The hash does
+// not depend on the UIDs, so that a restarted member owns the same switches.
+func rendezvous(members []Member, dpid uint64) (owner Member, ok bool) {
+	var max uint64
+	for _, v := range members {
+		h := fnv.New64a()
+		h.Write([]byte(v.Name))
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, dpid)
+		h.Write(b)
+		if score := mix(h.Sum64()); !ok || score > max {
+			owner, max, ok = v, score, true
+		}
+	}
+
+	return owner, ok
+}
+
+// mix is the finalizer of SplitMix64, which spreads the bits of the FNV hash
+// whose last input bytes affect only its lower bits.
+func mix(v uint64) uint64 {
+	v ^= v >> 30
+	v *= 0xbf58476d1ce4e5b9
+	v ^= v >> 27
+	v *= 0x94d049bb133111eb
+	v ^= v >> 31
+
+	return v
+}
+
+// Self returns this controller as a member.
+func (r *Cluster) Self() Member {
+	return Member{
+		UID:       r.observer.UID(),
+		Name:      r.config.Name,
+		Address:   r.config.Address,
+		Leader:    r.observer.IsMaster(),
+		Timestamp: time.Now(),
+	}
+}
+
+// Members returns the live members including this controller, which are known
+// by the last heartbeat.
+func (r *Cluster) Members() []Member {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	members := make([]Member, len(r.members))
+	copy(members, r.members)
+
+	return members
+}
+
+// Leader returns the current leader. ok will be false if there is no live leader.
+func (r *Cluster) Leader() (leader Member, ok bool) {
+	for _, v := range r.Members() {
+		if v.Leader {
+			return v, true
+		}
+	}
+
+	return Member{}, false
+}
@@ -0,0 +1,59 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package cluster
+
+import (
+	"testing"
+)
+
+func TestRendezvous(t *testing.T) {
+	members := []Member{{UID: "1", Name: "ctl1"}, {UID: "2", Name: "ctl2"}, {UID: "3", Name: "ctl3"}}
+
+	owners := make(map[uint64]string)
+	count := make(map[string]int)
+	for dpid := uint64(1); dpid <= 300; dpid++ {
+		owner, ok := rendezvous(members, dpid)
+		if !ok {
+			t.Fatalf("no owner of %v", dpid)
+		}
+		owners[dpid] = owner.Name
+		count[owner.Name]++
+	}
+	for _, v := range members {
+		if count[v.Name] < 50 {
+			t.Fatalf("unbalanced owners: %v", count)
+		}
+	}
+
+	// ctl2 has left. Only its switches should be moved.
+	left := []Member{members[0], members[2]}
+	for dpid, prev := range owners {
+		owner, _ := rendezvous(left, dpid)
+		if prev != "ctl2" && owner.Name != prev {
+			t.Fatalf("switch %v has been moved from %v to %v", dpid, prev, owner.Name)
+		}
+	}
+
+	if _, ok := rendezvous(nil, 1); ok {
+		t.Fatal("unexpected owner without the members")
+	}
+}
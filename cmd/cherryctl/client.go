@@ -0,0 +1,176 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// client calls the REST API of the controller.
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+	// stream is the HTTP client without the timeout for the event stream.
+	stream *http.Client
+}
+
+// newClient returns a client that authenticates itself with token, or with the
+// client certificate in certFile and keyFile. Both can be empty.
+func newClient(baseURL string, insecure bool, token, certFile, keyFile string) (*client, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+	}
+
+	return &client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Transport: transport, Timeout: requestTimeout},
+		stream:  &http.Client{Transport: transport},
+	}, nil
+}
+
+func (r *client) get(path string, result interface{}) error {
+	return r.call(http.MethodGet, path, nil, result)
+}
+
+func (r *client) put(path string, body, result interface{}) error {
+	return r.call(http.MethodPut, path, body, result)
+}
+
+func (r *client) delete(path string, result interface{}) error {
+	return r.call(http.MethodDelete, path, nil, result)
+}
+
+func (r *client) call(method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, r.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	r.authorize(req)
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// download writes the raw response of path to w.
+func (r *client) download(path string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, r.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	r.authorize(req)
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
+
+// events calls f with the type and the JSON data of each server-sent event
+// streamed from path until the stream is closed or f returns an error.
+func (r *client) events(path string, f func(t string, data []byte) error) error {
+	req, err := http.NewRequest(http.MethodGet, r.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	r.authorize(req)
+	resp, err := r.stream.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return readEvents(resp.Body, f)
+}
+
+func (r *client) authorize(req *http.Request) {
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+}
+
+func responseError(resp *http.Response) error {
+	e := struct {
+		Error string `json:"error"`
+	}{}
+	b, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(b, &e); err == nil && e.Error != "" {
+		return fmt.Errorf("%v: %v", resp.Status, e.Error)
+	}
+
+	return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,1019 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Command cherryctl manages the Cherry controller through its REST API.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/superkkt/cherry/cluster"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/protocol"
+)
+
+const usage = `Usage: cherryctl [options] <command> [arguments]
+
+Commands:
+  switch list                  List the switches registered in the database
+  device list                  List the connected devices
+  admission list               Show the admission control and the switches waiting for the approval
+  admission approve <dpid> [description]
+                               Approve a switch by registering it in the database
+  admission forget <dpid>      Remove a switch from the pending list
+  alias list                   List the names and the metadata of the switches
+  alias set <dpid> <name> [site] [rack] [role]
+                               Name a switch
+  alias remove <dpid>          Remove the name of a switch
+  maintenance list             List the maintenance windows of the switches and the ports
+  maintenance add <dpid> <port> <start> <end> [description]
+                               Schedule a maintenance window in RFC 3339, e.g., 2006-01-02T15:04:05Z,
+                               of a port, or the whole switch if the port is 0
+  maintenance remove <id>      Remove a maintenance window, which ends it if it is active
+  port list <dpid>             List the ports of a connected device
+  link list                    List the links among the devices
+  host list                    List the hosts
+  flow dump <dpid>             Dump the flows installed on a device
+  flow flush <mac>             Remove the flows toward a host from all the devices
+  flow audit <dpid>            Compare the flows of a device with the ones installed by the controller
+  flow repair <dpid>           Remove the orphan flows of a device, and install the missing ones again
+  packet in <dpid> <port> <frame>
+                               Process a frame in hex as if it is received from a port of a device
+  packet out <dpid> <port> <frame>
+                               Send a frame in hex out to a port of a device
+  packet arp <mac> <ip> <target>
+                               Print an ARP request frame in hex for the packet commands
+  trace <dpid> <port> <dst_mac> [<src_ip> <dst_ip> [icmp|tcp|udp [dst_port]]]
+                               Trace the path of a probe received from a port of a device
+  capture list                 List the control channel captures
+  capture start <dpid> [size]  Start capturing the OpenFlow messages of a device up to size bytes
+  capture stop <dpid>          Stop capturing the OpenFlow messages of a device
+  capture save <dpid> <file>   Save the capture of a device as a pcap file
+  capture clear <dpid>         Discard the capture of a device
+  record start|stop            Start or stop recording the PACKET_INs to the file configured on the controller
+  record show                  Show the PACKET_IN recording status
+  dryrun show                  Show the dry run and the FLOW_MODs recorded instead of being sent
+  dryrun set on|off [app ...]  Record the FLOW_MODs of all the applications, or only the ones of the apps if off
+  dryrun clear                 Forget the recorded FLOW_MODs
+  app list                     List the applications
+  app enable <name>            Enable an application
+  app disable <name>           Disable an application
+  config reload                Reload the configuration file of the controller
+  log get <module>             Show the log level of a module ("default" for all the modules)
+  log set <module> <level>     Change the log level of a module
+  events [type ...]            Tail the events, e.g., events PortUp PortDown
+  audit [since]                List the recent administrative actions, optionally since an RFC 3339 time
+  cluster list                 List the controllers in the cluster
+
+Options:
+`
+
+var (
+	apiURL   = flag.String("api", defaultAPIURL(), "URL of the REST API of the controller (or set CHERRY_API)")
+	insecure = flag.Bool("insecure", false, "Skip the TLS certificate verification")
+	asJSON   = flag.Bool("json", false, "Print the raw JSON responses")
+	token    = flag.String("token", os.Getenv("CHERRY_TOKEN"), "API token of the controller (or set CHERRY_TOKEN)")
+	certFile = flag.String("cert", "", "Client certificate file for the TLS client authentication")
+	keyFile  = flag.String("key", "", "Private key file of the client certificate")
+)
+
+func defaultAPIURL() string {
+	if v := os.Getenv("CHERRY_API"); v != "" {
+		return v
+	}
+
+	return "https://localhost:7070"
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient(*apiURL, *insecure, *token, *certFile, *keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cherryctl: %v\n", err)
+		os.Exit(1)
+	}
+	if err := run(c, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "cherryctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("invalid command: see cherryctl -h")
+
+func run(c *client, args []string) error {
+	cmd := strings.Join(args[:min(2, len(args))], " ")
+	if args[0] == "events" || args[0] == "audit" || args[0] == "trace" {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "switch list":
+		return listSwitches(c)
+	case "device list":
+		return listDevices(c)
+	case "admission list":
+		return listAdmission(c)
+	case "admission approve":
+		if len(args) != 3 && len(args) != 4 {
+			return errUsage
+		}
+		return approveDevice(c, args[2], args[3:])
+	case "admission forget":
+		if len(args) != 3 {
+			return errUsage
+		}
+		if err := c.delete("/api/v1/admission/"+url.PathEscape(args[2]), nil); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %v from the pending list\n", args[2])
+		return nil
+	case "alias list":
+		return listAliases(c)
+	case "alias set":
+		if len(args) < 4 || len(args) > 7 {
+			return errUsage
+		}
+		return setAlias(c, args[2], args[3:])
+	case "alias remove":
+		if len(args) != 3 {
+			return errUsage
+		}
+		if err := c.delete("/api/v1/alias/"+url.PathEscape(args[2]), nil); err != nil {
+			return err
+		}
+		fmt.Printf("Removed the name of %v\n", args[2])
+		return nil
+	case "maintenance list":
+		return listMaintenance(c)
+	case "maintenance add":
+		if len(args) != 6 && len(args) != 7 {
+			return errUsage
+		}
+		return addMaintenance(c, args[2:])
+	case "maintenance remove":
+		if len(args) != 3 {
+			return errUsage
+		}
+		if err := c.delete("/api/v1/maintenance/"+url.PathEscape(args[2]), nil); err != nil {
+			return err
+		}
+		fmt.Printf("Removed the maintenance window %v\n", args[2])
+		return nil
+	case "port list":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return listPorts(c, args[2])
+	case "link list":
+		return listLinks(c)
+	case "host list":
+		return listHosts(c)
+	case "flow dump":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return dumpFlows(c, args[2])
+	case "flow audit", "flow repair":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return auditFlows(c, args[2], args[1] == "repair")
+	case "flow flush":
+		if len(args) != 3 {
+			return errUsage
+		}
+		if err := c.delete("/api/v1/flow/"+url.PathEscape(args[2]), nil); err != nil {
+			return err
+		}
+		fmt.Printf("Flushed the flows toward %v\n", args[2])
+		return nil
+	case "packet in", "packet out":
+		if len(args) != 5 {
+			return errUsage
+		}
+		return sendPacket(c, args[1], args[2], args[3], args[4])
+	case "packet arp":
+		if len(args) != 5 {
+			return errUsage
+		}
+		return printARPRequest(args[2], args[3], args[4])
+	case "trace":
+		if len(args) != 4 && (len(args) < 6 || len(args) > 8) {
+			return errUsage
+		}
+		return tracePath(c, args[1], args[2], args[3], args[4:])
+	case "capture list":
+		return listCaptures(c)
+	case "capture start", "capture stop":
+		if len(args) != 3 && (len(args) != 4 || args[1] != "start") {
+			return errUsage
+		}
+		return toggleCapture(c, args[2], args[1] == "start", args[3:])
+	case "capture save":
+		if len(args) != 4 {
+			return errUsage
+		}
+		return saveCapture(c, args[2], args[3])
+	case "capture clear":
+		if len(args) != 3 {
+			return errUsage
+		}
+		if err := c.delete("/api/v1/device/"+url.PathEscape(args[2])+"/capture", nil); err != nil {
+			return err
+		}
+		fmt.Printf("Discarded the capture of %v\n", args[2])
+		return nil
+	case "record start", "record stop", "record show":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return toggleRecord(c, args[1])
+	case "dryrun show":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return showDryRun(c)
+	case "dryrun set":
+		if len(args) < 3 || (args[2] != "on" && args[2] != "off") {
+			return errUsage
+		}
+		return setDryRun(c, args[2] == "on", args[3:])
+	case "dryrun clear":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := c.delete("/api/v1/dryrun", nil); err != nil {
+			return err
+		}
+		fmt.Println("Forgot the recorded FLOW_MODs")
+		return nil
+	case "app list":
+		return listApps(c)
+	case "cluster list":
+		return listClusterMembers(c)
+	case "app enable", "app disable":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return toggleApp(c, args[2], args[1] == "enable")
+	case "config reload":
+		if err := c.call(http.MethodPost, "/api/v1/config/reload", nil, nil); err != nil {
+			return err
+		}
+		fmt.Println("Reloaded the configuration")
+		return nil
+	case "log get":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return showLogLevel(c, args[2], "")
+	case "log set":
+		if len(args) != 4 {
+			return errUsage
+		}
+		return showLogLevel(c, args[2], args[3])
+	case "events":
+		return tailEvents(c, args[1:])
+	case "audit":
+		if len(args) > 2 {
+			return errUsage
+		}
+		return listAudits(c, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// output prints v as JSON if -json is set, or calls table otherwise.
+func output(v interface{}, table func(w io.Writer)) error {
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	table(w)
+
+	return w.Flush()
+}
+
+func listSwitches(c *client) error {
+	v := struct {
+		Switches []network.Switch `json:"switches"`
+	}{}
+	if err := c.get("/api/v1/switch", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tDPID\tPORTS\tFIRST PORT\tDESCRIPTION")
+		for _, s := range v.Switches {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", s.ID, s.DPID, s.NumPorts, s.FirstPort, s.Description)
+		}
+	})
+}
+
+func listDevices(c *client) error {
+	v := struct {
+		Devices []network.DeviceInfo `json:"devices"`
+	}{}
+	if err := c.get("/api/v1/device", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "DPID\tNAME\tPORTS\tTABLES\tMANUFACTURER\tHARDWARE\tSOFTWARE")
+		for _, d := range v.Devices {
+			name := "-"
+			if d.Alias != nil {
+				name = d.Alias.Name
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", d.DPID, name, d.NumPorts, d.NumTables,
+				d.Descriptions.Manufacturer, d.Descriptions.Hardware, d.Descriptions.Software)
+		}
+	})
+}
+
+func listAdmission(c *client) error {
+	v := struct {
+		Mode    string                  `json:"mode"`
+		Allowed []uint64                `json:"allowed"`
+		Pending []network.PendingDevice `json:"pending"`
+	}{}
+	if err := c.get("/api/v1/admission", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintf(w, "Admission: %v\n", v.Mode)
+		fmt.Fprintf(w, "Allowed: %v\n\n", v.Allowed)
+		fmt.Fprintln(w, "DPID\tADDRESS\tFIRST SEEN\tLAST SEEN\tATTEMPTS")
+		for _, d := range v.Pending {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", d.DPID, d.Address,
+				d.FirstSeen.Format(time.RFC3339), d.LastSeen.Format(time.RFC3339), d.Attempts)
+		}
+	})
+}
+
+func approveDevice(c *client, dpid string, desc []string) error {
+	var body interface{}
+	if len(desc) > 0 {
+		body = map[string]string{"description": desc[0]}
+	}
+	if err := c.call(http.MethodPost, "/api/v1/admission/"+url.PathEscape(dpid), body, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Approved %v, which is admitted when it connects again\n", dpid)
+
+	return nil
+}
+
+func listAliases(c *client) error {
+	v := struct {
+		Aliases []network.SwitchAlias `json:"aliases"`
+	}{}
+	if err := c.get("/api/v1/alias", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "DPID\tNAME\tSITE\tRACK\tROLE")
+		for _, a := range v.Aliases {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", a.DPID, a.Name, a.Site, a.Rack, a.Role)
+		}
+	})
+}
+
+// setAlias names the switch of dpid by the name, site, rack and role in args.
+func setAlias(c *client, dpid string, args []string) error {
+	alias := network.SwitchAlias{}
+	for i, v := range []*string{&alias.Name, &alias.Site, &alias.Rack, &alias.Role} {
+		if i < len(args) {
+			*v = args[i]
+		}
+	}
+	if err := c.call(http.MethodPut, "/api/v1/alias/"+url.PathEscape(dpid), alias, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Named %v as %v\n", dpid, alias.Name)
+
+	return nil
+}
+
+func listMaintenance(c *client) error {
+	v := struct {
+		Windows []struct {
+			network.MaintenanceWindow
+			Active bool `json:"active"`
+		} `json:"windows"`
+	}{}
+	if err := c.get("/api/v1/maintenance", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tDPID\tPORT\tSTART\tEND\tACTIVE\tDESCRIPTION")
+		for _, m := range v.Windows {
+			port := "all"
+			if m.Port != 0 {
+				port = strconv.FormatUint(uint64(m.Port), 10)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", m.ID, m.DPID, port, m.Start.Local().Format(time.RFC3339), m.End.Local().Format(time.RFC3339), m.Active, m.Description)
+		}
+	})
+}
+
+// addMaintenance schedules the maintenance window of the DPID, the port, the
+// start and the end times, and the optional description in args.
+func addMaintenance(c *client, args []string) error {
+	dpid, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid DPID: %v", args[0])
+	}
+	port, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid port: %v", args[1])
+	}
+	window := network.MaintenanceWindow{DPID: dpid, Port: uint32(port)}
+	if window.Start, err = time.Parse(time.RFC3339, args[2]); err != nil {
+		return fmt.Errorf("invalid start time: %v", err)
+	}
+	if window.End, err = time.Parse(time.RFC3339, args[3]); err != nil {
+		return fmt.Errorf("invalid end time: %v", err)
+	}
+	if len(args) > 4 {
+		window.Description = args[4]
+	}
+	if err := c.call(http.MethodPost, "/api/v1/maintenance", window, &window); err != nil {
+		return err
+	}
+	fmt.Printf("Scheduled the maintenance window %v\n", window.ID)
+
+	return nil
+}
+
+func listPorts(c *client, dpid string) error {
+	v := struct {
+		Ports []network.PortInfo `json:"ports"`
+	}{}
+	if err := c.get("/api/v1/device/"+url.PathEscape(dpid)+"/port", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "NUMBER\tNAME\tMAC\tADMIN\tLINK\tSPEED(MB)\tEDGE\tSTP")
+		for _, p := range v.Ports {
+			stp := "-"
+			if p.Edge {
+				stp = upDown(!p.Disabled, "forwarding", "blocking")
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", p.Number, p.Name, p.MAC,
+				upDown(p.AdminUp, "up", "down"), upDown(p.LinkUp, "up", "down"), p.Speed, p.Edge, stp)
+		}
+	})
+}
+
+func listLinks(c *client) error {
+	v := struct {
+		Links []network.LinkInfo `json:"links"`
+	}{}
+	if err := c.get("/api/v1/link", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "PORT\tPORT\tSTP\tLATENCY\tUTILIZATION")
+		for _, l := range v.Links {
+			latency := "-"
+			if l.Latency > 0 {
+				latency = fmt.Sprintf("%.3fms", l.Latency)
+			}
+			// Both directions of the link.
+			utilization := "-"
+			if len(l.Traffic) == 2 {
+				utilization = fmt.Sprintf("%.1f%%/%.1f%%", l.Traffic[0].Utilization*100, l.Traffic[1].Utilization*100)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", l.Ports[0], l.Ports[1], upDown(l.Enabled, "forwarding", "blocking"), latency, utilization)
+		}
+	})
+}
+
+func listHosts(c *client) error {
+	v := struct {
+		Hosts []network.Host `json:"hosts"`
+	}{}
+	if err := c.get("/api/v1/host", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tIP\tMAC\tPORT\tSTALE\tDESCRIPTION")
+		for _, h := range v.Hosts {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", h.ID, h.IP, h.MAC, h.Port, h.Stale, h.Description)
+		}
+	})
+}
+
+func dumpFlows(c *client, dpid string) error {
+	v := struct {
+		Flows []network.FlowInfo `json:"flows"`
+	}{}
+	if err := c.get("/api/v1/device/"+url.PathEscape(dpid)+"/flow", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "TABLE\tPRIORITY\tCOOKIE\tIDLE\tHARD\tDURATION\tPACKETS\tBYTES\tMATCH")
+		for _, f := range v.Flows {
+			fmt.Fprintf(w, "%v\t%v\t0x%x\t%v\t%v\t%v\t%v\t%v\t%v\n", f.TableID, f.Priority, f.Cookie,
+				f.IdleTimeout, f.HardTimeout, f.Duration, f.PacketCount, f.ByteCount, formatMatch(f.Match))
+		}
+	})
+}
+
+// auditFlows prints the difference between the flows of a device and the ones
+// installed by the controller, which is also fixed if repair is true.
+func auditFlows(c *client, dpid string, repair bool) error {
+	var v network.FlowAudit
+	path := "/api/v1/device/" + url.PathEscape(dpid) + "/flow/"
+	if repair {
+		if err := c.call(http.MethodPost, path+"reconcile", nil, &v); err != nil {
+			return err
+		}
+	} else {
+		if err := c.get(path+"audit", &v); err != nil {
+			return err
+		}
+	}
+
+	err := output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "STATE\tTABLE\tPRIORITY\tCOOKIE\tIDLE\tHARD\tMATCH")
+		for _, f := range v.Orphans {
+			fmt.Fprintf(w, "orphan\t%v\t%v\t0x%x\t%v\t%v\t%v\n", f.TableID, f.Priority, f.Cookie, f.IdleTimeout, f.HardTimeout, formatMatch(f.Match))
+		}
+		for _, f := range v.Missing {
+			fmt.Fprintf(w, "missing\t%v\t%v\t0x%x\t%v\t%v\t%v\n", f.TableID, f.Priority, f.Cookie, f.IdleTimeout, f.HardTimeout, formatMatch(f.Match))
+		}
+	})
+	if err != nil || *asJSON {
+		return err
+	}
+	fmt.Printf("\n%v matched, %v orphans, %v missing\n", v.Matched, len(v.Orphans), len(v.Missing))
+	if !v.Complete {
+		fmt.Println("Warning: the controller does not remember all the flows it has installed")
+	}
+	if v.Repaired {
+		fmt.Println("Repaired the flows")
+	}
+
+	return nil
+}
+
+func formatMatch(m map[string]string) string {
+	if len(m) == 0 {
+		return "*"
+	}
+
+	// Same order as the OpenFlow match fields.
+	fields := []string{"in_port", "src_mac", "dst_mac", "vlan_id", "ether_type", "src_ip", "dst_ip", "ip_protocol", "src_port", "dst_port"}
+	v := []string{}
+	for _, f := range fields {
+		if value, ok := m[f]; ok {
+			v = append(v, f+"="+value)
+		}
+	}
+
+	return strings.Join(v, ",")
+}
+
+func listCaptures(c *client) error {
+	v := struct {
+		Captures []network.CaptureInfo `json:"captures"`
+	}{}
+	if err := c.get("/api/v1/capture", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "DPID\tCAPTURING\tLENGTH\tSIZE")
+		for _, v := range v.Captures {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", v.DPID, v.Enabled, v.Length, v.Size)
+		}
+	})
+}
+
+// toggleCapture starts or stops capturing a device. size is the optional
+// maximum bytes of the capture.
+func toggleCapture(c *client, dpid string, enabled bool, size []string) error {
+	body := struct {
+		Enabled bool `json:"enabled"`
+		Size    int  `json:"size,omitempty"`
+	}{Enabled: enabled}
+	if len(size) > 0 {
+		n, err := strconv.Atoi(size[0])
+		if err != nil {
+			return fmt.Errorf("invalid size: %v", size[0])
+		}
+		body.Size = n
+	}
+	var v network.CaptureInfo
+	if err := c.put("/api/v1/device/"+url.PathEscape(dpid)+"/capture", body, &v); err != nil {
+		return err
+	}
+	if enabled {
+		fmt.Printf("Capturing %v up to %v bytes\n", dpid, v.Size)
+	} else {
+		fmt.Printf("Stopped capturing %v (%v bytes captured)\n", dpid, v.Length)
+	}
+
+	return nil
+}
+
+func saveCapture(c *client, dpid, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := c.download("/api/v1/device/"+url.PathEscape(dpid)+"/capture", f); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Saved the capture of %v to %v\n", dpid, file)
+
+	return nil
+}
+
+// toggleRecord starts or stops recording the PACKET_INs, or shows the status
+// of the recording if cmd is "show".
+func toggleRecord(c *client, cmd string) error {
+	var v network.RecordInfo
+	path := "/api/v1/packetin/record"
+	if cmd == "show" {
+		if err := c.get(path, &v); err != nil {
+			return err
+		}
+	} else {
+		body := struct {
+			Enabled bool `json:"enabled"`
+		}{cmd == "start"}
+		if err := c.put(path, body, &v); err != nil {
+			return err
+		}
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "RECORDING\tFILE\tRECORDS")
+		fmt.Fprintf(w, "%v\t%v\t%v\n", v.Enabled, v.File, v.Records)
+	})
+}
+
+func showDryRun(c *client) error {
+	var v network.DryRunInfo
+	if err := c.get("/api/v1/dryrun", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintf(w, "Dry run: enabled=%v, apps=%v, recorded=%v\n\n", v.Enabled, strings.Join(v.Apps, ","), v.Recorded)
+		fmt.Fprintln(w, "TIME\tDPID\tAPP\tCOMMAND\tTABLE\tPRIORITY\tCOOKIE\tMATCH\tERROR")
+		for _, f := range v.Flows {
+			match := make([]string, 0, len(f.Match))
+			for k, m := range f.Match {
+				match = append(match, k+"="+m)
+			}
+			sort.Strings(match)
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%#x\t%v\t%v\n", f.Time.Local().Format(time.RFC3339), f.DPID, f.App, f.Command, f.TableID, f.Priority, f.Cookie, strings.Join(match, ","), f.Error)
+		}
+	})
+}
+
+// setDryRun records the FLOW_MODs of all the applications if enabled is true,
+// or only the ones of apps otherwise.
+func setDryRun(c *client, enabled bool, apps []string) error {
+	body := struct {
+		Enabled bool     `json:"enabled"`
+		Apps    []string `json:"apps"`
+	}{enabled, apps}
+	var v network.DryRunInfo
+	if err := c.put("/api/v1/dryrun", body, &v); err != nil {
+		return err
+	}
+	fmt.Printf("Dry run: enabled=%v, apps=%v\n", v.Enabled, strings.Join(v.Apps, ","))
+
+	return nil
+}
+
+type appStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Order   int    `json:"order"`
+	Status  string `json:"status"`
+}
+
+func listApps(c *client) error {
+	v := struct {
+		Apps []appStatus `json:"apps"`
+	}{}
+	if err := c.get("/api/v1/app", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "ORDER\tNAME\tENABLED\tSTATUS")
+		for _, a := range v.Apps {
+			order := "-"
+			if a.Enabled {
+				order = fmt.Sprint(a.Order)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", order, a.Name, a.Enabled, strings.TrimSpace(a.Status))
+		}
+	})
+}
+
+func listClusterMembers(c *client) error {
+	v := struct {
+		Self    cluster.Member   `json:"self"`
+		Members []cluster.Member `json:"members"`
+	}{}
+	if err := c.get("/api/v1/cluster", &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME	ADDRESS	ROLE	HEARTBEAT	UID")
+		for _, m := range v.Members {
+			name := m.Name
+			if m.UID == v.Self.UID {
+				name += " (*)"
+			}
+			fmt.Fprintf(w, "%v	%v	%v	%v	%.12v\n", name, m.Address, upDown(m.Leader, "leader", "standby"),
+				m.Timestamp.Local().Format(time.RFC3339), m.UID)
+		}
+	})
+}
+
+// sendPacket injects frame as a PACKET_IN from the port if dir is "in", or
+// sends it out to the port if dir is "out".
+func sendPacket(c *client, dir, dpid, port, frame string) error {
+	body := struct {
+		Frame string `json:"frame"`
+	}{frame}
+	path := fmt.Sprintf("/api/v1/device/%v/port/%v/packet-%v", url.PathEscape(dpid), url.PathEscape(port), dir)
+	if err := c.call(http.MethodPost, path, body, nil); err != nil {
+		return err
+	}
+	if dir == "in" {
+		fmt.Printf("Injected the frame from %v:%v\n", dpid, port)
+	} else {
+		fmt.Printf("Sent the frame out to %v:%v\n", dpid, port)
+	}
+
+	return nil
+}
+
+// tracePath prints the path of a probe toward dstMAC received from the port.
+// The probe is an IPv4 packet if ip has the source and destination addresses,
+// which may be followed by the protocol and the destination port.
+func tracePath(c *client, dpid, port, dstMAC string, ip []string) error {
+	body := struct {
+		DstMAC   string `json:"dst_mac"`
+		SrcIP    string `json:"src_ip,omitempty"`
+		DstIP    string `json:"dst_ip,omitempty"`
+		Protocol string `json:"protocol,omitempty"`
+		SrcPort  uint16 `json:"src_port,omitempty"`
+		DstPort  uint16 `json:"dst_port,omitempty"`
+	}{DstMAC: dstMAC}
+	if len(ip) >= 2 {
+		body.SrcIP, body.DstIP = ip[0], ip[1]
+	}
+	if len(ip) >= 3 {
+		body.Protocol = ip[2]
+	}
+	if len(ip) == 4 {
+		v, err := strconv.ParseUint(ip[3], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid destination port: %v", ip[3])
+		}
+		// Any ephemeral port.
+		body.SrcPort, body.DstPort = 49152, uint16(v)
+	}
+
+	var v network.PathTrace
+	path := fmt.Sprintf("/api/v1/device/%v/port/%v/trace", url.PathEscape(dpid), url.PathEscape(port))
+	if err := c.call(http.MethodPost, path, body, &v); err != nil {
+		return err
+	}
+
+	err := output(v, func(w io.Writer) {
+		fmt.Fprintln(w, "HOP\tDPID\tIN_PORT\tOUT_PORTS\tNOTE")
+		for i, h := range v.Hops {
+			out := "-"
+			if len(h.OutPorts) > 0 {
+				out = strings.Trim(fmt.Sprint(h.OutPorts), "[]")
+			}
+			notes := []string{}
+			if h.ToController {
+				notes = append(notes, "sent to the controller")
+			}
+			if h.Loop {
+				notes = append(notes, "loop")
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", i, h.DPID, h.InPort, out, strings.Join(notes, ", "))
+		}
+	})
+	if err != nil || *asJSON {
+		return err
+	}
+	fmt.Printf("\nProbe %v", v.Probe)
+	if v.Destination != "" {
+		fmt.Printf(", destination %v at %v", dstMAC, v.Destination)
+	}
+	fmt.Println()
+	if !v.Complete {
+		fmt.Println("Warning: the probe was still moving when the trace timed out")
+	}
+
+	return nil
+}
+
+func printARPRequest(mac, ip, target string) error {
+	sha, err := net.ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+	spa, tpa := net.ParseIP(ip).To4(), net.ParseIP(target).To4()
+	if spa == nil || tpa == nil {
+		return errors.New("invalid IPv4 address")
+	}
+
+	arp, err := protocol.NewARPRequest(sha, spa, tpa).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	frame, err := protocol.Ethernet{
+		SrcMAC:  sha,
+		DstMAC:  net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		Type:    0x0806,
+		Payload: arp,
+	}.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	fmt.Println(hex.EncodeToString(frame))
+
+	return nil
+}
+
+func toggleApp(c *client, name string, enabled bool) error {
+	body := struct {
+		Enabled bool `json:"enabled"`
+	}{enabled}
+	if err := c.put("/api/v1/app/"+url.PathEscape(name), body, nil); err != nil {
+		return err
+	}
+	fmt.Printf("%v application has been %v\n", name, upDown(enabled, "enabled", "disabled"))
+
+	return nil
+}
+
+// showLogLevel shows the log level of module after changing it to level if level is not empty.
+func showLogLevel(c *client, module, level string) error {
+	v := struct {
+		Module string `json:"module"`
+		Level  string `json:"level"`
+	}{}
+	path := "/api/v1/log/" + url.PathEscape(module)
+	var err error
+	if level == "" {
+		err = c.get(path, &v)
+	} else {
+		err = c.put(path, struct {
+			Level string `json:"level"`
+		}{level}, &v)
+	}
+	if err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		fmt.Fprintf(w, "%v\t%v\n", v.Module, v.Level)
+	})
+}
+
+func tailEvents(c *client, types []string) error {
+	path := "/api/v1/events"
+	if len(types) > 0 {
+		path += "?type=" + url.QueryEscape(strings.Join(types, ","))
+	}
+
+	err := c.events(path, func(t string, data []byte) error {
+		if *asJSON {
+			fmt.Println(string(data))
+			return nil
+		}
+
+		e := struct {
+			Timestamp time.Time       `json:"timestamp"`
+			Data      json.RawMessage `json:"data"`
+		}{}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		fmt.Printf("%v %-16v %s\n", e.Timestamp.Local().Format("2006-01-02 15:04:05.000"), t, e.Data)
+		return nil
+	})
+	if err == io.EOF {
+		return errors.New("event stream has been closed by the controller")
+	}
+
+	return err
+}
+
+// listAudits lists the audit records persisted by the Journal application.
+func listAudits(c *client, since []string) error {
+	query := url.Values{}
+	query.Set("type", "AuditRecorded")
+	query.Set("limit", "1000")
+	if len(since) > 0 {
+		query.Set("since", since[0])
+	}
+	v := struct {
+		Entries []struct {
+			Message   string    `json:"message"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"entries"`
+	}{}
+	if err := c.get("/api/v1/journal?"+query.Encode(), &v); err != nil {
+		return err
+	}
+
+	return output(v, func(w io.Writer) {
+		// The entries are in descending order.
+		for i := len(v.Entries) - 1; i >= 0; i-- {
+			e := v.Entries[i]
+			fmt.Fprintf(w, "%v  %v\n", e.Timestamp.Local().Format("2006-01-02 15:04:05"), e.Message)
+		}
+	})
+}
+
+func upDown(v bool, up, down string) string {
+	if v {
+		return up
+	}
+
+	return down
+}
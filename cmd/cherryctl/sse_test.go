@@ -0,0 +1,51 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadEvents(t *testing.T) {
+	stream := ": keepalive\n\n" +
+		"event: PortUp\ndata: {\"a\":1}\n\n" +
+		"event: DeviceDown\ndata: {\"b\":\ndata: 2}\n\n"
+
+	types := []string{}
+	data := []string{}
+	err := readEvents(strings.NewReader(stream), func(t string, d []byte) error {
+		types = append(types, t)
+		data = append(data, string(d))
+		return nil
+	})
+	if err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(types, ",") != "PortUp,DeviceDown" {
+		t.Fatalf("unexpected event types: %v", types)
+	}
+	if data[0] != `{"a":1}` || data[1] != "{\"b\":\n2}" {
+		t.Fatalf("unexpected event data: %q", data)
+	}
+}
@@ -0,0 +1,382 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/superkkt/viper"
+)
+
+// Prefix of the environment variables that override the config file, e.g.,
+// CHERRY_DATABASE_PASSWORD overrides database.password.
+const configEnvPrefix = "CHERRY"
+
+type configType int
+
+const (
+	configString configType = iota
+	configInt
+	configBool
+	configFloat
+	// Map of the string values whose keys are arbitrary.
+	configMap
+)
+
+type configKey struct {
+	typ configType
+	// Unit of the integer durations, e.g., seconds.
+	unit string
+}
+
+// configSchema is all the keys of the config file. cherry.yaml documents them
+// and their default values.
+var configSchema = map[string]configKey{
+	"default.port":                  {typ: configInt},
+	"default.listen":                {typ: configString},
+	"default.log_level":             {typ: configString},
+	"default.log_modules":           {typ: configMap},
+	"default.log_output":            {typ: configString},
+	"default.log_format":            {typ: configString},
+	"default.applications":          {typ: configString},
+	"default.application_scopes":    {typ: configMap},
+	"default.plugins":               {typ: configString},
+	"default.vlan_id":               {typ: configInt},
+	"default.admin_email":           {typ: configString},
+	"default.packet_in_workers":     {typ: configInt},
+	"default.write_flush_interval":  {typ: configInt, unit: "microseconds"},
+	"default.write_flush_threshold": {typ: configInt},
+	"default.packet_in_record_file": {typ: configString},
+	"default.link_latency_interval": {typ: configInt, unit: "seconds"},
+	"default.port_stats_interval":   {typ: configInt, unit: "seconds"},
+	"default.path_selection":        {typ: configString},
+	"default.reroute_utilization":   {typ: configFloat},
+	"default.reroute_intervals":     {typ: configInt},
+	"default.packet_sampling":       {typ: configFloat},
+	"default.sample_window":         {typ: configInt, unit: "milliseconds"},
+	"default.dry_run":               {typ: configBool},
+	"default.dry_run_apps":          {typ: configString},
+	"default.switch_admission":      {typ: configString},
+	"default.allowed_dpids":         {typ: configString},
+	"default.tls":                   {typ: configBool},
+	"default.cert_file":             {typ: configString},
+	"default.key_file":              {typ: configString},
+	"default.client_ca_file":        {typ: configString},
+	"default.device_certificates":   {typ: configString},
+	"default.quirks":                {typ: configMap},
+
+	"syslog.server":   {typ: configString},
+	"syslog.protocol": {typ: configString},
+	"syslog.facility": {typ: configString},
+	"syslog.ca_file":  {typ: configString},
+
+	"l2switch.storm_threshold":      {typ: configInt},
+	"l2switch.storm_block_duration": {typ: configInt, unit: "seconds"},
+
+	"discovery.probe_interval":         {typ: configInt, unit: "milliseconds"},
+	"discovery.probe_jitter":           {typ: configInt, unit: "milliseconds"},
+	"discovery.probe_batch":            {typ: configInt},
+	"discovery.stale_expiration":       {typ: configInt, unit: "seconds"},
+	"discovery.undiscovered_interval":  {typ: configInt, unit: "seconds"},
+	"discovery.duplicate_ip_block":     {typ: configInt, unit: "seconds"},
+	"discovery.flap_threshold":         {typ: configInt},
+	"discovery.flap_window":            {typ: configInt, unit: "seconds"},
+	"discovery.flap_dampening":         {typ: configInt, unit: "seconds"},
+	"discovery.probe_rate":             {typ: configInt},
+	"discovery.max_concurrent_senders": {typ: configInt},
+	"discovery.passive_learning":       {typ: configBool},
+	"discovery.max_probe_backoff":      {typ: configInt, unit: "seconds"},
+	"discovery.exclude":                {typ: configString},
+	"discovery.probe_mac":              {typ: configString},
+	"discovery.probe_sources":          {typ: configString},
+
+	"database.driver":            {typ: configString},
+	"database.path":              {typ: configString},
+	"database.host":              {typ: configString},
+	"database.port":              {typ: configInt},
+	"database.user":              {typ: configString},
+	"database.password":          {typ: configString},
+	"database.name":              {typ: configString},
+	"database.sslmode":           {typ: configString},
+	"database.max_open_conns":    {typ: configInt},
+	"database.max_idle_conns":    {typ: configInt},
+	"database.conn_max_lifetime": {typ: configInt, unit: "seconds"},
+	"database.timeout":           {typ: configInt, unit: "seconds"},
+	"database.max_retry":         {typ: configInt},
+	"database.retry_interval":    {typ: configInt, unit: "milliseconds"},
+	"database.cache_ttl":         {typ: configInt, unit: "seconds"},
+	"database.etcd.endpoints":    {typ: configString},
+	"database.etcd.prefix":       {typ: configString},
+
+	"cluster.name":                 {typ: configString},
+	"cluster.address":              {typ: configString},
+	"cluster.election_timeout":     {typ: configInt, unit: "seconds"},
+	"cluster.replication_interval": {typ: configInt, unit: "seconds"},
+	"cluster.sharding":             {typ: configBool},
+	"cluster.assignments":          {typ: configMap},
+
+	"rest.port":      {typ: configInt},
+	"rest.tls":       {typ: configBool},
+	"rest.cert_file": {typ: configString},
+	"rest.key_file":  {typ: configString},
+	"rest.pprof":     {typ: configBool},
+
+	"api.tokens":         {typ: configString},
+	"api.clients":        {typ: configString},
+	"api.client_ca_file": {typ: configString},
+
+	"tracing.sample_rate":   {typ: configFloat},
+	"tracing.otlp_endpoint": {typ: configString},
+	"tracing.otlp_insecure": {typ: configBool},
+
+	"auth.methods":          {typ: configString},
+	"auth.radius_host":      {typ: configString},
+	"auth.radius_port":      {typ: configInt},
+	"auth.radius_secret":    {typ: configString},
+	"auth.radius_timeout":   {typ: configInt, unit: "seconds"},
+	"auth.radius_dead_time": {typ: configInt, unit: "seconds"},
+	"auth.cache_ttl":        {typ: configInt, unit: "seconds"},
+	"auth.mac_password":     {typ: configString},
+	"auth.nas_identifier":   {typ: configString},
+
+	"portal.url": {typ: configString},
+	"portal.ip":  {typ: configString},
+
+	"acl.default_policy":  {typ: configString},
+	"acl.source":          {typ: configString},
+	"acl.source_checksum": {typ: configString},
+	"acl.source_interval": {typ: configInt, unit: "seconds"},
+
+	"ids.mode":      {typ: configString},
+	"ids.collector": {typ: configString},
+	"ids.selectors": {typ: configString},
+
+	"ddos.syn_flood_threshold":     {typ: configInt},
+	"ddos.arp_flood_threshold":     {typ: configInt},
+	"ddos.amplification_threshold": {typ: configInt},
+	"ddos.reflector_ports":         {typ: configString},
+	"ddos.action":                  {typ: configString},
+	"ddos.queue":                   {typ: configInt},
+	"ddos.idle_timeout":            {typ: configInt, unit: "seconds"},
+	"ddos.duration":                {typ: configInt, unit: "seconds"},
+
+	"elephant.interval":     {typ: configInt, unit: "seconds"},
+	"elephant.threshold":    {typ: configInt},
+	"elephant.min_duration": {typ: configInt, unit: "seconds"},
+
+	"sflow.collector":        {typ: configString},
+	"sflow.agent_ip":         {typ: configString},
+	"sflow.sampling_rate":    {typ: configInt},
+	"sflow.polling_interval": {typ: configInt, unit: "seconds"},
+	"sflow.header_size":      {typ: configInt},
+
+	"ipfix.collector": {typ: configString},
+	"ipfix.interval":  {typ: configInt, unit: "seconds"},
+
+	"router.interfaces":    {typ: configString},
+	"router.routes":        {typ: configString},
+	"router.bgp.local_as":  {typ: configInt},
+	"router.bgp.router_id": {typ: configString},
+	"router.bgp.peer":      {typ: configString},
+	"router.bgp.peer_as":   {typ: configInt},
+	"router.bgp.hold_time": {typ: configInt, unit: "seconds"},
+
+	"journal.retention": {typ: configInt, unit: "days"},
+
+	"snmp.port":             {typ: configInt},
+	"snmp.community":        {typ: configString},
+	"snmp.location":         {typ: configString},
+	"snmp.polling_interval": {typ: configInt, unit: "seconds"},
+	"snmp.enterprise_oid":   {typ: configString},
+
+	"ovsdb.managers": {typ: configString},
+	"ovsdb.timeout":  {typ: configInt, unit: "seconds"},
+
+	"grpc.port":              {typ: configInt},
+	"grpc.tls":               {typ: configBool},
+	"grpc.cert_file":         {typ: configString},
+	"grpc.key_file":          {typ: configString},
+	"grpc.processor_timeout": {typ: configInt, unit: "milliseconds"},
+}
+
+// validateSchema checks that all the keys in the config file are known and all
+// the values have the right types. It returns all the problems at once.
+func validateSchema() error {
+	problems := []string{}
+
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := configSchema[key]; ok || isMapEntry(key) {
+			continue
+		}
+		msg := fmt.Sprintf("unknown key %v", key)
+		if v := similarConfigKey(key); v != "" {
+			msg += fmt.Sprintf(" (did you mean %v?)", v)
+		}
+		problems = append(problems, msg)
+	}
+
+	keys = make([]string, 0, len(configSchema))
+	for key := range configSchema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := viper.Get(key)
+		if value == nil {
+			continue
+		}
+		if err := configSchema[key].check(value); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid %v: %v", key, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+func (r configKey) check(value interface{}) error {
+	switch r.typ {
+	case configString:
+		switch value.(type) {
+		case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+			return fmt.Errorf("expected a string, got %v", value)
+		}
+	case configInt:
+		if f, ok := value.(float64); ok && f != math.Trunc(f) {
+			return fmt.Errorf("expected an integer%v, got %v", r.unitSuffix(), value)
+		}
+		if _, err := cast.ToInt64E(value); err != nil {
+			return fmt.Errorf("expected an integer%v, got %q", r.unitSuffix(), fmt.Sprint(value))
+		}
+	case configBool:
+		if _, err := cast.ToBoolE(value); err != nil {
+			return fmt.Errorf("expected true or false, got %q", fmt.Sprint(value))
+		}
+	case configFloat:
+		if _, err := cast.ToFloat64E(value); err != nil {
+			return fmt.Errorf("expected a number, got %q", fmt.Sprint(value))
+		}
+	case configMap:
+		if _, err := cast.ToStringMapStringE(value); err != nil {
+			return fmt.Errorf("expected a map, got %v", value)
+		}
+	}
+
+	return nil
+}
+
+func (r configKey) unitSuffix() string {
+	if r.unit == "" {
+		return ""
+	}
+
+	return " number of " + r.unit
+}
+
+// isMapEntry returns whether key is an entry of a map key such as default.log_modules.network.
+func isMapEntry(key string) bool {
+	i := strings.LastIndex(key, ".")
+	if i < 0 {
+		return false
+	}
+	v, ok := configSchema[key[:i]]
+
+	return ok && v.typ == configMap
+}
+
+// similarConfigKey returns the known key that is most similar to key, or an
+// empty string if there is no similar one.
+func similarConfigKey(key string) string {
+	result, min := "", 4 // Maximum edit distance of the suggestions.
+	for k := range configSchema {
+		if d := editDistance(key, k); d < min || (d == min && k < result) {
+			result, min = k, d
+		}
+	}
+
+	return result
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+
+	return m
+}
+
+// printConfig prints the effective value of all the keys, which are read from
+// the config file or the environment variables. The secrets are masked.
+func printConfig() {
+	keys := make([]string, 0, len(configSchema))
+	for key := range configSchema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := viper.Get(key)
+		switch {
+		case value == nil:
+			fmt.Printf("%v = (default)\n", key)
+		case strings.HasSuffix(key, "password") || strings.HasSuffix(key, "secret") || key == "api.tokens" || key == "snmp.community":
+			fmt.Printf("%v = ********\n", key)
+		default:
+			fmt.Printf("%v = %v\n", key, value)
+		}
+	}
+}
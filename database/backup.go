@@ -0,0 +1,344 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/acl"
+	"github.com/superkkt/cherry/northbound/app/pbr"
+)
+
+const backupVersion = 1
+
+// Backup is the portable state of the controller, which is independent of the
+// database backend. The IDs in a backup are only meaningful inside it: they are
+// reassigned when the backup is restored. The host locations are not included
+// as they are discovered again by the controller.
+type Backup struct {
+	Version   int                    `json:"version"`
+	Timestamp time.Time              `json:"timestamp"`
+	Switches  []network.SwitchParam  `json:"switches"`
+	Networks  []network.NetworkParam `json:"networks"`
+	Hosts     []backupHost           `json:"hosts"`
+	VIPs      []backupVIP            `json:"vips"`
+	MACRules  []backupMACRule        `json:"mac_rules"`
+	Policies  []backupPolicy         `json:"policies"`
+	// Aliases is missing in the backups of the older versions.
+	Aliases []network.SwitchAlias `json:"switch_aliases,omitempty"`
+}
+
+type backupHost struct {
+	ID          uint64 `json:"id"`
+	IP          string `json:"ip"`
+	MAC         string `json:"mac"`
+	Description string `json:"description"`
+}
+
+type backupVIP struct {
+	IP            string `json:"ip"`
+	ActiveHostID  uint64 `json:"active_host_id"`
+	StandbyHostID uint64 `json:"standby_host_id"`
+	Description   string `json:"description"`
+}
+
+type backupMACRule struct {
+	MAC   string `json:"mac"`
+	DPID  uint64 `json:"dpid"`
+	Port  uint32 `json:"port"`
+	Allow bool   `json:"allow"`
+}
+
+type backupPolicy struct {
+	SrcNet   string `json:"src_net,omitempty"`
+	DstNet   string `json:"dst_net,omitempty"`
+	Protocol uint8  `json:"protocol"`
+	DstPort  uint16 `json:"dst_port"`
+	DPID     uint64 `json:"dpid"`
+	Port     uint32 `json:"port"`
+}
+
+// Export writes the state of the controller stored in db to w as JSON.
+func Export(db Database, w io.Writer) error {
+	b, err := newBackup(db)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(b)
+}
+
+func newBackup(db Database) (*Backup, error) {
+	b := &Backup{
+		Version:   backupVersion,
+		Timestamp: time.Now().UTC(),
+	}
+
+	// Zero limit means all the rows.
+	switches, err := db.Switches(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range switches {
+		b.Switches = append(b.Switches, v.SwitchParam)
+	}
+
+	if b.Aliases, err = db.SwitchAliases(); err != nil {
+		return nil, err
+	}
+
+	networks, err := db.Networks(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range networks {
+		b.Networks = append(b.Networks, v.NetworkParam)
+	}
+
+	hosts, err := db.Hosts(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range hosts {
+		id, err := strconv.ParseUint(v.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host ID: %v", v.ID)
+		}
+		b.Hosts = append(b.Hosts, backupHost{ID: id, IP: v.IP, MAC: v.MAC, Description: v.Description})
+	}
+	// Restoring the hosts in the order of their IDs keeps the order of the listings.
+	sort.Slice(b.Hosts, func(i, j int) bool { return b.Hosts[i].ID < b.Hosts[j].ID })
+
+	vips, err := db.VIPs(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vips {
+		active, err := strconv.ParseUint(v.ActiveHost.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host ID: %v", v.ActiveHost.ID)
+		}
+		standby, err := strconv.ParseUint(v.StandbyHost.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host ID: %v", v.StandbyHost.ID)
+		}
+		b.VIPs = append(b.VIPs, backupVIP{IP: v.IP, ActiveHostID: active, StandbyHostID: standby, Description: v.Description})
+	}
+	// VIPs are listed in the descending order of their IDs.
+	for i, j := 0, len(b.VIPs)-1; i < j; i, j = i+1, j-1 {
+		b.VIPs[i], b.VIPs[j] = b.VIPs[j], b.VIPs[i]
+	}
+
+	rules, err := db.MACRules()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range rules {
+		b.MACRules = append(b.MACRules, backupMACRule{MAC: v.MAC.String(), DPID: v.DPID, Port: v.Port, Allow: v.Allow})
+	}
+
+	policies, err := db.Policies()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range policies {
+		p := backupPolicy{Protocol: v.Protocol, DstPort: v.DstPort, DPID: v.DPID, Port: v.Port}
+		if v.SrcNet != nil {
+			p.SrcNet = v.SrcNet.String()
+		}
+		if v.DstNet != nil {
+			p.DstNet = v.DstNet.String()
+		}
+		b.Policies = append(b.Policies, p)
+	}
+
+	return b, nil
+}
+
+// Import restores the state of the controller written by Export into db, which
+// should be empty to avoid conflicts with the existing entries.
+func Import(db Database, r io.Reader) error {
+	b := new(Backup)
+	if err := json.NewDecoder(r).Decode(b); err != nil {
+		return err
+	}
+	if b.Version != backupVersion {
+		return fmt.Errorf("unsupported backup version: %v", b.Version)
+	}
+	if err := checkEmpty(db); err != nil {
+		return err
+	}
+
+	for _, v := range b.Switches {
+		if _, err := db.AddSwitch(v); err != nil {
+			return fmt.Errorf("failed to add a switch (DPID=%v): %v", v.DPID, err)
+		}
+	}
+	for _, v := range b.Aliases {
+		if err := db.SetSwitchAlias(v); err != nil {
+			return fmt.Errorf("failed to set a switch alias (DPID=%v): %v", v.DPID, err)
+		}
+	}
+	for _, v := range b.Networks {
+		ip := net.ParseIP(v.Address)
+		if ip == nil {
+			return fmt.Errorf("invalid network address: %v", v.Address)
+		}
+		if _, err := db.AddNetwork(ip, net.CIDRMask(int(v.Mask), 32)); err != nil {
+			return fmt.Errorf("failed to add a network (%v/%v): %v", v.Address, v.Mask, err)
+		}
+	}
+
+	// Host IDs in the backup to the new ones.
+	hostIDs := make(map[uint64]uint64)
+	for _, v := range b.Hosts {
+		ipID, err := lookupIPID(db, v.IP)
+		if err != nil {
+			return err
+		}
+		id, err := db.AddHost(network.HostParam{IPID: ipID, MAC: v.MAC, Description: v.Description})
+		if err != nil {
+			return fmt.Errorf("failed to add a host (IP=%v, MAC=%v): %v", v.IP, v.MAC, err)
+		}
+		hostIDs[v.ID] = id
+	}
+
+	for _, v := range b.VIPs {
+		ipID, err := lookupIPID(db, v.IP)
+		if err != nil {
+			return err
+		}
+		active, ok := hostIDs[v.ActiveHostID]
+		if !ok {
+			return fmt.Errorf("unknown active host ID of VIP %v: %v", v.IP, v.ActiveHostID)
+		}
+		standby, ok := hostIDs[v.StandbyHostID]
+		if !ok {
+			return fmt.Errorf("unknown standby host ID of VIP %v: %v", v.IP, v.StandbyHostID)
+		}
+		param := network.VIPParam{IPID: ipID, ActiveHostID: active, StandbyHostID: standby, Description: v.Description}
+		if _, _, err := db.AddVIP(param); err != nil {
+			return fmt.Errorf("failed to add a VIP (IP=%v): %v", v.IP, err)
+		}
+	}
+
+	for _, v := range b.MACRules {
+		mac, err := net.ParseMAC(v.MAC)
+		if err != nil {
+			return err
+		}
+		if _, err := db.AddMACRule(acl.Rule{MAC: mac, DPID: v.DPID, Port: v.Port, Allow: v.Allow}); err != nil {
+			return fmt.Errorf("failed to add a MAC rule (MAC=%v): %v", v.MAC, err)
+		}
+	}
+
+	for _, v := range b.Policies {
+		p := pbr.Policy{Protocol: v.Protocol, DstPort: v.DstPort, DPID: v.DPID, Port: v.Port}
+		var err error
+		if p.SrcNet, err = parseBackupNet(v.SrcNet); err != nil {
+			return err
+		}
+		if p.DstNet, err = parseBackupNet(v.DstNet); err != nil {
+			return err
+		}
+		if _, err := db.AddPolicy(p); err != nil {
+			return fmt.Errorf("failed to add a policy (%v): %v", p, err)
+		}
+	}
+
+	return nil
+}
+
+func checkEmpty(db Database) error {
+	switches, err := db.Switches(1, 0)
+	if err != nil {
+		return err
+	}
+	networks, err := db.Networks(1, 0)
+	if err != nil {
+		return err
+	}
+	rules, err := db.MACRules()
+	if err != nil {
+		return err
+	}
+	policies, err := db.Policies()
+	if err != nil {
+		return err
+	}
+	aliases, err := db.SwitchAliases()
+	if err != nil {
+		return err
+	}
+	if len(switches) > 0 || len(networks) > 0 || len(rules) > 0 || len(policies) > 0 || len(aliases) > 0 {
+		return errors.New("database is not empty")
+	}
+
+	return nil
+}
+
+// lookupIPID returns the ID of the IP address whose value is addr in the CIDR
+// notation, e.g., 10.0.0.1/24.
+func lookupIPID(db Database, addr string) (uint64, error) {
+	ip, n, err := net.ParseCIDR(addr)
+	if err != nil {
+		return 0, err
+	}
+	netw, ok, err := db.Network(n.IP)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("unknown network of %v", addr)
+	}
+	addrs, err := db.IPAddrs(netw.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range addrs {
+		if v.Address == ip.String() {
+			return v.ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown IP address: %v", addr)
+}
+
+func parseBackupNet(s string) (*net.IPNet, error) {
+	if s == "" {
+		return nil, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+
+	return n, err
+}
@@ -0,0 +1,101 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/acl"
+	"github.com/superkkt/cherry/northbound/app/pbr"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src := NewMemory()
+
+	if _, err := src.AddSwitch(network.SwitchParam{DPID: 1, NumPorts: 4, FirstPort: 1, FirstPrintedPort: 1, Description: "sw1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetSwitchAlias(network.SwitchAlias{DPID: 1, Name: "leaf1", Rack: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.AddNetwork(net.IPv4(10, 0, 0, 0), net.CIDRMask(24, 32)); err != nil {
+		t.Fatal(err)
+	}
+	var hosts []uint64
+	for i, v := range []string{"00:11:22:33:44:01", "00:11:22:33:44:02"} {
+		id, err := ipID(net.IPv4(10, 0, 0, byte(i+1)).To4())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hostID, err := src.AddHost(network.HostParam{IPID: id, MAC: v, Description: "host"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, hostID)
+	}
+	vipID, err := ipID(net.IPv4(10, 0, 0, 100).To4())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := src.AddVIP(network.VIPParam{IPID: vipID, ActiveHostID: hosts[0], StandbyHostID: hosts[1], Description: "vip"}); err != nil {
+		t.Fatal(err)
+	}
+	mac, _ := net.ParseMAC("00:11:22:33:44:01")
+	if _, err := src.AddMACRule(acl.Rule{MAC: mac, DPID: 1, Allow: true}); err != nil {
+		t.Fatal(err)
+	}
+	_, dst, _ := net.ParseCIDR("192.168.0.0/16")
+	if _, err := src.AddPolicy(pbr.Policy{DstNet: dst, Protocol: 6, DstPort: 80, DPID: 1, Port: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Export(src, buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	restored := NewMemory()
+	if err := Import(restored, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Import(restored, bytes.NewReader(data)); err == nil {
+		t.Fatal("expected an error for the non-empty database")
+	}
+
+	expected, err := newBackup(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := newBackup(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual.Timestamp = expected.Timestamp
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected restored state: expected=%+v, actual=%+v", expected, actual)
+	}
+}
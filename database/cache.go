@@ -0,0 +1,424 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/discovery"
+	"github.com/superkkt/cherry/northbound/app/virtualip"
+)
+
+const (
+	cacheFlushInterval = 100 * time.Millisecond
+	// The pending updates are written without waiting for the flush interval
+	// if there are this many updates.
+	cacheFlushThreshold = 256
+)
+
+var pendingUpdates = metrics.NewGauge("database_pending_location_updates", "Number of the host location updates waiting to be written to the database.")
+
+// Cache keeps the host locations in memory to answer the lookups of the
+// packet-in handlers without querying the backend, and writes the location
+// updates of the known hosts to the backend asynchronously. Only the latest
+// update of a host is written if it moves several times before the write. The
+// cached entries expire after the TTL, so that the changes made by the other
+// controllers sharing the backend are eventually visible.
+type Cache struct {
+	Database
+	ttl time.Duration
+	// wakeup makes the flusher write the pending updates immediately.
+	wakeup chan struct{}
+
+	// flushMutex serializes the writes of the pending updates.
+	flushMutex sync.Mutex
+
+	mutex     sync.Mutex
+	hosts     map[string]*cachedHost              // Key = MAC and IP addresses.
+	locations map[string]cachedLocation           // Key = MAC address.
+	macs      map[string]cachedMAC                // Key = IPv4 address.
+	pending   map[string]discovery.LocationUpdate // Key = MAC and IP addresses.
+	// writing is the updates being written by the flusher.
+	writing map[string]discovery.LocationUpdate // Key = MAC and IP addresses.
+}
+
+type cachedHost struct {
+	// registered is true if the backend has reported that the host is
+	// registered, which means that its moves can be written asynchronously.
+	registered bool
+	dpid       uint64
+	port       uint16
+	expire     time.Time
+}
+
+type cachedLocation struct {
+	dpid   string
+	port   uint32
+	status network.LocationStatus
+	expire time.Time
+}
+
+type cachedMAC struct {
+	mac    net.HardwareAddr
+	ok     bool
+	expire time.Time
+}
+
+func newCache(db Database, ttl time.Duration) *Cache {
+	v := &Cache{
+		Database:  db,
+		ttl:       ttl,
+		wakeup:    make(chan struct{}, 1),
+		hosts:     make(map[string]*cachedHost),
+		locations: make(map[string]cachedLocation),
+		macs:      make(map[string]cachedMAC),
+		pending:   make(map[string]discovery.LocationUpdate),
+	}
+	go v.flusher()
+
+	return v
+}
+
+func hostKey(mac net.HardwareAddr, ip net.IP) string {
+	return mac.String() + "/" + ip.String()
+}
+
+func (r *Cache) flusher() {
+	ticker := time.NewTicker(cacheFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.wakeup:
+		}
+		r.flush()
+	}
+}
+
+// enqueue adds update to the pending updates, replacing the previous one of
+// the same host. The caller should hold the mutex.
+func (r *Cache) enqueue(key string, update discovery.LocationUpdate) {
+	r.pending[key] = update
+	pendingUpdates.Set(float64(len(r.pending)))
+	if len(r.pending) < cacheFlushThreshold {
+		return
+	}
+	select {
+	case r.wakeup <- struct{}{}:
+	default:
+		// The flusher has already been woken up.
+	}
+}
+
+// flush writes the pending location updates to the backend.
+func (r *Cache) flush() {
+	r.flushMutex.Lock()
+	defer r.flushMutex.Unlock()
+
+	r.mutex.Lock()
+	pending := r.pending
+	r.pending = make(map[string]discovery.LocationUpdate)
+	r.writing = pending
+	pendingUpdates.Set(0)
+	r.mutex.Unlock()
+
+	defer func() {
+		r.mutex.Lock()
+		r.writing = nil
+		r.mutex.Unlock()
+	}()
+
+	if len(pending) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(pending))
+	updates := make([]discovery.LocationUpdate, 0, len(pending))
+	for k, v := range pending {
+		keys = append(keys, k)
+		updates = append(updates, v)
+	}
+	// Write all the pending updates in a single transaction.
+	if _, err := r.Database.UpdateHostLocations(updates); err == nil {
+		return
+	}
+
+	// Write them one by one to skip the failed ones.
+	for i, v := range updates {
+		if _, err := r.Database.UpdateHostLocations(updates[i : i+1]); err != nil {
+			logger.Errorf("failed to write the host location: MAC=%v, IP=%v, DPID=%v, port=%v: %v", v.MAC, v.IP, v.DPID, v.Port, err)
+			// The next update will query the backend again.
+			r.mutex.Lock()
+			delete(r.hosts, keys[i])
+			delete(r.locations, v.MAC.String())
+			r.mutex.Unlock()
+		}
+	}
+}
+
+// invalidate removes all the cached entries after writing the pending updates.
+func (r *Cache) invalidate() {
+	r.flush()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.hosts = make(map[string]*cachedHost)
+	r.locations = make(map[string]cachedLocation)
+	r.macs = make(map[string]cachedMAC)
+}
+
+// invalidateMACs removes the cached IPv4 to MAC address mappings, which are changed by the hosts and the VIPs.
+func (r *Cache) invalidateMACs() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.macs = make(map[string]cachedMAC)
+}
+
+func (r *Cache) UpdateHostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
+	return r.updateLocation(mac, ip, swDPID, portNum, r.Database.UpdateHostLocation)
+}
+
+func (r *Cache) UpdateIPv6HostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
+	return r.updateLocation(mac, ip, swDPID, portNum, r.Database.UpdateIPv6HostLocation)
+}
+
+type updateFunc func(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error)
+
+func (r *Cache) updateLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16, update updateFunc) (updated bool, err error) {
+	key := hostKey(mac, ip)
+
+	r.mutex.Lock()
+	h, ok := r.hosts[key]
+	if ok && time.Now().Before(h.expire) {
+		// Same location? The backend will report that nothing is updated
+		// whether or not the host is registered.
+		if h.dpid == swDPID && h.port == portNum {
+			r.mutex.Unlock()
+			return false, nil
+		}
+		h.dpid, h.port = swDPID, portNum
+		// An unregistered host has moved. The backend will not update it
+		// until it is registered, which invalidates the cache.
+		if !h.registered {
+			r.mutex.Unlock()
+			return false, nil
+		}
+		// A registered host has moved.
+		r.enqueue(key, discovery.LocationUpdate{MAC: mac, IP: ip, DPID: swDPID, Port: portNum})
+		r.setLocation(mac, swDPID, portNum)
+		r.mutex.Unlock()
+		return true, nil
+	}
+	// This update supersedes the pending one of the same host.
+	if _, ok := r.pending[key]; ok {
+		delete(r.pending, key)
+		pendingUpdates.Set(float64(len(r.pending)))
+	}
+	_, writing := r.writing[key]
+	r.mutex.Unlock()
+
+	// Wait for the update of the same host being written, so that it does not
+	// overwrite this update. The other hosts never wait for the flusher.
+	if writing {
+		r.flushMutex.Lock()
+		r.flushMutex.Unlock()
+	}
+	// Unknown host whose registration should be queried from the backend.
+	updated, err = update(mac, ip, swDPID, portNum)
+	if err != nil {
+		return false, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	registered := updated || (ok && h.registered)
+	r.hosts[key] = &cachedHost{registered: registered, dpid: swDPID, port: portNum, expire: time.Now().Add(r.ttl)}
+	if updated {
+		r.setLocation(mac, swDPID, portNum)
+	}
+
+	return updated, nil
+}
+
+func (r *Cache) UpdateHostLocations(updates []discovery.LocationUpdate) (updated []bool, err error) {
+	// Write the pending updates first, so that they do not overwrite these updates.
+	r.flush()
+	if updated, err = r.Database.UpdateHostLocations(updates); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, v := range updates {
+		key := hostKey(v.MAC, v.IP)
+		h, ok := r.hosts[key]
+		registered := updated[i] || (ok && h.registered)
+		r.hosts[key] = &cachedHost{registered: registered, dpid: v.DPID, port: v.Port, expire: time.Now().Add(r.ttl)}
+		if updated[i] {
+			r.setLocation(v.MAC, v.DPID, v.Port)
+		}
+	}
+
+	return updated, nil
+}
+
+func (r *Cache) setLocation(mac net.HardwareAddr, swDPID uint64, portNum uint16) {
+	r.locations[mac.String()] = cachedLocation{
+		dpid:   strconv.FormatUint(swDPID, 10),
+		port:   uint32(portNum),
+		status: network.LocationDiscovered,
+		expire: time.Now().Add(r.ttl),
+	}
+}
+
+func (r *Cache) Location(mac net.HardwareAddr) (dpid string, port uint32, status network.LocationStatus, err error) {
+	r.mutex.Lock()
+	v, ok := r.locations[mac.String()]
+	r.mutex.Unlock()
+	if ok && time.Now().Before(v.expire) {
+		return v.dpid, v.port, v.status, nil
+	}
+
+	dpid, port, status, err = r.Database.Location(mac)
+	if err != nil {
+		return "", 0, network.LocationUnregistered, err
+	}
+
+	r.mutex.Lock()
+	r.locations[mac.String()] = cachedLocation{dpid: dpid, port: port, status: status, expire: time.Now().Add(r.ttl)}
+	r.mutex.Unlock()
+
+	return dpid, port, status, nil
+}
+
+func (r *Cache) MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
+	r.mutex.Lock()
+	v, found := r.macs[ip.String()]
+	r.mutex.Unlock()
+	if found && time.Now().Before(v.expire) {
+		return v.mac, v.ok, nil
+	}
+
+	mac, ok, err = r.Database.MAC(ip)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.mutex.Lock()
+	r.macs[ip.String()] = cachedMAC{mac: mac, ok: ok, expire: time.Now().Add(r.ttl)}
+	r.mutex.Unlock()
+
+	return mac, ok, nil
+}
+
+func (r *Cache) ResetHostLocationsByPort(swDPID uint64, portNum uint16) ([]discovery.Host, error) {
+	// The pending updates may be on the port.
+	r.flush()
+	hosts, err := r.Database.ResetHostLocationsByPort(swDPID, portNum)
+	r.invalidateHosts(func(h *cachedHost) bool { return h.dpid == swDPID && h.port == portNum })
+
+	return hosts, err
+}
+
+func (r *Cache) ResetHostLocationsByDevice(swDPID uint64) ([]discovery.Host, error) {
+	// The pending updates may be on the device.
+	r.flush()
+	hosts, err := r.Database.ResetHostLocationsByDevice(swDPID)
+	r.invalidateHosts(func(h *cachedHost) bool { return h.dpid == swDPID })
+
+	return hosts, err
+}
+
+func (r *Cache) ResetHostLocationsByPorts(swDPID uint64, portNums []uint16) ([]discovery.Host, error) {
+	// The pending updates may be on the ports.
+	r.flush()
+	hosts, err := r.Database.ResetHostLocationsByPorts(swDPID, portNums)
+	ports := make(map[uint16]bool)
+	for _, v := range portNums {
+		ports[v] = true
+	}
+	r.invalidateHosts(func(h *cachedHost) bool { return h.dpid == swDPID && ports[h.port] })
+
+	return hosts, err
+}
+
+// invalidateHosts removes the cached hosts that satisfy match and all the cached locations.
+func (r *Cache) invalidateHosts(match func(*cachedHost) bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for k, v := range r.hosts {
+		if match(v) {
+			delete(r.hosts, k)
+		}
+	}
+	r.locations = make(map[string]cachedLocation)
+}
+
+func (r *Cache) AddHost(host network.HostParam) (hostID uint64, err error) {
+	defer r.invalidate()
+	return r.Database.AddHost(host)
+}
+
+func (r *Cache) RemoveHost(id uint64) (ok bool, err error) {
+	defer r.invalidate()
+	return r.Database.RemoveHost(id)
+}
+
+func (r *Cache) RemoveSwitch(id uint64) (ok bool, err error) {
+	defer r.invalidate()
+	return r.Database.RemoveSwitch(id)
+}
+
+func (r *Cache) AddVIP(vip network.VIPParam) (id uint64, cidr string, err error) {
+	defer r.invalidateMACs()
+	return r.Database.AddVIP(vip)
+}
+
+func (r *Cache) RemoveVIP(id uint64) (ok bool, err error) {
+	defer r.invalidateMACs()
+	return r.Database.RemoveVIP(id)
+}
+
+func (r *Cache) ToggleVIP(id uint64) (net.IP, net.HardwareAddr, error) {
+	defer r.invalidateMACs()
+	return r.Database.ToggleVIP(id)
+}
+
+func (r *Cache) ToggleDeviceVIP(swDPID uint64) ([]virtualip.Address, error) {
+	defer r.invalidateMACs()
+	return r.Database.ToggleDeviceVIP(swDPID)
+}
+
+func (r *Cache) TogglePortVIP(swDPID uint64, portNum uint16) ([]virtualip.Address, error) {
+	defer r.invalidateMACs()
+	return r.Database.TogglePortVIP(swDPID, portNum)
+}
@@ -0,0 +1,85 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+)
+
+func TestCacheHostMove(t *testing.T) {
+	db := NewMemory()
+	if _, err := db.AddSwitch(network.SwitchParam{DPID: 1, NumPorts: 4, FirstPort: 1, FirstPrintedPort: 1, Description: "sw1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddNetwork(net.IPv4(10, 0, 0, 0), net.CIDRMask(24, 32)); err != nil {
+		t.Fatal(err)
+	}
+	ip := net.IPv4(10, 0, 0, 1).To4()
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	id, _ := ipID(ip)
+	if _, err := db.AddHost(network.HostParam{IPID: id, MAC: mac.String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCache(db, time.Minute)
+	for i, v := range []struct {
+		port    uint16
+		updated bool
+	}{{1, true}, {1, false}, {2, true}, {2, false}, {1, true}} {
+		updated, err := cache.UpdateHostLocation(mac, ip, 1, v.port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != v.updated {
+			t.Fatalf("#%v: unexpected result: expected=%v, actual=%v", i, v.updated, updated)
+		}
+		_, port, status, err := cache.Location(mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != network.LocationDiscovered || port != uint32(v.port) {
+			t.Fatalf("#%v: unexpected cached location: port=%v, status=%v", i, port, status)
+		}
+	}
+
+	// The last move is written asynchronously.
+	cache.flush()
+	_, port, _, err := db.Location(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 1 {
+		t.Fatalf("unexpected location in the database: port=%v", port)
+	}
+
+	// Unregistered host is never reported as updated.
+	unknown := net.IPv4(10, 0, 0, 2).To4()
+	for _, port := range []uint16{1, 2} {
+		if updated, err := cache.UpdateHostLocation(mac, unknown, 1, port); err != nil || updated {
+			t.Fatalf("unexpected result of the unregistered host: updated=%v, err=%v", updated, err)
+		}
+	}
+}
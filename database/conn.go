@@ -0,0 +1,158 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+
+	"github.com/superkkt/viper"
+)
+
+const (
+	defaultMaxOpenConns  = 32
+	defaultMaxIdleConns  = 4
+	defaultTimeout       = 10 * time.Second
+	defaultRetryInterval = 250 * time.Millisecond
+	maxRetryInterval     = 5 * time.Second
+)
+
+var (
+	queryDuration = metrics.NewHistogram("database_query_duration_seconds",
+		"Elapsed time of the database queries and transactions including their retries.",
+		[]float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+	)
+	queryRetries = metrics.NewCounter("database_query_retries_total", "Number of the retried database queries and transactions.")
+	queryErrors  = metrics.NewCounter("database_query_errors_total", "Number of the failed database queries and transactions.")
+)
+
+// connConfig is the connection pool, the timeout, and the retry settings of
+// the database backends.
+type connConfig struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration // Zero means no limit.
+	// I/O timeout of a query, so that a hung database server does not block
+	// the callers such as the packet-in handlers forever.
+	timeout  time.Duration
+	maxRetry int
+	// Base interval of the exponential backoff between the retries.
+	retryInterval time.Duration
+}
+
+func loadConnConfig() (connConfig, error) {
+	c := connConfig{
+		maxOpenConns:  defaultMaxOpenConns,
+		maxIdleConns:  defaultMaxIdleConns,
+		timeout:       defaultTimeout,
+		maxRetry:      maxDeadlockRetry,
+		retryInterval: defaultRetryInterval,
+	}
+
+	if viper.IsSet("database.max_open_conns") {
+		c.maxOpenConns = viper.GetInt("database.max_open_conns")
+		if c.maxOpenConns <= 0 {
+			return connConfig{}, errors.New("invalid database.max_open_conns in the config file")
+		}
+	}
+	if viper.IsSet("database.max_idle_conns") {
+		c.maxIdleConns = viper.GetInt("database.max_idle_conns")
+		if c.maxIdleConns < 0 || c.maxIdleConns > c.maxOpenConns {
+			return connConfig{}, errors.New("invalid database.max_idle_conns in the config file")
+		}
+	}
+	if viper.IsSet("database.conn_max_lifetime") {
+		v := viper.GetInt("database.conn_max_lifetime")
+		if v < 0 {
+			return connConfig{}, errors.New("invalid database.conn_max_lifetime in the config file")
+		}
+		c.connMaxLifetime = time.Duration(v) * time.Second
+	}
+	if viper.IsSet("database.timeout") {
+		v := viper.GetInt("database.timeout")
+		if v <= 0 || v > 3600 {
+			return connConfig{}, errors.New("invalid database.timeout in the config file")
+		}
+		c.timeout = time.Duration(v) * time.Second
+	}
+	if viper.IsSet("database.max_retry") {
+		c.maxRetry = viper.GetInt("database.max_retry")
+		if c.maxRetry < 0 || c.maxRetry > 100 {
+			return connConfig{}, errors.New("invalid database.max_retry in the config file")
+		}
+	}
+	if viper.IsSet("database.retry_interval") {
+		v := viper.GetInt("database.retry_interval")
+		if v <= 0 || v > 60000 {
+			return connConfig{}, errors.New("invalid database.retry_interval in the config file")
+		}
+		c.retryInterval = time.Duration(v) * time.Millisecond
+	}
+
+	return c, nil
+}
+
+func (r connConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(r.maxOpenConns)
+	db.SetMaxIdleConns(r.maxIdleConns)
+	db.SetConnMaxLifetime(r.connMaxLifetime)
+}
+
+// backoff returns a random interval before the n-th retry, whose upper bound
+// grows exponentially up to maxRetryInterval.
+func (r connConfig) backoff(random *rand.Rand, n int) time.Duration {
+	max := r.retryInterval
+	for i := 0; i < n && max < maxRetryInterval; i++ {
+		max *= 2
+	}
+	if max > maxRetryInterval {
+		max = maxRetryInterval
+	}
+
+	return time.Duration(random.Int63n(int64(max)))
+}
+
+// retry calls f again with the backoff while f fails with an error that is
+// retryable, such as a deadlock or a broken connection, up to maxRetry times.
+func (r connConfig) retry(random *rand.Rand, f func() error, retryable func(error) bool) error {
+	start := time.Now()
+	defer func() { queryDuration.Observe(time.Since(start).Seconds()) }()
+
+	for n := 0; ; n++ {
+		err := f()
+		if err == nil {
+			// Success
+			return nil
+		}
+		if n >= r.maxRetry || (!retryable(err) && err != driver.ErrBadConn) {
+			queryErrors.Inc()
+			return err
+		}
+		queryRetries.Inc()
+		time.Sleep(r.backoff(random, n))
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/cluster"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/acl"
+	"github.com/superkkt/cherry/northbound/app/discovery"
+	"github.com/superkkt/cherry/northbound/app/journal"
+	"github.com/superkkt/cherry/northbound/app/l2switch"
+	"github.com/superkkt/cherry/northbound/app/pbr"
+	"github.com/superkkt/cherry/northbound/app/virtualip"
+
+	"github.com/superkkt/viper"
+)
+
+// Database is the union of the database interfaces required by the controller
+// and the northbound applications. Each backend driver implements all of them.
+type Database interface {
+	cluster.Database
+	discovery.Database
+	l2switch.Database
+
+	// Network controller.
+	AddHost(network.HostParam) (hostID uint64, err error)
+	AddNetwork(net.IP, net.IPMask) (netID uint64, err error)
+	AddSwitch(network.SwitchParam) (swID uint64, err error)
+	AddVIP(network.VIPParam) (id uint64, cidr string, err error)
+	Host(hostID uint64) (host network.Host, ok bool, err error)
+	Hosts(limit, offset uint8) ([]network.Host, error)
+	IPAddrs(networkID uint64) ([]network.IP, error)
+	Location(mac net.HardwareAddr) (dpid string, port uint32, status network.LocationStatus, err error)
+	Network(net.IP) (n network.Network, ok bool, err error)
+	Networks(limit, offset uint8) ([]network.Network, error)
+	RemoveHost(id uint64) (ok bool, err error)
+	RemoveNetwork(id uint64) (ok bool, err error)
+	RemoveSwitch(id uint64) (ok bool, err error)
+	RemoveSwitchAlias(dpid uint64) (ok bool, err error)
+	RemoveVIP(id uint64) (ok bool, err error)
+	SetSwitchAlias(network.SwitchAlias) error
+	Switch(dpid uint64) (sw network.Switch, ok bool, err error)
+	SwitchAliases() ([]network.SwitchAlias, error)
+	Switches(limit, offset uint8) ([]network.Switch, error)
+	SwitchPorts(switchID uint64) ([]network.SwitchPort, error)
+	ToggleVIP(id uint64) (net.IP, net.HardwareAddr, error)
+	VIPs(limit, offset uint8) ([]network.VIP, error)
+	MaintenanceWindows() ([]network.MaintenanceWindow, error)
+	AddMaintenanceWindow(network.MaintenanceWindow) (id uint64, err error)
+	RemoveMaintenanceWindow(id uint64) (ok bool, err error)
+
+	// Virtual IP.
+	ToggleDeviceVIP(swDPID uint64) ([]virtualip.Address, error)
+	TogglePortVIP(swDPID uint64, portNum uint16) ([]virtualip.Address, error)
+	GetActivatedVIPs() ([]virtualip.Address, error)
+
+	// ACL.
+	MACRules() ([]acl.Rule, error)
+	AddMACRule(acl.Rule) (id uint64, err error)
+	RemoveMACRule(id uint64) (rule acl.Rule, ok bool, err error)
+
+	// PBR.
+	Policies() ([]pbr.Policy, error)
+	AddPolicy(pbr.Policy) (id uint64, err error)
+	RemovePolicy(id uint64) (ok bool, err error)
+
+	// Journal.
+	AddJournal([]journal.Entry) error
+	Journal(since time.Time, eventType string, limit uint16) ([]journal.Entry, error)
+	RemoveJournal(before time.Time) (n int64, err error)
+
+	// Ping checks whether the backend is reachable.
+	Ping() error
+}
+
+const defaultCacheTTL = 30 * time.Second
+
+// Driver opens a database backend using the database section of the config file.
+type Driver func() (Database, error)
+
+var (
+	mutex   sync.Mutex
+	drivers = make(map[string]Driver)
+)
+
+// Register makes a database driver available by the name. It panics if the
+// name is already registered.
+func Register(name string, d Driver) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if d == nil {
+		panic("database driver is nil")
+	}
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Sprintf("duplicated database driver: %v", name))
+	}
+	drivers[name] = d
+}
+
+// Drivers returns the sorted names of the registered drivers.
+func Drivers() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	names := make([]string, 0, len(drivers))
+	for k := range drivers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Open opens the database backend specified by database.driver in the config
+// file, and then applies the pending schema migrations. The default driver is
+// mysql.
+func Open() (Database, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := db.(migrator); ok {
+		if _, err := m.migrate(false); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl := defaultCacheTTL
+	if viper.IsSet("database.cache_ttl") {
+		v := viper.GetInt("database.cache_ttl")
+		if v < 0 {
+			return nil, errors.New("invalid database.cache_ttl in the config file")
+		}
+		ttl = time.Duration(v) * time.Second
+	}
+	// Zero TTL disables the cache.
+	if ttl > 0 {
+		db = newCache(db, ttl)
+	}
+
+	return db, nil
+}
+
+// PendingMigrations returns the schema migrations that will be applied by
+// Open, without applying them.
+func PendingMigrations() ([]Migration, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := db.(migrator)
+	if !ok {
+		// The backend does not have a versioned schema.
+		return nil, nil
+	}
+
+	return m.migrate(true)
+}
+
+func open() (Database, error) {
+	name := "mysql"
+	if viper.IsSet("database.driver") {
+		name = viper.GetString("database.driver")
+	}
+
+	mutex.Lock()
+	d, ok := drivers[name]
+	mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver: %v (available drivers: %v)", name, Drivers())
+	}
+
+	return d()
+}
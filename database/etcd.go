@@ -0,0 +1,254 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/superkkt/viper"
+)
+
+func init() {
+	Register("etcd", func() (Database, error) { return NewEtcd() })
+}
+
+// Etcd stores the data in etcd v3 through its JSON gateway, so that it does
+// not need the etcd client library. Each transaction compares the revisions of
+// all the keys it has read, so that --max-txn-ops of etcd should be large
+// enough for the number of the hosts.
+type Etcd struct {
+	*KVStore
+}
+
+func NewEtcd() (*Etcd, error) {
+	conn, err := loadConnConfig()
+	if err != nil {
+		return nil, err
+	}
+	endpoints := []string{}
+	for _, v := range strings.Split(viper.GetString("database.etcd.endpoints"), ",") {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			continue
+		}
+		endpoints = append(endpoints, strings.TrimRight(v, "/"))
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("invalid database.etcd.endpoints in the config file")
+	}
+	prefix := "/cherry/"
+	if viper.IsSet("database.etcd.prefix") {
+		prefix = viper.GetString("database.etcd.prefix")
+		if len(prefix) == 0 {
+			return nil, errors.New("invalid database.etcd.prefix in the config file")
+		}
+	}
+
+	client := &etcdClient{
+		endpoints: endpoints,
+		prefix:    prefix,
+		http:      &http.Client{Timeout: conn.timeout},
+	}
+	// Check the connectivity.
+	if _, err := client.get("seq/", true); err != nil {
+		return nil, err
+	}
+
+	return &Etcd{newKVStore(client)}, nil
+}
+
+type etcdClient struct {
+	endpoints []string
+	prefix    string
+	http      *http.Client
+}
+
+type etcdKeyValue struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	ModRevision string `json:"mod_revision"`
+}
+
+type etcdRangeRequest struct {
+	Key      string `json:"key"`
+	RangeEnd string `json:"range_end,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	KVs []etcdKeyValue `json:"kvs"`
+}
+
+type etcdCompare struct {
+	Key         string `json:"key"`
+	Target      string `json:"target"`
+	Result      string `json:"result"`
+	ModRevision string `json:"mod_revision"`
+}
+
+type etcdPutRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type etcdDeleteRequest struct {
+	Key string `json:"key"`
+}
+
+type etcdRequestOp struct {
+	Put    *etcdPutRequest    `json:"request_put,omitempty"`
+	Delete *etcdDeleteRequest `json:"request_delete_range,omitempty"`
+}
+
+type etcdTxnRequest struct {
+	Compare []etcdCompare   `json:"compare"`
+	Success []etcdRequestOp `json:"success"`
+}
+
+type etcdTxnResponse struct {
+	Succeeded bool `json:"succeeded"`
+}
+
+func encodeKey(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// prefixEnd returns the end of the range whose keys start with prefix.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xFF {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	// No end: all the keys greater than or equal to prefix.
+	return "\x00"
+}
+
+// call sends req to the API specified by path, and then decodes the response
+// into resp. The endpoints are tried in order until one of them responds.
+func (r *etcdClient) call(path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range r.endpoints {
+		var res *http.Response
+		res, err = r.http.Post(v+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			// Try the next endpoint.
+			continue
+		}
+		err = decodeEtcdResponse(res, resp)
+		res.Body.Close()
+		return err
+	}
+
+	return fmt.Errorf("no available etcd endpoint: %v", err)
+}
+
+func decodeEtcdResponse(res *http.Response, v interface{}) error {
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected etcd response status: %v", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (r *etcdClient) get(key string, prefix bool) ([]kvPair, error) {
+	req := etcdRangeRequest{Key: encodeKey(r.prefix + key)}
+	if prefix {
+		req.RangeEnd = encodeKey(prefixEnd(r.prefix + key))
+	}
+	resp := new(etcdRangeResponse)
+	if err := r.call("/v3/kv/range", req, resp); err != nil {
+		return nil, err
+	}
+
+	result := make([]kvPair, 0, len(resp.KVs))
+	for _, v := range resp.KVs {
+		key, err := base64.StdEncoding.DecodeString(v.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := base64.StdEncoding.DecodeString(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		revision, err := strconv.ParseInt(v.ModRevision, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid etcd revision: %v", v.ModRevision)
+		}
+		result = append(result, kvPair{
+			key:      strings.TrimPrefix(string(key), r.prefix),
+			value:    value,
+			revision: revision,
+		})
+	}
+
+	return result, nil
+}
+
+func (r *etcdClient) commit(compares map[string]int64, puts map[string][]byte, deletes []string) (ok bool, err error) {
+	req := etcdTxnRequest{
+		Compare: []etcdCompare{},
+		Success: []etcdRequestOp{},
+	}
+	for k, v := range compares {
+		req.Compare = append(req.Compare, etcdCompare{
+			Key:         encodeKey(r.prefix + k),
+			Target:      "MOD",
+			Result:      "EQUAL",
+			ModRevision: strconv.FormatInt(v, 10),
+		})
+	}
+	for k, v := range puts {
+		req.Success = append(req.Success, etcdRequestOp{
+			Put: &etcdPutRequest{Key: encodeKey(r.prefix + k), Value: base64.StdEncoding.EncodeToString(v)},
+		})
+	}
+	for _, v := range deletes {
+		req.Success = append(req.Success, etcdRequestOp{
+			Delete: &etcdDeleteRequest{Key: encodeKey(r.prefix + v)},
+		})
+	}
+	// Nothing to write?
+	if len(req.Success) == 0 {
+		return true, nil
+	}
+
+	resp := new(etcdTxnResponse)
+	if err := r.call("/v3/kv/txn", req, resp); err != nil {
+		return false, err
+	}
+
+	return resp.Succeeded, nil
+}
@@ -0,0 +1,155 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// kv is a key-value store that supports the optimistic transactions.
+type kv interface {
+	// get returns the pair of key, or the pairs whose keys start with key if
+	// prefix is true. The pairs are sorted by their keys.
+	get(key string, prefix bool) ([]kvPair, error)
+	// commit applies puts and deletes atomically if the revisions of the keys
+	// in compares are not changed. Zero revision means that the key does not
+	// exist. ok will be false if any revision has been changed.
+	commit(compares map[string]int64, puts map[string][]byte, deletes []string) (ok bool, err error)
+}
+
+type kvPair struct {
+	key      string
+	value    []byte
+	revision int64
+}
+
+// kvTxn records the revisions of the read keys and buffers the writes, which
+// are committed only if the read keys have not been modified in the meantime.
+type kvTxn struct {
+	kv      kv
+	reads   map[string]int64
+	puts    map[string][]byte
+	deletes map[string]bool
+}
+
+func newKVTxn(kv kv) *kvTxn {
+	return &kvTxn{
+		kv:      kv,
+		reads:   make(map[string]int64),
+		puts:    make(map[string][]byte),
+		deletes: make(map[string]bool),
+	}
+}
+
+// get decodes the value of key into v. ok will be false if there is no such key.
+// The buffered writes of this transaction are visible.
+func (r *kvTxn) get(key string, v interface{}) (ok bool, err error) {
+	if r.deletes[key] {
+		return false, nil
+	}
+	if value, ok := r.puts[key]; ok {
+		return true, json.Unmarshal(value, v)
+	}
+
+	pairs, err := r.kv.get(key, false)
+	if err != nil {
+		return false, err
+	}
+	if len(pairs) == 0 {
+		r.reads[key] = 0
+		return false, nil
+	}
+	r.reads[key] = pairs[0].revision
+
+	return true, json.Unmarshal(pairs[0].value, v)
+}
+
+// list calls f with the keys and values whose keys start with prefix in
+// ascending order. The buffered writes of this transaction are not visible.
+func (r *kvTxn) list(prefix string, f func(key string, value []byte) error) error {
+	pairs, err := r.kv.get(prefix, true)
+	if err != nil {
+		return err
+	}
+	for _, v := range pairs {
+		r.reads[v.key] = v.revision
+		if err := f(v.key, v.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *kvTxn) put(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	delete(r.deletes, key)
+	r.puts[key] = value
+
+	return nil
+}
+
+func (r *kvTxn) delete(key string) {
+	delete(r.puts, key)
+	r.deletes[key] = true
+}
+
+// nextID returns a new unique ID of the table.
+func (r *kvTxn) nextID(table string) (uint64, error) {
+	var id uint64
+	key := "seq/" + table
+	if _, err := r.get(key, &id); err != nil {
+		return 0, err
+	}
+	id++
+	if err := r.put(key, id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *kvTxn) commit() (ok bool, err error) {
+	deletes := make([]string, 0, len(r.deletes))
+	for k := range r.deletes {
+		deletes = append(deletes, k)
+	}
+
+	return r.kv.commit(r.reads, r.puts, deletes)
+}
+
+// idKey returns the key of the ID in the table. IDs are zero-padded, so that
+// the keys are sorted by the IDs.
+func idKey(table string, id uint64) string {
+	return fmt.Sprintf("%v/%020d", table, id)
+}
+
+// keyID returns the ID of the key made by idKey.
+func keyID(key string) (uint64, error) {
+	return strconv.ParseUint(key[strings.LastIndex(key, "/")+1:], 10, 64)
+}
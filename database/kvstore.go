@@ -0,0 +1,1968 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/superkkt/cherry/cluster"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/acl"
+	"github.com/superkkt/cherry/northbound/app/discovery"
+	"github.com/superkkt/cherry/northbound/app/journal"
+	"github.com/superkkt/cherry/northbound/app/pbr"
+	"github.com/superkkt/cherry/northbound/app/virtualip"
+)
+
+const maxConflictRetry = 10
+
+// KVStore stores the data in a key-value store as JSON documents, so that the
+// state can be shared by the clustered controllers through a distributed store
+// such as etcd. The relations, which are the foreign keys in the SQL backends,
+// are checked in the transactions.
+//
+// The keys are the table names followed by the zero-padded IDs. The IDs of the
+// IP addresses are the IPv4 addresses as integers, and an IP address only has a
+// record while it is used by a host or a VIP. The IDs of the switch ports are
+// made of the switch IDs and the port numbers.
+type KVStore struct {
+	kv     kv
+	random *rand.Rand
+}
+
+func newKVStore(kv kv) *KVStore {
+	return &KVStore{
+		kv:     kv,
+		random: rand.New(&randomSource{src: rand.NewSource(time.Now().Unix())}),
+	}
+}
+
+// update runs f in a transaction, and then commits it. f is called again if
+// the transaction conflicts with another one, so that f should initialize its
+// results.
+func (r *KVStore) update(f func(*kvTxn) error) error {
+	start := time.Now()
+	defer func() { queryDuration.Observe(time.Since(start).Seconds()) }()
+
+	for i := 0; ; i++ {
+		txn := newKVTxn(r.kv)
+		if err := f(txn); err != nil {
+			queryErrors.Inc()
+			return err
+		}
+		ok, err := txn.commit()
+		if err != nil {
+			queryErrors.Inc()
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if i >= maxConflictRetry {
+			queryErrors.Inc()
+			return errors.New("too many conflicts of the transactions")
+		}
+		queryRetries.Inc()
+		time.Sleep(time.Duration(r.random.Int31n(100)) * time.Millisecond)
+	}
+}
+
+// view runs f in a read-only transaction.
+func (r *KVStore) view(f func(*kvTxn) error) error {
+	start := time.Now()
+	defer func() { queryDuration.Observe(time.Since(start).Seconds()) }()
+
+	if err := f(newKVTxn(r.kv)); err != nil {
+		queryErrors.Inc()
+		return err
+	}
+
+	return nil
+}
+
+// Ping reads the master election key, which is a round trip to the backend
+// regardless of whether the key exists.
+func (r *KVStore) Ping() error {
+	_, err := r.kv.get("election/master", false)
+	return err
+}
+
+type kvSwitch struct {
+	ID               uint64 `json:"id"`
+	DPID             uint64 `json:"dpid"`
+	NumPorts         uint16 `json:"n_ports"`
+	FirstPort        uint16 `json:"first_port"`
+	FirstPrintedPort uint16 `json:"first_printed_port"`
+	Description      string `json:"description"`
+}
+
+// portName returns the printed name of the port.
+func (r kvSwitch) portName(number uint16) string {
+	return fmt.Sprintf("%v/%v", r.Description, int(number)-int(r.FirstPort)+int(r.FirstPrintedPort))
+}
+
+func (r kvSwitch) hasPort(number uint16) bool {
+	return number >= r.FirstPort && uint32(number) < uint32(r.FirstPort)+uint32(r.NumPorts)
+}
+
+func makePortID(swID uint64, number uint16) uint64 {
+	return swID<<16 | uint64(number)
+}
+
+func splitPortID(id uint64) (swID uint64, number uint16) {
+	return id >> 16, uint16(id & 0xFFFF)
+}
+
+type kvNetwork struct {
+	ID      uint64 `json:"id"`
+	Address string `json:"address"`
+	Mask    uint8  `json:"mask"`
+}
+
+func (r kvNetwork) ipNet() *net.IPNet {
+	mask := net.CIDRMask(int(r.Mask), 32)
+	return &net.IPNet{IP: net.ParseIP(r.Address).To4().Mask(mask), Mask: mask}
+}
+
+type kvIP struct {
+	HostID uint64 `json:"host_id,omitempty"`
+	VIPID  uint64 `json:"vip_id,omitempty"`
+}
+
+type kvHost struct {
+	ID          uint64    `json:"id"`
+	IPID        uint64    `json:"ip_id"`
+	PortID      *uint64   `json:"port_id"`
+	MAC         string    `json:"mac"`
+	IPv6        []string  `json:"ipv6"`
+	Description string    `json:"description"`
+	Timestamp   time.Time `json:"last_updated_timestamp"`
+}
+
+func (r kvHost) hasIPv6(ip net.IP) bool {
+	for _, v := range r.IPv6 {
+		if net.ParseIP(v).Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type kvVIP struct {
+	ID            uint64 `json:"id"`
+	IPID          uint64 `json:"ip_id"`
+	ActiveHostID  uint64 `json:"active_host_id"`
+	StandbyHostID uint64 `json:"standby_host_id"`
+	Description   string `json:"description"`
+}
+
+type kvFlow struct {
+	ID        uint64    `json:"id"`
+	SwitchID  uint64    `json:"switch_id"`
+	DstMAC    string    `json:"dst_mac"`
+	OutPort   uint32    `json:"out_port"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type kvMACRule struct {
+	ID    uint64 `json:"id"`
+	MAC   string `json:"mac"`
+	DPID  uint64 `json:"dpid"`
+	Port  uint32 `json:"port"`
+	Allow bool   `json:"allow"`
+}
+
+type kvPolicy struct {
+	ID       uint64 `json:"id"`
+	SrcNet   string `json:"src_net"` // Empty means any address.
+	DstNet   string `json:"dst_net"` // Empty means any address.
+	Protocol uint8  `json:"protocol"`
+	DstPort  uint16 `json:"dst_port"`
+	DPID     uint64 `json:"dpid"`
+	Port     uint32 `json:"port"`
+}
+
+type kvMaster struct {
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type kvMember struct {
+	UID       string    `json:"uid"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address"`
+	Leader    bool      `json:"leader"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type kvState struct {
+	State     []byte    `json:"state"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// listTable decodes all the records of the table into the slice pointed by v in ascending order of their IDs.
+func listTable(txn *kvTxn, table string, v interface{}) error {
+	values := []json.RawMessage{}
+	err := txn.list(table+"/", func(key string, value []byte) error {
+		values = append(values, json.RawMessage(value))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// page returns the range of the records in descending order of their IDs, as
+// the SQL backends do with LIMIT offset, limit + 1.
+func page(n int, limit, offset uint8) (start, end int) {
+	if limit == 0 {
+		return 0, n
+	}
+	start, end = int(offset), int(offset)+int(limit)+1
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+
+	return start, end
+}
+
+func reverse(n int, swap func(i, j int)) {
+	for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
+
+func ipID(ip net.IP) (uint64, error) {
+	v, err := ipv4ToInt(ip)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(v), nil
+}
+
+func macKey(mac net.HardwareAddr) string {
+	return "host_mac/" + hex.EncodeToString(mac) + "/"
+}
+
+func getSwitch(txn *kvTxn, id uint64) (*kvSwitch, error) {
+	v := new(kvSwitch)
+	ok, err := txn.get(idKey("switch", id), v)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func getSwitchByDPID(txn *kvTxn, dpid uint64) (*kvSwitch, error) {
+	var id uint64
+	ok, err := txn.get(idKey("switch_dpid", dpid), &id)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return getSwitch(txn, id)
+}
+
+func getPortID(txn *kvTxn, swDPID uint64, portNum uint16) (uint64, error) {
+	sw, err := getSwitchByDPID(txn, swDPID)
+	if err != nil {
+		return 0, err
+	}
+	if sw == nil || !sw.hasPort(portNum) {
+		return 0, fmt.Errorf("unknown switch port (DPID=%v, Number=%v)", swDPID, portNum)
+	}
+
+	return makePortID(sw.ID, portNum), nil
+}
+
+func getHost(txn *kvTxn, id uint64) (*kvHost, error) {
+	v := new(kvHost)
+	ok, err := txn.get(idKey("host", id), v)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func putHost(txn *kvTxn, h *kvHost) error {
+	return txn.put(idKey("host", h.ID), h)
+}
+
+// hostsByMAC returns the hosts whose MAC address is mac.
+func hostsByMAC(txn *kvTxn, mac net.HardwareAddr) ([]*kvHost, error) {
+	ids := []uint64{}
+	err := txn.list(macKey(mac), func(key string, value []byte) error {
+		id, err := keyID(key)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := []*kvHost{}
+	for _, id := range ids {
+		h, err := getHost(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts, nil
+}
+
+func getVIPRecord(txn *kvTxn, id uint64) (*kvVIP, error) {
+	v := new(kvVIP)
+	ok, err := txn.get(idKey("vip", id), v)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// findNetwork returns the network that contains the IP address specified by ipID, or nil if there is no such network.
+func findNetwork(networks []kvNetwork, ipID uint64) *kvNetwork {
+	ip := intToIPv4(int64(ipID))
+	for i := range networks {
+		if networks[i].ipNet().Contains(ip) {
+			return &networks[i]
+		}
+	}
+
+	return nil
+}
+
+// checkAvailableIP returns an error if the IP address specified by id is unknown or used.
+func checkAvailableIP(txn *kvTxn, id uint64) (*kvNetwork, error) {
+	networks := []kvNetwork{}
+	if err := listTable(txn, "network", &networks); err != nil {
+		return nil, err
+	}
+	n := findNetwork(networks, id)
+	// Network and broadcast addresses are not the IP addresses of the network.
+	if n == nil || id == uint64(binary32(n.ipNet().IP)) || id == uint64(binary32(broadcast(n.ipNet()))) {
+		return nil, errors.New("unknown IP address ID")
+	}
+	ok, err := txn.get(idKey("ip", id), new(kvIP))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, errors.New("already used IP address")
+	}
+
+	return n, nil
+}
+
+func binary32(ip net.IP) uint32 {
+	v, _ := ipv4ToInt(ip)
+	return uint32(v)
+}
+
+func broadcast(n *net.IPNet) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	for i := range ip {
+		ip[i] = n.IP.To4()[i] | ^n.Mask[i]
+	}
+
+	return ip
+}
+
+func (r *KVStore) MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
+	if ip == nil {
+		panic("IP address is nil")
+	}
+	id, err := ipID(ip)
+	if err != nil {
+		return nil, false, err
+	}
+
+	f := func(txn *kvTxn) error {
+		var v kvIP
+		used, err := txn.get(idKey("ip", id), &v)
+		if err != nil || !used {
+			return err
+		}
+		hostID := v.HostID
+		if v.VIPID != 0 {
+			vip, err := getVIPRecord(txn, v.VIPID)
+			if err != nil || vip == nil {
+				return err
+			}
+			hostID = vip.ActiveHostID
+		}
+		h, err := getHost(txn, hostID)
+		if err != nil || h == nil {
+			return err
+		}
+		if mac, err = net.ParseMAC(h.MAC); err != nil {
+			return err
+		}
+		ok = true
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, false, err
+	}
+
+	return mac, ok, nil
+}
+
+func (r *KVStore) Location(mac net.HardwareAddr) (dpid string, port uint32, status network.LocationStatus, err error) {
+	if mac == nil {
+		panic("MAC address is nil")
+	}
+
+	status = network.LocationUnregistered
+	f := func(txn *kvTxn) error {
+		hosts, err := hostsByMAC(txn, mac)
+		if err != nil || len(hosts) == 0 {
+			return err
+		}
+		h := hosts[0]
+		if h.PortID == nil {
+			// The node is registered, but we don't know its physical location yet.
+			status = network.LocationUndiscovered
+			return nil
+		}
+		swID, number := splitPortID(*h.PortID)
+		sw, err := getSwitch(txn, swID)
+		if err != nil || sw == nil {
+			return err
+		}
+		dpid, port, status = strconv.FormatUint(sw.DPID, 10), uint32(number), network.LocationDiscovered
+
+		return nil
+	}
+	if err := r.view(f); err != nil {
+		return "", 0, network.LocationUnregistered, err
+	}
+
+	return dpid, port, status, nil
+}
+
+func (r *KVStore) Switches(limit, offset uint8) (sw []network.Switch, err error) {
+	f := func(txn *kvTxn) error {
+		switches := []kvSwitch{}
+		if err := listTable(txn, "switch", &switches); err != nil {
+			return err
+		}
+		reverse(len(switches), func(i, j int) { switches[i], switches[j] = switches[j], switches[i] })
+		start, end := page(len(switches), limit, offset)
+		for _, v := range switches[start:end] {
+			sw = append(sw, network.Switch{
+				ID: v.ID,
+				SwitchParam: network.SwitchParam{
+					DPID:             v.DPID,
+					NumPorts:         v.NumPorts,
+					FirstPort:        v.FirstPort,
+					FirstPrintedPort: v.FirstPrintedPort,
+					Description:      v.Description,
+				},
+			})
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+func (r *KVStore) AddSwitch(sw network.SwitchParam) (swID uint64, err error) {
+	f := func(txn *kvTxn) error {
+		v, err := getSwitchByDPID(txn, sw.DPID)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			return fmt.Errorf("duplicated switch DPID: %v", sw.DPID)
+		}
+		if swID, err = txn.nextID("switch"); err != nil {
+			return err
+		}
+		if err := txn.put(idKey("switch_dpid", sw.DPID), swID); err != nil {
+			return err
+		}
+
+		return txn.put(idKey("switch", swID), kvSwitch{
+			ID:               swID,
+			DPID:             sw.DPID,
+			NumPorts:         sw.NumPorts,
+			FirstPort:        sw.FirstPort,
+			FirstPrintedPort: sw.FirstPrintedPort,
+			Description:      sw.Description,
+		})
+	}
+	if err = r.update(f); err != nil {
+		return 0, err
+	}
+
+	return swID, nil
+}
+
+func (r *KVStore) Switch(dpid uint64) (sw network.Switch, ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		v, err := getSwitchByDPID(txn, dpid)
+		if err != nil || v == nil {
+			return err
+		}
+		sw = network.Switch{
+			ID: v.ID,
+			SwitchParam: network.SwitchParam{
+				DPID:             v.DPID,
+				NumPorts:         v.NumPorts,
+				FirstPort:        v.FirstPort,
+				FirstPrintedPort: v.FirstPrintedPort,
+				Description:      v.Description,
+			},
+		}
+		ok = true
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return network.Switch{}, false, err
+	}
+
+	return sw, ok, nil
+}
+
+func (r *KVStore) RemoveSwitch(id uint64) (ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		sw, err := getSwitch(txn, id)
+		if err != nil || sw == nil {
+			return err
+		}
+		hosts := []kvHost{}
+		if err := listTable(txn, "host", &hosts); err != nil {
+			return err
+		}
+		for _, v := range hosts {
+			if v.PortID == nil {
+				continue
+			}
+			if swID, _ := splitPortID(*v.PortID); swID == id {
+				return errors.New("failed to remove a switch: it has child hosts connected to this switch")
+			}
+		}
+		flows := []kvFlow{}
+		if err := listTable(txn, "flow", &flows); err != nil {
+			return err
+		}
+		for _, v := range flows {
+			if v.SwitchID == id {
+				txn.delete(idKey("flow", v.ID))
+			}
+		}
+		txn.delete(idKey("switch_dpid", sw.DPID))
+		txn.delete(idKey("switch", id))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// SwitchAliases returns all the aliases of the switches.
+func (r *KVStore) SwitchAliases() (aliases []network.SwitchAlias, err error) {
+	f := func(txn *kvTxn) error {
+		aliases = []network.SwitchAlias{}
+		return listTable(txn, "switch_alias", &aliases)
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+// SetSwitchAlias adds the alias of a switch, or replaces the one of the same DPID.
+func (r *KVStore) SetSwitchAlias(alias network.SwitchAlias) error {
+	return r.update(func(txn *kvTxn) error {
+		aliases := []network.SwitchAlias{}
+		if err := listTable(txn, "switch_alias", &aliases); err != nil {
+			return err
+		}
+		for _, v := range aliases {
+			if v.Name == alias.Name && v.DPID != alias.DPID {
+				return errors.New("duplicated switch name")
+			}
+		}
+
+		return txn.put(idKey("switch_alias", alias.DPID), alias)
+	})
+}
+
+// RemoveSwitchAlias removes the alias of the switch whose DPID is dpid. ok will be false if there is no such alias.
+func (r *KVStore) RemoveSwitchAlias(dpid uint64) (ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		found, err := txn.get(idKey("switch_alias", dpid), new(network.SwitchAlias))
+		if err != nil || !found {
+			return err
+		}
+		txn.delete(idKey("switch_alias", dpid))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// MaintenanceWindows returns all the maintenance windows sorted by their IDs.
+func (r *KVStore) MaintenanceWindows() (windows []network.MaintenanceWindow, err error) {
+	f := func(txn *kvTxn) error {
+		windows = []network.MaintenanceWindow{}
+		if err := listTable(txn, "maintenance", &windows); err != nil {
+			return err
+		}
+		sort.Slice(windows, func(i, j int) bool { return windows[i].ID < windows[j].ID })
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// AddMaintenanceWindow adds a new maintenance window and returns its unique ID.
+func (r *KVStore) AddMaintenanceWindow(window network.MaintenanceWindow) (id uint64, err error) {
+	f := func(txn *kvTxn) error {
+		if id, err = txn.nextID("maintenance"); err != nil {
+			return err
+		}
+		window.ID = id
+
+		return txn.put(idKey("maintenance", id), window)
+	}
+	if err = r.update(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveMaintenanceWindow removes the maintenance window specified by id. ok will be false if there is no such window.
+func (r *KVStore) RemoveMaintenanceWindow(id uint64) (ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		found, err := txn.get(idKey("maintenance", id), new(network.MaintenanceWindow))
+		if err != nil || !found {
+			return err
+		}
+		txn.delete(idKey("maintenance", id))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+func (r *KVStore) SwitchPorts(swID uint64) (ports []network.SwitchPort, err error) {
+	f := func(txn *kvTxn) error {
+		sw, err := getSwitch(txn, swID)
+		if err != nil || sw == nil {
+			return err
+		}
+		for i := uint16(0); i < sw.NumPorts; i++ {
+			ports = append(ports, network.SwitchPort{
+				ID:     makePortID(swID, sw.FirstPort+i),
+				Number: uint(i) + 1,
+			})
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return ports, nil
+}
+
+func (r *KVStore) Networks(limit, offset uint8) (networks []network.Network, err error) {
+	f := func(txn *kvTxn) error {
+		v := []kvNetwork{}
+		if err := listTable(txn, "network", &v); err != nil {
+			return err
+		}
+		reverse(len(v), func(i, j int) { v[i], v[j] = v[j], v[i] })
+		start, end := page(len(v), limit, offset)
+		for _, n := range v[start:end] {
+			networks = append(networks, network.Network{
+				ID:           n.ID,
+				NetworkParam: network.NetworkParam{Address: n.Address, Mask: n.Mask},
+			})
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return networks, nil
+}
+
+func (r *KVStore) AddNetwork(addr net.IP, mask net.IPMask) (netID uint64, err error) {
+	ones, _ := mask.Size()
+	n := &net.IPNet{IP: addr.To4().Mask(mask), Mask: mask}
+
+	f := func(txn *kvTxn) error {
+		networks := []kvNetwork{}
+		if err := listTable(txn, "network", &networks); err != nil {
+			return err
+		}
+		for _, v := range networks {
+			if v.ipNet().Contains(n.IP) || n.Contains(v.ipNet().IP) {
+				return fmt.Errorf("overlapped network: %v", v.ipNet())
+			}
+		}
+		if netID, err = txn.nextID("network"); err != nil {
+			return err
+		}
+
+		return txn.put(idKey("network", netID), kvNetwork{ID: netID, Address: addr.String(), Mask: uint8(ones)})
+	}
+	if err = r.update(f); err != nil {
+		return 0, err
+	}
+
+	return netID, nil
+}
+
+func (r *KVStore) Network(addr net.IP) (n network.Network, ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		networks := []kvNetwork{}
+		if err := listTable(txn, "network", &networks); err != nil {
+			return err
+		}
+		for _, v := range networks {
+			if net.ParseIP(v.Address).Equal(addr) {
+				n = network.Network{ID: v.ID, NetworkParam: network.NetworkParam{Address: v.Address, Mask: v.Mask}}
+				ok = true
+				return nil
+			}
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return network.Network{}, false, err
+	}
+
+	return n, ok, nil
+}
+
+func (r *KVStore) RemoveNetwork(id uint64) (ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		v := new(kvNetwork)
+		found, err := txn.get(idKey("network", id), v)
+		if err != nil || !found {
+			return err
+		}
+		n := v.ipNet()
+		err = txn.list("ip/", func(key string, value []byte) error {
+			ipID, err := keyID(key)
+			if err != nil {
+				return err
+			}
+			if n.Contains(intToIPv4(int64(ipID))) {
+				return errors.New("failed to remove a network: it has child IP addresses that are being used by hosts")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		txn.delete(idKey("network", id))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+func (r *KVStore) IPAddrs(networkID uint64) (addresses []network.IP, err error) {
+	f := func(txn *kvTxn) error {
+		v := new(kvNetwork)
+		found, err := txn.get(idKey("network", networkID), v)
+		if err != nil || !found {
+			return err
+		}
+		hosts := []kvHost{}
+		if err := listTable(txn, "host", &hosts); err != nil {
+			return err
+		}
+		byIP := make(map[uint64]kvHost)
+		for _, h := range hosts {
+			byIP[h.IPID] = h
+		}
+		used := make(map[uint64]bool)
+		err = txn.list("ip/", func(key string, value []byte) error {
+			id, err := keyID(key)
+			if err != nil {
+				return err
+			}
+			used[id] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		first := uint64(binary32(v.ipNet().IP))
+		ones, bits := v.ipNet().Mask.Size()
+		// Minus two due to network and broadcast addresses
+		n := (uint64(1) << uint(bits-ones)) - 2
+		for id := first + 1; id <= first+n; id++ {
+			ip := network.IP{ID: id, Address: intToIPv4(int64(id)).String(), Used: used[id]}
+			if h, ok := byIP[id]; ok {
+				ip.Host = h.Description
+				if h.PortID != nil {
+					swID, number := splitPortID(*h.PortID)
+					sw, err := getSwitch(txn, swID)
+					if err != nil {
+						return err
+					}
+					if sw != nil {
+						ip.Port = sw.portName(number)
+					}
+				}
+			}
+			addresses = append(addresses, ip)
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+// toHost converts h to network.Host using the networks and the switches.
+func toHost(h kvHost, networks []kvNetwork, switches map[uint64]kvSwitch) network.Host {
+	v := network.Host{
+		ID:          strconv.FormatUint(h.ID, 10),
+		IP:          intToIPv4(int64(h.IPID)).String(),
+		MAC:         h.MAC,
+		Description: h.Description,
+	}
+	if n := findNetwork(networks, h.IPID); n != nil {
+		v.IP = fmt.Sprintf("%v/%v", v.IP, n.Mask)
+	}
+	if h.PortID != nil {
+		swID, number := splitPortID(*h.PortID)
+		if sw, ok := switches[swID]; ok {
+			v.Port = sw.portName(number)
+		}
+	}
+	// Check its freshness.
+	if time.Now().Sub(h.Timestamp) > discovery.ProbeInterval*3 {
+		v.Stale = true
+	}
+
+	return v
+}
+
+func loadTopology(txn *kvTxn) (networks []kvNetwork, switches map[uint64]kvSwitch, err error) {
+	if err := listTable(txn, "network", &networks); err != nil {
+		return nil, nil, err
+	}
+	sw := []kvSwitch{}
+	if err := listTable(txn, "switch", &sw); err != nil {
+		return nil, nil, err
+	}
+	switches = make(map[uint64]kvSwitch)
+	for _, v := range sw {
+		switches[v.ID] = v
+	}
+
+	return networks, switches, nil
+}
+
+func (r *KVStore) Hosts(limit, offset uint8) (hosts []network.Host, err error) {
+	f := func(txn *kvTxn) error {
+		networks, switches, err := loadTopology(txn)
+		if err != nil {
+			return err
+		}
+		v := []kvHost{}
+		if err := listTable(txn, "host", &v); err != nil {
+			return err
+		}
+		reverse(len(v), func(i, j int) { v[i], v[j] = v[j], v[i] })
+		start, end := page(len(v), limit, offset)
+		for _, h := range v[start:end] {
+			hosts = append(hosts, toHost(h, networks, switches))
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+func (r *KVStore) Host(id uint64) (host network.Host, ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		h, err := getHost(txn, id)
+		if err != nil || h == nil {
+			return err
+		}
+		networks, switches, err := loadTopology(txn)
+		if err != nil {
+			return err
+		}
+		host = toHost(*h, networks, switches)
+		ok = true
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return network.Host{}, false, err
+	}
+
+	return host, ok, nil
+}
+
+func (r *KVStore) AddHost(host network.HostParam) (hostID uint64, err error) {
+	mac, err := net.ParseMAC(host.MAC)
+	if err != nil {
+		return 0, err
+	}
+	ipv6, err := host.IPv6Addrs()
+	if err != nil {
+		return 0, err
+	}
+	addrs := make([]string, len(ipv6))
+	for i, v := range ipv6 {
+		addrs[i] = v.String()
+	}
+
+	f := func(txn *kvTxn) error {
+		if _, err := checkAvailableIP(txn, host.IPID); err != nil {
+			return err
+		}
+		if len(ipv6) > 0 {
+			hosts := []kvHost{}
+			if err := listTable(txn, "host", &hosts); err != nil {
+				return err
+			}
+			for _, h := range hosts {
+				for _, ip := range ipv6 {
+					if h.hasIPv6(ip) {
+						return fmt.Errorf("already used IPv6 address: %v", ip)
+					}
+				}
+			}
+		}
+		if hostID, err = txn.nextID("host"); err != nil {
+			return err
+		}
+		if err := txn.put(idKey("ip", host.IPID), kvIP{HostID: hostID}); err != nil {
+			return err
+		}
+		if err := txn.put(macKey(mac)+fmt.Sprintf("%020d", hostID), hostID); err != nil {
+			return err
+		}
+
+		return putHost(txn, &kvHost{
+			ID:          hostID,
+			IPID:        host.IPID,
+			MAC:         mac.String(),
+			IPv6:        addrs,
+			Description: host.Description,
+			Timestamp:   time.Now(),
+		})
+	}
+	if err = r.update(f); err != nil {
+		return 0, err
+	}
+
+	return hostID, nil
+}
+
+func (r *KVStore) RemoveHost(id uint64) (ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		h, err := getHost(txn, id)
+		if err != nil || h == nil {
+			return err
+		}
+		vips := []kvVIP{}
+		if err := listTable(txn, "vip", &vips); err != nil {
+			return err
+		}
+		for _, v := range vips {
+			if v.ActiveHostID == id || v.StandbyHostID == id {
+				return errors.New("failed to remove a host: it has child VIP addresses")
+			}
+		}
+		mac, err := net.ParseMAC(h.MAC)
+		if err != nil {
+			return err
+		}
+		txn.delete(macKey(mac) + fmt.Sprintf("%020d", id))
+		txn.delete(idKey("ip", h.IPID))
+		txn.delete(idKey("host", id))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// toggleVIPs swaps the active and standby hosts of vips, and then returns the
+// VIPs with the MAC addresses of the new active hosts.
+func toggleVIPs(txn *kvTxn, vips []kvVIP) ([]virtualip.Address, error) {
+	result := []virtualip.Address{}
+	for _, v := range vips {
+		v.ActiveHostID, v.StandbyHostID = v.StandbyHostID, v.ActiveHostID
+		if err := txn.put(idKey("vip", v.ID), v); err != nil {
+			return nil, err
+		}
+		h, err := getHost(txn, v.ActiveHostID)
+		if err != nil {
+			return nil, err
+		}
+		if h == nil {
+			return nil, fmt.Errorf("unknown host (ID=%v)", v.ActiveHostID)
+		}
+		mac, err := net.ParseMAC(h.MAC)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, virtualip.Address{IP: intToIPv4(int64(v.IPID)), MAC: mac})
+	}
+
+	return result, nil
+}
+
+// activeVIPs returns the VIPs whose active hosts satisfy match.
+func activeVIPs(txn *kvTxn, match func(*kvHost) bool) ([]kvVIP, error) {
+	vips := []kvVIP{}
+	if err := listTable(txn, "vip", &vips); err != nil {
+		return nil, err
+	}
+
+	result := []kvVIP{}
+	for _, v := range vips {
+		h, err := getHost(txn, v.ActiveHostID)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil && match(h) {
+			result = append(result, v)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *KVStore) ToggleVIP(id uint64) (ip net.IP, mac net.HardwareAddr, err error) {
+	f := func(txn *kvTxn) error {
+		v, err := getVIPRecord(txn, id)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return fmt.Errorf("unknown VIP (ID=%v)", id)
+		}
+		result, err := toggleVIPs(txn, []kvVIP{*v})
+		if err != nil {
+			return err
+		}
+		ip, mac = result[0].IP, result[0].MAC
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return nil, nil, err
+	}
+
+	return ip, mac, nil
+}
+
+func (r *KVStore) TogglePortVIP(swDPID uint64, portNum uint16) (result []virtualip.Address, err error) {
+	f := func(txn *kvTxn) error {
+		portID, err := getPortID(txn, swDPID, portNum)
+		if err != nil {
+			return err
+		}
+		vips, err := activeVIPs(txn, func(h *kvHost) bool { return h.PortID != nil && *h.PortID == portID })
+		if err != nil {
+			return err
+		}
+		result, err = toggleVIPs(txn, vips)
+
+		return err
+	}
+	if err = r.update(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *KVStore) ToggleDeviceVIP(swDPID uint64) (result []virtualip.Address, err error) {
+	f := func(txn *kvTxn) error {
+		result = nil
+
+		sw, err := getSwitchByDPID(txn, swDPID)
+		if err != nil || sw == nil {
+			return err
+		}
+		vips, err := activeVIPs(txn, func(h *kvHost) bool {
+			if h.PortID == nil {
+				return false
+			}
+			swID, _ := splitPortID(*h.PortID)
+			return swID == sw.ID
+		})
+		if err != nil {
+			return err
+		}
+		result, err = toggleVIPs(txn, vips)
+
+		return err
+	}
+	if err = r.update(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *KVStore) VIPs(limit, offset uint8) (result []network.VIP, err error) {
+	f := func(txn *kvTxn) error {
+		networks, switches, err := loadTopology(txn)
+		if err != nil {
+			return err
+		}
+		vips := []kvVIP{}
+		if err := listTable(txn, "vip", &vips); err != nil {
+			return err
+		}
+		reverse(len(vips), func(i, j int) { vips[i], vips[j] = vips[j], vips[i] })
+		start, end := page(len(vips), limit, offset)
+		for _, v := range vips[start:end] {
+			active, err := getHost(txn, v.ActiveHostID)
+			if err != nil {
+				return err
+			}
+			if active == nil {
+				return fmt.Errorf("unknown active host (ID=%v)", v.ActiveHostID)
+			}
+			standby, err := getHost(txn, v.StandbyHostID)
+			if err != nil {
+				return err
+			}
+			if standby == nil {
+				return fmt.Errorf("unknown standby host (ID=%v)", v.StandbyHostID)
+			}
+			ip := intToIPv4(int64(v.IPID)).String()
+			if n := findNetwork(networks, v.IPID); n != nil {
+				ip = fmt.Sprintf("%v/%v", ip, n.Mask)
+			}
+			result = append(result, network.VIP{
+				ID:          v.ID,
+				IP:          ip,
+				ActiveHost:  toHost(*active, networks, switches),
+				StandbyHost: toHost(*standby, networks, switches),
+				Description: v.Description,
+			})
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *KVStore) GetActivatedVIPs() (result []virtualip.Address, err error) {
+	f := func(txn *kvTxn) error {
+		vips, err := activeVIPs(txn, func(h *kvHost) bool { return true })
+		if err != nil {
+			return err
+		}
+		for _, v := range vips {
+			h, err := getHost(txn, v.ActiveHostID)
+			if err != nil {
+				return err
+			}
+			mac, err := net.ParseMAC(h.MAC)
+			if err != nil {
+				return err
+			}
+			result = append(result, virtualip.Address{IP: intToIPv4(int64(v.IPID)), MAC: mac})
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *KVStore) AddVIP(vip network.VIPParam) (id uint64, cidr string, err error) {
+	f := func(txn *kvTxn) error {
+		n, err := checkAvailableIP(txn, vip.IPID)
+		if err != nil {
+			return err
+		}
+		for _, hostID := range []uint64{vip.ActiveHostID, vip.StandbyHostID} {
+			h, err := getHost(txn, hostID)
+			if err != nil {
+				return err
+			}
+			if h == nil {
+				return fmt.Errorf("unknown host (ID=%v)", hostID)
+			}
+		}
+		if id, err = txn.nextID("vip"); err != nil {
+			return err
+		}
+		if err := txn.put(idKey("ip", vip.IPID), kvIP{VIPID: id}); err != nil {
+			return err
+		}
+		cidr = fmt.Sprintf("%v/%v", intToIPv4(int64(vip.IPID)), n.Mask)
+
+		return txn.put(idKey("vip", id), kvVIP{
+			ID:            id,
+			IPID:          vip.IPID,
+			ActiveHostID:  vip.ActiveHostID,
+			StandbyHostID: vip.StandbyHostID,
+			Description:   vip.Description,
+		})
+	}
+	if err = r.update(f); err != nil {
+		return 0, "", err
+	}
+
+	return id, cidr, nil
+}
+
+func (r *KVStore) RemoveVIP(id uint64) (ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		v, err := getVIPRecord(txn, id)
+		if err != nil || v == nil {
+			return err
+		}
+		txn.delete(idKey("ip", v.IPID))
+		txn.delete(idKey("vip", id))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// GetUndiscoveredHosts returns IP addresses whose physical location is still
+// undiscovered, and the ones whose location has been staled more than
+// expiration. The results can be nil on empty result.
+func (r *KVStore) GetUndiscoveredHosts(expiration time.Duration) (undiscovered, staled []net.IP, err error) {
+	f := func(txn *kvTxn) error {
+		hosts := []kvHost{}
+		if err := listTable(txn, "host", &hosts); err != nil {
+			return err
+		}
+		for _, v := range hosts {
+			ip := intToIPv4(int64(v.IPID))
+			if v.PortID == nil {
+				undiscovered = append(undiscovered, ip)
+			} else if time.Now().Sub(v.Timestamp) > expiration {
+				staled = append(staled, ip)
+			}
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, nil, err
+	}
+
+	return undiscovered, staled, nil
+}
+
+// UpdateHostLocation updates the physical location of a host, whose MAC and IP
+// addresses are matched with mac and ip, to the port identified by swDPID and
+// portNum. updated will be true if its location has been actually updated.
+func (r *KVStore) UpdateHostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
+	id, err := ipID(ip)
+	if err != nil {
+		return false, err
+	}
+
+	return r.updateLocation(mac, swDPID, portNum, func(h *kvHost) bool { return h.IPID == id })
+}
+
+// UpdateIPv6HostLocation updates the physical location of a host, whose MAC
+// and IPv6 addresses are matched with mac and ip, to the port identified by
+// swDPID and portNum. updated will be true if its location has been actually updated.
+func (r *KVStore) UpdateIPv6HostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
+	return r.updateLocation(mac, swDPID, portNum, func(h *kvHost) bool { return h.hasIPv6(ip) })
+}
+
+// updateLocation updates the location of the host whose MAC address is mac and that satisfies match.
+func (r *KVStore) updateLocation(mac net.HardwareAddr, swDPID uint64, portNum uint16, match func(*kvHost) bool) (updated bool, err error) {
+	f := func(txn *kvTxn) error {
+		updated, err = updateLocationTxn(txn, mac, swDPID, portNum, match)
+		return err
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+func updateLocationTxn(txn *kvTxn, mac net.HardwareAddr, swDPID uint64, portNum uint16, match func(*kvHost) bool) (updated bool, err error) {
+	hosts, err := hostsByMAC(txn, mac)
+	if err != nil {
+		return false, err
+	}
+	var host *kvHost
+	for _, v := range hosts {
+		if match(v) {
+			host = v
+			break
+		}
+	}
+	// Unknown host?
+	if host == nil {
+		return false, nil
+	}
+	portID, err := getPortID(txn, swDPID, portNum)
+	if err != nil {
+		return false, err
+	}
+	updated = host.PortID == nil || *host.PortID != portID
+	host.PortID = &portID
+	host.Timestamp = time.Now()
+
+	return updated, putHost(txn, host)
+}
+
+// UpdateHostLocations updates the host locations in a single transaction as
+// UpdateHostLocation and UpdateIPv6HostLocation do. updated[i] will be true if
+// the location of updates[i] has been actually updated.
+func (r *KVStore) UpdateHostLocations(updates []discovery.LocationUpdate) (updated []bool, err error) {
+	f := func(txn *kvTxn) error {
+		updated = make([]bool, len(updates))
+		for i, v := range updates {
+			ip := v.IP
+			match := func(h *kvHost) bool { return h.hasIPv6(ip) }
+			if ip.To4() != nil {
+				id, err := ipID(ip)
+				if err != nil {
+					return err
+				}
+				match = func(h *kvHost) bool { return h.IPID == id }
+			}
+			if updated[i], err = updateLocationTxn(txn, v.MAC, v.DPID, v.Port, match); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// ResetHostLocationsByPort sets NULL to the host locations that belong to the
+// port specified by swDPID and portNum, and then returns the reset hosts.
+func (r *KVStore) ResetHostLocationsByPort(swDPID uint64, portNum uint16) (hosts []discovery.Host, err error) {
+	return r.resetHostLocations(swDPID, func(number uint16) bool { return number == portNum })
+}
+
+// ResetHostLocationsByDevice sets NULL to the host locations that belong to the
+// device specified by swDPID, and then returns the reset hosts.
+func (r *KVStore) ResetHostLocationsByDevice(swDPID uint64) (hosts []discovery.Host, err error) {
+	return r.resetHostLocations(swDPID, func(number uint16) bool { return true })
+}
+
+// ResetHostLocationsByPorts sets NULL to the host locations that belong to the
+// ports specified by swDPID and portNums in a single transaction, and then
+// returns the reset hosts. Unknown ports are ignored.
+func (r *KVStore) ResetHostLocationsByPorts(swDPID uint64, portNums []uint16) (hosts []discovery.Host, err error) {
+	ports := make(map[uint16]bool)
+	for _, v := range portNums {
+		ports[v] = true
+	}
+
+	return r.resetHostLocations(swDPID, func(number uint16) bool { return ports[number] })
+}
+
+// resetHostLocations sets NULL to the locations of the hosts on the ports of the device that satisfy match.
+func (r *KVStore) resetHostLocations(swDPID uint64, match func(number uint16) bool) (hosts []discovery.Host, err error) {
+	f := func(txn *kvTxn) error {
+		hosts = nil
+
+		sw, err := getSwitchByDPID(txn, swDPID)
+		if err != nil || sw == nil {
+			return err
+		}
+		v := []kvHost{}
+		if err := listTable(txn, "host", &v); err != nil {
+			return err
+		}
+		for i := range v {
+			h := &v[i]
+			if h.PortID == nil {
+				continue
+			}
+			swID, number := splitPortID(*h.PortID)
+			if swID != sw.ID || !match(number) {
+				continue
+			}
+			mac, err := net.ParseMAC(h.MAC)
+			if err != nil {
+				return err
+			}
+			hosts = append(hosts, discovery.Host{
+				MAC:      mac,
+				IP:       intToIPv4(int64(h.IPID)),
+				Location: discovery.Location{DPID: swDPID, Port: uint32(number)},
+			})
+			h.PortID = nil
+			if err := putHost(txn, h); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+// GetUndiscoveredIPv6Hosts returns IPv6 addresses of the hosts whose physical
+// location is still undiscovered, and the ones whose location has been staled
+// more than expiration. The results can be nil on empty result.
+func (r *KVStore) GetUndiscoveredIPv6Hosts(expiration time.Duration) (undiscovered, staled []net.IP, err error) {
+	f := func(txn *kvTxn) error {
+		hosts := []kvHost{}
+		if err := listTable(txn, "host", &hosts); err != nil {
+			return err
+		}
+		for _, v := range hosts {
+			for _, addr := range v.IPv6 {
+				ip := net.ParseIP(addr)
+				if ip == nil {
+					return fmt.Errorf("invalid IPv6 address: %v", addr)
+				}
+				if v.PortID == nil {
+					undiscovered = append(undiscovered, ip)
+				} else if time.Now().Sub(v.Timestamp) > expiration {
+					staled = append(staled, ip)
+				}
+			}
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, nil, err
+	}
+
+	return undiscovered, staled, nil
+}
+
+// Elect selects a new master as uid if there is a no existing master that has
+// been updated within expiration. elected will be true if this uid has been
+// elected as the new master or was already elected.
+func (r *KVStore) Elect(uid string, expiration time.Duration) (elected bool, err error) {
+	f := func(txn *kvTxn) error {
+		elected = false
+
+		var master kvMaster
+		ok, err := txn.get("election/master", &master)
+		if err != nil {
+			return err
+		}
+		// No existing master, already elected, or another stale master?
+		if !ok || master.Name == uid || time.Now().Sub(master.Timestamp) > expiration {
+			elected = true
+			return txn.put("election/master", kvMaster{Name: uid, Timestamp: time.Now()})
+		}
+
+		return nil
+	}
+	if err := r.update(f); err != nil {
+		return false, err
+	}
+
+	return elected, nil
+}
+
+// Heartbeat records the heartbeat of m, and then returns the members whose
+// last heartbeats are within expiration, including m. The members whose
+// heartbeats have expired are removed.
+func (r *KVStore) Heartbeat(m cluster.Member, expiration time.Duration) ([]cluster.Member, error) {
+	// Each member only writes its own key, so that the heartbeats of the
+	// members never conflict with each other.
+	f := func(txn *kvTxn) error {
+		return txn.put("cluster/member/"+m.UID, kvMember{
+			UID:       m.UID,
+			Name:      m.Name,
+			Address:   m.Address,
+			Leader:    m.Leader,
+			Timestamp: time.Now(),
+		})
+	}
+	if err := r.update(f); err != nil {
+		return nil, err
+	}
+
+	var members []cluster.Member
+	var stale []string
+	f = func(txn *kvTxn) error {
+		members, stale = nil, nil
+		return txn.list("cluster/member/", func(key string, value []byte) error {
+			var v kvMember
+			if err := json.Unmarshal(value, &v); err != nil {
+				return err
+			}
+			if time.Now().Sub(v.Timestamp) > expiration {
+				stale = append(stale, key)
+				return nil
+			}
+			members = append(members, cluster.Member{
+				UID:       v.UID,
+				Name:      v.Name,
+				Address:   v.Address,
+				Leader:    v.Leader,
+				Timestamp: v.Timestamp,
+			})
+			return nil
+		})
+	}
+	if err := r.view(f); err != nil {
+		return nil, err
+	}
+	if len(stale) == 0 {
+		return members, nil
+	}
+
+	f = func(txn *kvTxn) error {
+		for _, key := range stale {
+			var v kvMember
+			ok, err := txn.get(key, &v)
+			if err != nil {
+				return err
+			}
+			// Still stale?
+			if ok && time.Now().Sub(v.Timestamp) > expiration {
+				txn.delete(key)
+			}
+		}
+		return nil
+	}
+	if err := r.update(f); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SaveState stores state of the replica specified by name.
+func (r *KVStore) SaveState(name string, state []byte) error {
+	return r.update(func(txn *kvTxn) error {
+		return txn.put("cluster/state/"+name, kvState{State: state, Timestamp: time.Now()})
+	})
+}
+
+// State returns the state of the replica specified by name and when it has
+// been stored. ok will be false if there is no such state.
+func (r *KVStore) State(name string) (state []byte, timestamp time.Time, ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		var v kvState
+		if ok, err = txn.get("cluster/state/"+name, &v); err != nil {
+			return err
+		}
+		state, timestamp = v.State, v.Timestamp
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	return state, timestamp, ok, nil
+}
+
+// AddFlow adds a new flow into the database and returns its unique ID.
+func (r *KVStore) AddFlow(swDPID uint64, dstMAC net.HardwareAddr, outPort uint32) (flowID uint64, err error) {
+	f := func(txn *kvTxn) error {
+		sw, err := getSwitchByDPID(txn, swDPID)
+		if err != nil {
+			return err
+		}
+		if sw == nil {
+			return fmt.Errorf("unknown switch (DPID=%v)", swDPID)
+		}
+		if flowID, err = txn.nextID("flow"); err != nil {
+			return err
+		}
+
+		return txn.put(idKey("flow", flowID), kvFlow{
+			ID:        flowID,
+			SwitchID:  sw.ID,
+			DstMAC:    dstMAC.String(),
+			OutPort:   outPort,
+			Timestamp: time.Now(),
+		})
+	}
+	if err := r.update(f); err != nil {
+		return 0, err
+	}
+
+	return flowID, nil
+}
+
+// RemoveFlow removes the flow specified by flowID from the database. Unlike
+// the SQL backends, the removed flows are not kept as the history.
+func (r *KVStore) RemoveFlow(flowID uint64) error {
+	return r.update(func(txn *kvTxn) error {
+		txn.delete(idKey("flow", flowID))
+		return nil
+	})
+}
+
+// MACRules returns all the MAC access control rules.
+func (r *KVStore) MACRules() (rules []acl.Rule, err error) {
+	f := func(txn *kvTxn) error {
+		v := []kvMACRule{}
+		if err := listTable(txn, "mac_acl", &v); err != nil {
+			return err
+		}
+		for _, rule := range v {
+			mac, err := net.ParseMAC(rule.MAC)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, acl.Rule{ID: rule.ID, MAC: mac, DPID: rule.DPID, Port: rule.Port, Allow: rule.Allow})
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// AddMACRule adds a new MAC access control rule and returns its unique ID.
+func (r *KVStore) AddMACRule(rule acl.Rule) (id uint64, err error) {
+	f := func(txn *kvTxn) error {
+		v := []kvMACRule{}
+		if err := listTable(txn, "mac_acl", &v); err != nil {
+			return err
+		}
+		for _, e := range v {
+			if e.MAC == rule.MAC.String() && e.DPID == rule.DPID && e.Port == rule.Port {
+				return fmt.Errorf("duplicated MAC rule (ID=%v)", e.ID)
+			}
+		}
+		if id, err = txn.nextID("mac_acl"); err != nil {
+			return err
+		}
+
+		return txn.put(idKey("mac_acl", id), kvMACRule{ID: id, MAC: rule.MAC.String(), DPID: rule.DPID, Port: rule.Port, Allow: rule.Allow})
+	}
+	if err = r.update(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveMACRule removes the MAC access control rule specified by id, and then returns the removed one.
+func (r *KVStore) RemoveMACRule(id uint64) (rule acl.Rule, ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		var v kvMACRule
+		found, err := txn.get(idKey("mac_acl", id), &v)
+		if err != nil || !found {
+			return err
+		}
+		mac, err := net.ParseMAC(v.MAC)
+		if err != nil {
+			return err
+		}
+		rule = acl.Rule{ID: v.ID, MAC: mac, DPID: v.DPID, Port: v.Port, Allow: v.Allow}
+		txn.delete(idKey("mac_acl", id))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return acl.Rule{}, false, err
+	}
+
+	return rule, ok, nil
+}
+
+func parseIPNet(s string) (*net.IPNet, error) {
+	if s == "" {
+		return nil, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+
+	return n, err
+}
+
+func formatIPNet(n *net.IPNet) string {
+	if n == nil {
+		return ""
+	}
+
+	return n.String()
+}
+
+// Policies returns all the routing policies sorted by their IDs.
+func (r *KVStore) Policies() (policies []pbr.Policy, err error) {
+	f := func(txn *kvTxn) error {
+		v := []kvPolicy{}
+		if err := listTable(txn, "pbr_policy", &v); err != nil {
+			return err
+		}
+		sort.Slice(v, func(i, j int) bool { return v[i].ID < v[j].ID })
+		for _, p := range v {
+			policy := pbr.Policy{ID: p.ID, Protocol: p.Protocol, DstPort: p.DstPort, DPID: p.DPID, Port: p.Port}
+			if policy.SrcNet, err = parseIPNet(p.SrcNet); err != nil {
+				return err
+			}
+			if policy.DstNet, err = parseIPNet(p.DstNet); err != nil {
+				return err
+			}
+			policies = append(policies, policy)
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// AddPolicy adds a new routing policy and returns its unique ID.
+func (r *KVStore) AddPolicy(policy pbr.Policy) (id uint64, err error) {
+	f := func(txn *kvTxn) error {
+		if id, err = txn.nextID("pbr_policy"); err != nil {
+			return err
+		}
+
+		return txn.put(idKey("pbr_policy", id), kvPolicy{
+			ID:       id,
+			SrcNet:   formatIPNet(policy.SrcNet),
+			DstNet:   formatIPNet(policy.DstNet),
+			Protocol: policy.Protocol,
+			DstPort:  policy.DstPort,
+			DPID:     policy.DPID,
+			Port:     policy.Port,
+		})
+	}
+	if err = r.update(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemovePolicy removes the routing policy specified by id. ok will be false if there is no such policy.
+func (r *KVStore) RemovePolicy(id uint64) (ok bool, err error) {
+	f := func(txn *kvTxn) error {
+		ok = false
+
+		found, err := txn.get(idKey("pbr_policy", id), new(kvPolicy))
+		if err != nil || !found {
+			return err
+		}
+		txn.delete(idKey("pbr_policy", id))
+		ok = true
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// AddJournal records the journal entries in a single transaction.
+func (r *KVStore) AddJournal(entries []journal.Entry) error {
+	return r.update(func(txn *kvTxn) error {
+		for _, v := range entries {
+			id, err := txn.nextID("journal")
+			if err != nil {
+				return err
+			}
+			v.ID = id
+			if err := txn.put(idKey("journal", id), v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Journal returns the journal entries recorded at or after since, whose type
+// is eventType, in descending order of their IDs. Zero since and empty
+// eventType match all the entries.
+func (r *KVStore) Journal(since time.Time, eventType string, limit uint16) (entries []journal.Entry, err error) {
+	f := func(txn *kvTxn) error {
+		v := []journal.Entry{}
+		if err := listTable(txn, "journal", &v); err != nil {
+			return err
+		}
+		entries = nil
+		for i := len(v) - 1; i >= 0 && len(entries) < int(limit); i-- {
+			if v[i].Timestamp.Before(since) || (len(eventType) > 0 && v[i].Type != eventType) {
+				continue
+			}
+			entries = append(entries, v[i])
+		}
+
+		return nil
+	}
+	if err = r.view(f); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RemoveJournal removes the journal entries recorded before t, and then returns the number of the removed entries.
+func (r *KVStore) RemoveJournal(before time.Time) (n int64, err error) {
+	f := func(txn *kvTxn) error {
+		n = 0
+
+		v := []journal.Entry{}
+		if err := listTable(txn, "journal", &v); err != nil {
+			return err
+		}
+		for _, e := range v {
+			if e.Timestamp.Before(before) {
+				txn.delete(idKey("journal", e.ID))
+				n++
+			}
+		}
+
+		return nil
+	}
+	if err = r.update(f); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+func init() {
+	Register("memory", func() (Database, error) { return NewMemory(), nil })
+}
+
+// Memory keeps the data only in memory, so that all the data are lost when the
+// controller is restarted. It is for the demos and the tests that do not need a
+// real database server.
+type Memory struct {
+	*KVStore
+}
+
+func NewMemory() *Memory {
+	return &Memory{newKVStore(newMemoryKV())}
+}
+
+type memoryKV struct {
+	mutex    sync.Mutex
+	revision int64
+	pairs    map[string]kvPair
+}
+
+func newMemoryKV() *memoryKV {
+	return &memoryKV{
+		pairs: make(map[string]kvPair),
+	}
+}
+
+func (r *memoryKV) get(key string, prefix bool) ([]kvPair, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !prefix {
+		v, ok := r.pairs[key]
+		if !ok {
+			return nil, nil
+		}
+		return []kvPair{v}, nil
+	}
+
+	result := []kvPair{}
+	for k, v := range r.pairs {
+		if strings.HasPrefix(k, key) {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].key < result[j].key })
+
+	return result, nil
+}
+
+func (r *memoryKV) commit(compares map[string]int64, puts map[string][]byte, deletes []string) (ok bool, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for k, v := range compares {
+		// Missing key has zero revision.
+		if r.pairs[k].revision != v {
+			return false, nil
+		}
+	}
+
+	r.revision++
+	for k, v := range puts {
+		value := make([]byte, len(v))
+		copy(value, v)
+		r.pairs[k] = kvPair{key: k, value: value, revision: r.revision}
+	}
+	for _, v := range deletes {
+		delete(r.pairs, v)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,258 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/cluster"
+	"github.com/superkkt/cherry/network"
+)
+
+func TestMemoryHostLocation(t *testing.T) {
+	db := NewMemory()
+
+	swID, err := db.AddSwitch(network.SwitchParam{DPID: 1, NumPorts: 4, FirstPort: 1, FirstPrintedPort: 1, Description: "sw1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddSwitch(network.SwitchParam{DPID: 1, NumPorts: 4}); err == nil {
+		t.Fatal("expected an error for the duplicated DPID")
+	}
+	if _, err := db.AddNetwork(net.IPv4(10, 0, 0, 0), net.CIDRMask(24, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddNetwork(net.IPv4(10, 0, 0, 128), net.CIDRMask(25, 32)); err == nil {
+		t.Fatal("expected an error for the overlapped network")
+	}
+
+	ip := net.IPv4(10, 0, 0, 1).To4()
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	ipID, err := ipID(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostID, err := db.AddHost(network.HostParam{IPID: ipID, MAC: mac.String(), Description: "host1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddHost(network.HostParam{IPID: ipID, MAC: mac.String()}); err == nil {
+		t.Fatal("expected an error for the used IP address")
+	}
+
+	_, _, status, err := db.Location(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != network.LocationUndiscovered {
+		t.Fatalf("unexpected location status: %v", status)
+	}
+
+	updated, err := db.UpdateHostLocation(mac, ip, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("expected the updated location")
+	}
+	if updated, _ := db.UpdateHostLocation(mac, ip, 1, 2); updated {
+		t.Fatal("expected the unchanged location")
+	}
+	dpid, port, status, err := db.Location(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dpid != "1" || port != 2 || status != network.LocationDiscovered {
+		t.Fatalf("unexpected location: dpid=%v, port=%v, status=%v", dpid, port, status)
+	}
+	host, ok, err := db.Host(hostID)
+	if err != nil || !ok {
+		t.Fatalf("failed to query the host: ok=%v, err=%v", ok, err)
+	}
+	if host.IP != "10.0.0.1/24" || host.Port != "sw1/2" {
+		t.Fatalf("unexpected host: %+v", host)
+	}
+
+	if _, err := db.RemoveSwitch(swID); err == nil {
+		t.Fatal("expected an error for the switch that has the connected hosts")
+	}
+	hosts, err := db.ResetHostLocationsByDevice(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || !hosts[0].IP.Equal(ip) {
+		t.Fatalf("unexpected reset hosts: %v", hosts)
+	}
+	if ok, err := db.RemoveSwitch(swID); err != nil || !ok {
+		t.Fatalf("failed to remove the switch: ok=%v, err=%v", ok, err)
+	}
+}
+
+func TestMemoryIPv6Host(t *testing.T) {
+	db := NewMemory()
+	if _, err := db.AddSwitch(network.SwitchParam{DPID: 1, NumPorts: 4, FirstPort: 1, FirstPrintedPort: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddNetwork(net.IPv4(10, 0, 0, 0), net.CIDRMask(24, 32)); err != nil {
+		t.Fatal(err)
+	}
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	ip := net.ParseIP("2001:db8::1")
+	id1, _ := ipID(net.IPv4(10, 0, 0, 1))
+	id2, _ := ipID(net.IPv4(10, 0, 0, 2))
+	host := network.HostParam{IPID: id1, MAC: mac.String(), IPv6: []string{ip.String()}}
+	if _, err := db.AddHost(host); err != nil {
+		t.Fatal(err)
+	}
+	host.IPID = id2
+	if _, err := db.AddHost(host); err == nil {
+		t.Fatal("expected an error for the used IPv6 address")
+	}
+	host.IPv6 = []string{"10.0.0.3"}
+	if _, err := db.AddHost(host); err == nil {
+		t.Fatal("expected an error for the invalid IPv6 address")
+	}
+
+	undiscovered, _, err := db.GetUndiscoveredIPv6Hosts(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undiscovered) != 1 || !undiscovered[0].Equal(ip) {
+		t.Fatalf("unexpected undiscovered IPv6 hosts: %v", undiscovered)
+	}
+	updated, err := db.UpdateIPv6HostLocation(mac, ip, 1, 2)
+	if err != nil || !updated {
+		t.Fatalf("failed to update the location: updated=%v, err=%v", updated, err)
+	}
+	if undiscovered, _, _ := db.GetUndiscoveredIPv6Hosts(time.Hour); len(undiscovered) != 0 {
+		t.Fatalf("unexpected undiscovered IPv6 hosts: %v", undiscovered)
+	}
+}
+
+func TestMemoryHeartbeat(t *testing.T) {
+	db := NewMemory()
+	expiration := 200 * time.Millisecond
+
+	if _, err := db.Heartbeat(cluster.Member{UID: "a", Name: "ctl1", Leader: true}, expiration); err != nil {
+		t.Fatal(err)
+	}
+	members, err := db.Heartbeat(cluster.Member{UID: "b", Name: "ctl2"}, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("unexpected number of the members: expected=2, actual=%v", len(members))
+	}
+
+	// ctl1 is dead.
+	time.Sleep(expiration + 50*time.Millisecond)
+	members, err = db.Heartbeat(cluster.Member{UID: "b", Name: "ctl2", Leader: true}, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].UID != "b" || !members[0].Leader {
+		t.Fatalf("unexpected members: %+v", members)
+	}
+}
+
+func TestMemoryState(t *testing.T) {
+	db := NewMemory()
+
+	if _, _, ok, err := db.State("topology"); err != nil || ok {
+		t.Fatalf("unexpected state: ok=%v, err=%v", ok, err)
+	}
+	for _, v := range []string{"first", "second"} {
+		if err := db.SaveState("topology", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state, timestamp, ok, err := db.State("topology")
+	if err != nil || !ok {
+		t.Fatalf("failed to get the state: ok=%v, err=%v", ok, err)
+	}
+	if string(state) != "second" {
+		t.Fatalf("unexpected state: expected=second, actual=%v", string(state))
+	}
+	if time.Since(timestamp) > time.Second {
+		t.Fatalf("unexpected timestamp: %v", timestamp)
+	}
+}
+
+func TestMemorySwitchAlias(t *testing.T) {
+	db := NewMemory()
+
+	for _, v := range []network.SwitchAlias{{DPID: 2, Name: "leaf2"}, {DPID: 1, Name: "spine"}, {DPID: 1, Name: "leaf1", Site: "seoul"}} {
+		if err := db.SetSwitchAlias(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetSwitchAlias(network.SwitchAlias{DPID: 3, Name: "leaf1"}); err == nil {
+		t.Fatal("expected an error for the duplicated name")
+	}
+	aliases, err := db.SwitchAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []network.SwitchAlias{{DPID: 1, Name: "leaf1", Site: "seoul"}, {DPID: 2, Name: "leaf2"}}
+	if !reflect.DeepEqual(aliases, expected) {
+		t.Fatalf("unexpected aliases: expected=%+v, actual=%+v", expected, aliases)
+	}
+	if ok, err := db.RemoveSwitchAlias(2); err != nil || !ok {
+		t.Fatalf("failed to remove the alias: ok=%v, err=%v", ok, err)
+	}
+	if ok, err := db.RemoveSwitchAlias(2); err != nil || ok {
+		t.Fatalf("unexpected removal of the removed alias: ok=%v, err=%v", ok, err)
+	}
+}
+
+func TestMemoryMaintenanceWindow(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	windows := []network.MaintenanceWindow{
+		{DPID: 1, Start: start, End: start.Add(time.Hour), Description: "firmware upgrade"},
+		{DPID: 2, Port: 3, Start: start, End: start.Add(2 * time.Hour)},
+	}
+	for i := range windows {
+		id, err := db.AddMaintenanceWindow(windows[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		windows[i].ID = id
+	}
+	v, err := db.MaintenanceWindows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, windows) {
+		t.Fatalf("unexpected windows: expected=%+v, actual=%+v", windows, v)
+	}
+	if ok, err := db.RemoveMaintenanceWindow(windows[0].ID); err != nil || !ok {
+		t.Fatalf("failed to remove the window: ok=%v, err=%v", ok, err)
+	}
+	if ok, err := db.RemoveMaintenanceWindow(windows[0].ID); err != nil || ok {
+		t.Fatalf("unexpected removal of the removed window: ok=%v, err=%v", ok, err)
+	}
+}
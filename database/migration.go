@@ -0,0 +1,317 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("database")
+)
+
+// Migration is a versioned change of the schema. The schema files, and the
+// schema created by the backends themselves, always have the latest version,
+// so that they should record all the migrations as applied ones.
+type Migration struct {
+	Version     int
+	Description string
+	// Statements of each SQL dialect, whose names are the driver names.
+	stmts map[string][]string
+}
+
+// migrations should be sorted by their versions, which start from 1 and
+// increase by one. A migration should never be modified once it is released.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Add host_ipv6 table for the IPv6 addresses of the hosts",
+		stmts: map[string][]string{
+			"mysql": []string{
+				"CREATE TABLE IF NOT EXISTS `host_ipv6` (" +
+					"`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT, " +
+					"`host_id` bigint(20) unsigned NOT NULL, " +
+					"`address` binary(16) NOT NULL, " +
+					"PRIMARY KEY (`id`), " +
+					"UNIQUE KEY `address` (`address`), " +
+					"KEY `host_id` (`host_id`), " +
+					"CONSTRAINT `host_ipv6_ibfk_1` FOREIGN KEY (`host_id`) REFERENCES `host` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+					") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			},
+			"postgres": []string{
+				"CREATE TABLE IF NOT EXISTS host_ipv6 (" +
+					"id bigserial PRIMARY KEY, " +
+					"host_id bigint NOT NULL REFERENCES host (id) ON DELETE CASCADE ON UPDATE CASCADE, " +
+					"address bytea NOT NULL UNIQUE CHECK (length(address) = 16))",
+				"CREATE INDEX IF NOT EXISTS host_ipv6_host_id ON host_ipv6 (host_id)",
+			},
+			"sqlite": []string{
+				"CREATE TABLE IF NOT EXISTS host_ipv6 (" +
+					"id integer PRIMARY KEY AUTOINCREMENT, " +
+					"host_id integer NOT NULL REFERENCES host (id) ON DELETE CASCADE ON UPDATE CASCADE, " +
+					"address blob NOT NULL UNIQUE CHECK (length(address) = 16))",
+				"CREATE INDEX IF NOT EXISTS host_ipv6_host_id ON host_ipv6 (host_id)",
+			},
+		},
+	},
+	{
+		Version:     2,
+		Description: "Add journal table for the event journal",
+		stmts: map[string][]string{
+			"mysql": []string{
+				"CREATE TABLE IF NOT EXISTS `journal` (" +
+					"`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT, " +
+					"`type` varchar(64) NOT NULL, " +
+					"`message` text NOT NULL, " +
+					"`timestamp` datetime NOT NULL, " +
+					"PRIMARY KEY (`id`), " +
+					"KEY `timestamp` (`timestamp`)" +
+					") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			},
+			"postgres": []string{
+				"CREATE TABLE IF NOT EXISTS journal (" +
+					"id bigserial PRIMARY KEY, " +
+					"type varchar(64) NOT NULL, " +
+					"message text NOT NULL, " +
+					"timestamp timestamptz NOT NULL)",
+				"CREATE INDEX IF NOT EXISTS journal_timestamp ON journal (timestamp)",
+			},
+			"sqlite": []string{
+				"CREATE TABLE IF NOT EXISTS journal (" +
+					"id integer PRIMARY KEY AUTOINCREMENT, " +
+					"type text NOT NULL, " +
+					"message text NOT NULL, " +
+					"timestamp timestamp NOT NULL)",
+				"CREATE INDEX IF NOT EXISTS journal_timestamp ON journal (timestamp)",
+			},
+		},
+	},
+	{
+		Version:     3,
+		Description: "Add cluster_member table for the heartbeats of the cluster members",
+		stmts: map[string][]string{
+			"mysql": []string{
+				"CREATE TABLE IF NOT EXISTS `cluster_member` (" +
+					"`uid` varchar(64) NOT NULL, " +
+					"`name` varchar(255) NOT NULL, " +
+					"`address` varchar(255) NOT NULL, " +
+					"`leader` tinyint(1) NOT NULL, " +
+					"`timestamp` datetime NOT NULL, " +
+					"PRIMARY KEY (`uid`)" +
+					") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			},
+			"postgres": []string{
+				"CREATE TABLE IF NOT EXISTS cluster_member (" +
+					"uid varchar(64) PRIMARY KEY, " +
+					"name varchar(255) NOT NULL, " +
+					"address varchar(255) NOT NULL, " +
+					"leader boolean NOT NULL, " +
+					"timestamp timestamptz NOT NULL)",
+			},
+			"sqlite": []string{
+				"CREATE TABLE IF NOT EXISTS cluster_member (" +
+					"uid text PRIMARY KEY, " +
+					"name text NOT NULL, " +
+					"address text NOT NULL, " +
+					"leader boolean NOT NULL, " +
+					"timestamp timestamp NOT NULL)",
+			},
+		},
+	},
+	{
+		Version:     4,
+		Description: "Add cluster_state table for the state replicated between the cluster members",
+		stmts: map[string][]string{
+			"mysql": []string{
+				"CREATE TABLE IF NOT EXISTS `cluster_state` (" +
+					"`name` varchar(64) NOT NULL, " +
+					"`state` mediumblob NOT NULL, " +
+					"`timestamp` datetime NOT NULL, " +
+					"PRIMARY KEY (`name`)" +
+					") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			},
+			"postgres": []string{
+				"CREATE TABLE IF NOT EXISTS cluster_state (" +
+					"name varchar(64) PRIMARY KEY, " +
+					"state bytea NOT NULL, " +
+					"timestamp timestamptz NOT NULL)",
+			},
+			"sqlite": []string{
+				"CREATE TABLE IF NOT EXISTS cluster_state (" +
+					"name text PRIMARY KEY, " +
+					"state blob NOT NULL, " +
+					"timestamp timestamp NOT NULL)",
+			},
+		},
+	},
+	{
+		Version:     5,
+		Description: "Add switch_alias table for the names and the metadata of the switches",
+		stmts: map[string][]string{
+			"mysql": []string{
+				"CREATE TABLE IF NOT EXISTS `switch_alias` (" +
+					"`dpid` bigint(20) unsigned NOT NULL, " +
+					"`name` varchar(64) NOT NULL, " +
+					"`site` varchar(64) NOT NULL DEFAULT '', " +
+					"`rack` varchar(64) NOT NULL DEFAULT '', " +
+					"`role` varchar(64) NOT NULL DEFAULT '', " +
+					"PRIMARY KEY (`dpid`), " +
+					"UNIQUE KEY `name` (`name`)" +
+					") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			},
+			"postgres": []string{
+				"CREATE TABLE IF NOT EXISTS switch_alias (" +
+					"dpid numeric(20) PRIMARY KEY, " +
+					"name varchar(64) NOT NULL UNIQUE, " +
+					"site varchar(64) NOT NULL DEFAULT '', " +
+					"rack varchar(64) NOT NULL DEFAULT '', " +
+					"role varchar(64) NOT NULL DEFAULT '')",
+			},
+			"sqlite": []string{
+				"CREATE TABLE IF NOT EXISTS switch_alias (" +
+					"dpid text PRIMARY KEY, " +
+					"name text NOT NULL UNIQUE, " +
+					"site text NOT NULL DEFAULT '', " +
+					"rack text NOT NULL DEFAULT '', " +
+					"role text NOT NULL DEFAULT '')",
+			},
+		},
+	},
+	{
+		Version:     6,
+		Description: "Add maintenance table for the maintenance windows of the switches and the ports",
+		stmts: map[string][]string{
+			"mysql": []string{
+				"CREATE TABLE IF NOT EXISTS `maintenance` (" +
+					"`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT, " +
+					"`dpid` bigint(20) unsigned NOT NULL, " +
+					"`port` int(10) unsigned NOT NULL DEFAULT '0', " +
+					"`start_time` datetime NOT NULL, " +
+					"`end_time` datetime NOT NULL, " +
+					"`description` varchar(255) NOT NULL DEFAULT '', " +
+					"PRIMARY KEY (`id`)" +
+					") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			},
+			"postgres": []string{
+				"CREATE TABLE IF NOT EXISTS maintenance (" +
+					"id bigserial PRIMARY KEY, " +
+					"dpid numeric(20) NOT NULL, " +
+					"port bigint NOT NULL DEFAULT 0, " +
+					"start_time timestamptz NOT NULL, " +
+					"end_time timestamptz NOT NULL, " +
+					"description varchar(255) NOT NULL DEFAULT '')",
+			},
+			"sqlite": []string{
+				"CREATE TABLE IF NOT EXISTS maintenance (" +
+					"id integer PRIMARY KEY AUTOINCREMENT, " +
+					"dpid text NOT NULL, " +
+					"port integer NOT NULL DEFAULT 0, " +
+					"start_time timestamp NOT NULL, " +
+					"end_time timestamp NOT NULL, " +
+					"description text NOT NULL DEFAULT '')",
+			},
+		},
+	},
+}
+
+// LatestSchemaVersion returns the version of the latest migration.
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+// migrator is implemented by the backends that have versioned schemas.
+type migrator interface {
+	// migrate applies the pending migrations, and then returns them. The
+	// migrations are not applied if dryRun is true.
+	migrate(dryRun bool) (pending []Migration, err error)
+}
+
+var mysqlPlaceholder = regexp.MustCompile(`\$[0-9]+`)
+
+// migrateSQL applies the pending migrations of the dialect to db. rewrite
+// converts the queries that use the PostgreSQL placeholders into the ones of
+// the dialect. The bookkeeping table, schema_migration, is created even if
+// dryRun is true.
+func migrateSQL(db *sql.DB, dialect string, rewrite func(string) string, dryRun bool) (pending []Migration, err error) {
+	qry := "CREATE TABLE IF NOT EXISTS schema_migration (" +
+		"version integer NOT NULL PRIMARY KEY, " +
+		"description varchar(255) NOT NULL, " +
+		"timestamp timestamp NOT NULL)"
+	if _, err := db.Exec(qry); err != nil {
+		return nil, fmt.Errorf("failed to create the schema_migration table: %v", err)
+	}
+
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migration").Scan(&current); err != nil {
+		return nil, err
+	}
+	for _, v := range migrations {
+		if v.Version > current {
+			pending = append(pending, v)
+		}
+	}
+	if dryRun {
+		return pending, nil
+	}
+
+	for _, v := range pending {
+		stmts, ok := v.stmts[dialect]
+		if !ok {
+			return nil, fmt.Errorf("missing %v statements of the schema migration %v", dialect, v.Version)
+		}
+		logger.Infof("applying the schema migration %v: %v", v.Version, v.Description)
+		if err := applyMigration(db, v, stmts, rewrite); err != nil {
+			return nil, fmt.Errorf("failed to apply the schema migration %v: %v", v.Version, err)
+		}
+	}
+
+	return pending, nil
+}
+
+func applyMigration(db *sql.DB, m Migration, stmts []string, rewrite func(string) string) error {
+	// Note that MySQL implicitly commits the transaction on most DDL statements.
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, v := range stmts {
+		if _, err := tx.Exec(v); err != nil {
+			return err
+		}
+	}
+	qry := rewrite("INSERT INTO schema_migration (version, description, timestamp) VALUES ($1, $2, $3)")
+	if _, err := tx.Exec(qry, m.Version, m.Description, now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -22,6 +22,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -32,8 +33,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/superkkt/cherry/cluster"
 	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/acl"
 	"github.com/superkkt/cherry/northbound/app/discovery"
+	"github.com/superkkt/cherry/northbound/app/journal"
+	"github.com/superkkt/cherry/northbound/app/pbr"
 	"github.com/superkkt/cherry/northbound/app/virtualip"
 
 	"github.com/go-sql-driver/mysql"
@@ -46,28 +51,38 @@ const (
 	maxDeadlockRetry         = 5
 )
 
+func init() {
+	Register("mysql", func() (Database, error) { return NewMySQL() })
+}
+
 type MySQL struct {
 	db     *sql.DB
+	conn   connConfig
 	random *rand.Rand
 }
 
 func NewMySQL() (*MySQL, error) {
+	conn, err := loadConnConfig()
+	if err != nil {
+		return nil, err
+	}
 	db, err := newDBConn(viper.GetString("database.host"), viper.GetString("database.user"),
-		viper.GetString("database.password"), viper.GetString("database.name"), uint16(viper.GetInt("database.port")))
+		viper.GetString("database.password"), viper.GetString("database.name"), uint16(viper.GetInt("database.port")), conn.timeout)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(32)
-	db.SetMaxIdleConns(4)
+	conn.apply(db)
 
 	return &MySQL{
 		db:     db,
+		conn:   conn,
 		random: rand.New(&randomSource{src: rand.NewSource(time.Now().Unix())}),
 	}, nil
 }
 
-func newDBConn(host, username, password, dbname string, port uint16) (*sql.DB, error) {
-	dsn := fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?timeout=5s&wait_timeout=120&parseTime=true&loc=Local", username, password, host, port, dbname)
+func newDBConn(host, username, password, dbname string, port uint16, timeout time.Duration) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?timeout=5s&readTimeout=%v&writeTimeout=%v&wait_timeout=120&parseTime=true&loc=Local",
+		username, password, host, port, dbname, timeout, timeout)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
@@ -98,20 +113,26 @@ func isForeignkeyErr(err error) bool {
 }
 
 func (r *MySQL) query(f func(*sql.DB) error) error {
-	deadlockRetry := 0
+	retryable := func(err error) bool {
+		return isDeadlock(err) || err == mysql.ErrInvalidConn
+	}
 
-	for {
-		err := f(r.db)
-		if err == nil {
-			// Success
-			return nil
-		}
-		if !isDeadlock(err) || deadlockRetry >= maxDeadlockRetry {
-			return err
-		}
-		time.Sleep(time.Duration(r.random.Int31n(500)) * time.Millisecond)
-		deadlockRetry++
+	return r.conn.retry(r.random, func() error { return f(r.db) }, retryable)
+}
+
+func (r *MySQL) migrate(dryRun bool) (pending []Migration, err error) {
+	rewrite := func(qry string) string {
+		return mysqlPlaceholder.ReplaceAllString(qry, "?")
 	}
+
+	return migrateSQL(r.db, "mysql", rewrite, dryRun)
+}
+
+func (r *MySQL) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.conn.timeout)
+	defer cancel()
+
+	return r.db.PingContext(ctx)
 }
 
 func (r *MySQL) MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
@@ -357,6 +378,141 @@ func (r *MySQL) RemoveSwitch(id uint64) (ok bool, err error) {
 	return ok, nil
 }
 
+// SwitchAliases returns all the aliases of the switches.
+func (r *MySQL) SwitchAliases() (aliases []network.SwitchAlias, err error) {
+	f := func(db *sql.DB) error {
+		aliases = nil
+
+		rows, err := db.Query("SELECT `dpid`, `name`, `site`, `rack`, `role` FROM `switch_alias` ORDER BY `dpid`")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v network.SwitchAlias
+			if err := rows.Scan(&v.DPID, &v.Name, &v.Site, &v.Rack, &v.Role); err != nil {
+				return err
+			}
+			aliases = append(aliases, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+// SetSwitchAlias adds the alias of a switch, or replaces the one of the same DPID.
+func (r *MySQL) SetSwitchAlias(alias network.SwitchAlias) error {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO `switch_alias` (`dpid`, `name`, `site`, `rack`, `role`) VALUES (?, ?, ?, ?, ?) "
+		qry += "ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `site` = VALUES(`site`), `rack` = VALUES(`rack`), `role` = VALUES(`role`)"
+		_, err := db.Exec(qry, alias.DPID, alias.Name, alias.Site, alias.Rack, alias.Role)
+		return err
+	}
+
+	return r.query(f)
+}
+
+// RemoveSwitchAlias removes the alias of the switch whose DPID is dpid. ok will be false if there is no such alias.
+func (r *MySQL) RemoveSwitchAlias(dpid uint64) (ok bool, err error) {
+	f := func(db *sql.DB) error {
+		result, err := db.Exec("DELETE FROM `switch_alias` WHERE `dpid` = ?", dpid)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		ok = n > 0
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// MaintenanceWindows returns all the maintenance windows sorted by their IDs.
+func (r *MySQL) MaintenanceWindows() (windows []network.MaintenanceWindow, err error) {
+	f := func(db *sql.DB) error {
+		windows = nil
+
+		rows, err := db.Query("SELECT `id`, `dpid`, `port`, `start_time`, `end_time`, `description` FROM `maintenance` ORDER BY `id`")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v network.MaintenanceWindow
+			if err := rows.Scan(&v.ID, &v.DPID, &v.Port, &v.Start, &v.End, &v.Description); err != nil {
+				return err
+			}
+			windows = append(windows, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// AddMaintenanceWindow adds a new maintenance window and returns its unique ID.
+func (r *MySQL) AddMaintenanceWindow(window network.MaintenanceWindow) (id uint64, err error) {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO `maintenance` (`dpid`, `port`, `start_time`, `end_time`, `description`) VALUES (?, ?, ?, ?, ?)"
+		result, err := db.Exec(qry, window.DPID, window.Port, window.Start, window.End, window.Description)
+		if err != nil {
+			return err
+		}
+		v, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = uint64(v)
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveMaintenanceWindow removes the maintenance window specified by id. ok will be false if there is no such window.
+func (r *MySQL) RemoveMaintenanceWindow(id uint64) (ok bool, err error) {
+	f := func(db *sql.DB) error {
+		result, err := db.Exec("DELETE FROM `maintenance` WHERE `id` = ?", id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		ok = n > 0
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
 func (r *MySQL) SwitchPorts(swID uint64) (ports []network.SwitchPort, err error) {
 	f := func(db *sql.DB) error {
 		qry := `SELECT A.id, A.number, B.first_port
@@ -681,6 +837,11 @@ func (r *MySQL) Host(id uint64) (host network.Host, ok bool, err error) {
 }
 
 func (r *MySQL) AddHost(host network.HostParam) (hostID uint64, err error) {
+	ipv6, err := host.IPv6Addrs()
+	if err != nil {
+		return 0, err
+	}
+
 	f := func(db *sql.DB) error {
 		tx, err := db.Begin()
 		if err != nil {
@@ -699,6 +860,11 @@ func (r *MySQL) AddHost(host network.HostParam) (hostID uint64, err error) {
 		if err != nil {
 			return err
 		}
+		for _, ip := range ipv6 {
+			if _, err := tx.Exec("INSERT INTO `host_ipv6` (host_id, address) VALUES (?, ?)", hostID, []byte(ip.To16())); err != nil {
+				return err
+			}
+		}
 
 		if err := tx.Commit(); err != nil {
 			return err
@@ -1128,7 +1294,7 @@ func (r *MySQL) getVIPs(limit, offset uint8) (result []registeredVIP, err error)
 }
 
 func (r *MySQL) GetActivatedVIPs() (result []virtualip.Address, err error) {
-	vips, err := r.getVIPs()
+	vips, err := r.getVIPs(0, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -1257,11 +1423,15 @@ func (r *MySQL) RemoveVIP(id uint64) (ok bool, err error) {
 }
 
 // GetUndiscoveredHosts returns IP addresses whose physical location is still
-// undiscovered or staled more than expiration. result can be nil on empty result.
-func (r *MySQL) GetUndiscoveredHosts(expiration time.Duration) (result []net.IP, err error) {
+// undiscovered, and the ones whose location has been staled more than
+// expiration. The results can be nil on empty result.
+func (r *MySQL) GetUndiscoveredHosts(expiration time.Duration) (undiscovered, staled []net.IP, err error) {
 	f := func(db *sql.DB) error {
+		// Initialize the results as this function can be called again on a deadlock.
+		undiscovered, staled = nil, nil
+
 		// NOTE: Do not include VIP addresses!
-		qry := "SELECT IFNULL(INET_NTOA(B.`address`), '0.0.0.0') "
+		qry := "SELECT IFNULL(INET_NTOA(B.`address`), '0.0.0.0'), A.`port_id` IS NULL "
 		qry += "FROM `host` A "
 		qry += "JOIN `ip` B "
 		qry += "ON A.`ip_id` = B.`id` "
@@ -1275,7 +1445,8 @@ func (r *MySQL) GetUndiscoveredHosts(expiration time.Duration) (result []net.IP,
 
 		for rows.Next() {
 			var addr string
-			if err := rows.Scan(&addr); err != nil {
+			var unknown bool
+			if err := rows.Scan(&addr, &unknown); err != nil {
 				return err
 			}
 			ip := net.ParseIP(addr)
@@ -1285,17 +1456,21 @@ func (r *MySQL) GetUndiscoveredHosts(expiration time.Duration) (result []net.IP,
 			if ip.IsUnspecified() {
 				continue
 			}
-			result = append(result, ip)
+			if unknown {
+				undiscovered = append(undiscovered, ip)
+			} else {
+				staled = append(staled, ip)
+			}
 		}
 
 		return rows.Err()
 	}
 
 	if err = r.query(f); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return result, nil
+	return undiscovered, staled, nil
 }
 
 // UpdateHostLocation updates the physical location of a host, whose MAC and IP
@@ -1390,8 +1565,8 @@ func updateLocation(tx *sql.Tx, hostID, portID uint64) (updated bool, err error)
 }
 
 // ResetHostLocationsByPort sets NULL to the host locations that belong to the
-// port specified by swDPID and portNum.
-func (r *MySQL) ResetHostLocationsByPort(swDPID uint64, portNum uint16) error {
+// port specified by swDPID and portNum, and then returns the reset hosts.
+func (r *MySQL) ResetHostLocationsByPort(swDPID uint64, portNum uint16) (hosts []discovery.Host, err error) {
 	f := func(db *sql.DB) error {
 		tx, err := db.Begin()
 		if err != nil {
@@ -1404,7 +1579,19 @@ func (r *MySQL) ResetHostLocationsByPort(swDPID uint64, portNum uint16) error {
 			return err
 		}
 
-		qry := "UPDATE `host` SET `port_id` = NULL WHERE `port_id` = ?"
+		qry := "SELECT A.`mac`, INET_NTOA(B.`address`), D.`dpid`, C.`number` "
+		qry += "FROM `host` A "
+		qry += "JOIN `ip` B ON A.`ip_id` = B.`id` "
+		qry += "JOIN `port` C ON A.`port_id` = C.`id` "
+		qry += "JOIN `switch` D ON C.`switch_id` = D.`id` "
+		qry += "WHERE A.`port_id` = ? "
+		qry += "FOR UPDATE"
+		hosts, err = locatedHosts(tx, qry, portID)
+		if err != nil {
+			return err
+		}
+
+		qry = "UPDATE `host` SET `port_id` = NULL WHERE `port_id` = ?"
 		if _, err := tx.Exec(qry, portID); err != nil {
 			return err
 		}
@@ -1415,35 +1602,66 @@ func (r *MySQL) ResetHostLocationsByPort(swDPID uint64, portNum uint16) error {
 
 		return nil
 	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
 
-	return r.query(f)
+	return hosts, nil
 }
 
 // ResetHostLocationsByDevice sets NULL to the host locations that belong to the
-// device specified by swDPID.
-func (r *MySQL) ResetHostLocationsByDevice(swDPID uint64) error {
+// device specified by swDPID, and then returns the reset hosts.
+func (r *MySQL) ResetHostLocationsByDevice(swDPID uint64) (hosts []discovery.Host, err error) {
 	f := func(db *sql.DB) error {
-		qry := "UPDATE `host` A "
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qry := "SELECT A.`mac`, INET_NTOA(B.`address`), D.`dpid`, C.`number` "
+		qry += "FROM `host` A "
+		qry += "JOIN `ip` B ON A.`ip_id` = B.`id` "
+		qry += "JOIN `port` C ON A.`port_id` = C.`id` "
+		qry += "JOIN `switch` D ON C.`switch_id` = D.`id` "
+		qry += "WHERE D.`dpid` = ? "
+		qry += "FOR UPDATE"
+		hosts, err = locatedHosts(tx, qry, swDPID)
+		if err != nil {
+			return err
+		}
+
+		qry = "UPDATE `host` A "
 		qry += "JOIN `port` B ON A.`port_id` = B.`id` "
 		qry += "JOIN `switch` C ON B.`switch_id` = C.`id` "
 		qry += "SET A.`port_id` = NULL "
 		qry += "WHERE C.`dpid` = ?"
-
-		_, err := db.Exec(qry, swDPID)
-		if err != nil {
+		if _, err := tx.Exec(qry, swDPID); err != nil {
 			return err
 		}
 
-		return nil
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
 	}
 
-	return r.query(f)
+	return hosts, nil
 }
 
-// Elect selects a new master as uid if there is a no existing master that has
-// been updated within expiration. elected will be true if this uid has been
-// elected as the new master or was already elected.
-func (r *MySQL) Elect(uid string, expiration time.Duration) (elected bool, err error) {
+// ResetHostLocationsByPorts sets NULL to the host locations that belong to the
+// ports specified by swDPID and portNums in a single transaction, and then
+// returns the reset hosts. Unknown ports are ignored.
+func (r *MySQL) ResetHostLocationsByPorts(swDPID uint64, portNums []uint16) (hosts []discovery.Host, err error) {
+	if len(portNums) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{swDPID}
+	for _, v := range portNums {
+		args = append(args, v)
+	}
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(portNums)), ", ")
+
 	f := func(db *sql.DB) error {
 		tx, err := db.Begin()
 		if err != nil {
@@ -1451,50 +1669,118 @@ func (r *MySQL) Elect(uid string, expiration time.Duration) (elected bool, err e
 		}
 		defer tx.Rollback()
 
-		var name string
-		var timestamp time.Time
-		qry := "SELECT `name`, `timestamp` "
-		qry += "FROM `election` "
-		qry += "WHERE `type` = 'MASTER' "
-		qry += "FOR UPDATE" // Lock the selected row even if there is a no exsiting one.
-		err = tx.QueryRow(qry).Scan(&name, &timestamp)
-		// Real error?
-		if err != nil && err != sql.ErrNoRows {
+		qry := "SELECT A.`mac`, INET_NTOA(B.`address`), D.`dpid`, C.`number` "
+		qry += "FROM `host` A "
+		qry += "JOIN `ip` B ON A.`ip_id` = B.`id` "
+		qry += "JOIN `port` C ON A.`port_id` = C.`id` "
+		qry += "JOIN `switch` D ON C.`switch_id` = D.`id` "
+		qry += "WHERE D.`dpid` = ? AND C.`number` IN (" + in + ") "
+		qry += "FOR UPDATE"
+		hosts, err = locatedHosts(tx, qry, args...)
+		if err != nil {
 			return err
 		}
 
-		// No existing master?
-		if err == sql.ErrNoRows {
-			// I am the newly elected master!
-			qry = "INSERT INTO `election` (`name`, `type`, `timestamp`) "
-			qry += "VALUES (?, 'MASTER', NOW())"
-			if _, err := tx.Exec(qry, uid); err != nil {
+		qry = "UPDATE `host` A "
+		qry += "JOIN `port` B ON A.`port_id` = B.`id` "
+		qry += "JOIN `switch` C ON B.`switch_id` = C.`id` "
+		qry += "SET A.`port_id` = NULL "
+		qry += "WHERE C.`dpid` = ? AND B.`number` IN (" + in + ")"
+		if _, err := tx.Exec(qry, args...); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+// locatedHosts returns the hosts selected by qry, which selects their MAC
+// addresses, IP addresses, DPIDs and port numbers.
+func locatedHosts(tx *sql.Tx, qry string, args ...interface{}) ([]discovery.Host, error) {
+	rows, err := tx.Query(qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []discovery.Host{}
+	for rows.Next() {
+		var mac []byte
+		var addr string
+		var dpid uint64
+		var port uint32
+		if err := rows.Scan(&mac, &addr, &dpid, &port); err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %v", addr)
+		}
+		result = append(result, discovery.Host{
+			MAC:      net.HardwareAddr(mac),
+			IP:       ip,
+			Location: discovery.Location{DPID: dpid, Port: port},
+		})
+	}
+
+	return result, rows.Err()
+}
+
+// GetUndiscoveredIPv6Hosts returns IPv6 addresses of the hosts whose physical
+// location is still undiscovered, and the ones whose location has been staled
+// more than expiration. The results can be nil on empty result.
+func (r *MySQL) GetUndiscoveredIPv6Hosts(expiration time.Duration) (undiscovered, staled []net.IP, err error) {
+	f := func(db *sql.DB) error {
+		// Initialize the results as this function can be called again on a deadlock.
+		undiscovered, staled = nil, nil
+
+		qry := "SELECT B.`address`, A.`port_id` IS NULL "
+		qry += "FROM `host` A "
+		qry += "JOIN `host_ipv6` B "
+		qry += "ON A.`id` = B.`host_id` "
+		qry += "WHERE A.`port_id` IS NULL OR A.`last_updated_timestamp` < NOW() - INTERVAL ? SECOND"
+
+		rows, err := db.Query(qry, uint64(expiration.Seconds()))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr []byte
+			var unknown bool
+			if err := rows.Scan(&addr, &unknown); err != nil {
 				return err
 			}
-			elected = true
-		} else {
-			// Already elected or another stale master?
-			if name == uid || time.Now().Sub(timestamp) > expiration {
-				qry = "UPDATE `election` SET `name` = ?, `timestamp` = NOW() WHERE `type` = 'MASTER'"
-				if _, err := tx.Exec(qry, uid); err != nil {
-					return err
-				}
-				elected = true
+			if len(addr) != net.IPv6len {
+				return fmt.Errorf("invalid IPv6 address: %v", addr)
+			}
+			if unknown {
+				undiscovered = append(undiscovered, net.IP(addr))
+			} else {
+				staled = append(staled, net.IP(addr))
 			}
 		}
 
-		return tx.Commit()
+		return rows.Err()
 	}
 
-	if err := r.query(f); err != nil {
-		return false, err
+	if err = r.query(f); err != nil {
+		return nil, nil, err
 	}
 
-	return elected, nil
+	return undiscovered, staled, nil
 }
 
-// AddFlow adds a new flow into the database and returns its unique ID.
-func (r *MySQL) AddFlow(swDPID uint64, dstMAC net.HardwareAddr, outPort uint32) (flowID uint64, err error) {
+// UpdateIPv6HostLocation updates the physical location of a host, whose MAC
+// and IPv6 addresses are matched with mac and ip, to the port identified by
+// swDPID and portNum. updated will be true if its location has been actually updated.
+func (r *MySQL) UpdateIPv6HostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
 	f := func(db *sql.DB) error {
 		tx, err := db.Begin()
 		if err != nil {
@@ -1502,20 +1788,252 @@ func (r *MySQL) AddFlow(swDPID uint64, dstMAC net.HardwareAddr, outPort uint32)
 		}
 		defer tx.Rollback()
 
-		var switchID uint64
-		qry := "SELECT `id` FROM `switch` WHERE `dpid` = ? FOR UPDATE"
-		err = tx.QueryRow(qry, swDPID).Scan(&switchID)
+		hostID, ok, err := getIPv6HostID(tx, mac, ip)
 		if err != nil {
 			return err
 		}
+		// Unknown host?
+		if !ok {
+			updated = false
+			return nil
+		}
 
-		qry = "INSERT INTO `flow` (`switch_id`, `dst_mac`, `out_port`, `timestamp`) VALUES (?, ?, ?, NOW())"
-		result, err := tx.Exec(qry, switchID, dstMAC.String(), outPort)
+		portID, err := portID(tx, swDPID, portNum)
 		if err != nil {
 			return err
 		}
 
-		id, err := result.LastInsertId()
+		updated, err = updateLocation(tx, hostID, portID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+func getIPv6HostID(tx *sql.Tx, mac net.HardwareAddr, ip net.IP) (hostID uint64, ok bool, err error) {
+	qry := "SELECT A.`id` "
+	qry += "FROM `host` A "
+	qry += "JOIN `host_ipv6` B "
+	qry += "ON A.`id` = B.`host_id` "
+	qry += "WHERE A.`mac` = ? AND B.`address` = ? "
+	qry += "FOR UPDATE"
+	if err := tx.QueryRow(qry, []byte(mac), []byte(ip.To16())).Scan(&hostID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return hostID, true, nil
+}
+
+// UpdateHostLocations updates the host locations in a single transaction as
+// UpdateHostLocation and UpdateIPv6HostLocation do. updated[i] will be true if
+// the location of updates[i] has been actually updated.
+func (r *MySQL) UpdateHostLocations(updates []discovery.LocationUpdate) (updated []bool, err error) {
+	f := func(db *sql.DB) error {
+		updated = make([]bool, len(updates))
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for i, v := range updates {
+			var hostID uint64
+			var ok bool
+			if v.IP.To4() != nil {
+				hostID, ok, err = getHostID(tx, v.MAC, v.IP)
+			} else {
+				hostID, ok, err = getIPv6HostID(tx, v.MAC, v.IP)
+			}
+			if err != nil {
+				return err
+			}
+			// Unknown host?
+			if !ok {
+				continue
+			}
+
+			portID, err := portID(tx, v.DPID, v.Port)
+			if err != nil {
+				return err
+			}
+			if updated[i], err = updateLocation(tx, hostID, portID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Elect selects a new master as uid if there is a no existing master that has
+// been updated within expiration. elected will be true if this uid has been
+// elected as the new master or was already elected.
+func (r *MySQL) Elect(uid string, expiration time.Duration) (elected bool, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var name string
+		var timestamp time.Time
+		qry := "SELECT `name`, `timestamp` "
+		qry += "FROM `election` "
+		qry += "WHERE `type` = 'MASTER' "
+		qry += "FOR UPDATE" // Lock the selected row even if there is a no exsiting one.
+		err = tx.QueryRow(qry).Scan(&name, &timestamp)
+		// Real error?
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		// No existing master?
+		if err == sql.ErrNoRows {
+			// I am the newly elected master!
+			qry = "INSERT INTO `election` (`name`, `type`, `timestamp`) "
+			qry += "VALUES (?, 'MASTER', NOW())"
+			if _, err := tx.Exec(qry, uid); err != nil {
+				return err
+			}
+			elected = true
+		} else {
+			// Already elected or another stale master?
+			if name == uid || time.Now().Sub(timestamp) > expiration {
+				qry = "UPDATE `election` SET `name` = ?, `timestamp` = NOW() WHERE `type` = 'MASTER'"
+				if _, err := tx.Exec(qry, uid); err != nil {
+					return err
+				}
+				elected = true
+			}
+		}
+
+		return tx.Commit()
+	}
+
+	if err := r.query(f); err != nil {
+		return false, err
+	}
+
+	return elected, nil
+}
+
+// Heartbeat records the heartbeat of m, and then returns the members whose
+// last heartbeats are within expiration, including m. The members whose
+// heartbeats have expired are removed.
+func (r *MySQL) Heartbeat(m cluster.Member, expiration time.Duration) (members []cluster.Member, err error) {
+	f := func(db *sql.DB) error {
+		members = nil
+
+		qry := "INSERT INTO `cluster_member` (`uid`, `name`, `address`, `leader`, `timestamp`) "
+		qry += "VALUES (?, ?, ?, ?, NOW()) "
+		qry += "ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `address` = VALUES(`address`), `leader` = VALUES(`leader`), `timestamp` = NOW()"
+		if _, err := db.Exec(qry, m.UID, m.Name, m.Address, m.Leader); err != nil {
+			return err
+		}
+		// The timestamps are compared by the database server as they are recorded by its clock.
+		qry = "DELETE FROM `cluster_member` WHERE `timestamp` < DATE_SUB(NOW(), INTERVAL ? MICROSECOND)"
+		if _, err := db.Exec(qry, int64(expiration/time.Microsecond)); err != nil {
+			return err
+		}
+
+		rows, err := db.Query("SELECT `uid`, `name`, `address`, `leader`, `timestamp` FROM `cluster_member`")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v cluster.Member
+			if err := rows.Scan(&v.UID, &v.Name, &v.Address, &v.Leader, &v.Timestamp); err != nil {
+				return err
+			}
+			members = append(members, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SaveState stores state of the replica specified by name.
+func (r *MySQL) SaveState(name string, state []byte) error {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO `cluster_state` (`name`, `state`, `timestamp`) VALUES (?, ?, NOW()) "
+		qry += "ON DUPLICATE KEY UPDATE `state` = VALUES(`state`), `timestamp` = NOW()"
+		_, err := db.Exec(qry, name, state)
+		return err
+	}
+
+	return r.query(f)
+}
+
+// State returns the state of the replica specified by name and when it has
+// been stored. ok will be false if there is no such state.
+func (r *MySQL) State(name string) (state []byte, timestamp time.Time, ok bool, err error) {
+	f := func(db *sql.DB) error {
+		qry := "SELECT `state`, `timestamp` FROM `cluster_state` WHERE `name` = ?"
+		if err := db.QueryRow(qry, name).Scan(&state, &timestamp); err != nil {
+			if err == sql.ErrNoRows {
+				ok = false
+				return nil
+			}
+			return err
+		}
+		ok = true
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	return state, timestamp, ok, nil
+}
+
+// AddFlow adds a new flow into the database and returns its unique ID.
+func (r *MySQL) AddFlow(swDPID uint64, dstMAC net.HardwareAddr, outPort uint32) (flowID uint64, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var switchID uint64
+		qry := "SELECT `id` FROM `switch` WHERE `dpid` = ? FOR UPDATE"
+		err = tx.QueryRow(qry, swDPID).Scan(&switchID)
+		if err != nil {
+			return err
+		}
+
+		qry = "INSERT INTO `flow` (`switch_id`, `dst_mac`, `out_port`, `timestamp`) VALUES (?, ?, ?, NOW())"
+		result, err := tx.Exec(qry, switchID, dstMAC.String(), outPort)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
 		if err != nil {
 			return err
 		}
@@ -1545,3 +2063,286 @@ func (r *MySQL) RemoveFlow(flowID uint64) error {
 
 	return r.query(f)
 }
+
+// MACRules returns all the MAC access control rules.
+func (r *MySQL) MACRules() (rules []acl.Rule, err error) {
+	f := func(db *sql.DB) error {
+		rows, err := db.Query("SELECT `id`, HEX(`mac`), `dpid`, `port`, `allow` FROM `mac_acl` ORDER BY `id`")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v acl.Rule
+			var mac string
+			if err := rows.Scan(&v.ID, &mac, &v.DPID, &v.Port, &v.Allow); err != nil {
+				return err
+			}
+			if v.MAC, err = decodeMAC(mac); err != nil {
+				return err
+			}
+			rules = append(rules, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// AddMACRule adds a new MAC access control rule and returns its unique ID.
+func (r *MySQL) AddMACRule(rule acl.Rule) (id uint64, err error) {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO `mac_acl` (`mac`, `dpid`, `port`, `allow`) VALUES (UNHEX(?), ?, ?, ?)"
+		result, err := db.Exec(qry, normalizeMAC(rule.MAC.String()), rule.DPID, rule.Port, rule.Allow)
+		if err != nil {
+			return err
+		}
+		v, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = uint64(v)
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveMACRule removes the MAC access control rule specified by id, and then returns the removed one.
+func (r *MySQL) RemoveMACRule(id uint64) (rule acl.Rule, ok bool, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var mac string
+		qry := "SELECT `id`, HEX(`mac`), `dpid`, `port`, `allow` FROM `mac_acl` WHERE `id` = ? FOR UPDATE"
+		err = tx.QueryRow(qry, id).Scan(&rule.ID, &mac, &rule.DPID, &rule.Port, &rule.Allow)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		if rule.MAC, err = decodeMAC(mac); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM `mac_acl` WHERE `id` = ?", id); err != nil {
+			return err
+		}
+		ok = true
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return acl.Rule{}, false, err
+	}
+
+	return rule, ok, nil
+}
+
+// ipNet returns nil if mask is zero, which means any address.
+func ipNet(addr string, mask uint8) (*net.IPNet, error) {
+	if mask == 0 {
+		return nil, nil
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %v", addr)
+	}
+	m := net.CIDRMask(int(mask), 32)
+
+	return &net.IPNet{IP: ip.Mask(m), Mask: m}, nil
+}
+
+// splitIPNet returns zero address and mask if n is nil, which means any address.
+func splitIPNet(n *net.IPNet) (addr string, mask uint8) {
+	if n == nil {
+		return "0.0.0.0", 0
+	}
+	ones, _ := n.Mask.Size()
+
+	return n.IP.String(), uint8(ones)
+}
+
+// Policies returns all the routing policies sorted by their IDs.
+func (r *MySQL) Policies() (policies []pbr.Policy, err error) {
+	f := func(db *sql.DB) error {
+		qry := "SELECT `id`, INET_NTOA(`src_address`), `src_mask`, INET_NTOA(`dst_address`), `dst_mask`, "
+		qry += "`protocol`, `dst_port`, `dpid`, `port` "
+		qry += "FROM `pbr_policy` ORDER BY `id`"
+		rows, err := db.Query(qry)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v pbr.Policy
+			var srcAddr, dstAddr string
+			var srcMask, dstMask uint8
+			if err := rows.Scan(&v.ID, &srcAddr, &srcMask, &dstAddr, &dstMask, &v.Protocol, &v.DstPort, &v.DPID, &v.Port); err != nil {
+				return err
+			}
+			if v.SrcNet, err = ipNet(srcAddr, srcMask); err != nil {
+				return err
+			}
+			if v.DstNet, err = ipNet(dstAddr, dstMask); err != nil {
+				return err
+			}
+			policies = append(policies, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// AddPolicy adds a new routing policy and returns its unique ID.
+func (r *MySQL) AddPolicy(policy pbr.Policy) (id uint64, err error) {
+	f := func(db *sql.DB) error {
+		srcAddr, srcMask := splitIPNet(policy.SrcNet)
+		dstAddr, dstMask := splitIPNet(policy.DstNet)
+
+		qry := "INSERT INTO `pbr_policy` (`src_address`, `src_mask`, `dst_address`, `dst_mask`, `protocol`, `dst_port`, `dpid`, `port`) "
+		qry += "VALUES (INET_ATON(?), ?, INET_ATON(?), ?, ?, ?, ?, ?)"
+		result, err := db.Exec(qry, srcAddr, srcMask, dstAddr, dstMask, policy.Protocol, policy.DstPort, policy.DPID, policy.Port)
+		if err != nil {
+			return err
+		}
+		v, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = uint64(v)
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemovePolicy removes the routing policy specified by id. ok will be false if there is no such policy.
+func (r *MySQL) RemovePolicy(id uint64) (ok bool, err error) {
+	f := func(db *sql.DB) error {
+		result, err := db.Exec("DELETE FROM `pbr_policy` WHERE `id` = ?", id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		ok = n > 0
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// AddJournal records the journal entries in a single transaction.
+func (r *MySQL) AddJournal(entries []journal.Entry) error {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.Prepare("INSERT INTO `journal` (`type`, `message`, `timestamp`) VALUES (?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, v := range entries {
+			if _, err := stmt.Exec(v.Type, v.Message, v.Timestamp); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+
+	return r.query(f)
+}
+
+// Journal returns the journal entries recorded at or after since, whose type
+// is eventType, in descending order of their IDs. Zero since and empty
+// eventType match all the entries.
+func (r *MySQL) Journal(since time.Time, eventType string, limit uint16) (entries []journal.Entry, err error) {
+	f := func(db *sql.DB) error {
+		entries = nil
+
+		qry := "SELECT `id`, `type`, `message`, `timestamp` FROM `journal` WHERE `timestamp` >= ? "
+		args := []interface{}{since}
+		if len(eventType) > 0 {
+			qry += "AND `type` = ? "
+			args = append(args, eventType)
+		}
+		qry += "ORDER BY `id` DESC LIMIT ?"
+		args = append(args, limit)
+
+		rows, err := db.Query(qry, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v journal.Entry
+			if err := rows.Scan(&v.ID, &v.Type, &v.Message, &v.Timestamp); err != nil {
+				return err
+			}
+			entries = append(entries, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RemoveJournal removes the journal entries recorded before t, and then returns the number of the removed entries.
+func (r *MySQL) RemoveJournal(before time.Time) (n int64, err error) {
+	f := func(db *sql.DB) error {
+		result, err := db.Exec("DELETE FROM `journal` WHERE `timestamp` < ?", before)
+		if err != nil {
+			return err
+		}
+		n, err = result.RowsAffected()
+
+		return err
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -15,6 +15,56 @@
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
 /*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
 
+--
+-- Table structure for table `schema_migration`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `schema_migration` (
+  `version` int(11) NOT NULL,
+  `description` varchar(255) NOT NULL,
+  `timestamp` timestamp NOT NULL,
+  PRIMARY KEY (`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- This schema already has all the migrations in database/migration.go.
+--
+
+INSERT IGNORE INTO `schema_migration` VALUES (1,'Add host_ipv6 table for the IPv6 addresses of the hosts',NOW()),(2,'Add journal table for the event journal',NOW()),(3,'Add cluster_member table for the heartbeats of the cluster members',NOW()),(4,'Add cluster_state table for the state replicated between the cluster members',NOW()),(5,'Add switch_alias table for the names and the metadata of the switches',NOW()),(6,'Add maintenance table for the maintenance windows of the switches and the ports',NOW());
+
+--
+-- Table structure for table `cluster_member`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `cluster_member` (
+  `uid` varchar(64) NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `address` varchar(255) NOT NULL,
+  `leader` tinyint(1) NOT NULL,
+  `timestamp` datetime NOT NULL,
+  PRIMARY KEY (`uid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `cluster_state`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `cluster_state` (
+  `name` varchar(64) NOT NULL,
+  `state` mediumblob NOT NULL,
+  `timestamp` datetime NOT NULL,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `election`
 --
@@ -118,6 +168,23 @@ DELIMITER ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
 
+--
+-- Table structure for table `host_ipv6`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `host_ipv6` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `host_id` bigint(20) unsigned NOT NULL,
+  `address` binary(16) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `address` (`address`),
+  KEY `host_id` (`host_id`),
+  CONSTRAINT `host_ipv6_ibfk_1` FOREIGN KEY (`host_id`) REFERENCES `host` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `ip`
 --
@@ -186,6 +253,40 @@ CREATE TABLE IF NOT EXISTS `switch` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `switch_alias`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `switch_alias` (
+  `dpid` bigint(20) unsigned NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `site` varchar(64) NOT NULL DEFAULT '',
+  `rack` varchar(64) NOT NULL DEFAULT '',
+  `role` varchar(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (`dpid`),
+  UNIQUE KEY `name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `maintenance`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `maintenance` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `dpid` bigint(20) unsigned NOT NULL,
+  `port` int(10) unsigned NOT NULL DEFAULT '0',
+  `start_time` datetime NOT NULL,
+  `end_time` datetime NOT NULL,
+  `description` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `flow`
 --
@@ -205,6 +306,59 @@ CREATE TABLE IF NOT EXISTS `flow` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `journal`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `journal` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `type` varchar(64) NOT NULL,
+  `message` text NOT NULL,
+  `timestamp` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `timestamp` (`timestamp`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `mac_acl`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `mac_acl` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `mac` binary(6) NOT NULL,
+  `dpid` bigint(20) unsigned NOT NULL DEFAULT '0',
+  `port` int(10) unsigned NOT NULL DEFAULT '0',
+  `allow` boolean NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `mac_acl` (`mac`,`dpid`,`port`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `pbr_policy`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `pbr_policy` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `src_address` int(10) unsigned NOT NULL DEFAULT '0',
+  `src_mask` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `dst_address` int(10) unsigned NOT NULL DEFAULT '0',
+  `dst_mask` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `protocol` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `dst_port` smallint(5) unsigned NOT NULL DEFAULT '0',
+  `dpid` bigint(20) unsigned NOT NULL,
+  `port` int(10) unsigned NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `vip`
 --
@@ -0,0 +1,95 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/superkkt/viper"
+)
+
+// SQLSTATE codes of PostgreSQL.
+const (
+	pgDeadlockCode   = "40P01"
+	pgForeignkeyCode = "23503"
+)
+
+// PostgreSQL stores the data using the schema in postgres_schema.sql. It only
+// uses database/sql, so that a PostgreSQL driver registered as "postgres",
+// such as github.com/lib/pq, should be linked by the postgres build tag.
+type PostgreSQL struct {
+	*stdSQL
+}
+
+func NewPostgreSQL() (*PostgreSQL, error) {
+	conn, err := loadConnConfig()
+	if err != nil {
+		return nil, err
+	}
+	// statement_timeout is passed to the server as a run-time parameter.
+	dsn := fmt.Sprintf("host=%v port=%v user=%v password=%v dbname=%v sslmode=%v connect_timeout=5 statement_timeout=%v",
+		viper.GetString("database.host"), viper.GetInt("database.port"), viper.GetString("database.user"),
+		viper.GetString("database.password"), viper.GetString("database.name"), pgSSLMode(), int64(conn.timeout/time.Millisecond))
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	conn.apply(db)
+
+	d := dialect{
+		name: "postgres",
+		isRetryable: func(err error) bool {
+			return pgErrorCode(err) == pgDeadlockCode
+		},
+		isForeignkeyErr: func(err error) bool {
+			return pgErrorCode(err) == pgForeignkeyCode
+		},
+	}
+
+	return &PostgreSQL{newStdSQL(db, conn, d)}, nil
+}
+
+func pgSSLMode() string {
+	if !viper.IsSet("database.sslmode") {
+		return "disable"
+	}
+
+	return viper.GetString("database.sslmode")
+}
+
+// pgErrorCode returns the SQLSTATE code of err, or an empty string if err does not come from PostgreSQL.
+func pgErrorCode(err error) string {
+	e, ok := err.(interface {
+		SQLState() string
+	})
+	if !ok {
+		return ""
+	}
+
+	return strings.ToUpper(e.SQLState())
+}
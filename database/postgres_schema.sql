@@ -0,0 +1,186 @@
+--
+-- PostgreSQL schema of Cherry, which is equivalent to mysql_schema.sql.
+--
+-- IPv4 addresses are stored as bigint, MAC addresses as bytea, and DPIDs as
+-- numeric(20) because bigint cannot hold the 64-bit unsigned integers.
+--
+
+CREATE TABLE IF NOT EXISTS schema_migration (
+  version integer NOT NULL PRIMARY KEY,
+  description varchar(255) NOT NULL,
+  timestamp timestamp NOT NULL
+);
+-- This schema already has all the migrations in database/migration.go.
+INSERT INTO schema_migration VALUES (1, 'Add host_ipv6 table for the IPv6 addresses of the hosts', now()) ON CONFLICT DO NOTHING;
+INSERT INTO schema_migration VALUES (2, 'Add journal table for the event journal', now()) ON CONFLICT DO NOTHING;
+INSERT INTO schema_migration VALUES (3, 'Add cluster_member table for the heartbeats of the cluster members', now()) ON CONFLICT DO NOTHING;
+INSERT INTO schema_migration VALUES (4, 'Add cluster_state table for the state replicated between the cluster members', now()) ON CONFLICT DO NOTHING;
+INSERT INTO schema_migration VALUES (5, 'Add switch_alias table for the names and the metadata of the switches', now()) ON CONFLICT DO NOTHING;
+INSERT INTO schema_migration VALUES (6, 'Add maintenance table for the maintenance windows of the switches and the ports', now()) ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS cluster_member (
+  uid varchar(64) PRIMARY KEY,
+  name varchar(255) NOT NULL,
+  address varchar(255) NOT NULL,
+  leader boolean NOT NULL,
+  timestamp timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cluster_state (
+  name varchar(64) PRIMARY KEY,
+  state bytea NOT NULL,
+  timestamp timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS election (
+  id bigserial PRIMARY KEY,
+  name varchar(255) NOT NULL,
+  type varchar(16) NOT NULL UNIQUE CHECK (type IN ('MASTER')),
+  timestamp timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS acl (
+  id bigserial PRIMARY KEY,
+  network bigint NOT NULL,
+  mask integer NOT NULL,
+  UNIQUE (network, mask)
+);
+
+CREATE TABLE IF NOT EXISTS switch (
+  id bigserial PRIMARY KEY,
+  dpid numeric(20) NOT NULL UNIQUE,
+  n_ports integer NOT NULL,
+  first_port integer NOT NULL DEFAULT 1,
+  first_printed_port integer NOT NULL DEFAULT 0,
+  description varchar(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS switch_alias (
+  dpid numeric(20) PRIMARY KEY,
+  name varchar(64) NOT NULL UNIQUE,
+  site varchar(64) NOT NULL DEFAULT '',
+  rack varchar(64) NOT NULL DEFAULT '',
+  role varchar(64) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS maintenance (
+  id bigserial PRIMARY KEY,
+  dpid numeric(20) NOT NULL,
+  port bigint NOT NULL DEFAULT 0,
+  start_time timestamptz NOT NULL,
+  end_time timestamptz NOT NULL,
+  description varchar(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS port (
+  id bigserial PRIMARY KEY,
+  switch_id bigint NOT NULL REFERENCES switch (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  number integer NOT NULL,
+  UNIQUE (switch_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS network (
+  id bigserial PRIMARY KEY,
+  address bigint NOT NULL,
+  mask integer NOT NULL,
+  UNIQUE (address, mask)
+);
+
+CREATE TABLE IF NOT EXISTS ip (
+  id bigserial PRIMARY KEY,
+  network_id bigint NOT NULL REFERENCES network (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  address bigint NOT NULL UNIQUE,
+  used boolean NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS ip_used ON ip (used);
+CREATE INDEX IF NOT EXISTS ip_network_id ON ip (network_id);
+
+CREATE TABLE IF NOT EXISTS host (
+  id bigserial PRIMARY KEY,
+  ip_id bigint NOT NULL UNIQUE REFERENCES ip (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  port_id bigint DEFAULT NULL REFERENCES port (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  mac bytea NOT NULL CHECK (length(mac) = 6),
+  description varchar(255) NOT NULL,
+  last_updated_timestamp timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS host_port_id ON host (port_id);
+CREATE INDEX IF NOT EXISTS host_mac ON host (mac);
+CREATE INDEX IF NOT EXISTS host_last_updated_timestamp ON host (last_updated_timestamp);
+
+CREATE TABLE IF NOT EXISTS host_ipv6 (
+  id bigserial PRIMARY KEY,
+  host_id bigint NOT NULL REFERENCES host (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  address bytea NOT NULL UNIQUE CHECK (length(address) = 16)
+);
+CREATE INDEX IF NOT EXISTS host_ipv6_host_id ON host_ipv6 (host_id);
+
+CREATE TABLE IF NOT EXISTS journal (
+  id bigserial PRIMARY KEY,
+  type varchar(64) NOT NULL,
+  message text NOT NULL,
+  timestamp timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS journal_timestamp ON journal (timestamp);
+
+CREATE TABLE IF NOT EXISTS vip (
+  id bigserial PRIMARY KEY,
+  ip_id bigint NOT NULL UNIQUE REFERENCES ip (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  active_host_id bigint NOT NULL REFERENCES host (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  standby_host_id bigint NOT NULL REFERENCES host (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  description varchar(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS flow (
+  id bigserial PRIMARY KEY,
+  switch_id bigint NOT NULL REFERENCES switch (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  dst_mac varchar(255) NOT NULL,
+  out_port bigint NOT NULL,
+  removed boolean NOT NULL DEFAULT FALSE,
+  timestamp timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flow_dst_mac ON flow (dst_mac);
+
+CREATE TABLE IF NOT EXISTS mac_acl (
+  id bigserial PRIMARY KEY,
+  mac bytea NOT NULL CHECK (length(mac) = 6),
+  dpid numeric(20) NOT NULL DEFAULT 0,
+  port bigint NOT NULL DEFAULT 0,
+  allow boolean NOT NULL,
+  UNIQUE (mac, dpid, port)
+);
+
+CREATE TABLE IF NOT EXISTS pbr_policy (
+  id bigserial PRIMARY KEY,
+  src_address bigint NOT NULL DEFAULT 0,
+  src_mask smallint NOT NULL DEFAULT 0,
+  dst_address bigint NOT NULL DEFAULT 0,
+  dst_mask smallint NOT NULL DEFAULT 0,
+  protocol smallint NOT NULL DEFAULT 0,
+  dst_port integer NOT NULL DEFAULT 0,
+  dpid numeric(20) NOT NULL,
+  port bigint NOT NULL
+);
+
+--
+-- The used flag of an IP address is maintained by the hosts and VIPs using it.
+--
+
+CREATE OR REPLACE FUNCTION update_ip_used() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' OR TG_OP = 'DELETE' THEN
+    UPDATE ip SET used = FALSE WHERE id = OLD.ip_id;
+  END IF;
+  IF TG_OP = 'INSERT' OR TG_OP = 'UPDATE' THEN
+    UPDATE ip SET used = TRUE WHERE id = NEW.ip_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS host_ip_used ON host;
+CREATE TRIGGER host_ip_used AFTER INSERT OR UPDATE OF ip_id OR DELETE ON host
+  FOR EACH ROW EXECUTE PROCEDURE update_ip_used();
+
+DROP TRIGGER IF EXISTS vip_ip_used ON vip;
+CREATE TRIGGER vip_ip_used AFTER INSERT OR UPDATE OF ip_id OR DELETE ON vip
+  FOR EACH ROW EXECUTE PROCEDURE update_ip_used();
@@ -0,0 +1,296 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/superkkt/viper"
+)
+
+const defaultSQLitePath = "/var/lib/cherry/cherry.db"
+
+var (
+	sqlitePlaceholder = regexp.MustCompile(`\$([0-9]+)`)
+	sqliteLock        = regexp.MustCompile(`\s+FOR\s+(UPDATE(\s+OF\s+\w+)?|SHARE)\s*$`)
+)
+
+// SQLite stores the data in a single file, so that Cherry can run without any
+// external database server. The schema is created when the database is opened.
+// It only uses database/sql, so that a SQLite driver registered as "sqlite3",
+// such as github.com/mattn/go-sqlite3, should be linked by the sqlite build tag.
+type SQLite struct {
+	*stdSQL
+}
+
+func NewSQLite() (*SQLite, error) {
+	conn, err := loadConnConfig()
+	if err != nil {
+		return nil, err
+	}
+	path := defaultSQLitePath
+	if viper.IsSet("database.path") {
+		path = viper.GetString("database.path")
+	}
+	// The transactions acquire the write lock immediately instead of failing
+	// on the lock upgrade, and wait for the lock up to the busy timeout.
+	dsn := fmt.Sprintf("file:%v?_foreign_keys=1&_busy_timeout=%v&_txlock=immediate", path, int64(conn.timeout/time.Millisecond))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	conn.apply(db)
+	// SQLite allows only one writer at a time.
+	db.SetMaxOpenConns(1)
+	if err := createSQLiteSchema(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the SQLite schema: %v", err)
+	}
+
+	d := dialect{
+		name: "sqlite",
+		rewrite: func(qry string) string {
+			// SQLite locks the whole database in a transaction, so that the row locks are not necessary.
+			qry = sqliteLock.ReplaceAllString(qry, "")
+			return sqlitePlaceholder.ReplaceAllString(qry, "?$1")
+		},
+		isRetryable: func(err error) bool {
+			return strings.Contains(err.Error(), "database is locked") || strings.Contains(err.Error(), "database table is locked")
+		},
+		isForeignkeyErr: func(err error) bool {
+			return strings.Contains(err.Error(), "FOREIGN KEY constraint failed")
+		},
+	}
+
+	return &SQLite{newStdSQL(db, conn, d)}, nil
+}
+
+// createSQLiteSchema creates the latest schema if db is empty. The schema of
+// the existing database is upgraded by the migrations instead.
+func createSQLiteSchema(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'election'").Scan(&n); err != nil {
+		return err
+	}
+	// Not empty?
+	if n > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	// The latest schema already has all the migrations.
+	for _, v := range migrations {
+		qry := "INSERT INTO schema_migration (version, description, timestamp) VALUES (?, ?, ?)"
+		if _, err := tx.Exec(qry, v.Version, v.Description, now()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// sqliteSchema is equivalent to mysql_schema.sql. DPIDs are stored as text as
+// SQLite converts the numbers that are not representable by the 64-bit signed
+// integers into the floating point numbers.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS schema_migration (
+  version integer NOT NULL PRIMARY KEY,
+  description varchar(255) NOT NULL,
+  timestamp timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cluster_member (
+  uid text PRIMARY KEY,
+  name text NOT NULL,
+  address text NOT NULL,
+  leader boolean NOT NULL,
+  timestamp timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cluster_state (
+  name text PRIMARY KEY,
+  state blob NOT NULL,
+  timestamp timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS election (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  name text NOT NULL,
+  type text NOT NULL UNIQUE CHECK (type IN ('MASTER')),
+  timestamp timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS switch (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  dpid text NOT NULL UNIQUE,
+  n_ports integer NOT NULL,
+  first_port integer NOT NULL DEFAULT 1,
+  first_printed_port integer NOT NULL DEFAULT 0,
+  description text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS switch_alias (
+  dpid text PRIMARY KEY,
+  name text NOT NULL UNIQUE,
+  site text NOT NULL DEFAULT '',
+  rack text NOT NULL DEFAULT '',
+  role text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS maintenance (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  dpid text NOT NULL,
+  port integer NOT NULL DEFAULT 0,
+  start_time timestamp NOT NULL,
+  end_time timestamp NOT NULL,
+  description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS port (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  switch_id integer NOT NULL REFERENCES switch (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  number integer NOT NULL,
+  UNIQUE (switch_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS network (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  address integer NOT NULL,
+  mask integer NOT NULL,
+  UNIQUE (address, mask)
+);
+
+CREATE TABLE IF NOT EXISTS ip (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  network_id integer NOT NULL REFERENCES network (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  address integer NOT NULL UNIQUE,
+  used boolean NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS ip_network_id ON ip (network_id);
+
+CREATE TABLE IF NOT EXISTS host (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  ip_id integer NOT NULL UNIQUE REFERENCES ip (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  port_id integer DEFAULT NULL REFERENCES port (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  mac blob NOT NULL CHECK (length(mac) = 6),
+  description text NOT NULL,
+  last_updated_timestamp timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS host_port_id ON host (port_id);
+CREATE INDEX IF NOT EXISTS host_mac ON host (mac);
+
+CREATE TABLE IF NOT EXISTS host_ipv6 (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  host_id integer NOT NULL REFERENCES host (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  address blob NOT NULL UNIQUE CHECK (length(address) = 16)
+);
+CREATE INDEX IF NOT EXISTS host_ipv6_host_id ON host_ipv6 (host_id);
+
+CREATE TABLE IF NOT EXISTS journal (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  type text NOT NULL,
+  message text NOT NULL,
+  timestamp timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS journal_timestamp ON journal (timestamp);
+
+CREATE TABLE IF NOT EXISTS vip (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  ip_id integer NOT NULL UNIQUE REFERENCES ip (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  active_host_id integer NOT NULL REFERENCES host (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  standby_host_id integer NOT NULL REFERENCES host (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+  description text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS flow (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  switch_id integer NOT NULL REFERENCES switch (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  dst_mac text NOT NULL,
+  out_port integer NOT NULL,
+  removed boolean NOT NULL DEFAULT 0,
+  timestamp timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flow_dst_mac ON flow (dst_mac);
+
+CREATE TABLE IF NOT EXISTS mac_acl (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  mac blob NOT NULL CHECK (length(mac) = 6),
+  dpid text NOT NULL DEFAULT '0',
+  port integer NOT NULL DEFAULT 0,
+  allow boolean NOT NULL,
+  UNIQUE (mac, dpid, port)
+);
+
+CREATE TABLE IF NOT EXISTS pbr_policy (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  src_address integer NOT NULL DEFAULT 0,
+  src_mask integer NOT NULL DEFAULT 0,
+  dst_address integer NOT NULL DEFAULT 0,
+  dst_mask integer NOT NULL DEFAULT 0,
+  protocol integer NOT NULL DEFAULT 0,
+  dst_port integer NOT NULL DEFAULT 0,
+  dpid text NOT NULL,
+  port integer NOT NULL
+);
+
+CREATE TRIGGER IF NOT EXISTS disable_ip AFTER INSERT ON host
+BEGIN
+  UPDATE ip SET used = 1 WHERE id = NEW.ip_id;
+END;
+CREATE TRIGGER IF NOT EXISTS update_ip AFTER UPDATE OF ip_id ON host
+BEGIN
+  UPDATE ip SET used = 0 WHERE id = OLD.ip_id;
+  UPDATE ip SET used = 1 WHERE id = NEW.ip_id;
+END;
+CREATE TRIGGER IF NOT EXISTS enable_ip AFTER DELETE ON host
+BEGIN
+  UPDATE ip SET used = 0 WHERE id = OLD.ip_id;
+END;
+CREATE TRIGGER IF NOT EXISTS disable_vip AFTER INSERT ON vip
+BEGIN
+  UPDATE ip SET used = 1 WHERE id = NEW.ip_id;
+END;
+CREATE TRIGGER IF NOT EXISTS update_vip AFTER UPDATE OF ip_id ON vip
+BEGIN
+  UPDATE ip SET used = 0 WHERE id = OLD.ip_id;
+  UPDATE ip SET used = 1 WHERE id = NEW.ip_id;
+END;
+CREATE TRIGGER IF NOT EXISTS enable_vip AFTER DELETE ON vip
+BEGIN
+  UPDATE ip SET used = 0 WHERE id = OLD.ip_id;
+END;
+`
@@ -0,0 +1,1737 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superkkt/cherry/cluster"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/acl"
+	"github.com/superkkt/cherry/northbound/app/discovery"
+	"github.com/superkkt/cherry/northbound/app/journal"
+	"github.com/superkkt/cherry/northbound/app/pbr"
+	"github.com/superkkt/cherry/northbound/app/virtualip"
+)
+
+// stdSQL implements the Database interface using the standard SQL that is
+// understood by both PostgreSQL and SQLite. The queries are written with the
+// PostgreSQL placeholders ($1, $2, ...) and the row locking clauses, which are
+// rewritten by the dialect.
+//
+// IPv4 addresses are stored as integers, MAC addresses as binary strings, and
+// DPIDs as decimal numbers because the 64-bit signed integers cannot hold them.
+type stdSQL struct {
+	db      *sql.DB
+	conn    connConfig
+	random  *rand.Rand
+	dialect dialect
+}
+
+type dialect struct {
+	// name is the driver name of the dialect.
+	name string
+	// rewrite converts a query into the one of this dialect.
+	rewrite func(qry string) string
+	// isRetryable returns whether the transaction that failed with err can be retried.
+	isRetryable func(err error) bool
+	// isForeignkeyErr returns whether err is a violation of a foreign key constraint.
+	isForeignkeyErr func(err error) bool
+}
+
+func newStdSQL(db *sql.DB, conn connConfig, d dialect) *stdSQL {
+	return &stdSQL{
+		db:      db,
+		conn:    conn,
+		random:  rand.New(&randomSource{src: rand.NewSource(time.Now().Unix())}),
+		dialect: d,
+	}
+}
+
+func (r *stdSQL) sql(qry string) string {
+	if r.dialect.rewrite == nil {
+		return qry
+	}
+
+	return r.dialect.rewrite(qry)
+}
+
+func (r *stdSQL) query(f func(*sql.DB) error) error {
+	return r.conn.retry(r.random, func() error { return f(r.db) }, r.dialect.isRetryable)
+}
+
+func (r *stdSQL) migrate(dryRun bool) (pending []Migration, err error) {
+	return migrateSQL(r.db, r.dialect.name, r.sql, dryRun)
+}
+
+func (r *stdSQL) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.conn.timeout)
+	defer cancel()
+
+	return r.db.PingContext(ctx)
+}
+
+// now returns the current time in UTC, which is stored as the timestamps, so
+// that they are comparable even if the database stores them as strings.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func ipv4ToInt(ip net.IP) (int64, error) {
+	v := ip.To4()
+	if v == nil {
+		return 0, fmt.Errorf("invalid IPv4 address: %v", ip)
+	}
+
+	return int64(binary.BigEndian.Uint32(v)), nil
+}
+
+func intToIPv4(v int64) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, uint32(v))
+
+	return ip
+}
+
+// dpidArg formats dpid as a string as database/sql does not accept the uint64
+// values whose high bit is set.
+func dpidArg(dpid uint64) string {
+	return strconv.FormatUint(dpid, 10)
+}
+
+func sqlLimit(limit, offset uint8) string {
+	if limit == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", uint(limit)+1, offset)
+}
+
+// portName formats the printed name of a switch port, or returns an empty string if the port is unknown.
+func portName(description sql.NullString, number sql.NullInt64) string {
+	if !description.Valid || !number.Valid {
+		return ""
+	}
+
+	return fmt.Sprintf("%v/%v", description.String, number.Int64)
+}
+
+func (r *stdSQL) MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
+	if ip == nil {
+		panic("IP address is nil")
+	}
+	addr, err := ipv4ToInt(ip)
+	if err != nil {
+		return nil, false, err
+	}
+
+	f := func(db *sql.DB) error {
+		// Union query from both vip and host tables
+		qry := `SELECT B.mac
+			FROM vip A
+			JOIN host B ON A.active_host_id = B.id
+			JOIN ip C ON A.ip_id = C.id
+			WHERE C.address = $1
+			UNION ALL
+			SELECT A.mac
+			FROM host A
+			JOIN ip B ON A.ip_id = B.id
+			WHERE B.address = $1
+			LIMIT 1`
+		var v []byte
+		if err := db.QueryRow(r.sql(qry), addr).Scan(&v); err != nil {
+			// Unknown IP address?
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		if len(v) != 6 {
+			return errors.New("invalid MAC address")
+		}
+		mac = net.HardwareAddr(v)
+		ok = true
+
+		return nil
+	}
+	err = r.query(f)
+
+	return mac, ok, err
+}
+
+func (r *stdSQL) Location(mac net.HardwareAddr) (dpid string, port uint32, status network.LocationStatus, err error) {
+	if mac == nil {
+		panic("MAC address is nil")
+	}
+
+	f := func(db *sql.DB) error {
+		// Initial value.
+		status = network.LocationUnregistered
+
+		var portID sql.NullInt64
+		if err := db.QueryRow(r.sql("SELECT port_id FROM host WHERE mac = $1"), []byte(mac)).Scan(&portID); err != nil {
+			// Unregistered host?
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		// NULL port ID?
+		if portID.Valid == false {
+			// The node is registered, but we don't know its physical location yet.
+			status = network.LocationUndiscovered
+			return nil
+		}
+
+		qry := "SELECT B.dpid, A.number FROM port A JOIN switch B ON A.switch_id = B.id WHERE A.id = $1"
+		if err := db.QueryRow(r.sql(qry), portID.Int64).Scan(&dpid, &port); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		status = network.LocationDiscovered
+
+		return nil
+	}
+	if err := r.query(f); err != nil {
+		return "", 0, network.LocationUnregistered, err
+	}
+
+	return dpid, port, status, nil
+}
+
+func (r *stdSQL) Switches(limit, offset uint8) (sw []network.Switch, err error) {
+	f := func(db *sql.DB) error {
+		sw = nil
+
+		qry := "SELECT id, dpid, n_ports, first_port, first_printed_port, description FROM switch ORDER BY id DESC"
+		rows, err := db.Query(r.sql(qry + sqlLimit(limit, offset)))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			v := network.Switch{}
+			if err := rows.Scan(&v.ID, &v.DPID, &v.NumPorts, &v.FirstPort, &v.FirstPrintedPort, &v.Description); err != nil {
+				return err
+			}
+			sw = append(sw, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+func (r *stdSQL) AddSwitch(sw network.SwitchParam) (swID uint64, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qry := "INSERT INTO switch (dpid, n_ports, first_port, first_printed_port, description) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+		if err := tx.QueryRow(r.sql(qry), dpidArg(sw.DPID), sw.NumPorts, sw.FirstPort, sw.FirstPrintedPort, sw.Description).Scan(&swID); err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(r.sql("INSERT INTO port (switch_id, number) VALUES ($1, $2)"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i := uint16(0); i < sw.NumPorts; i++ {
+			if _, err := stmt.Exec(swID, sw.FirstPort+i); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return swID, nil
+}
+
+func (r *stdSQL) Switch(dpid uint64) (sw network.Switch, ok bool, err error) {
+	f := func(db *sql.DB) error {
+		qry := "SELECT id, dpid, n_ports, first_port, first_printed_port, description FROM switch WHERE dpid = $1"
+		err := db.QueryRow(r.sql(qry), dpidArg(dpid)).Scan(&sw.ID, &sw.DPID, &sw.NumPorts, &sw.FirstPort, &sw.FirstPrintedPort, &sw.Description)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		ok = true
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return network.Switch{}, false, err
+	}
+
+	return sw, ok, nil
+}
+
+// remove deletes the row specified by id from the table. ok will be false if there is no such row.
+func (r *stdSQL) remove(table string, id uint64) (ok bool, err error) {
+	f := func(db *sql.DB) error {
+		result, err := db.Exec(r.sql(fmt.Sprintf("DELETE FROM %v WHERE id = $1", table)), id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		ok = n > 0
+
+		return nil
+	}
+	err = r.query(f)
+
+	return ok, err
+}
+
+func (r *stdSQL) RemoveSwitch(id uint64) (ok bool, err error) {
+	ok, err = r.remove("switch", id)
+	if err != nil {
+		if r.dialect.isForeignkeyErr(err) {
+			return false, errors.New("failed to remove a switch: it has child hosts connected to this switch")
+		}
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// SwitchAliases returns all the aliases of the switches.
+func (r *stdSQL) SwitchAliases() (aliases []network.SwitchAlias, err error) {
+	f := func(db *sql.DB) error {
+		aliases = nil
+
+		rows, err := db.Query("SELECT dpid, name, site, rack, role FROM switch_alias")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v network.SwitchAlias
+			if err := rows.Scan(&v.DPID, &v.Name, &v.Site, &v.Rack, &v.Role); err != nil {
+				return err
+			}
+			aliases = append(aliases, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+	// The DPIDs of SQLite are text.
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].DPID < aliases[j].DPID })
+
+	return aliases, nil
+}
+
+// SetSwitchAlias adds the alias of a switch, or replaces the one of the same DPID.
+func (r *stdSQL) SetSwitchAlias(alias network.SwitchAlias) error {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO switch_alias (dpid, name, site, rack, role) VALUES ($1, $2, $3, $4, $5) "
+		qry += "ON CONFLICT (dpid) DO UPDATE SET name = excluded.name, site = excluded.site, rack = excluded.rack, role = excluded.role"
+		_, err := db.Exec(r.sql(qry), dpidArg(alias.DPID), alias.Name, alias.Site, alias.Rack, alias.Role)
+		return err
+	}
+
+	return r.query(f)
+}
+
+// RemoveSwitchAlias removes the alias of the switch whose DPID is dpid. ok will be false if there is no such alias.
+func (r *stdSQL) RemoveSwitchAlias(dpid uint64) (ok bool, err error) {
+	f := func(db *sql.DB) error {
+		result, err := db.Exec(r.sql("DELETE FROM switch_alias WHERE dpid = $1"), dpidArg(dpid))
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		ok = n > 0
+
+		return nil
+	}
+	err = r.query(f)
+
+	return ok, err
+}
+
+// MaintenanceWindows returns all the maintenance windows sorted by their IDs.
+func (r *stdSQL) MaintenanceWindows() (windows []network.MaintenanceWindow, err error) {
+	f := func(db *sql.DB) error {
+		windows = nil
+
+		rows, err := db.Query("SELECT id, dpid, port, start_time, end_time, description FROM maintenance ORDER BY id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v network.MaintenanceWindow
+			if err := rows.Scan(&v.ID, &v.DPID, &v.Port, &v.Start, &v.End, &v.Description); err != nil {
+				return err
+			}
+			windows = append(windows, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// AddMaintenanceWindow adds a new maintenance window and returns its unique ID.
+func (r *stdSQL) AddMaintenanceWindow(window network.MaintenanceWindow) (id uint64, err error) {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO maintenance (dpid, port, start_time, end_time, description) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+		return db.QueryRow(r.sql(qry), dpidArg(window.DPID), window.Port, window.Start.UTC(), window.End.UTC(), window.Description).Scan(&id)
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveMaintenanceWindow removes the maintenance window specified by id. ok will be false if there is no such window.
+func (r *stdSQL) RemoveMaintenanceWindow(id uint64) (ok bool, err error) {
+	return r.remove("maintenance", id)
+}
+
+func (r *stdSQL) SwitchPorts(swID uint64) (ports []network.SwitchPort, err error) {
+	f := func(db *sql.DB) error {
+		ports = nil
+
+		qry := `SELECT A.id, A.number - B.first_port + 1
+			FROM port A
+			JOIN switch B ON A.switch_id = B.id
+			WHERE A.switch_id = $1
+			ORDER BY A.id ASC`
+		rows, err := db.Query(r.sql(qry), swID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			v := network.SwitchPort{}
+			if err := rows.Scan(&v.ID, &v.Number); err != nil {
+				return err
+			}
+			ports = append(ports, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return ports, nil
+}
+
+func (r *stdSQL) Networks(limit, offset uint8) (networks []network.Network, err error) {
+	f := func(db *sql.DB) error {
+		networks = nil
+
+		rows, err := db.Query(r.sql("SELECT id, address, mask FROM network ORDER BY id DESC" + sqlLimit(limit, offset)))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr int64
+			v := network.Network{}
+			if err := rows.Scan(&v.ID, &addr, &v.Mask); err != nil {
+				return err
+			}
+			v.Address = intToIPv4(addr).String()
+			networks = append(networks, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return networks, nil
+}
+
+func (r *stdSQL) AddNetwork(addr net.IP, mask net.IPMask) (netID uint64, err error) {
+	v, err := ipv4ToInt(addr)
+	if err != nil {
+		return 0, err
+	}
+	ones, bits := mask.Size()
+	// Minus two due to network and broadcast addresses
+	n := (int64(1) << uint(bits-ones)) - 2
+
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := tx.QueryRow(r.sql("INSERT INTO network (address, mask) VALUES ($1, $2) RETURNING id"), v, ones).Scan(&netID); err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(r.sql("INSERT INTO ip (network_id, address) VALUES ($1, $2)"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i := int64(1); i <= n; i++ {
+			if _, err := stmt.Exec(netID, v+i); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return netID, nil
+}
+
+func (r *stdSQL) Network(addr net.IP) (n network.Network, ok bool, err error) {
+	v, err := ipv4ToInt(addr)
+	if err != nil {
+		return network.Network{}, false, err
+	}
+
+	f := func(db *sql.DB) error {
+		if err := db.QueryRow(r.sql("SELECT id, mask FROM network WHERE address = $1"), v).Scan(&n.ID, &n.Mask); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		n.Address = intToIPv4(v).String()
+		ok = true
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return network.Network{}, false, err
+	}
+
+	return n, ok, nil
+}
+
+func (r *stdSQL) RemoveNetwork(id uint64) (ok bool, err error) {
+	ok, err = r.remove("network", id)
+	if err != nil {
+		if r.dialect.isForeignkeyErr(err) {
+			return false, errors.New("failed to remove a network: it has child IP addresses that are being used by hosts")
+		}
+		return false, err
+	}
+
+	return ok, nil
+}
+
+func (r *stdSQL) IPAddrs(networkID uint64) (addresses []network.IP, err error) {
+	f := func(db *sql.DB) error {
+		addresses = nil
+
+		qry := `SELECT A.id, A.address, A.used, C.description, E.description, D.number - E.first_port + E.first_printed_port
+			FROM ip A
+			LEFT JOIN host C ON C.ip_id = A.id
+			LEFT JOIN port D ON D.id = C.port_id
+			LEFT JOIN switch E ON E.id = D.switch_id
+			WHERE A.network_id = $1
+			ORDER BY A.address`
+		rows, err := db.Query(r.sql(qry), networkID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr int64
+			var host, sw sql.NullString
+			var port sql.NullInt64
+			v := network.IP{}
+			if err := rows.Scan(&v.ID, &addr, &v.Used, &host, &sw, &port); err != nil {
+				return err
+			}
+			v.Address = intToIPv4(addr).String()
+			v.Host = host.String
+			v.Port = portName(sw, port)
+			addresses = append(addresses, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+const hostQuery = `SELECT A.id, B.address, E.mask, D.description, C.number - D.first_port + D.first_printed_port,
+		A.mac, A.description, A.last_updated_timestamp
+	FROM host A
+	JOIN ip B ON A.ip_id = B.id
+	LEFT JOIN port C ON A.port_id = C.id
+	LEFT JOIN switch D ON C.switch_id = D.id
+	JOIN network E ON B.network_id = E.id `
+
+func scanHost(rows *sql.Rows) (network.Host, error) {
+	var addr int64
+	var mask uint8
+	var sw sql.NullString
+	var port sql.NullInt64
+	var mac []byte
+	var timestamp time.Time
+
+	v := network.Host{}
+	if err := rows.Scan(&v.ID, &addr, &mask, &sw, &port, &mac, &v.Description, &timestamp); err != nil {
+		return network.Host{}, err
+	}
+	if len(mac) != 6 {
+		return network.Host{}, fmt.Errorf("invalid MAC address: %v", mac)
+	}
+	v.IP = fmt.Sprintf("%v/%v", intToIPv4(addr), mask)
+	v.Port = portName(sw, port)
+	v.MAC = net.HardwareAddr(mac).String()
+	// Check its freshness.
+	if time.Now().Sub(timestamp) > discovery.ProbeInterval*3 {
+		v.Stale = true
+	}
+
+	return v, nil
+}
+
+func (r *stdSQL) Hosts(limit, offset uint8) (hosts []network.Host, err error) {
+	f := func(db *sql.DB) error {
+		hosts = nil
+
+		rows, err := db.Query(r.sql(hostQuery + "ORDER BY A.id DESC" + sqlLimit(limit, offset)))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			v, err := scanHost(rows)
+			if err != nil {
+				return err
+			}
+			hosts = append(hosts, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+func (r *stdSQL) Host(id uint64) (host network.Host, ok bool, err error) {
+	f := func(db *sql.DB) error {
+		rows, err := db.Query(r.sql(hostQuery+"WHERE A.id = $1"), id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			return rows.Err()
+		}
+		if host, err = scanHost(rows); err != nil {
+			return err
+		}
+		ok = true
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return network.Host{}, false, err
+	}
+
+	return host, ok, nil
+}
+
+// isAvailableIP locks the IP address specified by id, and then returns whether it is not used.
+func (r *stdSQL) isAvailableIP(tx *sql.Tx, id uint64) (bool, error) {
+	var used bool
+	if err := tx.QueryRow(r.sql("SELECT used FROM ip WHERE id = $1 FOR UPDATE"), id).Scan(&used); err != nil {
+		if err == sql.ErrNoRows {
+			return false, errors.New("unknown IP address ID")
+		}
+		return false, err
+	}
+
+	return !used, nil
+}
+
+func (r *stdSQL) AddHost(host network.HostParam) (hostID uint64, err error) {
+	mac, err := net.ParseMAC(host.MAC)
+	if err != nil {
+		return 0, err
+	}
+	ipv6, err := host.IPv6Addrs()
+	if err != nil {
+		return 0, err
+	}
+
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		ok, err := r.isAvailableIP(tx, host.IPID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("already used IP address")
+		}
+		qry := "INSERT INTO host (ip_id, mac, description, last_updated_timestamp) VALUES ($1, $2, $3, $4) RETURNING id"
+		if err := tx.QueryRow(r.sql(qry), host.IPID, []byte(mac), host.Description, now()).Scan(&hostID); err != nil {
+			return err
+		}
+		for _, ip := range ipv6 {
+			if _, err := tx.Exec(r.sql("INSERT INTO host_ipv6 (host_id, address) VALUES ($1, $2)"), hostID, []byte(ip.To16())); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return hostID, nil
+}
+
+func (r *stdSQL) RemoveHost(id uint64) (ok bool, err error) {
+	ok, err = r.remove("host", id)
+	if err != nil {
+		if r.dialect.isForeignkeyErr(err) {
+			return false, errors.New("failed to remove a host: it has child VIP addresses")
+		}
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// toggleVIPs swaps the active and standby hosts of the VIPs selected by qry,
+// which selects their IDs, addresses, active and standby host IDs, and then
+// returns the VIPs with the MAC addresses of the new active hosts.
+func (r *stdSQL) toggleVIPs(tx *sql.Tx, qry string, args ...interface{}) ([]virtualip.Address, error) {
+	rows, err := tx.Query(r.sql(qry), args...)
+	if err != nil {
+		return nil, err
+	}
+	vips := []vip{}
+	for rows.Next() {
+		var v vip
+		var addr int64
+		if err := rows.Scan(&v.id, &addr, &v.active, &v.standby); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		v.address = intToIPv4(addr)
+		vips = append(vips, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := []virtualip.Address{}
+	for _, v := range vips {
+		// Swap active and standby hosts
+		if _, err := tx.Exec(r.sql("UPDATE vip SET active_host_id = $1, standby_host_id = $2 WHERE id = $3"), v.standby, v.active, v.id); err != nil {
+			return nil, err
+		}
+		// Get standby's MAC address as the standby host will be active soon!
+		var mac []byte
+		if err := tx.QueryRow(r.sql("SELECT mac FROM host WHERE id = $1"), v.standby).Scan(&mac); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("unknown host (ID=%v)", v.standby)
+			}
+			return nil, err
+		}
+		result = append(result, virtualip.Address{IP: v.address, MAC: net.HardwareAddr(mac)})
+	}
+
+	return result, nil
+}
+
+func (r *stdSQL) ToggleVIP(id uint64) (ip net.IP, mac net.HardwareAddr, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qry := `SELECT A.id, B.address, A.active_host_id, A.standby_host_id
+			FROM vip A
+			JOIN ip B ON A.ip_id = B.id
+			WHERE A.id = $1
+			FOR UPDATE OF A`
+		result, err := r.toggleVIPs(tx, qry, id)
+		if err != nil {
+			return err
+		}
+		if len(result) == 0 {
+			return fmt.Errorf("unknown VIP (ID=%v)", id)
+		}
+		ip, mac = result[0].IP, result[0].MAC
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, nil, err
+	}
+
+	return ip, mac, nil
+}
+
+func (r *stdSQL) TogglePortVIP(swDPID uint64, portNum uint16) (result []virtualip.Address, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		portID, err := r.portID(tx, swDPID, portNum)
+		if err != nil {
+			return err
+		}
+		qry := `SELECT A.id, C.address, A.active_host_id, A.standby_host_id
+			FROM vip A
+			JOIN host B ON A.active_host_id = B.id
+			JOIN ip C ON A.ip_id = C.id
+			WHERE B.port_id = $1
+			FOR UPDATE OF A`
+		if result, err = r.toggleVIPs(tx, qry, portID); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *stdSQL) ToggleDeviceVIP(swDPID uint64) (result []virtualip.Address, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qry := `SELECT A.id, E.address, A.active_host_id, A.standby_host_id
+			FROM vip A
+			JOIN host B ON A.active_host_id = B.id
+			JOIN port C ON B.port_id = C.id
+			JOIN switch D ON D.id = C.switch_id
+			JOIN ip E ON E.id = A.ip_id
+			WHERE D.dpid = $1
+			FOR UPDATE OF A`
+		if result, err = r.toggleVIPs(tx, qry, dpidArg(swDPID)); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *stdSQL) portID(tx *sql.Tx, swDPID uint64, portNum uint16) (id uint64, err error) {
+	qry := `SELECT A.id
+		FROM port A
+		JOIN switch B ON A.switch_id = B.id
+		WHERE A.number = $1 AND B.dpid = $2
+		FOR SHARE`
+	if err := tx.QueryRow(r.sql(qry), portNum, dpidArg(swDPID)).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("unknown switch port (DPID=%v, Number=%v)", swDPID, portNum)
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *stdSQL) VIPs(limit, offset uint8) (result []network.VIP, err error) {
+	vips, err := r.getVIPs(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range vips {
+		active, ok, err := r.Host(v.active)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown active host (ID=%v)", v.active)
+		}
+
+		standby, ok, err := r.Host(v.standby)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown standby host (ID=%v)", v.standby)
+		}
+
+		result = append(result, network.VIP{
+			ID:          v.id,
+			IP:          v.address,
+			ActiveHost:  active,
+			StandbyHost: standby,
+			Description: v.description,
+		})
+	}
+
+	return result, nil
+}
+
+func (r *stdSQL) getVIPs(limit, offset uint8) (result []registeredVIP, err error) {
+	f := func(db *sql.DB) error {
+		result = nil
+
+		qry := `SELECT A.id, B.address, C.mask, A.active_host_id, A.standby_host_id, A.description
+			FROM vip A
+			JOIN ip B ON A.ip_id = B.id
+			JOIN network C ON C.id = B.network_id
+			ORDER BY A.id DESC`
+		rows, err := db.Query(r.sql(qry + sqlLimit(limit, offset)))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v registeredVIP
+			var addr int64
+			var mask uint8
+			if err := rows.Scan(&v.id, &addr, &mask, &v.active, &v.standby, &v.description); err != nil {
+				return err
+			}
+			v.address = fmt.Sprintf("%v/%v", intToIPv4(addr), mask)
+			result = append(result, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *stdSQL) GetActivatedVIPs() (result []virtualip.Address, err error) {
+	f := func(db *sql.DB) error {
+		result = nil
+
+		qry := `SELECT B.address, C.mac
+			FROM vip A
+			JOIN ip B ON A.ip_id = B.id
+			JOIN host C ON A.active_host_id = C.id`
+		rows, err := db.Query(r.sql(qry))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr int64
+			var mac []byte
+			if err := rows.Scan(&addr, &mac); err != nil {
+				return err
+			}
+			result = append(result, virtualip.Address{IP: intToIPv4(addr), MAC: net.HardwareAddr(mac)})
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *stdSQL) AddVIP(vip network.VIPParam) (id uint64, cidr string, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		ok, err := r.isAvailableIP(tx, vip.IPID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("already used IP address")
+		}
+		qry := "INSERT INTO vip (ip_id, active_host_id, standby_host_id, description) VALUES ($1, $2, $3, $4) RETURNING id"
+		if err := tx.QueryRow(r.sql(qry), vip.IPID, vip.ActiveHostID, vip.StandbyHostID, vip.Description).Scan(&id); err != nil {
+			return err
+		}
+
+		var addr int64
+		var mask uint8
+		qry = "SELECT A.address, B.mask FROM ip A JOIN network B ON A.network_id = B.id WHERE A.id = $1"
+		if err := tx.QueryRow(r.sql(qry), vip.IPID).Scan(&addr, &mask); err != nil {
+			return err
+		}
+		cidr = fmt.Sprintf("%v/%v", intToIPv4(addr), mask)
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return 0, "", err
+	}
+
+	return id, cidr, nil
+}
+
+func (r *stdSQL) RemoveVIP(id uint64) (ok bool, err error) {
+	return r.remove("vip", id)
+}
+
+// GetUndiscoveredHosts returns IP addresses whose physical location is still
+// undiscovered, and the ones whose location has been staled more than
+// expiration. The results can be nil on empty result.
+func (r *stdSQL) GetUndiscoveredHosts(expiration time.Duration) (undiscovered, staled []net.IP, err error) {
+	f := func(db *sql.DB) error {
+		// Initialize the results as this function can be called again on a deadlock.
+		undiscovered, staled = nil, nil
+
+		// NOTE: Do not include VIP addresses!
+		qry := `SELECT B.address, A.port_id IS NULL
+			FROM host A
+			JOIN ip B ON A.ip_id = B.id
+			WHERE A.port_id IS NULL OR A.last_updated_timestamp < $1`
+		rows, err := db.Query(r.sql(qry), now().Add(-expiration))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr int64
+			var unknown bool
+			if err := rows.Scan(&addr, &unknown); err != nil {
+				return err
+			}
+			if unknown {
+				undiscovered = append(undiscovered, intToIPv4(addr))
+			} else {
+				staled = append(staled, intToIPv4(addr))
+			}
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, nil, err
+	}
+
+	return undiscovered, staled, nil
+}
+
+// UpdateHostLocation updates the physical location of a host, whose MAC and IP
+// addresses are matched with mac and ip, to the port identified by swDPID and
+// portNum. updated will be true if its location has been actually updated.
+func (r *stdSQL) UpdateHostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
+	addr, err := ipv4ToInt(ip)
+	if err != nil {
+		return false, err
+	}
+
+	return r.updateLocation(swDPID, portNum, ipv4HostQuery, []byte(mac), addr)
+}
+
+// UpdateIPv6HostLocation updates the physical location of a host, whose MAC
+// and IPv6 addresses are matched with mac and ip, to the port identified by
+// swDPID and portNum. updated will be true if its location has been actually updated.
+func (r *stdSQL) UpdateIPv6HostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
+	return r.updateLocation(swDPID, portNum, ipv6HostQuery, []byte(mac), []byte(ip.To16()))
+}
+
+// Queries that select the ID and the port ID of the host whose MAC address is
+// $1, and whose IPv4 or IPv6 address is $2.
+const (
+	ipv4HostQuery = `SELECT A.id, A.port_id
+		FROM host A
+		JOIN ip B ON A.ip_id = B.id
+		WHERE A.mac = $1 AND B.address = $2
+		FOR UPDATE OF A`
+	ipv6HostQuery = `SELECT A.id, A.port_id
+		FROM host A
+		JOIN host_ipv6 B ON A.id = B.host_id
+		WHERE A.mac = $1 AND B.address = $2
+		FOR UPDATE OF A`
+)
+
+// updateLocation updates the location of the host selected by qry, which selects its ID and port ID.
+func (r *stdSQL) updateLocation(swDPID uint64, portNum uint16, qry string, args ...interface{}) (updated bool, err error) {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if updated, err = r.updateLocationTx(tx, swDPID, portNum, qry, args...); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+func (r *stdSQL) updateLocationTx(tx *sql.Tx, swDPID uint64, portNum uint16, qry string, args ...interface{}) (updated bool, err error) {
+	var hostID uint64
+	var previous sql.NullInt64
+	if err := tx.QueryRow(r.sql(qry), args...).Scan(&hostID, &previous); err != nil {
+		// Unknown host?
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	portID, err := r.portID(tx, swDPID, portNum)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(r.sql("UPDATE host SET port_id = $1, last_updated_timestamp = $2 WHERE id = $3"), portID, now(), hostID); err != nil {
+		return false, err
+	}
+
+	return !previous.Valid || uint64(previous.Int64) != portID, nil
+}
+
+// UpdateHostLocations updates the host locations in a single transaction as
+// UpdateHostLocation and UpdateIPv6HostLocation do. updated[i] will be true if
+// the location of updates[i] has been actually updated.
+func (r *stdSQL) UpdateHostLocations(updates []discovery.LocationUpdate) (updated []bool, err error) {
+	f := func(db *sql.DB) error {
+		updated = make([]bool, len(updates))
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for i, v := range updates {
+			if v.IP.To4() != nil {
+				addr, err := ipv4ToInt(v.IP)
+				if err != nil {
+					return err
+				}
+				updated[i], err = r.updateLocationTx(tx, v.DPID, v.Port, ipv4HostQuery, []byte(v.MAC), addr)
+			} else {
+				updated[i], err = r.updateLocationTx(tx, v.DPID, v.Port, ipv6HostQuery, []byte(v.MAC), []byte(v.IP.To16()))
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// ResetHostLocationsByPort sets NULL to the host locations that belong to the
+// port specified by swDPID and portNum, and then returns the reset hosts.
+func (r *stdSQL) ResetHostLocationsByPort(swDPID uint64, portNum uint16) (hosts []discovery.Host, err error) {
+	return r.resetHostLocations("C.number = $1 AND D.dpid = $2", portNum, dpidArg(swDPID))
+}
+
+// ResetHostLocationsByDevice sets NULL to the host locations that belong to the
+// device specified by swDPID, and then returns the reset hosts.
+func (r *stdSQL) ResetHostLocationsByDevice(swDPID uint64) (hosts []discovery.Host, err error) {
+	return r.resetHostLocations("D.dpid = $1", dpidArg(swDPID))
+}
+
+// ResetHostLocationsByPorts sets NULL to the host locations that belong to the
+// ports specified by swDPID and portNums in a single transaction, and then
+// returns the reset hosts. Unknown ports are ignored.
+func (r *stdSQL) ResetHostLocationsByPorts(swDPID uint64, portNums []uint16) (hosts []discovery.Host, err error) {
+	if len(portNums) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{dpidArg(swDPID)}
+	params := make([]string, len(portNums))
+	for i, v := range portNums {
+		args = append(args, v)
+		params[i] = fmt.Sprintf("$%v", i+2)
+	}
+
+	return r.resetHostLocations("D.dpid = $1 AND C.number IN ("+strings.Join(params, ", ")+")", args...)
+}
+
+// resetHostLocations sets NULL to the locations of the hosts selected by cond,
+// which is a condition on the port (C) and the switch (D) tables.
+func (r *stdSQL) resetHostLocations(cond string, args ...interface{}) (hosts []discovery.Host, err error) {
+	f := func(db *sql.DB) error {
+		hosts = nil
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qry := `SELECT A.mac, B.address, D.dpid, C.number
+			FROM host A
+			JOIN ip B ON A.ip_id = B.id
+			JOIN port C ON A.port_id = C.id
+			JOIN switch D ON C.switch_id = D.id
+			WHERE ` + cond + `
+			FOR UPDATE OF A`
+		rows, err := tx.Query(r.sql(qry), args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var addr int64
+			var mac []byte
+			var v discovery.Host
+			if err := rows.Scan(&mac, &addr, &v.Location.DPID, &v.Location.Port); err != nil {
+				rows.Close()
+				return err
+			}
+			v.MAC = net.HardwareAddr(mac)
+			v.IP = intToIPv4(addr)
+			hosts = append(hosts, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// A single statement for all the hosts, as a device can have hundreds of hosts.
+		qry = `UPDATE host SET port_id = NULL
+			WHERE port_id IN (
+				SELECT C.id
+				FROM port C
+				JOIN switch D ON C.switch_id = D.id
+				WHERE ` + cond + `
+			)`
+		if _, err := tx.Exec(r.sql(qry), args...); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+// GetUndiscoveredIPv6Hosts returns IPv6 addresses of the hosts whose physical
+// location is still undiscovered, and the ones whose location has been staled
+// more than expiration. The results can be nil on empty result.
+func (r *stdSQL) GetUndiscoveredIPv6Hosts(expiration time.Duration) (undiscovered, staled []net.IP, err error) {
+	f := func(db *sql.DB) error {
+		// Initialize the results as this function can be called again on a deadlock.
+		undiscovered, staled = nil, nil
+
+		qry := `SELECT B.address, A.port_id IS NULL
+			FROM host A
+			JOIN host_ipv6 B ON A.id = B.host_id
+			WHERE A.port_id IS NULL OR A.last_updated_timestamp < $1`
+		rows, err := db.Query(r.sql(qry), now().Add(-expiration))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr []byte
+			var unknown bool
+			if err := rows.Scan(&addr, &unknown); err != nil {
+				return err
+			}
+			if len(addr) != net.IPv6len {
+				return fmt.Errorf("invalid IPv6 address: %v", addr)
+			}
+			if unknown {
+				undiscovered = append(undiscovered, net.IP(addr))
+			} else {
+				staled = append(staled, net.IP(addr))
+			}
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, nil, err
+	}
+
+	return undiscovered, staled, nil
+}
+
+// Elect selects a new master as uid if there is a no existing master that has
+// been updated within expiration. elected will be true if this uid has been
+// elected as the new master or was already elected.
+func (r *stdSQL) Elect(uid string, expiration time.Duration) (elected bool, err error) {
+	f := func(db *sql.DB) error {
+		elected = false
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		// The unique type prevents the concurrent insertions of the masters.
+		qry := "INSERT INTO election (name, type, timestamp) VALUES ($1, 'MASTER', $2) ON CONFLICT (type) DO NOTHING"
+		result, err := tx.Exec(r.sql(qry), uid, now())
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// No existing master?
+		if n > 0 {
+			// I am the newly elected master!
+			elected = true
+			return tx.Commit()
+		}
+
+		var name string
+		var timestamp time.Time
+		if err := tx.QueryRow(r.sql("SELECT name, timestamp FROM election WHERE type = 'MASTER' FOR UPDATE")).Scan(&name, &timestamp); err != nil {
+			return err
+		}
+		// Already elected or another stale master?
+		if name == uid || time.Now().Sub(timestamp) > expiration {
+			if _, err := tx.Exec(r.sql("UPDATE election SET name = $1, timestamp = $2 WHERE type = 'MASTER'"), uid, now()); err != nil {
+				return err
+			}
+			elected = true
+		}
+
+		return tx.Commit()
+	}
+	if err := r.query(f); err != nil {
+		return false, err
+	}
+
+	return elected, nil
+}
+
+// Heartbeat records the heartbeat of m, and then returns the members whose
+// last heartbeats are within expiration, including m. The members whose
+// heartbeats have expired are removed.
+func (r *stdSQL) Heartbeat(m cluster.Member, expiration time.Duration) (members []cluster.Member, err error) {
+	f := func(db *sql.DB) error {
+		members = nil
+
+		qry := "INSERT INTO cluster_member (uid, name, address, leader, timestamp) VALUES ($1, $2, $3, $4, $5) "
+		qry += "ON CONFLICT (uid) DO UPDATE SET name = excluded.name, address = excluded.address, leader = excluded.leader, timestamp = excluded.timestamp"
+		if _, err := db.Exec(r.sql(qry), m.UID, m.Name, m.Address, m.Leader, now()); err != nil {
+			return err
+		}
+		deadline := now().Add(-expiration)
+		if _, err := db.Exec(r.sql("DELETE FROM cluster_member WHERE timestamp < $1"), deadline); err != nil {
+			return err
+		}
+
+		rows, err := db.Query(r.sql("SELECT uid, name, address, leader, timestamp FROM cluster_member"))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v cluster.Member
+			if err := rows.Scan(&v.UID, &v.Name, &v.Address, &v.Leader, &v.Timestamp); err != nil {
+				return err
+			}
+			members = append(members, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SaveState stores state of the replica specified by name.
+func (r *stdSQL) SaveState(name string, state []byte) error {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO cluster_state (name, state, timestamp) VALUES ($1, $2, $3) "
+		qry += "ON CONFLICT (name) DO UPDATE SET state = excluded.state, timestamp = excluded.timestamp"
+		_, err := db.Exec(r.sql(qry), name, state, now())
+		return err
+	}
+
+	return r.query(f)
+}
+
+// State returns the state of the replica specified by name and when it has
+// been stored. ok will be false if there is no such state.
+func (r *stdSQL) State(name string) (state []byte, timestamp time.Time, ok bool, err error) {
+	f := func(db *sql.DB) error {
+		qry := "SELECT state, timestamp FROM cluster_state WHERE name = $1"
+		if err := db.QueryRow(r.sql(qry), name).Scan(&state, &timestamp); err != nil {
+			if err == sql.ErrNoRows {
+				ok = false
+				return nil
+			}
+			return err
+		}
+		ok = true
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	return state, timestamp, ok, nil
+}
+
+// AddFlow adds a new flow into the database and returns its unique ID.
+func (r *stdSQL) AddFlow(swDPID uint64, dstMAC net.HardwareAddr, outPort uint32) (flowID uint64, err error) {
+	f := func(db *sql.DB) error {
+		qry := `INSERT INTO flow (switch_id, dst_mac, out_port, timestamp)
+			SELECT id, $2, $3, $4 FROM switch WHERE dpid = $1
+			RETURNING id`
+		return db.QueryRow(r.sql(qry), dpidArg(swDPID), dstMAC.String(), outPort, now()).Scan(&flowID)
+	}
+	if err := r.query(f); err != nil {
+		return 0, err
+	}
+
+	return flowID, nil
+}
+
+// RemoveFlow removes the flow specified by flowID from the database.
+func (r *stdSQL) RemoveFlow(flowID uint64) error {
+	f := func(db *sql.DB) error {
+		_, err := db.Exec(r.sql("UPDATE flow SET removed = TRUE WHERE id = $1"), flowID)
+		return err
+	}
+
+	return r.query(f)
+}
+
+// MACRules returns all the MAC access control rules.
+func (r *stdSQL) MACRules() (rules []acl.Rule, err error) {
+	f := func(db *sql.DB) error {
+		rules = nil
+
+		rows, err := db.Query(r.sql("SELECT id, mac, dpid, port, allow FROM mac_acl ORDER BY id"))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v acl.Rule
+			var mac []byte
+			if err := rows.Scan(&v.ID, &mac, &v.DPID, &v.Port, &v.Allow); err != nil {
+				return err
+			}
+			v.MAC = net.HardwareAddr(mac)
+			rules = append(rules, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// AddMACRule adds a new MAC access control rule and returns its unique ID.
+func (r *stdSQL) AddMACRule(rule acl.Rule) (id uint64, err error) {
+	f := func(db *sql.DB) error {
+		qry := "INSERT INTO mac_acl (mac, dpid, port, allow) VALUES ($1, $2, $3, $4) RETURNING id"
+		return db.QueryRow(r.sql(qry), []byte(rule.MAC), dpidArg(rule.DPID), rule.Port, rule.Allow).Scan(&id)
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveMACRule removes the MAC access control rule specified by id, and then returns the removed one.
+func (r *stdSQL) RemoveMACRule(id uint64) (rule acl.Rule, ok bool, err error) {
+	f := func(db *sql.DB) error {
+		ok = false
+
+		var mac []byte
+		qry := "DELETE FROM mac_acl WHERE id = $1 RETURNING id, mac, dpid, port, allow"
+		if err := db.QueryRow(r.sql(qry), id).Scan(&rule.ID, &mac, &rule.DPID, &rule.Port, &rule.Allow); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		rule.MAC = net.HardwareAddr(mac)
+		ok = true
+
+		return nil
+	}
+	if err = r.query(f); err != nil {
+		return acl.Rule{}, false, err
+	}
+
+	return rule, ok, nil
+}
+
+// Policies returns all the routing policies sorted by their IDs.
+func (r *stdSQL) Policies() (policies []pbr.Policy, err error) {
+	f := func(db *sql.DB) error {
+		policies = nil
+
+		qry := "SELECT id, src_address, src_mask, dst_address, dst_mask, protocol, dst_port, dpid, port FROM pbr_policy ORDER BY id"
+		rows, err := db.Query(r.sql(qry))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v pbr.Policy
+			var srcAddr, dstAddr int64
+			var srcMask, dstMask uint8
+			if err := rows.Scan(&v.ID, &srcAddr, &srcMask, &dstAddr, &dstMask, &v.Protocol, &v.DstPort, &v.DPID, &v.Port); err != nil {
+				return err
+			}
+			if v.SrcNet, err = ipNet(intToIPv4(srcAddr).String(), srcMask); err != nil {
+				return err
+			}
+			if v.DstNet, err = ipNet(intToIPv4(dstAddr).String(), dstMask); err != nil {
+				return err
+			}
+			policies = append(policies, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// AddPolicy adds a new routing policy and returns its unique ID.
+func (r *stdSQL) AddPolicy(policy pbr.Policy) (id uint64, err error) {
+	srcAddr, srcMask := splitIPNet(policy.SrcNet)
+	src, err := ipv4ToInt(net.ParseIP(srcAddr))
+	if err != nil {
+		return 0, err
+	}
+	dstAddr, dstMask := splitIPNet(policy.DstNet)
+	dst, err := ipv4ToInt(net.ParseIP(dstAddr))
+	if err != nil {
+		return 0, err
+	}
+
+	f := func(db *sql.DB) error {
+		qry := `INSERT INTO pbr_policy (src_address, src_mask, dst_address, dst_mask, protocol, dst_port, dpid, port)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id`
+		return db.QueryRow(r.sql(qry), src, srcMask, dst, dstMask, policy.Protocol, policy.DstPort, dpidArg(policy.DPID), policy.Port).Scan(&id)
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemovePolicy removes the routing policy specified by id. ok will be false if there is no such policy.
+func (r *stdSQL) RemovePolicy(id uint64) (ok bool, err error) {
+	return r.remove("pbr_policy", id)
+}
+
+// AddJournal records the journal entries in a single transaction.
+func (r *stdSQL) AddJournal(entries []journal.Entry) error {
+	f := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.Prepare(r.sql("INSERT INTO journal (type, message, timestamp) VALUES ($1, $2, $3)"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, v := range entries {
+			if _, err := stmt.Exec(v.Type, v.Message, v.Timestamp.UTC()); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+
+	return r.query(f)
+}
+
+// Journal returns the journal entries recorded at or after since, whose type
+// is eventType, in descending order of their IDs. Zero since and empty
+// eventType match all the entries.
+func (r *stdSQL) Journal(since time.Time, eventType string, limit uint16) (entries []journal.Entry, err error) {
+	f := func(db *sql.DB) error {
+		entries = nil
+
+		qry := "SELECT id, type, message, timestamp FROM journal WHERE timestamp >= $1 "
+		args := []interface{}{since.UTC()}
+		if len(eventType) > 0 {
+			qry += "AND type = $2 "
+			args = append(args, eventType)
+		}
+		qry += fmt.Sprintf("ORDER BY id DESC LIMIT %v", limit)
+
+		rows, err := db.Query(r.sql(qry), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v journal.Entry
+			if err := rows.Scan(&v.ID, &v.Type, &v.Message, &v.Timestamp); err != nil {
+				return err
+			}
+			entries = append(entries, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RemoveJournal removes the journal entries recorded before t, and then returns the number of the removed entries.
+func (r *stdSQL) RemoveJournal(before time.Time) (n int64, err error) {
+	f := func(db *sql.DB) error {
+		result, err := db.Exec(r.sql("DELETE FROM journal WHERE timestamp < $1"), before.UTC())
+		if err != nil {
+			return err
+		}
+		n, err = result.RowsAffected()
+
+		return err
+	}
+	if err = r.query(f); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -38,15 +38,19 @@ var (
 )
 
 const (
-	interval = 1 * time.Second
+	// DefaultExpiration is the time after which the master that has not
+	// updated its election is replaced by another one.
+	DefaultExpiration = 5 * time.Second
 )
 
 type Observer struct {
-	uid string
-	db  Database
+	uid        string
+	db         Database
+	expiration time.Duration
 
-	mutex  sync.Mutex
-	master bool
+	mutex     sync.Mutex
+	master    bool
+	listeners []func(master bool)
 }
 
 type Database interface {
@@ -56,10 +60,16 @@ type Database interface {
 	Elect(uid string, expiration time.Duration) (elected bool, err error)
 }
 
-func New(db Database) *Observer {
+// New returns an observer that runs the election every fifth of expiration.
+func New(db Database, expiration time.Duration) *Observer {
+	if expiration <= 0 {
+		expiration = DefaultExpiration
+	}
+
 	return &Observer{
-		uid: generateRandomUID(),
-		db:  db,
+		uid:        generateRandomUID(),
+		db:         db,
+		expiration: expiration,
 	}
 }
 
@@ -72,7 +82,7 @@ func generateRandomUID() string {
 func (r *Observer) Run(ctx context.Context) error {
 	logger.Debugf("starting an election observer: uid=%v", r.uid)
 
-	ticker := time.Tick(interval)
+	ticker := time.Tick(r.expiration / 5)
 	// Infinite loop.
 	for {
 		// Wait the context cancels or the ticker rasises.
@@ -82,7 +92,7 @@ func (r *Observer) Run(ctx context.Context) error {
 			return nil
 		case <-ticker:
 			prev := r.getMaster()
-			elected, err := r.db.Elect(r.uid, interval*5)
+			elected, err := r.db.Elect(r.uid, r.expiration)
 			if err != nil {
 				return err
 			}
@@ -90,11 +100,37 @@ func (r *Observer) Run(ctx context.Context) error {
 
 			if prev != elected {
 				logger.Warningf("master controller has been changed: prev=%v, new=%v", prev, elected)
+				r.notify(elected)
 			}
 		}
 	}
 }
 
+// UID returns the unique ID of this observer in the election.
+func (r *Observer) UID() string {
+	return r.uid
+}
+
+// OnChange registers f that is called whenever this observer becomes the
+// master or loses the mastership. f should not block the election.
+func (r *Observer) OnChange(f func(master bool)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.listeners = append(r.listeners, f)
+}
+
+func (r *Observer) notify(master bool) {
+	r.mutex.Lock()
+	listeners := make([]func(bool), len(r.listeners))
+	copy(listeners, r.listeners)
+	r.mutex.Unlock()
+
+	for _, f := range listeners {
+		f(master)
+	}
+}
+
 func (r *Observer) IsMaster() bool {
 	return r.getMaster()
 }
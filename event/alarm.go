@@ -0,0 +1,47 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package event
+
+// AlarmRaised is published with Alarm when an abnormal event occurs. The
+// Monitor application notifies the administrator of the alarms.
+const AlarmRaised Type = "AlarmRaised"
+
+type Alarm struct {
+	Subject string
+	Body    string
+	// Switch that the alarm is about, which is zero if it is not about a
+	// switch, and its port, which is zero if it is about the whole switch.
+	// The alarms of the switches under maintenance are suppressed.
+	DPID uint64
+	Port uint32
+}
+
+// RaiseAlarm publishes a new alarm.
+func RaiseAlarm(subject, body string) {
+	Publish(AlarmRaised, Alarm{Subject: subject, Body: body})
+}
+
+// RaisePortAlarm publishes a new alarm about the port of the switch whose DPID
+// is dpid. Zero port means the whole switch.
+func RaisePortAlarm(dpid uint64, port uint32, subject, body string) {
+	Publish(AlarmRaised, Alarm{Subject: subject, Body: body, DPID: dpid, Port: port})
+}
@@ -0,0 +1,54 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package event
+
+import (
+	"fmt"
+)
+
+// AuditRecorded is published with Audit whenever a client calls a management
+// API that changes the state of the controller or the network. The Journal
+// application persists them, so that they can be queried later.
+const AuditRecorded Type = "AuditRecorded"
+
+// Audit is an administrative action.
+type Audit struct {
+	User   string `json:"user"`   // Name of the authenticated client.
+	Client string `json:"client"` // Remote address of the client.
+	Action string `json:"action"` // e.g., DELETE /api/v1/flow/00:11:22:33:44:55
+	Params string `json:"params,omitempty"`
+	Result string `json:"result"` // e.g., 200 OK
+}
+
+func (r Audit) String() string {
+	s := fmt.Sprintf("user=%v, client=%v, action=%v", r.User, r.Client, r.Action)
+	if r.Params != "" {
+		s += fmt.Sprintf(", params=%v", r.Params)
+	}
+
+	return s + fmt.Sprintf(", result=%v", r.Result)
+}
+
+// RecordAudit publishes a new audit record.
+func RecordAudit(a Audit) {
+	Publish(AuditRecorded, a)
+}
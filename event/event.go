@@ -0,0 +1,115 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package event provides a simple publish/subscribe API for the structured
+// events raised by the controller and its north-bound applications.
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+type Type string
+
+type Event struct {
+	Type      Type
+	Timestamp time.Time
+	Data      interface{}
+}
+
+// Listener is called synchronously when an event is published, so it should not block.
+type Listener func(Event)
+
+type subscriber struct {
+	listener Listener
+	// Nil means all types.
+	types map[Type]bool
+}
+
+var (
+	mutex       sync.RWMutex
+	lastID      uint64
+	subscribers = make(map[uint64]*subscriber)
+)
+
+// Subscribe registers l to receive the events whose type is one of types. If
+// types is empty, l receives all the events. It returns a function that
+// cancels the subscription.
+func Subscribe(l Listener, types ...Type) (unsubscribe func()) {
+	s := &subscriber{listener: l}
+	if len(types) > 0 {
+		s.types = make(map[Type]bool)
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	mutex.Lock()
+	lastID++
+	id := lastID
+	subscribers[id] = s
+	mutex.Unlock()
+
+	return func() {
+		mutex.Lock()
+		delete(subscribers, id)
+		mutex.Unlock()
+	}
+}
+
+// Publish delivers a new event whose type is t to the subscribers.
+func Publish(t Type, data interface{}) {
+	e := Event{
+		Type:      t,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	mutex.RLock()
+	listeners := make([]Listener, 0, len(subscribers))
+	for _, v := range subscribers {
+		if v.types == nil || v.types[t] {
+			listeners = append(listeners, v.listener)
+		}
+	}
+	mutex.RUnlock()
+
+	for _, l := range listeners {
+		l(e)
+	}
+}
+
+// Channel subscribes to the events whose type is one of types, like Subscribe,
+// and delivers them to the returned channel whose buffer size is size. The
+// events are dropped if the buffer is full, so that a slow receiver never
+// blocks the publishers. It returns a function that cancels the subscription.
+func Channel(size int, types ...Type) (c <-chan Event, unsubscribe func()) {
+	queue := make(chan Event, size)
+	unsubscribe = Subscribe(func(e Event) {
+		select {
+		case queue <- e:
+		default:
+		}
+	}, types...)
+
+	return queue, unsubscribe
+}
@@ -0,0 +1,128 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package event
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// The events below are exchanged among the north-bound applications, so that
+// an application can react to the others without importing them. The packets
+// are still passed along the processor chain.
+const (
+	// HostAuthenticated is published with HostAuth when a host is authenticated.
+	HostAuthenticated Type = "HostAuthenticated"
+	// ACLUpdated is published with ACLUpdate when the MAC rules are changed.
+	ACLUpdated Type = "ACLUpdated"
+	// HostQuarantined is published with Quarantine when a host is blocked.
+	HostQuarantined Type = "HostQuarantined"
+)
+
+type HostAuth struct {
+	MAC net.HardwareAddr `json:"mac"`
+	// Location of the host, which is zero if it is unknown.
+	DPID uint64 `json:"dpid,omitempty"`
+	Port uint32 `json:"port,omitempty"`
+	// VLAN assigned to the host by the authentication server, which is zero if
+	// there is no assignment. The controller switches all the hosts in the default
+	// VLAN, so it is up to the subscribers to apply it, e.g., by configuring the
+	// access VLAN of the switch port.
+	VLANID uint16 `json:"vlan_id,omitempty"`
+	// Application that has authenticated the host, e.g., Auth or Portal.
+	Source string `json:"source"`
+}
+
+func (r HostAuth) String() string {
+	return fmt.Sprintf("MAC=%v, DPID=%v, Port=%v, VLANID=%v, Source=%v", r.MAC, r.DPID, r.Port, r.VLANID, r.Source)
+}
+
+type ACLUpdate struct {
+	// Nil means the rules of all the hosts, e.g., when the default policy is changed.
+	MAC net.HardwareAddr `json:"mac,omitempty"`
+}
+
+func (r ACLUpdate) String() string {
+	if r.MAC == nil {
+		return "MAC=all"
+	}
+
+	return fmt.Sprintf("MAC=%v", r.MAC)
+}
+
+type Quarantine struct {
+	MAC      net.HardwareAddr `json:"mac,omitempty"`
+	IP       net.IP           `json:"ip,omitempty"`
+	Duration time.Duration    `json:"duration"`
+	// Application that has blocked the host, e.g., IDS.
+	Source string `json:"source"`
+}
+
+func (r Quarantine) String() string {
+	return fmt.Sprintf("MAC=%v, IP=%v, Duration=%v, Source=%v", r.MAC, r.IP, r.Duration, r.Source)
+}
+
+// NotifyHostAuthenticated publishes a new HostAuthenticated event.
+func NotifyHostAuthenticated(v HostAuth) {
+	Publish(HostAuthenticated, v)
+}
+
+// OnHostAuthenticated calls f with the HostAuthenticated events. It returns a
+// function that cancels the subscription.
+func OnHostAuthenticated(f func(HostAuth)) (unsubscribe func()) {
+	return Subscribe(func(e Event) {
+		if v, ok := e.Data.(HostAuth); ok {
+			f(v)
+		}
+	}, HostAuthenticated)
+}
+
+// NotifyACLUpdated publishes a new ACLUpdated event.
+func NotifyACLUpdated(v ACLUpdate) {
+	Publish(ACLUpdated, v)
+}
+
+// OnACLUpdated calls f with the ACLUpdated events. It returns a function that
+// cancels the subscription.
+func OnACLUpdated(f func(ACLUpdate)) (unsubscribe func()) {
+	return Subscribe(func(e Event) {
+		if v, ok := e.Data.(ACLUpdate); ok {
+			f(v)
+		}
+	}, ACLUpdated)
+}
+
+// NotifyHostQuarantined publishes a new HostQuarantined event.
+func NotifyHostQuarantined(v Quarantine) {
+	Publish(HostQuarantined, v)
+}
+
+// OnHostQuarantined calls f with the HostQuarantined events. It returns a
+// function that cancels the subscription.
+func OnHostQuarantined(f func(Quarantine)) (unsubscribe func()) {
+	return Subscribe(func(e Event) {
+		if v, ok := e.Data.(Quarantine); ok {
+			f(v)
+		}
+	}, HostQuarantined)
+}
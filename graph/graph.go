@@ -26,6 +26,7 @@ import (
 	"container/list"
 	"errors"
 	"fmt"
+	"math"
 	"sort"
 	"sync"
 	"time"
@@ -200,6 +201,20 @@ func (r *Graph) RemoveEdge(p Point) {
 	logger.Debugf("removed an edge: id=%v", e.value.ID())
 }
 
+// Edges returns all the edges in the graph.
+func (r *Graph) Edges() []Edge {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v := make([]Edge, 0, len(r.edges))
+	for _, e := range r.edges {
+		v = append(v, e.value)
+	}
+
+	return v
+}
+
 // IsEdge returns whether p is on an edge between two vertexeis.
 func (r *Graph) IsEdge(p Point) bool {
 	// Read lock
@@ -431,6 +446,72 @@ func (r *Graph) FindPath(src, dst Vertex) []Path {
 		}
 	}
 
+	return backtrack(prev, dst)
+}
+
+// FindShortestPath finds the path of the least cost from src to dst using
+// Dijkstra's algorithm. Unlike FindPath, it also uses the edges disabled by the
+// minimum spanning tree. cost returns the non-negative cost of e when it is
+// traversed from p, which may differ by the direction, and the infinite cost
+// excludes e. cost is called with the read lock held, so it should not call
+// the methods of this graph.
+func (r *Graph) FindShortestPath(src, dst Vertex, cost func(p Point, e Edge) float64) []Path {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if _, ok := r.vertexies[src.ID()]; !ok || len(r.edges) == 0 {
+		return []Path{}
+	}
+
+	dist := map[string]float64{src.ID(): 0}
+	done := make(map[string]bool)
+	prev := make(map[string]Path)
+	for {
+		// Linear search instead of a priority queue, which is fast enough
+		// for the number of the switches in a network.
+		u, min := "", math.Inf(1)
+		for id, d := range dist {
+			// The lower ID wins the tie so that the result is stable.
+			if done[id] || d > min || (d == min && id > u) {
+				continue
+			}
+			u, min = id, d
+		}
+		if u == "" || u == dst.ID() {
+			break
+		}
+		done[u] = true
+
+		vertex := r.vertexies[u]
+		for _, w := range vertex.edges {
+			points := w.value.Points()
+			from, next := points[0], points[1]
+			if from.Vertex().ID() != u {
+				from, next = next, from
+			}
+			id := next.Vertex().ID()
+			if done[id] {
+				continue
+			}
+			d := min + cost(from, w.value)
+			if math.IsInf(d, 1) {
+				continue
+			}
+			if old, ok := dist[id]; ok && old <= d {
+				continue
+			}
+			dist[id] = d
+			prev[id] = Path{V: vertex.value, E: w.value}
+		}
+	}
+
+	return backtrack(prev, dst)
+}
+
+// backtrack returns the path from the source to dst, where prev is the
+// previous step of each vertex on the way from the source.
+func backtrack(prev map[string]Path, dst Vertex) []Path {
 	u := dst
 	result := make([]Path, 0)
 	for {
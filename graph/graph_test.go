@@ -23,6 +23,7 @@ package graph
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -92,7 +93,7 @@ func TestInvalidMST(t *testing.T) {
 		points: [2]point{point{"a", 1}, point{"b", 1}},
 		weight: 2,
 	}
-	if err := graph.AddEdge(e); err == nil {
+	if _, err := graph.AddEdge(e); err == nil {
 		t.Fatal("Expected error, but not occurred!")
 	}
 }
@@ -105,7 +106,7 @@ func TestRemoveVertex(t *testing.T) {
 		points: [2]point{point{"a", 1}, point{"b", 1}},
 		weight: 2,
 	}
-	if err := graph.AddEdge(e); err != nil {
+	if _, err := graph.AddEdge(e); err != nil {
 		t.Fatal(err)
 	}
 	graph.RemoveVertex(node{"a"})
@@ -132,7 +133,7 @@ func TestRemoveEdges(t *testing.T) {
 		points: [2]point{point{"a", 1}, point{"b", 1}},
 		weight: 2,
 	}
-	if err := graph.AddEdge(e); err != nil {
+	if _, err := graph.AddEdge(e); err != nil {
 		t.Fatal(err)
 	}
 	graph.RemoveEdge(point{"a", 1})
@@ -148,10 +149,10 @@ func TestRemoveEdges(t *testing.T) {
 		t.Fatalf("Expected # of edges is 0/0, got=%v/%v\n", len(a.edges), len(b.edges))
 	}
 
-	if err := graph.AddEdge(e); err != nil {
+	if _, err := graph.AddEdge(e); err != nil {
 		t.Fatal(err)
 	}
-	if err := graph.AddEdge(e); err != nil {
+	if _, err := graph.AddEdge(e); err != nil {
 		t.Fatal(err)
 	}
 	if len(a.edges) != 1 || len(b.edges) != 1 {
@@ -177,10 +178,10 @@ func TestDuplicatedEdges(t *testing.T) {
 		points: [2]point{point{"a", 1}, point{"b", 1}},
 		weight: 2,
 	}
-	if err := graph.AddEdge(e); err != nil {
+	if _, err := graph.AddEdge(e); err != nil {
 		t.Fatal(err)
 	}
-	if err := graph.AddEdge(e); err != nil {
+	if _, err := graph.AddEdge(e); err != nil {
 		t.Fatal(err)
 	}
 
@@ -209,7 +210,7 @@ func TestMST0(t *testing.T) {
 	})
 
 	for _, v := range edges {
-		if err := graph.AddEdge(v); err != nil {
+		if _, err := graph.AddEdge(v); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -279,7 +280,7 @@ func TestMST1(t *testing.T) {
 	})
 
 	for _, v := range edges {
-		if err := graph.AddEdge(v); err != nil {
+		if _, err := graph.AddEdge(v); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -364,7 +365,7 @@ func TestMST2(t *testing.T) {
 	})
 
 	for _, v := range edges {
-		if err := graph.AddEdge(v); err != nil {
+		if _, err := graph.AddEdge(v); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -459,7 +460,7 @@ func TestMST3(t *testing.T) {
 	})
 
 	for _, v := range edges {
-		if err := graph.AddEdge(v); err != nil {
+		if _, err := graph.AddEdge(v); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -535,7 +536,7 @@ func TestMST4(t *testing.T) {
 	})
 
 	for _, v := range edges {
-		if err := graph.AddEdge(v); err != nil {
+		if _, err := graph.AddEdge(v); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -558,3 +559,60 @@ func TestMST4(t *testing.T) {
 		}
 	}
 }
+
+func TestFindShortestPath(t *testing.T) {
+	graph := New()
+	for i := 1; i <= 4; i++ {
+		graph.AddVertex(node{fmt.Sprintf("%v", i)})
+	}
+	edges := []link{
+		{points: [2]point{{"1", 1}, {"2", 1}}, weight: 1},
+		{points: [2]point{{"2", 2}, {"3", 1}}, weight: 1},
+		{points: [2]point{{"3", 2}, {"4", 1}}, weight: 1},
+		// Disabled by MST.
+		{points: [2]point{{"4", 2}, {"1", 2}}, weight: 2},
+		{points: [2]point{{"1", 3}, {"3", 3}}, weight: 5},
+	}
+	for _, v := range edges {
+		if _, err := graph.AddEdge(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	weight := func(p Point, e Edge) float64 { return e.Weight() }
+	path := graph.FindShortestPath(node{"1"}, node{"3"}, weight)
+	if len(path) != 2 || path[0].E.ID() != edges[0].ID() || path[1].E.ID() != edges[1].ID() {
+		t.Fatalf("Unexpected path: %+v", path)
+	}
+
+	// Expensive from 2 to 3, but not from 3 to 2.
+	directed := func(p Point, e Edge) float64 {
+		if p.ID() == "2:2" {
+			return 10
+		}
+		return e.Weight()
+	}
+	path = graph.FindShortestPath(node{"1"}, node{"3"}, directed)
+	if len(path) != 2 || path[0].E.ID() != edges[3].ID() || path[1].E.ID() != edges[2].ID() {
+		t.Fatalf("Unexpected path: %+v", path)
+	}
+	path = graph.FindShortestPath(node{"3"}, node{"1"}, directed)
+	if len(path) != 2 || path[0].E.ID() != edges[1].ID() || path[1].E.ID() != edges[0].ID() {
+		t.Fatalf("Unexpected path: %+v", path)
+	}
+
+	// Without the edges of 1.
+	excluded := func(p Point, e Edge) float64 {
+		if points := e.Points(); points[0].Vertex().ID() == "1" || points[1].Vertex().ID() == "1" {
+			return math.Inf(1)
+		}
+		return e.Weight()
+	}
+	if path := graph.FindShortestPath(node{"1"}, node{"3"}, excluded); len(path) != 0 {
+		t.Fatalf("Unexpected path over the excluded edges: %+v", path)
+	}
+
+	if path := graph.FindShortestPath(node{"1"}, node{"5"}, weight); len(path) != 0 {
+		t.Fatalf("Unexpected path to an unknown vertex: %+v", path)
+	}
+}
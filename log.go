@@ -0,0 +1,177 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/superkkt/go-logging"
+	"github.com/superkkt/viper"
+)
+
+const textLogFormat = `%{level}: %{shortpkg}.%{shortfunc}: %{message}`
+
+var (
+	// Modules whose levels have been set by default.log_modules. They follow
+	// default.log_level again once they are removed from the config file.
+	leveledModules = make(map[string]bool)
+	// key=value pairs in the log messages, e.g., deviceID=1 or mac=00:01:02:03:04:05.
+	logFieldPattern = regexp.MustCompile(`\b([A-Za-z][A-Za-z0-9_]*)=([^\s,()]+)`)
+)
+
+func initLog() error {
+	format := strings.ToLower(viper.GetString("default.log_format"))
+	if format != "" && format != "text" && format != "json" {
+		return errors.New("invalid default.log_format in the config file")
+	}
+
+	facility, err := parseFacility(viper.GetString("syslog.facility"))
+	if err != nil {
+		return errors.New("invalid syslog.facility in the config file")
+	}
+
+	var backend logging.Backend
+	var formatter logging.Formatter
+	switch strings.ToLower(viper.GetString("default.log_output")) {
+	case "", "syslog":
+		b, err := newSyslog(programName, facility, format != "json")
+		if err != nil {
+			return err
+		}
+		backend, formatter = b, logging.MustStringFormatter(textLogFormat)
+	case "remote":
+		b, err := newRemoteSyslog(viper.GetString("syslog.protocol"), viper.GetString("syslog.server"), viper.GetString("syslog.ca_file"), facility, programName)
+		if err != nil {
+			return fmt.Errorf("invalid syslog section in the config file: %v", err)
+		}
+		// The timestamp and the module are in the syslog header.
+		backend, formatter = b, logging.MustStringFormatter(textLogFormat)
+	case "stderr":
+		backend = logging.NewLogBackend(os.Stderr, "", 0)
+		formatter = logging.MustStringFormatter(`%{time:2006-01-02T15:04:05.000Z07:00} ` + textLogFormat)
+	default:
+		return errors.New("invalid default.log_output in the config file")
+	}
+	if format == "json" {
+		formatter = jsonFormatter{}
+	}
+
+	loggerLeveled = logging.AddModuleLevel(logging.NewBackendFormatter(backend, formatter))
+	setLogLevels()
+	logging.SetBackend(loggerLeveled)
+
+	return nil
+}
+
+// setLogLevels sets the log levels of all the modules and the specific ones
+// from the config file.
+func setLogLevels() {
+	level := getLogLevel(viper.GetString("default.log_level"))
+	// Set log level for all modules
+	loggerLeveled.SetLevel(level, "")
+
+	modules := viper.GetStringMapString("default.log_modules")
+	for m := range leveledModules {
+		if _, ok := modules[m]; !ok {
+			loggerLeveled.SetLevel(level, m)
+		}
+	}
+	for m, l := range modules {
+		loggerLeveled.SetLevel(getLogLevel(l), m)
+		leveledModules[m] = true
+	}
+}
+
+func getLogLevel(level string) logging.Level {
+	level = strings.ToUpper(level)
+	ret, err := logging.LogLevel(level)
+	if err != nil {
+		logger.Infof("invalid log level=%v, defaulting to %v..", level, defaultLogLevel)
+		return defaultLogLevel
+	}
+
+	return ret
+}
+
+// jsonFormatter formats a log record as a single line JSON object, which can be
+// shipped to the log collectors such as ELK without parsing. The key=value pairs
+// in the message are also extracted as its fields.
+type jsonFormatter struct{}
+
+type jsonRecord struct {
+	Time      string            `json:"time"`
+	Level     string            `json:"level"`
+	Module    string            `json:"module"`
+	Function  string            `json:"func,omitempty"`
+	Goroutine string            `json:"goroutine"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+func (r jsonFormatter) Format(calldepth int, record *logging.Record, w io.Writer) error {
+	v := jsonRecord{
+		Time:      record.Time.Format(time.RFC3339Nano),
+		Level:     record.Level.String(),
+		Module:    record.Module,
+		Goroutine: getGoRoutineID(),
+		Message:   record.Message(),
+		Fields:    logFields(record.Message()),
+	}
+	if pc, _, _, ok := runtime.Caller(calldepth + 1); ok {
+		if f := runtime.FuncForPC(pc); f != nil {
+			v.Function = f.Name()
+		}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+
+	return err
+}
+
+func logFields(msg string) map[string]string {
+	matches := logFieldPattern.FindAllStringSubmatch(msg, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	fields := make(map[string]string)
+	for _, v := range matches {
+		// Strip the trailing periods of the sentence, e.g., "..., inport=1, so ignore PACKET_IN..".
+		if value := strings.TrimRight(v[2], "."); value != "" {
+			fields[v[1]] = value
+		}
+	}
+
+	return fields
+}
@@ -23,20 +23,28 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/superkkt/cherry/cluster"
 	"github.com/superkkt/cherry/database"
-	"github.com/superkkt/cherry/election"
 	"github.com/superkkt/cherry/network"
 	"github.com/superkkt/cherry/northbound"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/rbac"
+	"github.com/superkkt/cherry/trace"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
@@ -55,6 +63,16 @@ var (
 	loggerLeveled     logging.LeveledBackend
 	showVersion       = flag.Bool("version", false, "Show program version and exit")
 	defaultConfigFile = flag.String("config", fmt.Sprintf("/usr/local/etc/%v.yaml", programName), "absolute path of the configuration file")
+	migrateDryRun     = flag.Bool("migrate-dry-run", false, "Show the pending database schema migrations and exit")
+	exportFile        = flag.String("export", "", "Export the controller state in the database to the JSON file and exit")
+	importFile        = flag.String("import", "", "Import the controller state from the JSON file into the empty database and exit")
+	checkConfigOnly   = flag.Bool("check-config", false, "Validate the configuration file, show the effective values and exit")
+	selfTestOnly      = flag.Bool("selftest", false, "Test the controller with the emulated switches on the memory database and exit")
+	replayFile        = flag.String("replay", "", "Replay the PACKET_INs recorded in the file with the emulated switches on the memory database and exit")
+	replaySpeed       = flag.Float64("replay-speed", 1, "Speed of the replay relative to the recording (0 replays the PACKET_INs without any delay)")
+	simulateFile      = flag.String("simulate", "", "Run the controller with the emulated switches and hosts of the topology in the YAML file on the memory database")
+	// listening is 1 while the OpenFlow port is listening.
+	listening int32
 )
 
 func main() {
@@ -64,43 +82,216 @@ func main() {
 		fmt.Printf("Version: %v\n", programVersion)
 		os.Exit(0)
 	}
+	if *checkConfigOnly {
+		os.Exit(checkConfig())
+	}
 
 	initConfig()
-	if err := initLog(getLogLevel(viper.GetString("default.log_level"))); err != nil {
+	if err := initLog(); err != nil {
 		logger.Fatalf("failed to init log: %v", err)
 	}
 
+	if err := initTracing(); err != nil {
+		logger.Fatalf("failed to init the tracing: %v", err)
+	}
+	if err := initAPIAuth(); err != nil {
+		logger.Fatalf("failed to init the API authentication: %v", err)
+	}
+
+	if *migrateDryRun {
+		showPendingMigrations()
+		os.Exit(0)
+	}
+	var sim *simulation
+	if *simulateFile != "" {
+		var err error
+		if sim, err = readSimulation(*simulateFile); err != nil {
+			logger.Fatalf("failed to read the simulation topology %v: %v", *simulateFile, err)
+		}
+	}
+	if *selfTestOnly || *replayFile != "" || sim != nil {
+		// Never touch the real database, and the switches connected to the
+		// controller already running on the same host.
+		port, err := freePort()
+		if err != nil {
+			logger.Fatalf("failed to find a free port: %v", err)
+		}
+		viper.Set("database.driver", "memory")
+		viper.Set("default.port", port)
+		// The emulated switches do not speak TLS.
+		viper.Set("default.tls", false)
+		viper.Set("default.listen", "")
+		viper.Set("default.client_ca_file", "")
+	}
+	if *replayFile != "" {
+		// A single worker processes the PACKET_INs in the recorded order.
+		viper.Set("default.packet_in_workers", 1)
+		// The latency probes would be counted as the PACKET_OUTs of the replay.
+		viper.Set("default.link_latency_interval", 0)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
-	db, err := database.NewMySQL()
+	db, err := database.Open()
 	if err != nil {
-		logger.Fatalf("failed to init MySQL database: %v", err)
+		logger.Fatalf("failed to init the database: %v", err)
+	}
+	if *replayFile != "" {
+		// The state exported from the production may be replayed together.
+		if *importFile != "" {
+			backup(db)
+		}
+	} else if *exportFile != "" || *importFile != "" {
+		backup(db)
+		os.Exit(0)
+	}
+	if sim != nil {
+		if err := sim.register(db); err != nil {
+			logger.Fatalf("failed to register the simulation topology: %v", err)
+		}
 	}
 
-	observer := initElectionObserver(ctx, db)
+	c, err := initCluster(ctx, db)
+	if err != nil {
+		logger.Fatalf("failed to init the cluster: %v", err)
+	}
 
 	controller := network.NewController(db)
-	manager, err := createAppManager(db)
+	if viper.IsSet("default.packet_in_workers") {
+		controller.SetPacketInWorkers(viper.GetInt("default.packet_in_workers"))
+	}
+	if viper.IsSet("default.write_flush_interval") || viper.IsSet("default.write_flush_threshold") {
+		interval, threshold := network.DefaultWriteFlushInterval, network.DefaultWriteFlushThreshold
+		if viper.IsSet("default.write_flush_interval") {
+			interval = time.Duration(viper.GetInt("default.write_flush_interval")) * time.Microsecond
+		}
+		if viper.IsSet("default.write_flush_threshold") {
+			threshold = viper.GetInt("default.write_flush_threshold")
+		}
+		controller.SetWriteBuffering(interval, threshold)
+	}
+	controller.SetPacketInRecordFile(viper.GetString("default.packet_in_record_file"))
+	if viper.IsSet("default.link_latency_interval") {
+		controller.SetLinkLatencyInterval(time.Duration(viper.GetInt("default.link_latency_interval")) * time.Second)
+	}
+	if viper.IsSet("default.port_stats_interval") {
+		controller.SetPortStatsInterval(time.Duration(viper.GetInt("default.port_stats_interval")) * time.Second)
+	}
+	if viper.IsSet("default.path_selection") {
+		v, err := network.ParsePathSelection(viper.GetString("default.path_selection"))
+		if err != nil {
+			logger.Fatalf("failed to set the path selection: %v", err)
+		}
+		controller.SetPathSelection(v)
+	}
+	if err := initRerouting(controller); err != nil {
+		logger.Fatalf("failed to init the rerouting: %v", err)
+	}
+	if err := initPacketSampling(controller); err != nil {
+		logger.Fatalf("failed to init the packet sampling: %v", err)
+	}
+	if err := initAdmission(controller); err != nil {
+		logger.Fatalf("failed to init the admission control: %v", err)
+	}
+	if err := initQuirks(controller); err != nil {
+		logger.Fatalf("failed to init the quirks of the switches: %v", err)
+	}
+	endpoints, err := parseEndpoints()
+	if err != nil {
+		logger.Fatalf("failed to parse the OpenFlow endpoints: %v", err)
+	}
+	tlsConfig, err := initOpenFlowTLS(controller, endpoints)
+	if err != nil {
+		logger.Fatalf("failed to init the TLS of the OpenFlow connections: %v", err)
+	}
+	manager, err := createAppManager(ctx, db, controller.Finder())
 	if err != nil {
 		logger.Fatalf("failed to create application manager: %v", err)
 	}
+	if err := initDryRun(controller, manager); err != nil {
+		logger.Fatalf("failed to init the dry run: %v", err)
+	}
 	manager.AddEventSender(controller)
-
+	go controller.RunMaintenance(ctx)
+	controller.SetCluster(c)
+	c.OnLeaderChange(controller.SetMaster)
+	controller.SetMaster(c.IsLeader())
+	controller.AddHealthCheck(func() map[string]error { return checkHealth(db, c) })
+	manager.AddHealthServer(controller)
+	manager.AddRESTServer(controller)
+
+	manager.SetReloader(func() error { return reloadConfig(manager) })
 	initSignalHandler(controller, manager, cancel)
+	if *selfTestOnly {
+		go func() { os.Exit(selfTest(ctx, viper.GetInt("default.port"), controller.Finder())) }()
+	}
+	if *replayFile != "" {
+		go func() {
+			os.Exit(replay(ctx, viper.GetInt("default.port"), *replayFile, *replaySpeed, controller.Finder()))
+		}()
+	}
+
+	if sim != nil {
+		go func() {
+			if err := sim.run(ctx, viper.GetInt("default.port"), controller.Finder()); err != nil {
+				logger.Fatalf("failed to run the simulation: %v", err)
+			}
+		}()
+	}
+
+	listen(ctx, endpoints, tlsConfig, controller)
+}
+
+func showPendingMigrations() {
+	pending, err := database.PendingMigrations()
+	if err != nil {
+		logger.Fatalf("failed to query the pending schema migrations: %v", err)
+	}
+	if len(pending) == 0 {
+		fmt.Printf("No pending schema migration: the latest version is %v\n", database.LatestSchemaVersion())
+		return
+	}
+	for _, v := range pending {
+		fmt.Printf("Pending schema migration %v: %v\n", v.Version, v.Description)
+	}
+}
+
+// backup exports or imports the controller state depending on the flags.
+func backup(db database.Database) {
+	if *exportFile != "" {
+		f, err := os.Create(*exportFile)
+		if err != nil {
+			logger.Fatalf("failed to create the export file: %v", err)
+		}
+		if err := database.Export(db, f); err != nil {
+			f.Close()
+			logger.Fatalf("failed to export the controller state: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			logger.Fatalf("failed to close the export file: %v", err)
+		}
+		fmt.Printf("Exported the controller state to %v\n", *exportFile)
+		return
+	}
 
-	listen(ctx, viper.GetInt("default.port"), controller, observer)
+	f, err := os.Open(*importFile)
+	if err != nil {
+		logger.Fatalf("failed to open the import file: %v", err)
+	}
+	defer f.Close()
+	if err := database.Import(db, f); err != nil {
+		logger.Fatalf("failed to import the controller state: %v", err)
+	}
+	fmt.Printf("Imported the controller state from %v\n", *importFile)
 }
 
 func initConfig() {
-	viper.SetConfigFile(*defaultConfigFile)
-	// Read the config file.
-	if err := viper.ReadInConfig(); err != nil {
+	if err := readConfig(); err != nil {
 		logger.Fatalf("failed to read the config file: %v", err)
 	}
 	// Watching and re-reading config file whenever it changes.
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		if loggerLeveled != nil {
-			// Set log level for all modules
-			loggerLeveled.SetLevel(getLogLevel(viper.GetString("default.log_level")), "")
+			setLogLevels()
 		}
 	})
 	viper.WatchConfig()
@@ -109,10 +300,69 @@ func initConfig() {
 	}
 }
 
+// readConfig reads the config file whose format, YAML or TOML, is determined by
+// its extension. The environment variables such as CHERRY_DATABASE_PASSWORD
+// override the values in the file.
+func readConfig() error {
+	viper.SetConfigFile(*defaultConfigFile)
+	viper.SetEnvPrefix(configEnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	return viper.ReadInConfig()
+}
+
+// checkConfig validates the config file and the applications in it, and then
+// prints the effective values. It returns the exit status of the program.
+func checkConfig() int {
+	if err := readConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read the config file: %v\n", err)
+		return 1
+	}
+	if err := validateConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", *defaultConfigFile, err)
+		return 1
+	}
+	apps, err := parseApplications()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", *defaultConfigFile, err)
+		return 1
+	}
+	if err := loadPlugins(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", *defaultConfigFile, err)
+		return 1
+	}
+	// The applications are not initialized, so that they do not need the database.
+	manager, err := northbound.NewManager(nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create application manager: %v\n", err)
+		return 1
+	}
+	if err := manager.Check(apps); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: invalid default.applications: %v\n", *defaultConfigFile, err)
+		return 1
+	}
+	if err := setScopes(manager); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", *defaultConfigFile, err)
+		return 1
+	}
+
+	printConfig()
+	fmt.Printf("%v: OK\n", *defaultConfigFile)
+
+	return 0
+}
+
 func validateConfig() error {
+	if err := validateSchema(); err != nil {
+		return err
+	}
 	if port := viper.GetInt("default.port"); port <= 0 || port > 0xFFFF {
 		return errors.New("invalid default.port")
 	}
+	if _, err := parseEndpoints(); err != nil {
+		return err
+	}
 	if len(viper.GetString("default.log_level")) == 0 {
 		return errors.New("invalid default.log_level")
 	}
@@ -122,20 +372,325 @@ func validateConfig() error {
 	if len(viper.GetString("default.admin_email")) == 0 {
 		return errors.New("invalid default.admin_email")
 	}
+	if viper.IsSet("default.packet_in_workers") {
+		if n := viper.GetInt("default.packet_in_workers"); n <= 0 || n > 1024 {
+			return errors.New("invalid default.packet_in_workers")
+		}
+	}
+	if viper.IsSet("default.write_flush_interval") {
+		if v := viper.GetInt("default.write_flush_interval"); v < 0 || v > 100000 {
+			return errors.New("invalid default.write_flush_interval")
+		}
+	}
+	if viper.IsSet("default.write_flush_threshold") {
+		if v := viper.GetInt("default.write_flush_threshold"); v <= 0 || v > 1024*1024 {
+			return errors.New("invalid default.write_flush_threshold")
+		}
+	}
+
+	return nil
+}
+
+func initRerouting(controller *network.Controller) error {
+	// Rerouting is disabled by default.
+	if !viper.IsSet("default.reroute_utilization") {
+		return nil
+	}
+	threshold := viper.GetFloat64("default.reroute_utilization")
+	if threshold < 0 || threshold > 1 {
+		return errors.New("invalid default.reroute_utilization in the config file")
+	}
+	intervals := network.DefaultRerouteIntervals
+	if viper.IsSet("default.reroute_intervals") {
+		intervals = viper.GetInt("default.reroute_intervals")
+	}
+	if intervals <= 0 {
+		return errors.New("invalid default.reroute_intervals in the config file")
+	}
+	controller.SetRerouting(threshold, intervals)
+
+	return nil
+}
+
+func initPacketSampling(controller *network.Controller) error {
+	// Sampling is disabled by default.
+	if !viper.IsSet("default.packet_sampling") {
+		return nil
+	}
+	fraction := viper.GetFloat64("default.packet_sampling")
+	if fraction < 0 || fraction > 1 {
+		return errors.New("invalid default.packet_sampling in the config file")
+	}
+	window := network.DefaultSampleWindow
+	if viper.IsSet("default.sample_window") {
+		window = time.Duration(viper.GetInt("default.sample_window")) * time.Millisecond
+	}
+	if window <= 0 {
+		return errors.New("invalid default.sample_window in the config file")
+	}
+	controller.SetPacketSampling(fraction, window)
+
+	return nil
+}
+
+func initDryRun(controller *network.Controller, manager *northbound.Manager) error {
+	apps := []string{}
+	for _, v := range strings.Split(strings.Replace(viper.GetString("default.dry_run_apps"), " ", "", -1), ",") {
+		if v == "" {
+			continue
+		}
+		if !manager.IsRegistered(v) {
+			return fmt.Errorf("unknown application in default.dry_run_apps: %v", v)
+		}
+		apps = append(apps, v)
+	}
+	enabled := viper.GetBool("default.dry_run")
+	if enabled || len(apps) > 0 {
+		logger.Warningf("the FLOW_MODs are not sent in the dry run: enabled=%v, apps=%v", enabled, apps)
+	}
+	controller.SetDryRun(enabled, apps)
+
+	return nil
+}
+
+func initAdmission(controller *network.Controller) error {
+	mode := network.AdmitAll
+	if viper.IsSet("default.switch_admission") {
+		var err error
+		if mode, err = network.ParseAdmission(viper.GetString("default.switch_admission")); err != nil {
+			return err
+		}
+	}
+	allowed := []uint64{}
+	if v := strings.Replace(viper.GetString("default.allowed_dpids"), " ", "", -1); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			dpid, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid DPID in default.allowed_dpids: %v", s)
+			}
+			allowed = append(allowed, dpid)
+		}
+	}
+	if mode == network.AdmitAllowed && len(allowed) == 0 {
+		return errors.New("empty default.allowed_dpids in the whitelist admission")
+	}
+	controller.SetAdmission(mode, allowed)
 
 	return nil
 }
 
-func initElectionObserver(ctx context.Context, db *database.MySQL) *election.Observer {
-	observer := election.New(db)
+func initQuirks(controller *network.Controller) error {
+	quirks := []network.Quirk{}
+	for name, spec := range viper.GetStringMapString("default.quirks") {
+		v, err := network.ParseQuirk(name, spec)
+		if err != nil {
+			return err
+		}
+		quirks = append(quirks, v)
+	}
+	controller.SetQuirks(quirks)
+
+	return nil
+}
+
+// initOpenFlowTLS returns the TLS config of the OpenFlow connections, or nil
+// if none of the endpoints is TLS.
+func initOpenFlowTLS(controller *network.Controller, endpoints []endpoint) (*tls.Config, error) {
+	caFile := viper.GetString("default.client_ca_file")
+	bindings := strings.Replace(viper.GetString("default.device_certificates"), " ", "", -1)
+	secure := false
+	for _, v := range endpoints {
+		secure = secure || v.tls
+	}
+	if !secure {
+		if caFile != "" {
+			return nil, errors.New("default.client_ca_file without any TLS endpoint")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(viper.GetString("default.cert_file"), viper.GetString("default.key_file"))
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caFile == "" {
+		if bindings != "" {
+			return nil, errors.New("default.device_certificates without default.client_ca_file")
+		}
+		return config, nil
+	}
+
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate in %v", caFile)
+	}
+	config.ClientCAs = cas
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	// Each binding is the common name of a certificate and its DPIDs.
+	certificates := make(map[string][]uint64)
+	for _, b := range strings.Split(bindings, ";") {
+		if b == "" {
+			continue
+		}
+		v := strings.Split(b, ",")
+		if len(v) < 2 || v[0] == "" {
+			return nil, fmt.Errorf("invalid binding in default.device_certificates: %v", b)
+		}
+		for _, s := range v[1:] {
+			dpid, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DPID in default.device_certificates: %v", s)
+			}
+			certificates[v[0]] = append(certificates[v[0]], dpid)
+		}
+	}
+	controller.SetDeviceCertificates(certificates)
+
+	return config, nil
+}
+
+func initTracing() error {
+	// Tracing is disabled by default.
+	if !viper.IsSet("tracing.sample_rate") {
+		return nil
+	}
+	rate := viper.GetFloat64("tracing.sample_rate")
+	if rate < 0 || rate > 1 {
+		return errors.New("invalid tracing.sample_rate in the config file")
+	}
+	trace.SetSampleRate(rate)
+
+	endpoint := viper.GetString("tracing.otlp_endpoint")
+	if endpoint == "" {
+		return nil
+	}
+	exporter, err := trace.NewOTLPExporter(endpoint, viper.GetBool("tracing.otlp_insecure"))
+	if err != nil {
+		return err
+	}
+	trace.AddExporter(exporter)
+
+	return nil
+}
+
+// initAPIAuth sets the RBAC policy of the REST and gRPC APIs. The APIs are open
+// to everyone if there is neither a token nor a client.
+func initAPIAuth() error {
+	policy, err := rbac.NewPolicy(viper.GetString("api.tokens"), viper.GetString("api.clients"), viper.GetString("api.client_ca_file"))
+	if err != nil {
+		return errors.Wrap(err, "invalid api section in the config file")
+	}
+	if !policy.Enabled() {
+		logger.Warning("the REST and gRPC APIs are open to everyone: set api.tokens or api.clients in the config file")
+	}
+	rbac.SetPolicy(policy)
+
+	return nil
+}
+
+// reloadConfig reads the config file again, and then applies the log levels,
+// the enabled applications and their settings that can be changed at runtime.
+func reloadConfig(manager *northbound.Manager) error {
+	logger.Infof("reloading the configuration from %v..", *defaultConfigFile)
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	setLogLevels()
+	if err := initAPIAuth(); err != nil {
+		return err
+	}
+
+	apps, err := parseApplications()
+	if err != nil {
+		return err
+	}
+	if err := manager.SetApplications(apps); err != nil {
+		return err
+	}
+	if err := setScopes(manager); err != nil {
+		return err
+	}
+	if err := manager.Reload(); err != nil {
+		return err
+	}
+	logger.Infof("reloaded the configuration")
+
+	return nil
+}
+
+func initCluster(ctx context.Context, db database.Database) (*cluster.Cluster, error) {
+	conf := cluster.Config{
+		Name:    viper.GetString("cluster.name"),
+		Address: viper.GetString("cluster.address"),
+	}
+	if conf.Name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		conf.Name = hostname
+	}
+	if viper.IsSet("cluster.election_timeout") {
+		v := viper.GetInt("cluster.election_timeout")
+		if v <= 0 || v > 60 {
+			return nil, errors.New("invalid cluster.election_timeout in the config file")
+		}
+		conf.Expiration = time.Duration(v) * time.Second
+	}
+	if viper.IsSet("cluster.replication_interval") {
+		v := viper.GetInt("cluster.replication_interval")
+		if v <= 0 || v > 600 {
+			return nil, errors.New("invalid cluster.replication_interval in the config file")
+		}
+		conf.ReplicationInterval = time.Duration(v) * time.Second
+	}
+	conf.Sharding = viper.GetBool("cluster.sharding")
+	conf.Assignments = make(map[uint64]string)
+	for k, v := range viper.GetStringMapString("cluster.assignments") {
+		dpid, err := strconv.ParseUint(k, 10, 64)
+		if err != nil || v == "" {
+			return nil, errors.New("invalid cluster.assignments in the config file")
+		}
+		conf.Assignments[dpid] = v
+	}
+
+	c := cluster.New(db, conf)
 	go func() {
-		if err := observer.Run(ctx); err != nil {
-			logger.Fatalf("failed to run the election observer: %v", err)
+		if err := c.Run(ctx); err != nil {
+			logger.Fatalf("failed to run the cluster: %v", err)
 		}
-		logger.Debugf("election observer terminated")
+		logger.Debugf("cluster terminated")
 	}()
 
-	return observer
+	return c, nil
+}
+
+// checkHealth checks the components of the controller that should work for it
+// to serve the switches.
+func checkHealth(db database.Database, c *cluster.Cluster) map[string]error {
+	result := map[string]error{
+		"database": db.Ping(),
+		"listener": nil,
+		"election": nil,
+	}
+	if atomic.LoadInt32(&listening) == 0 {
+		result["listener"] = errors.New("OpenFlow port is not listening")
+	}
+	// Only the leader serves the switches unless they are sharded.
+	if !c.IsSharded() && !c.IsLeader() {
+		result["election"] = errors.New("not the leader of the cluster")
+	}
+
+	return result
 }
 
 func initSignalHandler(controller *network.Controller, manager *northbound.Manager, cancel context.CancelFunc) {
@@ -151,10 +706,15 @@ func initSignalHandler(controller *network.Controller, manager *northbound.Manag
 				// Graceful shutdown
 				logger.Warning("Shutting down...")
 				cancel()
+				manager.Stop()
 				// Timeout for cancelation
 				time.Sleep(5 * time.Second)
 				os.Exit(0)
 			} else if s == syscall.SIGHUP {
+				if err := reloadConfig(manager); err != nil {
+					logger.Errorf("failed to reload the configuration: %v", err)
+				}
+			} else if s == syscall.SIGUSR1 {
 				fmt.Println("* Controller status:")
 				fmt.Println(controller.String())
 				fmt.Printf("\n* Manager status:\n")
@@ -164,47 +724,91 @@ func initSignalHandler(controller *network.Controller, manager *northbound.Manag
 	}()
 }
 
-func initLog(level logging.Level) error {
-	backend, err := newSyslog(programName)
-	if err != nil {
-		return err
-	}
-	backend = logging.NewBackendFormatter(backend, logging.MustStringFormatter(`%{level}: %{shortpkg}.%{shortfunc}: %{message}`))
-
-	loggerLeveled = logging.AddModuleLevel(backend)
-	// Set log level for all modules
-	loggerLeveled.SetLevel(level, "")
-	logging.SetBackend(loggerLeveled)
+// endpoint is an address that the switches connect to.
+type endpoint struct {
+	// network is tcp, tcp4 or tcp6.
+	network string
+	address string
+	tls     bool
+}
 
-	return nil
+func (r endpoint) String() string {
+	if r.tls {
+		return "tls://" + r.address
+	}
+	return r.address
 }
 
-func getLogLevel(level string) logging.Level {
-	level = strings.ToUpper(level)
-	ret, err := logging.LogLevel(level)
-	if err != nil {
-		logger.Infof("invalid log level=%v, defaulting to %v..", level, defaultLogLevel)
-		return defaultLogLevel
+// parseEndpoints returns the endpoints in default.listen, or the one on
+// default.port if it is empty.
+func parseEndpoints() ([]endpoint, error) {
+	listen := strings.Replace(viper.GetString("default.listen"), " ", "", -1)
+	if listen == "" {
+		return []endpoint{{network: "tcp", address: fmt.Sprintf(":%v", viper.GetInt("default.port")), tls: viper.GetBool("default.tls")}}, nil
 	}
 
-	return ret
+	result := []endpoint{}
+	for _, s := range strings.Split(listen, ",") {
+		e := endpoint{network: "tcp", address: s}
+		if strings.HasPrefix(s, "tls://") {
+			e.address, e.tls = strings.TrimPrefix(s, "tls://"), true
+		} else {
+			e.address = strings.TrimPrefix(s, "tcp://")
+		}
+		host, port, err := net.SplitHostPort(e.address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address in default.listen: %v", s)
+		}
+		if v, err := strconv.Atoi(port); err != nil || v <= 0 || v > 0xFFFF {
+			return nil, fmt.Errorf("invalid port in default.listen: %v", s)
+		}
+		// A literal address only listens on its own family, so that both
+		// 0.0.0.0 and [::] can listen on the same port.
+		if ip := net.ParseIP(host); ip != nil {
+			if ip.To4() != nil {
+				e.network = "tcp4"
+			} else {
+				e.network = "tcp6"
+			}
+		}
+		result = append(result, e)
+	}
+
+	return result, nil
 }
 
-func listen(ctx context.Context, port int, controller *network.Controller, observer *election.Observer) {
+// listen accepts the OpenFlow connections on the endpoints. tlsConfig should
+// not be nil if any of them is TLS.
+func listen(ctx context.Context, endpoints []endpoint, tlsConfig *tls.Config, controller *network.Controller) {
 	type KeepAliver interface {
 		SetKeepAlive(keepalive bool) error
 		SetKeepAlivePeriod(d time.Duration) error
 	}
+	type accepted struct {
+		conn net.Conn
+		tls  bool
+	}
 
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
-	if err != nil {
-		logger.Errorf("failed to listen on %v port: %v", port, err)
-		return
+	listeners := make([]net.Listener, 0, len(endpoints))
+	defer func() {
+		for _, v := range listeners {
+			v.Close()
+		}
+	}()
+	for _, e := range endpoints {
+		l, err := net.Listen(e.network, e.address)
+		if err != nil {
+			logger.Errorf("failed to listen on %v: %v", e, err)
+			return
+		}
+		logger.Infof("listening on %v", e)
+		listeners = append(listeners, l)
 	}
-	defer listener.Close()
+	atomic.StoreInt32(&listening, 1)
+	defer atomic.StoreInt32(&listening, 0)
 
 	// Connection dispatcher.
-	f := func(c chan<- net.Conn) {
+	f := func(listener net.Listener, secure bool, queue chan<- accepted) {
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
@@ -213,19 +817,16 @@ func listen(ctx context.Context, port int, controller *network.Controller, obser
 			}
 			logger.Infof("new device is connected from %v", conn.RemoteAddr())
 
-			// Only the master controller can serve the connections!
-			if observer.IsMaster() == false {
-				logger.Warningf("disconnecting the newly connected device (%v) because we are not the master controller!", conn.RemoteAddr())
-				conn.Close()
-				continue
-			}
-
-			// Pass the new connection into the backlog queue.
-			c <- conn
+			// Pass the new connection into the backlog queue. All the members of the
+			// cluster accept the connections: the devices of the others are held as
+			// slaves (OpenFlow 1.3) or disconnected (OpenFlow 1.0) by the controller.
+			queue <- accepted{conn, secure}
 		}
 	}
-	backlog := make(chan net.Conn, 32)
-	go f(backlog)
+	backlog := make(chan accepted, 32)
+	for i, v := range listeners {
+		go f(v, endpoints[i].tls, backlog)
+	}
 
 	// Infinite loop
 	for {
@@ -233,8 +834,9 @@ func listen(ctx context.Context, port int, controller *network.Controller, obser
 		case <-ctx.Done():
 			logger.Debug("terminating the main listener loop...")
 			return
-		case conn := <-backlog:
+		case v := <-backlog:
 			logger.Debug("fetching a new connection from the backlog..")
+			conn := v.conn
 			if v, ok := conn.(KeepAliver); ok {
 				logger.Debug("trying to enable socket keepalive..")
 				if err := v.SetKeepAlive(true); err == nil {
@@ -246,16 +848,24 @@ func listen(ctx context.Context, port int, controller *network.Controller, obser
 					logger.Errorf("failed to enable socket keepalive: %v", err)
 				}
 			}
+			if v.tls {
+				// The handshake is done by the first read of the session.
+				conn = tls.Server(conn, tlsConfig)
+			}
 			controller.AddConnection(ctx, conn)
 		}
 	}
 }
 
-func createAppManager(db *database.MySQL) (*northbound.Manager, error) {
+func createAppManager(ctx context.Context, db database.Database, finder network.Finder) (*northbound.Manager, error) {
+	if err := loadPlugins(); err != nil {
+		return nil, err
+	}
 	manager, err := northbound.NewManager(db)
 	if err != nil {
 		return nil, err
 	}
+	manager.SetServices(ctx, app.NewServices(finder))
 
 	apps, err := parseApplications()
 	if err != nil {
@@ -266,10 +876,36 @@ func createAppManager(db *database.MySQL) (*northbound.Manager, error) {
 			return nil, errors.Wrap(err, fmt.Sprintf("enabling %v", v))
 		}
 	}
+	if err := setScopes(manager); err != nil {
+		return nil, err
+	}
 
 	return manager, nil
 }
 
+// loadPlugins loads the Go plugins in default.plugins that register their applications.
+func loadPlugins() error {
+	v := strings.Replace(viper.GetString("default.plugins"), " ", "", -1)
+	if v == "" {
+		return nil
+	}
+
+	return northbound.LoadPlugins(strings.Split(v, ","))
+}
+
+// setScopes restricts the applications in default.application_scopes to their switches.
+func setScopes(manager *northbound.Manager) error {
+	scopes, err := northbound.ParseScopes(viper.GetStringMapString("default.application_scopes"))
+	if err != nil {
+		return errors.Wrap(err, "invalid default.application_scopes")
+	}
+	if err := manager.SetScopes(scopes); err != nil {
+		return errors.Wrap(err, "invalid default.application_scopes")
+	}
+
+	return nil
+}
+
 func parseApplications() ([]string, error) {
 	// Remove spaces, and then split it using comma
 	tokens := strings.Split(strings.Replace(viper.GetString("default.applications"), " ", "", -1), ",")
@@ -0,0 +1,308 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package metrics provides the counters, the gauges and the histograms that the
+// controller and its north-bound applications use to report their internal states.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	value uint64
+}
+
+func (r *Counter) Inc() {
+	atomic.AddUint64(&r.value, 1)
+}
+
+func (r *Counter) Add(n uint64) {
+	atomic.AddUint64(&r.value, n)
+}
+
+func (r *Counter) Value() uint64 {
+	return atomic.LoadUint64(&r.value)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits uint64
+}
+
+func (r *Gauge) Set(v float64) {
+	atomic.StoreUint64(&r.bits, math.Float64bits(v))
+}
+
+func (r *Gauge) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&r.bits)
+		new := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&r.bits, old, new) {
+			return
+		}
+	}
+}
+
+func (r *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&r.bits))
+}
+
+// Histogram counts the observed values in the buckets.
+type Histogram struct {
+	mutex  sync.Mutex
+	bounds []float64 // Upper bounds of the buckets in ascending order.
+	counts []uint64  // Non-cumulative count of each bucket.
+	sum    float64
+	count  uint64
+}
+
+func (r *Histogram) Observe(v float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Index of the first bucket whose upper bound is greater than or equal to v.
+	r.counts[sort.SearchFloat64s(r.bounds, v)]++
+	r.sum += v
+	r.count++
+}
+
+type Bucket struct {
+	UpperBound float64 `json:"upper_bound"`
+	// Cumulative count of the observed values that are less than or equal to UpperBound.
+	Count uint64 `json:"count"`
+}
+
+type HistogramValue struct {
+	// The last bucket whose upper bound is infinity is omitted. Count is its cumulative count.
+	Buckets []Bucket `json:"buckets"`
+	Sum     float64  `json:"sum"`
+	Count   uint64   `json:"count"`
+}
+
+func (r *Histogram) Value() HistogramValue {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v := HistogramValue{
+		Buckets: make([]Bucket, len(r.bounds)),
+		Sum:     r.sum,
+		Count:   r.count,
+	}
+	var cumulative uint64
+	for i, bound := range r.bounds {
+		cumulative += r.counts[i]
+		v.Buckets[i] = Bucket{UpperBound: bound, Count: cumulative}
+	}
+
+	return v
+}
+
+// GaugeFunc is a gauge whose value is obtained by calling its function when it is collected.
+type GaugeFunc struct {
+	f func() float64
+}
+
+func (r *GaugeFunc) Value() float64 {
+	return r.f()
+}
+
+// CounterVec is a set of the counters partitioned by the values of its labels.
+type CounterVec struct {
+	labels   []string
+	mutex    sync.Mutex
+	counters map[string]*labeledCounter
+}
+
+type labeledCounter struct {
+	values  []string
+	counter *Counter
+}
+
+// WithLabelValues returns the counter for the label values, which should be
+// in the same order as the label names of the vector. It panics if the number
+// of the values is different from the number of the labels.
+func (r *CounterVec) WithLabelValues(values ...string) *Counter {
+	if len(values) != len(r.labels) {
+		panic("invalid number of the label values")
+	}
+	key := strings.Join(values, "\xff")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.counters[key]
+	if !ok {
+		v = &labeledCounter{values: append([]string(nil), values...), counter: &Counter{}}
+		r.counters[key] = v
+	}
+
+	return v.counter
+}
+
+// LabeledValue is a value of a metric vector.
+type LabeledValue struct {
+	Labels map[string]string `json:"labels"`
+	Value  interface{}       `json:"value"`
+}
+
+func (r *CounterVec) Value() []LabeledValue {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	keys := make([]string, 0, len(r.counters))
+	for k := range r.counters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]LabeledValue, len(keys))
+	for i, k := range keys {
+		v := r.counters[k]
+		labels := make(map[string]string)
+		for j, name := range r.labels {
+			labels[name] = v.values[j]
+		}
+		result[i] = LabeledValue{Labels: labels, Value: v.counter.Value()}
+	}
+
+	return result
+}
+
+type metric struct {
+	name  string
+	help  string
+	t     Type
+	value interface{}
+}
+
+var (
+	mutex    sync.Mutex
+	registry = make(map[string]*metric)
+)
+
+func register(name, help string, t Type, value interface{}) interface{} {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// Return the registered one so that a metric can be declared in several places.
+	if v, ok := registry[name]; ok {
+		if v.t != t {
+			panic("metric " + name + " is already registered as a " + string(v.t))
+		}
+		return v.value
+	}
+	registry[name] = &metric{name: name, help: help, t: t, value: value}
+
+	return value
+}
+
+// NewCounter returns the counter whose name is name, and registers it if it is not registered yet.
+func NewCounter(name, help string) *Counter {
+	return register(name, help, TypeCounter, &Counter{}).(*Counter)
+}
+
+// NewGauge returns the gauge whose name is name, and registers it if it is not registered yet.
+func NewGauge(name, help string) *Gauge {
+	return register(name, help, TypeGauge, &Gauge{}).(*Gauge)
+}
+
+// NewGaugeFunc registers the gauge whose value is obtained by calling f, if it
+// is not registered yet. f should be safe for concurrent use.
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	return register(name, help, TypeGauge, &GaugeFunc{f: f}).(*GaugeFunc)
+}
+
+// NewCounterVec returns the counter vector whose name is name, and registers it
+// if it is not registered yet. labels are the names of the labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return register(name, help, TypeCounter, &CounterVec{
+		labels:   labels,
+		counters: make(map[string]*labeledCounter),
+	}).(*CounterVec)
+}
+
+// NewHistogram returns the histogram whose name is name, and registers it if
+// it is not registered yet. bounds are the upper bounds of the buckets.
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	b := make([]float64, len(bounds))
+	copy(b, bounds)
+	sort.Float64s(b)
+
+	return register(name, help, TypeHistogram, &Histogram{
+		bounds: b,
+		// The last one is the bucket whose upper bound is infinity.
+		counts: make([]uint64, len(b)+1),
+	}).(*Histogram)
+}
+
+// Metric is a snapshot of a registered metric.
+type Metric struct {
+	Name string `json:"name"`
+	Help string `json:"help"`
+	Type Type   `json:"type"`
+	// uint64 for a counter, float64 for a gauge, HistogramValue for a
+	// histogram, and []LabeledValue for a counter vector.
+	Value interface{} `json:"value"`
+}
+
+// All returns the snapshots of all the registered metrics sorted by their names.
+func All() []Metric {
+	mutex.Lock()
+	metrics := make([]*metric, 0, len(registry))
+	for _, v := range registry {
+		metrics = append(metrics, v)
+	}
+	mutex.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	result := make([]Metric, len(metrics))
+	for i, v := range metrics {
+		result[i] = Metric{Name: v.name, Help: v.help, Type: v.t}
+		switch m := v.value.(type) {
+		case *Counter:
+			result[i].Value = m.Value()
+		case *Gauge:
+			result[i].Value = m.Value()
+		case *GaugeFunc:
+			result[i].Value = m.Value()
+		case *CounterVec:
+			result[i].Value = m.Value()
+		case *Histogram:
+			result[i].Value = m.Value()
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,103 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WritePrometheus writes all the registered metrics to w in the Prometheus
+// text exposition format (version 0.0.4).
+func WritePrometheus(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	for _, m := range All() {
+		fmt.Fprintf(buf, "# HELP %v %v\n", m.Name, escapeHelp(m.Help))
+		fmt.Fprintf(buf, "# TYPE %v %v\n", m.Name, m.Type)
+
+		switch v := m.Value.(type) {
+		case uint64:
+			fmt.Fprintf(buf, "%v %v\n", m.Name, v)
+		case float64:
+			fmt.Fprintf(buf, "%v %v\n", m.Name, formatFloat(v))
+		case []LabeledValue:
+			for _, l := range v {
+				fmt.Fprintf(buf, "%v%v %v\n", m.Name, formatLabels(l.Labels), l.Value)
+			}
+		case HistogramValue:
+			for _, b := range v.Buckets {
+				fmt.Fprintf(buf, "%v_bucket{le=\"%v\"} %v\n", m.Name, formatFloat(b.UpperBound), b.Count)
+			}
+			fmt.Fprintf(buf, "%v_bucket{le=\"+Inf\"} %v\n", m.Name, v.Count)
+			fmt.Fprintf(buf, "%v_sum %v\n", m.Name, formatFloat(v.Sum))
+			fmt.Fprintf(buf, "%v_count %v\n", m.Name, v.Count)
+		}
+	}
+
+	return buf.Flush()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, k := range names {
+		pairs[i] = fmt.Sprintf("%v=\"%v\"", k, escapeLabel(labels[k]))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
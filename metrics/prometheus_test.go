@@ -0,0 +1,53 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	NewCounter("test_counter_total", "Test counter.").Add(3)
+	NewCounterVec("test_vec_total", "Test counter vector.", "dpid").WithLabelValues(`1"2`).Inc()
+	NewGaugeFunc("test_gauge", "Test\ngauge.", func() float64 { return 1.5 })
+	h := NewHistogram("test_seconds", "Test histogram.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(2)
+
+	buf := new(bytes.Buffer)
+	if err := WritePrometheus(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"# HELP test_counter_total Test counter.\n# TYPE test_counter_total counter\ntest_counter_total 3\n",
+		"test_vec_total{dpid=\"1\\\"2\"} 1\n",
+		"# HELP test_gauge Test\\ngauge.\n# TYPE test_gauge gauge\ntest_gauge 1.5\n",
+		"test_seconds_bucket{le=\"0.1\"} 1\ntest_seconds_bucket{le=\"1\"} 1\ntest_seconds_bucket{le=\"+Inf\"} 2\ntest_seconds_sum 2.05\ntest_seconds_count 2\n",
+	}
+	for _, v := range expected {
+		if !strings.Contains(buf.String(), v) {
+			t.Fatalf("missing %q in the output:\n%v", v, buf.String())
+		}
+	}
+}
@@ -0,0 +1,342 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Admission is how the devices are admitted to the network when they connect.
+type Admission int
+
+const (
+	// AdmitAll admits any device, which is the default.
+	AdmitAll Admission = iota
+	// AdmitAllowed only admits the devices whose DPIDs are allowed.
+	AdmitAllowed
+	// AdmitApproved admits the allowed devices and the ones registered in the
+	// database as the switches, which are approved by the REST API. The other
+	// devices are rejected, and then listed as pending.
+	AdmitApproved
+)
+
+// ParseAdmission parses open, whitelist or approval.
+func ParseAdmission(s string) (Admission, error) {
+	switch strings.ToLower(s) {
+	case "open":
+		return AdmitAll, nil
+	case "whitelist":
+		return AdmitAllowed, nil
+	case "approval":
+		return AdmitApproved, nil
+	default:
+		return 0, fmt.Errorf("invalid admission: %v", s)
+	}
+}
+
+func (r Admission) String() string {
+	switch r {
+	case AdmitAll:
+		return "open"
+	case AdmitAllowed:
+		return "whitelist"
+	case AdmitApproved:
+		return "approval"
+	default:
+		return fmt.Sprintf("Admission(%d)", int(r))
+	}
+}
+
+// Maximum number of the pending devices remembered. The least recently seen
+// one is forgotten when exceeded.
+const maxPendingDevices = 256
+
+var rejectedDevices = metrics.NewCounter("openflow_rejected_devices_total", "Number of the device connections rejected by the admission control.")
+
+// PendingDevice is a device rejected by the admission control, which waits for
+// the approval.
+type PendingDevice struct {
+	DPID uint64 `json:"dpid"`
+	// Remote address of the last connection.
+	Address   string    `json:"address"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Attempts  int       `json:"attempts"`
+}
+
+type admissionControl struct {
+	db database
+	// mode and allowed are set before the first connection.
+	mode    Admission
+	allowed map[uint64]bool
+	// certificates maps the common names of the device certificates to the
+	// DPIDs that they may claim. It is nil if the certificates are not bound
+	// to the DPIDs.
+	certificates map[string][]uint64
+
+	mutex   sync.Mutex
+	pending map[uint64]*PendingDevice
+}
+
+func newAdmissionControl(db database) *admissionControl {
+	return &admissionControl{
+		db:      db,
+		allowed: make(map[uint64]bool),
+		pending: make(map[uint64]*PendingDevice),
+	}
+}
+
+// admit returns whether the device of dpid connected from addr is admitted.
+func (r *admissionControl) admit(dpid uint64, addr net.Addr) (bool, error) {
+	if r.mode == AdmitAll || r.allowed[dpid] {
+		return true, nil
+	}
+	if r.mode == AdmitApproved {
+		_, ok, err := r.db.Switch(dpid)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			r.remove(dpid)
+			return true, nil
+		}
+	}
+	r.reject(dpid, addr)
+
+	return false, nil
+}
+
+// verify returns an error if the device connected over conn claims dpid that
+// is not bound to its certificate.
+func (r *admissionControl) verify(dpid uint64, conn net.Conn) error {
+	if r.certificates == nil {
+		return nil
+	}
+
+	c, ok := conn.(*tls.Conn)
+	if !ok {
+		rejectedDevices.Inc()
+		return errors.New("not a TLS connection")
+	}
+	certs := c.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		rejectedDevices.Inc()
+		return errors.New("no client certificate")
+	}
+	name := certs[0].Subject.CommonName
+	if bound, ok := r.certificates[name]; ok {
+		for _, v := range bound {
+			if v == dpid {
+				return nil
+			}
+		}
+	} else if v, err := strconv.ParseUint(name, 10, 64); err == nil && v == dpid {
+		return nil
+	}
+	rejectedDevices.Inc()
+
+	return fmt.Errorf("DPID %v is not bound to the certificate of %v", dpid, name)
+}
+
+func (r *admissionControl) reject(dpid uint64, addr net.Addr) {
+	rejectedDevices.Inc()
+	if r.mode != AdmitApproved {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	v, ok := r.pending[dpid]
+	if !ok {
+		if len(r.pending) >= maxPendingDevices {
+			r.evict()
+		}
+		v = &PendingDevice{DPID: dpid, FirstSeen: now}
+		r.pending[dpid] = v
+	}
+	v.Address = addr.String()
+	v.LastSeen = now
+	v.Attempts++
+}
+
+// evict forgets the least recently seen pending device. The caller should
+// lock the mutex.
+func (r *admissionControl) evict() {
+	var oldest *PendingDevice
+	for _, v := range r.pending {
+		if oldest == nil || v.LastSeen.Before(oldest.LastSeen) {
+			oldest = v
+		}
+	}
+	if oldest != nil {
+		delete(r.pending, oldest.DPID)
+	}
+}
+
+// remove forgets the pending device of dpid, and then returns whether it was
+// pending.
+func (r *admissionControl) remove(dpid uint64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, ok := r.pending[dpid]
+	delete(r.pending, dpid)
+
+	return ok
+}
+
+func (r *admissionControl) pendingDevices() []PendingDevice {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v := make([]PendingDevice, 0, len(r.pending))
+	for _, d := range r.pending {
+		v = append(v, *d)
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].DPID < v[j].DPID })
+
+	return v
+}
+
+// SetAdmission sets how the devices are admitted, and the DPIDs of the devices
+// that are always admitted. It should be called before adding the first
+// connection. Default is AdmitAll.
+func (r *Controller) SetAdmission(mode Admission, allowed []uint64) {
+	r.admission.mode = mode
+	for _, v := range allowed {
+		r.admission.allowed[v] = true
+	}
+}
+
+// SetDeviceCertificates binds the DPIDs to the common names of the client
+// certificates of the devices, which are keys of bindings, so that a device
+// only claims the DPIDs bound to its certificate. A common name not in
+// bindings is bound to the DPID in decimal that it is. The connections should
+// be TLS connections verifying the client certificates. It should be called
+// before adding the first connection.
+func (r *Controller) SetDeviceCertificates(bindings map[string][]uint64) {
+	r.admission.certificates = make(map[string][]uint64)
+	for k, v := range bindings {
+		r.admission.certificates[k] = v
+	}
+}
+
+func (r *Controller) showAdmission(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	allowed := make([]uint64, 0, len(r.admission.allowed))
+	for v := range r.admission.allowed {
+		allowed = append(allowed, v)
+	}
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i] < allowed[j] })
+
+	w.WriteJson(&struct {
+		Mode    string          `json:"mode"`
+		Allowed []uint64        `json:"allowed"`
+		Pending []PendingDevice `json:"pending"`
+	}{r.admission.mode.String(), allowed, r.admission.pendingDevices()})
+}
+
+// approveDevice registers the device in the database as a switch, so that it
+// is admitted when it connects again.
+func (r *Controller) approveDevice(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	dpid, err := strconv.ParseUint(req.PathParam("dpid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if r.admission.mode != AdmitApproved {
+		writeError(w, http.StatusConflict, fmt.Errorf("the devices are not approved in the %v admission", r.admission.mode))
+		return
+	}
+	// The body is optional.
+	sw := SwitchParam{Description: "approved by the admission control"}
+	if req.ContentLength > 0 {
+		if err := req.DecodeJsonPayload(&sw); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	sw.DPID = dpid
+	if err := sw.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, ok, err := r.db.Switch(dpid)
+	if err != nil {
+		logger.Errorf("failed to query database: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if ok {
+		writeError(w, http.StatusConflict, errors.New("already approved device"))
+		return
+	}
+	swID, err := r.db.AddSwitch(sw)
+	if err != nil {
+		logger.Errorf("failed to query database: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	r.admission.remove(dpid)
+	logger.Infof("approved the device whose DPID is %v", dpid)
+
+	w.WriteJson(&struct {
+		SwitchID uint64 `json:"switch_id"`
+	}{swID})
+}
+
+// forgetDevice removes the pending device, which is listed again when it
+// connects again.
+func (r *Controller) forgetDevice(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	dpid, err := strconv.ParseUint(req.PathParam("dpid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !r.admission.remove(dpid) {
+		writeError(w, http.StatusNotFound, errors.New("unknown pending device"))
+		return
+	}
+
+	w.WriteJson(&struct{}{})
+}
@@ -0,0 +1,233 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// aliasReloadInterval is how often the aliases are reloaded from the database,
+// so that the changes through the other members of the cluster are applied.
+const aliasReloadInterval = time.Minute
+
+// SwitchAlias is the human-readable name and the metadata of a switch, which
+// are shown with its DPID in the logs, the APIs and the UI.
+type SwitchAlias struct {
+	DPID uint64 `json:"dpid"`
+	Name string `json:"name"`
+	Site string `json:"site,omitempty"`
+	Rack string `json:"rack,omitempty"`
+	Role string `json:"role,omitempty"`
+}
+
+func (r *SwitchAlias) validate() error {
+	if r.Name == "" {
+		return errors.New("empty name")
+	}
+	// A name should never be mistaken for a DPID.
+	if _, err := strconv.ParseUint(r.Name, 10, 64); err == nil {
+		return errors.New("numeric name")
+	}
+	for _, v := range []string{r.Name, r.Site, r.Rack, r.Role} {
+		if len(v) > 64 {
+			return fmt.Errorf("too long value: %v", v)
+		}
+	}
+
+	return nil
+}
+
+type aliasRegistry struct {
+	db database
+
+	mutex   sync.Mutex
+	aliases map[uint64]SwitchAlias
+	loaded  time.Time
+}
+
+func newAliasRegistry(db database) *aliasRegistry {
+	return &aliasRegistry{
+		db:      db,
+		aliases: make(map[uint64]SwitchAlias),
+	}
+}
+
+// reload reloads the aliases from the database if they are older than
+// aliasReloadInterval. The caller should lock the mutex.
+func (r *aliasRegistry) reload() {
+	if time.Since(r.loaded) < aliasReloadInterval {
+		return
+	}
+	// Retry after the interval even if it fails.
+	r.loaded = time.Now()
+
+	aliases, err := r.db.SwitchAliases()
+	if err != nil {
+		logger.Errorf("failed to load the switch aliases: %v", err)
+		return
+	}
+	r.aliases = make(map[uint64]SwitchAlias)
+	for _, v := range aliases {
+		r.aliases[v.DPID] = v
+	}
+}
+
+func (r *aliasRegistry) lookup(dpid uint64) (SwitchAlias, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reload()
+	v, ok := r.aliases[dpid]
+
+	return v, ok
+}
+
+// label returns dpid followed by its alias name if any, e.g., 1 (leaf1).
+func (r *aliasRegistry) label(dpid uint64) string {
+	v, ok := r.lookup(dpid)
+	if !ok {
+		return strconv.FormatUint(dpid, 10)
+	}
+
+	return fmt.Sprintf("%v (%v)", dpid, v.Name)
+}
+
+// list returns the aliases sorted by their DPIDs.
+func (r *aliasRegistry) list() []SwitchAlias {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reload()
+	v := make([]SwitchAlias, 0, len(r.aliases))
+	for _, a := range r.aliases {
+		v = append(v, a)
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].DPID < v[j].DPID })
+
+	return v
+}
+
+// set stores alias into the database, and then into the registry. It returns
+// false without storing if its name is already used by another switch.
+func (r *aliasRegistry) set(alias SwitchAlias) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reload()
+	for _, v := range r.aliases {
+		if v.Name == alias.Name && v.DPID != alias.DPID {
+			return false, nil
+		}
+	}
+	if err := r.db.SetSwitchAlias(alias); err != nil {
+		return false, err
+	}
+	r.aliases[alias.DPID] = alias
+
+	return true, nil
+}
+
+func (r *aliasRegistry) remove(dpid uint64) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ok, err := r.db.RemoveSwitchAlias(dpid)
+	if err != nil {
+		return false, err
+	}
+	delete(r.aliases, dpid)
+
+	return ok, nil
+}
+
+func (r *Controller) listAlias(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.WriteJson(&struct {
+		Aliases []SwitchAlias `json:"aliases"`
+	}{r.aliases.list()})
+}
+
+func (r *Controller) setAlias(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	dpid, err := strconv.ParseUint(req.PathParam("dpid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	alias := SwitchAlias{}
+	if err := req.DecodeJsonPayload(&alias); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	alias.DPID = dpid
+	if err := alias.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ok, err := r.aliases.set(alias)
+	if err != nil {
+		logger.Errorf("failed to query database: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusConflict, errors.New("duplicated switch name"))
+		return
+	}
+	logger.Infof("set the alias of the switch whose DPID is %v: %+v", dpid, alias)
+
+	w.WriteJson(&alias)
+}
+
+func (r *Controller) removeAlias(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	dpid, err := strconv.ParseUint(req.PathParam("dpid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ok, err := r.aliases.remove(dpid)
+	if err != nil {
+		logger.Errorf("failed to query database: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown switch alias"))
+		return
+	}
+	logger.Infof("removed the alias of the switch whose DPID is %v", dpid)
+
+	w.WriteJson(&struct{}{})
+}
@@ -0,0 +1,93 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/superkkt/cherry/event"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/superkkt/go-logging"
+)
+
+// Maximum length of the request body recorded in an audit record.
+const maxAuditParams = 1024
+
+var auditLogger = logging.MustGetLogger("audit")
+
+// auditMiddleware records the REST API requests that change something,
+// including the denied ones. It should wrap rest.RecorderMiddleware, which
+// provides the status code, and authMiddleware, which provides the user name.
+type auditMiddleware struct{}
+
+func (r *auditMiddleware) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, req *rest.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+			handler(w, req)
+			return
+		}
+
+		params := ""
+		if req.Body != nil {
+			body, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			// Restore the body for the handler.
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			params = auditParams(body)
+		}
+
+		handler(w, req)
+
+		a := event.Audit{
+			Client: req.RemoteAddr,
+			Action: fmt.Sprintf("%v %v", req.Method, req.URL.Path),
+			Params: params,
+		}
+		if v, ok := req.Env["REMOTE_USER"].(string); ok {
+			a.User = v
+		}
+		if v, ok := req.Env["STATUS_CODE"].(int); ok {
+			a.Result = fmt.Sprintf("%v %v", v, http.StatusText(v))
+		}
+		auditLogger.Infof("%v", a)
+		event.RecordAudit(a)
+	}
+}
+
+func auditParams(body []byte) string {
+	// Remove the new lines so that a record is a line.
+	v := strings.Join(strings.Fields(string(body)), " ")
+	if len(v) > maxAuditParams {
+		v = v[:maxAuditParams] + "..."
+	}
+
+	return v
+}
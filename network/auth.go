@@ -0,0 +1,104 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/superkkt/cherry/rbac"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Path prefixes of the REST APIs whose changes require the admin role. The
+// other changes require the operator role, and reading requires the reader role.
+var adminPaths = []string{
+	"/api/v1/admission",
+	"/api/v1/alias",
+	"/api/v1/app",
+	"/api/v1/config",
+	"/api/v1/dryrun",
+	"/api/v1/log",
+	"/api/v1/maintenance",
+	"/api/v1/network",
+	"/api/v1/ovsdb",
+	"/api/v1/switch",
+}
+
+// authMiddleware authorizes the REST API requests by the current RBAC policy,
+// and then sets the name of the client to REMOTE_USER of the request environment.
+type authMiddleware struct{}
+
+func (r *authMiddleware) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, req *rest.Request) {
+		id, err := rbac.Current().Authorize(bearerToken(req), req.TLS, requiredRole(req.Method, req.URL.Path))
+		switch err {
+		case nil:
+		case rbac.ErrUnauthenticated:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cherry"`)
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		default:
+			logger.Infof("permission denied: client=%v, role=%v, method=%v, path=%v", id.Name, id.Role, req.Method, req.URL.Path)
+			req.Env["REMOTE_USER"] = id.Name
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		req.Env["REMOTE_USER"] = id.Name
+		handler(w, req)
+	}
+}
+
+func requiredRole(method, path string) rbac.Role {
+	// The preflight requests of the browsers do not have the credentials, and
+	// the web UI page has nothing but the scripts that call the REST APIs. The
+	// health checks are probed by the orchestrators and the load balancers.
+	if method == http.MethodOptions || path == "/ui" || path == "/healthz" || path == "/readyz" {
+		return rbac.RoleNone
+	}
+	// The profiles reveal the internals of the controller, and profiling slows it down.
+	if strings.HasPrefix(path, "/debug/pprof/") {
+		return rbac.RoleAdmin
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return rbac.RoleReader
+	}
+	for _, v := range adminPaths {
+		if path == v || strings.HasPrefix(path, v+"/") {
+			return rbac.RoleAdmin
+		}
+	}
+
+	return rbac.RoleOperator
+}
+
+// bearerToken returns the token in the Authorization header, or in the
+// access_token query parameter for the clients that cannot set the header, such
+// as the EventSource of the browsers.
+func bearerToken(req *rest.Request) string {
+	if v := req.Header.Get("Authorization"); len(v) > 7 && strings.EqualFold(v[:7], "Bearer ") {
+		return strings.TrimSpace(v[7:])
+	}
+
+	return req.URL.Query().Get("access_token")
+}
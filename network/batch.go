@@ -0,0 +1,91 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding"
+)
+
+// FlowBatch collects the messages, mostly the FLOW_MODs of a path, to be sent to
+// several devices. The messages to a device are sent at once followed by a single
+// barrier request, instead of a system call and a barrier per message.
+type FlowBatch struct {
+	// app is the name of the application that sends the messages, which is
+	// empty if it is the controller itself.
+	app      string
+	devices  []*Device
+	messages map[*Device][]encoding.BinaryMarshaler
+}
+
+func NewFlowBatch() *FlowBatch {
+	return &FlowBatch{
+		messages: make(map[*Device][]encoding.BinaryMarshaler),
+	}
+}
+
+// SetApp sets the name of the application that sends the messages, whose
+// FLOW_MODs are only recorded if the application is in the dry run.
+func (r *FlowBatch) SetApp(name string) {
+	r.app = name
+}
+
+// Add adds msg to be sent to d. The messages to the same device are sent in the
+// order they are added.
+func (r *FlowBatch) Add(d *Device, msg encoding.BinaryMarshaler) {
+	if msg == nil {
+		panic("Message is nil")
+	}
+
+	if _, ok := r.messages[d]; !ok {
+		r.devices = append(r.devices, d)
+	}
+	r.messages[d] = append(r.messages[d], msg)
+}
+
+// Len returns the number of the messages in the batch.
+func (r *FlowBatch) Len() int {
+	n := 0
+	for _, v := range r.messages {
+		n += len(v)
+	}
+
+	return n
+}
+
+// Commit sends the messages to all the devices in the order the devices are
+// added, and then empties the batch. The devices after a failed one are still
+// tried, and the first error is returned.
+func (r *FlowBatch) Commit() error {
+	var result error
+	for _, d := range r.devices {
+		if err := d.sendMessages(r.app, r.messages[d], true); err != nil {
+			logger.Errorf("failed to send the batched messages to %v: %v", d.ID(), err)
+			if result == nil {
+				result = err
+			}
+		}
+	}
+	r.devices = nil
+	r.messages = make(map[*Device][]encoding.BinaryMarshaler)
+
+	return result
+}
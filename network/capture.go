@@ -0,0 +1,273 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/superkkt/cherry/openflow/capture"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+const (
+	// Every connection records its stream until the DPID of the device is
+	// known, so that the handshake is also captured.
+	handshakeCaptureSize = 64 * 1024
+	defaultCaptureSize   = 4 * 1024 * 1024
+	maxCaptureSize       = 256 * 1024 * 1024
+)
+
+// captureRegistry has the control channel captures of the devices, which are
+// kept across the connections of the same device.
+type captureRegistry struct {
+	mutex    sync.Mutex
+	captures map[uint64]*deviceCapture
+}
+
+type deviceCapture struct {
+	ring    *capture.Ring
+	enabled bool
+}
+
+type CaptureInfo struct {
+	DPID    uint64 `json:"dpid"`
+	Enabled bool   `json:"enabled"`
+	Size    int    `json:"size"`   // Maximum bytes kept.
+	Length  int    `json:"length"` // Bytes kept now.
+}
+
+func newCaptureRegistry() *captureRegistry {
+	return &captureRegistry{captures: make(map[uint64]*deviceCapture)}
+}
+
+// ring returns the ring that the connections of the device should record to,
+// or nil if the capture is disabled.
+func (r *captureRegistry) ring(dpid uint64) *capture.Ring {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.captures[dpid]
+	if !ok || !v.enabled {
+		return nil
+	}
+
+	return v.ring
+}
+
+// enable starts capturing the device into a ring of size bytes. The current
+// ring is kept if it has the same size.
+func (r *captureRegistry) enable(dpid uint64, size int) *capture.Ring {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.captures[dpid]
+	if !ok || v.ring.Size() != size {
+		v = &deviceCapture{ring: capture.NewRing(size)}
+		r.captures[dpid] = v
+	}
+	v.enabled = true
+
+	return v.ring
+}
+
+// disable stops capturing the device, whose ring is kept to be downloaded.
+func (r *captureRegistry) disable(dpid uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if v, ok := r.captures[dpid]; ok {
+		v.enabled = false
+	}
+}
+
+func (r *captureRegistry) remove(dpid uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.captures, dpid)
+}
+
+func (r *captureRegistry) get(dpid uint64) (*capture.Ring, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.captures[dpid]
+	if !ok {
+		return nil, false
+	}
+
+	return v.ring, true
+}
+
+func (r *captureRegistry) info(dpid uint64) (CaptureInfo, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.captures[dpid]
+	if !ok {
+		return CaptureInfo{}, false
+	}
+
+	return CaptureInfo{DPID: dpid, Enabled: v.enabled, Size: v.ring.Size(), Length: v.ring.Len()}, true
+}
+
+func (r *captureRegistry) list() []CaptureInfo {
+	r.mutex.Lock()
+	dpids := make([]uint64, 0, len(r.captures))
+	for k := range r.captures {
+		dpids = append(dpids, k)
+	}
+	r.mutex.Unlock()
+	sort.Slice(dpids, func(i, j int) bool { return dpids[i] < dpids[j] })
+
+	result := make([]CaptureInfo, 0, len(dpids))
+	for _, v := range dpids {
+		if info, ok := r.info(v); ok {
+			result = append(result, info)
+		}
+	}
+
+	return result
+}
+
+func (r *Controller) listCapture(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.WriteJson(&struct {
+		Captures []CaptureInfo `json:"captures"`
+	}{r.captures.list()})
+}
+
+// captureDevice returns the DPID of the dpid path parameter, and the device if
+// it is connected to this controller. It forwards the request to the owner of
+// the device if the capture of the device is not found here.
+func (r *Controller) captureDevice(w rest.ResponseWriter, req *rest.Request) (uint64, *Device, bool) {
+	dpid, err := strconv.ParseUint(req.PathParam("dpid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return 0, nil, false
+	}
+	// Device ID is its DPID in decimal.
+	d := r.topo.Device(strconv.FormatUint(dpid, 10))
+	if d == nil {
+		if _, ok := r.captures.get(dpid); !ok && r.forwardToOwner(w, req, dpid) {
+			return 0, nil, false
+		}
+	}
+
+	return dpid, d, true
+}
+
+// toggleCapture starts or stops capturing the control channel of a device. The
+// device does not need to be connected, so that its next handshake is captured.
+func (r *Controller) toggleCapture(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	dpid, d, ok := r.captureDevice(w, req)
+	if !ok {
+		return
+	}
+	p := struct {
+		Enabled bool `json:"enabled"`
+		Size    int  `json:"size"` // In bytes.
+	}{}
+	if err := req.DecodeJsonPayload(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if p.Size == 0 {
+		p.Size = defaultCaptureSize
+	}
+	if p.Size < 0 || p.Size > maxCaptureSize {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("size should be between 1 and %v", maxCaptureSize))
+		return
+	}
+
+	if p.Enabled {
+		ring := r.captures.enable(dpid, p.Size)
+		if d != nil {
+			d.session.setCapture(ring)
+		}
+		logger.Infof("started capturing the control channel of %v", dpid)
+	} else {
+		r.captures.disable(dpid)
+		if d != nil {
+			d.session.setCapture(nil)
+		}
+		logger.Infof("stopped capturing the control channel of %v", dpid)
+	}
+
+	info, _ := r.captures.info(dpid)
+	w.WriteJson(&info)
+}
+
+// downloadCapture sends the control channel capture of a device as a pcap file.
+func (r *Controller) downloadCapture(w rest.ResponseWriter, req *rest.Request) {
+	dpid, _, ok := r.captureDevice(w, req)
+	if !ok {
+		return
+	}
+	ring, ok := r.captures.get(dpid)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown capture"))
+		return
+	}
+	writer, ok := w.(http.ResponseWriter)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("raw response is not supported"))
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=cherry-%v.pcap", dpid))
+	if _, err := ring.WriteTo(writer); err != nil {
+		logger.Debugf("failed to write the capture of %v: %v", dpid, err)
+	}
+}
+
+// removeCapture stops capturing a device, and then discards its capture.
+func (r *Controller) removeCapture(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	dpid, d, ok := r.captureDevice(w, req)
+	if !ok {
+		return
+	}
+	if _, ok := r.captures.get(dpid); !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown capture"))
+		return
+	}
+	r.captures.remove(dpid)
+	if d != nil {
+		d.session.setCapture(nil)
+	}
+	logger.Infof("removed the control channel capture of %v", dpid)
+
+	w.WriteJson(&struct{}{})
+}
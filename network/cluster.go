@@ -0,0 +1,85 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/superkkt/cherry/cluster"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// SetCluster sets the cluster of this controller, whose members are shown by
+// the REST API. The links of the topology are replicated to the members, so
+// that the next leader knows them before the LLDP probes come back.
+func (r *Controller) SetCluster(c *cluster.Cluster) {
+	r.cluster = c
+	c.Replicate("topology", &topologyReplica{r.topo})
+	c.OnRebalance(r.rebalance)
+}
+
+type topologyReplica struct {
+	topo *topology
+}
+
+type topologyState struct {
+	// Links are the pairs of the port IDs, e.g., 1:2 for the port 2 of the device 1.
+	Links [][2]string `json:"links"`
+}
+
+func (r *topologyReplica) Snapshot() ([]byte, error) {
+	state := topologyState{Links: [][2]string{}}
+	for _, v := range r.topo.Links() {
+		state.Links = append(state.Links, [2]string{v[0].ID(), v[1].ID()})
+	}
+
+	return json.Marshal(state)
+}
+
+func (r *topologyReplica) Restore(state []byte) error {
+	var v topologyState
+	if err := json.Unmarshal(state, &v); err != nil {
+		return err
+	}
+	r.topo.seedLinks(v.Links)
+
+	return nil
+}
+
+func (r *Controller) listCluster(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.cluster == nil {
+		writeError(w, http.StatusNotFound, errors.New("not clustered"))
+		return
+	}
+	leader, _ := r.cluster.Leader()
+
+	w.WriteJson(&struct {
+		Self    cluster.Member   `json:"self"`
+		Leader  cluster.Member   `json:"leader"`
+		Members []cluster.Member `json:"members"`
+	}{r.cluster.Self(), leader, r.cluster.Members()})
+}
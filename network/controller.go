@@ -23,14 +23,22 @@ package network
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/superkkt/cherry/cluster"
+	"github.com/superkkt/cherry/metrics"
 	"github.com/superkkt/cherry/openflow"
 	"github.com/superkkt/cherry/protocol"
+	"github.com/superkkt/cherry/rbac"
+	"github.com/superkkt/cherry/trace"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/superkkt/go-logging"
@@ -55,12 +63,18 @@ type database interface {
 	RemoveHost(id uint64) (ok bool, err error)
 	RemoveNetwork(id uint64) (ok bool, err error)
 	RemoveSwitch(id uint64) (ok bool, err error)
+	RemoveSwitchAlias(dpid uint64) (ok bool, err error)
 	RemoveVIP(id uint64) (ok bool, err error)
+	SetSwitchAlias(SwitchAlias) error
 	Switch(dpid uint64) (sw Switch, ok bool, err error)
+	SwitchAliases() ([]SwitchAlias, error)
 	Switches(limit, offset uint8) ([]Switch, error)
 	SwitchPorts(switchID uint64) ([]SwitchPort, error)
 	ToggleVIP(id uint64) (net.IP, net.HardwareAddr, error)
 	VIPs(limit, offset uint8) ([]VIP, error)
+	MaintenanceWindows() ([]MaintenanceWindow, error)
+	AddMaintenanceWindow(MaintenanceWindow) (id uint64, err error)
+	RemoveMaintenanceWindow(id uint64) (ok bool, err error)
 }
 
 type LocationStatus int
@@ -89,6 +103,11 @@ type ControllerEventListener interface {
 }
 
 type TopologyEventListener interface {
+	// OnLinkUp is called with the ports of a link among the devices discovered by LLDP.
+	OnLinkUp(Finder, [2]*Port) error
+	// OnLinkDown is called with the ports of a removed link, e.g., by a port down or a stale LLDP.
+	OnLinkDown(Finder, [2]*Port) error
+	// OnTopologyChange is called after OnLinkUp and OnLinkDown of the changed links.
 	OnTopologyChange(Finder) error
 }
 
@@ -96,21 +115,75 @@ type Controller struct {
 	topo     *topology
 	listener EventListener
 	db       database
+	cluster  *cluster.Cluster
+	// master is 1 while this controller is the master in the cluster.
+	master int32
+
+	sessionMutex sync.Mutex
+	// Value is the function that disconnects the session.
+	sessions map[*session]context.CancelFunc
+
+	healthMutex  sync.Mutex
+	healthChecks []HealthCheck
+
+	packetInWorkers int
+	packetInOnce    sync.Once
+	packetInPool    *packetInPool
+
+	writeFlushInterval  time.Duration
+	writeFlushThreshold int
+
+	linkLatencyInterval time.Duration
+	portStatsInterval   time.Duration
+	rerouteThreshold    float64
+	rerouteIntervals    int
+	sampleFraction      float64
+	sampleWindow        time.Duration
+
+	captures *captureRegistry
+	recorder *packetInRecorder
+	tracer   *pathTracer
+	dryRun   *dryRun
+	// admission and aliases are shared by the sessions.
+	admission   *admissionControl
+	aliases     *aliasRegistry
+	maintenance *maintenanceSchedule
+	// quirks are matched by the descriptions of the devices in order.
+	quirks []Quirk
 }
 
 func NewController(db database) *Controller {
 	v := &Controller{
-		topo: newTopology(db),
-		db:   db,
-	}
-	go v.serveREST()
+		topo:                newTopology(db),
+		db:                  db,
+		sessions:            make(map[*session]context.CancelFunc),
+		writeFlushInterval:  DefaultWriteFlushInterval,
+		writeFlushThreshold: DefaultWriteFlushThreshold,
+		linkLatencyInterval: DefaultLinkLatencyInterval,
+		portStatsInterval:   DefaultPortStatsInterval,
+		rerouteIntervals:    DefaultRerouteIntervals,
+		sampleWindow:        DefaultSampleWindow,
+		captures:            newCaptureRegistry(),
+		recorder:            new(packetInRecorder),
+		tracer:              newPathTracer(),
+		dryRun:              newDryRun(),
+		admission:           newAdmissionControl(db),
+		aliases:             newAliasRegistry(db),
+		quirks:              builtinQuirks,
+	}
+	v.maintenance = v.topo.maintenance
 
 	return v
 }
 
-func (r *Controller) serveREST() {
-	api := rest.NewApi()
-	router, err := rest.MakeRouter(
+// ServeREST starts the REST server in background. Additional routes, which are
+// provided by north-bound applications, will be served with the default ones.
+func (r *Controller) ServeREST(routes ...*rest.Route) {
+	go r.serveREST(routes)
+}
+
+func (r *Controller) serveREST(extra []*rest.Route) {
+	routes := []*rest.Route{
 		rest.Get("/api/v1/switch", r.listSwitch),
 		rest.Post("/api/v1/switch", r.addSwitch),
 		rest.Delete("/api/v1/switch/:id", r.removeSwitch),
@@ -130,18 +203,78 @@ func (r *Controller) serveREST() {
 		rest.Delete("/api/v1/vip/:id", r.removeVIP),
 		rest.Options("/api/v1/vip/:id", r.allowOrigin),
 		rest.Put("/api/v1/vip/:id", r.toggleVIP),
-	)
+		rest.Get("/api/v1/metrics", r.listMetrics),
+		rest.Get("/metrics", r.exportMetrics),
+		rest.Get("/api/v1/device", r.listDevice),
+		rest.Get("/api/v1/device/:dpid/port", r.listDevicePort),
+		rest.Get("/api/v1/device/:dpid/port/stats", r.listPortStats),
+		rest.Get("/api/v1/device/:dpid/flow", r.listFlow),
+		rest.Get("/api/v1/device/:dpid/flow/audit", r.auditFlows),
+		rest.Post("/api/v1/device/:dpid/flow/reconcile", r.reconcileFlows),
+		rest.Post("/api/v1/device/:dpid/port/:port/packet-in", r.injectPacketIn),
+		rest.Post("/api/v1/device/:dpid/port/:port/packet-out", r.sendPacketOut),
+		rest.Post("/api/v1/device/:dpid/port/:port/trace", r.tracePath),
+		rest.Get("/api/v1/device/:dpid/capture", r.downloadCapture),
+		rest.Put("/api/v1/device/:dpid/capture", r.toggleCapture),
+		rest.Delete("/api/v1/device/:dpid/capture", r.removeCapture),
+		rest.Get("/api/v1/capture", r.listCapture),
+		rest.Get("/api/v1/packetin/record", r.showRecord),
+		rest.Put("/api/v1/packetin/record", r.toggleRecord),
+		rest.Get("/api/v1/link", r.listLink),
+		rest.Delete("/api/v1/flow/:mac", r.flushFlows),
+		rest.Options("/api/v1/flow/:mac", r.allowOrigin),
+		rest.Get("/api/v1/events", r.streamEvents),
+		rest.Get("/api/v1/traces", r.listTrace),
+		rest.Get("/api/v1/log/:module", r.showLogLevel),
+		rest.Put("/api/v1/log/:module", r.setLogLevel),
+		rest.Options("/api/v1/log/:module", r.allowOrigin),
+		rest.Get("/ui", r.showUI),
+		rest.Get("/api/v1/cluster", r.listCluster),
+		rest.Get("/api/v1/admission", r.showAdmission),
+		rest.Post("/api/v1/admission/:dpid", r.approveDevice),
+		rest.Delete("/api/v1/admission/:dpid", r.forgetDevice),
+		rest.Options("/api/v1/admission/:dpid", r.allowOrigin),
+		rest.Get("/api/v1/alias", r.listAlias),
+		rest.Put("/api/v1/alias/:dpid", r.setAlias),
+		rest.Delete("/api/v1/alias/:dpid", r.removeAlias),
+		rest.Options("/api/v1/alias/:dpid", r.allowOrigin),
+		rest.Get("/api/v1/maintenance", r.listMaintenance),
+		rest.Post("/api/v1/maintenance", r.addMaintenance),
+		rest.Delete("/api/v1/maintenance/:id", r.removeMaintenance),
+		rest.Options("/api/v1/maintenance/:id", r.allowOrigin),
+		rest.Get("/api/v1/dryrun", r.showDryRun),
+		rest.Put("/api/v1/dryrun", r.setDryRun),
+		rest.Delete("/api/v1/dryrun", r.clearDryRun),
+		rest.Get("/healthz", r.showLiveness),
+		rest.Get("/readyz", r.showReadiness),
+	}
+	if viper.GetBool("rest.pprof") {
+		routes = append(routes, pprofRoutes()...)
+	}
+	routes = append(routes, extra...)
+
+	api := rest.NewApi()
+	// The audit records have the status codes and the user names from the inner middlewares.
+	api.Use(&auditMiddleware{}, &rest.RecorderMiddleware{}, &authMiddleware{})
+	router, err := rest.MakeRouter(routes...)
 	if err != nil {
 		logger.Errorf("failed to make a REST router: %v", err)
 		return
 	}
 	api.SetApp(router)
 
-	addr := fmt.Sprintf(":%v", viper.GetInt("rest.port"))
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%v", viper.GetInt("rest.port")),
+		Handler: api.MakeHandler(),
+	}
 	if viper.GetBool("rest.tls") {
-		err = http.ListenAndServeTLS(addr, viper.GetString("rest.cert_file"), viper.GetString("rest.key_file"), api.MakeHandler())
+		if cas := rbac.Current().ClientCAs(); cas != nil {
+			// The clients without a certificate can still use the tokens.
+			server.TLSConfig = &tls.Config{ClientCAs: cas, ClientAuth: tls.VerifyClientCertIfGiven}
+		}
+		err = server.ListenAndServeTLS(viper.GetString("rest.cert_file"), viper.GetString("rest.key_file"))
 	} else {
-		err = http.ListenAndServe(addr, api.MakeHandler())
+		err = server.ListenAndServe()
 	}
 
 	if err != nil {
@@ -155,6 +288,37 @@ func (r *Controller) allowOrigin(w rest.ResponseWriter, req *rest.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "DELETE, PUT")
 }
 
+func (r *Controller) listMetrics(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.WriteJson(&struct {
+		Metrics []metrics.Metric `json:"metrics"`
+	}{metrics.All()})
+}
+
+// exportMetrics writes the metrics in the Prometheus text format.
+func (r *Controller) exportMetrics(w rest.ResponseWriter, req *rest.Request) {
+	writer, ok := w.(http.ResponseWriter)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("raw response is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WritePrometheus(writer); err != nil {
+		logger.Errorf("failed to write the metrics: %v", err)
+	}
+}
+
+// listTrace shows the recently sampled traces of the PACKET_IN and FLOW_MOD processing.
+func (r *Controller) listTrace(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.WriteJson(&struct {
+		Traces []*trace.Span `json:"traces"`
+	}{trace.Recent()})
+}
+
 type SwitchParam struct {
 	DPID             uint64 `json:"dpid"`
 	NumPorts         uint16 `json:"n_ports"`
@@ -440,6 +604,9 @@ type HostParam struct {
 	IPID        uint64 `json:"ip_id"`
 	MAC         string `json:"mac"`
 	Description string `json:"description"`
+	// IPv6 addresses of the host, which are optional. The discovery finds the
+	// location of the host by them as well as its IPv4 address.
+	IPv6 []string `json:"ipv6,omitempty"`
 }
 
 func (r *HostParam) validate() error {
@@ -447,10 +614,27 @@ func (r *HostParam) validate() error {
 	if err != nil {
 		return err
 	}
+	if _, err := r.IPv6Addrs(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// IPv6Addrs returns the parsed IPv6 addresses of the host.
+func (r *HostParam) IPv6Addrs() ([]net.IP, error) {
+	result := make([]net.IP, 0, len(r.IPv6))
+	for _, v := range r.IPv6 {
+		ip := net.ParseIP(v)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid IPv6 address: %v", v)
+		}
+		result = append(result, ip)
+	}
+
+	return result, nil
+}
+
 type Host struct {
 	ID          string `json:"id"`
 	IP          string `json:"ip"`
@@ -729,15 +913,177 @@ func writeError(w rest.ResponseWriter, status int, err error) {
 	}{err.Error()})
 }
 
+// SetPacketInWorkers sets the number of the workers that process the PACKET_INs
+// of all the devices. It should be called before adding the first connection.
+// Default is DefaultPacketInWorkers.
+func (r *Controller) SetPacketInWorkers(n int) {
+	r.packetInWorkers = n
+}
+
+// SetWriteBuffering sets how the messages to each device are buffered: they
+// are written together interval after the first one, or as soon as threshold
+// bytes are buffered. Zero interval disables the buffering. It should be
+// called before adding the first connection. Defaults are
+// DefaultWriteFlushInterval and DefaultWriteFlushThreshold.
+func (r *Controller) SetWriteBuffering(interval time.Duration, threshold int) {
+	r.writeFlushInterval = interval
+	r.writeFlushThreshold = threshold
+}
+
+// SetLinkLatencyInterval sets how often the latency of the links is measured.
+// Zero disables the measurement. It should be called before adding the first
+// connection. Default is DefaultLinkLatencyInterval.
+func (r *Controller) SetLinkLatencyInterval(interval time.Duration) {
+	r.linkLatencyInterval = interval
+}
+
+// SetPortStatsInterval sets how often the port stats of the devices are polled
+// to calculate the traffic of the links. Zero disables the polling. It should
+// be called before adding the first connection. Default is
+// DefaultPortStatsInterval.
+func (r *Controller) SetPortStatsInterval(interval time.Duration) {
+	r.portStatsInterval = interval
+}
+
+// SetRerouting makes the largest flows of a link rerouted onto the alternate
+// paths when the utilization of the link exceeds threshold for intervals of
+// the port stats polling in a row. Zero threshold disables the rerouting,
+// which is the default. It should be called before adding the first
+// connection.
+func (r *Controller) SetRerouting(threshold float64, intervals int) {
+	r.rerouteThreshold = threshold
+	r.rerouteIntervals = intervals
+}
+
+// SetPacketSampling makes fraction (0 - 1) of the packets received from the
+// hosts sampled by the windows of the given duration, which are published by
+// EventPacketSampled. Zero fraction disables the sampling, which is the
+// default. It should be called before adding the first connection.
+func (r *Controller) SetPacketSampling(fraction float64, window time.Duration) {
+	r.sampleFraction = fraction
+	r.sampleWindow = window
+}
+
+// SetPathSelection sets how the paths among the devices are chosen. It should
+// be called before adding the first connection. Default is PathByHops.
+func (r *Controller) SetPathSelection(v PathSelection) {
+	r.topo.pathSelection = v
+}
+
+func (r *Controller) getPacketInPool() *packetInPool {
+	r.packetInOnce.Do(func() {
+		n := r.packetInWorkers
+		if n <= 0 {
+			n = DefaultPacketInWorkers
+		}
+		r.packetInPool = newPacketInPool(n)
+	})
+
+	return r.packetInPool
+}
+
 func (r *Controller) AddConnection(ctx context.Context, c net.Conn) {
 	conf := sessionConfig{
-		conn:     c,
-		watcher:  r.topo,
-		finder:   r.topo,
-		listener: r.listener,
+		conn:      c,
+		watcher:   r.topo,
+		finder:    r.topo,
+		listener:  r.listener,
+		isMaster:  r.isMaster,
+		isOwner:   r.isOwner,
+		workers:   r.getPacketInPool(),
+		captures:  r.captures,
+		recorder:  r.recorder,
+		tracer:    r.tracer,
+		dryRun:    r.dryRun,
+		admission: r.admission,
+		aliases:   r.aliases,
+		quirks:    r.quirks,
+
+		flushInterval:     r.writeFlushInterval,
+		flushThreshold:    r.writeFlushThreshold,
+		latencyInterval:   r.linkLatencyInterval,
+		portStatsInterval: r.portStatsInterval,
+		rerouteThreshold:  r.rerouteThreshold,
+		rerouteIntervals:  r.rerouteIntervals,
+		sampleFraction:    r.sampleFraction,
+		sampleWindow:      r.sampleWindow,
 	}
 	session := newSession(conf)
-	go session.Run(ctx)
+	connections.Inc()
+
+	ctx, cancel := context.WithCancel(ctx)
+	r.sessionMutex.Lock()
+	r.sessions[session] = cancel
+	r.sessionMutex.Unlock()
+
+	go func() {
+		session.Run(ctx)
+		cancel()
+
+		r.sessionMutex.Lock()
+		delete(r.sessions, session)
+		r.sessionMutex.Unlock()
+	}()
+}
+
+// SetMaster is called whenever this controller becomes the master in the
+// cluster or loses the mastership.
+func (r *Controller) SetMaster(master bool) {
+	if master {
+		atomic.StoreInt32(&r.master, 1)
+	} else {
+		atomic.StoreInt32(&r.master, 0)
+	}
+	r.rebalance()
+}
+
+// rebalance is called whenever the masters of the devices may have changed.
+// The OpenFlow 1.3 devices held as the slaves are promoted if this controller
+// has become their master, and the devices whose master is no longer this
+// controller are disconnected so that the applications stop controlling them.
+// The disconnected OpenFlow 1.3 devices reconnect to us, and then they are held
+// as the slaves.
+func (r *Controller) rebalance() {
+	r.sessionMutex.Lock()
+	defer r.sessionMutex.Unlock()
+
+	for s, cancel := range r.sessions {
+		go func(s *session, cancel context.CancelFunc) {
+			handover, err := s.rebalance()
+			if err != nil {
+				logger.Errorf("failed to promote to the master of the device: %v", err)
+				return
+			}
+			if handover {
+				logger.Warningf("disconnecting the device because we are no longer its master controller (DPID=%v)", s.device.Label())
+				cancel()
+			}
+		}(s, cancel)
+	}
+}
+
+// isMaster returns whether this controller is the master of all the devices,
+// which is the leader of the cluster that does not shard the devices.
+func (r *Controller) isMaster() bool {
+	if r.cluster != nil && r.cluster.IsSharded() {
+		return false
+	}
+
+	return atomic.LoadInt32(&r.master) == 1
+}
+
+// isOwner returns whether this controller is the master of the device whose DPID is dpid.
+func (r *Controller) isOwner(dpid uint64) bool {
+	if r.cluster != nil && r.cluster.IsSharded() {
+		return r.cluster.IsOwner(dpid)
+	}
+
+	return atomic.LoadInt32(&r.master) == 1
+}
+
+// Finder returns the topology of the network discovered by the controller.
+func (r *Controller) Finder() Finder {
+	return r.topo
 }
 
 func (r *Controller) SetEventListener(l EventListener) {
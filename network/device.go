@@ -26,7 +26,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/superkkt/cherry/openflow"
 	"github.com/superkkt/cherry/openflow/transceiver"
@@ -34,11 +37,11 @@ import (
 )
 
 type Descriptions struct {
-	Manufacturer string
-	Hardware     string
-	Software     string
-	Serial       string
-	Description  string
+	Manufacturer string `json:"manufacturer"`
+	Hardware     string `json:"hardware"`
+	Software     string `json:"software"`
+	Serial       string `json:"serial"`
+	Description  string `json:"description"`
 }
 
 type Features struct {
@@ -48,15 +51,30 @@ type Features struct {
 }
 
 type Device struct {
+	// The ID and the ports are read by every PACKET_IN, so they are read
+	// without the mutex that may be held while sending messages.
+	id    atomic.Value // string
+	ports atomic.Value // map[uint32]*Port, replaced as a whole when a port is added.
+
 	mutex        sync.RWMutex
-	id           string
 	session      *session
 	descriptions Descriptions
 	features     Features
-	ports        map[uint32]*Port
 	flowTableID  uint8 // Table IDs that we install flows
+	quirk        Quirk
 	factory      openflow.Factory
 	closed       bool
+	handedOver   bool
+	installed    *installCache
+	ledger       *flowLedger
+	// Pending stats requests. Key = Transaction ID.
+	stats map[uint32]*statsRequest
+}
+
+type statsRequest struct {
+	flows []openflow.FlowStats
+	ports []openflow.PortStats
+	done  chan struct{}
 }
 
 var (
@@ -68,10 +86,16 @@ func newDevice(s *session) *Device {
 		panic("Session is nil")
 	}
 
-	return &Device{
-		session: s,
-		ports:   make(map[uint32]*Port),
+	v := &Device{
+		session:   s,
+		stats:     make(map[uint32]*statsRequest),
+		installed: newInstallCache(),
+		ledger:    newFlowLedger(),
 	}
+	v.id.Store("")
+	v.ports.Store(make(map[uint32]*Port))
+
+	return v
 }
 
 func (r *Device) String() string {
@@ -79,8 +103,9 @@ func (r *Device) String() string {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	v := fmt.Sprintf("Device ID=%v, Descriptions=%+v, Features=%+v, # of ports=%v, FlowTableID=%v, Connected=%v\n", r.id, r.descriptions, r.features, len(r.ports), r.flowTableID, !r.closed)
-	for _, p := range r.ports {
+	ports := r.portMap()
+	v := fmt.Sprintf("Device ID=%v, Descriptions=%+v, Features=%+v, # of ports=%v, FlowTableID=%v, Connected=%v\n", r.ID(), r.descriptions, r.features, len(ports), r.flowTableID, !r.closed)
+	for _, p := range ports {
 		v += fmt.Sprintf("\t%v\n", p.String())
 	}
 
@@ -88,27 +113,36 @@ func (r *Device) String() string {
 }
 
 func (r *Device) ID() string {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+	return r.id.Load().(string)
+}
 
-	return r.id
+// Alias returns the alias of the device, and whether it has one.
+func (r *Device) Alias() (SwitchAlias, bool) {
+	dpid, err := strconv.ParseUint(r.ID(), 10, 64)
+	if err != nil {
+		return SwitchAlias{}, false
+	}
+
+	return r.session.aliases.lookup(dpid)
 }
 
-func (r *Device) setID(id string) {
-	// Write lock
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+// Label returns the ID of the device followed by its alias name if any, e.g.,
+// 1 (leaf1), which is shown in the logs.
+func (r *Device) Label() string {
+	v, ok := r.Alias()
+	if !ok {
+		return r.ID()
+	}
 
-	r.id = id
+	return fmt.Sprintf("%v (%v)", r.ID(), v.Name)
 }
 
-func (r *Device) isValid() bool {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+func (r *Device) setID(id string) {
+	r.id.Store(id)
+}
 
-	return len(r.id) > 0
+func (r *Device) isValid() bool {
+	return len(r.ID()) > 0
 }
 
 func (r *Device) Factory() openflow.Factory {
@@ -154,6 +188,24 @@ func (r *Device) setDescriptions(d Descriptions) {
 	r.descriptions = d
 }
 
+// Quirk returns the quirk of the device model, which is the zero Quirk if none
+// or if the descriptions have not been received yet.
+func (r *Device) Quirk() Quirk {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.quirk
+}
+
+func (r *Device) setQuirk(q Quirk) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.quirk = q
+}
+
 func (r *Device) Features() Features {
 	// Read lock
 	r.mutex.RLock()
@@ -170,22 +222,19 @@ func (r *Device) setFeatures(f Features) {
 	r.features = f
 }
 
+func (r *Device) portMap() map[uint32]*Port {
+	return r.ports.Load().(map[uint32]*Port)
+}
+
 // Port may return nil if there is no port whose number is num
 func (r *Device) Port(num uint32) *Port {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
-	return r.ports[num]
+	return r.portMap()[num]
 }
 
 func (r *Device) Ports() []*Port {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
-	p := make([]*Port, 0)
-	for _, v := range r.ports {
+	ports := r.portMap()
+	p := make([]*Port, 0, len(ports))
+	for _, v := range ports {
 		p = append(p, v)
 	}
 
@@ -200,16 +249,23 @@ func (r *Device) setPort(num uint32, p openflow.Port) {
 	if p == nil {
 		panic("Port is nil")
 	}
-	logger.Debugf("Device=%v, PortNum=%v, AdminUp=%v, LinkUp=%v", r.id, p.Number(), !p.IsPortDown(), !p.IsLinkDown())
+	logger.Debugf("Device=%v, PortNum=%v, AdminUp=%v, LinkUp=%v", r.ID(), p.Number(), !p.IsPortDown(), !p.IsLinkDown())
 
-	port, ok := r.ports[num]
-	if ok {
+	ports := r.portMap()
+	if port, ok := ports[num]; ok {
 		port.SetValue(p)
-	} else {
-		v := NewPort(r, num)
-		v.SetValue(p)
-		r.ports[num] = v
+		return
+	}
+
+	// The readers may be iterating the current map.
+	v := NewPort(r, num)
+	v.SetValue(p)
+	m := make(map[uint32]*Port, len(ports)+1)
+	for k, port := range ports {
+		m[k] = port
 	}
+	m[num] = v
+	r.ports.Store(m)
 }
 
 func (r *Device) FlowTableID() uint8 {
@@ -229,6 +285,22 @@ func (r *Device) setFlowTableID(id uint8) {
 }
 
 func (r *Device) SendMessage(msg encoding.BinaryMarshaler) error {
+	return r.sendMessage("", msg)
+}
+
+// SendFlow is SendMessage for the messages of the application named app, whose
+// FLOW_MODs are only recorded, instead of being sent, if app is in the dry run.
+func (r *Device) SendFlow(app string, msg encoding.BinaryMarshaler) error {
+	return r.sendMessage(app, msg)
+}
+
+// IsDryRun returns whether the FLOW_MODs sent by app through SendFlow or a
+// FlowBatch are only recorded instead of being installed on the device.
+func (r *Device) IsDryRun(app string) bool {
+	return r.session.dryRun.covers(app)
+}
+
+func (r *Device) sendMessage(app string, msg encoding.BinaryMarshaler) error {
 	// Write lock
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -239,10 +311,75 @@ func (r *Device) SendMessage(msg encoding.BinaryMarshaler) error {
 	if r.closed {
 		return ErrClosedDevice
 	}
+	if r.session.dryRun.intercept(r.features, app, msg) {
+		return nil
+	}
+	if r.installed.suppress(msg) {
+		logger.Debugf("skipping the FLOW_MOD that adds the flow just added to %v", r.ID())
+		return nil
+	}
 
 	return r.session.Write(msg)
 }
 
+// SendMessages sends msgs followed by a barrier request at once, so that the
+// messages are processed by the device before any message sent after them. The
+// barrier request is omitted if the quirk of the device has NoBarrier.
+func (r *Device) SendMessages(msgs ...encoding.BinaryMarshaler) error {
+	return r.sendMessages("", msgs, true)
+}
+
+// sendMessages is SendMessages for the messages of the application named app,
+// which is empty if they are sent by the controller itself. The FLOW_MODs are
+// sent even in the dry run if dryRun is false, e.g., the flows that make the
+// switch send the traffic to the controller.
+func (r *Device) sendMessages(app string, msgs []encoding.BinaryMarshaler, dryRun bool) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	batch := make([]encoding.BinaryMarshaler, 0, len(msgs)+1)
+	for _, v := range msgs {
+		if v == nil {
+			panic("Message is nil")
+		}
+		if dryRun && r.session.dryRun.intercept(r.features, app, v) {
+			continue
+		}
+		if r.installed.suppress(v) {
+			logger.Debugf("skipping the FLOW_MOD that adds the flow just added to %v", r.ID())
+			continue
+		}
+		batch = append(batch, v)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if r.quirk.NoBarrier {
+		return r.session.WriteBatch(batch)
+	}
+	barrier, err := r.factory.NewBarrierRequest()
+	if err != nil {
+		return err
+	}
+
+	return r.session.WriteBatch(append(batch, barrier))
+}
+
+// forgetInstalledFlows makes the next FLOW_MODs adding the flows that have
+// been recently added be sent again, e.g., after the flows are removed.
+func (r *Device) forgetInstalledFlows() {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.installed.reset()
+}
+
 func (r *Device) IsClosed() bool {
 	// Read lock
 	r.mutex.RLock()
@@ -278,8 +415,11 @@ func (r *Device) RemoveAllFlows() error {
 	flowmod.SetTableID(0xFF) // ALL
 	flowmod.SetFlowMatch(match)
 	flowmod.SetOutPort(port)
-	if err := r.session.Write(flowmod); err != nil {
-		return err
+	r.installed.reset()
+	if !r.session.dryRun.intercept(r.features, "", flowmod) {
+		if err := r.session.Write(flowmod); err != nil {
+			return err
+		}
 	}
 
 	return setARPSender(r.factory, r.session.transceiver)
@@ -303,6 +443,10 @@ func (r *Device) RemoveFlow(match openflow.Match, port openflow.OutPort) error {
 	flowmod.SetTableID(0xFF) // ALL
 	flowmod.SetFlowMatch(match)
 	flowmod.SetOutPort(port)
+	r.installed.reset()
+	if r.session.dryRun.intercept(r.features, "", flowmod) {
+		return nil
+	}
 
 	return r.session.Write(flowmod)
 }
@@ -334,6 +478,10 @@ func (r *Device) RemoveFlowByMAC(mac net.HardwareAddr) error {
 	flowmod.SetTableID(0xFF) // ALL
 	flowmod.SetFlowMatch(match)
 	flowmod.SetOutPort(port)
+	r.installed.reset()
+	if r.session.dryRun.intercept(r.features, "", flowmod) {
+		return nil
+	}
 
 	return r.session.Write(flowmod)
 }
@@ -371,7 +519,10 @@ func (r *Device) SendARPAnnouncement(ip net.IP, mac net.HardwareAddr) error {
 	return r.flood(nil, announcement)
 }
 
-func (r *Device) SendARPProbe(sha net.HardwareAddr, tpa net.IP) error {
+// SendARPProbe sends an ARP request for tpa to the egress ports, or floods it
+// if egress is nil. spa can be nil, then the request is an ARP probe whose SPA
+// is all-zero.
+func (r *Device) SendARPProbe(sha net.HardwareAddr, spa, tpa net.IP, egress []*Port) error {
 	// Write lock
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -380,12 +531,12 @@ func (r *Device) SendARPProbe(sha net.HardwareAddr, tpa net.IP) error {
 		return ErrClosedDevice
 	}
 
-	probe, err := makeARPProbe(sha, tpa)
+	probe, err := makeARPProbe(sha, spa, tpa)
 	if err != nil {
 		return err
 	}
 
-	return r.flood(nil, probe)
+	return r.sendProbe(probe, egress)
 }
 
 // https://en.wikipedia.org/wiki/Address_Resolution_Protocol#ARP_probe
@@ -395,8 +546,14 @@ func (r *Device) SendARPProbe(sha net.HardwareAddr, tpa net.IP) error {
 // Before beginning to use an IPv4 address (whether received from manual configuration,
 // DHCP, or some other means), a host implementing this specification must test to see
 // if the address is already in use, by broadcasting ARP probe packets.
-func makeARPProbe(sha net.HardwareAddr, tpa net.IP) ([]byte, error) {
-	arp := protocol.NewARPRequest(sha, net.IPv4(0, 0, 0, 0), tpa)
+//
+// Some routers do not answer an ARP probe because of their ACLs on the ARP
+// sources, so spa can be specified to send a normal ARP request instead.
+func makeARPProbe(sha net.HardwareAddr, spa, tpa net.IP) ([]byte, error) {
+	if spa == nil {
+		spa = net.IPv4(0, 0, 0, 0)
+	}
+	arp := protocol.NewARPRequest(sha, spa, tpa)
 	probe, err := arp.MarshalBinary()
 	if err != nil {
 		return nil, err
@@ -411,6 +568,69 @@ func makeARPProbe(sha net.HardwareAddr, tpa net.IP) ([]byte, error) {
 	return eth.MarshalBinary()
 }
 
+// SendNSProbe sends an IPv6 neighbor solicitation for target to the egress
+// ports, or floods it if egress is nil, so that the target replies to sha. src
+// can be nil, then the link-local address made from sha is used as the source
+// address.
+func (r *Device) SendNSProbe(sha net.HardwareAddr, src, target net.IP, egress []*Port) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	probe, err := makeNSProbe(sha, src, target)
+	if err != nil {
+		return err
+	}
+
+	return r.sendProbe(probe, egress)
+}
+
+func (r *Device) sendProbe(probe []byte, egress []*Port) error {
+	if egress == nil {
+		return r.flood(nil, probe)
+	}
+	for _, port := range egress {
+		if err := r.output(port, probe); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func makeNSProbe(sha net.HardwareAddr, src, target net.IP) ([]byte, error) {
+	if src == nil {
+		src = protocol.LinkLocalAddress(sha)
+	}
+	dst, dstMAC := protocol.SolicitedNodeAddress(target)
+
+	ns := protocol.NewNeighborSolicitation(target, sha)
+	ns.SetPseudoHeader(src, dst)
+	payload, err := ns.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	ip := protocol.NewIPv6(src, dst, 58, payload)
+	// Neighbor discovery messages should have 255 hop limit.
+	ip.HopLimit = 255
+	packet, err := ip.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	eth := protocol.Ethernet{
+		SrcMAC:  sha,
+		DstMAC:  dstMAC,
+		Type:    0x86DD,
+		Payload: packet,
+	}
+
+	return eth.MarshalBinary()
+}
+
 // Flood broadcasts the packet to all ports of this device, except the ingress port if ingress is not nil.
 func (r *Device) Flood(ingress *Port, packet []byte) error {
 	// Write lock
@@ -424,6 +644,97 @@ func (r *Device) Flood(ingress *Port, packet []byte) error {
 	return r.flood(ingress, packet)
 }
 
+// Output sends the packet out to the egress port of this device.
+func (r *Device) Output(egress *Port, packet []byte) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	return r.output(egress, packet)
+}
+
+// InjectPacketIn processes the packet as if it is received from the ingress
+// port of this device by a PACKET_IN, which is never sent by the device.
+func (r *Device) InjectPacketIn(ingress *Port, packet []byte) error {
+	// Read lock
+	r.mutex.RLock()
+	closed, s, f := r.closed, r.session, r.factory
+	r.mutex.RUnlock()
+
+	if closed {
+		return ErrClosedDevice
+	}
+
+	return s.OnPacketIn(f, s.transceiver, newInjectedPacketIn(f.ProtocolVersion(), ingress.Number(), packet))
+}
+
+// Resubmit processes the packet by the flow table of this device as if it is
+// received from the ingress port, or from the controller if ingress is nil.
+func (r *Device) Resubmit(ingress *Port, packet []byte) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	inPort := openflow.NewInPort()
+	if ingress != nil {
+		inPort.SetValue(ingress.Number())
+	} else {
+		inPort.SetController()
+	}
+
+	outPort := openflow.NewOutPort()
+	outPort.SetTable()
+
+	action, err := r.factory.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(outPort)
+
+	out, err := r.factory.NewPacketOut()
+	if err != nil {
+		return err
+	}
+	out.SetInPort(inPort)
+	out.SetAction(action)
+	out.SetData(packet)
+
+	return r.session.Write(out)
+}
+
+// output sends the packet out to the egress port of this device.
+func (r *Device) output(egress *Port, packet []byte) error {
+	inPort := openflow.NewInPort()
+	inPort.SetController()
+
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(egress.Number())
+
+	action, err := r.factory.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(outPort)
+
+	out, err := r.factory.NewPacketOut()
+	if err != nil {
+		return err
+	}
+	out.SetInPort(inPort)
+	out.SetAction(action)
+	out.SetData(packet)
+
+	return r.session.Write(out)
+}
+
 // flood broadcasts the packet to all ports of this device, except the ingress port if ingress is not nil.
 func (r *Device) flood(ingress *Port, packet []byte) error {
 	inPort := openflow.NewInPort()
@@ -454,6 +765,156 @@ func (r *Device) flood(ingress *Port, packet []byte) error {
 	return r.session.Write(out)
 }
 
+// FlowStats queries the statistics of the flows that match with match on all
+// the flow tables, and then waits for the replies up to timeout.
+func (r *Device) FlowStats(match openflow.Match, timeout time.Duration) ([]openflow.FlowStats, error) {
+	port := openflow.NewOutPort()
+	port.SetNone()
+
+	return r.flowStats(match, port, timeout)
+}
+
+// outputFlowStats queries the statistics of the flows that output the packets
+// to the port whose number is num.
+func (r *Device) outputFlowStats(num uint32, timeout time.Duration) ([]openflow.FlowStats, error) {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil, ErrClosedDevice
+	}
+	match, err := r.factory.NewMatch()
+	r.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	port := openflow.NewOutPort()
+	port.SetValue(num)
+
+	return r.flowStats(match, port, timeout)
+}
+
+func (r *Device) flowStats(match openflow.Match, port openflow.OutPort, timeout time.Duration) ([]openflow.FlowStats, error) {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil, ErrClosedDevice
+	}
+	req, err := r.factory.NewFlowStatsRequest()
+	if err != nil {
+		r.mutex.Unlock()
+		return nil, err
+	}
+	req.SetMatch(match)
+	req.SetOutPort(port)
+	req.SetTableID(0xFF) // ALL
+	r.mutex.Unlock()
+
+	result, err := r.requestStats(req, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.flows, nil
+}
+
+// PortStats queries the statistics of all the ports, and then waits for the replies up to timeout.
+func (r *Device) PortStats(timeout time.Duration) ([]openflow.PortStats, error) {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil, ErrClosedDevice
+	}
+	req, err := r.factory.NewPortStatsRequest()
+	if err != nil {
+		r.mutex.Unlock()
+		return nil, err
+	}
+	r.mutex.Unlock()
+
+	result, err := r.requestStats(req, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.ports, nil
+}
+
+type statsMessage interface {
+	openflow.Header
+	encoding.BinaryMarshaler
+}
+
+func (r *Device) requestStats(req statsMessage, timeout time.Duration) (*statsRequest, error) {
+	pending := &statsRequest{done: make(chan struct{})}
+
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil, ErrClosedDevice
+	}
+	r.stats[req.TransactionID()] = pending
+	if err := r.session.Write(req); err != nil {
+		delete(r.stats, req.TransactionID())
+		r.mutex.Unlock()
+		return nil, err
+	}
+	r.mutex.Unlock()
+
+	select {
+	case <-pending.done:
+		return pending, nil
+	case <-time.After(timeout):
+		r.mutex.Lock()
+		delete(r.stats, req.TransactionID())
+		r.mutex.Unlock()
+		return nil, errors.New("stats request timeout")
+	}
+}
+
+// getStatsRequest returns the pending stats request whose transaction ID is
+// xid. The request will be removed from the pending list if more is false.
+// XXX: Caller should lock the mutex before they call this function.
+func (r *Device) getStatsRequest(xid uint32, more bool) (*statsRequest, bool) {
+	pending, ok := r.stats[xid]
+	if !ok {
+		logger.Debugf("unexpected stats reply: xid=%v", xid)
+		return nil, false
+	}
+	if !more {
+		delete(r.stats, xid)
+	}
+
+	return pending, true
+}
+
+func (r *Device) addFlowStats(reply openflow.FlowStatsReply) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	pending, ok := r.getStatsRequest(reply.TransactionID(), reply.More())
+	if !ok {
+		return
+	}
+	pending.flows = append(pending.flows, reply.FlowStats()...)
+	if !reply.More() {
+		close(pending.done)
+	}
+}
+
+func (r *Device) addPortStats(reply openflow.PortStatsReply) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	pending, ok := r.getStatsRequest(reply.TransactionID(), reply.More())
+	if !ok {
+		return
+	}
+	pending.ports = append(pending.ports, reply.PortStats()...)
+	if !reply.More() {
+		close(pending.done)
+	}
+}
+
 func (r *Device) Close() {
 	// Write lock
 	r.mutex.Lock()
@@ -461,3 +922,23 @@ func (r *Device) Close() {
 
 	r.closed = true
 }
+
+// IsHandedOver returns whether the device has been disconnected because this
+// controller has lost the leadership of the cluster. The state of the device
+// shared with the new leader, such as the host locations in the database,
+// should be kept intact.
+func (r *Device) IsHandedOver() bool {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.handedOver
+}
+
+func (r *Device) setHandedOver() {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.handedOver = true
+}
@@ -0,0 +1,302 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/openflow"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// In the dry run, the FLOW_MODs of the applications are computed as usual, but
+// they are only validated and recorded instead of being sent to the devices,
+// so that a new policy can be checked against the live traffic before it is
+// enforced. The flows that make the switches send the traffic to the
+// controller, i.e., the table-miss, the sampling and the path tracing flows,
+// are still sent so that the PACKET_INs keep coming.
+
+const (
+	// Maximum number of the FLOW_MODs remembered. The oldest one is forgotten
+	// when exceeded.
+	dryRunLogSize = 1000
+)
+
+var dryRunFlowMods = metrics.NewCounterVec("openflow_flow_mods_dry_run_total", "Number of the FLOW_MOD messages recorded instead of being sent in the dry run.", "app")
+
+// DryRunFlow is a FLOW_MOD recorded, but not sent, in the dry run.
+type DryRunFlow struct {
+	Time time.Time `json:"time"`
+	DPID uint64    `json:"dpid"`
+	// Application that has sent the FLOW_MOD. Empty if it is the controller itself.
+	App         string            `json:"app,omitempty"`
+	Command     string            `json:"command"`
+	TableID     uint8             `json:"table_id"`
+	Priority    uint16            `json:"priority"`
+	Cookie      uint64            `json:"cookie"`
+	IdleTimeout uint16            `json:"idle_timeout"`
+	HardTimeout uint16            `json:"hard_timeout"`
+	Match       map[string]string `json:"match"`
+	// Why the FLOW_MOD would be rejected. Empty if it is valid.
+	Error string `json:"error,omitempty"`
+}
+
+func (r DryRunFlow) String() string {
+	app := r.App
+	if app == "" {
+		app = "controller"
+	}
+	v := fmt.Sprintf("DPID=%v, App=%v, Command=%v, TableID=%v, Priority=%v, Cookie=%#x, Match=%v", r.DPID, app, r.Command, r.TableID, r.Priority, r.Cookie, r.Match)
+	if r.Error != "" {
+		v += fmt.Sprintf(", Error=%v", r.Error)
+	}
+
+	return v
+}
+
+// DryRunInfo is the current mode of the dry run and the recorded FLOW_MODs.
+type DryRunInfo struct {
+	// Enabled makes all the FLOW_MODs sent through the devices recorded.
+	Enabled bool `json:"enabled"`
+	// Apps are the applications whose FLOW_MODs are recorded if Enabled is false.
+	Apps []string `json:"apps"`
+	// Number of the FLOW_MODs recorded since the controller started.
+	Recorded uint64       `json:"recorded"`
+	Flows    []DryRunFlow `json:"flows,omitempty"`
+}
+
+type dryRun struct {
+	// active is read without the mutex by every FLOW_MOD, which is nonzero if
+	// there is anything to record.
+	active   int32
+	recorded uint64
+
+	mutex   sync.Mutex
+	enabled bool
+	// Key = application name in uppercase.
+	apps map[string]bool
+	// Ring buffer of the recorded FLOW_MODs. next is the index of the oldest
+	// one once it is full.
+	log  []DryRunFlow
+	next int
+}
+
+func newDryRun() *dryRun {
+	return &dryRun{apps: make(map[string]bool)}
+}
+
+func (r *dryRun) set(enabled bool, apps []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.enabled = enabled
+	r.apps = make(map[string]bool)
+	for _, v := range apps {
+		r.apps[strings.ToUpper(v)] = true
+	}
+	if r.enabled || len(r.apps) > 0 {
+		atomic.StoreInt32(&r.active, 1)
+	} else {
+		atomic.StoreInt32(&r.active, 0)
+	}
+}
+
+// covers returns whether the FLOW_MODs sent by app are recorded instead of
+// being sent.
+func (r *dryRun) covers(app string) bool {
+	if atomic.LoadInt32(&r.active) == 0 {
+		return false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.enabled || r.apps[strings.ToUpper(app)]
+}
+
+// intercept returns true if msg is a FLOW_MOD sent by app to the device whose
+// features are f, which should not be sent as it has been recorded. app is
+// empty if the controller itself sends msg.
+func (r *dryRun) intercept(f Features, app string, msg encoding.BinaryMarshaler) bool {
+	if atomic.LoadInt32(&r.active) == 0 {
+		return false
+	}
+	flow, ok := msg.(openflow.FlowMod)
+	if !ok {
+		return false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.enabled && !r.apps[strings.ToUpper(app)] {
+		return false
+	}
+	v := DryRunFlow{
+		Time:        time.Now(),
+		DPID:        f.DPID,
+		App:         app,
+		Command:     flowModCommand(flow.Command()),
+		TableID:     flow.TableID(),
+		Priority:    flow.Priority(),
+		Cookie:      flow.Cookie(),
+		IdleTimeout: flow.IdleTimeout(),
+		HardTimeout: flow.HardTimeout(),
+		Match:       matchFields(flow.FlowMatch()),
+	}
+	if err := validateFlowMod(f, flow); err != nil {
+		v.Error = err.Error()
+	}
+	if len(r.log) < dryRunLogSize {
+		r.log = append(r.log, v)
+	} else {
+		r.log[r.next] = v
+		r.next = (r.next + 1) % dryRunLogSize
+	}
+	atomic.AddUint64(&r.recorded, 1)
+	dryRunFlowMods.WithLabelValues(app).Inc()
+	logger.Infof("dry run: %v", v)
+
+	return true
+}
+
+// validateFlowMod returns the reason why the device whose features are f
+// would reject flow.
+func validateFlowMod(f Features, flow openflow.FlowMod) error {
+	if _, err := flow.MarshalBinary(); err != nil {
+		return err
+	}
+	if flow.Command() != openflow.FlowAdd && flow.Command() != openflow.FlowModify {
+		return nil
+	}
+	if flow.TableID() == 0xFF {
+		return errors.New("adding a flow to all the tables")
+	}
+	if f.NumTables > 0 && flow.TableID() >= f.NumTables {
+		return fmt.Errorf("unknown table: %v tables", f.NumTables)
+	}
+
+	return nil
+}
+
+func flowModCommand(cmd openflow.FlowModCmd) string {
+	switch cmd {
+	case openflow.FlowAdd:
+		return "add"
+	case openflow.FlowModify:
+		return "modify"
+	case openflow.FlowDelete:
+		return "delete"
+	case openflow.FlowDeleteStrict:
+		return "delete_strict"
+	default:
+		return fmt.Sprintf("FlowModCmd(%d)", int(cmd))
+	}
+}
+
+// info returns the mode and the recorded FLOW_MODs from the oldest one.
+func (r *dryRun) info() DryRunInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v := DryRunInfo{
+		Enabled:  r.enabled,
+		Apps:     []string{},
+		Recorded: atomic.LoadUint64(&r.recorded),
+		Flows:    make([]DryRunFlow, 0, len(r.log)),
+	}
+	for k := range r.apps {
+		v.Apps = append(v.Apps, k)
+	}
+	sort.Strings(v.Apps)
+	v.Flows = append(v.Flows, r.log[r.next:]...)
+	v.Flows = append(v.Flows, r.log[:r.next]...)
+
+	return v
+}
+
+func (r *dryRun) clear() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.log = nil
+	r.next = 0
+}
+
+// SetDryRun records the FLOW_MODs sent through the devices instead of sending
+// them: all of them if enabled is true, or only the ones sent by the
+// applications in apps otherwise.
+func (r *Controller) SetDryRun(enabled bool, apps []string) {
+	r.dryRun.set(enabled, apps)
+}
+
+func (r *Controller) showDryRun(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	info := r.dryRun.info()
+	w.WriteJson(&info)
+}
+
+// setDryRun changes the mode of the dry run of this controller.
+func (r *Controller) setDryRun(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p := struct {
+		Enabled bool     `json:"enabled"`
+		Apps    []string `json:"apps"`
+	}{}
+	if err := req.DecodeJsonPayload(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, v := range p.Apps {
+		if strings.TrimSpace(v) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("empty application name"))
+			return
+		}
+	}
+
+	r.dryRun.set(p.Enabled, p.Apps)
+	logger.Warningf("dry run has been changed: enabled=%v, apps=%v", p.Enabled, p.Apps)
+
+	info := r.dryRun.info()
+	info.Flows = nil
+	w.WriteJson(&info)
+}
+
+// clearDryRun forgets the recorded FLOW_MODs.
+func (r *Controller) clearDryRun(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	r.dryRun.clear()
+	w.WriteJson(&struct{}{})
+}
@@ -0,0 +1,98 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+func TestDryRun(t *testing.T) {
+	features := Features{DPID: 1, NumTables: 2}
+	r := newDryRun()
+	if r.intercept(features, "ACL", newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:01", 1)) {
+		t.Fatal("the FLOW_MOD is intercepted while the dry run is disabled")
+	}
+
+	r.set(false, []string{"acl"})
+	if !r.intercept(features, "ACL", newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:01", 1)) {
+		t.Fatal("the FLOW_MOD of the application in the dry run is not intercepted")
+	}
+	if r.intercept(features, "L2Switch", newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:02", 2)) {
+		t.Fatal("the FLOW_MOD of another application is intercepted")
+	}
+	invalid := newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:03", 3)
+	invalid.SetTableID(5)
+	if !r.intercept(features, "ACL", invalid) {
+		t.Fatal("the invalid FLOW_MOD is not intercepted")
+	}
+	// The other messages are always sent.
+	barrier, err := of13.NewFactory().NewBarrierRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.intercept(features, "ACL", barrier) {
+		t.Fatal("the barrier request is intercepted")
+	}
+
+	r.set(true, nil)
+	if !r.intercept(features, "", newTestFlow(t, openflow.FlowDelete, "00:00:00:00:00:04", 0)) {
+		t.Fatal("the FLOW_MOD of the controller is not intercepted in the global dry run")
+	}
+
+	info := r.info()
+	if info.Recorded != 3 || len(info.Flows) != 3 {
+		t.Fatalf("unexpected number of the recorded FLOW_MODs: recorded=%v, flows=%v", info.Recorded, len(info.Flows))
+	}
+	if info.Flows[0].Error != "" || info.Flows[0].Match["dst_mac"] == "" {
+		t.Fatalf("unexpected FLOW_MOD: %v", info.Flows[0])
+	}
+	if info.Flows[1].Error == "" {
+		t.Fatalf("the invalid FLOW_MOD is not reported: %v", info.Flows[1])
+	}
+	if info.Flows[2].Command != "delete" || info.Flows[2].App != "" {
+		t.Fatalf("unexpected FLOW_MOD: %v", info.Flows[2])
+	}
+
+	r.clear()
+	if info := r.info(); info.Recorded != 3 || len(info.Flows) != 0 {
+		t.Fatalf("unexpected FLOW_MODs after clearing: %+v", info)
+	}
+}
+
+func TestDryRunLog(t *testing.T) {
+	r := newDryRun()
+	r.set(true, nil)
+	for i := 0; i < dryRunLogSize+10; i++ {
+		r.intercept(Features{DPID: uint64(i)}, "", newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:01", 0))
+	}
+	flows := r.info().Flows
+	if len(flows) != dryRunLogSize {
+		t.Fatalf("unexpected number of the FLOW_MODs: %v", len(flows))
+	}
+	// From the oldest one.
+	if flows[0].DPID != 10 || flows[len(flows)-1].DPID != dryRunLogSize+9 {
+		t.Fatalf("unexpected order of the FLOW_MODs: first=%v, last=%v", flows[0].DPID, flows[len(flows)-1].DPID)
+	}
+}
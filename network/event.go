@@ -0,0 +1,120 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	// EventDeviceUp is published with DeviceEvent when a device has been connected.
+	EventDeviceUp event.Type = "DeviceUp"
+	// EventDeviceDown is published with DeviceEvent when a device has been disconnected.
+	EventDeviceDown event.Type = "DeviceDown"
+	// EventPortUp is published with PortEvent when the link of a port has been up.
+	EventPortUp event.Type = "PortUp"
+	// EventPortDown is published with PortEvent when the link of a port has been down.
+	EventPortDown event.Type = "PortDown"
+	// EventLinkUp is published with LinkEvent when a link among the devices has been added.
+	EventLinkUp event.Type = "LinkUp"
+	// EventLinkDown is published with LinkEvent when a link among the devices has been removed.
+	EventLinkDown event.Type = "LinkDown"
+	// EventTopologyChanged is published without data when a link among the devices has been added or removed.
+	EventTopologyChanged event.Type = "TopologyChanged"
+	// EventFlowRemoved is published with FlowRemovedEvent when a device has removed a flow due to its timeout.
+	EventFlowRemoved event.Type = "FlowRemoved"
+	// EventPacketSampled is published with PacketSample when a packet received from a host has been sampled.
+	EventPacketSampled event.Type = "PacketSampled"
+	// EventMaintenanceStarted is published with MaintenanceWindow when a switch or a port has been drained for its maintenance window.
+	EventMaintenanceStarted event.Type = "MaintenanceStarted"
+	// EventMaintenanceEnded is published with MaintenanceWindow when a switch or a port has been restored after its maintenance window.
+	EventMaintenanceEnded event.Type = "MaintenanceEnded"
+)
+
+type DeviceEvent struct {
+	DPID uint64 `json:"dpid"`
+}
+
+func (r DeviceEvent) String() string {
+	return fmt.Sprintf("DPID=%v", r.DPID)
+}
+
+type PortEvent struct {
+	DPID uint64 `json:"dpid"`
+	Port uint32 `json:"port"`
+}
+
+func (r PortEvent) String() string {
+	return fmt.Sprintf("DPID=%v, port=%v", r.DPID, r.Port)
+}
+
+type LinkEvent struct {
+	Ports [2]PortEvent `json:"ports"`
+}
+
+func newLinkEvent(link [2]*Port) LinkEvent {
+	v := LinkEvent{}
+	for i, p := range link {
+		v.Ports[i] = PortEvent{DPID: p.Device().Features().DPID, Port: p.Number()}
+	}
+
+	return v
+}
+
+func (r LinkEvent) String() string {
+	return fmt.Sprintf("%v <-> %v", r.Ports[0], r.Ports[1])
+}
+
+type FlowRemovedEvent struct {
+	DPID        uint64            `json:"dpid"`
+	TableID     uint8             `json:"table_id"`
+	Priority    uint16            `json:"priority"`
+	Cookie      uint64            `json:"cookie"`
+	Reason      uint8             `json:"reason"`
+	Duration    uint32            `json:"duration"` // In seconds.
+	PacketCount uint64            `json:"packet_count"`
+	ByteCount   uint64            `json:"byte_count"`
+	Match       map[string]string `json:"match"` // Wildcard fields are omitted.
+	// Message is the FLOW_REMOVED itself for the subscribers that need the
+	// match as is, e.g., to export it.
+	Message openflow.FlowRemoved `json:"-"`
+}
+
+func (r FlowRemovedEvent) String() string {
+	return fmt.Sprintf("DPID=%v, table=%v, priority=%v, cookie=%v, reason=%v, match=%v", r.DPID, r.TableID, r.Priority, r.Cookie, r.Reason, r.Match)
+}
+
+type PacketSample struct {
+	DPID   uint64 `json:"dpid"`
+	Port   uint32 `json:"port"`
+	Rate   uint32 `json:"rate"`   // One of Rate packets is sampled on average.
+	Pool   uint64 `json:"pool"`   // Packets received by the port, or zero if unknown.
+	Length uint16 `json:"length"` // Length of the packet, which may be longer than Frame.
+	Frame  []byte `json:"frame"`
+}
+
+func (r PacketSample) String() string {
+	return fmt.Sprintf("DPID=%v, port=%v, rate=%v, length=%v", r.DPID, r.Port, r.Rate, r.Length)
+}
@@ -0,0 +1,148 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	// Maximum number of the flows remembered for a device. The ledger is
+	// incomplete once exceeded, until all the flows are removed.
+	flowLedgerSize = 65536
+)
+
+// flowLedger remembers the flows that we have installed on a device, which are
+// compared with the flow table of the device by the audit. It learns the flows
+// from the FLOW_MODs sent to the device and the FLOW_REMOVEDs received from it.
+type flowLedger struct {
+	mutex      sync.Mutex
+	entries    map[string]*ledgerEntry
+	incomplete bool
+}
+
+type ledgerEntry struct {
+	flow   openflow.FlowMod
+	fields map[string]string
+	added  time.Time
+}
+
+func newFlowLedger() *flowLedger {
+	return &flowLedger{entries: make(map[string]*ledgerEntry)}
+}
+
+// ledgerKey returns the identity of a flow on the device, which is what the
+// strict variants of FLOW_MOD compare.
+func ledgerKey(tableID uint8, priority uint16, fields map[string]string) string {
+	key := make([]string, 0, len(fields)+2)
+	key = append(key, strconv.Itoa(int(tableID)), strconv.Itoa(int(priority)))
+	for k, v := range fields {
+		key = append(key, k+"="+v)
+	}
+	// The fields in the map are not ordered.
+	sort.Strings(key[2:])
+
+	return strings.Join(key, "/")
+}
+
+// record updates the ledger with flow that has been sent to the device.
+func (r *flowLedger) record(flow openflow.FlowMod) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	fields := matchFields(flow.FlowMatch())
+	switch flow.Command() {
+	case openflow.FlowAdd, openflow.FlowModify:
+		key := ledgerKey(flow.TableID(), flow.Priority(), fields)
+		if _, ok := r.entries[key]; !ok && len(r.entries) >= flowLedgerSize {
+			r.incomplete = true
+			return
+		}
+		r.entries[key] = &ledgerEntry{flow: flow, fields: fields, added: time.Now()}
+	case openflow.FlowDeleteStrict:
+		delete(r.entries, ledgerKey(flow.TableID(), flow.Priority(), fields))
+	case openflow.FlowDelete:
+		// The output port is not compared, so that the flows that may have
+		// been removed are forgotten rather than reported as missing.
+		for k, v := range r.entries {
+			if covers(flow, fields, v) {
+				delete(r.entries, k)
+			}
+		}
+	}
+	if len(r.entries) == 0 {
+		r.incomplete = false
+	}
+}
+
+// covers returns whether the non-strict FLOW_MOD removing the flows of fields
+// also removes the flow of v.
+func covers(flow openflow.FlowMod, fields map[string]string, v *ledgerEntry) bool {
+	if flow.TableID() != 0xFF && flow.TableID() != v.flow.TableID() {
+		return false
+	}
+	mask := flow.CookieMask()
+	if flow.Cookie()&mask != v.flow.Cookie()&mask {
+		return false
+	}
+	for k, f := range fields {
+		if v.fields[k] != f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// remove forgets the flow that the device has removed.
+func (r *flowLedger) remove(flow openflow.FlowRemoved) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.entries, ledgerKey(flow.TableID(), flow.Priority(), matchFields(flow.Match())))
+}
+
+// flows returns the flows in the ledger except the ones that have expired by
+// their hard timeouts, and whether the ledger is complete.
+func (r *flowLedger) flows() (flows []ledgerEntry, complete bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	flows = make([]ledgerEntry, 0, len(r.entries))
+	for k, v := range r.entries {
+		timeout := time.Duration(v.flow.HardTimeout()) * time.Second
+		if timeout > 0 && now.Sub(v.added) >= timeout {
+			delete(r.entries, k)
+			continue
+		}
+		flows = append(flows, *v)
+	}
+
+	return flows, !r.incomplete
+}
@@ -0,0 +1,69 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+func TestFlowLedger(t *testing.T) {
+	l := newFlowLedger()
+	l.record(newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:01", 1))
+	l.record(newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:02", 2))
+	// Adding the same flow again replaces it.
+	l.record(newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:02", 3))
+	if flows, complete := l.flows(); len(flows) != 2 || !complete {
+		t.Fatalf("expected 2 flows, got %v (complete=%v)", len(flows), complete)
+	}
+
+	// The strict deletion does not remove the flows of another priority.
+	del := newTestFlow(t, openflow.FlowDeleteStrict, "00:00:00:00:00:01", 0)
+	del.SetPriority(100)
+	l.record(del)
+	if flows, _ := l.flows(); len(flows) != 2 {
+		t.Fatalf("expected 2 flows after the strict deletion, got %v", len(flows))
+	}
+
+	// The cookie mask protects the flows whose cookie does not match.
+	del = newTestFlow(t, openflow.FlowDelete, "00:00:00:00:00:02", 0)
+	del.SetCookieMask(0x1)
+	l.record(del)
+	if flows, _ := l.flows(); len(flows) != 2 {
+		t.Fatalf("expected 2 flows after the masked deletion, got %v", len(flows))
+	}
+
+	// The wildcard match removes all the flows.
+	match, err := of13.NewFactory().NewMatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	del = newTestFlow(t, openflow.FlowDelete, "00:00:00:00:00:02", 0)
+	del.SetTableID(0xFF)
+	del.SetFlowMatch(match)
+	l.record(del)
+	if flows, _ := l.flows(); len(flows) != 0 {
+		t.Fatalf("expected no flow after deleting all, got %v", len(flows))
+	}
+}
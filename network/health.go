@@ -0,0 +1,103 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// HealthCheck reports the health of the components keyed by their names. Nil
+// error means the component is healthy.
+type HealthCheck func() map[string]error
+
+type healthStatus struct {
+	Status  string            `json:"status"` // ok or fail.
+	Devices int               `json:"devices"`
+	Checks  map[string]string `json:"checks"` // Error messages of the failed checks, or ok.
+	Failed  []string          `json:"failed,omitempty"`
+}
+
+// AddHealthCheck adds f to the checks that decide the readiness of the controller.
+func (r *Controller) AddHealthCheck(f HealthCheck) {
+	r.healthMutex.Lock()
+	defer r.healthMutex.Unlock()
+
+	r.healthChecks = append(r.healthChecks, f)
+}
+
+func (r *Controller) checkHealth() healthStatus {
+	r.healthMutex.Lock()
+	checks := make([]HealthCheck, len(r.healthChecks))
+	copy(checks, r.healthChecks)
+	r.healthMutex.Unlock()
+
+	status := healthStatus{
+		Status: "ok",
+		Checks: make(map[string]string),
+	}
+	for _, d := range r.topo.Devices() {
+		if d.isValid() {
+			status.Devices++
+		}
+	}
+	for _, f := range checks {
+		for name, err := range f() {
+			if err == nil {
+				status.Checks[name] = "ok"
+				continue
+			}
+			status.Checks[name] = err.Error()
+			status.Failed = append(status.Failed, name)
+		}
+	}
+	if len(status.Failed) > 0 {
+		status.Status = "fail"
+		sort.Strings(status.Failed)
+	}
+
+	return status
+}
+
+// showLiveness always responds with 200 OK as long as the controller can serve
+// the requests. The result of the checks is informational.
+func (r *Controller) showLiveness(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteJson(r.checkHealth())
+}
+
+// showReadiness responds with 503 Service Unavailable if any check fails, so
+// that the load balancers stop sending the switches and the clients to this
+// controller.
+func (r *Controller) showReadiness(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-store")
+
+	status := r.checkHealth()
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.WriteJson(status)
+}
@@ -0,0 +1,171 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// injectedPacketIn is a PACKET_IN crafted by the controller, which looks like
+// the one sent by the table-miss flow of the device.
+type injectedPacketIn struct {
+	openflow.Message
+	inPort uint32
+	data   []byte
+}
+
+func newInjectedPacketIn(version uint8, inPort uint32, data []byte) *injectedPacketIn {
+	return &injectedPacketIn{
+		// The type of PACKET_IN is the same on OpenFlow 1.0 and 1.3.
+		Message: openflow.NewMessage(version, of13.OFPT_PACKET_IN, 0),
+		inPort:  inPort,
+		data:    data,
+	}
+}
+
+func (r *injectedPacketIn) BufferID() uint32 {
+	return of13.OFP_NO_BUFFER
+}
+
+func (r *injectedPacketIn) Length() uint16 {
+	return uint16(len(r.data))
+}
+
+func (r *injectedPacketIn) InPort() uint32 {
+	return r.inPort
+}
+
+func (r *injectedPacketIn) TableID() uint8 {
+	return 0
+}
+
+func (r *injectedPacketIn) Reason() uint8 {
+	// OFPR_NO_MATCH
+	return 0
+}
+
+func (r *injectedPacketIn) Cookie() uint64 {
+	return 0
+}
+
+func (r *injectedPacketIn) Data() []byte {
+	return r.data
+}
+
+// decodeFrame returns the Ethernet frame of the JSON request body, which is
+// written in hex digits that may be separated by spaces or colons.
+func decodeFrame(req *rest.Request) ([]byte, error) {
+	var body struct {
+		Frame string `json:"frame"`
+	}
+	if err := req.DecodeJsonPayload(&body); err != nil {
+		return nil, err
+	}
+	frame, err := hex.DecodeString(strings.NewReplacer(" ", "", ":", "").Replace(body.Frame))
+	if err != nil {
+		return nil, fmt.Errorf("invalid frame: %v", err)
+	}
+	// Destination and source MAC addresses, and EtherType.
+	if len(frame) < 14 {
+		return nil, errors.New("too short frame")
+	}
+
+	return frame, nil
+}
+
+// findDevicePort returns the port of the connected device specified by the
+// dpid and port path parameters. It writes the error response and returns false
+// if there is no such port.
+func (r *Controller) findDevicePort(w rest.ResponseWriter, req *rest.Request) (*Port, bool) {
+	d, ok := r.findDevice(w, req)
+	if !ok {
+		return nil, false
+	}
+	num, err := strconv.ParseUint(req.PathParam("port"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	p := d.Port(uint32(num))
+	if p == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown port: %v", num))
+		return nil, false
+	}
+
+	return p, true
+}
+
+// injectPacketIn processes the frame in the request as if it is received from
+// the port by a PACKET_IN, so that the decisions of the applications on the
+// frame can be tested. The applications may send the frame out to the devices.
+func (r *Controller) injectPacketIn(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, ok := r.findDevicePort(w, req)
+	if !ok {
+		return
+	}
+	frame, err := decodeFrame(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.Device().InjectPacketIn(p, frame); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	logger.Infof("injected a PACKET_IN of %v bytes from %v", len(frame), p.ID())
+
+	w.WriteJson(&struct{}{})
+}
+
+// sendPacketOut sends the frame in the request out to the port by a PACKET_OUT.
+func (r *Controller) sendPacketOut(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, ok := r.findDevicePort(w, req)
+	if !ok {
+		return
+	}
+	frame, err := decodeFrame(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.Device().Output(p, frame); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	logger.Infof("sent a PACKET_OUT of %v bytes to %v", len(frame), p.ID())
+
+	w.WriteJson(&struct{}{})
+}
@@ -0,0 +1,116 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding"
+	"encoding/binary"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	// Long enough for the flow to take effect after its barrier.
+	installCacheTTL = 2 * time.Second
+	// Maximum number of the entries of a device, which is reset when exceeded.
+	installCacheSize = 4096
+)
+
+var suppressedFlowMods = metrics.NewCounter("openflow_flow_mods_suppressed_total", "Number of the FLOW_MOD messages not sent as they add the flows just added.")
+
+// installCache remembers the flows recently added to a device, so that the
+// identical FLOW_MODs triggered by a burst of PACKET_INs, which arrive before
+// the first one takes effect, are not sent again. It is protected by the mutex
+// of the device.
+type installCache struct {
+	entries map[string]time.Time
+}
+
+func newInstallCache() *installCache {
+	return &installCache{entries: make(map[string]time.Time)}
+}
+
+// suppress returns true if msg is a FLOW_MOD adding the same flow as the one
+// added within installCacheTTL. The other FLOW_MODs may remove the added flows,
+// so they reset the cache.
+func (r *installCache) suppress(msg encoding.BinaryMarshaler) bool {
+	flow, ok := msg.(openflow.FlowMod)
+	if !ok {
+		return false
+	}
+	if flow.Command() != openflow.FlowAdd {
+		r.reset()
+		return false
+	}
+	key, err := flowKey(flow)
+	if err != nil {
+		// Let the transceiver return the error.
+		return false
+	}
+
+	now := time.Now()
+	if t, ok := r.entries[key]; ok && now.Sub(t) < installCacheTTL {
+		suppressedFlowMods.Inc()
+		return true
+	}
+	if len(r.entries) >= installCacheSize {
+		r.reset()
+	}
+	r.entries[key] = now
+
+	return false
+}
+
+func (r *installCache) reset() {
+	if len(r.entries) > 0 {
+		r.entries = make(map[string]time.Time)
+	}
+}
+
+// flowKey returns the identity of the flow added by f, which does not include
+// the cookie that is usually different for each installation.
+func flowKey(f openflow.FlowMod) (string, error) {
+	key := make([]byte, 7, 64)
+	key[0] = f.TableID()
+	binary.BigEndian.PutUint16(key[1:3], f.Priority())
+	binary.BigEndian.PutUint16(key[3:5], f.IdleTimeout())
+	binary.BigEndian.PutUint16(key[5:7], f.HardTimeout())
+
+	if m := f.FlowMatch(); m != nil {
+		v, err := m.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		key = append(key, v...)
+	}
+	if ins := f.FlowInstruction(); ins != nil {
+		v, err := ins.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		key = append(key, v...)
+	}
+
+	return string(key), nil
+}
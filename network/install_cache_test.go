@@ -0,0 +1,121 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+func newTestFlow(t testing.TB, cmd openflow.FlowModCmd, mac string, cookie uint64) openflow.FlowMod {
+	f := of13.NewFactory()
+	match, err := f.NewMatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match.SetVLANID(1000)
+	match.SetDstMAC(v)
+
+	flow, err := f.NewFlowMod(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow.SetCookie(cookie)
+	flow.SetFlowMatch(match)
+
+	return flow
+}
+
+func TestInstallCache(t *testing.T) {
+	c := newInstallCache()
+	if c.suppress(newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:01", 1)) {
+		t.Fatal("the first flow is suppressed")
+	}
+	// The cookie is not a part of the flow.
+	if !c.suppress(newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:01", 2)) {
+		t.Fatal("the identical flow is not suppressed")
+	}
+	if c.suppress(newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:02", 3)) {
+		t.Fatal("a different flow is suppressed")
+	}
+	// Deleting any flow forgets all the added flows.
+	if c.suppress(newTestFlow(t, openflow.FlowDelete, "00:00:00:00:00:03", 0)) {
+		t.Fatal("the flow deletion is suppressed")
+	}
+	if c.suppress(newTestFlow(t, openflow.FlowAdd, "00:00:00:00:00:01", 4)) {
+		t.Fatal("the flow added again after the deletion is suppressed")
+	}
+}
+
+// BenchmarkFlowInstall measures the cost of a FLOW_MOD on its way to the
+// transceiver: checking the install cache and then marshaling it.
+func BenchmarkFlowInstall(b *testing.B) {
+	f := of13.NewFactory()
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(3)
+	action, err := f.NewAction()
+	if err != nil {
+		b.Fatal(err)
+	}
+	action.SetOutPort(outPort)
+
+	flows := make([]openflow.FlowMod, 1024)
+	for i := range flows {
+		mac := make(net.HardwareAddr, 6)
+		binary.BigEndian.PutUint32(mac[2:], uint32(i))
+		flow := newTestFlow(b, openflow.FlowAdd, mac.String(), 0)
+		inst, err := f.NewInstruction()
+		if err != nil {
+			b.Fatal(err)
+		}
+		inst.ApplyAction(action)
+		flow.SetFlowInstruction(inst)
+		flows[i] = flow
+	}
+
+	c := newInstallCache()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Every flow is new to the cache.
+		if i%len(flows) == 0 {
+			c.reset()
+		}
+		flow := flows[i%len(flows)]
+		if c.suppress(flow) {
+			b.Fatal("a new flow is suppressed")
+		}
+		packet, err := flow.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+		openflow.ReleaseBuffer(packet)
+	}
+}
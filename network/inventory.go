@@ -0,0 +1,420 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// The REST APIs in this file show the live state of the network, which is
+// learned from the connected switches rather than the database.
+
+const flowStatsTimeout = 5 * time.Second
+
+type DeviceInfo struct {
+	ID           string       `json:"id"`
+	DPID         uint64       `json:"dpid"`
+	Descriptions Descriptions `json:"descriptions"`
+	NumPorts     int          `json:"n_ports"`
+	NumTables    uint8        `json:"n_tables"`
+	FlowTableID  uint8        `json:"flow_table_id"`
+	// Alias is omitted if the device has no alias.
+	Alias *SwitchAlias `json:"alias,omitempty"`
+	// Quirk is the name of the quirk applied to the device, if any.
+	Quirk string `json:"quirk,omitempty"`
+}
+
+type PortInfo struct {
+	ID       string `json:"id"`
+	Number   uint32 `json:"number"`
+	Name     string `json:"name"`
+	MAC      string `json:"mac"`
+	AdminUp  bool   `json:"admin_up"`
+	LinkUp   bool   `json:"link_up"`
+	Speed    uint64 `json:"speed"`    // In MB.
+	Edge     bool   `json:"edge"`     // Connected to another switch?
+	Disabled bool   `json:"disabled"` // Disabled by the spanning tree?
+}
+
+// PortStatsInfo is the counters of a port since it was added to the device.
+type PortStatsInfo struct {
+	Number    uint32 `json:"number"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+}
+
+type LinkInfo struct {
+	Ports   [2]string `json:"ports"`
+	Enabled bool      `json:"enabled"`
+	// One-way latency in milliseconds, or zero if not measured yet.
+	Latency float64 `json:"latency_ms,omitempty"`
+	// Traffic from Ports[0] to Ports[1], and then the other way, which is
+	// omitted until the port stats are polled twice.
+	Traffic []LinkTraffic `json:"traffic,omitempty"`
+}
+
+type FlowInfo struct {
+	TableID     uint8             `json:"table_id"`
+	Priority    uint16            `json:"priority"`
+	Cookie      uint64            `json:"cookie"`
+	IdleTimeout uint16            `json:"idle_timeout"`
+	HardTimeout uint16            `json:"hard_timeout"`
+	Duration    uint32            `json:"duration"` // In seconds.
+	PacketCount uint64            `json:"packet_count"`
+	ByteCount   uint64            `json:"byte_count"`
+	Match       map[string]string `json:"match"` // Wildcard fields are omitted.
+}
+
+func (r *Controller) listDevice(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	devices := []DeviceInfo{}
+	for _, d := range r.topo.Devices() {
+		if !d.isValid() {
+			continue
+		}
+		devices = append(devices, NewDeviceInfo(d))
+	}
+	r.forwardToPeers(req, http.MethodGet, "/api/v1/device", func(dec *json.Decoder) error {
+		var v struct {
+			Devices []DeviceInfo `json:"devices"`
+		}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		// A device being handed over can be shown by both of the members.
+		for _, d := range v.Devices {
+			if !containsDevice(devices, d.DPID) {
+				devices = append(devices, d)
+			}
+		}
+		return nil
+	})
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DPID < devices[j].DPID })
+
+	w.WriteJson(&struct {
+		Devices []DeviceInfo `json:"devices"`
+	}{devices})
+}
+
+func (r *Controller) listDevicePort(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	d, ok := r.findDevice(w, req)
+	if !ok {
+		return
+	}
+
+	w.WriteJson(&struct {
+		Ports []PortInfo `json:"ports"`
+	}{NewPortInfos(r.topo, d)})
+}
+
+func (r *Controller) listPortStats(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	d, ok := r.findDevice(w, req)
+	if !ok {
+		return
+	}
+
+	stats, err := d.PortStats(flowStatsTimeout)
+	if err != nil {
+		logger.Errorf("failed to query the port stats from %v: %v", d.ID(), err)
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	ports := make([]PortStatsInfo, 0, len(stats))
+	for _, v := range stats {
+		// Skip the local or unknown ports.
+		if d.Port(v.PortNumber) == nil {
+			continue
+		}
+		ports = append(ports, PortStatsInfo{
+			Number:    v.PortNumber,
+			RxPackets: v.RxPackets,
+			TxPackets: v.TxPackets,
+			RxBytes:   v.RxBytes,
+			TxBytes:   v.TxBytes,
+			RxDropped: v.RxDropped,
+			TxDropped: v.TxDropped,
+			RxErrors:  v.RxErrors,
+			TxErrors:  v.TxErrors,
+		})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Number < ports[j].Number })
+
+	w.WriteJson(&struct {
+		Ports []PortStatsInfo `json:"ports"`
+	}{ports})
+}
+
+func (r *Controller) listFlow(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	d, ok := r.findDevice(w, req)
+	if !ok {
+		return
+	}
+
+	flows, err := QueryFlows(d)
+	if err != nil {
+		logger.Errorf("failed to query the flow stats from %v: %v", d.ID(), err)
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.WriteJson(&struct {
+		Flows []FlowInfo `json:"flows"`
+	}{flows})
+}
+
+// flushFlows removes the flows toward the host specified by the mac path
+// parameter from all the devices, so that they are installed again.
+func (r *Controller) flushFlows(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	mac, err := net.ParseMAC(req.PathParam("mac"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	r.removeFlows(mac)
+	r.forwardToPeers(req, http.MethodDelete, "/api/v1/flow/"+mac.String(), nil)
+	logger.Infof("flushed the flows toward %v", mac)
+
+	w.WriteJson(&struct{}{})
+}
+
+func (r *Controller) listLink(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	links := NewLinkInfos(r.topo)
+	r.forwardToPeers(req, http.MethodGet, "/api/v1/link", func(dec *json.Decoder) error {
+		var v struct {
+			Links []LinkInfo `json:"links"`
+		}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		links = append(links, v.Links...)
+		return nil
+	})
+	sort.Slice(links, func(i, j int) bool { return links[i].Ports[0] < links[j].Ports[0] })
+
+	w.WriteJson(&struct {
+		Links []LinkInfo `json:"links"`
+	}{links})
+}
+
+func containsDevice(devices []DeviceInfo, dpid uint64) bool {
+	for _, v := range devices {
+		if v.DPID == dpid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findDevice returns the connected device specified by the dpid path parameter.
+// It writes the error response and returns false if there is no such device. The
+// request on a device owned by another member of the sharded cluster is forwarded
+// to the member, and then false is returned.
+func (r *Controller) findDevice(w rest.ResponseWriter, req *rest.Request) (*Device, bool) {
+	dpid, err := strconv.ParseUint(req.PathParam("dpid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	// Device ID is its DPID in decimal.
+	d := r.topo.Device(strconv.FormatUint(dpid, 10))
+	if d == nil {
+		if r.forwardToOwner(w, req, dpid) {
+			return nil, false
+		}
+		writeError(w, http.StatusNotFound, errors.New("unknown device"))
+		return nil, false
+	}
+
+	return d, true
+}
+
+func NewDeviceInfo(d *Device) DeviceInfo {
+	features := d.Features()
+
+	v := DeviceInfo{
+		ID:           d.ID(),
+		DPID:         features.DPID,
+		Descriptions: d.Descriptions(),
+		NumPorts:     len(d.Ports()),
+		NumTables:    features.NumTables,
+		FlowTableID:  d.FlowTableID(),
+		Quirk:        d.Quirk().Name,
+	}
+	if alias, ok := d.Alias(); ok {
+		v.Alias = &alias
+	}
+
+	return v
+}
+
+// NewPortInfos returns the states of the ports on d sorted by their numbers.
+func NewPortInfos(finder Finder, d *Device) []PortInfo {
+	ports := []PortInfo{}
+	for _, p := range d.Ports() {
+		v := p.Value()
+		if v == nil {
+			continue
+		}
+		edge := finder.IsEdge(p)
+		ports = append(ports, PortInfo{
+			ID:       p.ID(),
+			Number:   p.Number(),
+			Name:     v.Name(),
+			MAC:      v.MAC().String(),
+			AdminUp:  !v.IsPortDown(),
+			LinkUp:   !v.IsLinkDown(),
+			Speed:    v.Speed(),
+			Edge:     edge,
+			Disabled: edge && !finder.IsEnabledBySTP(p),
+		})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Number < ports[j].Number })
+
+	return ports
+}
+
+func NewLinkInfos(finder Finder) []LinkInfo {
+	links := []LinkInfo{}
+	for _, v := range finder.Links() {
+		link := LinkInfo{
+			Ports:   [2]string{v[0].ID(), v[1].ID()},
+			Enabled: finder.IsEnabledBySTP(v[0]),
+			Latency: float64(finder.LinkLatency(v[0])/time.Microsecond) / 1000,
+		}
+		forward, ok1 := finder.LinkTraffic(v[0])
+		backward, ok2 := finder.LinkTraffic(v[1])
+		if ok1 && ok2 {
+			link.Traffic = []LinkTraffic{forward, backward}
+		}
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Ports[0] < links[j].Ports[0] })
+
+	return links
+}
+
+// QueryFlows queries all the flows installed on d.
+func QueryFlows(d *Device) ([]FlowInfo, error) {
+	match, err := d.Factory().NewMatch()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := d.FlowStats(match, flowStatsTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	flows := make([]FlowInfo, 0, len(stats))
+	for _, v := range stats {
+		flows = append(flows, FlowInfo{
+			TableID:     v.TableID,
+			Priority:    v.Priority,
+			Cookie:      v.Cookie,
+			IdleTimeout: v.IdleTimeout,
+			HardTimeout: v.HardTimeout,
+			Duration:    v.DurationSec,
+			PacketCount: v.PacketCount,
+			ByteCount:   v.ByteCount,
+			Match:       matchFields(v.Match),
+		})
+	}
+
+	return flows, nil
+}
+
+func matchFields(m openflow.Match) map[string]string {
+	v := make(map[string]string)
+	if m == nil {
+		return v
+	}
+
+	if wildcard, port := m.InPort(); !wildcard {
+		if port.IsController() {
+			v["in_port"] = "controller"
+		} else {
+			v["in_port"] = strconv.FormatUint(uint64(port.Value()), 10)
+		}
+	}
+	if wildcard, mac := m.SrcMAC(); !wildcard {
+		v["src_mac"] = mac.String()
+	}
+	if wildcard, mac := m.DstMAC(); !wildcard {
+		v["dst_mac"] = mac.String()
+	}
+	if wildcard, id := m.VLANID(); !wildcard {
+		v["vlan_id"] = strconv.Itoa(int(id))
+	}
+	if wildcard, t := m.EtherType(); !wildcard {
+		v["ether_type"] = "0x" + strconv.FormatUint(uint64(t), 16)
+	}
+	// Zero prefix length means a wildcard.
+	if ip := m.SrcIP(); ip != nil {
+		if ones, _ := ip.Mask.Size(); ones > 0 {
+			v["src_ip"] = ip.String()
+		}
+	}
+	if ip := m.DstIP(); ip != nil {
+		if ones, _ := ip.Mask.Size(); ones > 0 {
+			v["dst_ip"] = ip.String()
+		}
+	}
+	if wildcard, p := m.IPProtocol(); !wildcard {
+		v["ip_protocol"] = strconv.Itoa(int(p))
+	}
+	if wildcard, p := m.SrcPort(); !wildcard {
+		v["src_port"] = strconv.Itoa(int(p))
+	}
+	if wildcard, p := m.DstPort(); !wildcard {
+		v["dst_port"] = strconv.Itoa(int(p))
+	}
+
+	return v
+}
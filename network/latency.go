@@ -0,0 +1,192 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+)
+
+// The latency of a link is measured by the probes that the controller sends
+// out to a port of the link. A probe carries the time it is sent, and comes
+// back to the controller by the table-miss flow of the peer device. The
+// one-way latency of the link is the elapsed time minus the halves of the
+// round trip times of the control channels of the both devices, which are
+// measured by the echo requests sent just before the probes.
+
+// DefaultLinkLatencyInterval is how often the latency probes are sent out to
+// the ports of the links.
+const DefaultLinkLatencyInterval = 10 * time.Second
+
+var (
+	// IEEE Std 802 - Local Experimental EtherType 2.
+	latencyProbeEtherType = []byte{0x88, 0xB6}
+	latencyProbeMagic     = []byte("cherry/latency")
+	// The probe is sent to the LLDP multicast MAC address, which is not
+	// forwarded by the bridges.
+	latencyProbeDstMAC = []byte{0x01, 0x80, 0xC2, 0x00, 0x00, 0x0E}
+
+	linkLatency = metrics.NewHistogram("openflow_link_latency_seconds",
+		"One-way latency of the links among the devices measured by the latency probes.",
+		[]float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1},
+	)
+)
+
+// Ethernet header, magic, DPID, port number and timestamp in nanoseconds.
+const latencyProbeLength = 14 + 14 + 8 + 4 + 8
+
+func newLatencyProbe(dpid uint64, p openflow.Port, sent time.Time) ([]byte, error) {
+	payload := make([]byte, len(latencyProbeMagic)+20)
+	copy(payload, latencyProbeMagic)
+	v := payload[len(latencyProbeMagic):]
+	binary.BigEndian.PutUint64(v[0:8], dpid)
+	binary.BigEndian.PutUint32(v[8:12], p.Number())
+	binary.BigEndian.PutUint64(v[12:20], uint64(sent.UnixNano()))
+
+	ethernet := &protocol.Ethernet{
+		SrcMAC:  p.MAC(),
+		DstMAC:  latencyProbeDstMAC,
+		Type:    binary.BigEndian.Uint16(latencyProbeEtherType),
+		Payload: payload,
+	}
+
+	return ethernet.MarshalBinary()
+}
+
+func isLatencyProbe(frame []byte) bool {
+	return len(frame) >= latencyProbeLength &&
+		bytes.Equal(frame[12:14], latencyProbeEtherType) &&
+		bytes.Equal(frame[14:14+len(latencyProbeMagic)], latencyProbeMagic)
+}
+
+// parseLatencyProbe returns the device ID and the port number that the probe
+// has been sent out to, and the time it has been sent.
+func parseLatencyProbe(frame []byte) (deviceID string, portNum uint32, sent time.Time) {
+	v := frame[14+len(latencyProbeMagic):]
+	// Device ID is its DPID in decimal.
+	deviceID = strconv.FormatUint(binary.BigEndian.Uint64(v[0:8]), 10)
+	portNum = binary.BigEndian.Uint32(v[8:12])
+	sent = time.Unix(0, int64(binary.BigEndian.Uint64(v[12:20])))
+
+	return deviceID, portNum, sent
+}
+
+// runLatencyProber sends the latency probes out to the ports of the links of
+// the device every interval until ctx is canceled.
+func (r *session) runLatencyProber(ctx context.Context, interval time.Duration) {
+	r.runPeriodically(ctx, interval, func() {
+		if err := r.sendLatencyProbes(); err != nil {
+			logger.Debugf("failed to send the latency probes to %v: %v", r.device.ID(), err)
+		}
+	})
+}
+
+func (r *session) sendLatencyProbes() error {
+	ports := []openflow.Port{}
+	for _, p := range r.device.Ports() {
+		if r.finder.IsEdge(p) {
+			ports = append(ports, p.Value())
+		}
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+
+	f := r.device.Factory()
+	// The peer device uses the round trip time of this device measured by
+	// this echo, which is sent before the probes.
+	if err := r.transceiver.Ping(f); err != nil {
+		return err
+	}
+	dpid := r.device.Features().DPID
+	for _, p := range ports {
+		probe, err := newLatencyProbe(dpid, p, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := sendLatencyProbe(r.device, p.Number(), probe); err != nil {
+			return err
+		}
+		// The probes should not wait for the write buffering.
+		if err := r.stream.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sendLatencyProbe(d *Device, portNum uint32, probe []byte) error {
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(portNum)
+
+	action, err := d.Factory().NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(outPort)
+
+	out, err := d.Factory().NewPacketOut()
+	if err != nil {
+		return err
+	}
+	// From controller
+	out.SetInPort(openflow.NewInPort())
+	out.SetAction(action)
+	out.SetData(probe)
+
+	return d.SendMessage(out)
+}
+
+// handleLatencyProbe updates the latency of the link of inPort by the probe
+// received at the given time.
+func (r *session) handleLatencyProbe(inPort *Port, frame []byte, received time.Time) {
+	deviceID, portNum, sent := parseLatencyProbe(frame)
+	peer, err := r.findNeighborPort(deviceID, portNum)
+	if err != nil {
+		logger.Debugf("ignoring a latency probe: %v", err)
+		return
+	}
+	// Round trip times of the control channels of the both devices.
+	rtt1, rtt2 := peer.Device().session.transceiver.RTT(), r.transceiver.RTT()
+	if rtt1 == 0 || rtt2 == 0 {
+		return
+	}
+
+	latency := received.Sub(sent) - (rtt1+rtt2)/2
+	if latency < 0 {
+		// Within the jitter of the control channels.
+		latency = 0
+	}
+	if !r.watcher.LinkLatencyMeasured([2]*Port{inPort, peer}, latency) {
+		logger.Debugf("ignoring a latency probe from %v to %v: unknown link", peer.ID(), inPort.ID())
+		return
+	}
+	linkLatency.Observe(latency.Seconds())
+}
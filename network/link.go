@@ -24,12 +24,17 @@ package network
 import (
 	"fmt"
 	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/superkkt/cherry/graph"
 )
 
 type link struct {
 	ports [2]*Port
+	// latency is the smoothed one-way latency measured by the latency probes
+	// in nanoseconds, which is accessed atomically. Zero means unknown.
+	latency int64
 }
 
 func newLink(ports [2]*Port) *link {
@@ -49,7 +54,32 @@ func (r *link) Points() [2]graph.Point {
 	return [2]graph.Point{r.ports[0], r.ports[1]}
 }
 
+// Weight prefers the links of the lower latency when the spanning tree is
+// calculated.
 func (r *link) Weight() float64 {
-	// TODO: Calculate weight dynamically based on the link speed among these two ports
-	return 0
+	// TODO: Also consider the link speed among these two ports
+	return r.Latency().Seconds()
+}
+
+func (r *link) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.latency))
+}
+
+// observeLatency updates the smoothed latency by the latency of a probe.
+func (r *link) observeLatency(d time.Duration) {
+	// Non-zero is known.
+	if d <= 0 {
+		d = 1
+	}
+	for {
+		old := atomic.LoadInt64(&r.latency)
+		v := int64(d)
+		if old != 0 {
+			// Exponentially weighted moving average whose weight is 1/8.
+			v = old + (int64(d)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&r.latency, old, v) {
+			return
+		}
+	}
 }
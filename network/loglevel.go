@@ -0,0 +1,77 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/superkkt/go-logging"
+)
+
+// Pseudo module name that means the log level of all the modules.
+const defaultLogModule = "default"
+
+type logLevel struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+}
+
+func (r *Controller) showLogLevel(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	module := req.PathParam("module")
+	w.WriteJson(&logLevel{Module: module, Level: logging.GetLevel(logModule(module)).String()})
+}
+
+// setLogLevel changes the log level of a module at runtime. The modules listed
+// in default.log_modules are reset to the configured levels whenever the config
+// file is changed.
+func (r *Controller) setLogLevel(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p := logLevel{}
+	if err := req.DecodeJsonPayload(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	level, err := logging.LogLevel(strings.ToUpper(p.Level))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	module := req.PathParam("module")
+	logging.SetLevel(level, logModule(module))
+	logger.Infof("log level of %v module has been changed to %v", module, level)
+
+	w.WriteJson(&logLevel{Module: module, Level: level.String()})
+}
+
+func logModule(name string) string {
+	if name == defaultLogModule {
+		return ""
+	}
+
+	return name
+}
@@ -0,0 +1,433 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/graph"
+	"github.com/superkkt/cherry/openflow"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+const (
+	// maintenanceInterval is how often the maintenance windows are checked
+	// whether they have started or ended.
+	maintenanceInterval = 10 * time.Second
+	// maintenanceReloadInterval is how often the windows are reloaded from the
+	// database, so that the changes through the other members of the cluster
+	// are applied.
+	maintenanceReloadInterval = time.Minute
+	// drainedLinkCost is added to the cost of a link under maintenance, so that
+	// it is used only if there is no other path.
+	drainedLinkCost = 1e6
+)
+
+// MaintenanceWindow is the time range during which a switch, or one of its
+// ports, is under maintenance. Its links are drained, i.e., the paths avoid
+// them if possible, and its alarms are suppressed.
+type MaintenanceWindow struct {
+	ID   uint64 `json:"id"`
+	DPID uint64 `json:"dpid"`
+	// Zero means the whole switch.
+	Port        uint32    `json:"port,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Description string    `json:"description,omitempty"`
+}
+
+func (r MaintenanceWindow) String() string {
+	return fmt.Sprintf("ID=%v, DPID=%v, Port=%v, Start=%v, End=%v, Description=%v", r.ID, r.DPID, r.Port, r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), r.Description)
+}
+
+func (r *MaintenanceWindow) validate() error {
+	if r.DPID == 0 {
+		return errors.New("empty DPID")
+	}
+	// The reserved ports, e.g., the controller, start from 0xFFFFFF00.
+	if r.Port >= 0xFFFFFF00 {
+		return fmt.Errorf("invalid port number: %v", r.Port)
+	}
+	if r.Start.IsZero() || r.End.IsZero() {
+		return errors.New("empty start or end time")
+	}
+	if !r.End.After(r.Start) {
+		return errors.New("end time should be after start time")
+	}
+	if len(r.Description) > 255 {
+		return errors.New("too long description")
+	}
+
+	return nil
+}
+
+func (r MaintenanceWindow) isActive(now time.Time) bool {
+	return !now.Before(r.Start) && now.Before(r.End)
+}
+
+// covers returns whether the window is for the port of the switch whose DPID
+// is dpid. Zero port means the whole switch.
+func (r MaintenanceWindow) covers(dpid uint64, port uint32) bool {
+	return r.DPID == dpid && (r.Port == 0 || r.Port == port)
+}
+
+type maintenanceSchedule struct {
+	db database
+
+	mutex   sync.Mutex
+	windows map[uint64]MaintenanceWindow
+	loaded  time.Time
+	// []MaintenanceWindow that are active, which is replaced as a whole, so
+	// that the path finding reads it without locking.
+	active atomic.Value
+}
+
+func newMaintenanceSchedule(db database) *maintenanceSchedule {
+	v := &maintenanceSchedule{
+		db:      db,
+		windows: make(map[uint64]MaintenanceWindow),
+	}
+	v.active.Store([]MaintenanceWindow{})
+
+	return v
+}
+
+// reload reloads the windows from the database if they are older than
+// maintenanceReloadInterval. The caller should lock the mutex.
+func (r *maintenanceSchedule) reload() {
+	if time.Since(r.loaded) < maintenanceReloadInterval {
+		return
+	}
+	// Retry after the interval even if it fails.
+	r.loaded = time.Now()
+
+	windows, err := r.db.MaintenanceWindows()
+	if err != nil {
+		logger.Errorf("failed to load the maintenance windows: %v", err)
+		return
+	}
+	r.windows = make(map[uint64]MaintenanceWindow)
+	for _, v := range windows {
+		r.windows[v.ID] = v
+	}
+}
+
+// list returns the windows sorted by their start times.
+func (r *maintenanceSchedule) list() []MaintenanceWindow {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reload()
+	v := make([]MaintenanceWindow, 0, len(r.windows))
+	for _, w := range r.windows {
+		v = append(v, w)
+	}
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].Start.Equal(v[j].Start) {
+			return v[i].ID < v[j].ID
+		}
+		return v[i].Start.Before(v[j].Start)
+	})
+
+	return v
+}
+
+func (r *maintenanceSchedule) add(w MaintenanceWindow) (MaintenanceWindow, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	id, err := r.db.AddMaintenanceWindow(w)
+	if err != nil {
+		return MaintenanceWindow{}, err
+	}
+	w.ID = id
+	r.windows[id] = w
+
+	return w, nil
+}
+
+func (r *maintenanceSchedule) remove(id uint64) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ok, err := r.db.RemoveMaintenanceWindow(id)
+	if err != nil {
+		return false, err
+	}
+	delete(r.windows, id)
+
+	return ok, nil
+}
+
+// update activates the windows that cover now, and then returns the ones that
+// have been started and ended since the last update.
+func (r *maintenanceSchedule) update(now time.Time) (started, ended []MaintenanceWindow) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reload()
+	prev := make(map[uint64]MaintenanceWindow)
+	for _, v := range r.activeWindows() {
+		prev[v.ID] = v
+	}
+	active := []MaintenanceWindow{}
+	for _, v := range r.windows {
+		if !v.isActive(now) {
+			continue
+		}
+		active = append(active, v)
+		if _, ok := prev[v.ID]; ok {
+			delete(prev, v.ID)
+			continue
+		}
+		started = append(started, v)
+	}
+	// The rest have been ended or removed.
+	for _, v := range prev {
+		ended = append(ended, v)
+	}
+	r.active.Store(active)
+
+	return started, ended
+}
+
+func (r *maintenanceSchedule) activeWindows() []MaintenanceWindow {
+	return r.active.Load().([]MaintenanceWindow)
+}
+
+func (r *maintenanceSchedule) isActive(id uint64) bool {
+	for _, v := range r.activeWindows() {
+		if v.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// covers returns whether the port of the switch whose DPID is dpid is under
+// maintenance. Zero port means the switch itself.
+func (r *maintenanceSchedule) covers(dpid uint64, port uint32) bool {
+	for _, v := range r.activeWindows() {
+		if v.covers(dpid, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDrained returns whether p or its switch is under maintenance.
+func (r *maintenanceSchedule) isDrained(p *Port) bool {
+	if len(r.activeWindows()) == 0 {
+		return false
+	}
+
+	return r.covers(p.Device().Features().DPID, p.Number())
+}
+
+// drainCost returns the cost function that adds drainedLinkCost to cost of
+// the links under maintenance.
+func (r *maintenanceSchedule) drainCost(cost func(graph.Point, graph.Edge) float64) func(graph.Point, graph.Edge) float64 {
+	return func(p graph.Point, e graph.Edge) float64 {
+		l := e.(*link)
+		if r.isDrained(l.ports[0]) || r.isDrained(l.ports[1]) {
+			return cost(p, e) + drainedLinkCost
+		}
+		return cost(p, e)
+	}
+}
+
+// hopCost is the cost of the paths by the number of the hops.
+func hopCost(p graph.Point, e graph.Edge) float64 {
+	return 1
+}
+
+// RunMaintenance drains and restores the switches and the ports when their
+// maintenance windows start and end, until ctx is canceled.
+func (r *Controller) RunMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		r.checkMaintenance()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Controller) checkMaintenance() {
+	started, ended := r.maintenance.update(time.Now())
+	for _, v := range started {
+		logger.Warningf("maintenance started, draining %v", r.maintenanceLabel(v))
+		r.flushMaintenance(v, false)
+		event.Publish(EventMaintenanceStarted, v)
+	}
+	for _, v := range ended {
+		logger.Warningf("maintenance ended, restoring %v", r.maintenanceLabel(v))
+		r.flushMaintenance(v, true)
+		event.Publish(EventMaintenanceEnded, v)
+	}
+}
+
+func (r *Controller) maintenanceLabel(w MaintenanceWindow) string {
+	if w.Port == 0 {
+		return fmt.Sprintf("the switch %v", r.aliases.label(w.DPID))
+	}
+
+	return fmt.Sprintf("the port %v of the switch %v", w.Port, r.aliases.label(w.DPID))
+}
+
+// flushMaintenance removes the flows of the links of w, so that the new flows
+// follow the paths that avoid or use them again. The flows outputting to the
+// links are removed when they are drained, and all the flows of the switches
+// of the links are removed when they are restored because the flows using the
+// other paths instead are not known.
+func (r *Controller) flushMaintenance(w MaintenanceWindow, restored bool) {
+	for _, l := range r.topo.Links() {
+		for i, p := range l {
+			if !w.covers(p.Device().Features().DPID, p.Number()) {
+				continue
+			}
+			for _, v := range []*Port{p, l[1-i]} {
+				device := v.Device()
+				if device.IsClosed() || !r.isOwner(device.Features().DPID) {
+					continue
+				}
+				if err := flushMaintenanceFlows(device, v.Number(), restored); err != nil {
+					logger.Errorf("failed to remove the flows of %v for the maintenance: %v", v.ID(), err)
+				}
+			}
+		}
+	}
+}
+
+// flushMaintenanceFlows removes the flows of device outputting to port if the
+// port is drained, or all the flows of device if it is restored. The latter
+// reinstalls the ARP flow to the controller that is also removed.
+func flushMaintenanceFlows(device *Device, port uint32, restored bool) error {
+	if restored {
+		return device.RemoveAllFlows()
+	}
+
+	match, err := device.Factory().NewMatch()
+	if err != nil {
+		return err
+	}
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(port)
+
+	return device.RemoveFlow(match, outPort)
+}
+
+// UnderMaintenance returns whether the port of the switch whose DPID is dpid,
+// or the whole switch if port is zero, is in an active maintenance window.
+func (r *topology) UnderMaintenance(dpid uint64, port uint32) bool {
+	return r.maintenance.covers(dpid, port)
+}
+
+type maintenanceStatus struct {
+	MaintenanceWindow
+	Active bool `json:"active"`
+}
+
+func (r *Controller) listMaintenance(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	windows := []maintenanceStatus{}
+	for _, v := range r.maintenance.list() {
+		windows = append(windows, maintenanceStatus{MaintenanceWindow: v, Active: r.maintenance.isActive(v.ID)})
+	}
+	w.WriteJson(&struct {
+		Windows []maintenanceStatus `json:"windows"`
+	}{windows})
+}
+
+func (r *Controller) addMaintenance(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	window := MaintenanceWindow{}
+	if err := req.DecodeJsonPayload(&window); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	window.ID = 0
+	if err := window.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !window.End.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, errors.New("already ended maintenance window"))
+		return
+	}
+
+	window, err := r.maintenance.add(window)
+	if err != nil {
+		logger.Errorf("failed to query database: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Infof("scheduled a maintenance window: %v", window)
+	// Start it now if it is already active.
+	r.checkMaintenance()
+
+	w.WriteJson(&window)
+}
+
+func (r *Controller) removeMaintenance(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.ParseUint(req.PathParam("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ok, err := r.maintenance.remove(id)
+	if err != nil {
+		logger.Errorf("failed to query database: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown maintenance window"))
+		return
+	}
+	logger.Infof("removed the maintenance window whose ID is %v", id)
+	// End it now if it is active.
+	r.checkMaintenance()
+
+	w.WriteJson(&struct{}{})
+}
@@ -0,0 +1,197 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/openflow/of13"
+	"github.com/superkkt/cherry/openflow/transceiver"
+)
+
+type maintenanceDB struct {
+	database
+	windows []MaintenanceWindow
+}
+
+func (r *maintenanceDB) MaintenanceWindows() ([]MaintenanceWindow, error) {
+	return r.windows, nil
+}
+
+func (r *maintenanceDB) RemoveMaintenanceWindow(id uint64) (bool, error) {
+	for i, v := range r.windows {
+		if v.ID == id {
+			r.windows = append(r.windows[:i], r.windows[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func TestMaintenanceSchedule(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	db := &maintenanceDB{windows: []MaintenanceWindow{
+		{ID: 1, DPID: 1, Start: start, End: start.Add(time.Hour)},
+		{ID: 2, DPID: 2, Port: 3, Start: start.Add(30 * time.Minute), End: start.Add(2 * time.Hour)},
+	}}
+	s := newMaintenanceSchedule(db)
+
+	started, ended := s.update(start.Add(-time.Minute))
+	if len(started) != 0 || len(ended) != 0 || s.covers(1, 0) {
+		t.Fatalf("unexpected windows before the start: started=%v, ended=%v", started, ended)
+	}
+
+	started, ended = s.update(start)
+	if len(started) != 1 || started[0].ID != 1 || len(ended) != 0 {
+		t.Fatalf("unexpected windows at the start: started=%v, ended=%v", started, ended)
+	}
+	// The whole switch is under maintenance.
+	if !s.covers(1, 0) || !s.covers(1, 5) || s.covers(2, 0) {
+		t.Fatal("unexpected maintenance of the switch")
+	}
+
+	started, ended = s.update(start.Add(time.Hour))
+	if len(started) != 1 || started[0].ID != 2 || len(ended) != 1 || ended[0].ID != 1 {
+		t.Fatalf("unexpected windows after an hour: started=%v, ended=%v", started, ended)
+	}
+	// Only the port is under maintenance.
+	if !s.covers(2, 3) || s.covers(2, 4) || s.covers(2, 0) || s.covers(1, 0) {
+		t.Fatal("unexpected maintenance of the port")
+	}
+
+	// The removed window ends immediately.
+	if ok, err := s.remove(2); err != nil || !ok {
+		t.Fatalf("failed to remove the window: ok=%v, err=%v", ok, err)
+	}
+	started, ended = s.update(start.Add(time.Hour))
+	if len(started) != 0 || len(ended) != 1 || ended[0].ID != 2 || s.covers(2, 3) {
+		t.Fatalf("unexpected windows after the removal: started=%v, ended=%v", started, ended)
+	}
+}
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	now := time.Now()
+	for _, v := range []struct {
+		window MaintenanceWindow
+		valid  bool
+	}{
+		{MaintenanceWindow{DPID: 1, Start: now, End: now.Add(time.Hour)}, true},
+		{MaintenanceWindow{DPID: 1, Port: 48, Start: now, End: now.Add(time.Hour)}, true},
+		{MaintenanceWindow{Start: now, End: now.Add(time.Hour)}, false},
+		{MaintenanceWindow{DPID: 1, Port: 0xFFFFFFFD, Start: now, End: now.Add(time.Hour)}, false},
+		{MaintenanceWindow{DPID: 1, Start: now, End: now}, false},
+		{MaintenanceWindow{DPID: 1, End: now}, false},
+	} {
+		if err := v.window.validate(); (err == nil) != v.valid {
+			t.Errorf("unexpected validation of %v: %v", v.window, err)
+		}
+	}
+}
+
+// testChannel keeps the messages written to the stream of a test device.
+type testChannel struct {
+	bytes.Buffer
+}
+
+func (r *testChannel) Close() error {
+	return nil
+}
+
+type testFlowMod struct {
+	cookie   uint64
+	command  uint8
+	priority uint16
+	outPort  uint32
+	flags    uint16
+}
+
+// flowMods parses the OpenFlow 1.3 FLOW_MODs written to the channel.
+func (r *testChannel) flowMods() []testFlowMod {
+	result := []testFlowMod{}
+	v := r.Bytes()
+	for len(v) >= 8 {
+		length := int(binary.BigEndian.Uint16(v[2:4]))
+		if v[1] == of13.OFPT_FLOW_MOD {
+			result = append(result, testFlowMod{
+				cookie:   binary.BigEndian.Uint64(v[8:16]),
+				command:  v[25],
+				priority: binary.BigEndian.Uint16(v[30:32]),
+				outPort:  binary.BigEndian.Uint32(v[36:40]),
+				flags:    binary.BigEndian.Uint16(v[44:46]),
+			})
+		}
+		v = v[length:]
+	}
+
+	return result
+}
+
+// newTestDevice returns an OpenFlow 1.3 device whose messages are written to
+// the returned channel.
+func newTestDevice(dpid uint64) (*Device, *testChannel) {
+	channel := new(testChannel)
+	s := &session{
+		transceiver: transceiver.NewTransceiver(transceiver.NewStream(channel), new(testHandler)),
+		dryRun:      newDryRun(),
+	}
+	s.id.Store("")
+	d := newDevice(s)
+	d.setID(strconv.FormatUint(dpid, 10))
+	d.setFactory(of13.NewFactory())
+	d.setFeatures(Features{DPID: dpid, NumTables: 1})
+
+	return d, channel
+}
+
+type testHandler struct {
+	transceiver.Handler
+}
+
+func TestFlushMaintenanceFlows(t *testing.T) {
+	device, channel := newTestDevice(1)
+	if err := flushMaintenanceFlows(device, 3, false); err != nil {
+		t.Fatal(err)
+	}
+	flows := channel.flowMods()
+	if len(flows) != 1 || flows[0].command != of13.OFPFC_DELETE || flows[0].outPort != 3 {
+		t.Fatalf("unexpected FLOW_MODs draining the port: %+v", flows)
+	}
+
+	channel.Reset()
+	if err := flushMaintenanceFlows(device, 3, true); err != nil {
+		t.Fatal(err)
+	}
+	// All the flows are removed, and then the ARP flow to the controller is
+	// installed again.
+	flows = channel.flowMods()
+	if len(flows) != 2 || flows[0].command != of13.OFPFC_DELETE || flows[0].outPort != of13.OFPP_ANY {
+		t.Fatalf("unexpected FLOW_MODs restoring the port: %+v", flows)
+	}
+	if flows[1].command != of13.OFPFC_ADD || flows[1].priority != 100 {
+		t.Fatalf("the ARP flow is not reinstalled: %+v", flows[1])
+	}
+}
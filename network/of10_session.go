@@ -40,15 +40,31 @@ func newOF10Session(d *Device) *of10Session {
 }
 
 func (r *of10Session) OnHello(f openflow.Factory, w transceiver.Writer, v openflow.Hello) error {
+	if err := r.onStandbyHello(f, w); err != nil {
+		return err
+	}
+
+	return r.promote(f, w)
+}
+
+// onStandbyHello only queries the features of the device, which has no role,
+// until we know whether we are its master.
+func (r *of10Session) onStandbyHello(f openflow.Factory, w transceiver.Writer) error {
 	if err := sendHello(f, w); err != nil {
 		return errors.Wrap(err, "failed to send HELLO")
 	}
-	if err := sendSetConfig(f, w); err != nil {
-		return errors.Wrap(err, "failed to send SET_CONFIG")
-	}
 	if err := sendFeaturesRequest(f, w); err != nil {
 		return errors.Wrap(err, "failed to send FEATURE_REQUEST")
 	}
+
+	return nil
+}
+
+// promote initializes the device to serve it as its master.
+func (r *of10Session) promote(f openflow.Factory, w transceiver.Writer) error {
+	if err := sendSetConfig(f, w); err != nil {
+		return errors.Wrap(err, "failed to send SET_CONFIG")
+	}
 	if err := sendBarrierRequest(f, w); err != nil {
 		return errors.Wrap(err, "failed to send BARRIER_REQUEST")
 	}
@@ -118,6 +134,18 @@ func (r *of10Session) OnFlowRemoved(f openflow.Factory, w transceiver.Writer, v
 	return nil
 }
 
+func (r *of10Session) OnFlowStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.FlowStatsReply) error {
+	return nil
+}
+
+func (r *of10Session) OnPortStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.PortStatsReply) error {
+	return nil
+}
+
 func (r *of10Session) OnPacketIn(f openflow.Factory, w transceiver.Writer, v openflow.PacketIn) error {
 	return nil
 }
+
+func (r *of10Session) OnRoleReply(f openflow.Factory, w transceiver.Writer, v openflow.RoleReply) error {
+	return nil
+}
@@ -22,8 +22,6 @@
 package network
 
 import (
-	"strings"
-
 	"github.com/superkkt/cherry/openflow"
 	"github.com/superkkt/cherry/openflow/of13"
 	"github.com/superkkt/cherry/openflow/transceiver"
@@ -45,6 +43,9 @@ func (r *of13Session) OnHello(f openflow.Factory, w transceiver.Writer, v openfl
 	if err := sendHello(f, w); err != nil {
 		return errors.Wrap(err, "failed to send HELLO")
 	}
+	if err := sendRoleRequest(f, w, openflow.RoleMaster); err != nil {
+		return errors.Wrap(err, "failed to send ROLE_REQUEST")
+	}
 	if err := sendSetConfig(f, w); err != nil {
 		return errors.Wrap(err, "failed to send SET_CONFIG")
 	}
@@ -54,20 +55,38 @@ func (r *of13Session) OnHello(f openflow.Factory, w transceiver.Writer, v openfl
 	if err := sendBarrierRequest(f, w); err != nil {
 		return errors.Wrap(err, "failed to send BARRIER_REQUEST")
 	}
-	if err := sendRemovingAllFlows(f, w); err != nil {
-		return errors.Wrap(err, "failed to send FLOW_MOD to remove all flows")
+	if err := r.resetFlows(f, w); err != nil {
+		return err
 	}
-	// Make sure that the installed flows are removed before setTableMiss() is called
+	if err := sendDescriptionRequest(f, w); err != nil {
+		return errors.Wrap(err, "failed to send DESCRIPTION_REQUEST")
+	}
+	// Make sure that DESCRIPTION_REPLY is received before PORT_DESCRIPTION_REPLY
 	if err := sendBarrierRequest(f, w); err != nil {
 		return errors.Wrap(err, "failed to send BARRIER_REQUEST")
 	}
-	if err := setARPSender(f, w); err != nil {
-		return errors.Wrap(err, "failed to set ARP sender flow")
+	if err := sendPortDescriptionRequest(f, w); err != nil {
+		return errors.Wrap(err, "failed to send DESCRIPTION_REQUEST")
+	}
+
+	return nil
+}
+
+// onStandbyHello starts the session as a slave, which only queries the device
+// as the slave cannot modify it.
+func (r *of13Session) onStandbyHello(f openflow.Factory, w transceiver.Writer) error {
+	if err := sendHello(f, w); err != nil {
+		return errors.Wrap(err, "failed to send HELLO")
+	}
+	if err := sendRoleRequest(f, w, openflow.RoleSlave); err != nil {
+		return errors.Wrap(err, "failed to send ROLE_REQUEST")
+	}
+	if err := sendFeaturesRequest(f, w); err != nil {
+		return errors.Wrap(err, "failed to send FEATURE_REQUEST")
 	}
 	if err := sendDescriptionRequest(f, w); err != nil {
 		return errors.Wrap(err, "failed to send DESCRIPTION_REQUEST")
 	}
-	// Make sure that DESCRIPTION_REPLY is received before PORT_DESCRIPTION_REPLY
 	if err := sendBarrierRequest(f, w); err != nil {
 		return errors.Wrap(err, "failed to send BARRIER_REQUEST")
 	}
@@ -78,24 +97,47 @@ func (r *of13Session) OnHello(f openflow.Factory, w transceiver.Writer, v openfl
 	return nil
 }
 
-func (r *of13Session) OnError(f openflow.Factory, w transceiver.Writer, v openflow.Error) error {
-	return nil
+// promote makes us the master of the device, and then resets its flows as if
+// the device has just been connected.
+func (r *of13Session) promote(f openflow.Factory, w transceiver.Writer) error {
+	if err := sendRoleRequest(f, w, openflow.RoleMaster); err != nil {
+		return errors.Wrap(err, "failed to send ROLE_REQUEST")
+	}
+	if err := sendSetConfig(f, w); err != nil {
+		return errors.Wrap(err, "failed to send SET_CONFIG")
+	}
+
+	return r.resetFlows(f, w)
 }
 
-func (r *of13Session) OnFeaturesReply(f openflow.Factory, w transceiver.Writer, v openflow.FeaturesReply) error {
+// resetFlows removes all the flows installed on the device, and then installs
+// the default ones except the table-miss flows, which are installed when the
+// description of the device is known.
+func (r *of13Session) resetFlows(f openflow.Factory, w transceiver.Writer) error {
+	if err := sendRemovingAllFlows(f, w); err != nil {
+		return errors.Wrap(err, "failed to send FLOW_MOD to remove all flows")
+	}
+	// Make sure that the installed flows are removed before setTableMiss() is called
+	if err := sendBarrierRequest(f, w); err != nil {
+		return errors.Wrap(err, "failed to send BARRIER_REQUEST")
+	}
+	if err := setARPSender(f, w); err != nil {
+		return errors.Wrap(err, "failed to set ARP sender flow")
+	}
+
 	return nil
 }
 
-func (r *of13Session) OnGetConfigReply(f openflow.Factory, w transceiver.Writer, v openflow.GetConfigReply) error {
+func (r *of13Session) OnError(f openflow.Factory, w transceiver.Writer, v openflow.Error) error {
 	return nil
 }
 
-func isHP2920_24G(msg openflow.DescReply) bool {
-	return strings.HasPrefix(msg.Manufacturer(), "HP") && strings.HasPrefix(msg.Hardware(), "2920-24G")
+func (r *of13Session) OnFeaturesReply(f openflow.Factory, w transceiver.Writer, v openflow.FeaturesReply) error {
+	return nil
 }
 
-func isAS460054_T(msg openflow.DescReply) bool {
-	return strings.Contains(msg.Hardware(), "AS4600-54T")
+func (r *of13Session) OnGetConfigReply(f openflow.Factory, w transceiver.Writer, v openflow.GetConfigReply) error {
+	return nil
 }
 
 func (r *of13Session) setTableMiss(f openflow.Factory, w transceiver.Writer, tableID uint8, inst openflow.Instruction) error {
@@ -122,92 +164,48 @@ func (r *of13Session) setTableMiss(f openflow.Factory, w transceiver.Writer, tab
 	return w.Write(msg)
 }
 
-func (r *of13Session) setHP2920TableMiss(f openflow.Factory, w transceiver.Writer) error {
-	// Table-100 is a hardware table, and Table-200 is a software table
-	// that has very low performance.
+// setTableMisses chains the tables by the table-miss flows, and the last one
+// sends the packets to the controller.
+func (r *of13Session) setTableMisses(f openflow.Factory, w transceiver.Writer, tables []uint8) error {
 	inst, err := f.NewInstruction()
 	if err != nil {
 		return err
 	}
 
-	// 0 -> 100
-	inst.GotoTable(100)
-	if err := r.setTableMiss(f, w, 0, inst); err != nil {
-		return errors.Wrap(err, "failed to set table_miss flow entry")
-	}
-	// 100 -> 200
-	inst.GotoTable(200)
-	if err := r.setTableMiss(f, w, 100, inst); err != nil {
-		return errors.Wrap(err, "failed to set table_miss flow entry")
-	}
-
-	// 200 -> Controller
-	outPort := openflow.NewOutPort()
-	outPort.SetController()
-	action, err := f.NewAction()
-	if err != nil {
-		return err
-	}
-	action.SetOutPort(outPort)
-
-	inst.ApplyAction(action)
-	if err := r.setTableMiss(f, w, 200, inst); err != nil {
-		return errors.Wrap(err, "failed to set table_miss flow entry")
-	}
-	r.device.setFlowTableID(200)
-
-	return nil
-}
-
-func (r *of13Session) setAS4600TableMiss(f openflow.Factory, w transceiver.Writer) error {
-	// FIXME:
-	// AS460054-T gives an error (type=5, code=1) that means TABLE_FULL
-	// when we install a table-miss flow on Table-0 after we delete all
-	// flows already installed from the switch. Is this a bug of this switch??
-
-	return nil
-}
-
-func (r *of13Session) setDefaultTableMiss(f openflow.Factory, w transceiver.Writer) error {
-	inst, err := f.NewInstruction()
-	if err != nil {
-		return err
-	}
-
-	// 0 -> Controller
-	outPort := openflow.NewOutPort()
-	outPort.SetController()
-	action, err := f.NewAction()
-	if err != nil {
-		return err
-	}
-	action.SetOutPort(outPort)
-
-	inst.ApplyAction(action)
-	if err := r.setTableMiss(f, w, 0, inst); err != nil {
-		return errors.Wrap(err, "failed to set table_miss flow entry")
+	for i, id := range tables {
+		if i < len(tables)-1 {
+			// Current -> Next
+			inst.GotoTable(tables[i+1])
+		} else {
+			// Last -> Controller
+			outPort := openflow.NewOutPort()
+			outPort.SetController()
+			action, err := f.NewAction()
+			if err != nil {
+				return err
+			}
+			action.SetOutPort(outPort)
+			inst.ApplyAction(action)
+		}
+		if err := r.setTableMiss(f, w, id, inst); err != nil {
+			return errors.Wrap(err, "failed to set table_miss flow entry")
+		}
 	}
-	r.device.setFlowTableID(0)
+	r.device.setFlowTableID(tables[len(tables)-1])
 
 	return nil
 }
 
 func (r *of13Session) OnDescReply(f openflow.Factory, w transceiver.Writer, v openflow.DescReply) error {
-	var err error
-
 	// FIXME:
 	// Implement general routines for various table structures of OF1.3 switches
 	// based on table features reply
-	switch {
-	case isHP2920_24G(v):
-		err = r.setHP2920TableMiss(f, w)
-	case isAS460054_T(v):
-		err = r.setAS4600TableMiss(f, w)
-	default:
-		err = r.setDefaultTableMiss(f, w)
+	quirk := r.device.Quirk()
+	if quirk.NoTableMiss {
+		return nil
 	}
 
-	return err
+	return r.setTableMisses(f, w, quirk.tables())
 }
 
 func (r *of13Session) OnPortDescReply(f openflow.Factory, w transceiver.Writer, v openflow.PortDescReply) error {
@@ -243,6 +241,18 @@ func (r *of13Session) OnFlowRemoved(f openflow.Factory, w transceiver.Writer, v
 	return nil
 }
 
+func (r *of13Session) OnFlowStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.FlowStatsReply) error {
+	return nil
+}
+
+func (r *of13Session) OnPortStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.PortStatsReply) error {
+	return nil
+}
+
 func (r *of13Session) OnPacketIn(f openflow.Factory, w transceiver.Writer, v openflow.PacketIn) error {
 	return nil
 }
+
+func (r *of13Session) OnRoleReply(f openflow.Factory, w transceiver.Writer, v openflow.RoleReply) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"hash/fnv"
+
+	"github.com/superkkt/cherry/metrics"
+)
+
+const (
+	DefaultPacketInWorkers = 32
+	// Number of the PACKET_INs waiting for each worker. The session that
+	// receives more PACKET_INs than this waits for the worker, which also
+	// makes its device wait for us through the TCP flow control.
+	packetInQueueSize = 256
+)
+
+var queuedPacketIns = metrics.NewGauge("openflow_packet_ins_queued", "Number of the PACKET_IN messages waiting for the workers.")
+
+// packetInPool processes the PACKET_INs of all the sessions on a fixed number
+// of workers, so that a slow processor only delays the PACKET_INs assigned to
+// its worker instead of all the ones from the same device. The PACKET_INs from
+// the same ingress port are always assigned to the same worker, which keeps
+// their order.
+type packetInPool struct {
+	queues []chan func()
+}
+
+func newPacketInPool(workers int) *packetInPool {
+	if workers <= 0 {
+		panic("invalid number of the PACKET_IN workers")
+	}
+
+	v := &packetInPool{queues: make([]chan func(), workers)}
+	for i := range v.queues {
+		v.queues[i] = make(chan func(), packetInQueueSize)
+		go v.work(v.queues[i])
+	}
+
+	return v
+}
+
+func (r *packetInPool) work(queue chan func()) {
+	for f := range queue {
+		queuedPacketIns.Add(-1)
+		f()
+	}
+}
+
+// submit queues f to the worker of the ingress port whose ID is portID. It
+// blocks while the queue of the worker is full.
+func (r *packetInPool) submit(portID string, f func()) {
+	h := fnv.New32a()
+	h.Write([]byte(portID))
+
+	queuedPacketIns.Add(1)
+	r.queues[h.Sum32()%uint32(len(r.queues))] <- f
+}
@@ -0,0 +1,89 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/superkkt/cherry/graph"
+)
+
+// PathSelection is how Finder.Path chooses a path among two devices.
+type PathSelection int
+
+const (
+	// PathByHops follows the spanning tree, which is the default.
+	PathByHops PathSelection = iota
+	// PathByCongestion chooses the path of the least cost over all the links,
+	// including the ones blocked by the spanning tree, where the links of the
+	// higher utilization and latency cost more. The cost of the same link
+	// differs by the direction.
+	PathByCongestion
+)
+
+// ParsePathSelection parses hop or congestion.
+func ParsePathSelection(s string) (PathSelection, error) {
+	switch strings.ToLower(s) {
+	case "hop":
+		return PathByHops, nil
+	case "congestion":
+		return PathByCongestion, nil
+	default:
+		return 0, fmt.Errorf("invalid path selection: %v", s)
+	}
+}
+
+func (r PathSelection) String() string {
+	switch r {
+	case PathByHops:
+		return "hop"
+	case PathByCongestion:
+		return "congestion"
+	default:
+		return fmt.Sprintf("PathSelection(%d)", int(r))
+	}
+}
+
+// maxUtilization caps the utilization of a link so that its cost is finite.
+const maxUtilization = 0.99
+
+// congestionCost returns the cost of e traversed from p. A hop costs one, which
+// grows as 1/(1-u) by the utilization u of the link like the delay of a queue,
+// plus the latency of the link in milliseconds. The unknown utilization and
+// latency are regarded as zero.
+func congestionCost(p graph.Point, e graph.Edge) float64 {
+	l := e.(*link)
+	from, to := l.ports[0], l.ports[1]
+	if from.ID() != p.ID() {
+		from, to = to, from
+	}
+
+	cost := 1.0
+	if t, ok := newLinkTraffic(from, to); ok {
+		cost = 1 / (1 - math.Min(t.Utilization, maxUtilization))
+	}
+
+	return cost + float64(l.Latency())/float64(time.Millisecond)
+}
@@ -0,0 +1,450 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"crypto/rand"
+	"encoding"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// A path trace injects a probe into a device as if it is received from a port,
+// and then follows the probe through the devices by the traps, which are the
+// flows sending the probe to the controller when it enters a device from the
+// other device. The probe is told apart from the other packets by its source
+// MAC address, which is a random marker of each trace. Every trapped probe is
+// resubmitted to the flow table of the device that has trapped it.
+
+const (
+	// The traps are above all the other flows.
+	trapPriority = 0xFFFF
+	// The traps are removed when the trace is done, and expire by themselves
+	// if the removal is lost.
+	trapHardTimeout = 30
+	// Time for the devices to install the traps before injecting the probe,
+	// which are sent to the devices on different connections.
+	trapSettleTime = 200 * time.Millisecond
+	// The trace is done if the probe is not trapped during traceIdleTime, or
+	// traceTimeout has elapsed since the injection.
+	traceIdleTime = time.Second
+	traceTimeout  = 10 * time.Second
+)
+
+// PathTrace is the path of a probe injected into the port of a device.
+type PathTrace struct {
+	Probe       string     `json:"probe"` // Source MAC address of the probe.
+	Hops        []TraceHop `json:"hops"`
+	Loop        bool       `json:"loop"`
+	Complete    bool       `json:"complete"`              // False if timed out while the probe was moving.
+	Destination string     `json:"destination,omitempty"` // Port where the destination MAC address is found.
+}
+
+// TraceHop is a device that the probe has entered from InPort. OutPorts are
+// the ports that the probe has left to the other devices. The probe has left to
+// a host, or has been dropped, if a hop has no OutPorts.
+type TraceHop struct {
+	DPID         uint64   `json:"dpid"`
+	InPort       uint32   `json:"in_port"`
+	OutPorts     []uint32 `json:"out_ports"`
+	ToController bool     `json:"to_controller,omitempty"` // Sent to the controller by the flow table, e.g., table-miss.
+	Loop         bool     `json:"loop,omitempty"`          // Entered again the device that the probe has already passed.
+}
+
+type traceEvent struct {
+	device *Device
+	inPort uint32
+	data   []byte
+}
+
+// pathTracer holds the ongoing traces, which are keyed by their markers.
+type pathTracer struct {
+	// active is read without the mutex by every PACKET_IN.
+	active int32
+
+	mutex  sync.Mutex
+	traces map[string]chan traceEvent
+}
+
+func newPathTracer() *pathTracer {
+	return &pathTracer{
+		traces: make(map[string]chan traceEvent),
+	}
+}
+
+func (r *pathTracer) add(marker net.HardwareAddr) chan traceEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c := make(chan traceEvent, 256)
+	r.traces[marker.String()] = c
+	atomic.AddInt32(&r.active, 1)
+
+	return c
+}
+
+func (r *pathTracer) remove(marker net.HardwareAddr) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.traces, marker.String())
+	atomic.AddInt32(&r.active, -1)
+}
+
+// intercept takes the PACKET_IN if it is a probe of an ongoing trace, so that
+// the probe is not processed by the applications.
+func (r *pathTracer) intercept(d *Device, inPort uint32, data []byte) bool {
+	if atomic.LoadInt32(&r.active) == 0 || len(data) < 14 {
+		return false
+	}
+
+	r.mutex.Lock()
+	c, ok := r.traces[net.HardwareAddr(data[6:12]).String()]
+	r.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case c <- traceEvent{device: d, inPort: inPort, data: append([]byte(nil), data...)}:
+	default:
+		logger.Warningf("dropping a trapped probe from %v:%v: too many probes", d.ID(), inPort)
+	}
+
+	return true
+}
+
+// trace injects the probe into src, and then follows it. The source MAC address
+// of the probe is replaced with the marker of this trace.
+func (r *pathTracer) trace(finder Finder, src *Port, probe []byte) (*PathTrace, error) {
+	marker, err := newProbeMarker()
+	if err != nil {
+		return nil, err
+	}
+	copy(probe[6:12], marker)
+	events := r.add(marker)
+	defer r.remove(marker)
+
+	// Peers of the ports that have the traps.
+	peers := make(map[string]*Port)
+	traps := make(map[*Device][]*Port)
+	for _, v := range finder.Links() {
+		for i, p := range v {
+			// The probe injected into src should not be trapped at once.
+			if p.ID() == src.ID() {
+				continue
+			}
+			peers[p.ID()] = v[1-i]
+			traps[p.Device()] = append(traps[p.Device()], p)
+		}
+	}
+	defer func() {
+		for d, ports := range traps {
+			if err := sendTraps(d, openflow.FlowDeleteStrict, marker, ports); err != nil {
+				logger.Warningf("failed to remove the path trace traps on %v: %v", d.ID(), err)
+			}
+		}
+	}()
+	for d, ports := range traps {
+		if err := sendTraps(d, openflow.FlowAdd, marker, ports); err != nil {
+			return nil, fmt.Errorf("failed to install the traps on %v: %v", d.ID(), err)
+		}
+	}
+	time.Sleep(trapSettleTime)
+
+	if err := src.Device().Resubmit(src, probe); err != nil {
+		return nil, err
+	}
+	t := &pathTrace{
+		result: &PathTrace{
+			Probe: marker.String(),
+			Hops:  []TraceHop{newTraceHop(src.Device(), src.Number())},
+		},
+		peers:   peers,
+		visited: map[*Device]int{src.Device(): 0},
+	}
+	if node, _, err := finder.Node(probe[0:6]); err == nil && node != nil {
+		t.result.Destination = node.Port().ID()
+	}
+
+	deadline := time.After(traceTimeout)
+	idle := time.NewTimer(traceIdleTime)
+	defer idle.Stop()
+	for {
+		select {
+		case v := <-events:
+			t.follow(v)
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(traceIdleTime)
+		case <-idle.C:
+			t.result.Complete = true
+			return t.result, nil
+		case <-deadline:
+			return t.result, nil
+		}
+	}
+}
+
+// pathTrace is the state of a trace while following its probe.
+type pathTrace struct {
+	result *PathTrace
+	peers  map[string]*Port
+	// Indexes of the hops of the devices in result.
+	visited map[*Device]int
+}
+
+func (r *pathTrace) follow(v traceEvent) {
+	var peer *Port
+	if p := v.device.Port(v.inPort); p != nil {
+		peer = r.peers[p.ID()]
+	}
+	if peer == nil {
+		// Not trapped, but sent to the controller by the flow table.
+		if i, ok := r.visited[v.device]; ok {
+			r.result.Hops[i].ToController = true
+		}
+		return
+	}
+	if i, ok := r.visited[peer.Device()]; ok {
+		r.result.Hops[i].OutPorts = appendPortNumber(r.result.Hops[i].OutPorts, peer.Number())
+	}
+
+	hop := newTraceHop(v.device, v.inPort)
+	if _, ok := r.visited[v.device]; ok {
+		// Stop here, otherwise the probe would go round the loop forever.
+		hop.Loop = true
+		r.result.Loop = true
+		r.result.Hops = append(r.result.Hops, hop)
+		return
+	}
+	r.visited[v.device] = len(r.result.Hops)
+	r.result.Hops = append(r.result.Hops, hop)
+
+	// The probe is resubmitted from the controller, as the trap would take it
+	// again if it is resubmitted from the port.
+	if err := v.device.Resubmit(nil, v.data); err != nil {
+		logger.Warningf("failed to resubmit the probe to %v: %v", v.device.ID(), err)
+	}
+}
+
+func newTraceHop(d *Device, inPort uint32) TraceHop {
+	return TraceHop{
+		DPID:     d.Features().DPID,
+		InPort:   inPort,
+		OutPorts: []uint32{},
+	}
+}
+
+func appendPortNumber(ports []uint32, num uint32) []uint32 {
+	for _, v := range ports {
+		if v == num {
+			return ports
+		}
+	}
+
+	return append(ports, num)
+}
+
+// newProbeMarker returns a random unicast MAC address that is locally
+// administered.
+func newProbeMarker() (net.HardwareAddr, error) {
+	v := make([]byte, 6)
+	if _, err := rand.Read(v); err != nil {
+		return nil, err
+	}
+	v[0] = (v[0] | 0x02) &^ 0x01
+
+	return net.HardwareAddr(v), nil
+}
+
+// sendTraps adds or removes the traps of the probe marked by marker on ports.
+func sendTraps(d *Device, cmd openflow.FlowModCmd, marker net.HardwareAddr, ports []*Port) error {
+	f := d.Factory()
+	if f == nil {
+		return ErrClosedDevice
+	}
+
+	msgs := make([]encoding.BinaryMarshaler, 0, len(ports))
+	for _, p := range ports {
+		inPort := openflow.NewInPort()
+		inPort.SetValue(p.Number())
+		match, err := f.NewMatch()
+		if err != nil {
+			return err
+		}
+		match.SetInPort(inPort)
+		match.SetSrcMAC(marker)
+
+		flow, err := f.NewFlowMod(cmd)
+		if err != nil {
+			return err
+		}
+		flow.SetTableID(d.FlowTableID())
+		flow.SetPriority(trapPriority)
+		flow.SetFlowMatch(match)
+		if cmd == openflow.FlowAdd {
+			outPort := openflow.NewOutPort()
+			outPort.SetController()
+			action, err := f.NewAction()
+			if err != nil {
+				return err
+			}
+			action.SetOutPort(outPort)
+			inst, err := f.NewInstruction()
+			if err != nil {
+				return err
+			}
+			inst.ApplyAction(action)
+			flow.SetFlowInstruction(inst)
+			flow.SetHardTimeout(trapHardTimeout)
+		} else {
+			outPort := openflow.NewOutPort()
+			outPort.SetNone()
+			flow.SetOutPort(outPort)
+		}
+		msgs = append(msgs, flow)
+	}
+
+	// The probes are trapped even in the dry run.
+	return d.sendMessages("", msgs, false)
+}
+
+// traceProbe describes the probe of a trace. The probe is an IPv4 packet if
+// DstIP is specified, otherwise an Ethernet frame of an experimental EtherType.
+type traceProbe struct {
+	DstMAC   string `json:"dst_mac"`
+	SrcIP    string `json:"src_ip"`
+	DstIP    string `json:"dst_ip"`
+	Protocol string `json:"protocol"` // icmp (default), tcp, or udp.
+	SrcPort  uint16 `json:"src_port"`
+	DstPort  uint16 `json:"dst_port"`
+}
+
+// IEEE Std 802 - Local Experimental EtherType 1.
+const probeEtherType = 0x88B5
+
+var probePayload = []byte("Cherry path trace probe")
+
+// frame returns the Ethernet frame of the probe, whose source MAC address is
+// left to be filled.
+func (r traceProbe) frame() ([]byte, error) {
+	dstMAC, err := net.ParseMAC(r.DstMAC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination MAC address: %v", err)
+	}
+	eth := protocol.Ethernet{
+		SrcMAC:  make(net.HardwareAddr, 6),
+		DstMAC:  dstMAC,
+		Type:    probeEtherType,
+		Payload: probePayload,
+	}
+	if r.DstIP == "" {
+		return eth.MarshalBinary()
+	}
+
+	srcIP, dstIP := net.ParseIP(r.SrcIP).To4(), net.ParseIP(r.DstIP).To4()
+	if srcIP == nil || dstIP == nil {
+		return nil, errors.New("invalid or missing IPv4 addresses")
+	}
+	var proto uint8
+	var payload []byte
+	switch r.Protocol {
+	case "", "icmp":
+		proto = 1
+		payload, err = protocol.NewICMPEchoRequest(0, 0, probePayload).MarshalBinary()
+	case "tcp":
+		proto = 6
+		tcp := protocol.TCP{
+			SrcPort:    r.SrcPort,
+			DstPort:    r.DstPort,
+			Flags:      0x02, // SYN
+			WindowSize: 0xFFFF,
+		}
+		tcp.SetPseudoHeader(srcIP, dstIP)
+		payload, err = tcp.MarshalBinary()
+	case "udp":
+		proto = 17
+		udp := protocol.UDP{
+			SrcPort: r.SrcPort,
+			DstPort: r.DstPort,
+			Length:  uint16(8 + len(probePayload)),
+			Payload: probePayload,
+		}
+		udp.SetPseudoHeader(srcIP, dstIP)
+		payload, err = udp.MarshalBinary()
+	default:
+		return nil, fmt.Errorf("unknown protocol: %v", r.Protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ip, err := protocol.NewIPv4(srcIP, dstIP, proto, payload).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	eth.Type = 0x0800
+	eth.Payload = ip
+
+	return eth.MarshalBinary()
+}
+
+// tracePath injects a probe into the port, and then reports the devices and the
+// ports that the probe has passed.
+func (r *Controller) tracePath(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, ok := r.findDevicePort(w, req)
+	if !ok {
+		return
+	}
+	var probe traceProbe
+	if err := req.DecodeJsonPayload(&probe); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	frame, err := probe.frame()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := r.tracer.trace(r.topo, p, frame)
+	if err != nil {
+		logger.Errorf("failed to trace the path from %v: %v", p.ID(), err)
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	logger.Infof("traced the path from %v: %v hops", p.ID(), len(result.Hops))
+
+	w.WriteJson(result)
+}
@@ -24,6 +24,7 @@ package network
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/superkkt/cherry/graph"
 	"github.com/superkkt/cherry/openflow"
@@ -35,6 +36,21 @@ type Port struct {
 	device *Device
 	number uint32
 	value  openflow.Port
+	// The last counters polled from the device, and the rates between them and
+	// the previous ones.
+	counters  openflow.PortStats
+	countedAt time.Time
+	rates     *PortRates
+}
+
+// PortRates are the rates of the counters of a port per second.
+type PortRates struct {
+	RxBps    float64 `json:"rx_bps"`
+	TxBps    float64 `json:"tx_bps"`
+	RxPps    float64 `json:"rx_pps"`
+	TxPps    float64 `json:"tx_pps"`
+	RxErrors float64 `json:"rx_errors"`
+	TxErrors float64 `json:"tx_errors"`
 }
 
 func NewPort(d *Device, num uint32) *Port {
@@ -83,3 +99,57 @@ func (r *Port) SetValue(p openflow.Port) {
 
 	r.value = p
 }
+
+// updateCounters calculates the rates of the port from the counters polled at t.
+func (r *Port) updateCounters(v openflow.PortStats, t time.Time) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prev, prevAt := r.counters, r.countedAt
+	r.counters, r.countedAt = v, t
+	elapsed := t.Sub(prevAt).Seconds()
+	// The counters have been reset if they decrease, e.g., by a reboot.
+	if prevAt.IsZero() || elapsed <= 0 || v.RxBytes < prev.RxBytes || v.TxBytes < prev.TxBytes ||
+		v.RxPackets < prev.RxPackets || v.TxPackets < prev.TxPackets ||
+		v.RxErrors < prev.RxErrors || v.TxErrors < prev.TxErrors {
+		r.rates = nil
+		return
+	}
+	r.rates = &PortRates{
+		RxBps:    float64(v.RxBytes-prev.RxBytes) * 8 / elapsed,
+		TxBps:    float64(v.TxBytes-prev.TxBytes) * 8 / elapsed,
+		RxPps:    float64(v.RxPackets-prev.RxPackets) / elapsed,
+		TxPps:    float64(v.TxPackets-prev.TxPackets) / elapsed,
+		RxErrors: float64(v.RxErrors-prev.RxErrors) / elapsed,
+		TxErrors: float64(v.TxErrors-prev.TxErrors) / elapsed,
+	}
+}
+
+// Counters returns the counters of the port polled at the last port stats
+// polling and when they were polled, or false if they have not been polled yet.
+func (r *Port) Counters() (openflow.PortStats, time.Time, bool) {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.countedAt.IsZero() {
+		return openflow.PortStats{}, time.Time{}, false
+	}
+
+	return r.counters, r.countedAt, true
+}
+
+// Rates returns the rates of the counters during the last port stats polling
+// interval, or false if they are not known yet.
+func (r *Port) Rates() (PortRates, bool) {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.rates == nil {
+		return PortRates{}, false
+	}
+
+	return *r.rates, true
+}
@@ -0,0 +1,55 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"errors"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// pprofRoutes returns the REST routes of the runtime profiles served by net/http/pprof.
+func pprofRoutes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/debug/pprof/", pprofHandler(pprof.Index)),
+		rest.Get("/debug/pprof/cmdline", pprofHandler(pprof.Cmdline)),
+		rest.Get("/debug/pprof/profile", pprofHandler(pprof.Profile)),
+		rest.Get("/debug/pprof/symbol", pprofHandler(pprof.Symbol)),
+		rest.Post("/debug/pprof/symbol", pprofHandler(pprof.Symbol)),
+		rest.Get("/debug/pprof/trace", pprofHandler(pprof.Trace)),
+		// pprof.Index serves the named profiles such as heap and goroutine.
+		rest.Get("/debug/pprof/:profile", pprofHandler(pprof.Index)),
+	}
+}
+
+func pprofHandler(f http.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, req *rest.Request) {
+		writer, ok := w.(http.ResponseWriter)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, errors.New("raw response is not supported"))
+			return
+		}
+		f(writer, req.Request)
+	}
+}
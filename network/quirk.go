@@ -0,0 +1,199 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Quirk adjusts how the controller handles the switch models that do not
+// behave as the OpenFlow specification says. The models are matched by the
+// descriptions of the switches.
+type Quirk struct {
+	Name string `json:"name"`
+	// Manufacturer, Hardware and Software are the regular expressions that
+	// match the descriptions. An empty one matches any.
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Hardware     string `json:"hardware,omitempty"`
+	Software     string `json:"software,omitempty"`
+	// Tables are chained by the table-miss flows in order, and the last one
+	// sends the packets to the controller and has the flows of the controller.
+	// Default is table 0 only. It is only for OpenFlow 1.3.
+	Tables []uint8 `json:"tables,omitempty"`
+	// NoTableMiss does not install the table-miss flows at all.
+	NoTableMiss bool `json:"no_table_miss,omitempty"`
+	// NoBarrier does not send BARRIER_REQUEST after the messages of the
+	// applications.
+	NoBarrier bool `json:"no_barrier,omitempty"`
+	// NoDecrementTTL does not use the action that decrements the IP TTL.
+	NoDecrementTTL bool `json:"no_decrement_ttl,omitempty"`
+
+	manufacturer, hardware, software *regexp.Regexp
+}
+
+// builtinQuirks are the workarounds of the switch models that have been tested.
+var builtinQuirks = []Quirk{
+	{
+		// Table-100 is a hardware table, and Table-200 is a software table
+		// that has very low performance.
+		Name:         "hp2920",
+		Manufacturer: "^HP",
+		Hardware:     "^2920-24G",
+		Tables:       []uint8{0, 100, 200},
+	},
+	{
+		// FIXME:
+		// AS460054-T gives an error (type=5, code=1) that means TABLE_FULL
+		// when we install a table-miss flow on Table-0 after we delete all
+		// flows already installed from the switch. Is this a bug of this switch??
+		Name:        "as4600",
+		Hardware:    "AS4600-54T",
+		NoTableMiss: true,
+	},
+}
+
+func init() {
+	for i := range builtinQuirks {
+		if err := builtinQuirks[i].compile(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ParseQuirk parses spec, which is the options of a quirk separated by
+// semicolon: manufacturer=REGEXP, hardware=REGEXP, software=REGEXP,
+// tables=ID/ID/..., no_table_miss, no_barrier and no_decrement_ttl, e.g.,
+// "hardware=^2920-24G; tables=0/100/200".
+func ParseQuirk(name, spec string) (Quirk, error) {
+	v := Quirk{Name: name}
+	for _, opt := range strings.Split(spec, ";") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		key, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			key, value = strings.TrimSpace(opt[:i]), strings.TrimSpace(opt[i+1:])
+		}
+		switch key {
+		case "manufacturer":
+			v.Manufacturer = value
+		case "hardware":
+			v.Hardware = value
+		case "software":
+			v.Software = value
+		case "tables":
+			for _, s := range strings.Split(value, "/") {
+				id, err := strconv.ParseUint(s, 10, 8)
+				if err != nil || id > 254 {
+					return Quirk{}, fmt.Errorf("invalid table ID of quirk %v: %v", name, s)
+				}
+				v.Tables = append(v.Tables, uint8(id))
+			}
+		case "no_table_miss":
+			v.NoTableMiss = true
+		case "no_barrier":
+			v.NoBarrier = true
+		case "no_decrement_ttl":
+			v.NoDecrementTTL = true
+		default:
+			return Quirk{}, fmt.Errorf("unknown option of quirk %v: %v", name, opt)
+		}
+	}
+	if v.Manufacturer == "" && v.Hardware == "" && v.Software == "" {
+		return Quirk{}, fmt.Errorf("quirk %v matches all the switches", name)
+	}
+	if err := v.compile(); err != nil {
+		return Quirk{}, err
+	}
+
+	return v, nil
+}
+
+func (r *Quirk) compile() (err error) {
+	for _, v := range []struct {
+		expr string
+		re   **regexp.Regexp
+	}{{r.Manufacturer, &r.manufacturer}, {r.Hardware, &r.hardware}, {r.Software, &r.software}} {
+		if v.expr == "" {
+			continue
+		}
+		if *v.re, err = regexp.Compile(v.expr); err != nil {
+			return fmt.Errorf("invalid regular expression of quirk %v: %v", r.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Quirk) match(d Descriptions) bool {
+	if r.Name == "" {
+		return false
+	}
+
+	return (r.manufacturer == nil || r.manufacturer.MatchString(d.Manufacturer)) &&
+		(r.hardware == nil || r.hardware.MatchString(d.Hardware)) &&
+		(r.software == nil || r.software.MatchString(d.Software))
+}
+
+// tables returns the tables chained by the table-miss flows.
+func (r *Quirk) tables() []uint8 {
+	if len(r.Tables) == 0 {
+		return []uint8{0}
+	}
+
+	return r.Tables
+}
+
+// matchQuirk returns the first quirk in quirks that matches d, or the zero
+// Quirk if none.
+func matchQuirk(quirks []Quirk, d Descriptions) Quirk {
+	for _, v := range quirks {
+		if v.match(d) {
+			return v
+		}
+	}
+
+	return Quirk{}
+}
+
+// SetQuirks adds the quirks, which are matched before the built-in ones in
+// order of their names. A quirk replaces the built-in one of the same name. It
+// should be called before adding the first connection.
+func (r *Controller) SetQuirks(quirks []Quirk) {
+	v := append([]Quirk(nil), quirks...)
+	sort.Slice(v, func(i, j int) bool { return v[i].Name < v[j].Name })
+	for _, q := range builtinQuirks {
+		replaced := false
+		for _, p := range quirks {
+			replaced = replaced || p.Name == q.Name
+		}
+		if !replaced {
+			v = append(v, q)
+		}
+	}
+	r.quirks = v
+}
@@ -0,0 +1,77 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuirk(t *testing.T) {
+	v, err := ParseQuirk("edgecore", "hardware=^AS5712; tables=0/60; no_barrier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Hardware != "^AS5712" || !reflect.DeepEqual(v.Tables, []uint8{0, 60}) || !v.NoBarrier || v.NoTableMiss || v.NoDecrementTTL {
+		t.Fatalf("unexpected quirk: %+v", v)
+	}
+
+	for _, spec := range []string{
+		"",
+		"tables=0/60",
+		"hardware=[",
+		"hardware=^AS5712; tables=0/255",
+		"hardware=^AS5712; no_such_option",
+	} {
+		if _, err := ParseQuirk("invalid", spec); err == nil {
+			t.Fatalf("expected an error: %v", spec)
+		}
+	}
+}
+
+func TestMatchQuirk(t *testing.T) {
+	c := &Controller{quirks: builtinQuirks}
+	hp := Descriptions{Manufacturer: "HP", Hardware: "2920-24G Switch", Software: "WB.16.02"}
+	if v := matchQuirk(c.quirks, hp); v.Name != "hp2920" || !reflect.DeepEqual(v.tables(), []uint8{0, 100, 200}) {
+		t.Fatalf("unexpected quirk: %+v", v)
+	}
+	if v := matchQuirk(c.quirks, Descriptions{Manufacturer: "Nicira, Inc.", Hardware: "Open vSwitch"}); v.Name != "" || !reflect.DeepEqual(v.tables(), []uint8{0}) {
+		t.Fatalf("unexpected quirk: %+v", v)
+	}
+
+	// A configured quirk replaces the built-in one of the same name.
+	v, err := ParseQuirk("hp2920", "manufacturer=^HP; software=^WB\\.16; no_barrier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetQuirks([]Quirk{v})
+	if len(c.quirks) != len(builtinQuirks) {
+		t.Fatalf("unexpected number of quirks: %v", len(c.quirks))
+	}
+	if v := matchQuirk(c.quirks, hp); v.Name != "hp2920" || !v.NoBarrier || len(v.Tables) != 0 {
+		t.Fatalf("unexpected quirk: %+v", v)
+	}
+	hp.Software = "WB.15.18"
+	if v := matchQuirk(c.quirks, hp); v.Name != "" {
+		t.Fatalf("unexpected quirk: %+v", v)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// The flows installed or removed within auditGrace are not compared, as the
+// device may not have processed their FLOW_MODs yet.
+const auditGrace = 2 * time.Second
+
+var errIncompleteLedger = errors.New("too many flows to remember what we have installed")
+
+// FlowAudit is the difference between the flow table of a device and the flows
+// that we have installed on it.
+type FlowAudit struct {
+	Matched  int        `json:"matched"`
+	Orphans  []FlowInfo `json:"orphans"`            // On the device, but not installed by us.
+	Missing  []FlowInfo `json:"missing"`            // Installed by us, but not on the device.
+	Complete bool       `json:"complete"`           // False if the ledger has overflowed.
+	Repaired bool       `json:"repaired,omitempty"` // True if the difference has been fixed.
+
+	orphans []openflow.FlowStats
+	missing []openflow.FlowMod
+}
+
+func newFlowInfo(v openflow.FlowMod) FlowInfo {
+	return FlowInfo{
+		TableID:     v.TableID(),
+		Priority:    v.Priority(),
+		Cookie:      v.Cookie(),
+		IdleTimeout: v.IdleTimeout(),
+		HardTimeout: v.HardTimeout(),
+		Match:       matchFields(v.FlowMatch()),
+	}
+}
+
+// AuditFlows compares the flow table of d with the flows that we have installed
+// on d.
+func AuditFlows(d *Device) (*FlowAudit, error) {
+	match, err := d.Factory().NewMatch()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := d.FlowStats(match, flowStatsTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// The ledger is read after the stats, so that the flows installed in the
+	// meantime are within the grace period.
+	flows, complete := d.ledger.flows()
+
+	now := time.Now()
+	installed := make(map[string]openflow.FlowMod, len(flows))
+	for _, v := range flows {
+		if now.Sub(v.added) < auditGrace {
+			// Neither orphan nor missing.
+			installed[ledgerKey(v.flow.TableID(), v.flow.Priority(), v.fields)] = nil
+			continue
+		}
+		installed[ledgerKey(v.flow.TableID(), v.flow.Priority(), v.fields)] = v.flow
+	}
+
+	result := &FlowAudit{
+		Orphans:  []FlowInfo{},
+		Missing:  []FlowInfo{},
+		Complete: complete,
+	}
+	for _, v := range stats {
+		fields := matchFields(v.Match)
+		key := ledgerKey(v.TableID, v.Priority, fields)
+		if _, ok := installed[key]; ok {
+			delete(installed, key)
+			result.Matched++
+			continue
+		}
+		if time.Duration(v.DurationSec)*time.Second < auditGrace {
+			continue
+		}
+		result.orphans = append(result.orphans, v)
+		result.Orphans = append(result.Orphans, FlowInfo{
+			TableID:     v.TableID,
+			Priority:    v.Priority,
+			Cookie:      v.Cookie,
+			IdleTimeout: v.IdleTimeout,
+			HardTimeout: v.HardTimeout,
+			Duration:    v.DurationSec,
+			PacketCount: v.PacketCount,
+			ByteCount:   v.ByteCount,
+			Match:       fields,
+		})
+	}
+	for _, v := range installed {
+		if v == nil {
+			continue
+		}
+		result.missing = append(result.missing, v)
+		result.Missing = append(result.Missing, newFlowInfo(v))
+	}
+
+	return result, nil
+}
+
+// RepairFlows removes the orphan flows of audit from d, and installs the
+// missing ones again.
+func RepairFlows(d *Device, audit *FlowAudit) error {
+	if !audit.Complete {
+		// The flows not remembered would be removed as orphans.
+		return errIncompleteLedger
+	}
+	if len(audit.orphans) == 0 && len(audit.missing) == 0 {
+		return nil
+	}
+
+	msgs := make([]encoding.BinaryMarshaler, 0, len(audit.orphans)+len(audit.missing))
+	for _, v := range audit.orphans {
+		flowmod, err := d.Factory().NewFlowMod(openflow.FlowDeleteStrict)
+		if err != nil {
+			return err
+		}
+		port := openflow.NewOutPort()
+		port.SetNone()
+		flowmod.SetTableID(v.TableID)
+		flowmod.SetPriority(v.Priority)
+		flowmod.SetFlowMatch(v.Match)
+		flowmod.SetOutPort(port)
+		msgs = append(msgs, flowmod)
+	}
+	for _, v := range audit.missing {
+		msgs = append(msgs, v)
+	}
+	if err := d.SendMessages(msgs...); err != nil {
+		return err
+	}
+	audit.Repaired = true
+
+	return nil
+}
+
+func (r *Controller) auditFlows(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	d, ok := r.findDevice(w, req)
+	if !ok {
+		return
+	}
+
+	audit, err := AuditFlows(d)
+	if err != nil {
+		logger.Errorf("failed to audit the flows of %v: %v", d.ID(), err)
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.WriteJson(audit)
+}
+
+// reconcileFlows audits the flows of a device, and then repairs the difference.
+func (r *Controller) reconcileFlows(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	d, ok := r.findDevice(w, req)
+	if !ok {
+		return
+	}
+
+	audit, err := AuditFlows(d)
+	if err != nil {
+		logger.Errorf("failed to audit the flows of %v: %v", d.ID(), err)
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err := RepairFlows(d, audit); err != nil {
+		status := http.StatusServiceUnavailable
+		if err == errIncompleteLedger {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+	if audit.Repaired {
+		logger.Infof("reconciled the flows of %v: removed %v orphans and installed %v missing flows", d.ID(), len(audit.orphans), len(audit.missing))
+	}
+
+	w.WriteJson(audit)
+}
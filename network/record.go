@@ -0,0 +1,288 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// The PACKET_INs are recorded to a file, one JSON object per line, so that
+// they are replayed later to reproduce the behavior of the applications. Each
+// recording starts with the topology at the time, which is also replayed.
+
+// PacketInRecord is a line of the record file, which has either Topology or
+// the PACKET_IN received from Port of DPID.
+type PacketInRecord struct {
+	Time     time.Time         `json:"time"`
+	Topology *RecordedTopology `json:"topology,omitempty"`
+	DPID     uint64            `json:"dpid,omitempty"`
+	Port     uint32            `json:"port,omitempty"`
+	Frame    string            `json:"frame,omitempty"` // In hex.
+}
+
+type RecordedTopology struct {
+	Devices []RecordedDevice `json:"devices"`
+	Links   []LinkInfo       `json:"links"`
+}
+
+type RecordedDevice struct {
+	DPID    uint64   `json:"dpid"`
+	Version uint8    `json:"version"` // OpenFlow version.
+	Ports   []uint32 `json:"ports"`
+}
+
+type RecordInfo struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"`
+	Records uint64 `json:"records"` // PACKET_INs recorded since enabled.
+}
+
+var errNoRecordFile = errors.New("default.packet_in_record_file is not configured")
+
+// packetInRecorder appends the PACKET_INs to the record file while enabled.
+type packetInRecorder struct {
+	// enabled is read without the mutex by every PACKET_IN.
+	enabled int32
+	records uint64
+
+	mutex sync.Mutex
+	file  string
+	f     *os.File
+	enc   *json.Encoder
+}
+
+func (r *packetInRecorder) setFile(file string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.file = file
+}
+
+// start opens the record file, and then writes the topology to it.
+func (r *packetInRecorder) start(finder Finder) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.f != nil {
+		return nil
+	}
+	if r.file == "" {
+		return errNoRecordFile
+	}
+	f, err := os.OpenFile(r.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	if err := enc.Encode(&PacketInRecord{Time: time.Now(), Topology: recordTopology(finder)}); err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.enc = f, enc
+	atomic.StoreUint64(&r.records, 0)
+	atomic.StoreInt32(&r.enabled, 1)
+
+	return nil
+}
+
+func (r *packetInRecorder) stop() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	atomic.StoreInt32(&r.enabled, 0)
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f, r.enc = nil, nil
+
+	return err
+}
+
+func (r *packetInRecorder) info() RecordInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return RecordInfo{
+		Enabled: r.f != nil,
+		File:    r.file,
+		Records: atomic.LoadUint64(&r.records),
+	}
+}
+
+// record writes the PACKET_IN received from the port. The LLDP frames are not
+// recorded because the links are replayed by the recorded topology.
+func (r *packetInRecorder) record(p *Port, frame []byte) {
+	if atomic.LoadInt32(&r.enabled) == 0 {
+		return
+	}
+	if len(frame) >= 14 && frame[12] == 0x88 && frame[13] == 0xCC {
+		return
+	}
+
+	v := &PacketInRecord{
+		Time:  time.Now(),
+		DPID:  p.Device().Features().DPID,
+		Port:  p.Number(),
+		Frame: hex.EncodeToString(frame),
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.enc == nil {
+		return
+	}
+	if err := r.enc.Encode(v); err != nil {
+		logger.Errorf("failed to record the PACKET_IN: %v", err)
+		return
+	}
+	atomic.AddUint64(&r.records, 1)
+}
+
+func recordTopology(finder Finder) *RecordedTopology {
+	v := &RecordedTopology{
+		Devices: []RecordedDevice{},
+		Links:   NewLinkInfos(finder),
+	}
+	for _, d := range finder.Devices() {
+		if !d.isValid() {
+			continue
+		}
+		device := RecordedDevice{
+			DPID:    d.Features().DPID,
+			Version: d.Factory().ProtocolVersion(),
+			Ports:   []uint32{},
+		}
+		for _, p := range d.Ports() {
+			// Skip the reserved ports such as LOCAL.
+			if p.Number() >= 0xFFFFFF00 {
+				continue
+			}
+			device.Ports = append(device.Ports, p.Number())
+		}
+		sort.Slice(device.Ports, func(i, j int) bool { return device.Ports[i] < device.Ports[j] })
+		v.Devices = append(v.Devices, device)
+	}
+	sort.Slice(v.Devices, func(i, j int) bool { return v.Devices[i].DPID < v.Devices[j].DPID })
+
+	return v
+}
+
+// ReadPacketInRecords reads the first recording in the record file from r,
+// which is the topology and the PACKET_INs that follow it.
+func ReadPacketInRecords(r io.Reader) (*RecordedTopology, []PacketInRecord, error) {
+	var topology *RecordedTopology
+	records := []PacketInRecord{}
+
+	scanner := bufio.NewScanner(r)
+	// Long enough for the jumbo frames in hex.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var v PacketInRecord
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			return nil, nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		if v.Topology != nil {
+			if topology != nil {
+				// The next recording.
+				break
+			}
+			topology = v.Topology
+			continue
+		}
+		if topology == nil {
+			return nil, nil, fmt.Errorf("line %v: PACKET_IN before the topology", line)
+		}
+		if _, err := hex.DecodeString(v.Frame); err != nil {
+			return nil, nil, fmt.Errorf("line %v: invalid frame: %v", line, err)
+		}
+		records = append(records, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if topology == nil {
+		return nil, nil, errors.New("no recording")
+	}
+
+	return topology, records, nil
+}
+
+// SetPacketInRecordFile sets the file that the PACKET_INs are recorded to.
+func (r *Controller) SetPacketInRecordFile(file string) {
+	r.recorder.setFile(file)
+}
+
+func (r *Controller) showRecord(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	info := r.recorder.info()
+	w.WriteJson(&info)
+}
+
+// toggleRecord starts or stops recording the PACKET_INs received by this
+// controller to the configured file.
+func (r *Controller) toggleRecord(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p := struct {
+		Enabled bool `json:"enabled"`
+	}{}
+	if err := req.DecodeJsonPayload(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if p.Enabled {
+		if err := r.recorder.start(r.topo); err != nil {
+			status := http.StatusInternalServerError
+			if err == errNoRecordFile {
+				status = http.StatusConflict
+			}
+			writeError(w, status, err)
+			return
+		}
+		logger.Infof("started recording the PACKET_INs to %v", r.recorder.info().File)
+	} else {
+		if err := r.recorder.stop(); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Infof("stopped recording the PACKET_INs")
+	}
+
+	info := r.recorder.info()
+	w.WriteJson(&info)
+}
@@ -0,0 +1,311 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"sort"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/openflow"
+)
+
+// DefaultRerouteIntervals is how many port stats intervals in a row a link
+// should exceed the utilization threshold before its flows are rerouted.
+const DefaultRerouteIntervals = 3
+
+const (
+	// The flows are moved off a congested link until its utilization falls
+	// below this ratio of the threshold, and only onto the paths whose links
+	// stay below it, so that the flows do not move back and forth.
+	rerouteLowWatermark = 0.8
+	// Maximum number of the flows moved off a link at once.
+	maxRerouteFlows = 10
+	// A rerouted flow is not moved again for this long.
+	rerouteHoldDown = 10 * time.Minute
+)
+
+var reroutedFlows = metrics.NewCounter("openflow_rerouted_flows_total", "Number of the flows moved off the congested links.")
+
+// rerouter moves the largest flows off the congested links of a device onto
+// the alternate paths. Only the flows forwarding the packets to a discovered
+// host by its MAC address, e.g., the ones of L2 switch, are moved, because the
+// actions of a flow are unknown except its output port. It is used by the port
+// stats poller of a session, so it is not locked.
+type rerouter struct {
+	// Utilization of a link over which it is congested.
+	threshold float64
+	intervals int
+	// Consecutive intervals over the threshold keyed by the port numbers.
+	hot map[uint32]int
+	// Expirations of the hold-down of the rerouted flows keyed by ledgerKey.
+	held map[string]time.Time
+}
+
+func newRerouter(threshold float64, intervals int) *rerouter {
+	return &rerouter{
+		threshold: threshold,
+		intervals: intervals,
+		hot:       make(map[uint32]int),
+		held:      make(map[string]time.Time),
+	}
+}
+
+// check is called whenever the port stats of d are polled. It reroutes the
+// flows of the links of d whose utilization toward the peers have exceeded
+// the threshold for the intervals.
+func (r *rerouter) check(d *Device, finder Finder) {
+	now := time.Now()
+	for k, v := range r.held {
+		if now.After(v) {
+			delete(r.held, k)
+		}
+	}
+
+	for _, p := range d.Ports() {
+		t, ok := finder.LinkTraffic(p)
+		if !ok || t.Utilization < r.threshold {
+			delete(r.hot, p.Number())
+			continue
+		}
+		r.hot[p.Number()]++
+		if r.hot[p.Number()] < r.intervals {
+			continue
+		}
+		// The link should be congested for the intervals again before the
+		// next rerouting, during which the moved flows show up in the stats.
+		delete(r.hot, p.Number())
+
+		n, err := r.reroute(d, finder, p, t)
+		if err != nil {
+			logger.Errorf("failed to reroute the flows of the congested link of %v: %v", p.ID(), err)
+			continue
+		}
+		logger.Infof("rerouted %v flows off the congested link of %v (utilization=%.2f)", n, p.ID(), t.Utilization)
+	}
+}
+
+// reroute moves the largest flows of d that output to p onto the alternate
+// paths, and then returns the number of the moved flows.
+func (r *rerouter) reroute(d *Device, finder Finder, p *Port, t LinkTraffic) (int, error) {
+	speed := portSpeed(p)
+	if speed == 0 {
+		return 0, nil
+	}
+	stats, err := d.outputFlowStats(p.Number(), flowStatsTimeout)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(stats, func(i, j int) bool { return flowRate(stats[i]) > flowRate(stats[j]) })
+
+	// Bits per second to be moved, and the ones added to the ports of the
+	// alternate paths so far.
+	excess := (t.Utilization - r.threshold*rerouteLowWatermark) * speed
+	added := make(map[string]float64)
+	moved := 0
+	for _, v := range stats {
+		rate := flowRate(v)
+		// The rest are idle.
+		if excess <= 0 || moved == maxRerouteFlows || rate == 0 {
+			break
+		}
+		if v.TableID != d.FlowTableID() || !isReroutable(v.Match) {
+			continue
+		}
+		key := ledgerKey(v.TableID, v.Priority, matchFields(v.Match))
+		if _, ok := r.held[key]; ok {
+			continue
+		}
+		_, mac := v.Match.DstMAC()
+		node, _, err := finder.Node(mac)
+		if err != nil {
+			return moved, err
+		}
+		if node == nil || node.Port().Device().ID() == d.ID() {
+			continue
+		}
+		path := finder.AlternatePath(d.ID(), node.Port().Device().ID(), p)
+		if len(path) == 0 || !r.fits(finder, path, rate, added) {
+			continue
+		}
+		if err := rerouteFlow(v, path, node.Port()); err != nil {
+			return moved, err
+		}
+		logger.Debugf("rerouted the flow to %v via %v off %v", mac, path[0][0].ID(), p.ID())
+
+		for _, hop := range path {
+			added[hop[0].ID()] += rate
+		}
+		r.held[key] = time.Now().Add(rerouteHoldDown)
+		excess -= rate
+		moved++
+		reroutedFlows.Inc()
+	}
+
+	return moved, nil
+}
+
+// fits returns whether all the links of path stay below the low watermark when
+// rate is added to them.
+func (r *rerouter) fits(finder Finder, path [][2]*Port, rate float64, added map[string]float64) bool {
+	for _, hop := range path {
+		speed := portSpeed(hop[0])
+		if speed == 0 {
+			// Unknown.
+			continue
+		}
+		utilization := (added[hop[0].ID()] + rate) / speed
+		if t, ok := finder.LinkTraffic(hop[0]); ok {
+			utilization += t.Utilization
+		}
+		if utilization >= r.threshold*rerouteLowWatermark {
+			return false
+		}
+	}
+
+	return true
+}
+
+// flowRate returns the average bits per second of v since it was installed.
+func flowRate(v openflow.FlowStats) float64 {
+	d := time.Duration(v.DurationSec)*time.Second + time.Duration(v.DurationNanoSec)
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(v.ByteCount) * 8 / d.Seconds()
+}
+
+// isReroutable returns whether the flow of m forwards the packets to a host by
+// its MAC address, i.e., it only matches the fields of the Ethernet header.
+func isReroutable(m openflow.Match) bool {
+	if wildcard, _ := m.DstMAC(); wildcard {
+		return false
+	}
+	if wildcard, _ := m.VLANPriority(); !wildcard {
+		return false
+	}
+	for k := range matchFields(m) {
+		switch k {
+		case "in_port", "src_mac", "dst_mac", "vlan_id", "ether_type":
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// rerouteFlow installs the flow of v along path, and then to dst on the last
+// device. The flow of the first device, which is replaced, is installed last
+// so that the packets are not lost on the way.
+func rerouteFlow(v openflow.FlowStats, path [][2]*Port, dst *Port) error {
+	type hop struct {
+		// inPort is nil for the first device, which keeps the ingress
+		// port of v.
+		inPort, outPort *Port
+	}
+	hops := make([]hop, 0, len(path)+1)
+	for i, p := range path {
+		h := hop{outPort: p[0]}
+		if i > 0 {
+			h.inPort = path[i-1][1]
+		}
+		hops = append(hops, h)
+	}
+	hops = append(hops, hop{inPort: path[len(path)-1][1], outPort: dst})
+
+	batch := NewFlowBatch()
+	for i := len(hops) - 1; i >= 0; i-- {
+		flow, err := newReroutedFlow(v, hops[i].inPort, hops[i].outPort)
+		if err != nil {
+			return err
+		}
+		batch.Add(hops[i].outPort.Device(), flow)
+	}
+
+	return batch.Commit()
+}
+
+// newReroutedFlow makes the flow of v on the device of outPort that outputs to
+// outPort. The ingress port of v is replaced by inPort unless inPort is nil.
+// The flow replaces the one of the same match and priority, e.g., v itself on
+// the first device, instead of being rejected as an overlapping one. Only the
+// flow replacing v keeps its cookie, which may identify v for the application
+// that has installed v, e.g., the database row of L2 switch, so that the other
+// flows removed later are not mistaken for v.
+func newReroutedFlow(v openflow.FlowStats, inPort, outPort *Port) (openflow.FlowMod, error) {
+	d := outPort.Device()
+	f := d.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return nil, err
+	}
+	if wildcard, port := v.Match.InPort(); !wildcard {
+		if inPort != nil {
+			port = openflow.NewInPort()
+			port.SetValue(inPort.Number())
+		}
+		match.SetInPort(port)
+	}
+	if wildcard, mac := v.Match.SrcMAC(); !wildcard {
+		match.SetSrcMAC(mac)
+	}
+	_, dstMAC := v.Match.DstMAC()
+	match.SetDstMAC(dstMAC)
+	if wildcard, id := v.Match.VLANID(); !wildcard {
+		match.SetVLANID(id)
+	}
+	if wildcard, t := v.Match.EtherType(); !wildcard {
+		match.SetEtherType(t)
+	}
+
+	port := openflow.NewOutPort()
+	port.SetValue(outPort.Number())
+	action, err := f.NewAction()
+	if err != nil {
+		return nil, err
+	}
+	action.SetOutPort(port)
+	inst, err := f.NewInstruction()
+	if err != nil {
+		return nil, err
+	}
+	inst.ApplyAction(action)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return nil, err
+	}
+	if inPort == nil {
+		flow.SetCookie(v.Cookie)
+	}
+	flow.SetCheckOverlap(false)
+	flow.SetTableID(d.FlowTableID())
+	flow.SetIdleTimeout(v.IdleTimeout)
+	flow.SetHardTimeout(v.HardTimeout)
+	flow.SetPriority(v.Priority)
+	flow.SetFlowMatch(match)
+	flow.SetFlowInstruction(inst)
+
+	return flow, nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+type rerouteFinder struct {
+	Finder
+	utilization map[*Port]float64
+}
+
+func (r *rerouteFinder) LinkTraffic(p *Port) (LinkTraffic, bool) {
+	v, ok := r.utilization[p]
+	return LinkTraffic{Utilization: v}, ok
+}
+
+// testPortValue is a port whose speed is 1 Gbps.
+type testPortValue struct {
+	openflow.Port
+}
+
+func (r *testPortValue) Speed() uint64 {
+	return 1000
+}
+
+func newTestPort(d *Device, num uint32) *Port {
+	p := NewPort(d, num)
+	p.SetValue(new(testPortValue))
+
+	return p
+}
+
+func TestRerouteFits(t *testing.T) {
+	d1, _ := newTestDevice(1)
+	d2, _ := newTestDevice(2)
+	d3, _ := newTestDevice(3)
+	path := [][2]*Port{
+		{newTestPort(d1, 1), newTestPort(d2, 1)},
+		{newTestPort(d2, 2), newTestPort(d3, 1)},
+	}
+	finder := &rerouteFinder{utilization: map[*Port]float64{path[0][0]: 0.1, path[1][0]: 0.5}}
+	// The low watermark is 0.64.
+	r := newRerouter(0.8, DefaultRerouteIntervals)
+
+	added := map[string]float64{}
+	if !r.fits(finder, path, 100000000, added) {
+		t.Fatal("100 Mbps should fit the path")
+	}
+	if r.fits(finder, path, 200000000, added) {
+		t.Fatal("200 Mbps should not fit the second link")
+	}
+	// The flows moved onto the path so far are counted.
+	added[path[1][0].ID()] = 100000000
+	if r.fits(finder, path, 100000000, added) {
+		t.Fatal("100 Mbps should not fit the second link with the moved flows")
+	}
+}
+
+func TestIsReroutable(t *testing.T) {
+	f := of13.NewFactory()
+	newMatch := func() openflow.Match {
+		m, err := f.NewMatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	mac := net.HardwareAddr{0, 0, 0, 0, 0, 1}
+
+	m := newMatch()
+	m.SetDstMAC(mac)
+	m.SetVLANID(1)
+	if !isReroutable(m) {
+		t.Fatal("the flow to a MAC address should be reroutable")
+	}
+	if isReroutable(newMatch()) {
+		t.Fatal("the flow without the destination MAC address should not be reroutable")
+	}
+	m.SetEtherType(0x0800)
+	m.SetDstIP(&net.IPNet{IP: net.IPv4(10, 0, 0, 1), Mask: net.CIDRMask(32, 32)})
+	if isReroutable(m) {
+		t.Fatal("the flow matching the IP address should not be reroutable")
+	}
+}
+
+func TestRerouteFlow(t *testing.T) {
+	d1, c1 := newTestDevice(1)
+	d2, c2 := newTestDevice(2)
+	path := [][2]*Port{{newTestPort(d1, 2), newTestPort(d2, 1)}}
+	dst := newTestPort(d2, 3)
+
+	match, err := d1.Factory().NewMatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(4)
+	match.SetInPort(inPort)
+	match.SetDstMAC(net.HardwareAddr{0, 0, 0, 0, 0, 1})
+	v := openflow.FlowStats{Cookie: 7, Priority: 10, IdleTimeout: 30, Match: match}
+	if err := rerouteFlow(v, path, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flow of the first device replaces v with its cookie, and the one of
+	// the next device has its own cookie.
+	for i, c := range []*testChannel{c1, c2} {
+		flows := c.flowMods()
+		if len(flows) != 1 {
+			t.Fatalf("unexpected FLOW_MODs of device %v: %+v", i+1, flows)
+		}
+		f := flows[0]
+		if f.command != of13.OFPFC_ADD || f.priority != 10 || f.flags&of13.OFPFF_CHECK_OVERLAP != 0 {
+			t.Fatalf("unexpected FLOW_MOD of device %v: %+v", i+1, f)
+		}
+		if cookie := map[int]uint64{0: 7, 1: 0}[i]; f.cookie != cookie {
+			t.Fatalf("unexpected cookie of device %v: %v", i+1, f.cookie)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"context"
+	"encoding"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/openflow"
+)
+
+// The packet sampling sends a fraction of the packets received from the hosts
+// to the controller, so that the exporters see the packets of the established
+// flows as well as the first packets of the new flows. The switches forward the
+// packets of the established flows by themselves, so a sampling flow that sends
+// all the packets of a port to the controller is added for a short window at
+// random, and then removed: each port is sampled for the fraction of the time
+// on average. The sampled packets are published by EventPacketSampled, and then
+// handled as the other PACKET_INs so that they are still forwarded.
+
+const (
+	// The sampling flows are below the traps of the path trace, and above all
+	// the other flows.
+	samplePriority = 0xFFF0
+	// The sampling flows expire by themselves if the removal is lost.
+	sampleHardTimeout = 1
+	// A window of a port is closed early if it has sampled maxWindowSamples
+	// packets, so that a port flooded by a host cannot overload the controller.
+	maxWindowSamples = 16
+)
+
+var packetSamples = metrics.NewCounterVec("openflow_packet_samples_total", "Number of the packets sampled from each device.", "dpid")
+
+// DefaultSampleWindow is how long a port is sampled once its window is opened.
+const DefaultSampleWindow = 100 * time.Millisecond
+
+// packetSampler opens and closes the sampling windows of the ports of a device.
+type packetSampler struct {
+	fraction float64
+	window   time.Duration
+	// rate is the inverse of fraction, which is the sampling rate of the ports
+	// whose windows are not closed early.
+	rate uint32
+
+	mutex sync.Mutex
+	// Number of the samples of the opened windows. Key = port number.
+	windows map[uint32]int
+}
+
+func newPacketSampler(fraction float64, window time.Duration) *packetSampler {
+	return &packetSampler{
+		fraction: fraction,
+		window:   window,
+		rate:     uint32(math.Max(1, math.Round(1/fraction))),
+		windows:  make(map[uint32]int),
+	}
+}
+
+// shift closes the current windows and opens the new ones among ports. The
+// sampling flows of the ports opened again are added again to reset their hard
+// timeouts.
+func (r *packetSampler) shift(ports []*Port) (closed, opened []uint32) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prev := r.windows
+	r.windows = make(map[uint32]int)
+	for _, p := range ports {
+		if rand.Float64() >= r.fraction {
+			continue
+		}
+		opened = append(opened, p.Number())
+		r.windows[p.Number()] = 0
+	}
+	for num, n := range prev {
+		// The sampling flow of a window closed early has been removed.
+		if _, ok := r.windows[num]; !ok && n < maxWindowSamples {
+			closed = append(closed, num)
+		}
+	}
+
+	return closed, opened
+}
+
+// sample returns whether a packet received from port num is a sample. full
+// will be true if the window of the port has been closed early by the packet.
+func (r *packetSampler) sample(num uint32) (ok, full bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n, ok := r.windows[num]
+	if !ok || n >= maxWindowSamples {
+		return false, false
+	}
+	n++
+	r.windows[num] = n
+
+	return true, n == maxWindowSamples
+}
+
+// rateOf returns the sampling rate of the samples taken from p. A window closed
+// early has only sampled maxWindowSamples of the packets received during the
+// window, so the rate is scaled by the packets received in a window, which are
+// estimated from the polled rate of the port. Otherwise, the floods sampled
+// from a busy port would be underestimated.
+func (r *packetSampler) rateOf(p *Port) uint32 {
+	rate := float64(r.rate)
+	if v, ok := p.Rates(); ok {
+		if n := v.RxPps * r.window.Seconds(); n > maxWindowSamples {
+			rate *= n / maxWindowSamples
+		}
+	}
+
+	return uint32(math.Min(math.MaxUint32, math.Round(rate)))
+}
+
+// runPacketSampler shifts the sampling windows of the host ports of the device
+// until ctx is canceled.
+func (r *session) runPacketSampler(ctx context.Context) {
+	if r.sampler == nil {
+		return
+	}
+
+	r.runPeriodically(ctx, r.sampler.window, func() {
+		ports := []*Port{}
+		for _, p := range r.device.Ports() {
+			v := p.Value()
+			if v == nil || v.IsPortDown() || v.IsLinkDown() || r.finder.IsEdge(p) {
+				continue
+			}
+			ports = append(ports, p)
+		}
+		closed, opened := r.sampler.shift(ports)
+		if err := sendSampleFlows(r.device, openflow.FlowDeleteStrict, closed); err != nil {
+			logger.Debugf("failed to close the sampling windows of %v: %v", r.device.ID(), err)
+		}
+		if err := sendSampleFlows(r.device, openflow.FlowAdd, opened); err != nil {
+			logger.Debugf("failed to open the sampling windows of %v: %v", r.device.ID(), err)
+		}
+	})
+}
+
+// samplePacket publishes the PACKET_IN received from inPort if it is a sample.
+func (r *session) samplePacket(inPort *Port, v openflow.PacketIn) {
+	if r.sampler == nil {
+		return
+	}
+	ok, full := r.sampler.sample(inPort.Number())
+	if !ok {
+		return
+	}
+	if full {
+		if err := sendSampleFlows(r.device, openflow.FlowDeleteStrict, []uint32{inPort.Number()}); err != nil {
+			logger.Debugf("failed to close the sampling window of %v: %v", inPort.ID(), err)
+		}
+	}
+
+	sample := PacketSample{
+		DPID:   r.device.Features().DPID,
+		Port:   inPort.Number(),
+		Rate:   r.sampler.rateOf(inPort),
+		Length: v.Length(),
+		Frame:  v.Data(),
+	}
+	if counters, _, ok := inPort.Counters(); ok {
+		sample.Pool = counters.RxPackets
+	}
+	packetSamples.WithLabelValues(r.device.ID()).Inc()
+	event.Publish(EventPacketSampled, sample)
+}
+
+// sendSampleFlows adds or removes the sampling flows of ports.
+func sendSampleFlows(d *Device, cmd openflow.FlowModCmd, ports []uint32) error {
+	if len(ports) == 0 {
+		return nil
+	}
+	f := d.Factory()
+	if f == nil {
+		return ErrClosedDevice
+	}
+
+	msgs := make([]encoding.BinaryMarshaler, 0, len(ports))
+	for _, num := range ports {
+		inPort := openflow.NewInPort()
+		inPort.SetValue(num)
+		match, err := f.NewMatch()
+		if err != nil {
+			return err
+		}
+		match.SetInPort(inPort)
+
+		flow, err := f.NewFlowMod(cmd)
+		if err != nil {
+			return err
+		}
+		flow.SetTableID(d.FlowTableID())
+		flow.SetPriority(samplePriority)
+		flow.SetFlowMatch(match)
+		if cmd == openflow.FlowAdd {
+			outPort := openflow.NewOutPort()
+			outPort.SetController()
+			action, err := f.NewAction()
+			if err != nil {
+				return err
+			}
+			action.SetOutPort(outPort)
+			inst, err := f.NewInstruction()
+			if err != nil {
+				return err
+			}
+			inst.ApplyAction(action)
+			flow.SetFlowInstruction(inst)
+			flow.SetHardTimeout(sampleHardTimeout)
+		} else {
+			outPort := openflow.NewOutPort()
+			outPort.SetNone()
+			flow.SetOutPort(outPort)
+		}
+		msgs = append(msgs, flow)
+	}
+
+	// The samples are taken from the live traffic even in the dry run.
+	return d.sendMessages("", msgs, false)
+}
@@ -0,0 +1,102 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+func TestPacketSampler(t *testing.T) {
+	ports := []*Port{NewPort(nil, 1), NewPort(nil, 2)}
+
+	// Every port is always sampled.
+	s := newPacketSampler(1, DefaultSampleWindow)
+	if s.rate != 1 {
+		t.Fatalf("unexpected rate: %v", s.rate)
+	}
+	if ok, _ := s.sample(1); ok {
+		t.Fatal("sampled before opening the windows")
+	}
+	closed, opened := s.shift(ports)
+	if len(closed) != 0 || len(opened) != 2 {
+		t.Fatalf("unexpected windows: closed=%v, opened=%v", closed, opened)
+	}
+	for i := 1; i <= maxWindowSamples; i++ {
+		ok, full := s.sample(1)
+		if !ok {
+			t.Fatalf("packet %v is not sampled", i)
+		}
+		if full != (i == maxWindowSamples) {
+			t.Fatalf("unexpected full of packet %v: %v", i, full)
+		}
+	}
+	if ok, _ := s.sample(1); ok {
+		t.Fatal("sampled after the window is full")
+	}
+	if ok, _ := s.sample(3); ok {
+		t.Fatal("sampled a port without a window")
+	}
+
+	// Reopened windows are added again to reset their timeouts.
+	closed, opened = s.shift(ports)
+	if len(closed) != 0 || len(opened) != 2 {
+		t.Fatalf("unexpected windows: closed=%v, opened=%v", closed, opened)
+	}
+	// Only the window that has not been closed early is removed.
+	for i := 0; i < maxWindowSamples; i++ {
+		s.sample(1)
+	}
+	s.fraction = 0
+	closed, opened = s.shift(ports)
+	if len(closed) != 1 || closed[0] != 2 || len(opened) != 0 {
+		t.Fatalf("unexpected windows: closed=%v, opened=%v", closed, opened)
+	}
+
+	if v := newPacketSampler(0.01, time.Second).rate; v != 100 {
+		t.Fatalf("unexpected rate: %v", v)
+	}
+}
+
+func TestPacketSamplerRate(t *testing.T) {
+	s := newPacketSampler(0.1, 160*time.Millisecond)
+	p := NewPort(nil, 1)
+	// The rate of the port is unknown.
+	if v := s.rateOf(p); v != 10 {
+		t.Fatalf("unexpected rate: %v", v)
+	}
+
+	now := time.Now()
+	p.updateCounters(openflow.PortStats{RxPackets: 1000}, now)
+	p.updateCounters(openflow.PortStats{RxPackets: 1050}, now.Add(time.Second))
+	// 8 packets in a window are all sampled.
+	if v := s.rateOf(p); v != 10 {
+		t.Fatalf("unexpected rate of a quiet port: %v", v)
+	}
+	p.updateCounters(openflow.PortStats{RxPackets: 2050}, now.Add(2*time.Second))
+	// 16 of the 160 packets in a window are sampled.
+	if v := s.rateOf(p); v != 100 {
+		t.Fatalf("unexpected rate of a busy port: %v", v)
+	}
+}
@@ -25,42 +25,149 @@ import (
 	"bytes"
 	"context"
 	"encoding"
-	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/metrics"
 	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/capture"
 	"github.com/superkkt/cherry/openflow/of10"
 	"github.com/superkkt/cherry/openflow/of13"
 	"github.com/superkkt/cherry/openflow/transceiver"
 	"github.com/superkkt/cherry/protocol"
+	"github.com/superkkt/cherry/trace"
+
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
 )
 
 var (
 	errNotNegotiated = errors.New("invalid command on non-negotiated session")
+
+	packetIns         = metrics.NewCounterVec("openflow_packet_ins_total", "Number of the PACKET_IN messages received from each device.", "dpid")
+	flowMods          = metrics.NewCounterVec("openflow_flow_mods_total", "Number of the FLOW_MOD messages sent to each device.", "dpid")
+	connections       = metrics.NewCounter("openflow_connections_total", "Number of the accepted device connections including the reconnections.")
+	connectedDevices  = metrics.NewGauge("openflow_connected_devices", "Number of the connected devices.")
+	processorDuration = metrics.NewHistogram("northbound_packet_in_duration_seconds",
+		"Elapsed time of the north-bound processor chain handling a PACKET_IN.",
+		[]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+	)
 )
 
 const (
 	deviceExplorerInterval = 3 * time.Minute
 )
 
+const (
+	// DefaultWriteFlushInterval is how long the messages to a device are
+	// buffered to be written together by a single system call.
+	DefaultWriteFlushInterval = 200 * time.Microsecond
+	// DefaultWriteFlushThreshold is the size of the buffered messages to a
+	// device that are written without waiting for the flush interval.
+	DefaultWriteFlushThreshold = 16 * 1024
+)
+
 type session struct {
 	negotiated  bool
 	device      *Device
+	stream      *transceiver.Stream
 	transceiver *transceiver.Transceiver
 	handler     transceiver.Handler
 	watcher     watcher
 	finder      Finder
 	listener    ControllerEventListener
+	// isMaster returns whether this controller is the master of all the
+	// devices, which is known before their DPIDs.
+	isMaster func() bool
+	// isOwner returns whether this controller is the master of the device
+	// whose DPID is dpid.
+	isOwner func(dpid uint64) bool
+	// workers process the PACKET_INs out of the transceiver loop.
+	workers *packetInPool
+	// disconnect closes the session from the workers.
+	disconnect context.CancelFunc
+
+	// roleMutex serializes the promotion with the handlers of the messages.
+	roleMutex sync.Mutex
+	// standby is true while the device is held as a slave, which is neither
+	// added to the topology nor notified to the applications.
+	standby bool
+	// Replies received in the standby mode, which are handled when promoted.
+	standbyFeatures openflow.FeaturesReply
+	standbyDesc     openflow.DescReply
+	// id is a copy of the device ID that is read without locking the device,
+	// because Write is called by the device methods holding its write lock.
+	id atomic.Value
+	// capture records the stream to the ring of the device in captures.
+	capture  *capture.Conn
+	captures *captureRegistry
+	recorder *packetInRecorder
+	tracer   *pathTracer
+	// dryRun records the FLOW_MODs sent through the device instead of
+	// sending them.
+	dryRun *dryRun
+	// admission decides whether the device is admitted by its DPID, and
+	// conn is the connection of the device.
+	admission *admissionControl
+	conn      net.Conn
+	aliases   *aliasRegistry
+	// quirks are matched by the descriptions of the device in order.
+	quirks []Quirk
+	// latencyInterval is how often the latency probes are sent, and
+	// portStatsInterval is how often the port stats are polled.
+	latencyInterval   time.Duration
+	portStatsInterval time.Duration
+	// rerouter is nil if the rerouting is disabled.
+	rerouter *rerouter
+	// sampler is nil if the packet sampling is disabled.
+	sampler *packetSampler
 }
 
 type sessionConfig struct {
-	conn     net.Conn
-	watcher  watcher
-	finder   Finder
-	listener ControllerEventListener
+	conn      net.Conn
+	watcher   watcher
+	finder    Finder
+	listener  ControllerEventListener
+	isMaster  func() bool
+	isOwner   func(dpid uint64) bool
+	workers   *packetInPool
+	captures  *captureRegistry
+	recorder  *packetInRecorder
+	tracer    *pathTracer
+	dryRun    *dryRun
+	admission *admissionControl
+	aliases   *aliasRegistry
+	quirks    []Quirk
+	// Zero flushInterval disables the write buffering.
+	flushInterval  time.Duration
+	flushThreshold int
+	// Zero latencyInterval disables the link latency measurement, and zero
+	// portStatsInterval disables the port stats polling.
+	latencyInterval   time.Duration
+	portStatsInterval time.Duration
+	// The flows of a link are rerouted when its utilization exceeds
+	// rerouteThreshold for rerouteIntervals of the port stats polling. Zero
+	// rerouteThreshold disables the rerouting.
+	rerouteThreshold float64
+	rerouteIntervals int
+	// A fraction of the packets received from the hosts is sampled by the
+	// windows of sampleWindow. Zero sampleFraction disables the sampling.
+	sampleFraction float64
+	sampleWindow   time.Duration
+}
+
+// roleHandler is implemented by the protocol handlers that can hold the
+// devices as the slaves.
+type roleHandler interface {
+	// onStandbyHello starts the session without controlling the device.
+	onStandbyHello(f openflow.Factory, w transceiver.Writer) error
+	// promote makes us the master of the device held by onStandbyHello.
+	promote(f openflow.Factory, w transceiver.Writer) error
 }
 
 func checkParam(c sessionConfig) {
@@ -76,18 +183,68 @@ func checkParam(c sessionConfig) {
 	if c.listener == nil {
 		panic("Listener is nil")
 	}
+	if c.isMaster == nil {
+		panic("IsMaster is nil")
+	}
+	if c.isOwner == nil {
+		panic("IsOwner is nil")
+	}
+	if c.workers == nil {
+		panic("Workers is nil")
+	}
+	if c.captures == nil {
+		panic("Captures is nil")
+	}
+	if c.recorder == nil {
+		panic("Recorder is nil")
+	}
+	if c.tracer == nil {
+		panic("Tracer is nil")
+	}
+	if c.dryRun == nil {
+		panic("DryRun is nil")
+	}
+	if c.admission == nil {
+		panic("Admission is nil")
+	}
+	if c.aliases == nil {
+		panic("Aliases is nil")
+	}
 }
 
 func newSession(c sessionConfig) *session {
 	checkParam(c)
 
 	stream := transceiver.NewStream(c.conn)
+	stream.SetWriteBuffering(c.flushInterval, c.flushThreshold)
 	v := new(session)
 	v.watcher = c.watcher
 	v.finder = c.finder
 	v.listener = c.listener
+	v.isMaster = c.isMaster
+	v.isOwner = c.isOwner
+	v.workers = c.workers
 	v.device = newDevice(v)
+	v.stream = stream
 	v.transceiver = transceiver.NewTransceiver(stream, v)
+	v.captures = c.captures
+	v.recorder = c.recorder
+	v.tracer = c.tracer
+	v.dryRun = c.dryRun
+	v.admission = c.admission
+	v.conn = c.conn
+	v.aliases = c.aliases
+	v.quirks = c.quirks
+	v.latencyInterval = c.latencyInterval
+	v.portStatsInterval = c.portStatsInterval
+	if c.rerouteThreshold > 0 {
+		v.rerouter = newRerouter(c.rerouteThreshold, c.rerouteIntervals)
+	}
+	if c.sampleFraction > 0 {
+		v.sampler = newPacketSampler(c.sampleFraction, c.sampleWindow)
+	}
+	v.capture = capture.NewConn(c.conn.LocalAddr(), c.conn.RemoteAddr(), capture.NewRing(handshakeCaptureSize))
+	stream.SetCapture(v.capture)
 
 	return v
 }
@@ -111,6 +268,15 @@ func (r *session) OnHello(f openflow.Factory, w transceiver.Writer, v openflow.H
 	r.device.setFactory(f)
 	r.negotiated = true
 
+	r.roleMutex.Lock()
+	defer r.roleMutex.Unlock()
+
+	// Whether we are the master of the device is decided by its DPID.
+	if !r.isMaster() {
+		r.standby = true
+		return r.handler.(roleHandler).onStandbyHello(f, w)
+	}
+
 	return r.handler.OnHello(f, w, v)
 }
 
@@ -145,7 +311,47 @@ func (r *session) OnFeaturesReply(f openflow.Factory, w transceiver.Writer, v op
 		logger.Debug("received FEATURES_REPLY that is a response for our device explorer's probe")
 		return r.handler.OnFeaturesReply(f, w, v)
 	}
+	if err := r.admission.verify(v.DPID(), r.conn); err != nil {
+		return fmt.Errorf("rejecting the device not verified by its certificate (DPID=%v, address=%v): %v", r.aliases.label(v.DPID()), r.conn.RemoteAddr(), err)
+	}
+	ok, err := r.admission.admit(v.DPID(), r.conn.RemoteAddr())
+	if err != nil {
+		return errors.Wrap(err, "querying the admission of the device")
+	}
+	if !ok {
+		return fmt.Errorf("rejecting the device not admitted (DPID=%v, address=%v)", r.aliases.label(v.DPID()), r.conn.RemoteAddr())
+	}
+	// Keep the handshake if the device is being captured.
+	r.setCapture(r.captures.ring(v.DPID()))
+
+	r.roleMutex.Lock()
+	if r.standby {
+		r.standbyFeatures = v
+		r.roleMutex.Unlock()
+
+		if r.isOwner(v.DPID()) {
+			return r.promote()
+		}
+		// OF1.0 has no standard role request.
+		if f.ProtocolVersion() != openflow.OF13_VERSION {
+			return fmt.Errorf("disconnecting the OF1.0 device because we are not its master controller (DPID=%v)", v.DPID())
+		}
+		logger.Infof("holding the device as a slave because we are not its master controller (DPID=%v)", v.DPID())
+		return nil
+	}
+	defer r.roleMutex.Unlock()
 
+	// We may have lost the mastership after HELLO.
+	if !r.isOwner(v.DPID()) {
+		return fmt.Errorf("disconnecting the device because we are not its master controller (DPID=%v)", v.DPID())
+	}
+
+	return r.deviceUp(f, w, v)
+}
+
+// deviceUp initializes the device whose first FeaturesReply packet is v, and
+// then notifies the applications.
+func (r *session) deviceUp(f openflow.Factory, w transceiver.Writer, v openflow.FeaturesReply) error {
 	// We got a first FeaturesReply packet! Let's initialize this device.
 	dpid := strconv.FormatUint(v.DPID(), 10)
 	// Already connected device?
@@ -153,11 +359,14 @@ func (r *session) OnFeaturesReply(f openflow.Factory, w transceiver.Writer, v op
 		return errors.New("duplicated device DPID (aux. connection is not supported yet)")
 	}
 	r.device.setID(dpid)
+	r.id.Store(dpid)
 	// We assume a device is up after setting its DPID
 	if err := r.listener.OnDeviceUp(r.finder, r.device); err != nil {
 		return err
 	}
 	r.watcher.DeviceAdded(r.device)
+	connectedDevices.Add(1)
+	event.Publish(EventDeviceUp, DeviceEvent{DPID: v.DPID()})
 
 	features := Features{
 		DPID:       v.DPID(),
@@ -200,6 +409,21 @@ func (r *session) OnDescReply(f openflow.Factory, w transceiver.Writer, v openfl
 		Description:  v.Description(),
 	}
 	r.device.setDescriptions(desc)
+	// The handshake messages sent before this reply do not know the quirk,
+	// e.g., the barrier requests are sent regardless of NoBarrier.
+	if quirk := matchQuirk(r.quirks, desc); quirk.Name != "" {
+		logger.Infof("applying quirk %v to the device (DPID=%v)", quirk.Name, r.device.Label())
+		r.device.setQuirk(quirk)
+	}
+
+	r.roleMutex.Lock()
+	defer r.roleMutex.Unlock()
+
+	// The table-miss flows are installed when promoted.
+	if r.standby {
+		r.standbyDesc = v
+		return nil
+	}
 
 	return r.handler.OnDescReply(f, w, v)
 }
@@ -211,7 +435,15 @@ func (r *session) OnPortDescReply(f openflow.Factory, w transceiver.Writer, v op
 		return errNotNegotiated
 	}
 
-	return r.handler.OnPortDescReply(f, w, v)
+	if err := r.handler.OnPortDescReply(f, w, v); err != nil {
+		return err
+	}
+	// The device is not in the topology on standby.
+	if r.device.isValid() {
+		r.watcher.PortsAdded(r.device)
+	}
+
+	return nil
 }
 
 func newLLDPEtherFrame(deviceID string, port openflow.Port) ([]byte, error) {
@@ -281,12 +513,15 @@ func (r *session) sendPortEvent(portNum uint32, up bool) {
 		return
 	}
 
+	dpid, _ := strconv.ParseUint(r.device.ID(), 10, 64)
 	if up {
+		event.Publish(EventPortUp, PortEvent{DPID: dpid, Port: portNum})
 		if err := r.listener.OnPortUp(r.finder, port); err != nil {
 			logger.Errorf("OnPortUp: %v", err)
 			return
 		}
 	} else {
+		event.Publish(EventPortDown, PortEvent{DPID: dpid, Port: portNum})
 		if err := r.listener.OnPortDown(r.finder, port); err != nil {
 			logger.Errorf("OnPortDown: %v", err)
 			return
@@ -323,6 +558,13 @@ func (r *session) OnPortStatus(f openflow.Factory, w transceiver.Writer, v openf
 	logger.Debugf("Device=%v, PortNum=%v, AdminUp=%v, LinkUp=%v", r.device.ID(), port.Number(), !port.IsPortDown(), !port.IsLinkDown())
 	r.updatePort(v)
 
+	r.roleMutex.Lock()
+	standby := r.standby
+	r.roleMutex.Unlock()
+	if standby {
+		return nil
+	}
+
 	// Send port event
 	up := !port.IsPortDown() && !port.IsLinkDown()
 	r.sendPortEvent(port.Number(), up)
@@ -351,6 +593,20 @@ func (r *session) OnFlowRemoved(f openflow.Factory, w transceiver.Writer, v open
 		return errNotNegotiated
 	}
 
+	r.device.forgetInstalledFlows()
+	r.device.ledger.remove(v)
+	event.Publish(EventFlowRemoved, FlowRemovedEvent{
+		DPID:        r.device.Features().DPID,
+		TableID:     v.TableID(),
+		Priority:    v.Priority(),
+		Cookie:      v.Cookie(),
+		Reason:      v.Reason(),
+		Duration:    v.DurationSec(),
+		PacketCount: v.PacketCount(),
+		ByteCount:   v.ByteCount(),
+		Match:       matchFields(v.Match()),
+		Message:     v,
+	})
 	if err := r.listener.OnFlowRemoved(r.finder, v); err != nil {
 		logger.Errorf("error on OnFlowRemoved listeners: %v", err)
 		// Ignore this error and keep go on.
@@ -359,6 +615,28 @@ func (r *session) OnFlowRemoved(f openflow.Factory, w transceiver.Writer, v open
 	return r.handler.OnFlowRemoved(f, w, v)
 }
 
+func (r *session) OnFlowStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.FlowStatsReply) error {
+	logger.Debugf("FLOW_STATS_REPLY is received (xid=%v, n_flows=%v)", v.TransactionID(), len(v.FlowStats()))
+
+	if !r.negotiated {
+		return errNotNegotiated
+	}
+	r.device.addFlowStats(v)
+
+	return r.handler.OnFlowStatsReply(f, w, v)
+}
+
+func (r *session) OnPortStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.PortStatsReply) error {
+	logger.Debugf("PORT_STATS_REPLY is received (xid=%v, n_ports=%v)", v.TransactionID(), len(v.PortStats()))
+
+	if !r.negotiated {
+		return errNotNegotiated
+	}
+	r.device.addPortStats(v)
+
+	return r.handler.OnPortStatsReply(f, w, v)
+}
+
 func getEthernet(packet []byte) (*protocol.Ethernet, error) {
 	eth := new(protocol.Ethernet)
 	if err := eth.UnmarshalBinary(packet); err != nil {
@@ -452,18 +730,58 @@ func (r *session) OnPacketIn(f openflow.Factory, w transceiver.Writer, v openflo
 	if !r.negotiated {
 		return errNotNegotiated
 	}
-	logger.Debugf("PACKET_IN is received (device=%v, inport=%v, reason=%v, tableID=%v, cookie=%v)",
-		r.device.ID(), v.InPort(), v.Reason(), v.TableID(), v.Cookie())
-
-	ethernet, err := getEthernet(v.Data())
-	if err != nil {
-		return err
+	// Boxing the arguments allocates even if the log level is higher than DEBUG.
+	if logger.IsEnabledFor(logging.DEBUG) {
+		logger.Debugf("PACKET_IN is received (device=%v, inport=%v, reason=%v, tableID=%v, cookie=%v)",
+			r.device.ID(), v.InPort(), v.Reason(), v.TableID(), v.Cookie())
+	}
+	packetIns.WithLabelValues(r.device.ID()).Inc()
+	if r.tracer.intercept(r.device, v.InPort(), v.Data()) {
+		return nil
 	}
+
 	inPort := r.device.Port(v.InPort())
 	if inPort == nil {
 		logger.Errorf("failed to find a port: deviceID=%v, portNum=%v, so ignore PACKET_IN..", r.device.ID(), v.InPort())
 		return nil
 	}
+	if isLatencyProbe(v.Data()) {
+		r.handleLatencyProbe(inPort, v.Data(), time.Now())
+		return nil
+	}
+	r.recorder.record(inPort, v.Data())
+	r.samplePacket(inPort, v)
+
+	span := trace.Start("packet_in")
+	span.SetAttribute("dpid", r.device.ID())
+	span.SetAttribute("in_port", strconv.FormatUint(uint64(v.InPort()), 10))
+	queue := span.StartChild("queue")
+	r.workers.submit(inPort.ID(), func() {
+		queue.Finish()
+		defer span.Finish()
+
+		if err := r.handlePacketIn(f, w, v, inPort, span); err != nil {
+			if !isTemporaryErr(err) {
+				logger.Errorf("disconnecting the device (DPID=%v) due to the PACKET_IN error: %v", r.device.Label(), err)
+				r.disconnect()
+				return
+			}
+			logger.Errorf("failed to handle the PACKET_IN from %v: %v", inPort.ID(), err)
+		}
+	})
+
+	return nil
+}
+
+// handlePacketIn processes the PACKET_IN on a worker of the pool. An error that
+// is not temporary disconnects the device as if it is returned by OnPacketIn.
+func (r *session) handlePacketIn(f openflow.Factory, w transceiver.Writer, v openflow.PacketIn, inPort *Port, span *trace.Span) error {
+	parse := span.StartChild("parse")
+	ethernet, err := getEthernet(v.Data())
+	parse.Finish()
+	if err != nil {
+		return err
+	}
 	// Process LLDP, and then add an edge among two switches
 	if isLLDP(ethernet) {
 		return r.handleLLDP(inPort, ethernet)
@@ -478,26 +796,130 @@ func (r *session) OnPacketIn(f openflow.Factory, w transceiver.Writer, v openflo
 		return err
 	}
 
-	return r.listener.OnPacketIn(r.finder, inPort, ethernet)
+	start := time.Now()
+	defer func() { processorDuration.Observe(time.Since(start).Seconds()) }()
+
+	return r.listener.OnPacketIn(WithSpan(r.finder, span), inPort, ethernet)
+}
+
+func isTemporaryErr(err error) bool {
+	e, ok := errors.Cause(err).(interface {
+		Temporary() bool
+	})
+	return ok && e.Temporary()
+}
+
+func (r *session) OnRoleReply(f openflow.Factory, w transceiver.Writer, v openflow.RoleReply) error {
+	logger.Debugf("ROLE_REPLY (role=%v, generation=%v) is received", v.Role(), v.GenerationID())
+
+	if !r.negotiated {
+		return errNotNegotiated
+	}
+
+	return r.handler.OnRoleReply(f, w, v)
+}
+
+// promote makes this controller the master of the device held as a slave, and
+// then initializes the device as if it has just been connected.
+func (r *session) promote() error {
+	r.roleMutex.Lock()
+	defer r.roleMutex.Unlock()
+
+	if !r.standby {
+		return nil
+	}
+	r.standby = false
+
+	f := r.device.Factory()
+	w := r.transceiver
+	if err := r.handler.(roleHandler).promote(f, w); err != nil {
+		return err
+	}
+	// Not yet received replies are handled when they are received.
+	if r.standbyFeatures != nil {
+		if err := r.deviceUp(f, w, r.standbyFeatures); err != nil {
+			return err
+		}
+		logger.Infof("promoted to the master of the device (DPID=%v)", r.device.Label())
+	}
+	if r.standbyDesc != nil {
+		if err := r.handler.OnDescReply(f, w, r.standbyDesc); err != nil {
+			return err
+		}
+	}
+	r.standbyFeatures, r.standbyDesc = nil, nil
+
+	// OF1.0 provides the ports in the FeaturesReply packet.
+	if f.ProtocolVersion() != openflow.OF13_VERSION {
+		return nil
+	}
+	// The port description reply sends LLDP to discover the links again.
+	return sendPortDescriptionRequest(f, w)
+}
+
+// rebalance promotes the device held as a slave if we have become its master.
+// handover will be true if we are no longer the master of the device, which
+// should be disconnected.
+func (r *session) rebalance() (handover bool, err error) {
+	r.roleMutex.Lock()
+	standby, features := r.standby, r.standbyFeatures
+	r.roleMutex.Unlock()
+
+	if standby {
+		// The DPID is not known yet.
+		if features == nil {
+			if r.isMaster() {
+				return false, r.promote()
+			}
+			return false, nil
+		}
+		if r.isOwner(features.DPID()) {
+			return false, r.promote()
+		}
+		return false, nil
+	}
+
+	if !r.device.isValid() {
+		return false, nil
+	}
+	dpid, err := strconv.ParseUint(r.device.ID(), 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return !r.isOwner(dpid), nil
 }
 
 func (r *session) Run(ctx context.Context) {
+	ctx, r.disconnect = context.WithCancel(ctx)
+	defer r.disconnect()
+
 	stopExplorer := r.runDeviceExplorer(ctx)
 	logger.Debugf("started a new device explorer")
+	go r.runLatencyProber(ctx, r.latencyInterval)
+	go r.runPortStatsPoller(ctx, r.portStatsInterval)
+	go r.runPacketSampler(ctx)
 
 	if err := r.transceiver.Run(ctx); err != nil {
 		logger.Errorf("openflow transceiver is unexpectedly closed: %v", err)
 	}
-	logger.Infof("disconnected device (DPID=%v)", r.device.ID())
+	logger.Infof("disconnected device (DPID=%v)", r.device.Label())
 
 	stopExplorer()
 	r.transceiver.Close()
+	if r.device.isValid() {
+		if dpid, err := strconv.ParseUint(r.device.ID(), 10, 64); err == nil && !r.isOwner(dpid) {
+			r.device.setHandedOver()
+		}
+	}
 	r.device.Close()
 	if r.device.isValid() {
 		if err := r.listener.OnDeviceDown(r.finder, r.device); err != nil {
 			logger.Errorf("OnDeviceDown: %v", err)
 		}
 		r.watcher.DeviceRemoved(r.device)
+		connectedDevices.Add(-1)
+		event.Publish(EventDeviceDown, DeviceEvent{DPID: r.device.Features().DPID})
 	}
 }
 
@@ -548,10 +970,75 @@ func (r *session) runDeviceExplorer(ctx context.Context) context.CancelFunc {
 	return canceller
 }
 
+// runPeriodically calls f every interval until ctx is canceled, while we are
+// the master of the valid device. Zero or negative interval disables it.
+func (r *session) runPeriodically(ctx context.Context, interval time.Duration, f func()) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.roleMutex.Lock()
+		standby := r.standby
+		r.roleMutex.Unlock()
+		if standby || !r.device.isValid() {
+			continue
+		}
+		f()
+	}
+}
+
 func (r *session) Write(msg encoding.BinaryMarshaler) error {
+	if _, ok := msg.(openflow.FlowMod); ok {
+		id, _ := r.id.Load().(string)
+		flowMods.WithLabelValues(id).Inc()
+
+		span := trace.Start("flow_mod")
+		defer span.Finish()
+		span.SetAttribute("dpid", id)
+	}
+
 	return r.transceiver.Write(msg)
 }
 
+// WriteBatch writes msgs at once. See Write.
+func (r *session) WriteBatch(msgs []encoding.BinaryMarshaler) error {
+	id, _ := r.id.Load().(string)
+	for _, msg := range msgs {
+		if _, ok := msg.(openflow.FlowMod); ok {
+			flowMods.WithLabelValues(id).Inc()
+		}
+	}
+
+	return r.transceiver.WriteBatch(msgs)
+}
+
+// setCapture makes the session record its stream to ring, which stops
+// recording if it is nil.
+func (r *session) setCapture(ring *capture.Ring) {
+	r.capture.Attach(ring)
+	if ring == nil {
+		r.stream.SetCapture(nil)
+	} else {
+		r.stream.SetCapture(r.capture)
+	}
+}
+
+// OnSent records the FLOW_MODs sent to the device in its flow ledger.
+func (r *session) OnSent(msg encoding.BinaryMarshaler) {
+	if v, ok := msg.(openflow.FlowMod); ok {
+		r.device.ledger.record(v)
+	}
+}
+
 func sendHello(f openflow.Factory, w transceiver.Writer) error {
 	msg, err := f.NewHello()
 	if err != nil {
@@ -561,6 +1048,20 @@ func sendHello(f openflow.Factory, w transceiver.Writer) error {
 	return w.Write(msg)
 }
 
+// sendRoleRequest requests role to the device. The generation ID is the current
+// time, so that the latest request wins as long as the clocks of the controllers
+// are synchronized.
+func sendRoleRequest(f openflow.Factory, w transceiver.Writer, role openflow.ControllerRole) error {
+	msg, err := f.NewRoleRequest()
+	if err != nil {
+		return err
+	}
+	msg.SetRole(role)
+	msg.SetGenerationID(uint64(time.Now().UnixNano()))
+
+	return w.Write(msg)
+}
+
 func sendSetConfig(f openflow.Factory, w transceiver.Writer) error {
 	msg, err := f.NewSetConfig()
 	if err != nil {
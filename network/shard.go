@@ -0,0 +1,155 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/cluster"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/superkkt/viper"
+)
+
+// The switches are shared among the members of a sharded cluster, so that each
+// member only knows its own switches. The REST APIs on the live state of the
+// network are served by any member as one logical API: the requests on a
+// switch are forwarded to its owner, and the lists are merged from all the
+// members that advertise their REST API addresses.
+
+const (
+	// forwardedHeader marks the requests from the other members, which are
+	// served with the local state only, to avoid forwarding them again.
+	forwardedHeader = "X-Cherry-Forwarded"
+	peerTimeout     = 5 * time.Second
+)
+
+func (r *Controller) isSharded() bool {
+	return r.cluster != nil && r.cluster.IsSharded()
+}
+
+func isForwarded(req *rest.Request) bool {
+	return req.Header.Get(forwardedHeader) != ""
+}
+
+func peerURL(m cluster.Member, path string) *url.URL {
+	scheme := "http"
+	if viper.GetBool("rest.tls") {
+		scheme = "https"
+	}
+
+	return &url.URL{Scheme: scheme, Host: m.Address, Path: path}
+}
+
+// forwardToOwner forwards req to the owner of the switch whose DPID is dpid,
+// and then returns true, if the owner is another member that advertises its
+// REST API address.
+func (r *Controller) forwardToOwner(w rest.ResponseWriter, req *rest.Request, dpid uint64) bool {
+	if !r.isSharded() || isForwarded(req) {
+		return false
+	}
+	owner, ok := r.cluster.Owner(dpid)
+	if !ok || owner.UID == r.cluster.Self().UID || owner.Address == "" {
+		return false
+	}
+	writer, ok := w.(http.ResponseWriter)
+	if !ok {
+		return false
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(peerURL(owner, "/"))
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// Our handler has already set it.
+		resp.Header.Del("Access-Control-Allow-Origin")
+		return nil
+	}
+	proxy.ErrorHandler = func(_ http.ResponseWriter, _ *http.Request, err error) {
+		logger.Errorf("failed to forward the request to %v (%v): %v", owner.Name, owner.Address, err)
+		writeError(w, http.StatusBadGateway, fmt.Errorf("owner of the device is not reachable: %v", owner.Name))
+	}
+	req.Header.Set(forwardedHeader, r.cluster.Self().Name)
+	proxy.ServeHTTP(writer, req.Request)
+
+	return true
+}
+
+// forwardToPeers sends the requests of method on path to the other members that
+// advertise their REST API addresses, and then calls f, if it is not nil, with
+// the decoder of each response. The members that fail to respond are skipped.
+func (r *Controller) forwardToPeers(req *rest.Request, method, path string, f func(*json.Decoder) error) {
+	if !r.isSharded() || isForwarded(req) {
+		return
+	}
+
+	self := r.cluster.Self()
+	client := &http.Client{Timeout: peerTimeout}
+	mutex := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, v := range r.cluster.Members() {
+		if v.UID == self.UID || v.Address == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(m cluster.Member) {
+			defer wg.Done()
+
+			peerReq, err := http.NewRequest(method, peerURL(m, path).String(), nil)
+			if err != nil {
+				logger.Errorf("failed to make a request to %v: %v", m.Name, err)
+				return
+			}
+			// The token of the client is also valid on the other members.
+			if v := req.Header.Get("Authorization"); v != "" {
+				peerReq.Header.Set("Authorization", v)
+			}
+			peerReq.Header.Set(forwardedHeader, self.Name)
+
+			resp, err := client.Do(peerReq)
+			if err != nil {
+				logger.Errorf("failed to send %v %v to %v (%v): %v", method, path, m.Name, m.Address, err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				logger.Errorf("failed to send %v %v to %v (%v): status=%v", method, path, m.Name, m.Address, resp.StatusCode)
+				return
+			}
+			if f == nil {
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err := f(json.NewDecoder(resp.Body)); err != nil {
+				logger.Errorf("invalid response of %v from %v: %v", path, m.Name, err)
+			}
+		}(v)
+	}
+	wg.Wait()
+}
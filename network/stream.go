@@ -0,0 +1,105 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+const (
+	// Maximum number of the events queued for a slow client. The events are dropped if it is exceeded.
+	streamQueueSize = 1024
+	// Interval of the comment lines that keep the idle connections alive through the proxies.
+	streamKeepAlive = 30 * time.Second
+)
+
+type streamEvent struct {
+	Type      event.Type  `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// streamEvents streams the events published on the event bus as the server-sent
+// events (text/event-stream) until the client closes the connection. The type
+// query parameter, which is a comma separated list of the event types, filters
+// the events. All the events are streamed if it is empty.
+func (r *Controller) streamEvents(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	writer, ok := w.(http.ResponseWriter)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	types := []event.Type{}
+	for _, v := range strings.Split(req.URL.Query().Get("type"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			types = append(types, event.Type(v))
+		}
+	}
+	queue, unsubscribe := event.Channel(streamQueueSize, types...)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e := <-queue:
+			data, err := json.Marshal(streamEvent{Type: e.Type, Timestamp: e.Timestamp, Data: e.Data})
+			if err != nil {
+				logger.Errorf("failed to encode the event: type=%v, err=%v", e.Type, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(writer, "event: %v\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -24,10 +24,15 @@ package network
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/superkkt/cherry/event"
 	"github.com/superkkt/cherry/graph"
 
 	"github.com/pkg/errors"
@@ -38,6 +43,11 @@ type watcher interface {
 	DeviceLinked([2]*Port)
 	DeviceRemoved(*Device)
 	PortRemoved(*Port)
+	// PortsAdded is called when the ports of the device have been added.
+	PortsAdded(*Device)
+	// LinkLatencyMeasured is called with the latency of the link of the
+	// ports measured by a probe. It returns false if there is no such link.
+	LinkLatencyMeasured([2]*Port, time.Duration) bool
 }
 
 type Finder interface {
@@ -47,37 +57,73 @@ type Finder interface {
 	IsEnabledBySTP(p *Port) bool
 	// IsEdge returns whether p is an edge among two switches
 	IsEdge(p *Port) bool
+	// Links returns the port pairs of all the links among the devices.
+	Links() [][2]*Port
 	Node(mac net.HardwareAddr) (*Node, LocationStatus, error)
+	// Path returns the port pairs of the links from the source device to the
+	// destination device chosen by the path selection of the controller.
 	Path(srcDeviceID, dstDeviceID string) [][2]*Port
+	// AlternatePath returns the path of the least congestion cost from the
+	// source device to the destination device that does not use the link of
+	// avoid, regardless of the path selection.
+	AlternatePath(srcDeviceID, dstDeviceID string, avoid *Port) [][2]*Port
+	// LinkLatency returns the one-way latency of the link of p, or zero if p
+	// is not an edge or its latency has not been measured yet.
+	LinkLatency(p *Port) time.Duration
+	// LinkTraffic returns the traffic sent out from p to its peer over the
+	// link of p. It returns false if p is not an edge or the traffic is not
+	// known yet.
+	LinkTraffic(p *Port) (LinkTraffic, bool)
+	// UnderMaintenance returns whether the port of the switch whose DPID is
+	// dpid, or the whole switch if port is zero, is in an active maintenance
+	// window.
+	UnderMaintenance(dpid uint64, port uint32) bool
 }
 
+// topology is read by every PACKET_IN, so the readers never lock its mutex. The
+// devices are a copy-on-write map, and the graph has its own lock. The mutex
+// only serializes the changes of the topology.
 type topology struct {
-	mutex sync.RWMutex
-	// Key is the device ID
-	devices  map[string]*Device
+	mutex sync.Mutex
+	// map[string]*Device whose key is the device ID, which is replaced as a
+	// whole whenever a device is added or removed.
+	devices  atomic.Value
 	graph    *graph.Graph
 	listener TopologyEventListener
 	db       database
+	// Links replicated from the previous leader, which are keyed by the both
+	// port IDs, and valid until seedExpiration.
+	seeds          map[string]string
+	seedExpiration time.Time
+	// Links notified to the listener, which are keyed by their IDs. The
+	// changes are found by comparing them with the current links.
+	linkMutex sync.Mutex
+	links     map[string][2]*Port
+	// pathSelection is set before the first device is added.
+	pathSelection PathSelection
+	// The paths avoid the links under maintenance.
+	maintenance *maintenanceSchedule
 }
 
+// linkSeedTimeout is how long the replicated links are waiting for their ports.
+const linkSeedTimeout = 1 * time.Minute
+
 func newTopology(db database) *topology {
 	v := &topology{
-		devices: make(map[string]*Device),
-		graph:   graph.New(),
-		db:      db,
+		graph:       graph.New(),
+		db:          db,
+		links:       make(map[string][2]*Port),
+		maintenance: newMaintenanceSchedule(db),
 	}
+	v.devices.Store(make(map[string]*Device))
 	go v.staleEdgeRemover()
 
 	return v
 }
 
 func (r *topology) String() string {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
 	var buf bytes.Buffer
-	for _, v := range r.devices {
+	for _, v := range r.deviceMap() {
 		buf.WriteString(fmt.Sprintf("%v\n", v))
 	}
 	buf.WriteString(fmt.Sprintf("%v\n", r.graph))
@@ -92,6 +138,9 @@ func (r *topology) setEventListener(l TopologyEventListener) {
 // Caller should make sure the mutex is unlocked before calling this function.
 // Otherwise, event listeners may cause a deadlock by calling other topology functions.
 func (r *topology) sendEvent() {
+	r.sendLinkEvents()
+	event.Publish(EventTopologyChanged, nil)
+
 	if r.listener == nil {
 		return
 	}
@@ -102,13 +151,63 @@ func (r *topology) sendEvent() {
 	}
 }
 
-func (r *topology) Devices() []*Device {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+// sendLinkEvents notifies the links added or removed since the last call.
+func (r *topology) sendLinkEvents() {
+	r.linkMutex.Lock()
+	defer r.linkMutex.Unlock()
+
+	current := make(map[string][2]*Port)
+	for _, v := range r.Links() {
+		current[newLink(v).ID()] = v
+	}
+	for id, v := range r.links {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		logger.Infof("link down: %v <-> %v", v[0].ID(), v[1].ID())
+		event.Publish(EventLinkDown, newLinkEvent(v))
+		if r.listener != nil {
+			if err := r.listener.OnLinkDown(r, v); err != nil {
+				logger.Errorf("OnLinkDown: %v", err)
+			}
+		}
+	}
+	for id, v := range current {
+		if _, ok := r.links[id]; ok {
+			continue
+		}
+		logger.Infof("link up: %v <-> %v", v[0].ID(), v[1].ID())
+		event.Publish(EventLinkUp, newLinkEvent(v))
+		if r.listener != nil {
+			if err := r.listener.OnLinkUp(r, v); err != nil {
+				logger.Errorf("OnLinkUp: %v", err)
+			}
+		}
+	}
+	r.links = current
+}
+
+// deviceMap returns the current devices, which should not be modified.
+func (r *topology) deviceMap() map[string]*Device {
+	return r.devices.Load().(map[string]*Device)
+}
 
-	v := make([]*Device, 0)
-	for _, d := range r.devices {
+// updateDevices replaces the devices with their copy modified by f.
+// XXX: Caller should lock the mutex
+func (r *topology) updateDevices(f func(map[string]*Device)) {
+	devices := r.deviceMap()
+	v := make(map[string]*Device, len(devices)+1)
+	for k, d := range devices {
+		v[k] = d
+	}
+	f(v)
+	r.devices.Store(v)
+}
+
+func (r *topology) Devices() []*Device {
+	devices := r.deviceMap()
+	v := make([]*Device, 0, len(devices))
+	for _, d := range devices {
 		v = append(v, d)
 	}
 
@@ -117,11 +216,7 @@ func (r *topology) Devices() []*Device {
 
 // Device may return nil if a device whose ID is id does not exist
 func (r *topology) Device(id string) *Device {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
-	return r.devices[id]
+	return r.deviceMap()[id]
 }
 
 func (r *topology) DeviceAdded(d *Device) {
@@ -131,7 +226,7 @@ func (r *topology) DeviceAdded(d *Device) {
 		r.mutex.Lock()
 		defer r.mutex.Unlock()
 
-		r.devices[d.ID()] = d
+		r.updateDevices(func(devices map[string]*Device) { devices[d.ID()] = d })
 		r.graph.AddVertex(d)
 	}()
 	// XXX: Make sure the mutex is unlocked before calling sendEvent().
@@ -141,7 +236,7 @@ func (r *topology) DeviceAdded(d *Device) {
 // XXX: Caller should lock the mutex
 func (r *topology) removeDevice(d *Device) {
 	// Remove from the device database
-	delete(r.devices, d.ID())
+	r.updateDevices(func(devices map[string]*Device) { delete(devices, d.ID()) })
 }
 
 func (r *topology) DeviceRemoved(d *Device) {
@@ -183,12 +278,94 @@ func (r *topology) DeviceLinked(ports [2]*Port) {
 	}
 }
 
+// seedLinks stores links, the pairs of the port IDs, replicated from the
+// previous leader. They are added to the topology as soon as their ports are
+// added, and then they are removed as stale unless LLDP confirms them.
+func (r *topology) seedLinks(links [][2]string) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.seeds = make(map[string]string)
+	for _, v := range links {
+		r.seeds[v[0]] = v[1]
+		r.seeds[v[1]] = v[0]
+	}
+	r.seedExpiration = time.Now().Add(linkSeedTimeout)
+}
+
+func (r *topology) PortsAdded(d *Device) {
+	var added bool
+
+	// NOTE: This is an anonymous function (NOT a goroutine!) that has a critical section.
+	func() {
+		// Write lock
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if len(r.seeds) == 0 {
+			return
+		}
+		if time.Now().After(r.seedExpiration) {
+			r.seeds = nil
+			return
+		}
+
+		for _, p := range d.Ports() {
+			peerID, ok := r.seeds[p.ID()]
+			if !ok {
+				continue
+			}
+			peer := r.port(peerID)
+			if peer == nil || !isPortUp(p) || !isPortUp(peer) {
+				continue
+			}
+			delete(r.seeds, p.ID())
+			delete(r.seeds, peerID)
+
+			ok, err := r.graph.AddEdge(newLink([2]*Port{p, peer}))
+			if err != nil {
+				logger.Errorf("failed to add a replicated link: %v", err)
+				continue
+			}
+			if ok {
+				logger.Infof("added a replicated link: %v <-> %v", p.ID(), peerID)
+				added = true
+			}
+		}
+	}()
+
+	if added {
+		// XXX: Make sure the mutex is unlocked before calling sendEvent().
+		r.sendEvent()
+	}
+}
+
+// port returns the port whose ID is id, or nil if there is no such port.
+func (r *topology) port(id string) *Port {
+	v := strings.Split(id, ":")
+	if len(v) != 2 {
+		return nil
+	}
+	d, ok := r.deviceMap()[v[0]]
+	if !ok {
+		return nil
+	}
+	num, err := strconv.ParseUint(v[1], 10, 32)
+	if err != nil {
+		return nil
+	}
+
+	return d.Port(uint32(num))
+}
+
+func isPortUp(p *Port) bool {
+	v := p.Value()
+	return v != nil && !v.IsPortDown() && !v.IsLinkDown()
+}
+
 // Node may return nil if the node is unregistered or still undiscovered.
 func (r *topology) Node(mac net.HardwareAddr) (*Node, LocationStatus, error) {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
 	dpid, portNum, status, err := r.db.Location(mac)
 	if err != nil {
 		return nil, status, errors.Wrap(&networkErr{temporary: true, err: err}, "querying host location to the database")
@@ -197,7 +374,7 @@ func (r *topology) Node(mac net.HardwareAddr) (*Node, LocationStatus, error) {
 		return nil, status, nil
 	}
 
-	device, ok := r.devices[dpid]
+	device, ok := r.deviceMap()[dpid]
 	if !ok {
 		return nil, LocationUnregistered, nil
 	}
@@ -231,21 +408,46 @@ func (r *topology) PortRemoved(p *Port) {
 }
 
 func (r *topology) Path(srcDeviceID, dstDeviceID string) [][2]*Port {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+	return r.findPath(srcDeviceID, dstDeviceID, func(src, dst *Device) []graph.Path {
+		switch {
+		case r.pathSelection == PathByCongestion:
+			return r.graph.FindShortestPath(src, dst, r.maintenance.drainCost(congestionCost))
+		case len(r.maintenance.activeWindows()) > 0:
+			// The spanning tree may have no path that avoids the drained links.
+			return r.graph.FindShortestPath(src, dst, r.maintenance.drainCost(hopCost))
+		default:
+			return r.graph.FindPath(src, dst)
+		}
+	})
+}
 
+func (r *topology) AlternatePath(srcDeviceID, dstDeviceID string, avoid *Port) [][2]*Port {
+	// The infinite cost never reaches the destination.
+	cost := func(p graph.Point, e graph.Edge) float64 {
+		l := e.(*link)
+		if l.ports[0].ID() == avoid.ID() || l.ports[1].ID() == avoid.ID() {
+			return math.Inf(1)
+		}
+		return congestionCost(p, e)
+	}
+
+	return r.findPath(srcDeviceID, dstDeviceID, func(src, dst *Device) []graph.Path {
+		return r.graph.FindShortestPath(src, dst, r.maintenance.drainCost(cost))
+	})
+}
+
+func (r *topology) findPath(srcDeviceID, dstDeviceID string, find func(src, dst *Device) []graph.Path) [][2]*Port {
 	v := make([][2]*Port, 0)
-	src := r.devices[srcDeviceID]
-	dst := r.devices[dstDeviceID]
+	devices := r.deviceMap()
+	src := devices[srcDeviceID]
+	dst := devices[dstDeviceID]
 	// Unknown source or destination device?
 	if src == nil || dst == nil {
 		// Return empty path
 		return v
 	}
 
-	path := r.graph.FindPath(src, dst)
-	for _, p := range path {
+	for _, p := range find(src, dst) {
 		device := p.V.(*Device)
 		link := p.E.(*link)
 		v = append(v, pickPort(device, link))
@@ -263,6 +465,61 @@ func pickPort(d *Device, l *link) [2]*Port {
 	return [2]*Port{p[1].(*Port), p[0].(*Port)}
 }
 
+func (r *topology) Links() [][2]*Port {
+	edges := r.graph.Edges()
+	v := make([][2]*Port, 0, len(edges))
+	for _, e := range edges {
+		p := e.Points()
+		v = append(v, [2]*Port{p[0].(*Port), p[1].(*Port)})
+	}
+
+	return v
+}
+
+// link returns the link of p in the graph, or nil if p is not an edge.
+func (r *topology) link(p *Port) *link {
+	for _, e := range r.graph.Edges() {
+		l := e.(*link)
+		if l.ports[0].ID() == p.ID() || l.ports[1].ID() == p.ID() {
+			return l
+		}
+	}
+
+	return nil
+}
+
+func (r *topology) LinkLatencyMeasured(ports [2]*Port, latency time.Duration) bool {
+	l := r.link(ports[0])
+	if l == nil || l.ID() != newLink(ports).ID() {
+		return false
+	}
+	l.observeLatency(latency)
+
+	return true
+}
+
+func (r *topology) LinkLatency(p *Port) time.Duration {
+	l := r.link(p)
+	if l == nil {
+		return 0
+	}
+
+	return l.Latency()
+}
+
+func (r *topology) LinkTraffic(p *Port) (LinkTraffic, bool) {
+	l := r.link(p)
+	if l == nil {
+		return LinkTraffic{}, false
+	}
+	peer := l.ports[0]
+	if peer.ID() == p.ID() {
+		peer = l.ports[1]
+	}
+
+	return newLinkTraffic(p, peer)
+}
+
 func (r *topology) IsEdge(p *Port) bool {
 	return r.graph.IsEdge(p)
 }
@@ -0,0 +1,55 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"github.com/superkkt/cherry/trace"
+)
+
+// tracedFinder carries the span of the PACKET_IN being processed along the
+// processor chain, which only passes the finder to the next processor.
+type tracedFinder struct {
+	Finder
+	span *trace.Span
+}
+
+// WithSpan returns the finder that carries span. It returns finder itself if span is nil.
+func WithSpan(finder Finder, span *trace.Span) Finder {
+	if span == nil {
+		return finder
+	}
+	if v, ok := finder.(*tracedFinder); ok {
+		finder = v.Finder
+	}
+
+	return &tracedFinder{Finder: finder, span: span}
+}
+
+// SpanOf returns the span carried by finder, or nil if there is no such span.
+func SpanOf(finder Finder) *trace.Span {
+	v, ok := finder.(*tracedFinder)
+	if !ok {
+		return nil
+	}
+
+	return v.span
+}
@@ -0,0 +1,97 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPortStatsInterval is how often the port stats of the devices are
+// polled to calculate the traffic of the links.
+const DefaultPortStatsInterval = 30 * time.Second
+
+// LinkTraffic is the traffic sent out from a port to its peer over a link
+// during the last port stats polling interval.
+type LinkTraffic struct {
+	Bps float64 `json:"bps"`
+	Pps float64 `json:"pps"`
+	// Errors per second on the both ends, i.e., the transmit errors of the
+	// port and the receive errors of its peer.
+	Errors float64 `json:"errors"`
+	// Bps over the current speed of the port, or zero if the speed is unknown.
+	Utilization float64 `json:"utilization"`
+}
+
+func newLinkTraffic(p, peer *Port) (LinkTraffic, bool) {
+	tx, ok := p.Rates()
+	if !ok {
+		return LinkTraffic{}, false
+	}
+	rx, ok := peer.Rates()
+	if !ok {
+		return LinkTraffic{}, false
+	}
+
+	v := LinkTraffic{
+		Bps:    tx.TxBps,
+		Pps:    tx.TxPps,
+		Errors: tx.TxErrors + rx.RxErrors,
+	}
+	if speed := portSpeed(p); speed > 0 {
+		v.Utilization = tx.TxBps / speed
+	}
+
+	return v, true
+}
+
+// portSpeed returns the current speed of p in bits per second, or zero if it
+// is unknown.
+func portSpeed(p *Port) float64 {
+	v := p.Value()
+	if v == nil {
+		return 0
+	}
+	// Speed is in Mbps.
+	return float64(v.Speed()) * 1000000
+}
+
+// runPortStatsPoller polls the port stats of the device every interval until
+// ctx is canceled.
+func (r *session) runPortStatsPoller(ctx context.Context, interval time.Duration) {
+	r.runPeriodically(ctx, interval, func() {
+		stats, err := r.device.PortStats(flowStatsTimeout)
+		if err != nil {
+			logger.Debugf("failed to poll the port stats of %v: %v", r.device.ID(), err)
+			return
+		}
+		now := time.Now()
+		for _, v := range stats {
+			if p := r.device.Port(v.PortNumber); p != nil {
+				p.updateCounters(v, now)
+			}
+		}
+		if r.rerouter != nil {
+			r.rerouter.check(r.device, r.finder)
+		}
+	})
+}
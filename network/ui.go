@@ -0,0 +1,278 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// showUI serves the web dashboard, which is a single page that renders the
+// topology, the host locations and the port states using the REST APIs, and
+// refreshes them whenever the topology events are streamed from /api/v1/events.
+func (r *Controller) showUI(w rest.ResponseWriter, req *rest.Request) {
+	writer, ok := w.(http.ResponseWriter)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("raw response is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := io.WriteString(writer, uiPage); err != nil {
+		logger.Debugf("failed to write the web UI: %v", err)
+	}
+}
+
+// uiPage has no external dependency so that it works on the isolated management networks.
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Cherry</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 0; color: #222; }
+header { background: #8b1a1a; color: #fff; padding: 8px 16px; font-size: 16px; }
+header span { float: right; font-size: 12px; }
+main { display: flex; }
+#topology { flex: 3; border-right: 1px solid #ddd; }
+#side { flex: 2; padding: 8px 16px; overflow: auto; height: calc(100vh - 40px); }
+svg { width: 100%; height: calc(100vh - 40px); }
+.device { fill: #8b1a1a; cursor: pointer; }
+.device.selected { fill: #e0a000; }
+.host { fill: #4a7ab5; }
+.link { stroke: #555; stroke-width: 2; }
+.link.blocked { stroke: #bbb; stroke-dasharray: 4 4; }
+.access { stroke: #9ab; stroke-width: 1; }
+text { font-size: 11px; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 16px; }
+th, td { border-bottom: 1px solid #eee; padding: 3px 6px; text-align: left; }
+th { background: #f6f6f6; }
+.down { color: #c00; }
+.stale { color: #999; }
+h2 { font-size: 14px; margin: 12px 0 6px; }
+</style>
+</head>
+<body>
+<header>Cherry OpenFlow Controller <span id="status"></span></header>
+<main>
+<div id="topology"><svg id="graph"></svg></div>
+<div id="side">
+<div id="detail"><p>Click a switch to show its ports, counters and flows.</p></div>
+<h2>Hosts</h2>
+<table id="hosts"></table>
+</div>
+</main>
+<script>
+"use strict";
+var state = { devices: [], links: [], hosts: [], switches: [], selected: null };
+
+// API token of the user if the authentication is enabled.
+var token = localStorage.getItem("cherry.token") || "";
+
+function get(path) {
+	var headers = token ? { "Authorization": "Bearer " + token } : {};
+	return fetch(path, { headers: headers }).then(function(resp) {
+		if (resp.status === 401 && login()) { return get(path); }
+		if (!resp.ok) { throw new Error(path + ": " + resp.status); }
+		return resp.json();
+	});
+}
+
+function login() {
+	var v = prompt("API token");
+	if (!v) { return false; }
+	token = v;
+	localStorage.setItem("cherry.token", v);
+	watch();
+	return true;
+}
+
+function esc(v) {
+	return String(v).replace(/[&<>"]/g, function(c) {
+		return { "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;" }[c];
+	});
+}
+
+function el(name, attrs) {
+	var e = document.createElementNS("http://www.w3.org/2000/svg", name);
+	for (var k in attrs) { e.setAttribute(k, attrs[k]); }
+	return e;
+}
+
+function status(msg) { document.getElementById("status").textContent = msg; }
+
+// Returns the device ID and the port number of a host location, e.g., sw1/2, using the registered switches.
+function hostLocation(port) {
+	var i = port.lastIndexOf("/");
+	if (i < 0) { return null; }
+	var desc = port.substring(0, i), printed = parseInt(port.substring(i + 1), 10);
+	for (var j = 0; j < state.switches.length; j++) {
+		var sw = state.switches[j];
+		if (sw.description === desc) {
+			return { device: String(sw.dpid), port: printed - sw.first_printed_port + sw.first_port };
+		}
+	}
+	return null;
+}
+
+// Returns the alias name of a device, or its DPID if it has no alias.
+function deviceName(id) {
+	for (var i = 0; i < state.devices.length; i++) {
+		var d = state.devices[i];
+		if (d.id === id) { return d.alias ? d.alias.name : "DPID " + d.dpid; }
+	}
+	return "DPID " + id;
+}
+
+// Replaces the DPID of a port ID, e.g., 1:2, with the alias name of the device.
+function portName(id) {
+	var i = id.indexOf(":"), d = deviceName(id.substring(0, i));
+	return d.indexOf("DPID ") === 0 ? id : d + ":" + id.substring(i + 1);
+}
+
+function refresh() {
+	return Promise.all([get("/api/v1/device"), get("/api/v1/link"), get("/api/v1/host"), get("/api/v1/switch")])
+		.then(function(v) {
+			state.devices = v[0].devices; state.links = v[1].links;
+			state.hosts = v[2].hosts || []; state.switches = v[3].switches || [];
+			draw(); drawHosts();
+			if (state.selected) { showDevice(state.selected); }
+			status("updated at " + new Date().toLocaleTimeString());
+		})
+		.catch(function(err) { status(err.message); });
+}
+
+function draw() {
+	var svg = document.getElementById("graph");
+	while (svg.firstChild) { svg.removeChild(svg.firstChild); }
+	var w = svg.clientWidth, h = svg.clientHeight, cx = w / 2, cy = h / 2;
+	var radius = Math.min(w, h) / 2 - 90, pos = {};
+	state.devices.forEach(function(d, i) {
+		var a = 2 * Math.PI * i / state.devices.length;
+		pos[d.id] = { x: cx + radius * Math.cos(a), y: cy + radius * Math.sin(a), a: a };
+	});
+
+	state.links.forEach(function(l) {
+		var a = pos[l.ports[0].split(":")[0]], b = pos[l.ports[1].split(":")[0]];
+		if (!a || !b) { return; }
+		var line = el("line", { x1: a.x, y1: a.y, x2: b.x, y2: b.y, "class": l.enabled ? "link" : "link blocked" });
+		line.appendChild(el("title", {})).textContent = l.ports.map(portName).join(" - ") + (l.enabled ? "" : " (blocked by STP)");
+		svg.appendChild(line);
+	});
+
+	// Hosts are placed around their switches.
+	var count = {};
+	state.hosts.forEach(function(host) {
+		var loc = hostLocation(host.port || "");
+		if (!loc || !pos[loc.device]) { return; }
+		var p = pos[loc.device], n = count[loc.device] = (count[loc.device] || 0) + 1;
+		var a = p.a + (n % 2 ? 1 : -1) * Math.ceil(n / 2) * 0.25, r = 45 + 12 * Math.floor(n / 10);
+		var x = p.x + r * Math.cos(a), y = p.y + r * Math.sin(a);
+		svg.appendChild(el("line", { x1: p.x, y1: p.y, x2: x, y2: y, "class": "access" }));
+		var c = svg.appendChild(el("circle", { cx: x, cy: y, r: 5, "class": "host" }));
+		c.appendChild(el("title", {})).textContent = host.ip + " " + host.mac + " on port " + loc.port;
+	});
+
+	state.devices.forEach(function(d) {
+		var p = pos[d.id];
+		var g = svg.appendChild(el("g", { "class": d.id === state.selected ? "device selected" : "device" }));
+		g.appendChild(el("rect", { x: p.x - 14, y: p.y - 10, width: 28, height: 20, rx: 3 }));
+		var title = "DPID " + d.dpid + ", " + d.descriptions.manufacturer + " " + d.descriptions.hardware;
+		if (d.alias) {
+			title += ["site", "rack", "role"].filter(function(k) { return d.alias[k]; })
+				.map(function(k) { return ", " + k + " " + d.alias[k]; }).join("");
+		}
+		g.appendChild(el("title", {})).textContent = title;
+		svg.appendChild(el("text", { x: p.x, y: p.y + 24, "text-anchor": "middle" })).textContent = deviceName(d.id);
+		g.addEventListener("click", function() { state.selected = d.id; draw(); showDevice(d.id); });
+	});
+}
+
+function drawHosts() {
+	var rows = "<tr><th>IP</th><th>MAC</th><th>Location</th><th>Description</th></tr>";
+	state.hosts.forEach(function(h) {
+		rows += "<tr" + (h.stale ? " class=\"stale\"" : "") + "><td>" + esc(h.ip) + "</td><td>" + esc(h.mac) +
+			"</td><td>" + esc(h.port || "-") + "</td><td>" + esc(h.description) + "</td></tr>";
+	});
+	document.getElementById("hosts").innerHTML = rows;
+}
+
+function showDevice(id) {
+	var base = "/api/v1/device/" + id;
+	Promise.all([get(base + "/port"), get(base + "/port/stats").catch(function() { return { ports: [] }; })])
+		.then(function(v) {
+			var stats = {};
+			v[1].ports.forEach(function(s) { stats[s.number] = s; });
+			var rows = "<tr><th>Port</th><th>Name</th><th>Status</th><th>Speed</th><th>RX bytes</th><th>TX bytes</th><th>Errors</th></tr>";
+			v[0].ports.forEach(function(p) {
+				var s = stats[p.number] || {}, up = p.admin_up && p.link_up;
+				rows += "<tr><td>" + p.number + "</td><td>" + esc(p.name) + "</td><td" + (up ? "" : " class=\"down\"") + ">" +
+					(up ? "up" : "down") + (p.disabled ? " (STP blocked)" : "") + (p.edge ? " (inter-switch)" : "") + "</td><td>" +
+					p.speed + " MB</td><td>" + (s.rx_bytes || 0) + "</td><td>" + (s.tx_bytes || 0) + "</td><td>" +
+					((s.rx_errors || 0) + (s.tx_errors || 0)) + "</td></tr>";
+			});
+			document.getElementById("detail").innerHTML = "<h2>Switch " + esc(deviceName(id)) + "</h2><table>" + rows +
+				"</table><button id=\"flows\">Show the flow table</button><table id=\"flowtable\"></table>";
+			document.getElementById("flows").addEventListener("click", function() { showFlows(id); });
+		})
+		.catch(function(err) { status(err.message); });
+}
+
+function showFlows(id) {
+	get("/api/v1/device/" + id + "/flow").then(function(v) {
+		var rows = "<tr><th>Table</th><th>Priority</th><th>Match</th><th>Packets</th><th>Bytes</th><th>Duration</th></tr>";
+		v.flows.forEach(function(f) {
+			var match = Object.keys(f.match).map(function(k) { return k + "=" + f.match[k]; }).join(", ");
+			rows += "<tr><td>" + f.table_id + "</td><td>" + f.priority + "</td><td>" + esc(match || "*") + "</td><td>" +
+				f.packet_count + "</td><td>" + f.byte_count + "</td><td>" + f.duration + "s</td></tr>";
+		});
+		document.getElementById("flowtable").innerHTML = rows;
+	}).catch(function(err) { status(err.message); });
+}
+
+var pending = null;
+function schedule() {
+	// Coalesces the bursts of the events.
+	if (pending) { return; }
+	pending = setTimeout(function() { pending = null; refresh(); }, 500);
+}
+
+var events = null;
+function watch() {
+	var types = ["DeviceUp", "DeviceDown", "PortUp", "PortDown", "TopologyChanged", "HostDiscovered", "HostMoved", "HostLost"];
+	if (events) { events.close(); }
+	// EventSource cannot set the Authorization header.
+	events = new EventSource("/api/v1/events?type=" + types.join(",") + (token ? "&access_token=" + encodeURIComponent(token) : ""));
+	types.forEach(function(t) { events.addEventListener(t, schedule); });
+}
+
+watch();
+refresh();
+window.addEventListener("resize", draw);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,726 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package acl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "ACL"
+
+var (
+	logger = logging.MustGetLogger("acl")
+)
+
+const (
+	// We use MSB of the cookie to mark the flows that should survive RemoveAllFlows().
+	flowCookie = 0x1<<63 | 0xAC1
+	// Priority of the drop flows. It should be higher than the ones of the
+	// L2 switching flows and the authentication flows.
+	dropPriority = 30
+)
+
+var errExternalRules = errors.New("the rules are managed by the external source")
+
+type database interface {
+	MACRules() ([]Rule, error)
+	AddMACRule(Rule) (id uint64, err error)
+	RemoveMACRule(id uint64) (rule Rule, ok bool, err error)
+}
+
+// Rule is an access control entry of a MAC address. Zero DPID or Port means any switch or any port.
+type Rule struct {
+	ID    uint64
+	MAC   net.HardwareAddr
+	DPID  uint64
+	Port  uint32
+	Allow bool
+}
+
+func (r Rule) String() string {
+	action := "deny"
+	if r.Allow {
+		action = "allow"
+	}
+
+	return fmt.Sprintf("ID=%v, MAC=%v, DPID=%v, Port=%v, Action=%v", r.ID, r.MAC, r.DPID, r.Port, action)
+}
+
+// scope returns the specificity of the rule. A higher value means more specific.
+func (r Rule) scope() int {
+	switch {
+	case r.Port != 0:
+		return 2
+	case r.DPID != 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (r Rule) matches(mac net.HardwareAddr, dpid uint64, port uint32) bool {
+	if !bytes.Equal(r.MAC, mac) {
+		return false
+	}
+	if r.DPID != 0 && r.DPID != dpid {
+		return false
+	}
+	if r.Port != 0 && (r.DPID == 0 || r.Port != port) {
+		return false
+	}
+
+	return true
+}
+
+type ACL struct {
+	app.BaseProcessor
+	conf         app.Config
+	db           database
+	defaultAllow bool
+	mutex        sync.Mutex
+	rules        []Rule
+	finder       network.Finder
+	// source is nil if the rules are stored in the database.
+	source         *source
+	sourceInterval time.Duration
+	syncMutex      sync.Mutex
+	status         SourceStatus
+}
+
+// SourceStatus is the result of the last synchronization with the external
+// source of the rules.
+type SourceStatus struct {
+	Source   string    `json:"source"`
+	Synced   time.Time `json:"synced"`          // Last time the rules have been fetched successfully.
+	Changed  time.Time `json:"changed"`         // Last time the fetched rules have been applied.
+	Checksum string    `json:"checksum"`        // SHA-256 of the document of the applied rules.
+	Rules    int       `json:"rules"`           // Number of the applied rules.
+	Error    string    `json:"error,omitempty"` // Error of the last synchronization.
+	Failed   time.Time `json:"failed"`          // Last time the synchronization has failed.
+}
+
+func New(db database, conf app.Config) *ACL {
+	return &ACL{
+		db:   db,
+		conf: conf,
+	}
+}
+
+func (r *ACL) Init(ctx context.Context, s app.Services) error {
+	defaultAllow, err := loadDefaultPolicy(r.conf)
+	if err != nil {
+		return err
+	}
+	r.defaultAllow = defaultAllow
+
+	if location := r.conf.GetString("source"); location != "" {
+		r.source = newSource(location, r.conf.GetString("source_checksum"))
+		r.sourceInterval = defaultSourceInterval
+		if r.conf.IsSet("source_interval") {
+			r.sourceInterval = time.Duration(r.conf.GetInt("source_interval")) * time.Second
+		}
+		if r.sourceInterval <= 0 {
+			return errors.New("invalid acl.source_interval in the config file")
+		}
+		r.status.Source = location
+		// Finder is nil if the configuration is only checked.
+		if s.Finder != nil {
+			// The default policy is applied until the rules are fetched.
+			go r.syncer(ctx)
+		}
+		return nil
+	}
+
+	rules, err := r.db.MACRules()
+	if err != nil {
+		return errors.Wrap(err, "loading MAC rules")
+	}
+	r.rules = rules
+
+	return nil
+}
+
+func loadDefaultPolicy(conf app.Config) (allow bool, err error) {
+	switch strings.ToLower(conf.GetString("default_policy")) {
+	case "", "allow":
+		return true, nil
+	case "deny":
+		return false, nil
+	default:
+		return false, errors.New("invalid acl.default_policy in the config file")
+	}
+}
+
+// Reload applies the default policy in the config file, and reloads the rules
+// from the database, which may have been changed by the other controllers or
+// by restoring a backup, or from the external source. The flows of the changed
+// MAC addresses are removed so that their packets are evaluated again.
+// Changing the default policy removes the flows of all the hosts.
+func (r *ACL) Reload() error {
+	defaultAllow, err := loadDefaultPolicy(r.conf)
+	if err != nil {
+		return err
+	}
+	if r.source != nil {
+		r.mutex.Lock()
+		rules := r.rules
+		r.mutex.Unlock()
+		r.update(defaultAllow, rules)
+		r.sync(context.Background())
+		return nil
+	}
+	rules, err := r.db.MACRules()
+	if err != nil {
+		return errors.Wrap(err, "loading MAC rules")
+	}
+	r.update(defaultAllow, rules)
+
+	return nil
+}
+
+// update replaces the default policy and the rules, and then removes the
+// flows of the changed MAC addresses, or of all the hosts if the default
+// policy has been changed.
+func (r *ACL) update(defaultAllow bool, rules []Rule) {
+	r.mutex.Lock()
+	policyChanged := r.defaultAllow != defaultAllow
+	changed := changedMACs(r.rules, rules)
+	r.defaultAllow = defaultAllow
+	r.rules = rules
+	r.mutex.Unlock()
+	logger.Infof("reloaded the configuration: defaultAllow=%v, rules=%v", defaultAllow, len(rules))
+
+	if policyChanged {
+		r.reset()
+		event.NotifyACLUpdated(event.ACLUpdate{})
+		return
+	}
+	for _, mac := range changed {
+		r.refresh(mac)
+		event.NotifyACLUpdated(event.ACLUpdate{MAC: mac})
+	}
+}
+
+// syncer synchronizes the rules with the external source now and every
+// interval until ctx is canceled.
+func (r *ACL) syncer(ctx context.Context) {
+	r.sync(ctx)
+
+	ticker := time.NewTicker(r.sourceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.sync(ctx)
+		}
+	}
+}
+
+// sync fetches the rules from the external source, and then applies them if
+// they have been changed. The current rules are kept if it fails.
+func (r *ACL) sync(ctx context.Context) {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+
+	rules, checksum, err := r.source.fetch(ctx)
+	now := time.Now()
+	if err != nil {
+		logger.Errorf("failed to fetch the rules from %v: %v", r.status.Source, err)
+		r.mutex.Lock()
+		r.status.Error = err.Error()
+		r.status.Failed = now
+		r.mutex.Unlock()
+		return
+	}
+
+	r.mutex.Lock()
+	unchanged := checksum == r.status.Checksum
+	defaultAllow := r.defaultAllow
+	r.status.Synced = now
+	r.status.Error = ""
+	if !unchanged {
+		r.status.Changed = now
+		r.status.Checksum = checksum
+		r.status.Rules = len(rules)
+	}
+	r.mutex.Unlock()
+	if unchanged {
+		return
+	}
+
+	logger.Infof("applying %v rules fetched from %v (SHA-256=%v)", len(rules), r.status.Source, checksum)
+	r.update(defaultAllow, rules)
+}
+
+// Pause removes the drop flows from all the devices, so that the packets from
+// the denied hosts are forwarded while the application is disabled.
+func (r *ACL) Pause() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return nil
+	}
+	for _, device := range finder.Devices() {
+		if err := removeDropFlows(device, nil); err != nil {
+			logger.Errorf("failed to remove the drop flows from %v: %v", device.ID(), err)
+		}
+	}
+
+	return nil
+}
+
+// Resume removes the flows installed while the application was disabled, so
+// that the packets are evaluated with the rules again.
+func (r *ACL) Resume() error {
+	r.reset()
+	return nil
+}
+
+// changedMACs returns the MAC addresses whose rules are different between prev and curr.
+func changedMACs(prev, curr []Rule) []net.HardwareAddr {
+	rules := func(rules []Rule) map[string]map[string]bool {
+		v := make(map[string]map[string]bool)
+		for _, rule := range rules {
+			mac := rule.MAC.String()
+			if v[mac] == nil {
+				v[mac] = make(map[string]bool)
+			}
+			v[mac][fmt.Sprintf("%v/%v/%v", rule.DPID, rule.Port, rule.Allow)] = true
+		}
+		return v
+	}
+	o, n := rules(prev), rules(curr)
+
+	result := []net.HardwareAddr{}
+	for mac := range o {
+		if _, ok := n[mac]; !ok {
+			n[mac] = nil
+		}
+	}
+	for mac, v := range n {
+		if reflect.DeepEqual(o[mac], v) {
+			continue
+		}
+		addr, err := net.ParseMAC(mac)
+		if err != nil {
+			continue
+		}
+		result = append(result, addr)
+	}
+
+	return result
+}
+
+// reset removes all the flows including the drop flows from all the devices,
+// and then installs the fabric-wide drop flows again.
+func (r *ACL) reset() {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return
+	}
+	for _, device := range finder.Devices() {
+		if err := removeDropFlows(device, nil); err != nil {
+			logger.Errorf("failed to remove the drop flows from %v: %v", device.ID(), err)
+			continue
+		}
+		if err := device.RemoveAllFlows(); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+		r.installFabricDropFlows(device)
+	}
+}
+
+func (r *ACL) Name() string {
+	return appName
+}
+
+func (r *ACL) String() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%v: DefaultAllow=%v", r.Name(), r.defaultAllow))
+	for _, v := range r.rules {
+		buf.WriteString(fmt.Sprintf("\n\t%v", v))
+	}
+
+	return buf.String()
+}
+
+// allowed returns whether mac is allowed to access the network on the port
+// specified by dpid and port. The most specific rule takes precedence.
+func (r *ACL) allowed(mac net.HardwareAddr, dpid uint64, port uint32) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result, scope := r.defaultAllow, -1
+	for _, v := range r.rules {
+		if !v.matches(mac, dpid, port) || v.scope() <= scope {
+			continue
+		}
+		result, scope = v.Allow, v.scope()
+	}
+
+	return result
+}
+
+func (r *ACL) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	// Ports between switches are not subject to the access control.
+	if finder.IsEdge(ingress) {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	dpid, err := strconv.ParseUint(ingress.Device().ID(), 10, 64)
+	if err != nil {
+		logger.Errorf("invalid switch DPID: %v", ingress.Device().ID())
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+	if r.allowed(eth.SrcMAC, dpid, ingress.Number()) {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	logger.Infof("blocking the denied host: MAC=%v, port=%v", eth.SrcMAC, ingress.ID())
+	if err := installDropFlow(ingress.Device(), eth.SrcMAC, ingress.Number()); err != nil {
+		logger.Errorf("failed to install the drop flow: %v", err)
+	}
+
+	// Drop this packet.
+	return nil
+}
+
+func (r *ACL) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	r.finder = finder
+	r.mutex.Unlock()
+
+	r.installFabricDropFlows(device)
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+// installFabricDropFlows installs the fabric-wide deny rules on device in advance.
+func (r *ACL) installFabricDropFlows(device *network.Device) {
+	r.mutex.Lock()
+	rules := make([]Rule, len(r.rules))
+	copy(rules, r.rules)
+	r.mutex.Unlock()
+
+	for _, v := range rules {
+		if v.Allow || v.scope() != 0 {
+			continue
+		}
+		if err := installDropFlow(device, v.MAC, 0); err != nil {
+			logger.Errorf("failed to install the drop flow on %v: %v", device.ID(), err)
+		}
+	}
+}
+
+// installDropFlow installs a permanent flow that drops the packets from mac. Zero port means any ingress port.
+func installDropFlow(device *network.Device, mac net.HardwareAddr, port uint32) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	if port != 0 {
+		inPort := openflow.NewInPort()
+		inPort.SetValue(port)
+		match.SetInPort(inPort)
+	}
+	match.SetSrcMAC(mac)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	// Permanent flow that will be removed when the rule is changed.
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(0)
+	flow.SetPriority(dropPriority)
+	flow.SetFlowMatch(match)
+	// No instruction means drop.
+
+	return device.SendFlow(appName, flow)
+}
+
+// removeDropFlows removes the drop flows of mac, or all the drop flows if mac is nil.
+func removeDropFlows(device *network.Device, mac net.HardwareAddr) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	if mac != nil {
+		match.SetSrcMAC(mac)
+	}
+
+	flow, err := f.NewFlowMod(openflow.FlowDelete)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+	flow.SetTableID(0xFF) // ALL
+	flow.SetFlowMatch(match)
+
+	return device.SendFlow(appName, flow)
+}
+
+// refresh removes all the flows related to mac so that its packets are
+// evaluated again with the updated rules, and then installs the fabric-wide
+// drop flows if mac is denied everywhere.
+func (r *ACL) refresh(mac net.HardwareAddr) {
+	r.mutex.Lock()
+	finder := r.finder
+	denied := false
+	for _, v := range r.rules {
+		if bytes.Equal(v.MAC, mac) && v.scope() == 0 {
+			denied = !v.Allow
+		}
+	}
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return
+	}
+	for _, device := range finder.Devices() {
+		if err := removeDropFlows(device, mac); err != nil {
+			logger.Errorf("failed to remove the drop flows from %v: %v", device.ID(), err)
+			continue
+		}
+		if err := device.RemoveFlowByMAC(mac); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+		if !denied {
+			continue
+		}
+		if err := installDropFlow(device, mac, 0); err != nil {
+			logger.Errorf("failed to install the drop flow on %v: %v", device.ID(), err)
+		}
+	}
+}
+
+func (r *ACL) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/api/v1/acl/mac", r.listRule),
+		rest.Post("/api/v1/acl/mac", r.addRule),
+		rest.Delete("/api/v1/acl/mac/:id", r.removeRule),
+		rest.Options("/api/v1/acl/mac/:id", r.allowOrigin),
+		rest.Get("/api/v1/acl/source", r.showSource),
+	}
+}
+
+func (r *ACL) showSource(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.source == nil {
+		writeError(w, http.StatusNotFound, errors.New("no external source of the rules"))
+		return
+	}
+	r.mutex.Lock()
+	status := r.status
+	r.mutex.Unlock()
+
+	w.WriteJson(status)
+}
+
+func (r *ACL) allowOrigin(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE")
+}
+
+type ruleParam struct {
+	ID     uint64 `json:"id"`
+	MAC    string `json:"mac"`
+	DPID   uint64 `json:"dpid"`
+	Port   uint32 `json:"port"`
+	Action string `json:"action"`
+}
+
+func (r *ruleParam) toRule() (Rule, error) {
+	mac, err := net.ParseMAC(r.MAC)
+	if err != nil {
+		return Rule{}, err
+	}
+	if r.Port != 0 && r.DPID == 0 {
+		return Rule{}, errors.New("port scoped rule requires the switch DPID")
+	}
+
+	var allow bool
+	switch strings.ToLower(r.Action) {
+	case "allow":
+		allow = true
+	case "deny":
+		allow = false
+	default:
+		return Rule{}, fmt.Errorf("invalid action: %v", r.Action)
+	}
+
+	return Rule{MAC: mac, DPID: r.DPID, Port: r.Port, Allow: allow}, nil
+}
+
+func newRuleParam(rule Rule) ruleParam {
+	action := "deny"
+	if rule.Allow {
+		action = "allow"
+	}
+
+	return ruleParam{
+		ID:     rule.ID,
+		MAC:    rule.MAC.String(),
+		DPID:   rule.DPID,
+		Port:   rule.Port,
+		Action: action,
+	}
+}
+
+func (r *ACL) listRule(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	r.mutex.Lock()
+	rules := []ruleParam{}
+	for _, v := range r.rules {
+		rules = append(rules, newRuleParam(v))
+	}
+	r.mutex.Unlock()
+
+	w.WriteJson(&struct {
+		Rules []ruleParam `json:"rules"`
+	}{rules})
+}
+
+func (r *ACL) addRule(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.source != nil {
+		writeError(w, http.StatusConflict, errExternalRules)
+		return
+	}
+
+	param := ruleParam{}
+	if err := req.DecodeJsonPayload(&param); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rule, err := param.toRule()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := r.db.AddMACRule(rule)
+	if err != nil {
+		logger.Errorf("failed to add a new MAC rule: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rule.ID = id
+	logger.Infof("added a new MAC rule: %v", rule)
+
+	r.mutex.Lock()
+	r.rules = append(r.rules, rule)
+	r.mutex.Unlock()
+	r.refresh(rule.MAC)
+	event.NotifyACLUpdated(event.ACLUpdate{MAC: rule.MAC})
+
+	w.WriteJson(&struct {
+		ID uint64 `json:"id"`
+	}{id})
+}
+
+func (r *ACL) removeRule(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.source != nil {
+		writeError(w, http.StatusConflict, errExternalRules)
+		return
+	}
+
+	id, err := strconv.ParseUint(req.PathParam("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid rule id"))
+		return
+	}
+
+	rule, ok, err := r.db.RemoveMACRule(id)
+	if err != nil {
+		logger.Errorf("failed to remove a MAC rule: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown rule id"))
+		return
+	}
+	logger.Infof("removed a MAC rule: %v", rule)
+
+	r.mutex.Lock()
+	for i, v := range r.rules {
+		if v.ID == id {
+			r.rules = append(r.rules[:i], r.rules[i+1:]...)
+			break
+		}
+	}
+	r.mutex.Unlock()
+	r.refresh(rule.MAC)
+	event.NotifyACLUpdated(event.ACLUpdate{MAC: rule.MAC})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,144 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package acl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSourceInterval = 1 * time.Minute
+	sourceTimeout         = 10 * time.Second
+	// Maximum size of the documents read from a source.
+	maxSourceSize = 16 << 20
+)
+
+// source is an external source of the rules, which is an HTTP(S) URL or a
+// file path. Its document has the same format as the response of GET
+// /api/v1/acl/mac, and the IDs of the rules are ignored.
+type source struct {
+	location string
+	// checksum is the location of the SHA-256 digest of the document in hex,
+	// e.g., the output of sha256sum. Empty means no verification.
+	checksum string
+	client   *http.Client
+}
+
+func newSource(location, checksum string) *source {
+	return &source{
+		location: location,
+		checksum: checksum,
+		client:   &http.Client{Timeout: sourceTimeout},
+	}
+}
+
+// fetch reads the rules and the SHA-256 digest of their document in hex. It
+// fails if the digest does not match the checksum of the source, e.g., the
+// document is being written.
+func (r *source) fetch(ctx context.Context) (rules []Rule, digest string, err error) {
+	data, err := r.read(ctx, r.location)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	digest = hex.EncodeToString(sum[:])
+
+	if r.checksum != "" {
+		v, err := r.read(ctx, r.checksum)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "reading the checksum")
+		}
+		fields := strings.Fields(string(v))
+		if len(fields) == 0 || !strings.EqualFold(fields[0], digest) {
+			return nil, "", fmt.Errorf("checksum mismatch: SHA-256=%v", digest)
+		}
+	}
+
+	rules, err = parseRules(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return rules, digest, nil
+}
+
+func (r *source) read(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return ioutil.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSourceSize {
+		return nil, errors.New("too large document")
+	}
+
+	return data, nil
+}
+
+// parseRules parses the rules of a document, whose IDs are their positions
+// from 1.
+func parseRules(data []byte) ([]Rule, error) {
+	var doc struct {
+		Rules []ruleParam `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "decoding the rules")
+	}
+
+	rules := make([]Rule, 0, len(doc.Rules))
+	for i, v := range doc.Rules {
+		rule, err := v.toRule()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule #%v: %v", i+1, err)
+		}
+		rule.ID = uint64(i + 1)
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package acl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testRules = `{"rules": [
+	{"mac": "00:00:00:00:00:01", "action": "deny"},
+	{"id": 10, "mac": "00:00:00:00:00:02", "dpid": 1, "port": 2, "action": "allow"}
+]}`
+
+func TestSourceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, checksum := filepath.Join(dir, "rules.json"), filepath.Join(dir, "rules.json.sha256")
+	if err := ioutil.WriteFile(path, []byte(testRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(testRules))
+	digest := hex.EncodeToString(sum[:])
+	if err := ioutil.WriteFile(checksum, []byte(digest+"  rules.json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, v, err := newSource("file://"+path, checksum).fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != digest {
+		t.Fatalf("unexpected digest: %v", v)
+	}
+	if len(rules) != 2 || rules[0].ID != 1 || rules[0].Allow || rules[1].ID != 2 || !rules[1].Allow || rules[1].Port != 2 {
+		t.Fatalf("unexpected rules: %v", rules)
+	}
+
+	// The document is being written.
+	if err := ioutil.WriteFile(path, []byte(testRules[:20]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := newSource(path, checksum).fetch(context.Background()); err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+}
+
+func TestSourceHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rules":
+			w.Write([]byte(testRules))
+		case "/invalid":
+			w.Write([]byte(`{"rules": [{"mac": "00:00:00:00:00:01", "port": 1, "action": "deny"}]}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	rules, _, err := newSource(server.URL+"/rules", "").fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("unexpected rules: %v", rules)
+	}
+	// A port scoped rule requires the switch DPID.
+	if _, _, err := newSource(server.URL+"/invalid", "").fetch(context.Background()); err == nil {
+		t.Fatal("expected an invalid rule")
+	}
+	if _, _, err := newSource(server.URL+"/unknown", "").fetch(context.Background()); err == nil {
+		t.Fatal("expected a not found error")
+	}
+}
@@ -0,0 +1,796 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "Auth"
+
+var (
+	logger = logging.MustGetLogger("auth")
+
+	// A locally administered MAC address that is used as the source address of the EAPOL frames we send.
+	authenticatorMAC = net.HardwareAddr([]byte{0x06, 0xff, 0x29, 0x34, 0x82, 0x88})
+	// Port access entity (PAE) group address.
+	paeGroupMAC = net.HardwareAddr([]byte{0x01, 0x80, 0xC2, 0x00, 0x00, 0x03})
+)
+
+const (
+	// We use MSB of the cookie to mark the flows that should survive RemoveAllFlows().
+	flowCookie = 0x1<<63 | 0x8021
+	// Priorities of the EAPOL sender flow and the restriction flows. They should
+	// be higher than the one of the L2 switching flows.
+	eapolPriority    = 110
+	restrictPriority = 20
+	// Unauthenticated hosts cannot be authenticated again within this duration
+	// after they are rejected.
+	quietPeriod = 60 * time.Second
+	// Pending authentications are aborted if they are not completed within this duration.
+	pendingTimeout = 30 * time.Second
+)
+
+type sessionState int
+
+const (
+	statePending sessionState = iota
+	stateAuthorized
+	stateRejected
+)
+
+func (r sessionState) String() string {
+	switch r {
+	case statePending:
+		return "Pending"
+	case stateAuthorized:
+		return "Authorized"
+	case stateRejected:
+		return "Rejected"
+	default:
+		return "Unknown"
+	}
+}
+
+type session struct {
+	mac      net.HardwareAddr
+	port     *network.Port
+	state    sessionState
+	vlanID   uint16 // Zero means no VLAN assignment.
+	username string
+	// RADIUS State attribute of the ongoing EAP conversation.
+	radiusState []byte
+	eapID       uint8
+	timestamp   time.Time
+}
+
+type Auth struct {
+	app.BaseProcessor
+	conf        app.Config
+	radius      *radiusClient
+	cache       *resultCache
+	eapol       bool
+	macAuth     bool
+	macPassword string // Empty means the MAC address.
+	nasID       string
+	mutex       sync.Mutex
+	sessions    map[string]*session  // Key = MAC address.
+	restricted  map[string]time.Time // Key = port ID/MAC address, Value = when the restriction flow has been installed.
+	finder      network.Finder
+}
+
+func New(conf app.Config) *Auth {
+	return &Auth{
+		sessions:   make(map[string]*session),
+		restricted: make(map[string]time.Time),
+		conf:       conf,
+	}
+}
+
+func (r *Auth) Init(ctx context.Context, s app.Services) error {
+	servers, err := r.getServers()
+	if err != nil {
+		return err
+	}
+	secret := r.conf.GetString("radius_secret")
+	if len(secret) == 0 {
+		return errors.New("invalid auth.radius_secret in the config file")
+	}
+	timeout := r.conf.GetInt("radius_timeout")
+	if timeout <= 0 {
+		timeout = 3
+	}
+	deadTime := 30
+	if r.conf.IsSet("radius_dead_time") {
+		deadTime = r.conf.GetInt("radius_dead_time")
+		if deadTime < 0 {
+			return errors.New("invalid auth.radius_dead_time in the config file")
+		}
+	}
+	ttl := r.conf.GetInt("cache_ttl")
+	if ttl < 0 {
+		return errors.New("invalid auth.cache_ttl in the config file")
+	}
+	r.radius = newRADIUSClient(servers, secret, time.Duration(timeout)*time.Second, 2, time.Duration(deadTime)*time.Second)
+	r.radius.requests = s.Metrics.NewCounterVec("auth_radius_requests_total", "Number of the RADIUS requests for each server and their results.", "server", "result")
+	r.cache = newResultCache(time.Duration(ttl) * time.Second)
+	r.macPassword = r.conf.GetString("mac_password")
+
+	for _, v := range strings.Split(strings.Replace(r.conf.GetString("methods"), " ", "", -1), ",") {
+		switch strings.ToUpper(v) {
+		case "EAPOL":
+			r.eapol = true
+		case "MAC":
+			r.macAuth = true
+		default:
+			return fmt.Errorf("invalid auth.methods in the config file: %v", v)
+		}
+	}
+
+	r.nasID = r.conf.GetString("nas_identifier")
+	if len(r.nasID) == 0 {
+		r.nasID = "cherry"
+	}
+
+	return nil
+}
+
+// getServers returns the addresses of the RADIUS servers in auth.radius_host,
+// which are separated by comma and may have their own ports.
+func (r *Auth) getServers() ([]string, error) {
+	port := r.conf.GetInt("radius_port")
+	if port <= 0 || port > 0xFFFF {
+		return nil, errors.New("invalid auth.radius_port in the config file")
+	}
+
+	servers := []string{}
+	for _, v := range strings.Split(r.conf.GetString("radius_host"), ",") {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			continue
+		}
+		if _, p, err := net.SplitHostPort(v); err == nil {
+			if n, err := strconv.Atoi(p); err != nil || n <= 0 || n > 0xFFFF {
+				return nil, fmt.Errorf("invalid auth.radius_host in the config file: %v", v)
+			}
+		} else {
+			v = net.JoinHostPort(v, strconv.Itoa(port))
+		}
+		servers = append(servers, v)
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("invalid auth.radius_host in the config file")
+	}
+
+	return servers, nil
+}
+
+func (r *Auth) Name() string {
+	return appName
+}
+
+func (r *Auth) String() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%v", r.Name()))
+	for _, v := range r.sessions {
+		buf.WriteString(fmt.Sprintf("\n\tMAC=%v, Port=%v, State=%v, VLAN=%v, User=%v", v.mac, v.port.ID(), v.state, v.vlanID, v.username))
+	}
+
+	return buf.String()
+}
+
+// Health returns an error if none of the RADIUS servers is responding.
+func (r *Auth) Health() error {
+	if r.radius.alive() == 0 {
+		return errors.New("no RADIUS server is responding")
+	}
+
+	return nil
+}
+
+// Authorized returns whether the host whose MAC address is mac has been
+// authenticated on the port. vlanID is the VLAN ID assigned by the RADIUS server,
+// and it will be zero if there is no assignment.
+func (r *Auth) Authorized(mac net.HardwareAddr, port *network.Port) (vlanID uint16, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, ok := r.sessions[mac.String()]
+	if !ok || s.state != stateAuthorized || s.port.ID() != port.ID() {
+		return 0, false
+	}
+
+	return s.vlanID, true
+}
+
+func (r *Auth) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	// Remember the finder so that the flows can be removed when the application is paused.
+	r.mutex.Lock()
+	r.finder = finder
+	r.mutex.Unlock()
+
+	if r.eapol {
+		if err := installEAPOLSender(device); err != nil {
+			return errors.Wrap(err, "installing the EAPOL sender flow")
+		}
+	}
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+// Pause removes the EAPOL sender and the restriction flows from all the
+// devices, so that the unauthenticated hosts are not blocked while the
+// application is disabled.
+func (r *Auth) Pause() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.restricted = make(map[string]time.Time)
+	r.mutex.Unlock()
+
+	if finder != nil {
+		removeAuthFlows(finder.Devices())
+	}
+
+	return nil
+}
+
+// Resume installs the EAPOL sender flows again, and then removes the flows
+// installed while the application was disabled, so that the unauthenticated
+// hosts are restricted again.
+func (r *Auth) Resume() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return nil
+	}
+	for _, device := range finder.Devices() {
+		if r.eapol {
+			if err := installEAPOLSender(device); err != nil {
+				logger.Errorf("failed to install the EAPOL sender flow on %v: %v", device.ID(), err)
+				continue
+			}
+		}
+		if err := device.RemoveAllFlows(); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+func removeAuthFlows(devices []*network.Device) {
+	for _, device := range devices {
+		if device.IsClosed() {
+			continue
+		}
+		f := device.Factory()
+		match, err := f.NewMatch()
+		if err != nil {
+			logger.Errorf("failed to create a match: %v", err)
+			continue
+		}
+		flow, err := f.NewFlowMod(openflow.FlowDelete)
+		if err != nil {
+			logger.Errorf("failed to create a flow mod: %v", err)
+			continue
+		}
+		flow.SetCookie(flowCookie)
+		flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+		flow.SetTableID(0xFF) // ALL
+		flow.SetFlowMatch(match)
+		if err := device.SendFlow(appName, flow); err != nil {
+			logger.Errorf("failed to remove the authentication flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+}
+
+// installEAPOLSender installs a permanent flow that forwards EAPOL frames to the
+// controller so that they can bypass the restriction flows.
+func installEAPOLSender(device *network.Device) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	match.SetEtherType(0x888E) // EAPOL
+
+	outPort := openflow.NewOutPort()
+	outPort.SetController()
+	action, err := f.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(outPort)
+	inst, err := f.NewInstruction()
+	if err != nil {
+		return err
+	}
+	inst.ApplyAction(action)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	// Permanent flow
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(0)
+	flow.SetPriority(eapolPriority)
+	flow.SetFlowMatch(match)
+	flow.SetFlowInstruction(inst)
+
+	return device.SendFlow(appName, flow)
+}
+
+func (r *Auth) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	// Ports between switches are not subject to the authentication.
+	if finder.IsEdge(ingress) {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	if eth.Type == 0x888E {
+		if !r.eapol {
+			logger.Debugf("dropping the EAPOL frame from %v because EAPOL is disabled", eth.SrcMAC)
+			return nil
+		}
+		// EAPOL frames are consumed by this processor.
+		return r.handleEAPOL(finder, ingress, eth)
+	}
+
+	if _, ok := r.Authorized(eth.SrcMAC, ingress); ok {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	// The host is unauthenticated. Restrict it until the authentication succeeds.
+	if err := r.restrict(ingress, eth.SrcMAC); err != nil {
+		logger.Errorf("failed to restrict the host (MAC=%v): %v", eth.SrcMAC, err)
+	}
+	if r.macAuth {
+		r.startMACAuth(ingress, eth.SrcMAC)
+	}
+
+	// Drop this packet.
+	return nil
+}
+
+func (r *Auth) restrict(ingress *network.Port, mac net.HardwareAddr) error {
+	key := fmt.Sprintf("%v/%v", ingress.ID(), mac)
+
+	r.mutex.Lock()
+	// The restriction flow expires after the quiet period.
+	if t, ok := r.restricted[key]; ok && time.Since(t) < quietPeriod {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.restricted[key] = time.Now()
+	r.mutex.Unlock()
+
+	device := ingress.Device()
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(ingress.Number())
+	match.SetInPort(inPort)
+	match.SetSrcMAC(mac)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	// The flow is removed when the host is authenticated. Otherwise, it expires
+	// after the quiet period, so that the packets of the host are delivered to
+	// the controller again and the rejected or failed authentication is retried.
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(uint16(quietPeriod / time.Second))
+	flow.SetPriority(restrictPriority)
+	flow.SetFlowMatch(match)
+	// No instruction means drop.
+	logger.Debugf("restricting the unauthenticated host: port=%v, MAC=%v", ingress.ID(), mac)
+
+	return device.SendFlow(appName, flow)
+}
+
+func (r *Auth) unrestrict(port *network.Port, mac net.HardwareAddr) error {
+	key := fmt.Sprintf("%v/%v", port.ID(), mac)
+
+	r.mutex.Lock()
+	delete(r.restricted, key)
+	r.mutex.Unlock()
+
+	device := port.Device()
+	if device.IsClosed() {
+		return nil
+	}
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(port.Number())
+	match.SetInPort(inPort)
+	match.SetSrcMAC(mac)
+
+	flow, err := f.NewFlowMod(openflow.FlowDelete)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+	flow.SetTableID(0xFF) // ALL
+	flow.SetFlowMatch(match)
+
+	return device.SendFlow(appName, flow)
+}
+
+// getSession returns the session of mac. A new pending session is created if
+// there is no session, or the existing one has been expired.
+func (r *Auth) getSession(port *network.Port, mac net.HardwareAddr) (s *session, created bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, ok := r.sessions[mac.String()]
+	if ok {
+		expired := false
+		switch s.state {
+		case statePending:
+			expired = time.Since(s.timestamp) > pendingTimeout
+		case stateRejected:
+			expired = time.Since(s.timestamp) > quietPeriod
+		case stateAuthorized:
+			// The host has been moved to another port.
+			expired = s.port.ID() != port.ID()
+		}
+		if !expired {
+			return s, false
+		}
+	}
+
+	s = &session{
+		mac:       mac,
+		port:      port,
+		state:     statePending,
+		timestamp: time.Now(),
+	}
+	r.sessions[mac.String()] = s
+
+	return s, true
+}
+
+func (r *Auth) setState(s *session, state sessionState, vlanID uint16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s.state = state
+	s.vlanID = vlanID
+	s.timestamp = time.Now()
+}
+
+func (r *Auth) startMACAuth(ingress *network.Port, mac net.HardwareAddr) {
+	s, created := r.getSession(ingress, mac)
+	if !created {
+		return
+	}
+
+	// The host accepted recently is authorized without querying the servers.
+	if vlanID, ok := r.cache.get(mac.String(), time.Now()); ok {
+		logger.Debugf("using the cached RADIUS result: MAC=%v", mac)
+		r.accept(s, vlanID)
+		return
+	}
+
+	go func() {
+		// MAC authentication uses the normalized MAC address as the username and
+		// the password unless auth.mac_password is configured.
+		username := strings.Replace(mac.String(), ":", "", -1)
+		password := r.macPassword
+		if len(password) == 0 {
+			password = username
+		}
+		p := r.newAccessRequest(ingress, mac, username)
+		p.addUint32(attrServiceType, serviceTypeCallCheck)
+		p.addString(attrUserPassword, password)
+
+		resp, err := r.radius.exchange(p)
+		if err != nil {
+			logger.Errorf("failed to authenticate the host (MAC=%v): %v", mac, err)
+			r.setState(s, stateRejected, 0)
+			return
+		}
+		if resp.code == radiusAccessAccept {
+			r.cache.put(mac.String(), getAssignedVLAN(resp), time.Now())
+		}
+		r.handleResult(s, resp)
+	}()
+}
+
+func (r *Auth) newAccessRequest(port *network.Port, mac net.HardwareAddr, username string) *radiusPacket {
+	p := new(radiusPacket)
+	p.addString(attrUserName, username)
+	p.addString(attrNASIdentifier, r.nasID)
+	p.addUint32(attrNASPort, port.Number())
+	p.addUint32(attrNASPortType, nasPortTypeEthernet)
+	p.addString(attrCalledStationID, port.Device().ID())
+	p.addString(attrCallingStationID, strings.ToUpper(strings.Replace(mac.String(), ":", "-", -1)))
+
+	return p
+}
+
+// handleResult processes the final RADIUS response, and then returns true if it is
+// an Access-Accept or Access-Reject.
+func (r *Auth) handleResult(s *session, resp *radiusPacket) bool {
+	switch resp.code {
+	case radiusAccessAccept:
+		r.accept(s, getAssignedVLAN(resp))
+		return true
+	case radiusAccessReject:
+		r.setState(s, stateRejected, 0)
+		logger.Warningf("host authentication rejected: MAC=%v, port=%v", s.mac, s.port.ID())
+		return true
+	case radiusAccessChallenge:
+		return false
+	default:
+		logger.Errorf("unexpected RADIUS response code: %v", resp.code)
+		r.setState(s, stateRejected, 0)
+		return true
+	}
+}
+
+// accept authorizes the host of s with vlanID, and then removes its restriction.
+func (r *Auth) accept(s *session, vlanID uint16) {
+	r.setState(s, stateAuthorized, vlanID)
+	logger.Infof("host authenticated: MAC=%v, port=%v, VLAN=%v", s.mac, s.port.ID(), vlanID)
+	event.NotifyHostAuthenticated(event.HostAuth{
+		MAC:    s.mac,
+		DPID:   s.port.Device().Features().DPID,
+		Port:   s.port.Number(),
+		VLANID: vlanID,
+		Source: r.Name(),
+	})
+	if err := r.unrestrict(s.port, s.mac); err != nil {
+		logger.Errorf("failed to remove the restriction flow (MAC=%v): %v", s.mac, err)
+	}
+}
+
+// getAssignedVLAN returns the VLAN ID specified by the tunnel attributes (RFC 3580).
+func getAssignedVLAN(resp *radiusPacket) uint16 {
+	typ, ok := resp.get(attrTunnelType)
+	// The first byte is a tag.
+	if !ok || len(typ) != 4 || typ[3] != tunnelTypeVLAN {
+		return 0
+	}
+	id, ok := resp.get(attrTunnelPrivateGroupID)
+	if !ok || len(id) == 0 {
+		return 0
+	}
+	// Skip the optional tag.
+	if id[0] < 0x20 {
+		id = id[1:]
+	}
+	var vlanID uint16
+	if _, err := fmt.Sscanf(string(id), "%d", &vlanID); err != nil || vlanID > 4095 {
+		logger.Errorf("invalid Tunnel-Private-Group-ID: %v", string(id))
+		return 0
+	}
+
+	return vlanID
+}
+
+func (r *Auth) handleEAPOL(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	eapol := new(protocol.EAPOL)
+	if err := eapol.UnmarshalBinary(eth.Payload); err != nil {
+		return err
+	}
+	logger.Debugf("received EAPOL frame from %v: %v", eth.SrcMAC, eapol)
+
+	switch eapol.Type {
+	case protocol.EAPOLStart:
+		s, _ := r.getSession(ingress, eth.SrcMAC)
+		return r.sendIdentityRequest(s)
+	case protocol.EAPOLLogoff:
+		return r.logoff(finder, ingress, eth.SrcMAC)
+	case protocol.EAPOLPacket:
+		eap := new(protocol.EAP)
+		if err := eap.UnmarshalBinary(eapol.Body); err != nil {
+			return err
+		}
+		if eap.Code != protocol.EAPResponse {
+			logger.Debugf("ignoring unexpected EAP packet: %v", eap)
+			return nil
+		}
+		s, _ := r.getSession(ingress, eth.SrcMAC)
+		if eap.Type == 1 { // Identity
+			s.username = string(eap.Data)
+		}
+		go r.relayEAP(s, eapol.Body)
+		return nil
+	default:
+		// Ignore EAPOL-Key and other types.
+		return nil
+	}
+}
+
+func (r *Auth) sendIdentityRequest(s *session) error {
+	r.mutex.Lock()
+	s.eapID++
+	id := s.eapID
+	r.mutex.Unlock()
+
+	eap := protocol.EAP{
+		Code:       protocol.EAPRequest,
+		Identifier: id,
+		Type:       1, // Identity
+	}
+	body, err := eap.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return r.sendEAPOL(s, body)
+}
+
+// relayEAP forwards the EAP message to the RADIUS server, and then relays its response to the host.
+func (r *Auth) relayEAP(s *session, msg []byte) {
+	p := r.newAccessRequest(s.port, s.mac, s.username)
+	for len(msg) > 0 {
+		n := len(msg)
+		if n > 253 {
+			n = 253
+		}
+		p.add(attrEAPMessage, msg[:n])
+		msg = msg[n:]
+	}
+	r.mutex.Lock()
+	state := s.radiusState
+	r.mutex.Unlock()
+	if state != nil {
+		p.add(attrState, state)
+	}
+
+	resp, err := r.radius.exchange(p)
+	if err != nil {
+		logger.Errorf("failed to relay the EAP message (MAC=%v): %v", s.mac, err)
+		return
+	}
+
+	r.mutex.Lock()
+	s.radiusState, _ = resp.get(attrState)
+	r.mutex.Unlock()
+
+	if eap := resp.concat(attrEAPMessage); len(eap) > 0 {
+		if err := r.sendEAPOL(s, eap); err != nil {
+			logger.Errorf("failed to send the EAPOL frame (MAC=%v): %v", s.mac, err)
+		}
+	}
+	r.handleResult(s, resp)
+}
+
+func (r *Auth) sendEAPOL(s *session, body []byte) error {
+	eapol := protocol.NewEAPOL(protocol.EAPOLPacket, body)
+	payload, err := eapol.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	eth := protocol.Ethernet{
+		SrcMAC:  authenticatorMAC,
+		DstMAC:  s.mac,
+		Type:    0x888E,
+		Payload: payload,
+	}
+	frame, err := eth.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return r.PacketOut(s.port, frame)
+}
+
+func (r *Auth) logoff(finder network.Finder, port *network.Port, mac net.HardwareAddr) error {
+	r.mutex.Lock()
+	s, ok := r.sessions[mac.String()]
+	if ok && s.port.ID() == port.ID() {
+		delete(r.sessions, mac.String())
+	}
+	r.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+	logger.Infof("host logged off: MAC=%v, port=%v", mac, port.ID())
+
+	if err := r.restrict(port, mac); err != nil {
+		return err
+	}
+	// Remove the flows heading to the host so that it cannot receive packets anymore.
+	for _, device := range finder.Devices() {
+		if err := device.RemoveFlowByMAC(mac); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+func (r *Auth) OnPortDown(finder network.Finder, port *network.Port) error {
+	r.mutex.Lock()
+	for k, v := range r.sessions {
+		if v.port.ID() == port.ID() {
+			logger.Debugf("removing the authentication session on the down port: MAC=%v, port=%v", v.mac, port.ID())
+			delete(r.sessions, k)
+		}
+	}
+	for k := range r.restricted {
+		if strings.HasPrefix(k, port.ID()+"/") {
+			delete(r.restricted, k)
+		}
+	}
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnPortDown(finder, port)
+}
+
+func (r *Auth) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	for k, v := range r.sessions {
+		if v.port.Device().ID() == device.ID() {
+			delete(r.sessions, k)
+		}
+	}
+	for k := range r.restricted {
+		if strings.HasPrefix(k, device.ID()+":") {
+			delete(r.restricted, k)
+		}
+	}
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
@@ -0,0 +1,96 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Maximum number of the cached results, which bounds the memory used by the
+// MAC addresses of the hosts.
+const maxCacheEntries = 65536
+
+type cacheEntry struct {
+	vlanID  uint16
+	expires time.Time
+}
+
+// resultCache remembers the hosts accepted by the RADIUS servers for ttl, so
+// that they are authorized again without querying the servers, e.g., when they
+// are reconnected or the servers are not responding. The rejected hosts are not
+// cached as they are already throttled by the quiet period.
+type resultCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]cacheEntry // Key = MAC address.
+}
+
+func newResultCache(ttl time.Duration) *resultCache {
+	return &resultCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// get returns the VLAN ID assigned to the accepted host whose MAC address is
+// mac if it has not been expired.
+func (r *resultCache) get(mac string, now time.Time) (vlanID uint16, ok bool) {
+	if r.ttl <= 0 {
+		return 0, false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.entries[mac]
+	if !ok {
+		return 0, false
+	}
+	if !now.Before(v.expires) {
+		delete(r.entries, mac)
+		return 0, false
+	}
+
+	return v.vlanID, true
+}
+
+func (r *resultCache) put(mac string, vlanID uint16, now time.Time) {
+	if r.ttl <= 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.entries) >= maxCacheEntries {
+		for k, v := range r.entries {
+			if !now.Before(v.expires) {
+				delete(r.entries, k)
+			}
+		}
+		if len(r.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	r.entries[mac] = cacheEntry{vlanID: vlanID, expires: now.Add(r.ttl)}
+}
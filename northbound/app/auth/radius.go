@@ -0,0 +1,458 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+)
+
+const (
+	radiusAccessRequest   = 1
+	radiusAccessAccept    = 2
+	radiusAccessReject    = 3
+	radiusAccessChallenge = 11
+)
+
+const (
+	attrUserName             = 1
+	attrUserPassword         = 2
+	attrNASPort              = 5
+	attrServiceType          = 6
+	attrState                = 24
+	attrCalledStationID      = 30
+	attrCallingStationID     = 31
+	attrNASIdentifier        = 32
+	attrNASPortType          = 61
+	attrTunnelType           = 64
+	attrTunnelMediumType     = 65
+	attrEAPMessage           = 79
+	attrMessageAuthenticator = 80
+	attrTunnelPrivateGroupID = 81
+)
+
+const (
+	// Service-Type value for the MAC authentication, which is the Call Check of
+	// the dial-up lines.
+	serviceTypeCallCheck = 10
+	// NAS-Port-Type value for the Ethernet.
+	nasPortTypeEthernet = 15
+	// Tunnel-Type value for the VLAN (RFC 3580).
+	tunnelTypeVLAN = 13
+)
+
+type radiusAttribute struct {
+	typ   uint8
+	value []byte
+}
+
+type radiusPacket struct {
+	code          uint8
+	identifier    uint8
+	authenticator [16]byte
+	attributes    []radiusAttribute
+}
+
+func (r *radiusPacket) add(typ uint8, value []byte) {
+	r.attributes = append(r.attributes, radiusAttribute{typ: typ, value: value})
+}
+
+func (r *radiusPacket) addString(typ uint8, value string) {
+	r.add(typ, []byte(value))
+}
+
+func (r *radiusPacket) addUint32(typ uint8, value uint32) {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, value)
+	r.add(typ, v)
+}
+
+// get returns the first attribute whose type is typ.
+func (r *radiusPacket) get(typ uint8) (value []byte, ok bool) {
+	for _, v := range r.attributes {
+		if v.typ == typ {
+			return v.value, true
+		}
+	}
+
+	return nil, false
+}
+
+// concat returns concatenated values of all the attributes whose type is typ.
+func (r *radiusPacket) concat(typ uint8) []byte {
+	var buf bytes.Buffer
+	for _, v := range r.attributes {
+		if v.typ == typ {
+			buf.Write(v.value)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (r *radiusPacket) MarshalBinary() ([]byte, error) {
+	v := make([]byte, 20)
+	v[0] = r.code
+	v[1] = r.identifier
+	copy(v[4:20], r.authenticator[:])
+	for _, attr := range r.attributes {
+		if len(attr.value) > 253 {
+			return nil, fmt.Errorf("too long RADIUS attribute: type=%v", attr.typ)
+		}
+		v = append(v, attr.typ, uint8(2+len(attr.value)))
+		v = append(v, attr.value...)
+	}
+	if len(v) > 4096 {
+		return nil, errors.New("too long RADIUS packet")
+	}
+	binary.BigEndian.PutUint16(v[2:4], uint16(len(v)))
+
+	return v, nil
+}
+
+func (r *radiusPacket) UnmarshalBinary(data []byte) error {
+	if len(data) < 20 {
+		return errors.New("invalid RADIUS packet length")
+	}
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < 20 || len(data) < length {
+		return errors.New("invalid RADIUS length field")
+	}
+
+	r.code = data[0]
+	r.identifier = data[1]
+	copy(r.authenticator[:], data[4:20])
+	r.attributes = nil
+	buf := data[20:length]
+	for len(buf) > 0 {
+		if len(buf) < 2 || buf[1] < 2 || len(buf) < int(buf[1]) {
+			return errors.New("invalid RADIUS attribute length")
+		}
+		r.add(buf[0], buf[2:buf[1]])
+		buf = buf[buf[1]:]
+	}
+
+	return nil
+}
+
+// radiusServer is a RADIUS server and the time until which it is considered
+// dead because it has not responded.
+type radiusServer struct {
+	address string
+	dead    time.Time
+}
+
+// radiusClient is a minimal RADIUS client (RFC 2865 and RFC 3579) that is safe
+// for concurrent use by multiple goroutines. It sends a request to the servers
+// in order, and fails over to the next one if a server does not respond. The
+// failed server is skipped for deadTime unless all the servers have failed.
+type radiusClient struct {
+	servers  []*radiusServer
+	secret   []byte
+	timeout  time.Duration
+	retries  int
+	deadTime time.Duration
+	// Number of the requests for each server and their results.
+	requests *metrics.CounterVec
+
+	mutex      sync.Mutex
+	identifier uint8
+}
+
+func newRADIUSClient(servers []string, secret string, timeout time.Duration, retries int, deadTime time.Duration) *radiusClient {
+	c := &radiusClient{
+		secret:   []byte(secret),
+		timeout:  timeout,
+		retries:  retries,
+		deadTime: deadTime,
+	}
+	for _, v := range servers {
+		c.servers = append(c.servers, &radiusServer{address: v})
+	}
+
+	return c
+}
+
+func (r *radiusClient) nextIdentifier() uint8 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.identifier++
+	return r.identifier
+}
+
+// candidates returns the servers that should be tried in order. The dead
+// servers are tried after the alive ones so that they are detected once they
+// recover while all the others are dead.
+func (r *radiusClient) candidates() []*radiusServer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	alive := make([]*radiusServer, 0, len(r.servers))
+	dead := make([]*radiusServer, 0)
+	for _, v := range r.servers {
+		if now.Before(v.dead) {
+			dead = append(dead, v)
+		} else {
+			alive = append(alive, v)
+		}
+	}
+
+	return append(alive, dead...)
+}
+
+func (r *radiusClient) setDead(s *radiusServer, dead bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !dead {
+		s.dead = time.Time{}
+		return
+	}
+	s.dead = time.Now().Add(r.deadTime)
+}
+
+// alive returns the number of the servers that are not considered dead.
+func (r *radiusClient) alive() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, v := range r.servers {
+		if !now.Before(v.dead) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (r *radiusClient) count(server, result string) {
+	if r.requests != nil {
+		r.requests.WithLabelValues(server, result).Inc()
+	}
+}
+
+// encryptPassword hides the password as described in RFC 2865 section 5.2.
+func encryptPassword(password, secret []byte, authenticator [16]byte) []byte {
+	if len(password) == 0 || len(password)%16 != 0 {
+		padding := 16 - len(password)%16
+		password = append(password, make([]byte, padding)...)
+	}
+
+	result := make([]byte, 0, len(password))
+	prev := authenticator[:]
+	for i := 0; i < len(password); i += 16 {
+		h := md5.New()
+		h.Write(secret)
+		h.Write(prev)
+		b := h.Sum(nil)
+		for j := 0; j < 16; j++ {
+			b[j] ^= password[i+j]
+		}
+		result = append(result, b...)
+		prev = b
+	}
+
+	return result
+}
+
+// sign fills the Message-Authenticator attribute of an Access-Request packet. The
+// attribute should be the last one added to p.
+func (r *radiusClient) sign(p *radiusPacket) error {
+	if len(p.attributes) == 0 || p.attributes[len(p.attributes)-1].typ != attrMessageAuthenticator {
+		panic("Message-Authenticator should be the last attribute")
+	}
+
+	v, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(md5.New, r.secret)
+	mac.Write(v)
+	p.attributes[len(p.attributes)-1].value = mac.Sum(nil)
+
+	return nil
+}
+
+// verify checks the Response Authenticator and the Message-Authenticator, if
+// it exists, of a response packet for the request whose authenticator is auth.
+func (r *radiusClient) verify(resp []byte, auth [16]byte) error {
+	if len(resp) < 20 {
+		return errors.New("invalid RADIUS packet length")
+	}
+	length := int(binary.BigEndian.Uint16(resp[2:4]))
+	if length < 20 || len(resp) < length {
+		return errors.New("invalid RADIUS length field")
+	}
+	h := md5.New()
+	h.Write(resp[0:4])
+	h.Write(auth[:])
+	h.Write(resp[20:length])
+	h.Write(r.secret)
+	if !hmac.Equal(h.Sum(nil), resp[4:20]) {
+		return errors.New("invalid RADIUS response authenticator")
+	}
+
+	p := new(radiusPacket)
+	if err := p.UnmarshalBinary(resp); err != nil {
+		return err
+	}
+	expected, ok := p.get(attrMessageAuthenticator)
+	if !ok {
+		return nil
+	}
+	// Recalculate the Message-Authenticator using the request authenticator and the zeroed attribute.
+	v := make([]byte, length)
+	copy(v, resp[:length])
+	copy(v[4:20], auth[:])
+	offset := 20
+	for offset < length {
+		if length-offset < 2 || v[offset+1] < 2 || length-offset < int(v[offset+1]) {
+			return errors.New("invalid RADIUS attribute length")
+		}
+		if v[offset] == attrMessageAuthenticator {
+			copy(v[offset+2:offset+int(v[offset+1])], make([]byte, 16))
+		}
+		offset += int(v[offset+1])
+	}
+	mac := hmac.New(md5.New, r.secret)
+	mac.Write(v)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("invalid RADIUS message authenticator")
+	}
+
+	return nil
+}
+
+// exchange sends the Access-Request packet p to the servers until one of them
+// responds, and then returns a verified response.
+func (r *radiusClient) exchange(p *radiusPacket) (*radiusPacket, error) {
+	p.code = radiusAccessRequest
+	p.identifier = r.nextIdentifier()
+	if _, err := rand.Read(p.authenticator[:]); err != nil {
+		return nil, err
+	}
+	// Password should be encrypted using the final request authenticator.
+	for i, attr := range p.attributes {
+		if attr.typ == attrUserPassword {
+			p.attributes[i].value = encryptPassword(attr.value, r.secret, p.authenticator)
+		}
+	}
+	p.add(attrMessageAuthenticator, make([]byte, 16))
+	if err := r.sign(p); err != nil {
+		return nil, err
+	}
+	req, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range r.candidates() {
+		resp, err := r.send(server.address, req, p)
+		if err != nil {
+			logger.Warningf("failed to query the RADIUS server %v: %v", server.address, err)
+			r.count(server.address, "failure")
+			r.setDead(server, true)
+			continue
+		}
+		r.count(server.address, radiusCodeName(resp.code))
+		r.setDead(server, false)
+
+		return resp, nil
+	}
+
+	return nil, errors.New("no response from the RADIUS servers")
+}
+
+// send sends the encoded request req of p to server, and then returns its
+// verified response.
+func (r *radiusClient) send(server string, req []byte, p *radiusPacket) (*radiusPacket, error) {
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 4096)
+	for i := 0; i <= r.retries; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(r.timeout))
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if e, ok := err.(net.Error); ok && e.Timeout() {
+					logger.Debugf("RADIUS request timeout: server=%v, retry=%v", server, i)
+					break
+				}
+				return nil, err
+			}
+			// Ignore the responses for other requests.
+			if n < 20 || buf[1] != p.identifier {
+				continue
+			}
+			// A forged or corrupted datagram does not mean that the server has
+			// failed, so keep waiting for the genuine response.
+			if err := r.verify(buf[:n], p.authenticator); err != nil {
+				logger.Warningf("ignoring the RADIUS response from %v: %v", server, err)
+				continue
+			}
+			resp := new(radiusPacket)
+			if err := resp.UnmarshalBinary(buf[:n]); err != nil {
+				logger.Warningf("ignoring the RADIUS response from %v: %v", server, err)
+				continue
+			}
+
+			return resp, nil
+		}
+	}
+
+	return nil, errors.New("no response")
+}
+
+func radiusCodeName(code uint8) string {
+	switch code {
+	case radiusAccessAccept:
+		return "accept"
+	case radiusAccessReject:
+		return "reject"
+	case radiusAccessChallenge:
+		return "challenge"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package auth
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+const testSecret = "secret"
+
+// serveRADIUS answers the requests on a new UDP socket with the Access-Accept,
+// and then returns the address of the socket.
+func serveRADIUS(t *testing.T) (addr string, closer func()) {
+	return serveForgedRADIUS(t, false)
+}
+
+// serveForgedRADIUS is same as serveRADIUS except that it sends a response
+// with an invalid authenticator before the genuine one if forged is true.
+func serveForgedRADIUS(t *testing.T, forged bool) (addr string, closer func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := new(radiusPacket)
+			if err := req.UnmarshalBinary(buf[:n]); err != nil {
+				continue
+			}
+			resp := &radiusPacket{code: radiusAccessAccept, identifier: req.identifier}
+			resp.add(attrTunnelType, []byte{0, 0, 0, tunnelTypeVLAN})
+			resp.addString(attrTunnelPrivateGroupID, "100")
+			v, _ := resp.MarshalBinary()
+			h := md5.New()
+			h.Write(v[0:4])
+			h.Write(req.authenticator[:])
+			h.Write(v[20:])
+			h.Write([]byte(testSecret))
+			if forged {
+				conn.WriteTo(v, peer)
+			}
+			copy(v[4:20], h.Sum(nil))
+			conn.WriteTo(v, peer)
+		}
+	}()
+
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+// closedAddress returns an UDP address that nothing listens on.
+func closedAddress(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().String()
+}
+
+func TestRADIUSFailover(t *testing.T) {
+	addr, closer := serveRADIUS(t)
+	defer closer()
+
+	client := newRADIUSClient([]string{closedAddress(t), addr}, testSecret, 100*time.Millisecond, 0, time.Minute)
+	for i := 0; i < 2; i++ {
+		p := new(radiusPacket)
+		p.addString(attrUserName, "001122334455")
+		p.addString(attrUserPassword, "001122334455")
+		resp, err := client.exchange(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.code != radiusAccessAccept || getAssignedVLAN(resp) != 100 {
+			t.Fatalf("unexpected response: code=%v, VLAN=%v", resp.code, getAssignedVLAN(resp))
+		}
+	}
+	if n := client.alive(); n != 1 {
+		t.Fatalf("unexpected number of the alive servers: %v", n)
+	}
+	// The dead server should be tried after the alive one.
+	if c := client.candidates(); c[0].address != addr {
+		t.Fatalf("unexpected order of the servers: %v", c[0].address)
+	}
+
+	closer()
+	p := new(radiusPacket)
+	p.addString(attrUserName, "001122334455")
+	if _, err := client.exchange(p); err == nil {
+		t.Fatal("expected no response")
+	}
+	if n := client.alive(); n != 0 {
+		t.Fatalf("unexpected number of the alive servers: %v", n)
+	}
+}
+
+func TestRADIUSForgedResponse(t *testing.T) {
+	addr, closer := serveForgedRADIUS(t, true)
+	defer closer()
+
+	client := newRADIUSClient([]string{addr}, testSecret, time.Second, 0, time.Minute)
+	p := new(radiusPacket)
+	p.addString(attrUserName, "001122334455")
+	resp, err := client.exchange(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.code != radiusAccessAccept {
+		t.Fatalf("unexpected response code: %v", resp.code)
+	}
+	// The forged response should not mark the server dead.
+	if n := client.alive(); n != 1 {
+		t.Fatalf("unexpected number of the alive servers: %v", n)
+	}
+}
+
+func TestEncryptPassword(t *testing.T) {
+	var auth [16]byte
+	binary.BigEndian.PutUint64(auth[:], 0x0123456789ABCDEF)
+	v := encryptPassword([]byte("password"), []byte(testSecret), auth)
+	if len(v) != 16 {
+		t.Fatalf("unexpected length: %v", len(v))
+	}
+	// XOR with the same key stream recovers the padded password.
+	h := md5.New()
+	h.Write([]byte(testSecret))
+	h.Write(auth[:])
+	b := h.Sum(nil)
+	for i := range b {
+		b[i] ^= v[i]
+	}
+	if string(b[:8]) != "password" || b[8] != 0 {
+		t.Fatalf("unexpected password: %q", b)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	now := time.Now()
+	c := newResultCache(time.Minute)
+	c.put("00:11:22:33:44:55", 100, now)
+	if v, ok := c.get("00:11:22:33:44:55", now.Add(30*time.Second)); !ok || v != 100 {
+		t.Fatalf("unexpected result: VLAN=%v, ok=%v", v, ok)
+	}
+	if _, ok := c.get("00:11:22:33:44:55", now.Add(time.Minute)); ok {
+		t.Fatal("expected an expired result")
+	}
+
+	c = newResultCache(0)
+	c.put("00:11:22:33:44:55", 100, now)
+	if _, ok := c.get("00:11:22:33:44:55", now); ok {
+		t.Fatal("expected the disabled cache")
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	client := newRADIUSClient(nil, testSecret, time.Second, 0, time.Minute)
+	var auth [16]byte
+	for _, length := range []uint16{0, 19, 21, 4096} {
+		v := make([]byte, 20)
+		v[0] = radiusAccessAccept
+		binary.BigEndian.PutUint16(v[2:4], length)
+		if err := client.verify(v, auth); err == nil {
+			t.Fatalf("expected an error for the length field %v", length)
+		}
+	}
+	if err := client.verify(make([]byte, 10), auth); err == nil {
+		t.Fatal("expected an error for the short packet")
+	}
+}
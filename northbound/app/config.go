@@ -0,0 +1,81 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package app
+
+import (
+	"github.com/superkkt/viper"
+)
+
+// Config is the section of the config file for an application, whose keys are
+// relative to the section, e.g., probe_interval of the discovery section. The
+// values are read from the config file at the time of the call, so that the
+// applications that support reloading see the changed values.
+type Config interface {
+	// Section returns the name of the section.
+	Section() string
+	IsSet(key string) bool
+	GetString(key string) string
+	GetBool(key string) bool
+	GetInt(key string) int
+	GetInt64(key string) int64
+	// Defaults returns the default section shared by all the applications.
+	Defaults() Config
+}
+
+// NewConfig returns the section of the config file whose name is section.
+func NewConfig(section string) Config {
+	return viperConfig(section)
+}
+
+type viperConfig string
+
+func (r viperConfig) Section() string {
+	return string(r)
+}
+
+func (r viperConfig) key(k string) string {
+	return string(r) + "." + k
+}
+
+func (r viperConfig) IsSet(key string) bool {
+	return viper.IsSet(r.key(key))
+}
+
+func (r viperConfig) GetString(key string) string {
+	return viper.GetString(r.key(key))
+}
+
+func (r viperConfig) GetBool(key string) bool {
+	return viper.GetBool(r.key(key))
+}
+
+func (r viperConfig) GetInt(key string) int {
+	return viper.GetInt(r.key(key))
+}
+
+func (r viperConfig) GetInt64(key string) int64 {
+	return viper.GetInt64(r.key(key))
+}
+
+func (r viperConfig) Defaults() Config {
+	return viperConfig("default")
+}
@@ -0,0 +1,711 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ddos
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "DDoS"
+
+var (
+	logger = logging.MustGetLogger("ddos")
+)
+
+const (
+	// EventAttackDetected is published with Attack when a new attack is detected.
+	EventAttackDetected event.Type = "AttackDetected"
+
+	// We use MSB of the cookie to mark the flows that should survive
+	// RemoveAllFlows(), and the lower 32 bits are the ID of the mitigation.
+	cookiePrefix = 0x1<<63 | 0xDD05<<32
+	cookieMask   = 0xFFFFFFFF << 32
+	// Priority of the mitigation flows. It should be higher than the one of
+	// the ARP sender flows not to receive the ARP floods, and lower than the
+	// one of the blocks of the broadcast storms.
+	mitigationPriority = 150
+	// Maximum number of the mitigation flows not to fill up the flow tables.
+	maxMitigations = 1000
+
+	detectInterval = 1 * time.Second
+	statsInterval  = 10 * time.Second
+	statsTimeout   = 5 * time.Second
+
+	defaultIdleTimeout = 1 * time.Minute
+	defaultDuration    = 10 * time.Minute
+	// UDP source ports of chargen, DNS, NTP, SNMP, CLDAP, SSDP and memcached.
+	defaultReflectors = "19,53,123,161,389,1900,11211"
+)
+
+var defaultThresholds = map[Kind]float64{
+	SYNFlood:      1000,
+	ARPFlood:      100,
+	Amplification: 1000,
+}
+
+var errUnknownMitigation = errors.New("unknown mitigation")
+
+// Attack is the traffic toward a victim that has exceeded the threshold of its
+// kind.
+type Attack struct {
+	Kind   Kind     `json:"kind"`
+	Victim string   `json:"victim"` // IPv4 address, or the ingress port of ARPFlood.
+	Rate   uint64   `json:"rate"`   // Packets per second.
+	Ports  []string `json:"ports"`  // Ingress ports mitigated.
+}
+
+func (r Attack) String() string {
+	return fmt.Sprintf("Kind=%v, Victim=%v, Rate=%v/s, Ports=%v", r.Kind, r.Victim, r.Rate, r.Ports)
+}
+
+// Mitigation is a flow that drops or rate-limits the packets of an attack at
+// an ingress port.
+type Mitigation struct {
+	ID         uint32    `json:"id"`
+	Kind       Kind      `json:"kind"`
+	DPID       uint64    `json:"dpid"`
+	Port       uint32    `json:"port"`
+	Victim     string    `json:"victim,omitempty"`   // IPv4 address of SYNFlood and Amplification.
+	SrcPort    uint16    `json:"src_port,omitempty"` // UDP source port of Amplification.
+	Action     string    `json:"action"`             // drop or limit.
+	Rate       uint64    `json:"rate"`               // Packets per second of the attack when detected.
+	Packets    uint64    `json:"packets"`            // Matched by the flow at the last flow stats polling.
+	Bytes      uint64    `json:"bytes"`
+	Created    time.Time `json:"created"`
+	Expiration time.Time `json:"expiration"` // At the latest, as it also expires when the attack stops.
+
+	key    string
+	device *network.Device
+	flow   openflow.FlowMod
+}
+
+// DDoS detects the volumetric attacks from the PACKET_INs and the packets
+// sampled by the controller, and then installs the flows that drop or
+// rate-limit the attacks at their ingress ports, which expire when the attacks
+// stop. Only the ports of the hosts are mitigated, as the ports of the links
+// among the switches carry the legitimate traffic as well.
+type DDoS struct {
+	app.BaseProcessor
+	conf        app.Config
+	detector    *detector
+	limit       bool
+	queue       uint32
+	idleTimeout time.Duration
+	duration    time.Duration
+	finder      network.Finder
+	events      app.EventBus
+	mitigated   *metrics.CounterVec
+	// Stops detecting the attacks.
+	cancel context.CancelFunc
+	// Cancels the subscription of the sampled packets.
+	unsubscribe func()
+	mutex       sync.Mutex
+	// Whether the application has been disabled at runtime. The sampled packets
+	// are still delivered, so they should be ignored.
+	paused      bool
+	lastID      uint32
+	mitigations map[uint32]*Mitigation // Key = Mitigation ID.
+	keys        map[string]uint32      // Key = Mitigation key.
+}
+
+func New(conf app.Config) *DDoS {
+	return &DDoS{
+		conf:        conf,
+		mitigations: make(map[uint32]*Mitigation),
+		keys:        make(map[string]uint32),
+	}
+}
+
+func (r *DDoS) Init(ctx context.Context, s app.Services) error {
+	thresholds := make(map[Kind]float64)
+	for kind, def := range defaultThresholds {
+		key := string(kind) + "_threshold"
+		thresholds[kind] = def
+		if r.conf.IsSet(key) {
+			thresholds[kind] = float64(r.conf.GetInt(key))
+		}
+		if thresholds[kind] < 0 {
+			return fmt.Errorf("invalid ddos.%v in the config file", key)
+		}
+	}
+
+	reflectors := make(map[uint16]bool)
+	ports := defaultReflectors
+	if r.conf.IsSet("reflector_ports") {
+		ports = r.conf.GetString("reflector_ports")
+	}
+	for _, v := range strings.Split(ports, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || port == 0 {
+			return errors.New("invalid ddos.reflector_ports in the config file")
+		}
+		reflectors[uint16(port)] = true
+	}
+	r.detector = newDetector(thresholds, reflectors)
+
+	switch action := strings.ToLower(r.conf.GetString("action")); action {
+	case "", "drop":
+	case "limit":
+		queue := r.conf.GetInt("queue")
+		if queue < 0 {
+			return errors.New("invalid ddos.queue in the config file")
+		}
+		r.limit = true
+		r.queue = uint32(queue)
+	default:
+		return errors.New("invalid ddos.action in the config file")
+	}
+
+	r.idleTimeout = defaultIdleTimeout
+	if r.conf.IsSet("idle_timeout") {
+		r.idleTimeout = time.Duration(r.conf.GetInt("idle_timeout")) * time.Second
+	}
+	r.duration = defaultDuration
+	if r.conf.IsSet("duration") {
+		r.duration = time.Duration(r.conf.GetInt("duration")) * time.Second
+	}
+	// The timeouts of a flow are 16-bit seconds.
+	if r.idleTimeout < time.Second || r.idleTimeout > 0xFFFF*time.Second {
+		return errors.New("invalid ddos.idle_timeout in the config file")
+	}
+	if r.duration < r.idleTimeout || r.duration > 0xFFFF*time.Second {
+		return errors.New("invalid ddos.duration in the config file")
+	}
+
+	r.mitigated = s.Metrics.NewCounterVec("ddos_mitigations_total", "Number of the mitigation flows installed for each kind of the attacks.", "kind")
+	// Finder is nil if the configuration is only checked.
+	if s.Finder == nil {
+		return nil
+	}
+	r.finder = s.Finder
+	r.events = s.Events
+	r.unsubscribe = s.Events.Subscribe(r.onPacketSampled, network.EventPacketSampled)
+	ctx, r.cancel = context.WithCancel(ctx)
+	go r.run(ctx)
+
+	return nil
+}
+
+// Stop stops detecting the attacks. The mitigation flows expire by themselves.
+func (r *DDoS) Stop() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+func (r *DDoS) Name() string {
+	return appName
+}
+
+func (r *DDoS) String() string {
+	action := "drop"
+	if r.limit {
+		action = fmt.Sprintf("limit (queue=%v)", r.queue)
+	}
+	return fmt.Sprintf("%v: Thresholds=%v, Action=%v, IdleTimeout=%v, Duration=%v", r.Name(), r.detector.thresholds, action, r.idleTimeout, r.duration)
+}
+
+func (r *DDoS) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	if !finder.IsEdge(ingress) {
+		r.detector.observe(ingress, eth, 1)
+	}
+
+	return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+}
+
+// onPacketSampled counts a sample as the packets of its sampling rate. The
+// samples are also counted by OnPacketIn, which is negligible.
+func (r *DDoS) onPacketSampled(e event.Event) {
+	v, ok := e.Data.(network.PacketSample)
+	if !ok || r.isPaused() {
+		return
+	}
+	device := r.finder.Device(strconv.FormatUint(v.DPID, 10))
+	if device == nil {
+		return
+	}
+	ingress := device.Port(v.Port)
+	if ingress == nil {
+		return
+	}
+	eth := new(protocol.Ethernet)
+	if err := eth.UnmarshalBinary(v.Frame); err != nil {
+		return
+	}
+	r.detector.observe(ingress, eth, float64(v.Rate))
+}
+
+func (r *DDoS) run(ctx context.Context) {
+	detect := time.NewTicker(detectInterval)
+	defer detect.Stop()
+	stats := time.NewTicker(statsInterval)
+	defer stats.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-detect.C:
+			attacks := r.detector.detect(now)
+			if r.isPaused() {
+				continue
+			}
+			for _, v := range attacks {
+				r.mitigate(v)
+			}
+		case <-stats.C:
+			r.updateStats()
+		}
+	}
+}
+
+// mitigate installs the mitigation flows of the ingress ports of a that have
+// not been mitigated yet, and then raises an alarm if any has been installed.
+func (r *DDoS) mitigate(a attack) {
+	v := Attack{Kind: a.kind, Victim: a.victim, Rate: uint64(a.rate)}
+	if a.kind == ARPFlood {
+		v.Victim = a.port.ID()
+	}
+	for _, s := range a.sources {
+		m, err := r.addMitigation(a, s)
+		if err != nil {
+			logger.Errorf("failed to mitigate the attack (%v) at %v: %v", v, s.port.ID(), err)
+			continue
+		}
+		if m == nil {
+			// Already mitigated.
+			continue
+		}
+		v.Ports = append(v.Ports, s.port.ID())
+	}
+	if len(v.Ports) == 0 {
+		return
+	}
+
+	logger.Warningf("DDoS attack detected: %v", v)
+	r.events.Publish(event.AlarmRaised, event.Alarm{
+		Subject: fmt.Sprintf("Cherry: %v attack detected!", a.kind),
+		Body:    fmt.Sprintf("Victim: %v\r\nRate: %v packets/s\r\nIngress ports: %v\r\nMitigated for %v at the most", v.Victim, v.Rate, strings.Join(v.Ports, ", "), r.duration),
+	})
+	r.events.Publish(EventAttackDetected, v)
+}
+
+// addMitigation installs the mitigation flow of a at s. It returns nil if s
+// has already been mitigated.
+func (r *DDoS) addMitigation(a attack, s source) (*Mitigation, error) {
+	device := s.port.Device()
+	dpid, err := strconv.ParseUint(device.ID(), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mitigation{
+		Kind:    a.kind,
+		DPID:    dpid,
+		Port:    s.port.Number(),
+		SrcPort: s.srcPort,
+		Rate:    uint64(a.rate),
+		device:  device,
+	}
+	m.Victim = a.victim
+	m.key = fmt.Sprintf("%v/%v/%v/%v/%v", m.DPID, m.Port, m.Kind, m.Victim, m.SrcPort)
+
+	r.mutex.Lock()
+	if _, ok := r.keys[m.key]; ok {
+		r.mutex.Unlock()
+		return nil, nil
+	}
+	if len(r.mitigations) >= maxMitigations {
+		r.mutex.Unlock()
+		return nil, errors.New("too many mitigations")
+	}
+	r.lastID++
+	m.ID = r.lastID
+	r.mitigations[m.ID] = m
+	r.keys[m.key] = m.ID
+	r.mutex.Unlock()
+
+	// The ARP floods are always dropped as they are broadcast.
+	var egress *network.Port
+	action := "drop"
+	if r.limit && a.kind != ARPFlood {
+		if egress, err = r.nextHop(s.port, a.dstMAC); err != nil {
+			logger.Infof("dropping the attack instead of limiting it at %v: %v", s.port.ID(), err)
+		} else {
+			action = "limit"
+		}
+	}
+	flow, err := r.newFlow(m, egress)
+	if err == nil {
+		err = device.SendFlow(appName, flow)
+	}
+	if err != nil {
+		r.remove(m.ID)
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	m.Action = action
+	m.Created = time.Now()
+	m.Expiration = m.Created.Add(r.duration)
+	m.flow = flow
+	r.mutex.Unlock()
+	r.mitigated.WithLabelValues(string(m.Kind)).Inc()
+
+	return m, nil
+}
+
+// nextHop returns the port of the device of ingress toward the host of mac.
+func (r *DDoS) nextHop(ingress *network.Port, mac net.HardwareAddr) (*network.Port, error) {
+	node, status, err := r.finder.Node(mac)
+	if err != nil {
+		return nil, err
+	}
+	if status != network.LocationDiscovered || node == nil {
+		return nil, fmt.Errorf("unknown location of the victim (MAC=%v)", mac)
+	}
+
+	device := ingress.Device()
+	if node.Port().Device().ID() == device.ID() {
+		return node.Port(), nil
+	}
+	path := r.finder.Path(device.ID(), node.Port().Device().ID())
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no path toward the victim (MAC=%v)", mac)
+	}
+
+	return path[0][0], nil
+}
+
+// newFlow returns the mitigation flow of m, which forwards the packets to
+// egress through the rate-limiting queue, or drops them if egress is nil.
+func (r *DDoS) newFlow(m *Mitigation, egress *network.Port) (openflow.FlowMod, error) {
+	f := m.device.Factory()
+	if f == nil {
+		return nil, network.ErrClosedDevice
+	}
+	match, err := f.NewMatch()
+	if err != nil {
+		return nil, err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(m.Port)
+	match.SetInPort(inPort)
+	switch m.Kind {
+	case ARPFlood:
+		match.SetEtherType(0x0806)
+	case SYNFlood:
+		// Not all the switches can match the TCP flags, so all the TCP packets
+		// toward the victim are matched.
+		match.SetEtherType(0x0800)
+		match.SetIPProtocol(6)
+		match.SetDstIP(&net.IPNet{IP: net.ParseIP(m.Victim).To4(), Mask: net.CIDRMask(32, 32)})
+	case Amplification:
+		match.SetEtherType(0x0800)
+		match.SetIPProtocol(17)
+		match.SetSrcPort(m.SrcPort)
+		match.SetDstIP(&net.IPNet{IP: net.ParseIP(m.Victim).To4(), Mask: net.CIDRMask(32, 32)})
+	}
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return nil, err
+	}
+	flow.SetCookie(cookiePrefix | uint64(m.ID))
+	flow.SetTableID(m.device.FlowTableID())
+	flow.SetIdleTimeout(uint16(r.idleTimeout / time.Second))
+	flow.SetHardTimeout(uint16(r.duration / time.Second))
+	flow.SetPriority(mitigationPriority)
+	flow.SetFlowMatch(match)
+	if egress == nil {
+		// No instruction means drop.
+		return flow, nil
+	}
+
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(egress.Number())
+	action, err := f.NewAction()
+	if err != nil {
+		return nil, err
+	}
+	action.SetQueue(r.queue)
+	action.SetOutPort(outPort)
+	inst, err := f.NewInstruction()
+	if err != nil {
+		return nil, err
+	}
+	inst.ApplyAction(action)
+	flow.SetFlowInstruction(inst)
+
+	return flow, nil
+}
+
+func (r *DDoS) isPaused() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.paused
+}
+
+// Pause removes all the mitigation flows from the devices, and then stops
+// detecting the attacks from the sampled packets while the application is
+// disabled.
+func (r *DDoS) Pause() error {
+	r.mutex.Lock()
+	r.paused = true
+	r.mitigations = make(map[uint32]*Mitigation)
+	r.keys = make(map[string]uint32)
+	r.mutex.Unlock()
+
+	if r.finder == nil {
+		return nil
+	}
+	for _, device := range r.finder.Devices() {
+		if device.IsClosed() {
+			continue
+		}
+		f := device.Factory()
+		match, err := f.NewMatch()
+		if err != nil {
+			logger.Errorf("failed to create a match: %v", err)
+			continue
+		}
+		flow, err := f.NewFlowMod(openflow.FlowDelete)
+		if err != nil {
+			logger.Errorf("failed to create a flow mod: %v", err)
+			continue
+		}
+		flow.SetCookie(cookiePrefix)
+		flow.SetCookieMask(cookieMask)
+		flow.SetTableID(0xFF) // ALL
+		flow.SetFlowMatch(match)
+		if err := device.SendFlow(appName, flow); err != nil {
+			logger.Errorf("failed to remove the mitigation flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+// Resume starts detecting the attacks again.
+func (r *DDoS) Resume() error {
+	r.mutex.Lock()
+	r.paused = false
+	r.mutex.Unlock()
+
+	return nil
+}
+
+func (r *DDoS) remove(id uint32) *Mitigation {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m, ok := r.mitigations[id]
+	if !ok {
+		return nil
+	}
+	delete(r.mitigations, id)
+	delete(r.keys, m.key)
+
+	return m
+}
+
+func (r *DDoS) OnFlowRemoved(finder network.Finder, flow openflow.FlowRemoved) error {
+	if flow.Cookie()&cookieMask == cookiePrefix {
+		if m := r.remove(uint32(flow.Cookie())); m != nil {
+			logger.Infof("mitigation expired: ID=%v, kind=%v, port=%v:%v, victim=%v, packets=%v", m.ID, m.Kind, m.DPID, m.Port, m.Victim, flow.PacketCount())
+		}
+	}
+
+	return r.BaseProcessor.OnFlowRemoved(finder, flow)
+}
+
+func (r *DDoS) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	// The mitigation flows have gone with the device.
+	r.mutex.Lock()
+	for id, m := range r.mitigations {
+		if m.device == device {
+			delete(r.mitigations, id)
+			delete(r.keys, m.key)
+		}
+	}
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
+
+// updateStats updates the counters of the mitigations by the flow stats of
+// their devices.
+func (r *DDoS) updateStats() {
+	r.mutex.Lock()
+	devices := make(map[*network.Device]bool)
+	for _, m := range r.mitigations {
+		devices[m.device] = true
+	}
+	r.mutex.Unlock()
+
+	for device := range devices {
+		f := device.Factory()
+		if f == nil {
+			continue
+		}
+		match, err := f.NewMatch()
+		if err != nil {
+			continue
+		}
+		stats, err := device.FlowStats(match, statsTimeout)
+		if err != nil {
+			logger.Errorf("failed to query the flow stats of %v: %v", device.ID(), err)
+			continue
+		}
+
+		r.mutex.Lock()
+		for _, v := range stats {
+			if v.Cookie&cookieMask != cookiePrefix {
+				continue
+			}
+			if m, ok := r.mitigations[uint32(v.Cookie)]; ok && m.device == device {
+				m.Packets, m.Bytes = v.PacketCount, v.ByteCount
+			}
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// Mitigations returns the current mitigations ordered by their IDs.
+func (r *DDoS) Mitigations() []Mitigation {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v := make([]Mitigation, 0, len(r.mitigations))
+	for _, m := range r.mitigations {
+		// Being installed.
+		if m.flow == nil {
+			continue
+		}
+		v = append(v, *m)
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].ID < v[j].ID })
+
+	return v
+}
+
+func (r *DDoS) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/api/v1/ddos", r.listMitigation),
+		rest.Delete("/api/v1/ddos/:id", r.removeMitigation),
+		rest.Options("/api/v1/ddos/:id", r.allowOrigin),
+	}
+}
+
+func (r *DDoS) listMitigation(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.WriteJson(&struct {
+		Mitigations []Mitigation `json:"mitigations"`
+	}{r.Mitigations()})
+}
+
+func (r *DDoS) removeMitigation(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.ParseUint(req.PathParam("id"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	r.mutex.Lock()
+	m, ok := r.mitigations[uint32(id)]
+	if !ok || m.flow == nil {
+		r.mutex.Unlock()
+		writeError(w, http.StatusNotFound, errUnknownMitigation)
+		return
+	}
+	device, flow := m.device, m.flow
+	r.mutex.Unlock()
+
+	if err := removeFlow(device, flow); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	r.remove(uint32(id))
+	logger.Infof("removed the mitigation: ID=%v, kind=%v, port=%v:%v, victim=%v", m.ID, m.Kind, m.DPID, m.Port, m.Victim)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// removeFlow removes the mitigation flow installed by flow.
+func removeFlow(device *network.Device, flow openflow.FlowMod) error {
+	f := device.Factory()
+	if f == nil {
+		return network.ErrClosedDevice
+	}
+	v, err := f.NewFlowMod(openflow.FlowDeleteStrict)
+	if err != nil {
+		return err
+	}
+	v.SetTableID(flow.TableID())
+	v.SetPriority(flow.Priority())
+	v.SetFlowMatch(flow.FlowMatch())
+	outPort := openflow.NewOutPort()
+	outPort.SetNone()
+	v.SetOutPort(outPort)
+
+	return device.SendFlow(appName, v)
+}
+
+func (r *DDoS) allowOrigin(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE")
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,196 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ddos
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/protocol"
+)
+
+// Kind is a kind of the attacks.
+type Kind string
+
+const (
+	// SYNFlood is the TCP SYN packets toward a host.
+	SYNFlood Kind = "syn_flood"
+	// ARPFlood is the ARP packets from a port.
+	ARPFlood Kind = "arp_flood"
+	// Amplification is the UDP packets toward a host from the ports of the
+	// services that amplify the requests, e.g., DNS and NTP.
+	Amplification Kind = "amplification"
+)
+
+const (
+	tcpFlagSYN = 0x02
+	tcpFlagACK = 0x10
+)
+
+// The ingress ports sending less than this fraction of the threshold to the
+// victim of an attack are not mitigated, which are probably its clients.
+const minSourceShare = 0.01
+
+// target is what an attack is aimed at: the IPv4 address of the victim for
+// SYNFlood and Amplification, or the ingress port for ARPFlood.
+type target struct {
+	kind   Kind
+	victim string
+	port   *network.Port
+}
+
+// source is where the packets of an attack enter the network. srcPort is the
+// UDP source port of Amplification.
+type source struct {
+	port    *network.Port
+	srcPort uint16
+}
+
+type traffic struct {
+	packets float64
+	sources map[source]float64
+	// Destination MAC address of the last packet, which is the next hop
+	// toward the victim.
+	dstMAC net.HardwareAddr
+}
+
+// attack is the traffic of a target that has exceeded its threshold.
+type attack struct {
+	target
+	rate    float64 // Packets per second.
+	sources []source
+	dstMAC  net.HardwareAddr
+}
+
+// detector estimates the packet rates of the targets from the PACKET_INs and
+// the packet samples during each interval of detect.
+type detector struct {
+	thresholds map[Kind]float64 // Packets per second. Zero disables the detection.
+	reflectors map[uint16]bool  // UDP source ports of Amplification.
+	mutex      sync.Mutex
+	started    time.Time
+	targets    map[target]*traffic
+}
+
+func newDetector(thresholds map[Kind]float64, reflectors map[uint16]bool) *detector {
+	return &detector{
+		thresholds: thresholds,
+		reflectors: reflectors,
+		started:    time.Now(),
+		targets:    make(map[target]*traffic),
+	}
+}
+
+// classify returns the target and the UDP source port of an attack that eth
+// may belong to. ok will be false if eth is not a packet of any attack.
+func (r *detector) classify(ingress *network.Port, eth *protocol.Ethernet) (t target, srcPort uint16, ok bool) {
+	switch eth.Type {
+	case 0x0806: // ARP
+		return target{kind: ARPFlood, port: ingress}, 0, r.thresholds[ARPFlood] > 0
+	case 0x0800: // IPv4
+	default:
+		return target{}, 0, false
+	}
+
+	ip := new(protocol.IPv4)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+		return target{}, 0, false
+	}
+	switch ip.Protocol {
+	case 6: // TCP
+		tcp := new(protocol.TCP)
+		if err := tcp.UnmarshalBinary(ip.Payload); err != nil {
+			return target{}, 0, false
+		}
+		if tcp.Flags&(tcpFlagSYN|tcpFlagACK) != tcpFlagSYN {
+			return target{}, 0, false
+		}
+		return target{kind: SYNFlood, victim: ip.DstIP.String()}, 0, r.thresholds[SYNFlood] > 0
+	case 17: // UDP
+		udp := new(protocol.UDP)
+		if err := udp.UnmarshalBinary(ip.Payload); err != nil {
+			return target{}, 0, false
+		}
+		if !r.reflectors[udp.SrcPort] {
+			return target{}, 0, false
+		}
+		return target{kind: Amplification, victim: ip.DstIP.String()}, udp.SrcPort, r.thresholds[Amplification] > 0
+	default:
+		return target{}, 0, false
+	}
+}
+
+// observe counts eth received from ingress as weight packets, which is the
+// sampling rate of a sample.
+func (r *detector) observe(ingress *network.Port, eth *protocol.Ethernet, weight float64) {
+	t, srcPort, ok := r.classify(ingress, eth)
+	if !ok {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.targets[t]
+	if !ok {
+		v = &traffic{sources: make(map[source]float64)}
+		r.targets[t] = v
+	}
+	v.packets += weight
+	v.sources[source{port: ingress, srcPort: srcPort}] += weight
+	v.dstMAC = eth.DstMAC
+}
+
+// detect returns the attacks whose rates since the last call have exceeded
+// their thresholds, and then starts a new interval.
+func (r *detector) detect(now time.Time) []attack {
+	r.mutex.Lock()
+	targets, started := r.targets, r.started
+	r.targets = make(map[target]*traffic)
+	r.started = now
+	r.mutex.Unlock()
+
+	elapsed := now.Sub(started).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	attacks := []attack{}
+	for t, v := range targets {
+		threshold := r.thresholds[t.kind]
+		rate := v.packets / elapsed
+		if rate < threshold {
+			continue
+		}
+		a := attack{target: t, rate: rate, dstMAC: v.dstMAC}
+		for s, n := range v.sources {
+			if n/elapsed >= threshold*minSourceShare {
+				a.sources = append(a.sources, s)
+			}
+		}
+		attacks = append(attacks, a)
+	}
+
+	return attacks
+}
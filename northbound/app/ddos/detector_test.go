@@ -0,0 +1,112 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ddos
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/protocol"
+)
+
+var (
+	attackerMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	victimMAC   = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02}
+	victimIP    = net.IPv4(10, 0, 0, 2).To4()
+)
+
+func newTestPacket(t *testing.T, proto uint8, srcPort uint16, flags uint16) *protocol.Ethernet {
+	srcIP := net.IPv4(10, 0, 0, 1).To4()
+
+	var payload []byte
+	var err error
+	switch proto {
+	case 6:
+		tcp := protocol.TCP{SrcPort: srcPort, DstPort: 80, Flags: flags, WindowSize: 1024}
+		tcp.SetPseudoHeader(srcIP, victimIP)
+		payload, err = tcp.MarshalBinary()
+	case 17:
+		udp := protocol.UDP{SrcPort: srcPort, DstPort: 40000, Payload: make([]byte, 100)}
+		udp.SetPseudoHeader(srcIP, victimIP)
+		payload, err = udp.MarshalBinary()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := protocol.NewIPv4(srcIP, victimIP, proto, payload).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &protocol.Ethernet{SrcMAC: attackerMAC, DstMAC: victimMAC, Type: 0x0800, Payload: ip}
+}
+
+func TestDetector(t *testing.T) {
+	thresholds := map[Kind]float64{SYNFlood: 200, ARPFlood: 10, Amplification: 0}
+	d := newDetector(thresholds, map[uint16]bool{53: true})
+	attacker, client := network.NewPort(nil, 1), network.NewPort(nil, 2)
+
+	syn := newTestPacket(t, 6, 1234, tcpFlagSYN)
+	synAck := newTestPacket(t, 6, 1234, tcpFlagSYN|tcpFlagACK)
+	dns := newTestPacket(t, 17, 53, 0)
+	arp := &protocol.Ethernet{SrcMAC: attackerMAC, DstMAC: victimMAC, Type: 0x0806}
+
+	start := time.Now()
+	d.started = start
+	// The samples are counted as the packets of their sampling rate.
+	for i := 0; i < 20; i++ {
+		d.observe(attacker, syn, 10)
+		d.observe(attacker, synAck, 10)
+		d.observe(attacker, dns, 10)
+	}
+	d.observe(client, syn, 1)
+	for i := 0; i < 5; i++ {
+		d.observe(attacker, arp, 1)
+	}
+
+	attacks := d.detect(start.Add(time.Second))
+	if len(attacks) != 1 {
+		t.Fatalf("unexpected attacks: %+v", attacks)
+	}
+	a := attacks[0]
+	if a.kind != SYNFlood || a.victim != victimIP.String() || a.rate != 201 {
+		t.Fatalf("unexpected attack: %+v", a)
+	}
+	// The client is below the minimum share of the threshold.
+	if len(a.sources) != 1 || a.sources[0].port != attacker {
+		t.Fatalf("unexpected sources: %+v", a.sources)
+	}
+	if a.dstMAC.String() != victimMAC.String() {
+		t.Fatalf("unexpected destination MAC address: %v", a.dstMAC)
+	}
+
+	// A new interval has been started.
+	for i := 0; i < 20; i++ {
+		d.observe(attacker, arp, 1)
+	}
+	attacks = d.detect(start.Add(2 * time.Second))
+	if len(attacks) != 1 || attacks[0].kind != ARPFlood || attacks[0].port != attacker {
+		t.Fatalf("unexpected attacks: %+v", attacks)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package discovery
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// probeBackoff delays the probes for the hosts that do not answer them. The
+// probes are delayed on each device independently as a host only answers the
+// probes sent by the device that it is connected to.
+type probeBackoff struct {
+	// Delay after the first unanswered probe. It is doubled on every unanswered probe up to max.
+	base time.Duration
+	max  time.Duration
+
+	mutex  sync.Mutex
+	states map[string]map[string]*probeState // Key = IP address and device ID.
+}
+
+type probeState struct {
+	unanswered uint
+	next       time.Time
+}
+
+func newProbeBackoff(base, max time.Duration) *probeBackoff {
+	return &probeBackoff{
+		base:   base,
+		max:    max,
+		states: make(map[string]map[string]*probeState),
+	}
+}
+
+// filter returns the hosts that can be probed on the device now, and then
+// forgets the hosts on the device that are not in hosts anymore.
+func (r *probeBackoff) filter(deviceID string, hosts []net.IP) []net.IP {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	result := make([]net.IP, 0, len(hosts))
+	current := make(map[string]bool, len(hosts))
+	for _, ip := range hosts {
+		current[ip.String()] = true
+		s, ok := r.states[ip.String()][deviceID]
+		if ok && now.Before(s.next) {
+			continue
+		}
+		result = append(result, ip)
+	}
+
+	for ip, devices := range r.states {
+		if current[ip] {
+			continue
+		}
+		delete(devices, deviceID)
+		if len(devices) == 0 {
+			delete(r.states, ip)
+		}
+	}
+
+	return result
+}
+
+// probed records that a probe for ip has been sent on the device. It is
+// regarded as unanswered until reset is called for ip.
+func (r *probeBackoff) probed(deviceID string, ip net.IP) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	devices, ok := r.states[ip.String()]
+	if !ok {
+		devices = make(map[string]*probeState)
+		r.states[ip.String()] = devices
+	}
+	s, ok := devices[deviceID]
+	if !ok {
+		s = &probeState{}
+		devices[deviceID] = s
+	}
+
+	delay := r.max
+	// Avoid the overflow of the shift operation.
+	if s.unanswered < 32 {
+		if v := r.base << s.unanswered; v > 0 && v < r.max {
+			delay = v
+		}
+	}
+	s.unanswered++
+	s.next = time.Now().Add(delay)
+}
+
+// reset resumes probing ip at full rate on all the devices.
+func (r *probeBackoff) reset(ip net.IP) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.states, ip.String())
+}
@@ -28,39 +28,189 @@ import (
 	"math/rand"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/metrics"
 	"github.com/superkkt/cherry/network"
 	"github.com/superkkt/cherry/northbound/app"
 	"github.com/superkkt/cherry/protocol"
 
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
 	"github.com/superkkt/go-logging"
 )
 
+const appName = "Discovery"
+
 var (
 	logger = logging.MustGetLogger("discovery")
 
-	// A locally administered MAC address (https://en.wikipedia.org/wiki/MAC_address#Universal_vs._local).
-	myMAC = net.HardwareAddr([]byte{0x06, 0xff, 0x29, 0x34, 0x82, 0x87})
+	// Default source MAC address of the probes. It is a locally administered
+	// MAC address (https://en.wikipedia.org/wiki/MAC_address#Universal_vs._local).
+	defaultProbeMAC = net.HardwareAddr([]byte{0x06, 0xff, 0x29, 0x34, 0x82, 0x87})
+
+	probesSent        = metrics.NewCounter("discovery_probes_sent_total", "Number of the ARP and NS probes sent.")
+	repliesMatched    = metrics.NewCounter("discovery_replies_matched_total", "Number of the replies received for the probes.")
+	locationUpdates   = metrics.NewCounter("discovery_location_updates_total", "Number of the host location changes.")
+	databaseErrors    = metrics.NewCounter("discovery_database_errors_total", "Number of the failed database queries.")
+	undiscoveredHosts = metrics.NewGauge("discovery_undiscovered_hosts", "Number of the hosts whose location is undiscovered or staled.")
+	timeToDiscover    = metrics.NewHistogram("discovery_time_to_discover_seconds",
+		"Elapsed time from the first probe for a host to the discovery of its location.",
+		[]float64{1, 5, 10, 30, 60, 300, 900, 3600},
+	)
 )
 
 const (
+	// ProbeInterval is the default expiration of the discovered host locations.
+	// The hosts whose location is older than it are probed again.
 	ProbeInterval = 5 * time.Minute
+
+	// EventHostDiscovered is published with HostMove, whose From is nil, when
+	// the location of a host, which was unknown, has been discovered.
+	EventHostDiscovered event.Type = "HostDiscovered"
+	// EventHostMoved is published with HostMove when a host's location has been changed.
+	EventHostMoved event.Type = "HostMoved"
+	// EventHostLost is published with HostLoss when a host's location has been
+	// reset because its port or device has been down.
+	EventHostLost event.Type = "HostLost"
+
+	// Maximum number of the host movements kept in the history.
+	maxMoveHistory = 256
+
+	// Default interval and its random jitter between the ARP probe rounds.
+	defaultProbeInterval = 5000 * time.Millisecond
+	defaultProbeJitter   = 10000 * time.Millisecond
+
+	// Default maximum number of the probe packets sent per second on a device.
+	defaultProbeRate = 1000
+
+	// Default maximum delay of the probes for a host that does not answer them.
+	defaultMaxProbeBackoff = 5 * time.Minute
+
+	// Minimum interval between the passive learnings of a same host.
+	passiveLearningInterval = 10 * time.Second
+	// Number of the passively learned hosts that triggers removing the expired ones.
+	maxPassiveLearned = 4096
 )
 
+type Location struct {
+	DPID uint64 `json:"dpid"`
+	Port uint32 `json:"port"`
+}
+
+func (r Location) equal(port *network.Port) bool {
+	return strconv.FormatUint(r.DPID, 10) == port.Device().ID() && r.Port == port.Number()
+}
+
+type HostMove struct {
+	MAC net.HardwareAddr `json:"mac"`
+	IP  net.IP           `json:"ip"`
+	// From is nil if the previous location is unknown.
+	From      *Location `json:"from"`
+	To        Location  `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (r HostMove) String() string {
+	return fmt.Sprintf("HostMove MAC=%v, IP=%v, From=%+v, To=%+v, Timestamp=%v", r.MAC, r.IP, r.From, r.To, r.Timestamp)
+}
+
+// Host is a registered host whose location has been known.
+type Host struct {
+	MAC      net.HardwareAddr
+	IP       net.IP
+	Location Location
+}
+
+// LocationUpdate is a location of the host whose MAC and IP addresses are MAC
+// and IP. IP can be either an IPv4 or an IPv6 address.
+type LocationUpdate struct {
+	MAC  net.HardwareAddr
+	IP   net.IP
+	DPID uint64
+	Port uint16
+}
+
+type HostLoss struct {
+	MAC       net.HardwareAddr `json:"mac"`
+	IP        net.IP           `json:"ip"`
+	From      Location         `json:"from"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+func (r HostLoss) String() string {
+	return fmt.Sprintf("HostLoss MAC=%v, IP=%v, From=%+v, Timestamp=%v", r.MAC, r.IP, r.From, r.Timestamp)
+}
+
+// Subscribe registers l to receive the host events, which are
+// EventHostDiscovered, EventHostMoved and EventHostLost, so that the other
+// applications can react to them immediately. It returns a function that
+// cancels the subscription.
+func Subscribe(l event.Listener) (unsubscribe func()) {
+	return event.Subscribe(l, EventHostDiscovered, EventHostMoved, EventHostLost)
+}
+
 type processor struct {
 	app.BaseProcessor
-	db Database
+	conf app.Config
+	db   Database
+
+	// Current *settings, which is replaced when the config file is reloaded.
+	config atomic.Value
+	// Limits the number of the devices sending the probes at the same time. Nil means unlimited.
+	senders chan struct{}
+	// Nil if the backoff is disabled.
+	backoff *probeBackoff
+	// Nil if the flap dampening is disabled.
+	flap *flapDetector
+	// Source MAC address of the probes.
+	probeMAC net.HardwareAddr
+	// Source IP addresses of the probes for the hosts in the networks.
+	probeSources []probeSource
 
+	// Parent of the contexts of the ARP senders, which is cancelled on shutdown.
+	ctx       context.Context
 	mutex     sync.Mutex
 	canceller map[string]context.CancelFunc // Key = Device ID.
+	moves     []HostMove                    // Recent host movements in chronological order.
+	learned   map[string]time.Time          // Key = MAC and IP addresses of a passively learned host.
+	probing   map[string]time.Time          // Key = IP address of an undiscovered host. Value = time of the first probe.
+	conflicts map[string]time.Time          // Key = IP and MAC addresses of a duplicate IP. Value = time of the last alarm.
+	// Key = DPID of the device whose host locations are being reset by ports.
+	// Value = ports waiting for the running reset.
+	portResets map[uint64][]uint16
+}
+
+// settings are the parameters that can be changed by reloading the config file.
+type settings struct {
+	// Base interval and its random jitter between the ARP probe rounds.
+	probeInterval time.Duration
+	probeJitter   time.Duration
+	// Maximum number of the hosts probed in a round. Zero means unlimited.
+	probeBatch int
+	// The discovered host locations older than it are probed again.
+	staleExpiration time.Duration
+	// Minimum interval between the probes for the hosts whose location is
+	// unknown. Zero means they are probed in every round.
+	undiscoveredInterval time.Duration
+	// Maximum number of the probe packets sent per second on a device. Zero means unlimited.
+	probeRate int
+	// Learn the host locations from the packets that are not replies for our probes?
+	passive bool
+	// Networks and IP addresses that are never probed.
+	excluded []*net.IPNet
+	// Hard timeout of the flows that block the hosts using duplicate IP addresses. Zero disables the blocking.
+	duplicateBlock time.Duration
 }
 
 type Database interface {
 	// GetUndiscoveredHosts returns IP addresses whose physical location is still
-	// undiscovered or staled more than expiration.
-	GetUndiscoveredHosts(expiration time.Duration) ([]net.IP, error)
+	// undiscovered, and the ones whose location has been staled more than expiration.
+	GetUndiscoveredHosts(expiration time.Duration) (undiscovered, staled []net.IP, err error)
 
 	// UpdateHostLocation updates the physical location of a host, whose MAC and IP
 	// addresses are matched with mac and ip, to the port identified by swDPID and
@@ -68,23 +218,349 @@ type Database interface {
 	UpdateHostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error)
 
 	// ResetHostLocationsByPort sets NULL to the host locations that belong to the
-	// port specified by swDPID and portNum.
-	ResetHostLocationsByPort(swDPID uint64, portNum uint16) error
+	// port specified by swDPID and portNum, and then returns the reset hosts.
+	ResetHostLocationsByPort(swDPID uint64, portNum uint16) ([]Host, error)
 
 	// ResetHostLocationsByDevice sets NULL to the host locations that belong to the
-	// device specified by swDPID.
-	ResetHostLocationsByDevice(swDPID uint64) error
+	// device specified by swDPID, and then returns the reset hosts.
+	ResetHostLocationsByDevice(swDPID uint64) ([]Host, error)
+
+	// ResetHostLocationsByPorts sets NULL to the host locations that belong to
+	// the ports specified by swDPID and portNums in a single transaction, and
+	// then returns the reset hosts. Unknown ports are ignored.
+	ResetHostLocationsByPorts(swDPID uint64, portNums []uint16) ([]Host, error)
+
+	// UpdateHostLocations updates the host locations in a single transaction as
+	// UpdateHostLocation and UpdateIPv6HostLocation do. updated[i] will be true
+	// if the location of updates[i] has been actually updated.
+	UpdateHostLocations(updates []LocationUpdate) (updated []bool, err error)
+
+	// GetUndiscoveredIPv6Hosts returns IPv6 addresses of the hosts whose physical
+	// location is still undiscovered, and the ones whose location has been staled
+	// more than expiration.
+	GetUndiscoveredIPv6Hosts(expiration time.Duration) (undiscovered, staled []net.IP, err error)
+
+	// UpdateIPv6HostLocation updates the physical location of a host, whose MAC
+	// and IPv6 addresses are matched with mac and ip, to the port identified by
+	// swDPID and portNum. updated will be true if its location has been actually updated.
+	UpdateIPv6HostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error)
+
+	// MAC returns the MAC address of the host whose IPv4 address is ip. ok will
+	// be false if there is no such host.
+	MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error)
 }
 
-func New(db Database) app.Processor {
+func New(db Database, conf app.Config) app.Processor {
 	return &processor{
-		db:        db,
-		canceller: make(map[string]context.CancelFunc),
+		db:         db,
+		ctx:        context.Background(),
+		canceller:  make(map[string]context.CancelFunc),
+		learned:    make(map[string]time.Time),
+		probing:    make(map[string]time.Time),
+		conflicts:  make(map[string]time.Time),
+		portResets: make(map[uint64][]uint16),
+		conf:       conf,
+	}
+}
+
+func (r *processor) Init(ctx context.Context, s app.Services) error {
+	config, err := loadSettings(r.conf)
+	if err != nil {
+		return err
+	}
+	r.config.Store(config)
+	r.ctx = ctx
+
+	concurrency := r.conf.GetInt("max_concurrent_senders")
+	if concurrency < 0 {
+		return errors.New("invalid discovery.max_concurrent_senders in the config file")
+	}
+	if concurrency > 0 {
+		r.senders = make(chan struct{}, concurrency)
+	}
+
+	// Zero disables the backoff, so the default is only used when it is not specified.
+	maxBackoff := defaultMaxProbeBackoff
+	if r.conf.IsSet("max_probe_backoff") {
+		v := r.conf.GetInt("max_probe_backoff")
+		if v < 0 {
+			return errors.New("invalid discovery.max_probe_backoff in the config file")
+		}
+		maxBackoff = time.Duration(v) * time.Second
+	}
+	if maxBackoff > 0 {
+		r.backoff = newProbeBackoff(config.probeInterval, maxBackoff)
+	}
+
+	if err := r.initFlapDetector(); err != nil {
+		return err
+	}
+
+	r.probeMAC = defaultProbeMAC
+	if v := r.conf.GetString("probe_mac"); len(v) > 0 {
+		mac, err := net.ParseMAC(v)
+		if err != nil || len(mac) != 6 || mac[0]&0x01 != 0 {
+			return errors.New("invalid discovery.probe_mac in the config file")
+		}
+		r.probeMAC = mac
+	}
+
+	sources, err := parseProbeSources(r.conf.GetString("probe_sources"))
+	if err != nil {
+		return errors.Wrap(err, "invalid discovery.probe_sources in the config file")
+	}
+	r.probeSources = sources
+
+	return nil
+}
+
+// Reload applies the changes of the probe intervals, the batch size, the rate,
+// the stale expiration, the passive learning, the exclusion and the duplicate
+// IP blocking in the config file. The other parameters require a restart.
+func (r *processor) Reload() error {
+	config, err := loadSettings(r.conf)
+	if err != nil {
+		return err
+	}
+	r.config.Store(config)
+	logger.Infof("reloaded the configuration: %+v", *config)
+
+	return nil
+}
+
+func (r *processor) settings() *settings {
+	return r.config.Load().(*settings)
+}
+
+func loadSettings(conf app.Config) (*settings, error) {
+	r := new(settings)
+
+	probeInterval := conf.GetInt("probe_interval")
+	if probeInterval < 0 {
+		return nil, errors.New("invalid discovery.probe_interval in the config file")
+	}
+	r.probeInterval = time.Duration(probeInterval) * time.Millisecond
+	if probeInterval == 0 {
+		r.probeInterval = defaultProbeInterval
+	}
+
+	// Zero jitter is valid, so the default is only used when it is not specified.
+	r.probeJitter = defaultProbeJitter
+	if conf.IsSet("probe_jitter") {
+		jitter := conf.GetInt("probe_jitter")
+		if jitter < 0 {
+			return nil, errors.New("invalid discovery.probe_jitter in the config file")
+		}
+		r.probeJitter = time.Duration(jitter) * time.Millisecond
+	}
+
+	batch := conf.GetInt("probe_batch")
+	if batch < 0 {
+		return nil, errors.New("invalid discovery.probe_batch in the config file")
+	}
+	r.probeBatch = batch
+
+	expiration := conf.GetInt("stale_expiration")
+	if expiration < 0 {
+		return nil, errors.New("invalid discovery.stale_expiration in the config file")
+	}
+	r.staleExpiration = time.Duration(expiration) * time.Second
+	if expiration == 0 {
+		r.staleExpiration = ProbeInterval
+	}
+	interval := conf.GetInt("undiscovered_interval")
+	if interval < 0 {
+		return nil, errors.New("invalid discovery.undiscovered_interval in the config file")
+	}
+	r.undiscoveredInterval = time.Duration(interval) * time.Second
+
+	// Zero rate is valid, so the default is only used when it is not specified.
+	r.probeRate = defaultProbeRate
+	if conf.IsSet("probe_rate") {
+		rate := conf.GetInt("probe_rate")
+		if rate < 0 {
+			return nil, errors.New("invalid discovery.probe_rate in the config file")
+		}
+		r.probeRate = rate
+	}
+
+	r.passive = true
+	if conf.IsSet("passive_learning") {
+		r.passive = conf.GetBool("passive_learning")
+	}
+
+	excluded, err := parseExclusion(conf.GetString("exclude"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid discovery.exclude in the config file")
+	}
+	r.excluded = excluded
+
+	block := conf.GetInt("duplicate_ip_block")
+	if block < 0 || block > 0xFFFF {
+		return nil, errors.New("invalid discovery.duplicate_ip_block in the config file")
+	}
+	r.duplicateBlock = time.Duration(block) * time.Second
+
+	return r, nil
+}
+
+// initFlapDetector creates the flap detector of the links unless the dampening is disabled by the config file.
+func (r *processor) initFlapDetector() error {
+	// Zero disables the dampening, so the default is only used when it is not specified.
+	threshold := 5
+	if r.conf.IsSet("flap_threshold") {
+		threshold = r.conf.GetInt("flap_threshold")
+		if threshold < 0 {
+			return errors.New("invalid discovery.flap_threshold in the config file")
+		}
+	}
+	if threshold == 0 {
+		return nil
+	}
+
+	window := 60
+	if r.conf.IsSet("flap_window") {
+		window = r.conf.GetInt("flap_window")
+		if window <= 0 {
+			return errors.New("invalid discovery.flap_window in the config file")
+		}
+	}
+	dampening := 300
+	if r.conf.IsSet("flap_dampening") {
+		dampening = r.conf.GetInt("flap_dampening")
+		if dampening <= 0 {
+			return errors.New("invalid discovery.flap_dampening in the config file")
+		}
+	}
+	r.flap = newFlapDetector(threshold, time.Duration(window)*time.Second, time.Duration(dampening)*time.Second)
+
+	return nil
+}
+
+// parseExclusion parses s, which is a comma separated list of the networks and the IP addresses.
+func parseExclusion(s string) ([]*net.IPNet, error) {
+	result := []*net.IPNet{}
+	for _, token := range strings.Split(s, ",") {
+		token = strings.TrimSpace(token)
+		if len(token) == 0 {
+			continue
+		}
+		if strings.Contains(token, "/") {
+			_, n, err := net.ParseCIDR(token)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, n)
+			continue
+		}
+		ip := net.ParseIP(token)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %v", token)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return result, nil
+}
+
+type probeSource struct {
+	network *net.IPNet
+	ip      net.IP
+}
+
+// parseProbeSources parses s, which is a semicolon separated list of the
+// networks and their probe source IP addresses, e.g., "10.0.1.0/24,10.0.1.250".
+func parseProbeSources(s string) ([]probeSource, error) {
+	result := []probeSource{}
+	for _, token := range strings.Split(s, ";") {
+		token = strings.TrimSpace(token)
+		if len(token) == 0 {
+			continue
+		}
+		fields := strings.Split(token, ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid probe source: %v", token)
+		}
+		_, n, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(strings.TrimSpace(fields[1]))
+		if ip == nil || (ip.To4() == nil) != (n.IP.To4() == nil) {
+			return nil, fmt.Errorf("invalid source IP address: %v", fields[1])
+		}
+		if ip.To4() != nil {
+			ip = ip.To4()
+		}
+		result = append(result, probeSource{network: n, ip: ip})
+	}
+
+	return result, nil
+}
+
+// probeSource returns the source IP address of the probe for ip. It returns nil if there is no specified one.
+func (r *processor) probeSource(ip net.IP) net.IP {
+	for _, v := range r.probeSources {
+		if v.network.Contains(ip) {
+			return v.ip
+		}
 	}
+
+	return nil
+}
+
+// sendProbe sends an ARP probe, or an NS probe if ip is an IPv6 address, for ip to the egress ports of the device.
+func (r *processor) sendProbe(device *network.Device, egress []*network.Port, ip net.IP) error {
+	if ip.To4() == nil {
+		return device.SendNSProbe(r.probeMAC, r.probeSource(ip), ip, egress)
+	}
+
+	return device.SendARPProbe(r.probeMAC, r.probeSource(ip), ip, egress)
+}
+
+// hostPorts returns the active ports of the device that are not connected to
+// the other switches. The probes are only sent to them as flooding the probes
+// into the fabric wastes bandwidth and produces duplicate replies.
+func hostPorts(finder network.Finder, device *network.Device) []*network.Port {
+	result := []*network.Port{}
+	for _, port := range device.Ports() {
+		if finder.IsEdge(port) {
+			continue
+		}
+		if v := port.Value(); v == nil || v.IsPortDown() || v.IsLinkDown() {
+			continue
+		}
+		result = append(result, port)
+	}
+
+	return result
+}
+
+func (r *processor) isExcluded(ip net.IP) bool {
+	for _, v := range r.settings().excluded {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (r *processor) Name() string {
-	return "Discovery"
+	return appName
+}
+
+// Interests returns the packets used to discover the hosts: ARP, DHCP requests and IPv6.
+func (r *processor) Interests() []app.Interest {
+	return []app.Interest{
+		{EtherType: 0x0806},
+		{EtherType: 0x0800, IPProtocol: 17, Port: 67},
+		{EtherType: 0x86DD},
+	}
 }
 
 func (r *processor) String() string {
@@ -93,18 +569,19 @@ func (r *processor) String() string {
 
 func (r *processor) OnDeviceUp(finder network.Finder, device *network.Device) error {
 	r.stopARPSender(device.ID())
-	r.runARPSender(device)
+	r.runARPSender(finder, device)
 
 	// Propagate this event to the next processors.
 	return r.BaseProcessor.OnDeviceUp(finder, device)
 }
 
-func (r *processor) runARPSender(device *network.Device) {
+func (r *processor) runARPSender(finder network.Finder, device *network.Device) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(r.ctx)
 	go func() {
+		state := &senderState{}
 		// Infinite loop.
 		for {
 			select {
@@ -114,36 +591,137 @@ func (r *processor) runARPSender(device *network.Device) {
 			default:
 			}
 
-			if err := r.sendARPProbes(device); err != nil {
+			// Wait until the other devices finish their rounds if too many devices are sending the probes.
+			if r.senders != nil {
+				r.senders <- struct{}{}
+			}
+			err := r.sendARPProbes(finder, device, state)
+			if r.senders != nil {
+				<-r.senders
+			}
+			if err != nil {
 				logger.Errorf("failed to send ARP probes: %v", err)
 				// Ignore this error and keep go on.
 			}
-			// 5 <= interval <= 15 (seccond)
-			time.Sleep(time.Duration((5000 + rand.Intn(10000))) * time.Millisecond)
+			time.Sleep(r.nextProbeInterval())
 		}
 	}()
 	r.canceller[device.ID()] = cancel
 }
 
-func (r *processor) sendARPProbes(device *network.Device) error {
+// nextProbeInterval returns the probe interval with a random jitter so that the
+// probe rounds of the devices are not synchronized.
+func (r *processor) nextProbeInterval() time.Duration {
+	config := r.settings()
+	if config.probeJitter <= 0 {
+		return config.probeInterval
+	}
+
+	return config.probeInterval + time.Duration(rand.Int63n(int64(config.probeJitter)))
+}
+
+// senderState is the state of the probe sender of a device kept across the rounds.
+type senderState struct {
+	// Position of the next batch in the hosts to be probed.
+	offset int
+	// Last time when the hosts whose location is unknown have been probed.
+	lastUndiscovered time.Time
+}
+
+// sendARPProbes sends the ARP probes for at most probeBatch undiscovered or
+// staled hosts starting from the offset of state.
+func (r *processor) sendARPProbes(finder network.Finder, device *network.Device, state *senderState) error {
 	if device.IsClosed() {
 		return fmt.Errorf("already closed deivce: id=%v", device.ID())
 	}
+	ports := hostPorts(finder, device)
+	if len(ports) == 0 {
+		// No host is connected to this device.
+		return nil
+	}
 
-	hosts, err := r.db.GetUndiscoveredHosts(ProbeInterval)
+	config := r.settings()
+	undiscovered, staled, err := r.db.GetUndiscoveredHosts(config.staleExpiration)
 	if err != nil {
+		databaseErrors.Inc()
 		return err
 	}
+	undiscoveredIPv6, staledIPv6, err := r.db.GetUndiscoveredIPv6Hosts(config.staleExpiration)
+	if err != nil {
+		databaseErrors.Inc()
+		return err
+	}
+	undiscovered = append(undiscovered, undiscoveredIPv6...)
+	staled = append(staled, staledIPv6...)
+	undiscoveredHosts.Set(float64(len(undiscovered) + len(staled)))
+
+	hosts := staled
+	if time.Since(state.lastUndiscovered) >= config.undiscoveredInterval {
+		hosts = append(hosts, undiscovered...)
+		state.lastUndiscovered = time.Now()
+	}
+	r.forgetProbing(append(undiscovered, staled...))
+	if len(config.excluded) > 0 {
+		probed := make([]net.IP, 0, len(hosts))
+		for _, ip := range hosts {
+			if !r.isExcluded(ip) {
+				probed = append(probed, ip)
+			}
+		}
+		hosts = probed
+	}
+	if r.backoff != nil {
+		// Skip the hosts that have not answered the previous probes for a while.
+		hosts = r.backoff.filter(device.ID(), hosts)
+	}
+	if config.probeBatch > 0 && len(hosts) > config.probeBatch {
+		if state.offset >= len(hosts) {
+			state.offset = 0
+		}
+		end := state.offset + config.probeBatch
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		hosts, state.offset = hosts[state.offset:end], end
+	}
+
+	// Interval between the probes for the hosts not to burst the packet-outs.
+	var pace time.Duration
+	if config.probeRate > 0 {
+		pace = time.Second * time.Duration(len(ports)) / time.Duration(config.probeRate)
+	}
+	deadline := time.Now()
 	for _, ip := range hosts {
-		if err := device.SendARPProbe(myMAC, ip); err != nil {
+		if pace > 0 {
+			if d := time.Until(deadline); d > 0 {
+				time.Sleep(d)
+			}
+			deadline = time.Now().Add(pace)
+		}
+		if err := r.sendProbe(device, ports, ip); err != nil {
 			return err
 		}
-		logger.Debugf("sent an ARP probe for %v on %v", ip, device.ID())
+		r.markProbing(ip)
+		logger.Debugf("sent a probe for %v on %v", ip, device.ID())
+		if r.backoff != nil {
+			r.backoff.probed(device.ID(), ip)
+		}
 	}
 
 	return nil
 }
 
+// Stop stops the ARP senders of all the devices.
+func (r *processor) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for id, cancel := range r.canceller {
+		cancel()
+		delete(r.canceller, id)
+	}
+}
+
 func (r *processor) stopARPSender(deviceID string) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -157,6 +735,15 @@ func (r *processor) stopARPSender(deviceID string) {
 }
 
 func (r *processor) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	// IPv6?
+	if eth.Type == 0x86DD {
+		return r.processIPv6(finder, ingress, eth)
+	}
+	// IPv4?
+	if eth.Type == 0x0800 {
+		r.processDHCP(finder, ingress, eth)
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
 	// ARP?
 	if eth.Type != 0x0806 {
 		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
@@ -182,11 +769,13 @@ func (r *processor) OnPacketIn(finder network.Finder, ingress *network.Port, eth
 
 func (r *processor) processARPRequest(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet, arp *protocol.ARP) error {
 	// Our ARP probe?
-	if bytes.Equal(arp.SHA, myMAC) {
+	if bytes.Equal(arp.SHA, r.probeMAC) {
 		// Drop this packet! This packet should not be propagated among switches.
 		logger.Debugf("dropping our ARP probe that was propagated via an edge among switches: deviceID=%v", ingress.Device().ID())
 		return nil
 	} else {
+		// Normal and gratuitous ARP requests tell us where the sender is.
+		r.learnPassively(finder, ingress, arp.SHA, arp.SPA)
 		// Propagate this ARP request, wich is raised from a host, to the next processors.
 		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
 	}
@@ -194,40 +783,364 @@ func (r *processor) processARPRequest(finder network.Finder, ingress *network.Po
 
 func (r *processor) processARPReply(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet, arp *protocol.ARP) error {
 	// The target (not source!) hardware address of the ARP reply packet should be
-	// equal to the myMAC address if it is a counterpart for our ARP probe.
-	if bytes.Equal(arp.THA, myMAC) == false {
+	// equal to the probe MAC address if it is a counterpart for our ARP probe.
+	if bytes.Equal(arp.THA, r.probeMAC) == false {
 		logger.Debugf("unexpected ARP reply: %v", arp)
+		// Gratuitous ARP replies and the replies for the other hosts still tell us where the sender is.
+		r.learnPassively(finder, ingress, arp.SHA, arp.SPA)
 		// Drop this packet. Do not pass it to the next processors.
 		return nil
 	}
 
+	if r.backoff != nil {
+		r.backoff.reset(arp.SPA)
+	}
+	// This ARP reply packet will be processed. Do not pass it to the next processors.
+	repliesMatched.Inc()
+	return r.updateLocation(finder, ingress, arp.SHA, arp.SPA)
+}
+
+// processDHCP learns the location of the DHCP client from its DHCP request message.
+func (r *processor) processDHCP(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) {
+	if !r.settings().passive {
+		return
+	}
+
+	ip := new(protocol.IPv4)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil || ip.Protocol != 17 {
+		return
+	}
+	udp := new(protocol.UDP)
+	if err := udp.UnmarshalBinary(ip.Payload); err != nil || udp.SrcPort != 68 || udp.DstPort != 67 {
+		return
+	}
+	dhcp := new(protocol.DHCP)
+	if err := dhcp.UnmarshalBinary(udp.Payload); err != nil {
+		logger.Debugf("invalid DHCP packet: %v", err)
+		return
+	}
+	if dhcp.MessageType != protocol.DHCPRequest {
+		return
+	}
+
+	// Renewing or rebinding client has its address in ciaddr, otherwise the
+	// client puts the address in the requested IP address option.
+	addr := dhcp.ClientIP
+	if addr.IsUnspecified() {
+		addr = dhcp.RequestedIP
+	}
+	if addr == nil {
+		return
+	}
+	r.learnPassively(finder, ingress, dhcp.ClientMAC, addr)
+}
+
+// learnPassively updates the location of the host, whose MAC and IP addresses
+// are mac and ip, using a packet that is not a reply for our probes.
+func (r *processor) learnPassively(finder network.Finder, ingress *network.Port, mac net.HardwareAddr, ip net.IP) {
+	if !r.settings().passive || ip == nil || ip.IsUnspecified() || ip.IsMulticast() || ip.IsLinkLocalUnicast() {
+		return
+	}
+	// Ports between switches are not the locations of the hosts.
+	if finder.IsEdge(ingress) {
+		return
+	}
+	// The host is alive, so probe it again at full rate when it is staled.
+	if r.backoff != nil {
+		r.backoff.reset(ip)
+	}
+
+	// Do not query the database for every packet from a same host. The ingress
+	// port is a part of the key not to delay detecting the host movements.
+	key := mac.String() + "/" + ip.String() + "/" + ingress.ID()
+	now := time.Now()
+	r.mutex.Lock()
+	last, ok := r.learned[key]
+	if ok && now.Sub(last) < passiveLearningInterval {
+		r.mutex.Unlock()
+		return
+	}
+	if len(r.learned) >= maxPassiveLearned {
+		for k, v := range r.learned {
+			if now.Sub(v) >= passiveLearningInterval {
+				delete(r.learned, k)
+			}
+		}
+	}
+	r.learned[key] = now
+	r.mutex.Unlock()
+
+	// A packet from a port that is different from the recorded location is a
+	// candidate move, which should be confirmed using a probe as the packet can
+	// be forged. The reply for the probe will update the location.
+	if from := previousLocation(finder, mac); from != nil && !from.equal(ingress) {
+		if r.flap != nil && r.flap.dampened(mac) {
+			logger.Debugf("ignoring the candidate move of the flapping host: IP=%v, MAC=%v, to=%v", ip, mac, ingress.ID())
+			return
+		}
+		logger.Infof("candidate host move: IP=%v, MAC=%v, from=%+v, to=%v", ip, mac, *from, ingress.ID())
+		if err := r.confirmMove(ingress, ip); err != nil {
+			logger.Errorf("failed to send the probe to confirm the host move: MAC=%v, IP=%v, err=%v", mac, ip, err)
+		}
+		return
+	}
+
+	if err := r.updateLocation(finder, ingress, mac, ip); err != nil {
+		logger.Errorf("failed to learn the host location passively: MAC=%v, IP=%v, err=%v", mac, ip, err)
+	}
+}
+
+// confirmMove sends a probe for ip to the port that the host has moved to.
+func (r *processor) confirmMove(port *network.Port, ip net.IP) error {
+	if r.backoff != nil {
+		r.backoff.probed(port.Device().ID(), ip)
+	}
+
+	if err := r.sendProbe(port.Device(), []*network.Port{port}, ip); err != nil {
+		return err
+	}
+	r.markProbing(ip)
+
+	return nil
+}
+
+// markProbing remembers the time of the first probe for ip to measure the time to discover it.
+func (r *processor) markProbing(ip net.IP) {
+	probesSent.Inc()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.probing[ip.String()]; !ok {
+		r.probing[ip.String()] = time.Now()
+	}
+}
+
+// forgetProbing forgets the first probe times of the hosts that are not in hosts anymore.
+func (r *processor) forgetProbing(hosts []net.IP) {
+	current := make(map[string]bool, len(hosts))
+	for _, ip := range hosts {
+		current[ip.String()] = true
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for k := range r.probing {
+		if !current[k] {
+			delete(r.probing, k)
+		}
+	}
+}
+
+// discovered observes the time to discover ip if it has been probed.
+func (r *processor) discovered(ip net.IP) {
+	r.mutex.Lock()
+	first, ok := r.probing[ip.String()]
+	delete(r.probing, ip.String())
+	r.mutex.Unlock()
+
+	if ok {
+		timeToDiscover.Observe(time.Since(first).Seconds())
+	}
+}
+
+// updateLocation updates the location of the host, whose MAC and IP addresses
+// are mac and ip, to ingress if the host is registered.
+func (r *processor) updateLocation(finder network.Finder, ingress *network.Port, mac net.HardwareAddr, ip net.IP) error {
 	swDPID, err := strconv.ParseUint(ingress.Device().ID(), 10, 64)
 	if err != nil {
 		return fmt.Errorf("invalid device ID: %v", ingress.Device().ID())
 	}
 
-	// Update the host location in the database if SHA and SPA are matched.
-	updated, err := r.db.UpdateHostLocation(arp.SHA, arp.SPA, swDPID, uint16(ingress.Number()))
+	// Remember the previous location to report the movement.
+	from := previousLocation(finder, mac)
+	to := Location{DPID: swDPID, Port: ingress.Number()}
+	if from != nil && *from != to && r.flap != nil && r.flap.dampened(mac) {
+		logger.Debugf("ignoring the location update of the flapping host: IP=%v, MAC=%v, to=%+v", ip, mac, to)
+		return nil
+	}
+	// Update the host location in the database if the MAC and IP addresses are matched.
+	var updated bool
+	if ip.To4() != nil {
+		updated, err = r.db.UpdateHostLocation(mac, ip, swDPID, uint16(ingress.Number()))
+	} else {
+		updated, err = r.db.UpdateIPv6HostLocation(mac, ip, swDPID, uint16(ingress.Number()))
+	}
 	if err != nil {
+		databaseErrors.Inc()
 		return err
 	}
+	// The MAC and IP addresses may not be matched with the registered ones.
+	if !updated && ip.To4() != nil {
+		duplicate, err := r.checkDuplicateIP(ingress, mac, ip)
+		if err != nil {
+			databaseErrors.Inc()
+			return err
+		}
+		if duplicate {
+			return nil
+		}
+	}
+	r.discovered(ip)
 	// Remove installed flows for this host if the location has been changed.
 	if updated {
-		logger.Infof("host location updated: IP=%v, MAC=%v, deviceID=%v, portNum=%v", arp.SPA, arp.SHA, swDPID, ingress.Number())
-		// Remove flows from all devices.
-		for _, device := range finder.Devices() {
-			if err := device.RemoveFlowByMAC(arp.SHA); err != nil {
-				logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
-				continue
+		r.locationUpdated(finder, mac, ip, from, to)
+		if from != nil && r.flap != nil {
+			if v := r.flap.moved(mac, to); v != nil {
+				flapped(v)
 			}
-			logger.Infof("removed flows whose destination MAC address is %v on %v", arp.SHA, device.ID())
 		}
 	}
 
-	// This ARP reply packet has been processed. Do not pass it to the next processors.
 	return nil
 }
 
+func (r *processor) processIPv6(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	ip := new(protocol.IPv6)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+		return err
+	}
+	// ICMPv6?
+	if ip.NextHeader != 58 || len(ip.Payload) == 0 {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+	if ip.Payload[0] != protocol.ICMPv6NeighborSolicitation && ip.Payload[0] != protocol.ICMPv6NeighborAdvertisement {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	nd := new(protocol.NeighborDiscovery)
+	if err := nd.UnmarshalBinary(ip.Payload); err != nil {
+		return err
+	}
+	logger.Debugf("received neighbor discovery packet: type=%v, target=%v, linkAddr=%v", nd.Type, nd.Target, nd.LinkAddr)
+
+	if nd.Type == protocol.ICMPv6NeighborSolicitation {
+		// Our NS probe?
+		if bytes.Equal(eth.SrcMAC, r.probeMAC) {
+			// Drop this packet! This packet should not be propagated among switches.
+			logger.Debugf("dropping our NS probe that was propagated via an edge among switches: deviceID=%v", ingress.Device().ID())
+			return nil
+		}
+		// The source address of a solicitation from a host tells us where the host is.
+		r.learnPassively(finder, ingress, eth.SrcMAC, ip.SrcIP)
+		// Propagate this solicitation, which is raised from a host, to the next processors.
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	mac := nd.LinkAddr
+	if mac == nil {
+		mac = eth.SrcMAC
+	}
+	// The destination MAC address of the advertisement should be equal to the
+	// probe MAC address if it is a counterpart for our NS probe.
+	if bytes.Equal(eth.DstMAC, r.probeMAC) == false {
+		// Unsolicited advertisements and the ones for the other hosts still tell us where the sender is.
+		r.learnPassively(finder, ingress, mac, nd.Target)
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	if r.backoff != nil {
+		r.backoff.reset(nd.Target)
+	}
+	// This advertisement will be processed. Do not pass it to the next processors.
+	repliesMatched.Inc()
+	return r.updateLocation(finder, ingress, mac, nd.Target)
+}
+
+// locationUpdated records the host movement, and then removes the installed flows for the host.
+func (r *processor) locationUpdated(finder network.Finder, mac net.HardwareAddr, ip net.IP, from *Location, to Location) {
+	logger.Infof("host location updated: IP=%v, MAC=%v, deviceID=%v, portNum=%v", ip, mac, to.DPID, to.Port)
+	locationUpdates.Inc()
+	r.addMove(HostMove{
+		MAC:       mac,
+		IP:        ip,
+		From:      from,
+		To:        to,
+		Timestamp: time.Now(),
+	})
+	// Remove flows from all devices.
+	for _, device := range finder.Devices() {
+		if err := device.RemoveFlowByMAC(mac); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+		logger.Infof("removed flows whose destination MAC address is %v on %v", mac, device.ID())
+	}
+}
+
+func previousLocation(finder network.Finder, mac net.HardwareAddr) *Location {
+	node, status, err := finder.Node(mac)
+	if err != nil || status != network.LocationDiscovered {
+		return nil
+	}
+	dpid, err := strconv.ParseUint(node.Port().Device().ID(), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &Location{DPID: dpid, Port: node.Port().Number()}
+}
+
+// addMove records the host movement in the history, and then publishes it as an event.
+func (r *processor) addMove(move HostMove) {
+	r.mutex.Lock()
+	r.moves = append(r.moves, move)
+	if len(r.moves) > maxMoveHistory {
+		r.moves = r.moves[len(r.moves)-maxMoveHistory:]
+	}
+	r.mutex.Unlock()
+
+	if move.From == nil {
+		event.Publish(EventHostDiscovered, move)
+	} else {
+		event.Publish(EventHostMoved, move)
+	}
+}
+
+func publishLoss(hosts []Host) {
+	now := time.Now()
+	for _, v := range hosts {
+		event.Publish(EventHostLost, HostLoss{MAC: v.MAC, IP: v.IP, From: v.Location, Timestamp: now})
+	}
+}
+
+// Moves returns the recent host movements in chronological order.
+func (r *processor) Moves() []HostMove {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	moves := make([]HostMove, len(r.moves))
+	copy(moves, r.moves)
+
+	return moves
+}
+
+func (r *processor) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/api/v1/discovery/move", r.listMove),
+	}
+}
+
+func (r *processor) listMove(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	moves := r.Moves()
+	// Formatting the MAC address as a string.
+	type move struct {
+		HostMove
+		MAC string `json:"mac"`
+	}
+	result := make([]move, len(moves))
+	for i, v := range moves {
+		result[i] = move{HostMove: v, MAC: v.MAC.String()}
+	}
+
+	w.WriteJson(&struct {
+		Moves []move `json:"moves"`
+	}{result})
+}
+
 func (r *processor) OnPortDown(finder network.Finder, port *network.Port) error {
 	swDPID, err := strconv.ParseUint(port.Device().ID(), 10, 64)
 	if err != nil {
@@ -236,7 +1149,7 @@ func (r *processor) OnPortDown(finder network.Finder, port *network.Port) error
 
 	// Set NULLs to the host locations that associated with this port so that the
 	// packets heading to these hosts will be broadcasted until we discover it again.
-	if err := r.db.ResetHostLocationsByPort(swDPID, uint16(port.Number())); err != nil {
+	if err := r.resetPortLocations(swDPID, uint16(port.Number())); err != nil {
 		return err
 	}
 
@@ -244,10 +1157,52 @@ func (r *processor) OnPortDown(finder network.Finder, port *network.Port) error
 	return r.BaseProcessor.OnPortDown(finder, port)
 }
 
+// resetPortLocations resets the host locations of the port. The ports of the
+// device that go down while a reset is running, such as on a line card failure,
+// are reset together by the running one in a single transaction.
+func (r *processor) resetPortLocations(swDPID uint64, portNum uint16) error {
+	r.mutex.Lock()
+	if waiting, ok := r.portResets[swDPID]; ok {
+		r.portResets[swDPID] = append(waiting, portNum)
+		r.mutex.Unlock()
+		return nil
+	}
+	r.portResets[swDPID] = nil
+	r.mutex.Unlock()
+
+	var err error
+	ports := []uint16{portNum}
+	for len(ports) > 0 {
+		lost, e := r.db.ResetHostLocationsByPorts(swDPID, ports)
+		if e != nil {
+			databaseErrors.Inc()
+			err = e
+		} else {
+			publishLoss(lost)
+		}
+
+		r.mutex.Lock()
+		ports = r.portResets[swDPID]
+		if len(ports) == 0 {
+			delete(r.portResets, swDPID)
+		} else {
+			r.portResets[swDPID] = nil
+		}
+		r.mutex.Unlock()
+	}
+
+	return err
+}
+
 func (r *processor) OnDeviceDown(finder network.Finder, device *network.Device) error {
 	// Stop the ARP request sender.
 	r.stopARPSender(device.ID())
 
+	// The new leader keeps using the host locations.
+	if device.IsHandedOver() {
+		return r.BaseProcessor.OnDeviceDown(finder, device)
+	}
+
 	swDPID, err := strconv.ParseUint(device.ID(), 10, 64)
 	if err != nil {
 		return fmt.Errorf("invalid device ID: %v", device.ID())
@@ -255,9 +1210,12 @@ func (r *processor) OnDeviceDown(finder network.Finder, device *network.Device)
 
 	// Set NULLs to the host locations that belong to this device so that the packets
 	// heading to these hosts will be broadcasted until we discover them again.
-	if err := r.db.ResetHostLocationsByDevice(swDPID); err != nil {
+	lost, err := r.db.ResetHostLocationsByDevice(swDPID)
+	if err != nil {
+		databaseErrors.Inc()
 		return err
 	}
+	publishLoss(lost)
 
 	// Propagate this event to the next processors.
 	return r.BaseProcessor.OnDeviceDown(finder, device)
@@ -0,0 +1,159 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	// EventDuplicateIP is published with DuplicateIP when a host uses the IP
+	// address registered for another host.
+	EventDuplicateIP event.Type = "DuplicateIP"
+
+	// Minimum interval between the alarms for a same duplicate IP address.
+	duplicateAlarmInterval = 10 * time.Minute
+	// Number of the remembered duplicate IP addresses that triggers removing the expired ones.
+	maxConflicts = 1024
+
+	// We use MSB of the cookie to mark the flows that should survive RemoveAllFlows().
+	blockFlowCookie = 0x1<<63 | 0xD1B
+	// Same as the one of the ACL drop flows.
+	blockPriority = 30
+)
+
+type DuplicateIP struct {
+	IP net.IP `json:"ip"`
+	// MAC address registered for IP.
+	MAC net.HardwareAddr `json:"mac"`
+	// MAC address of the host that uses IP.
+	ConflictMAC net.HardwareAddr `json:"conflict_mac"`
+	Location    Location         `json:"location"`
+	Timestamp   time.Time        `json:"timestamp"`
+}
+
+func (r DuplicateIP) String() string {
+	return fmt.Sprintf("DuplicateIP IP=%v, MAC=%v, ConflictMAC=%v, Location=%+v, Timestamp=%v", r.IP, r.MAC, r.ConflictMAC, r.Location, r.Timestamp)
+}
+
+// checkDuplicateIP checks whether ip, which is used by the host whose MAC
+// address is mac, has been registered for another host. If so, it raises an
+// alarm and blocks the host if the blocking is enabled.
+func (r *processor) checkDuplicateIP(ingress *network.Port, mac net.HardwareAddr, ip net.IP) (duplicate bool, err error) {
+	registered, ok, err := r.db.MAC(ip)
+	if err != nil {
+		return false, err
+	}
+	if !ok || bytes.Equal(registered, mac) {
+		return false, nil
+	}
+
+	dpid, err := strconv.ParseUint(ingress.Device().ID(), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid device ID: %v", ingress.Device().ID())
+	}
+	v := DuplicateIP{
+		IP:          ip,
+		MAC:         registered,
+		ConflictMAC: mac,
+		Location:    Location{DPID: dpid, Port: ingress.Number()},
+		Timestamp:   time.Now(),
+	}
+	logger.Warningf("duplicate IP address: %v", v)
+
+	if block := r.settings().duplicateBlock; block > 0 {
+		if err := installBlockFlow(ingress, mac, block); err != nil {
+			logger.Errorf("failed to block the host using the duplicate IP address: %v", err)
+		} else {
+			logger.Infof("blocked %v on %v for %v", mac, ingress.ID(), block)
+		}
+	}
+
+	if r.shouldRaiseConflict(v) {
+		event.Publish(EventDuplicateIP, v)
+		event.RaisePortAlarm(v.Location.DPID, v.Location.Port,
+			fmt.Sprintf("Duplicate IP address %v", ip),
+			fmt.Sprintf("%v is registered for %v, but it is used by %v on the port %v of the switch %v.", ip, registered, mac, v.Location.Port, v.Location.DPID),
+		)
+	}
+
+	return true, nil
+}
+
+// shouldRaiseConflict returns whether the conflict should be reported, so that
+// a same conflict is not reported too frequently.
+func (r *processor) shouldRaiseConflict(v DuplicateIP) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	key := v.IP.String() + "/" + v.ConflictMAC.String()
+	if last, ok := r.conflicts[key]; ok && now.Sub(last) < duplicateAlarmInterval {
+		return false
+	}
+	if len(r.conflicts) >= maxConflicts {
+		for k, t := range r.conflicts {
+			if now.Sub(t) >= duplicateAlarmInterval {
+				delete(r.conflicts, k)
+			}
+		}
+	}
+	r.conflicts[key] = now
+
+	return true
+}
+
+// installBlockFlow drops the packets from mac on the port for timeout.
+func installBlockFlow(port *network.Port, mac net.HardwareAddr, timeout time.Duration) error {
+	device := port.Device()
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(port.Number())
+	match.SetInPort(inPort)
+	match.SetSrcMAC(mac)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(blockFlowCookie)
+	flow.SetTableID(device.FlowTableID())
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(uint16(timeout.Seconds()))
+	flow.SetPriority(blockPriority)
+	flow.SetFlowMatch(match)
+	// No instruction means drop.
+
+	return device.SendFlow(appName, flow)
+}
@@ -0,0 +1,149 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+)
+
+// EventMACFlap is published with MACFlap when the location updates of a host
+// start being dampened.
+const EventMACFlap event.Type = "MACFlap"
+
+type MACFlap struct {
+	MAC net.HardwareAddr `json:"mac"`
+	// Recent locations of the host in chronological order.
+	Locations []Location `json:"locations"`
+	// The location updates are ignored until this time.
+	Until     time.Time `json:"until"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (r MACFlap) String() string {
+	return fmt.Sprintf("MACFlap MAC=%v, Locations=%+v, Until=%v, Timestamp=%v", r.MAC, r.Locations, r.Until, r.Timestamp)
+}
+
+// flapDetector detects the hosts whose locations oscillate, which usually
+// means a loop or a mis-cabled link aggregation, and dampens their location
+// updates as each update removes the flows for the host from all the devices.
+type flapDetector struct {
+	// A host moving threshold times in window is regarded as flapping.
+	threshold int
+	window    time.Duration
+	// Location updates of a flapping host are ignored for this duration.
+	dampening time.Duration
+
+	mutex  sync.Mutex
+	states map[string]*flapState // Key = MAC address.
+}
+
+type flapState struct {
+	moves []flapMove
+	until time.Time
+}
+
+type flapMove struct {
+	to        Location
+	timestamp time.Time
+}
+
+func newFlapDetector(threshold int, window, dampening time.Duration) *flapDetector {
+	return &flapDetector{
+		threshold: threshold,
+		window:    window,
+		dampening: dampening,
+		states:    make(map[string]*flapState),
+	}
+}
+
+// dampened returns whether the location updates of mac should be ignored now.
+func (r *flapDetector) dampened(mac net.HardwareAddr) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, ok := r.states[mac.String()]
+	return ok && time.Now().Before(s.until)
+}
+
+// moved records that mac has moved to the location. It returns a non-nil
+// MACFlap if the host starts flapping by this move.
+func (r *flapDetector) moved(mac net.HardwareAddr, to Location) *MACFlap {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+
+	s, ok := r.states[mac.String()]
+	if !ok {
+		s = &flapState{}
+		r.states[mac.String()] = s
+	}
+	s.moves = append(s.moves, flapMove{to: to, timestamp: now})
+	if len(s.moves) < r.threshold {
+		return nil
+	}
+
+	s.until = now.Add(r.dampening)
+	locations := make([]Location, len(s.moves))
+	for i, v := range s.moves {
+		locations[i] = v.to
+	}
+	// Start counting again after the dampening.
+	s.moves = nil
+
+	return &MACFlap{
+		MAC:       mac,
+		Locations: locations,
+		Until:     s.until,
+		Timestamp: now,
+	}
+}
+
+// expire forgets the moves older than the window. The caller should hold the mutex.
+func (r *flapDetector) expire(now time.Time) {
+	for mac, s := range r.states {
+		i := 0
+		for i < len(s.moves) && now.Sub(s.moves[i].timestamp) >= r.window {
+			i++
+		}
+		s.moves = s.moves[i:]
+		if len(s.moves) == 0 && !now.Before(s.until) {
+			delete(r.states, mac)
+		}
+	}
+}
+
+// flapped reports the flapping host.
+func flapped(v *MACFlap) {
+	logger.Warningf("MAC flapping detected, location updates are dampened: %v", v)
+	event.Publish(EventMACFlap, *v)
+	event.RaiseAlarm(
+		fmt.Sprintf("MAC flapping %v", v.MAC),
+		fmt.Sprintf("%v has moved %v times among %+v. Its location updates are ignored until %v. Check loops or mis-cabled link aggregations.", v.MAC, len(v.Locations), v.Locations, v.Until.Format(time.RFC3339)),
+	)
+}
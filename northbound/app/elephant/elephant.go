@@ -0,0 +1,264 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package elephant
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("elephant")
+)
+
+const (
+	// EventElephantDetected is published with Flow when a new elephant flow is detected.
+	EventElephantDetected event.Type = "ElephantDetected"
+
+	statsTimeout = 5 * time.Second
+)
+
+// Flow is an elephant flow, which is a large long-lived flow.
+type Flow struct {
+	DeviceID    string    `json:"device_id"`
+	TableID     uint8     `json:"table_id"`
+	Priority    uint16    `json:"priority"`
+	Cookie      uint64    `json:"cookie"`
+	Match       string    `json:"match"` // Hex encoded match
+	Duration    uint32    `json:"duration"`
+	ByteCount   uint64    `json:"byte_count"`
+	PacketCount uint64    `json:"packet_count"`
+	Rate        uint64    `json:"rate"` // Bytes per second during the last polling interval
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func (r Flow) String() string {
+	return fmt.Sprintf("DeviceID=%v, TableID=%v, Priority=%v, Cookie=%v, Duration=%vs, Bytes=%v, Rate=%vB/s", r.DeviceID, r.TableID, r.Priority, r.Cookie, r.Duration, r.ByteCount, r.Rate)
+}
+
+type sample struct {
+	byteCount uint64
+	timestamp time.Time
+}
+
+type Elephant struct {
+	app.BaseProcessor
+	conf        app.Config
+	interval    time.Duration
+	threshold   uint64 // Bytes per second
+	minDuration uint32 // Seconds
+	once        sync.Once
+	mutex       sync.Mutex
+	samples     map[string]sample // Key = Flow key.
+	elephants   map[string]Flow   // Key = Flow key.
+}
+
+func New(conf app.Config) *Elephant {
+	return &Elephant{
+		samples:   make(map[string]sample),
+		elephants: make(map[string]Flow),
+		conf:      conf,
+	}
+}
+
+func (r *Elephant) Init(ctx context.Context, s app.Services) error {
+	interval := r.conf.GetInt("interval")
+	if interval <= 0 {
+		return errors.New("invalid elephant.interval in the config file")
+	}
+	r.interval = time.Duration(interval) * time.Second
+
+	threshold := r.conf.GetInt64("threshold")
+	if threshold <= 0 {
+		return errors.New("invalid elephant.threshold in the config file")
+	}
+	r.threshold = uint64(threshold)
+
+	duration := r.conf.GetInt("min_duration")
+	if duration < 0 {
+		return errors.New("invalid elephant.min_duration in the config file")
+	}
+	r.minDuration = uint32(duration)
+
+	return nil
+}
+
+func (r *Elephant) Name() string {
+	return "Elephant"
+}
+
+func (r *Elephant) String() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%v", r.Name()))
+	for _, v := range r.elephants {
+		buf.WriteString(fmt.Sprintf("\n\t%v", v))
+	}
+
+	return buf.String()
+}
+
+func (r *Elephant) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	r.once.Do(func() {
+		// Run the background flow stats poller.
+		go r.poller(finder)
+	})
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *Elephant) poller(finder network.Finder) {
+	logger.Debug("executed flow stats poller")
+
+	ticker := time.Tick(r.interval)
+	// Infinite loop.
+	for range ticker {
+		current := make(map[string]bool)
+		for _, device := range finder.Devices() {
+			if err := r.poll(device, current); err != nil {
+				logger.Errorf("failed to poll flow stats from %v: %v", device.ID(), err)
+				continue
+			}
+		}
+		r.expire(current)
+	}
+}
+
+func (r *Elephant) poll(device *network.Device, current map[string]bool) error {
+	match, err := device.Factory().NewMatch()
+	if err != nil {
+		return err
+	}
+	stats, err := device.FlowStats(match, statsTimeout)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, v := range stats {
+		m, err := v.Match.MarshalBinary()
+		if err != nil {
+			continue
+		}
+		flow := Flow{
+			DeviceID:    device.ID(),
+			TableID:     v.TableID,
+			Priority:    v.Priority,
+			Cookie:      v.Cookie,
+			Match:       hex.EncodeToString(m),
+			Duration:    v.DurationSec,
+			ByteCount:   v.ByteCount,
+			PacketCount: v.PacketCount,
+			Timestamp:   now,
+		}
+		key := fmt.Sprintf("%v/%v/%v/%v/%v", flow.DeviceID, flow.TableID, flow.Priority, flow.Cookie, flow.Match)
+		current[key] = true
+		r.update(key, flow)
+	}
+
+	return nil
+}
+
+func (r *Elephant) update(key string, flow Flow) {
+	r.mutex.Lock()
+	prev, ok := r.samples[key]
+	r.samples[key] = sample{byteCount: flow.ByteCount, timestamp: flow.Timestamp}
+	if !ok || flow.ByteCount < prev.byteCount {
+		// First sample or the flow has been re-installed.
+		r.mutex.Unlock()
+		return
+	}
+	elapsed := flow.Timestamp.Sub(prev.timestamp).Seconds()
+	if elapsed <= 0 {
+		r.mutex.Unlock()
+		return
+	}
+	flow.Rate = uint64(float64(flow.ByteCount-prev.byteCount) / elapsed)
+
+	if flow.Rate < r.threshold || flow.Duration < r.minDuration {
+		delete(r.elephants, key)
+		r.mutex.Unlock()
+		return
+	}
+	_, exist := r.elephants[key]
+	r.elephants[key] = flow
+	r.mutex.Unlock()
+
+	if !exist {
+		logger.Infof("elephant flow detected: %v", flow)
+		event.Publish(EventElephantDetected, flow)
+	}
+}
+
+// expire removes the flows that do not exist anymore.
+func (r *Elephant) expire(current map[string]bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for k := range r.samples {
+		if !current[k] {
+			delete(r.samples, k)
+			delete(r.elephants, k)
+		}
+	}
+}
+
+// Elephants returns the elephant flows detected by the last polling.
+func (r *Elephant) Elephants() []Flow {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	flows := make([]Flow, 0, len(r.elephants))
+	for _, v := range r.elephants {
+		flows = append(flows, v)
+	}
+
+	return flows
+}
+
+func (r *Elephant) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/api/v1/elephant", r.listElephant),
+	}
+}
+
+func (r *Elephant) listElephant(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.WriteJson(&struct {
+		Flows []Flow `json:"flows"`
+	}{r.Elephants()})
+}
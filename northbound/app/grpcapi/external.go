@@ -0,0 +1,335 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package grpcapi
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+)
+
+const (
+	// Flows requested by the external processors are removed with the L2
+	// switching flows when the topology is changed, so the MSB of the cookie
+	// should not be set.
+	externalFlowCookie = 0x1<<62 | 0xE87
+
+	defaultProcessorTimeout = 100 * time.Millisecond
+	// Maximum number of the events queued for an external processor. The
+	// events are dropped if it is exceeded.
+	processorQueueSize = 256
+)
+
+var processorTimeouts = metrics.NewCounter("grpc_processor_timeouts_total", "Number of the PACKET_INs not answered by the external processors in time.")
+
+// externalEvent is an event sent to the external processors. Only one of the
+// pointers is set, and only the PACKET_INs wait for their verdicts.
+type externalEvent struct {
+	id       uint64
+	packetIn *externalPacketIn
+	device   *externalStatus
+	port     *externalStatus
+}
+
+type externalPacketIn struct {
+	dpid   uint64
+	inPort uint32
+	data   []byte
+}
+
+type externalStatus struct {
+	dpid uint64
+	port uint32 // Zero for the device events.
+	up   bool
+}
+
+// externalVerdict is the answer of an external processor to a PACKET_IN.
+type externalVerdict struct {
+	// drop stops the processor chain.
+	drop       bool
+	packetOuts []externalPacketOut
+	flows      []externalFlow
+}
+
+type externalPacketOut struct {
+	dpid uint64
+	port uint32
+	data []byte
+}
+
+// externalFlow is a flow requested by an external processor, whose zero or nil match fields are wildcards.
+type externalFlow struct {
+	dpid        uint64
+	priority    uint16
+	idleTimeout uint16
+	hardTimeout uint16
+	inPort      uint32
+	etherType   uint16
+	srcMAC      net.HardwareAddr
+	dstMAC      net.HardwareAddr
+	srcIP       *net.IPNet
+	dstIP       *net.IPNet
+	ipProtocol  uint8
+	// Zero outPort drops the matched packets.
+	outPort uint32
+}
+
+// external is an external processor attached to the gRPC server.
+type external struct {
+	name   string
+	events chan externalEvent
+
+	mutex sync.Mutex
+	// Verdicts waited by the PACKET_INs. Key = event ID.
+	waiting map[uint64]chan externalVerdict
+}
+
+func newExternal(name string) *external {
+	return &external{
+		name:    name,
+		events:  make(chan externalEvent, processorQueueSize),
+		waiting: make(map[uint64]chan externalVerdict),
+	}
+}
+
+// send queues e without blocking. It returns false if the queue is full.
+func (r *external) send(e externalEvent) bool {
+	select {
+	case r.events <- e:
+		return true
+	default:
+		logger.Errorf("dropping an event to the external processor %v: queue is full", r.name)
+		return false
+	}
+}
+
+// ask sends the PACKET_IN e, and then waits for its verdict up to timeout.
+func (r *external) ask(e externalEvent, timeout time.Duration) (verdict externalVerdict, ok bool) {
+	c := make(chan externalVerdict, 1)
+	r.mutex.Lock()
+	r.waiting[e.id] = c
+	r.mutex.Unlock()
+
+	defer func() {
+		r.mutex.Lock()
+		delete(r.waiting, e.id)
+		r.mutex.Unlock()
+	}()
+
+	if !r.send(e) {
+		return externalVerdict{}, false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case v := <-c:
+		return v, true
+	case <-timer.C:
+		processorTimeouts.Inc()
+		logger.Errorf("external processor %v does not answer the PACKET_IN in %v", r.name, timeout)
+		return externalVerdict{}, false
+	}
+}
+
+// answer delivers the verdict of the PACKET_IN whose event ID is id. It returns
+// false if nobody waits for it, e.g., it is too late.
+func (r *external) answer(id uint64, v externalVerdict) bool {
+	r.mutex.Lock()
+	c, ok := r.waiting[id]
+	r.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	// Buffered by one, and nobody else answers the same ID.
+	c <- v
+
+	return true
+}
+
+func (r *GRPC) attach(e *external) {
+	r.externalMutex.Lock()
+	defer r.externalMutex.Unlock()
+
+	r.externals = append(r.externals, e)
+}
+
+func (r *GRPC) detach(e *external) {
+	r.externalMutex.Lock()
+	defer r.externalMutex.Unlock()
+
+	for i, v := range r.externals {
+		if v == e {
+			r.externals = append(r.externals[:i:i], r.externals[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *GRPC) getExternals() []*external {
+	r.externalMutex.RLock()
+	defer r.externalMutex.RUnlock()
+
+	return r.externals
+}
+
+// notify sends the event without waiting to all the external processors.
+func (r *GRPC) notify(e externalEvent) {
+	for _, v := range r.getExternals() {
+		e.id = atomic.AddUint64(&r.eventID, 1)
+		v.send(e)
+	}
+}
+
+func (r *GRPC) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	externals := r.getExternals()
+	if len(externals) == 0 {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	dpid, err := strconv.ParseUint(ingress.Device().ID(), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid device ID: %v", ingress.Device().ID())
+	}
+	data, err := eth.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	// The external processors are asked in the order of their attachment.
+	for _, v := range externals {
+		e := externalEvent{
+			id:       atomic.AddUint64(&r.eventID, 1),
+			packetIn: &externalPacketIn{dpid: dpid, inPort: ingress.Number(), data: data},
+		}
+		verdict, ok := v.ask(e, r.processorTimeout)
+		if !ok {
+			// Let the next one handle the packet.
+			continue
+		}
+		r.apply(finder, v.name, verdict)
+		if verdict.drop {
+			return nil
+		}
+	}
+
+	return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+}
+
+// apply sends the PACKET_OUTs and installs the flows of the verdict.
+func (r *GRPC) apply(finder network.Finder, name string, verdict externalVerdict) {
+	for _, v := range verdict.flows {
+		device := finder.Device(strconv.FormatUint(v.dpid, 10))
+		if device == nil {
+			logger.Errorf("unknown device in the flow request of %v: %v", name, v.dpid)
+			continue
+		}
+		if err := installExternalFlow(device, v); err != nil {
+			logger.Errorf("failed to install the flow requested by %v on %v: %v", name, v.dpid, err)
+		}
+	}
+	// The flows are sent before the packets that they may match.
+	for _, v := range verdict.packetOuts {
+		device := finder.Device(strconv.FormatUint(v.dpid, 10))
+		if device == nil {
+			logger.Errorf("unknown device in the PACKET_OUT of %v: %v", name, v.dpid)
+			continue
+		}
+		port := device.Port(v.port)
+		if port == nil {
+			logger.Errorf("unknown port in the PACKET_OUT of %v: %v:%v", name, v.dpid, v.port)
+			continue
+		}
+		if err := r.PacketOut(port, v.data); err != nil {
+			logger.Errorf("failed to send the PACKET_OUT of %v to %v: %v", name, port.ID(), err)
+		}
+	}
+}
+
+func installExternalFlow(device *network.Device, v externalFlow) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	if v.inPort != 0 {
+		inPort := openflow.NewInPort()
+		inPort.SetValue(v.inPort)
+		match.SetInPort(inPort)
+	}
+	if v.etherType != 0 {
+		match.SetEtherType(v.etherType)
+	}
+	if v.srcMAC != nil {
+		match.SetSrcMAC(v.srcMAC)
+	}
+	if v.dstMAC != nil {
+		match.SetDstMAC(v.dstMAC)
+	}
+	if v.srcIP != nil {
+		match.SetSrcIP(v.srcIP)
+	}
+	if v.dstIP != nil {
+		match.SetDstIP(v.dstIP)
+	}
+	if v.ipProtocol != 0 {
+		match.SetIPProtocol(v.ipProtocol)
+	}
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(externalFlowCookie)
+	flow.SetTableID(device.FlowTableID())
+	flow.SetIdleTimeout(v.idleTimeout)
+	flow.SetHardTimeout(v.hardTimeout)
+	flow.SetPriority(v.priority)
+	flow.SetFlowMatch(match)
+	// No instruction means drop.
+	if v.outPort != 0 {
+		outPort := openflow.NewOutPort()
+		outPort.SetValue(v.outPort)
+		action, err := f.NewAction()
+		if err != nil {
+			return err
+		}
+		action.SetOutPort(outPort)
+		inst, err := f.NewInstruction()
+		if err != nil {
+			return err
+		}
+		inst.ApplyAction(action)
+		flow.SetFlowInstruction(inst)
+	}
+
+	return device.SendFlow(appName, flow)
+}
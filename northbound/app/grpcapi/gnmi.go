@@ -0,0 +1,264 @@
+//go:build grpc
+// +build grpc
+
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const gnmiVersion = "0.7.0"
+
+// gnmiServer serves the telemetry tree in telemetry.go by the gNMI
+// Capabilities, Get and Subscribe RPCs. Set is not implemented.
+type gnmiServer struct {
+	gnmi.UnimplementedGNMIServer
+	app *GRPC
+}
+
+func (r *gnmiServer) Capabilities(ctx context.Context, req *gnmi.CapabilityRequest) (*gnmi.CapabilityResponse, error) {
+	return &gnmi.CapabilityResponse{
+		SupportedModels:    []*gnmi.ModelData{{Name: "cherry-telemetry", Organization: "Cherry", Version: "1.0.0"}},
+		SupportedEncodings: []gnmi.Encoding{gnmi.Encoding_JSON, gnmi.Encoding_JSON_IETF, gnmi.Encoding_PROTO},
+		GNMIVersion:        gnmiVersion,
+	}, nil
+}
+
+// snapshot returns all the leaves of the telemetry tree, which is empty until a
+// device is connected.
+func (r *gnmiServer) snapshot() []telemetryLeaf {
+	finder := r.app.getFinder()
+	if finder == nil {
+		return nil
+	}
+
+	return telemetrySnapshot(finder)
+}
+
+func (r *gnmiServer) Get(ctx context.Context, req *gnmi.GetRequest) (*gnmi.GetResponse, error) {
+	leaves := r.snapshot()
+	now := time.Now().UnixNano()
+
+	resp := &gnmi.GetResponse{}
+	for _, p := range req.Path {
+		pattern := joinPath(req.Prefix, p)
+		selected := selectLeaves(leaves, pattern)
+		if len(selected) == 0 {
+			return nil, status.Errorf(codes.NotFound, "no data under %v", pathString(pattern))
+		}
+		resp.Notification = append(resp.Notification, newNotification(now, req.Prefix, selected, nil))
+	}
+
+	return resp, nil
+}
+
+func (r *gnmiServer) Subscribe(stream gnmi.GNMI_SubscribeServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	list := req.GetSubscribe()
+	if list == nil || len(list.Subscription) == 0 {
+		return status.Error(codes.InvalidArgument, "the first request should be a subscription list")
+	}
+	subs := make([]*telemetrySubscription, 0, len(list.Subscription))
+	for _, v := range list.Subscription {
+		// Target-defined subscriptions are sampled.
+		onChange := v.Mode == gnmi.SubscriptionMode_ON_CHANGE
+		subs = append(subs, newTelemetrySubscription(joinPath(list.Prefix, v.Path), onChange,
+			time.Duration(v.SampleInterval), v.SuppressRedundant, time.Duration(v.HeartbeatInterval)))
+	}
+
+	switch list.Mode {
+	case gnmi.SubscriptionList_ONCE:
+		return r.sendAll(stream, list.Prefix, subs)
+	case gnmi.SubscriptionList_POLL:
+		for {
+			if err := r.sendAll(stream, list.Prefix, subs); err != nil {
+				return err
+			}
+			req, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if req.GetPoll() == nil {
+				return status.Error(codes.InvalidArgument, "expected a poll request")
+			}
+		}
+	default:
+		return r.stream(stream, list.Prefix, subs, list.UpdatesOnly)
+	}
+}
+
+// sendAll sends all the leaves of subs, and then a sync response.
+func (r *gnmiServer) sendAll(stream gnmi.GNMI_SubscribeServer, prefix *gnmi.Path, subs []*telemetrySubscription) error {
+	leaves := r.snapshot()
+	now := time.Now().UnixNano()
+	for _, v := range subs {
+		selected := selectLeaves(leaves, v.path)
+		if len(selected) == 0 {
+			continue
+		}
+		if err := sendNotification(stream, newNotification(now, prefix, selected, nil)); err != nil {
+			return err
+		}
+	}
+
+	return sendSync(stream)
+}
+
+// stream sends all the leaves of subs and a sync response, or only the sync
+// response if updatesOnly, and then the changed leaves of subs until the
+// client cancels the call.
+func (r *gnmiServer) stream(stream gnmi.GNMI_SubscribeServer, prefix *gnmi.Path, subs []*telemetrySubscription, updatesOnly bool) error {
+	// The client sends nothing after the subscription list, but the stream
+	// is still read to find out an error. The half-close of the client does
+	// not cancel the subscription.
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				if err != io.EOF {
+					failed <- err
+				}
+				return
+			}
+		}
+	}()
+
+	now := time.Now()
+	leaves := r.snapshot()
+	for _, v := range subs {
+		updates, _ := v.changes(leaves, now)
+		if updatesOnly || len(updates) == 0 {
+			continue
+		}
+		if err := sendNotification(stream, newNotification(now.UnixNano(), prefix, updates, nil)); err != nil {
+			return err
+		}
+	}
+	if err := sendSync(stream); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(telemetryTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case err := <-failed:
+			return err
+		case now := <-ticker.C:
+			leaves = nil
+			for _, v := range subs {
+				if !v.due(now) {
+					continue
+				}
+				// Taken once for all the subscriptions due at this tick.
+				if leaves == nil {
+					leaves = r.snapshot()
+				}
+				updates, deletes := v.changes(leaves, now)
+				if len(updates) == 0 && len(deletes) == 0 {
+					continue
+				}
+				if err := sendNotification(stream, newNotification(now.UnixNano(), prefix, updates, deletes)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func sendNotification(stream gnmi.GNMI_SubscribeServer, n *gnmi.Notification) error {
+	return stream.Send(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_Update{Update: n}})
+}
+
+func sendSync(stream gnmi.GNMI_SubscribeServer) error {
+	return stream.Send(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_SyncResponse{SyncResponse: true}})
+}
+
+// joinPath returns the telemetry path of path under prefix.
+func joinPath(prefix, path *gnmi.Path) []pathElem {
+	v := []pathElem{}
+	for _, p := range []*gnmi.Path{prefix, path} {
+		if p == nil {
+			continue
+		}
+		for _, e := range p.Elem {
+			v = append(v, pathElem{name: e.Name, keys: e.Key})
+		}
+	}
+	return v
+}
+
+func toGNMIPath(path []pathElem) *gnmi.Path {
+	v := &gnmi.Path{Elem: make([]*gnmi.PathElem, len(path))}
+	for i, e := range path {
+		v.Elem[i] = &gnmi.PathElem{Name: e.name, Key: e.keys}
+	}
+	return v
+}
+
+// newNotification returns the notification of the leaves, whose paths are
+// absolute. Its prefix only has the target and the origin of prefix.
+func newNotification(timestamp int64, prefix *gnmi.Path, updates []telemetryLeaf, deletes [][]pathElem) *gnmi.Notification {
+	v := &gnmi.Notification{Timestamp: timestamp}
+	if prefix != nil && (prefix.Target != "" || prefix.Origin != "") {
+		v.Prefix = &gnmi.Path{Target: prefix.Target, Origin: prefix.Origin}
+	}
+	for _, leaf := range updates {
+		v.Update = append(v.Update, &gnmi.Update{Path: toGNMIPath(leaf.path), Val: typedValue(leaf.value)})
+	}
+	for _, path := range deletes {
+		v.Delete = append(v.Delete, toGNMIPath(path))
+	}
+
+	return v
+}
+
+func typedValue(v interface{}) *gnmi.TypedValue {
+	switch v := v.(type) {
+	case string:
+		return &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: v}}
+	case uint64:
+		return &gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: v}}
+	case float64:
+		return &gnmi.TypedValue{Value: &gnmi.TypedValue_DoubleVal{DoubleVal: v}}
+	case bool:
+		return &gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: v}}
+	default:
+		panic("unexpected telemetry value")
+	}
+}
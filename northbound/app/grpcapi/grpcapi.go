@@ -0,0 +1,250 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package grpcapi serves the gRPC northbound API defined in pb/cherry.proto,
+// which provides the topology, host and flow operations, the event feed, and
+// the external processors that take part in the processor chain, and the
+// streaming telemetry by gNMI.
+// The server is only linked by the grpc build tag, so that the default build
+// does not depend on gRPC.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "GRPC"
+
+var (
+	logger = logging.MustGetLogger("grpcapi")
+)
+
+const defaultPort = 7071
+
+type database interface {
+	AddHost(network.HostParam) (hostID uint64, err error)
+	Host(hostID uint64) (host network.Host, ok bool, err error)
+	Hosts(limit, offset uint8) ([]network.Host, error)
+	RemoveHost(id uint64) (ok bool, err error)
+}
+
+type GRPC struct {
+	app.BaseProcessor
+	conf     app.Config
+	db       database
+	port     int
+	tls      bool
+	certFile string
+	keyFile  string
+	// processorTimeout is how long a PACKET_IN waits for the verdict of an external processor.
+	processorTimeout time.Duration
+
+	mutex  sync.RWMutex
+	finder network.Finder // Nil until a device is connected.
+
+	externalMutex sync.RWMutex
+	// External processors in the order of their attachment, which is replaced as a whole when changed.
+	externals []*external
+	eventID   uint64
+}
+
+func New(db database, conf app.Config) *GRPC {
+	return &GRPC{
+		db:   db,
+		conf: conf,
+	}
+}
+
+func (r *GRPC) Init(ctx context.Context, s app.Services) error {
+	r.port = defaultPort
+	if r.conf.IsSet("port") {
+		r.port = r.conf.GetInt("port")
+		if r.port <= 0 || r.port > 0xFFFF {
+			return errors.New("invalid grpc.port in the config file")
+		}
+	}
+	r.tls = r.conf.GetBool("tls")
+	if r.tls {
+		r.certFile = r.conf.GetString("cert_file")
+		r.keyFile = r.conf.GetString("key_file")
+		if r.certFile == "" || r.keyFile == "" {
+			return errors.New("invalid grpc.cert_file or grpc.key_file in the config file")
+		}
+	}
+	r.processorTimeout = defaultProcessorTimeout
+	if r.conf.IsSet("processor_timeout") {
+		v := r.conf.GetInt("processor_timeout")
+		if v <= 0 || v > 10000 {
+			return errors.New("invalid grpc.processor_timeout in the config file")
+		}
+		r.processorTimeout = time.Duration(v) * time.Millisecond
+	}
+
+	return r.serve()
+}
+
+func (r *GRPC) Name() string {
+	return appName
+}
+
+func (r *GRPC) String() string {
+	return fmt.Sprintf("%v (port=%v, tls=%v)", r.Name(), r.port, r.tls)
+}
+
+func (r *GRPC) setFinder(finder network.Finder) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.finder = finder
+}
+
+func (r *GRPC) getFinder() network.Finder {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.finder
+}
+
+func (r *GRPC) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	r.setFinder(finder)
+	r.notifyDevice(device, true)
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *GRPC) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	r.notifyDevice(device, false)
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
+
+func (r *GRPC) OnPortUp(finder network.Finder, port *network.Port) error {
+	r.notifyPort(port, true)
+	return r.BaseProcessor.OnPortUp(finder, port)
+}
+
+func (r *GRPC) OnPortDown(finder network.Finder, port *network.Port) error {
+	r.notifyPort(port, false)
+	return r.BaseProcessor.OnPortDown(finder, port)
+}
+
+func (r *GRPC) notifyDevice(device *network.Device, up bool) {
+	dpid, err := strconv.ParseUint(device.ID(), 10, 64)
+	if err != nil {
+		return
+	}
+	r.notify(externalEvent{device: &externalStatus{dpid: dpid, up: up}})
+}
+
+func (r *GRPC) notifyPort(port *network.Port, up bool) {
+	dpid, err := strconv.ParseUint(port.Device().ID(), 10, 64)
+	if err != nil {
+		return
+	}
+	r.notify(externalEvent{port: &externalStatus{dpid: dpid, port: port.Number(), up: up}})
+}
+
+func (r *GRPC) OnTopologyChange(finder network.Finder) error {
+	r.setFinder(finder)
+	return r.BaseProcessor.OnTopologyChange(finder)
+}
+
+// addHost registers a new host, and then announces it to all the devices.
+func (r *GRPC) addHost(param network.HostParam) (uint64, error) {
+	mac, err := net.ParseMAC(param.MAC)
+	if err != nil {
+		return 0, err
+	}
+	param.MAC = mac.String()
+
+	id, err := r.db.AddHost(param)
+	if err != nil {
+		return 0, err
+	}
+	host, ok, err := r.db.Host(id)
+	if err != nil || !ok {
+		// The host has been added anyway.
+		logger.Errorf("failed to query the added host (ID=%v): %v", id, err)
+		return id, nil
+	}
+	ip, _, err := net.ParseCIDR(host.IP)
+	if err != nil {
+		return id, nil
+	}
+	for _, d := range r.devices() {
+		if err := d.SendARPAnnouncement(ip, mac); err != nil {
+			logger.Errorf("failed to send the ARP announcement to %v: %v", d.ID(), err)
+		}
+	}
+
+	return id, nil
+}
+
+// removeHost removes the host, and then removes the flows toward it. It returns false if there is no such host.
+func (r *GRPC) removeHost(id uint64) (bool, error) {
+	host, ok, err := r.db.Host(id)
+	if err != nil || !ok {
+		return false, err
+	}
+	mac, err := net.ParseMAC(host.MAC)
+	if err != nil {
+		return false, err
+	}
+	if _, err := r.db.RemoveHost(id); err != nil {
+		return false, err
+	}
+	for _, d := range r.devices() {
+		if err := d.RemoveFlowByMAC(mac); err != nil {
+			logger.Errorf("failed to remove the flows toward %v on %v: %v", mac, d.ID(), err)
+		}
+	}
+
+	return true, nil
+}
+
+func (r *GRPC) devices() []*network.Device {
+	finder := r.getFinder()
+	if finder == nil {
+		return nil
+	}
+
+	return finder.Devices()
+}
+
+// device returns the connected device whose DPID is dpid, or nil if there is no such device.
+func (r *GRPC) device(dpid uint64) *network.Device {
+	finder := r.getFinder()
+	if finder == nil {
+		return nil
+	}
+
+	// Device ID is its DPID in decimal.
+	return finder.Device(strconv.FormatUint(dpid, 10))
+}
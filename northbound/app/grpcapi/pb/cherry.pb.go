@@ -0,0 +1,2265 @@
+// Cherry - An OpenFlow Controller
+//
+// Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+// Kitae Kim <superkkt@sds.co.kr>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: cherry.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Device struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Dpid          uint64                 `protobuf:"varint,2,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	Manufacturer  string                 `protobuf:"bytes,3,opt,name=manufacturer,proto3" json:"manufacturer,omitempty"`
+	Hardware      string                 `protobuf:"bytes,4,opt,name=hardware,proto3" json:"hardware,omitempty"`
+	Software      string                 `protobuf:"bytes,5,opt,name=software,proto3" json:"software,omitempty"`
+	Serial        string                 `protobuf:"bytes,6,opt,name=serial,proto3" json:"serial,omitempty"`
+	Description   string                 `protobuf:"bytes,7,opt,name=description,proto3" json:"description,omitempty"`
+	NPorts        uint32                 `protobuf:"varint,8,opt,name=n_ports,json=nPorts,proto3" json:"n_ports,omitempty"`
+	NTables       uint32                 `protobuf:"varint,9,opt,name=n_tables,json=nTables,proto3" json:"n_tables,omitempty"`
+	FlowTableId   uint32                 `protobuf:"varint,10,opt,name=flow_table_id,json=flowTableId,proto3" json:"flow_table_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Device) Reset() {
+	*x = Device{}
+	mi := &file_cherry_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Device) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Device) ProtoMessage() {}
+
+func (x *Device) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Device.ProtoReflect.Descriptor instead.
+func (*Device) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Device) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Device) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+func (x *Device) GetManufacturer() string {
+	if x != nil {
+		return x.Manufacturer
+	}
+	return ""
+}
+
+func (x *Device) GetHardware() string {
+	if x != nil {
+		return x.Hardware
+	}
+	return ""
+}
+
+func (x *Device) GetSoftware() string {
+	if x != nil {
+		return x.Software
+	}
+	return ""
+}
+
+func (x *Device) GetSerial() string {
+	if x != nil {
+		return x.Serial
+	}
+	return ""
+}
+
+func (x *Device) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Device) GetNPorts() uint32 {
+	if x != nil {
+		return x.NPorts
+	}
+	return 0
+}
+
+func (x *Device) GetNTables() uint32 {
+	if x != nil {
+		return x.NTables
+	}
+	return 0
+}
+
+func (x *Device) GetFlowTableId() uint32 {
+	if x != nil {
+		return x.FlowTableId
+	}
+	return 0
+}
+
+type Port struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Id      string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Number  uint32                 `protobuf:"varint,2,opt,name=number,proto3" json:"number,omitempty"`
+	Name    string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Mac     string                 `protobuf:"bytes,4,opt,name=mac,proto3" json:"mac,omitempty"`
+	AdminUp bool                   `protobuf:"varint,5,opt,name=admin_up,json=adminUp,proto3" json:"admin_up,omitempty"`
+	LinkUp  bool                   `protobuf:"varint,6,opt,name=link_up,json=linkUp,proto3" json:"link_up,omitempty"`
+	// In MB.
+	Speed uint64 `protobuf:"varint,7,opt,name=speed,proto3" json:"speed,omitempty"`
+	// Connected to another switch?
+	Edge bool `protobuf:"varint,8,opt,name=edge,proto3" json:"edge,omitempty"`
+	// Disabled by the spanning tree?
+	Disabled      bool `protobuf:"varint,9,opt,name=disabled,proto3" json:"disabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Port) Reset() {
+	*x = Port{}
+	mi := &file_cherry_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Port) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Port) ProtoMessage() {}
+
+func (x *Port) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Port.ProtoReflect.Descriptor instead.
+func (*Port) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Port) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Port) GetNumber() uint32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Port) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Port) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *Port) GetAdminUp() bool {
+	if x != nil {
+		return x.AdminUp
+	}
+	return false
+}
+
+func (x *Port) GetLinkUp() bool {
+	if x != nil {
+		return x.LinkUp
+	}
+	return false
+}
+
+func (x *Port) GetSpeed() uint64 {
+	if x != nil {
+		return x.Speed
+	}
+	return 0
+}
+
+func (x *Port) GetEdge() bool {
+	if x != nil {
+		return x.Edge
+	}
+	return false
+}
+
+func (x *Port) GetDisabled() bool {
+	if x != nil {
+		return x.Disabled
+	}
+	return false
+}
+
+type Link struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ports         []string               `protobuf:"bytes,1,rep,name=ports,proto3" json:"ports,omitempty"`
+	Enabled       bool                   `protobuf:"varint,2,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Link) Reset() {
+	*x = Link{}
+	mi := &file_cherry_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Link) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Link) ProtoMessage() {}
+
+func (x *Link) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Link.ProtoReflect.Descriptor instead.
+func (*Link) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Link) GetPorts() []string {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+func (x *Link) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+type Host struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// IP address with its prefix length, e.g., 10.0.0.1/24.
+	Ip  string `protobuf:"bytes,2,opt,name=ip,proto3" json:"ip,omitempty"`
+	Mac string `protobuf:"bytes,3,opt,name=mac,proto3" json:"mac,omitempty"`
+	// Location of the host, which is empty if it is unknown.
+	Port          string `protobuf:"bytes,4,opt,name=port,proto3" json:"port,omitempty"`
+	Description   string `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
+	Stale         bool   `protobuf:"varint,6,opt,name=stale,proto3" json:"stale,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Host) Reset() {
+	*x = Host{}
+	mi := &file_cherry_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Host) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Host) ProtoMessage() {}
+
+func (x *Host) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Host.ProtoReflect.Descriptor instead.
+func (*Host) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Host) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Host) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Host) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *Host) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *Host) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Host) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+type Flow struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	TableId     uint32                 `protobuf:"varint,1,opt,name=table_id,json=tableId,proto3" json:"table_id,omitempty"`
+	Priority    uint32                 `protobuf:"varint,2,opt,name=priority,proto3" json:"priority,omitempty"`
+	Cookie      uint64                 `protobuf:"varint,3,opt,name=cookie,proto3" json:"cookie,omitempty"`
+	IdleTimeout uint32                 `protobuf:"varint,4,opt,name=idle_timeout,json=idleTimeout,proto3" json:"idle_timeout,omitempty"`
+	HardTimeout uint32                 `protobuf:"varint,5,opt,name=hard_timeout,json=hardTimeout,proto3" json:"hard_timeout,omitempty"`
+	// In seconds.
+	Duration    uint32 `protobuf:"varint,6,opt,name=duration,proto3" json:"duration,omitempty"`
+	PacketCount uint64 `protobuf:"varint,7,opt,name=packet_count,json=packetCount,proto3" json:"packet_count,omitempty"`
+	ByteCount   uint64 `protobuf:"varint,8,opt,name=byte_count,json=byteCount,proto3" json:"byte_count,omitempty"`
+	// Wildcard fields are omitted.
+	Match         map[string]string `protobuf:"bytes,9,rep,name=match,proto3" json:"match,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Flow) Reset() {
+	*x = Flow{}
+	mi := &file_cherry_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Flow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Flow) ProtoMessage() {}
+
+func (x *Flow) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Flow.ProtoReflect.Descriptor instead.
+func (*Flow) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Flow) GetTableId() uint32 {
+	if x != nil {
+		return x.TableId
+	}
+	return 0
+}
+
+func (x *Flow) GetPriority() uint32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *Flow) GetCookie() uint64 {
+	if x != nil {
+		return x.Cookie
+	}
+	return 0
+}
+
+func (x *Flow) GetIdleTimeout() uint32 {
+	if x != nil {
+		return x.IdleTimeout
+	}
+	return 0
+}
+
+func (x *Flow) GetHardTimeout() uint32 {
+	if x != nil {
+		return x.HardTimeout
+	}
+	return 0
+}
+
+func (x *Flow) GetDuration() uint32 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+func (x *Flow) GetPacketCount() uint64 {
+	if x != nil {
+		return x.PacketCount
+	}
+	return 0
+}
+
+func (x *Flow) GetByteCount() uint64 {
+	if x != nil {
+		return x.ByteCount
+	}
+	return 0
+}
+
+func (x *Flow) GetMatch() map[string]string {
+	if x != nil {
+		return x.Match
+	}
+	return nil
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Type of the event, e.g., DeviceUp, PortDown or HostMoved.
+	Type      string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// JSON encoded data of the event, whose schema depends on the type.
+	Data          string `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_cherry_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Event) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+type ListDevicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDevicesRequest) Reset() {
+	*x = ListDevicesRequest{}
+	mi := &file_cherry_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDevicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDevicesRequest) ProtoMessage() {}
+
+func (x *ListDevicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDevicesRequest.ProtoReflect.Descriptor instead.
+func (*ListDevicesRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{6}
+}
+
+type ListDevicesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Devices       []*Device              `protobuf:"bytes,1,rep,name=devices,proto3" json:"devices,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDevicesResponse) Reset() {
+	*x = ListDevicesResponse{}
+	mi := &file_cherry_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDevicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDevicesResponse) ProtoMessage() {}
+
+func (x *ListDevicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDevicesResponse.ProtoReflect.Descriptor instead.
+func (*ListDevicesResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListDevicesResponse) GetDevices() []*Device {
+	if x != nil {
+		return x.Devices
+	}
+	return nil
+}
+
+type ListPortsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dpid          uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPortsRequest) Reset() {
+	*x = ListPortsRequest{}
+	mi := &file_cherry_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPortsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPortsRequest) ProtoMessage() {}
+
+func (x *ListPortsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPortsRequest.ProtoReflect.Descriptor instead.
+func (*ListPortsRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListPortsRequest) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+type ListPortsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ports         []*Port                `protobuf:"bytes,1,rep,name=ports,proto3" json:"ports,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPortsResponse) Reset() {
+	*x = ListPortsResponse{}
+	mi := &file_cherry_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPortsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPortsResponse) ProtoMessage() {}
+
+func (x *ListPortsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPortsResponse.ProtoReflect.Descriptor instead.
+func (*ListPortsResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListPortsResponse) GetPorts() []*Port {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+type ListLinksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLinksRequest) Reset() {
+	*x = ListLinksRequest{}
+	mi := &file_cherry_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLinksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLinksRequest) ProtoMessage() {}
+
+func (x *ListLinksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLinksRequest.ProtoReflect.Descriptor instead.
+func (*ListLinksRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{10}
+}
+
+type ListLinksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Links         []*Link                `protobuf:"bytes,1,rep,name=links,proto3" json:"links,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLinksResponse) Reset() {
+	*x = ListLinksResponse{}
+	mi := &file_cherry_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLinksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLinksResponse) ProtoMessage() {}
+
+func (x *ListLinksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLinksResponse.ProtoReflect.Descriptor instead.
+func (*ListLinksResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListLinksResponse) GetLinks() []*Link {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+type ListHostsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListHostsRequest) Reset() {
+	*x = ListHostsRequest{}
+	mi := &file_cherry_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListHostsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListHostsRequest) ProtoMessage() {}
+
+func (x *ListHostsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListHostsRequest.ProtoReflect.Descriptor instead.
+func (*ListHostsRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{12}
+}
+
+type ListHostsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hosts         []*Host                `protobuf:"bytes,1,rep,name=hosts,proto3" json:"hosts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListHostsResponse) Reset() {
+	*x = ListHostsResponse{}
+	mi := &file_cherry_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListHostsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListHostsResponse) ProtoMessage() {}
+
+func (x *ListHostsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListHostsResponse.ProtoReflect.Descriptor instead.
+func (*ListHostsResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListHostsResponse) GetHosts() []*Host {
+	if x != nil {
+		return x.Hosts
+	}
+	return nil
+}
+
+type AddHostRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IpId          uint64                 `protobuf:"varint,1,opt,name=ip_id,json=ipId,proto3" json:"ip_id,omitempty"`
+	Mac           string                 `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddHostRequest) Reset() {
+	*x = AddHostRequest{}
+	mi := &file_cherry_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddHostRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddHostRequest) ProtoMessage() {}
+
+func (x *AddHostRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddHostRequest.ProtoReflect.Descriptor instead.
+func (*AddHostRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *AddHostRequest) GetIpId() uint64 {
+	if x != nil {
+		return x.IpId
+	}
+	return 0
+}
+
+func (x *AddHostRequest) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *AddHostRequest) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+type AddHostResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddHostResponse) Reset() {
+	*x = AddHostResponse{}
+	mi := &file_cherry_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddHostResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddHostResponse) ProtoMessage() {}
+
+func (x *AddHostResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddHostResponse.ProtoReflect.Descriptor instead.
+func (*AddHostResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *AddHostResponse) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type RemoveHostRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveHostRequest) Reset() {
+	*x = RemoveHostRequest{}
+	mi := &file_cherry_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveHostRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveHostRequest) ProtoMessage() {}
+
+func (x *RemoveHostRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveHostRequest.ProtoReflect.Descriptor instead.
+func (*RemoveHostRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *RemoveHostRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type RemoveHostResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveHostResponse) Reset() {
+	*x = RemoveHostResponse{}
+	mi := &file_cherry_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveHostResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveHostResponse) ProtoMessage() {}
+
+func (x *RemoveHostResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveHostResponse.ProtoReflect.Descriptor instead.
+func (*RemoveHostResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{17}
+}
+
+type ListFlowsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dpid          uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFlowsRequest) Reset() {
+	*x = ListFlowsRequest{}
+	mi := &file_cherry_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFlowsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFlowsRequest) ProtoMessage() {}
+
+func (x *ListFlowsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFlowsRequest.ProtoReflect.Descriptor instead.
+func (*ListFlowsRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ListFlowsRequest) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+type ListFlowsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Flows         []*Flow                `protobuf:"bytes,1,rep,name=flows,proto3" json:"flows,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFlowsResponse) Reset() {
+	*x = ListFlowsResponse{}
+	mi := &file_cherry_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFlowsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFlowsResponse) ProtoMessage() {}
+
+func (x *ListFlowsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFlowsResponse.ProtoReflect.Descriptor instead.
+func (*ListFlowsResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ListFlowsResponse) GetFlows() []*Flow {
+	if x != nil {
+		return x.Flows
+	}
+	return nil
+}
+
+type RemoveFlowsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Dpid  uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	// Removes only the flows whose destination MAC address is mac if
+	// it is not empty. Otherwise, removes all the flows.
+	Mac           string `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveFlowsRequest) Reset() {
+	*x = RemoveFlowsRequest{}
+	mi := &file_cherry_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveFlowsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFlowsRequest) ProtoMessage() {}
+
+func (x *RemoveFlowsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFlowsRequest.ProtoReflect.Descriptor instead.
+func (*RemoveFlowsRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *RemoveFlowsRequest) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+func (x *RemoveFlowsRequest) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+type RemoveFlowsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveFlowsResponse) Reset() {
+	*x = RemoveFlowsResponse{}
+	mi := &file_cherry_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveFlowsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFlowsResponse) ProtoMessage() {}
+
+func (x *RemoveFlowsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFlowsResponse.ProtoReflect.Descriptor instead.
+func (*RemoveFlowsResponse) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{21}
+}
+
+type WatchEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Event types to receive. Empty means all the types.
+	Types         []string `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_cherry_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *WatchEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+type ProcessorMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*ProcessorMessage_Register
+	//	*ProcessorMessage_Verdict
+	Message       isProcessorMessage_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessorMessage) Reset() {
+	*x = ProcessorMessage{}
+	mi := &file_cherry_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessorMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessorMessage) ProtoMessage() {}
+
+func (x *ProcessorMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessorMessage.ProtoReflect.Descriptor instead.
+func (*ProcessorMessage) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ProcessorMessage) GetMessage() isProcessorMessage_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *ProcessorMessage) GetRegister() *Register {
+	if x != nil {
+		if x, ok := x.Message.(*ProcessorMessage_Register); ok {
+			return x.Register
+		}
+	}
+	return nil
+}
+
+func (x *ProcessorMessage) GetVerdict() *Verdict {
+	if x != nil {
+		if x, ok := x.Message.(*ProcessorMessage_Verdict); ok {
+			return x.Verdict
+		}
+	}
+	return nil
+}
+
+type isProcessorMessage_Message interface {
+	isProcessorMessage_Message()
+}
+
+type ProcessorMessage_Register struct {
+	Register *Register `protobuf:"bytes,1,opt,name=register,proto3,oneof"`
+}
+
+type ProcessorMessage_Verdict struct {
+	Verdict *Verdict `protobuf:"bytes,2,opt,name=verdict,proto3,oneof"`
+}
+
+func (*ProcessorMessage_Register) isProcessorMessage_Message() {}
+
+func (*ProcessorMessage_Verdict) isProcessorMessage_Message() {}
+
+type Register struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name of the external processor, which is shown in the logs.
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Register) Reset() {
+	*x = Register{}
+	mi := &file_cherry_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Register) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Register) ProtoMessage() {}
+
+func (x *Register) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Register.ProtoReflect.Descriptor instead.
+func (*Register) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *Register) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type Verdict struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the PACKET_IN event.
+	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Drop stops the processor chain, so that the applications after the GRPC
+	// application do not receive the PACKET_IN. Otherwise, the next external
+	// processor or application receives it.
+	Drop          bool           `protobuf:"varint,2,opt,name=drop,proto3" json:"drop,omitempty"`
+	PacketOuts    []*PacketOut   `protobuf:"bytes,3,rep,name=packet_outs,json=packetOuts,proto3" json:"packet_outs,omitempty"`
+	Flows         []*FlowRequest `protobuf:"bytes,4,rep,name=flows,proto3" json:"flows,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Verdict) Reset() {
+	*x = Verdict{}
+	mi := &file_cherry_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Verdict) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Verdict) ProtoMessage() {}
+
+func (x *Verdict) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Verdict.ProtoReflect.Descriptor instead.
+func (*Verdict) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *Verdict) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Verdict) GetDrop() bool {
+	if x != nil {
+		return x.Drop
+	}
+	return false
+}
+
+func (x *Verdict) GetPacketOuts() []*PacketOut {
+	if x != nil {
+		return x.PacketOuts
+	}
+	return nil
+}
+
+func (x *Verdict) GetFlows() []*FlowRequest {
+	if x != nil {
+		return x.Flows
+	}
+	return nil
+}
+
+type PacketOut struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Dpid  uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	Port  uint32                 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	// Ethernet frame.
+	Data          []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PacketOut) Reset() {
+	*x = PacketOut{}
+	mi := &file_cherry_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PacketOut) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PacketOut) ProtoMessage() {}
+
+func (x *PacketOut) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PacketOut.ProtoReflect.Descriptor instead.
+func (*PacketOut) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *PacketOut) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+func (x *PacketOut) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *PacketOut) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// FlowRequest adds a flow whose zero or empty match fields are wildcards.
+type FlowRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Dpid        uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	Priority    uint32                 `protobuf:"varint,2,opt,name=priority,proto3" json:"priority,omitempty"`
+	IdleTimeout uint32                 `protobuf:"varint,3,opt,name=idle_timeout,json=idleTimeout,proto3" json:"idle_timeout,omitempty"`
+	HardTimeout uint32                 `protobuf:"varint,4,opt,name=hard_timeout,json=hardTimeout,proto3" json:"hard_timeout,omitempty"`
+	InPort      uint32                 `protobuf:"varint,5,opt,name=in_port,json=inPort,proto3" json:"in_port,omitempty"`
+	EthType     uint32                 `protobuf:"varint,6,opt,name=eth_type,json=ethType,proto3" json:"eth_type,omitempty"`
+	SrcMac      string                 `protobuf:"bytes,7,opt,name=src_mac,json=srcMac,proto3" json:"src_mac,omitempty"`
+	DstMac      string                 `protobuf:"bytes,8,opt,name=dst_mac,json=dstMac,proto3" json:"dst_mac,omitempty"`
+	// IPv4 addresses in the CIDR notation, e.g., 10.0.0.0/24.
+	SrcIp      string `protobuf:"bytes,9,opt,name=src_ip,json=srcIp,proto3" json:"src_ip,omitempty"`
+	DstIp      string `protobuf:"bytes,10,opt,name=dst_ip,json=dstIp,proto3" json:"dst_ip,omitempty"`
+	IpProtocol uint32 `protobuf:"varint,11,opt,name=ip_protocol,json=ipProtocol,proto3" json:"ip_protocol,omitempty"`
+	// Port to send the matched packets, which are dropped if it is zero.
+	OutPort       uint32 `protobuf:"varint,12,opt,name=out_port,json=outPort,proto3" json:"out_port,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlowRequest) Reset() {
+	*x = FlowRequest{}
+	mi := &file_cherry_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlowRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlowRequest) ProtoMessage() {}
+
+func (x *FlowRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlowRequest.ProtoReflect.Descriptor instead.
+func (*FlowRequest) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *FlowRequest) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+func (x *FlowRequest) GetPriority() uint32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *FlowRequest) GetIdleTimeout() uint32 {
+	if x != nil {
+		return x.IdleTimeout
+	}
+	return 0
+}
+
+func (x *FlowRequest) GetHardTimeout() uint32 {
+	if x != nil {
+		return x.HardTimeout
+	}
+	return 0
+}
+
+func (x *FlowRequest) GetInPort() uint32 {
+	if x != nil {
+		return x.InPort
+	}
+	return 0
+}
+
+func (x *FlowRequest) GetEthType() uint32 {
+	if x != nil {
+		return x.EthType
+	}
+	return 0
+}
+
+func (x *FlowRequest) GetSrcMac() string {
+	if x != nil {
+		return x.SrcMac
+	}
+	return ""
+}
+
+func (x *FlowRequest) GetDstMac() string {
+	if x != nil {
+		return x.DstMac
+	}
+	return ""
+}
+
+func (x *FlowRequest) GetSrcIp() string {
+	if x != nil {
+		return x.SrcIp
+	}
+	return ""
+}
+
+func (x *FlowRequest) GetDstIp() string {
+	if x != nil {
+		return x.DstIp
+	}
+	return ""
+}
+
+func (x *FlowRequest) GetIpProtocol() uint32 {
+	if x != nil {
+		return x.IpProtocol
+	}
+	return 0
+}
+
+func (x *FlowRequest) GetOutPort() uint32 {
+	if x != nil {
+		return x.OutPort
+	}
+	return 0
+}
+
+type ProcessorEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the event, which is echoed by the verdict of a PACKET_IN.
+	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*ProcessorEvent_PacketIn
+	//	*ProcessorEvent_DeviceStatus
+	//	*ProcessorEvent_PortStatus
+	Event         isProcessorEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessorEvent) Reset() {
+	*x = ProcessorEvent{}
+	mi := &file_cherry_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessorEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessorEvent) ProtoMessage() {}
+
+func (x *ProcessorEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessorEvent.ProtoReflect.Descriptor instead.
+func (*ProcessorEvent) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *ProcessorEvent) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ProcessorEvent) GetEvent() isProcessorEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *ProcessorEvent) GetPacketIn() *PacketIn {
+	if x != nil {
+		if x, ok := x.Event.(*ProcessorEvent_PacketIn); ok {
+			return x.PacketIn
+		}
+	}
+	return nil
+}
+
+func (x *ProcessorEvent) GetDeviceStatus() *DeviceStatus {
+	if x != nil {
+		if x, ok := x.Event.(*ProcessorEvent_DeviceStatus); ok {
+			return x.DeviceStatus
+		}
+	}
+	return nil
+}
+
+func (x *ProcessorEvent) GetPortStatus() *PortStatus {
+	if x != nil {
+		if x, ok := x.Event.(*ProcessorEvent_PortStatus); ok {
+			return x.PortStatus
+		}
+	}
+	return nil
+}
+
+type isProcessorEvent_Event interface {
+	isProcessorEvent_Event()
+}
+
+type ProcessorEvent_PacketIn struct {
+	PacketIn *PacketIn `protobuf:"bytes,2,opt,name=packet_in,json=packetIn,proto3,oneof"`
+}
+
+type ProcessorEvent_DeviceStatus struct {
+	DeviceStatus *DeviceStatus `protobuf:"bytes,3,opt,name=device_status,json=deviceStatus,proto3,oneof"`
+}
+
+type ProcessorEvent_PortStatus struct {
+	PortStatus *PortStatus `protobuf:"bytes,4,opt,name=port_status,json=portStatus,proto3,oneof"`
+}
+
+func (*ProcessorEvent_PacketIn) isProcessorEvent_Event() {}
+
+func (*ProcessorEvent_DeviceStatus) isProcessorEvent_Event() {}
+
+func (*ProcessorEvent_PortStatus) isProcessorEvent_Event() {}
+
+type PacketIn struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Dpid   uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	InPort uint32                 `protobuf:"varint,2,opt,name=in_port,json=inPort,proto3" json:"in_port,omitempty"`
+	// Ethernet frame without the VLAN tag.
+	Data          []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PacketIn) Reset() {
+	*x = PacketIn{}
+	mi := &file_cherry_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PacketIn) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PacketIn) ProtoMessage() {}
+
+func (x *PacketIn) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PacketIn.ProtoReflect.Descriptor instead.
+func (*PacketIn) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *PacketIn) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+func (x *PacketIn) GetInPort() uint32 {
+	if x != nil {
+		return x.InPort
+	}
+	return 0
+}
+
+func (x *PacketIn) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type DeviceStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dpid          uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	Up            bool                   `protobuf:"varint,2,opt,name=up,proto3" json:"up,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeviceStatus) Reset() {
+	*x = DeviceStatus{}
+	mi := &file_cherry_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeviceStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeviceStatus) ProtoMessage() {}
+
+func (x *DeviceStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeviceStatus.ProtoReflect.Descriptor instead.
+func (*DeviceStatus) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *DeviceStatus) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+func (x *DeviceStatus) GetUp() bool {
+	if x != nil {
+		return x.Up
+	}
+	return false
+}
+
+type PortStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dpid          uint64                 `protobuf:"varint,1,opt,name=dpid,proto3" json:"dpid,omitempty"`
+	Port          uint32                 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Up            bool                   `protobuf:"varint,3,opt,name=up,proto3" json:"up,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PortStatus) Reset() {
+	*x = PortStatus{}
+	mi := &file_cherry_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PortStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PortStatus) ProtoMessage() {}
+
+func (x *PortStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_cherry_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PortStatus.ProtoReflect.Descriptor instead.
+func (*PortStatus) Descriptor() ([]byte, []int) {
+	return file_cherry_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *PortStatus) GetDpid() uint64 {
+	if x != nil {
+		return x.Dpid
+	}
+	return 0
+}
+
+func (x *PortStatus) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *PortStatus) GetUp() bool {
+	if x != nil {
+		return x.Up
+	}
+	return false
+}
+
+var File_cherry_proto protoreflect.FileDescriptor
+
+const file_cherry_proto_rawDesc = "" +
+	"\n" +
+	"\fcherry.proto\x12\tcherry.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x9a\x02\n" +
+	"\x06Device\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04dpid\x18\x02 \x01(\x04R\x04dpid\x12\"\n" +
+	"\fmanufacturer\x18\x03 \x01(\tR\fmanufacturer\x12\x1a\n" +
+	"\bhardware\x18\x04 \x01(\tR\bhardware\x12\x1a\n" +
+	"\bsoftware\x18\x05 \x01(\tR\bsoftware\x12\x16\n" +
+	"\x06serial\x18\x06 \x01(\tR\x06serial\x12 \n" +
+	"\vdescription\x18\a \x01(\tR\vdescription\x12\x17\n" +
+	"\an_ports\x18\b \x01(\rR\x06nPorts\x12\x19\n" +
+	"\bn_tables\x18\t \x01(\rR\anTables\x12\"\n" +
+	"\rflow_table_id\x18\n" +
+	" \x01(\rR\vflowTableId\"\xce\x01\n" +
+	"\x04Port\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06number\x18\x02 \x01(\rR\x06number\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x10\n" +
+	"\x03mac\x18\x04 \x01(\tR\x03mac\x12\x19\n" +
+	"\badmin_up\x18\x05 \x01(\bR\aadminUp\x12\x17\n" +
+	"\alink_up\x18\x06 \x01(\bR\x06linkUp\x12\x14\n" +
+	"\x05speed\x18\a \x01(\x04R\x05speed\x12\x12\n" +
+	"\x04edge\x18\b \x01(\bR\x04edge\x12\x1a\n" +
+	"\bdisabled\x18\t \x01(\bR\bdisabled\"6\n" +
+	"\x04Link\x12\x14\n" +
+	"\x05ports\x18\x01 \x03(\tR\x05ports\x12\x18\n" +
+	"\aenabled\x18\x02 \x01(\bR\aenabled\"\x84\x01\n" +
+	"\x04Host\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x0e\n" +
+	"\x02ip\x18\x02 \x01(\tR\x02ip\x12\x10\n" +
+	"\x03mac\x18\x03 \x01(\tR\x03mac\x12\x12\n" +
+	"\x04port\x18\x04 \x01(\tR\x04port\x12 \n" +
+	"\vdescription\x18\x05 \x01(\tR\vdescription\x12\x14\n" +
+	"\x05stale\x18\x06 \x01(\bR\x05stale\"\xe5\x02\n" +
+	"\x04Flow\x12\x19\n" +
+	"\btable_id\x18\x01 \x01(\rR\atableId\x12\x1a\n" +
+	"\bpriority\x18\x02 \x01(\rR\bpriority\x12\x16\n" +
+	"\x06cookie\x18\x03 \x01(\x04R\x06cookie\x12!\n" +
+	"\fidle_timeout\x18\x04 \x01(\rR\vidleTimeout\x12!\n" +
+	"\fhard_timeout\x18\x05 \x01(\rR\vhardTimeout\x12\x1a\n" +
+	"\bduration\x18\x06 \x01(\rR\bduration\x12!\n" +
+	"\fpacket_count\x18\a \x01(\x04R\vpacketCount\x12\x1d\n" +
+	"\n" +
+	"byte_count\x18\b \x01(\x04R\tbyteCount\x120\n" +
+	"\x05match\x18\t \x03(\v2\x1a.cherry.v1.Flow.MatchEntryR\x05match\x1a8\n" +
+	"\n" +
+	"MatchEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"i\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\tR\x04data\"\x14\n" +
+	"\x12ListDevicesRequest\"B\n" +
+	"\x13ListDevicesResponse\x12+\n" +
+	"\adevices\x18\x01 \x03(\v2\x11.cherry.v1.DeviceR\adevices\"&\n" +
+	"\x10ListPortsRequest\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\":\n" +
+	"\x11ListPortsResponse\x12%\n" +
+	"\x05ports\x18\x01 \x03(\v2\x0f.cherry.v1.PortR\x05ports\"\x12\n" +
+	"\x10ListLinksRequest\":\n" +
+	"\x11ListLinksResponse\x12%\n" +
+	"\x05links\x18\x01 \x03(\v2\x0f.cherry.v1.LinkR\x05links\"\x12\n" +
+	"\x10ListHostsRequest\":\n" +
+	"\x11ListHostsResponse\x12%\n" +
+	"\x05hosts\x18\x01 \x03(\v2\x0f.cherry.v1.HostR\x05hosts\"Y\n" +
+	"\x0eAddHostRequest\x12\x13\n" +
+	"\x05ip_id\x18\x01 \x01(\x04R\x04ipId\x12\x10\n" +
+	"\x03mac\x18\x02 \x01(\tR\x03mac\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\"!\n" +
+	"\x0fAddHostResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"#\n" +
+	"\x11RemoveHostRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"\x14\n" +
+	"\x12RemoveHostResponse\"&\n" +
+	"\x10ListFlowsRequest\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\":\n" +
+	"\x11ListFlowsResponse\x12%\n" +
+	"\x05flows\x18\x01 \x03(\v2\x0f.cherry.v1.FlowR\x05flows\":\n" +
+	"\x12RemoveFlowsRequest\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\x12\x10\n" +
+	"\x03mac\x18\x02 \x01(\tR\x03mac\"\x15\n" +
+	"\x13RemoveFlowsResponse\"*\n" +
+	"\x12WatchEventsRequest\x12\x14\n" +
+	"\x05types\x18\x01 \x03(\tR\x05types\"\x80\x01\n" +
+	"\x10ProcessorMessage\x121\n" +
+	"\bregister\x18\x01 \x01(\v2\x13.cherry.v1.RegisterH\x00R\bregister\x12.\n" +
+	"\averdict\x18\x02 \x01(\v2\x12.cherry.v1.VerdictH\x00R\averdictB\t\n" +
+	"\amessage\"\x1e\n" +
+	"\bRegister\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\x92\x01\n" +
+	"\aVerdict\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04drop\x18\x02 \x01(\bR\x04drop\x125\n" +
+	"\vpacket_outs\x18\x03 \x03(\v2\x14.cherry.v1.PacketOutR\n" +
+	"packetOuts\x12,\n" +
+	"\x05flows\x18\x04 \x03(\v2\x16.cherry.v1.FlowRequestR\x05flows\"G\n" +
+	"\tPacketOut\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\rR\x04port\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\"\xd3\x02\n" +
+	"\vFlowRequest\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\x12\x1a\n" +
+	"\bpriority\x18\x02 \x01(\rR\bpriority\x12!\n" +
+	"\fidle_timeout\x18\x03 \x01(\rR\vidleTimeout\x12!\n" +
+	"\fhard_timeout\x18\x04 \x01(\rR\vhardTimeout\x12\x17\n" +
+	"\ain_port\x18\x05 \x01(\rR\x06inPort\x12\x19\n" +
+	"\beth_type\x18\x06 \x01(\rR\aethType\x12\x17\n" +
+	"\asrc_mac\x18\a \x01(\tR\x06srcMac\x12\x17\n" +
+	"\adst_mac\x18\b \x01(\tR\x06dstMac\x12\x15\n" +
+	"\x06src_ip\x18\t \x01(\tR\x05srcIp\x12\x15\n" +
+	"\x06dst_ip\x18\n" +
+	" \x01(\tR\x05dstIp\x12\x1f\n" +
+	"\vip_protocol\x18\v \x01(\rR\n" +
+	"ipProtocol\x12\x19\n" +
+	"\bout_port\x18\f \x01(\rR\aoutPort\"\xd7\x01\n" +
+	"\x0eProcessorEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x122\n" +
+	"\tpacket_in\x18\x02 \x01(\v2\x13.cherry.v1.PacketInH\x00R\bpacketIn\x12>\n" +
+	"\rdevice_status\x18\x03 \x01(\v2\x17.cherry.v1.DeviceStatusH\x00R\fdeviceStatus\x128\n" +
+	"\vport_status\x18\x04 \x01(\v2\x15.cherry.v1.PortStatusH\x00R\n" +
+	"portStatusB\a\n" +
+	"\x05event\"K\n" +
+	"\bPacketIn\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\x12\x17\n" +
+	"\ain_port\x18\x02 \x01(\rR\x06inPort\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\"2\n" +
+	"\fDeviceStatus\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\x12\x0e\n" +
+	"\x02up\x18\x02 \x01(\bR\x02up\"D\n" +
+	"\n" +
+	"PortStatus\x12\x12\n" +
+	"\x04dpid\x18\x01 \x01(\x04R\x04dpid\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\rR\x04port\x12\x0e\n" +
+	"\x02up\x18\x03 \x01(\bR\x02up2\x93\x05\n" +
+	"\x06Cherry\x12L\n" +
+	"\vListDevices\x12\x1d.cherry.v1.ListDevicesRequest\x1a\x1e.cherry.v1.ListDevicesResponse\x12F\n" +
+	"\tListPorts\x12\x1b.cherry.v1.ListPortsRequest\x1a\x1c.cherry.v1.ListPortsResponse\x12F\n" +
+	"\tListLinks\x12\x1b.cherry.v1.ListLinksRequest\x1a\x1c.cherry.v1.ListLinksResponse\x12F\n" +
+	"\tListHosts\x12\x1b.cherry.v1.ListHostsRequest\x1a\x1c.cherry.v1.ListHostsResponse\x12@\n" +
+	"\aAddHost\x12\x19.cherry.v1.AddHostRequest\x1a\x1a.cherry.v1.AddHostResponse\x12I\n" +
+	"\n" +
+	"RemoveHost\x12\x1c.cherry.v1.RemoveHostRequest\x1a\x1d.cherry.v1.RemoveHostResponse\x12F\n" +
+	"\tListFlows\x12\x1b.cherry.v1.ListFlowsRequest\x1a\x1c.cherry.v1.ListFlowsResponse\x12L\n" +
+	"\vRemoveFlows\x12\x1d.cherry.v1.RemoveFlowsRequest\x1a\x1e.cherry.v1.RemoveFlowsResponse\x12@\n" +
+	"\vWatchEvents\x12\x1d.cherry.v1.WatchEventsRequest\x1a\x10.cherry.v1.Event0\x012R\n" +
+	"\tProcessor\x12E\n" +
+	"\aProcess\x12\x1b.cherry.v1.ProcessorMessage\x1a\x19.cherry.v1.ProcessorEvent(\x010\x01B6Z4github.com/superkkt/cherry/northbound/app/grpcapi/pbb\x06proto3"
+
+var (
+	file_cherry_proto_rawDescOnce sync.Once
+	file_cherry_proto_rawDescData []byte
+)
+
+func file_cherry_proto_rawDescGZIP() []byte {
+	file_cherry_proto_rawDescOnce.Do(func() {
+		file_cherry_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_cherry_proto_rawDesc), len(file_cherry_proto_rawDesc)))
+	})
+	return file_cherry_proto_rawDescData
+}
+
+var file_cherry_proto_msgTypes = make([]protoimpl.MessageInfo, 33)
+var file_cherry_proto_goTypes = []any{
+	(*Device)(nil),                // 0: cherry.v1.Device
+	(*Port)(nil),                  // 1: cherry.v1.Port
+	(*Link)(nil),                  // 2: cherry.v1.Link
+	(*Host)(nil),                  // 3: cherry.v1.Host
+	(*Flow)(nil),                  // 4: cherry.v1.Flow
+	(*Event)(nil),                 // 5: cherry.v1.Event
+	(*ListDevicesRequest)(nil),    // 6: cherry.v1.ListDevicesRequest
+	(*ListDevicesResponse)(nil),   // 7: cherry.v1.ListDevicesResponse
+	(*ListPortsRequest)(nil),      // 8: cherry.v1.ListPortsRequest
+	(*ListPortsResponse)(nil),     // 9: cherry.v1.ListPortsResponse
+	(*ListLinksRequest)(nil),      // 10: cherry.v1.ListLinksRequest
+	(*ListLinksResponse)(nil),     // 11: cherry.v1.ListLinksResponse
+	(*ListHostsRequest)(nil),      // 12: cherry.v1.ListHostsRequest
+	(*ListHostsResponse)(nil),     // 13: cherry.v1.ListHostsResponse
+	(*AddHostRequest)(nil),        // 14: cherry.v1.AddHostRequest
+	(*AddHostResponse)(nil),       // 15: cherry.v1.AddHostResponse
+	(*RemoveHostRequest)(nil),     // 16: cherry.v1.RemoveHostRequest
+	(*RemoveHostResponse)(nil),    // 17: cherry.v1.RemoveHostResponse
+	(*ListFlowsRequest)(nil),      // 18: cherry.v1.ListFlowsRequest
+	(*ListFlowsResponse)(nil),     // 19: cherry.v1.ListFlowsResponse
+	(*RemoveFlowsRequest)(nil),    // 20: cherry.v1.RemoveFlowsRequest
+	(*RemoveFlowsResponse)(nil),   // 21: cherry.v1.RemoveFlowsResponse
+	(*WatchEventsRequest)(nil),    // 22: cherry.v1.WatchEventsRequest
+	(*ProcessorMessage)(nil),      // 23: cherry.v1.ProcessorMessage
+	(*Register)(nil),              // 24: cherry.v1.Register
+	(*Verdict)(nil),               // 25: cherry.v1.Verdict
+	(*PacketOut)(nil),             // 26: cherry.v1.PacketOut
+	(*FlowRequest)(nil),           // 27: cherry.v1.FlowRequest
+	(*ProcessorEvent)(nil),        // 28: cherry.v1.ProcessorEvent
+	(*PacketIn)(nil),              // 29: cherry.v1.PacketIn
+	(*DeviceStatus)(nil),          // 30: cherry.v1.DeviceStatus
+	(*PortStatus)(nil),            // 31: cherry.v1.PortStatus
+	nil,                           // 32: cherry.v1.Flow.MatchEntry
+	(*timestamppb.Timestamp)(nil), // 33: google.protobuf.Timestamp
+}
+var file_cherry_proto_depIdxs = []int32{
+	32, // 0: cherry.v1.Flow.match:type_name -> cherry.v1.Flow.MatchEntry
+	33, // 1: cherry.v1.Event.timestamp:type_name -> google.protobuf.Timestamp
+	0,  // 2: cherry.v1.ListDevicesResponse.devices:type_name -> cherry.v1.Device
+	1,  // 3: cherry.v1.ListPortsResponse.ports:type_name -> cherry.v1.Port
+	2,  // 4: cherry.v1.ListLinksResponse.links:type_name -> cherry.v1.Link
+	3,  // 5: cherry.v1.ListHostsResponse.hosts:type_name -> cherry.v1.Host
+	4,  // 6: cherry.v1.ListFlowsResponse.flows:type_name -> cherry.v1.Flow
+	24, // 7: cherry.v1.ProcessorMessage.register:type_name -> cherry.v1.Register
+	25, // 8: cherry.v1.ProcessorMessage.verdict:type_name -> cherry.v1.Verdict
+	26, // 9: cherry.v1.Verdict.packet_outs:type_name -> cherry.v1.PacketOut
+	27, // 10: cherry.v1.Verdict.flows:type_name -> cherry.v1.FlowRequest
+	29, // 11: cherry.v1.ProcessorEvent.packet_in:type_name -> cherry.v1.PacketIn
+	30, // 12: cherry.v1.ProcessorEvent.device_status:type_name -> cherry.v1.DeviceStatus
+	31, // 13: cherry.v1.ProcessorEvent.port_status:type_name -> cherry.v1.PortStatus
+	6,  // 14: cherry.v1.Cherry.ListDevices:input_type -> cherry.v1.ListDevicesRequest
+	8,  // 15: cherry.v1.Cherry.ListPorts:input_type -> cherry.v1.ListPortsRequest
+	10, // 16: cherry.v1.Cherry.ListLinks:input_type -> cherry.v1.ListLinksRequest
+	12, // 17: cherry.v1.Cherry.ListHosts:input_type -> cherry.v1.ListHostsRequest
+	14, // 18: cherry.v1.Cherry.AddHost:input_type -> cherry.v1.AddHostRequest
+	16, // 19: cherry.v1.Cherry.RemoveHost:input_type -> cherry.v1.RemoveHostRequest
+	18, // 20: cherry.v1.Cherry.ListFlows:input_type -> cherry.v1.ListFlowsRequest
+	20, // 21: cherry.v1.Cherry.RemoveFlows:input_type -> cherry.v1.RemoveFlowsRequest
+	22, // 22: cherry.v1.Cherry.WatchEvents:input_type -> cherry.v1.WatchEventsRequest
+	23, // 23: cherry.v1.Processor.Process:input_type -> cherry.v1.ProcessorMessage
+	7,  // 24: cherry.v1.Cherry.ListDevices:output_type -> cherry.v1.ListDevicesResponse
+	9,  // 25: cherry.v1.Cherry.ListPorts:output_type -> cherry.v1.ListPortsResponse
+	11, // 26: cherry.v1.Cherry.ListLinks:output_type -> cherry.v1.ListLinksResponse
+	13, // 27: cherry.v1.Cherry.ListHosts:output_type -> cherry.v1.ListHostsResponse
+	15, // 28: cherry.v1.Cherry.AddHost:output_type -> cherry.v1.AddHostResponse
+	17, // 29: cherry.v1.Cherry.RemoveHost:output_type -> cherry.v1.RemoveHostResponse
+	19, // 30: cherry.v1.Cherry.ListFlows:output_type -> cherry.v1.ListFlowsResponse
+	21, // 31: cherry.v1.Cherry.RemoveFlows:output_type -> cherry.v1.RemoveFlowsResponse
+	5,  // 32: cherry.v1.Cherry.WatchEvents:output_type -> cherry.v1.Event
+	28, // 33: cherry.v1.Processor.Process:output_type -> cherry.v1.ProcessorEvent
+	24, // [24:34] is the sub-list for method output_type
+	14, // [14:24] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_cherry_proto_init() }
+func file_cherry_proto_init() {
+	if File_cherry_proto != nil {
+		return
+	}
+	file_cherry_proto_msgTypes[23].OneofWrappers = []any{
+		(*ProcessorMessage_Register)(nil),
+		(*ProcessorMessage_Verdict)(nil),
+	}
+	file_cherry_proto_msgTypes[28].OneofWrappers = []any{
+		(*ProcessorEvent_PacketIn)(nil),
+		(*ProcessorEvent_DeviceStatus)(nil),
+		(*ProcessorEvent_PortStatus)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_cherry_proto_rawDesc), len(file_cherry_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   33,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_cherry_proto_goTypes,
+		DependencyIndexes: file_cherry_proto_depIdxs,
+		MessageInfos:      file_cherry_proto_msgTypes,
+	}.Build()
+	File_cherry_proto = out.File
+	file_cherry_proto_goTypes = nil
+	file_cherry_proto_depIdxs = nil
+}
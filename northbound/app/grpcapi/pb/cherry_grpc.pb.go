@@ -0,0 +1,576 @@
+// Cherry - An OpenFlow Controller
+//
+// Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+// Kitae Kim <superkkt@sds.co.kr>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: cherry.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Cherry_ListDevices_FullMethodName = "/cherry.v1.Cherry/ListDevices"
+	Cherry_ListPorts_FullMethodName   = "/cherry.v1.Cherry/ListPorts"
+	Cherry_ListLinks_FullMethodName   = "/cherry.v1.Cherry/ListLinks"
+	Cherry_ListHosts_FullMethodName   = "/cherry.v1.Cherry/ListHosts"
+	Cherry_AddHost_FullMethodName     = "/cherry.v1.Cherry/AddHost"
+	Cherry_RemoveHost_FullMethodName  = "/cherry.v1.Cherry/RemoveHost"
+	Cherry_ListFlows_FullMethodName   = "/cherry.v1.Cherry/ListFlows"
+	Cherry_RemoveFlows_FullMethodName = "/cherry.v1.Cherry/RemoveFlows"
+	Cherry_WatchEvents_FullMethodName = "/cherry.v1.Cherry/WatchEvents"
+)
+
+// CherryClient is the client API for Cherry service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Cherry is the northbound API of the controller. It provides the same
+// operations as the REST API for the automation written in other languages.
+type CherryClient interface {
+	// Topology.
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+	ListPorts(ctx context.Context, in *ListPortsRequest, opts ...grpc.CallOption) (*ListPortsResponse, error)
+	ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error)
+	// Host.
+	ListHosts(ctx context.Context, in *ListHostsRequest, opts ...grpc.CallOption) (*ListHostsResponse, error)
+	AddHost(ctx context.Context, in *AddHostRequest, opts ...grpc.CallOption) (*AddHostResponse, error)
+	RemoveHost(ctx context.Context, in *RemoveHostRequest, opts ...grpc.CallOption) (*RemoveHostResponse, error)
+	// Flow.
+	ListFlows(ctx context.Context, in *ListFlowsRequest, opts ...grpc.CallOption) (*ListFlowsResponse, error)
+	RemoveFlows(ctx context.Context, in *RemoveFlowsRequest, opts ...grpc.CallOption) (*RemoveFlowsResponse, error)
+	// WatchEvents streams the events published by the controller until the
+	// client cancels the call.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type cherryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCherryClient(cc grpc.ClientConnInterface) CherryClient {
+	return &cherryClient{cc}
+}
+
+func (c *cherryClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, Cherry_ListDevices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) ListPorts(ctx context.Context, in *ListPortsRequest, opts ...grpc.CallOption) (*ListPortsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPortsResponse)
+	err := c.cc.Invoke(ctx, Cherry_ListPorts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLinksResponse)
+	err := c.cc.Invoke(ctx, Cherry_ListLinks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) ListHosts(ctx context.Context, in *ListHostsRequest, opts ...grpc.CallOption) (*ListHostsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListHostsResponse)
+	err := c.cc.Invoke(ctx, Cherry_ListHosts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) AddHost(ctx context.Context, in *AddHostRequest, opts ...grpc.CallOption) (*AddHostResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddHostResponse)
+	err := c.cc.Invoke(ctx, Cherry_AddHost_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) RemoveHost(ctx context.Context, in *RemoveHostRequest, opts ...grpc.CallOption) (*RemoveHostResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveHostResponse)
+	err := c.cc.Invoke(ctx, Cherry_RemoveHost_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) ListFlows(ctx context.Context, in *ListFlowsRequest, opts ...grpc.CallOption) (*ListFlowsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFlowsResponse)
+	err := c.cc.Invoke(ctx, Cherry_ListFlows_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) RemoveFlows(ctx context.Context, in *RemoveFlowsRequest, opts ...grpc.CallOption) (*RemoveFlowsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveFlowsResponse)
+	err := c.cc.Invoke(ctx, Cherry_RemoveFlows_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cherryClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Cherry_ServiceDesc.Streams[0], Cherry_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cherry_WatchEventsClient = grpc.ServerStreamingClient[Event]
+
+// CherryServer is the server API for Cherry service.
+// All implementations must embed UnimplementedCherryServer
+// for forward compatibility.
+//
+// Cherry is the northbound API of the controller. It provides the same
+// operations as the REST API for the automation written in other languages.
+type CherryServer interface {
+	// Topology.
+	ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error)
+	ListPorts(context.Context, *ListPortsRequest) (*ListPortsResponse, error)
+	ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error)
+	// Host.
+	ListHosts(context.Context, *ListHostsRequest) (*ListHostsResponse, error)
+	AddHost(context.Context, *AddHostRequest) (*AddHostResponse, error)
+	RemoveHost(context.Context, *RemoveHostRequest) (*RemoveHostResponse, error)
+	// Flow.
+	ListFlows(context.Context, *ListFlowsRequest) (*ListFlowsResponse, error)
+	RemoveFlows(context.Context, *RemoveFlowsRequest) (*RemoveFlowsResponse, error)
+	// WatchEvents streams the events published by the controller until the
+	// client cancels the call.
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedCherryServer()
+}
+
+// UnimplementedCherryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCherryServer struct{}
+
+func (UnimplementedCherryServer) ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (UnimplementedCherryServer) ListPorts(context.Context, *ListPortsRequest) (*ListPortsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListPorts not implemented")
+}
+func (UnimplementedCherryServer) ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListLinks not implemented")
+}
+func (UnimplementedCherryServer) ListHosts(context.Context, *ListHostsRequest) (*ListHostsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListHosts not implemented")
+}
+func (UnimplementedCherryServer) AddHost(context.Context, *AddHostRequest) (*AddHostResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AddHost not implemented")
+}
+func (UnimplementedCherryServer) RemoveHost(context.Context, *RemoveHostRequest) (*RemoveHostResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method RemoveHost not implemented")
+}
+func (UnimplementedCherryServer) ListFlows(context.Context, *ListFlowsRequest) (*ListFlowsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListFlows not implemented")
+}
+func (UnimplementedCherryServer) RemoveFlows(context.Context, *RemoveFlowsRequest) (*RemoveFlowsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method RemoveFlows not implemented")
+}
+func (UnimplementedCherryServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Error(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedCherryServer) mustEmbedUnimplementedCherryServer() {}
+func (UnimplementedCherryServer) testEmbeddedByValue()                {}
+
+// UnsafeCherryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CherryServer will
+// result in compilation errors.
+type UnsafeCherryServer interface {
+	mustEmbedUnimplementedCherryServer()
+}
+
+func RegisterCherryServer(s grpc.ServiceRegistrar, srv CherryServer) {
+	// If the following call panics, it indicates UnimplementedCherryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Cherry_ServiceDesc, srv)
+}
+
+func _Cherry_ListDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).ListDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_ListDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).ListDevices(ctx, req.(*ListDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_ListPorts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPortsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).ListPorts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_ListPorts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).ListPorts(ctx, req.(*ListPortsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_ListLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).ListLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_ListLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).ListLinks(ctx, req.(*ListLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_ListHosts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListHostsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).ListHosts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_ListHosts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).ListHosts(ctx, req.(*ListHostsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_AddHost_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddHostRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).AddHost(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_AddHost_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).AddHost(ctx, req.(*AddHostRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_RemoveHost_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveHostRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).RemoveHost(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_RemoveHost_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).RemoveHost(ctx, req.(*RemoveHostRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_ListFlows_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFlowsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).ListFlows(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_ListFlows_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).ListFlows(ctx, req.(*ListFlowsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_RemoveFlows_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveFlowsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CherryServer).RemoveFlows(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cherry_RemoveFlows_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CherryServer).RemoveFlows(ctx, req.(*RemoveFlowsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cherry_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CherryServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cherry_WatchEventsServer = grpc.ServerStreamingServer[Event]
+
+// Cherry_ServiceDesc is the grpc.ServiceDesc for Cherry service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Cherry_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cherry.v1.Cherry",
+	HandlerType: (*CherryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListDevices",
+			Handler:    _Cherry_ListDevices_Handler,
+		},
+		{
+			MethodName: "ListPorts",
+			Handler:    _Cherry_ListPorts_Handler,
+		},
+		{
+			MethodName: "ListLinks",
+			Handler:    _Cherry_ListLinks_Handler,
+		},
+		{
+			MethodName: "ListHosts",
+			Handler:    _Cherry_ListHosts_Handler,
+		},
+		{
+			MethodName: "AddHost",
+			Handler:    _Cherry_AddHost_Handler,
+		},
+		{
+			MethodName: "RemoveHost",
+			Handler:    _Cherry_RemoveHost_Handler,
+		},
+		{
+			MethodName: "ListFlows",
+			Handler:    _Cherry_ListFlows_Handler,
+		},
+		{
+			MethodName: "RemoveFlows",
+			Handler:    _Cherry_RemoveFlows_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Cherry_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "cherry.proto",
+}
+
+const (
+	Processor_Process_FullMethodName = "/cherry.v1.Processor/Process"
+)
+
+// ProcessorClient is the client API for Processor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Processor lets the applications written in other languages take part in
+// the processor chain of the controller without being built into it.
+type ProcessorClient interface {
+	// Process attaches the caller as an external processor until the call is
+	// closed. The first message should be a Register, and all the others should
+	// be the verdicts of the PACKET_INs. The controller streams the PACKET_INs
+	// reaching the GRPC application in the chain, and waits for their verdicts
+	// up to grpc.processor_timeout. The device and port events are only notified.
+	Process(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ProcessorMessage, ProcessorEvent], error)
+}
+
+type processorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProcessorClient(cc grpc.ClientConnInterface) ProcessorClient {
+	return &processorClient{cc}
+}
+
+func (c *processorClient) Process(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ProcessorMessage, ProcessorEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Processor_ServiceDesc.Streams[0], Processor_Process_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ProcessorMessage, ProcessorEvent]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Processor_ProcessClient = grpc.BidiStreamingClient[ProcessorMessage, ProcessorEvent]
+
+// ProcessorServer is the server API for Processor service.
+// All implementations must embed UnimplementedProcessorServer
+// for forward compatibility.
+//
+// Processor lets the applications written in other languages take part in
+// the processor chain of the controller without being built into it.
+type ProcessorServer interface {
+	// Process attaches the caller as an external processor until the call is
+	// closed. The first message should be a Register, and all the others should
+	// be the verdicts of the PACKET_INs. The controller streams the PACKET_INs
+	// reaching the GRPC application in the chain, and waits for their verdicts
+	// up to grpc.processor_timeout. The device and port events are only notified.
+	Process(grpc.BidiStreamingServer[ProcessorMessage, ProcessorEvent]) error
+	mustEmbedUnimplementedProcessorServer()
+}
+
+// UnimplementedProcessorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedProcessorServer struct{}
+
+func (UnimplementedProcessorServer) Process(grpc.BidiStreamingServer[ProcessorMessage, ProcessorEvent]) error {
+	return status.Error(codes.Unimplemented, "method Process not implemented")
+}
+func (UnimplementedProcessorServer) mustEmbedUnimplementedProcessorServer() {}
+func (UnimplementedProcessorServer) testEmbeddedByValue()                   {}
+
+// UnsafeProcessorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ProcessorServer will
+// result in compilation errors.
+type UnsafeProcessorServer interface {
+	mustEmbedUnimplementedProcessorServer()
+}
+
+func RegisterProcessorServer(s grpc.ServiceRegistrar, srv ProcessorServer) {
+	// If the following call panics, it indicates UnimplementedProcessorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Processor_ServiceDesc, srv)
+}
+
+func _Processor_Process_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ProcessorServer).Process(&grpc.GenericServerStream[ProcessorMessage, ProcessorEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Processor_ProcessServer = grpc.BidiStreamingServer[ProcessorMessage, ProcessorEvent]
+
+// Processor_ServiceDesc is the grpc.ServiceDesc for Processor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Processor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cherry.v1.Processor",
+	HandlerType: (*ProcessorServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Process",
+			Handler:       _Processor_Process_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "cherry.proto",
+}
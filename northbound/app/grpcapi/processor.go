@@ -0,0 +1,185 @@
+//go:build grpc
+// +build grpc
+
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package grpcapi
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/superkkt/cherry/northbound/app/grpcapi/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type processorServer struct {
+	pb.UnimplementedProcessorServer
+	app *GRPC
+}
+
+func (r *processorServer) Process(stream pb.Processor_ProcessServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	reg := msg.GetRegister()
+	if reg == nil || reg.Name == "" {
+		return status.Error(codes.InvalidArgument, "the first message should be a register with the name")
+	}
+
+	e := newExternal(reg.Name)
+	r.app.attach(e)
+	defer r.app.detach(e)
+	logger.Infof("external processor %v has been attached", e.name)
+	defer logger.Infof("external processor %v has been detached", e.name)
+
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			v := msg.GetVerdict()
+			if v == nil {
+				errc <- status.Error(codes.InvalidArgument, "expected a verdict")
+				return
+			}
+			verdict, err := newExternalVerdict(v)
+			if err != nil {
+				errc <- status.Error(codes.InvalidArgument, err.Error())
+				return
+			}
+			if !e.answer(v.Id, verdict) {
+				logger.Debugf("ignoring the late verdict of %v: ID=%v", e.name, v.Id)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case err := <-errc:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case v := <-e.events:
+			if err := stream.Send(newProcessorEvent(v)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func newProcessorEvent(e externalEvent) *pb.ProcessorEvent {
+	v := &pb.ProcessorEvent{Id: e.id}
+	switch {
+	case e.packetIn != nil:
+		v.Event = &pb.ProcessorEvent_PacketIn{PacketIn: &pb.PacketIn{
+			Dpid:   e.packetIn.dpid,
+			InPort: e.packetIn.inPort,
+			Data:   e.packetIn.data,
+		}}
+	case e.device != nil:
+		v.Event = &pb.ProcessorEvent_DeviceStatus{DeviceStatus: &pb.DeviceStatus{
+			Dpid: e.device.dpid,
+			Up:   e.device.up,
+		}}
+	case e.port != nil:
+		v.Event = &pb.ProcessorEvent_PortStatus{PortStatus: &pb.PortStatus{
+			Dpid: e.port.dpid,
+			Port: e.port.port,
+			Up:   e.port.up,
+		}}
+	}
+
+	return v
+}
+
+func newExternalVerdict(v *pb.Verdict) (externalVerdict, error) {
+	verdict := externalVerdict{drop: v.Drop}
+	for _, p := range v.PacketOuts {
+		if len(p.Data) < 14 {
+			return externalVerdict{}, fmt.Errorf("invalid PACKET_OUT data length: %v", len(p.Data))
+		}
+		verdict.packetOuts = append(verdict.packetOuts, externalPacketOut{dpid: p.Dpid, port: p.Port, data: p.Data})
+	}
+	for _, f := range v.Flows {
+		flow, err := newExternalFlow(f)
+		if err != nil {
+			return externalVerdict{}, err
+		}
+		verdict.flows = append(verdict.flows, flow)
+	}
+
+	return verdict, nil
+}
+
+func newExternalFlow(f *pb.FlowRequest) (externalFlow, error) {
+	if f.Priority > 0xFFFF || f.IdleTimeout > 0xFFFF || f.HardTimeout > 0xFFFF {
+		return externalFlow{}, fmt.Errorf("invalid priority or timeouts of the flow: %v", f)
+	}
+	if f.EthType > 0xFFFF || f.IpProtocol > 0xFF {
+		return externalFlow{}, fmt.Errorf("invalid eth_type or ip_protocol of the flow: %v", f)
+	}
+
+	flow := externalFlow{
+		dpid:        f.Dpid,
+		priority:    uint16(f.Priority),
+		idleTimeout: uint16(f.IdleTimeout),
+		hardTimeout: uint16(f.HardTimeout),
+		inPort:      f.InPort,
+		etherType:   uint16(f.EthType),
+		ipProtocol:  uint8(f.IpProtocol),
+		outPort:     f.OutPort,
+	}
+	var err error
+	if f.SrcMac != "" {
+		if flow.srcMAC, err = net.ParseMAC(f.SrcMac); err != nil {
+			return externalFlow{}, err
+		}
+	}
+	if f.DstMac != "" {
+		if flow.dstMAC, err = net.ParseMAC(f.DstMac); err != nil {
+			return externalFlow{}, err
+		}
+	}
+	if f.SrcIp != "" {
+		if _, flow.srcIP, err = net.ParseCIDR(f.SrcIp); err != nil {
+			return externalFlow{}, err
+		}
+	}
+	if f.DstIp != "" {
+		if _, flow.dstIP, err = net.ParseCIDR(f.DstIp); err != nil {
+			return externalFlow{}, err
+		}
+	}
+
+	return flow, nil
+}
@@ -0,0 +1,366 @@
+//go:build grpc
+// +build grpc
+
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/grpcapi/pb"
+	"github.com/superkkt/cherry/rbac"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Maximum number of the events queued for a slow WatchEvents client. The
+// events are dropped if it is exceeded.
+const eventQueueSize = 1024
+
+// Roles required by the methods that change the network. The other methods require the reader role.
+var methodRoles = map[string]rbac.Role{
+	"/cherry.v1.Cherry/AddHost":     rbac.RoleOperator,
+	"/cherry.v1.Cherry/RemoveHost":  rbac.RoleOperator,
+	"/cherry.v1.Cherry/RemoveFlows": rbac.RoleOperator,
+	// External processors can send any packet and install any flow.
+	"/cherry.v1.Processor/Process": rbac.RoleAdmin,
+}
+
+func (r *GRPC) serve() error {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(authorizeUnary),
+		grpc.StreamInterceptor(authorizeStream),
+	}
+	if r.tls {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		config := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if cas := rbac.Current().ClientCAs(); cas != nil {
+			// The clients without a certificate can still use the tokens.
+			config.ClientCAs = cas
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%v", r.port))
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer(opts...)
+	pb.RegisterCherryServer(s, &server{app: r})
+	pb.RegisterProcessorServer(s, &processorServer{app: r})
+	gnmi.RegisterGNMIServer(s, &gnmiServer{app: r})
+	go func() {
+		if err := s.Serve(l); err != nil {
+			logger.Errorf("gRPC server has been stopped: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func authorizeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	id, err := authorize(ctx, info.FullMethod)
+	// Records the calls that change the network, including the denied ones.
+	if _, ok := methodRoles[info.FullMethod]; ok {
+		defer func() { audit(ctx, id, info.FullMethod, req, err) }()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func audit(ctx context.Context, id rbac.Identity, method string, req interface{}, err error) {
+	a := event.Audit{
+		User:   id.Name,
+		Action: "gRPC " + method,
+		Params: fmt.Sprint(req),
+		Result: status.Code(err).String(),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		a.Client = p.Addr.String()
+	}
+	logger.Infof("audit: %v", a)
+	event.RecordAudit(a)
+}
+
+func authorizeStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if _, err := authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+
+	return handler(srv, stream)
+}
+
+// authorize checks the bearer token in the authorization metadata or the client
+// certificate of the call against the current RBAC policy, and then returns the client.
+func authorize(ctx context.Context, method string) (rbac.Identity, error) {
+	required, ok := methodRoles[method]
+	if !ok {
+		required = rbac.RoleReader
+	}
+
+	token := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			if len(v) > 7 && strings.EqualFold(v[:7], "Bearer ") {
+				token = strings.TrimSpace(v[7:])
+			}
+		}
+	}
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &info.State
+		}
+	}
+
+	id, err := rbac.Current().Authorize(token, state, required)
+	switch err {
+	case nil:
+		return id, nil
+	case rbac.ErrUnauthenticated:
+		return id, status.Error(codes.Unauthenticated, err.Error())
+	default:
+		logger.Infof("permission denied: client=%v, role=%v, method=%v", id.Name, id.Role, method)
+		return id, status.Error(codes.PermissionDenied, err.Error())
+	}
+}
+
+type server struct {
+	pb.UnimplementedCherryServer
+	app *GRPC
+}
+
+func (r *server) ListDevices(ctx context.Context, req *pb.ListDevicesRequest) (*pb.ListDevicesResponse, error) {
+	resp := &pb.ListDevicesResponse{}
+	for _, d := range r.app.devices() {
+		if d.ID() == "" {
+			// Not initialized yet.
+			continue
+		}
+		v := network.NewDeviceInfo(d)
+		resp.Devices = append(resp.Devices, &pb.Device{
+			Id:           v.ID,
+			Dpid:         v.DPID,
+			Manufacturer: v.Descriptions.Manufacturer,
+			Hardware:     v.Descriptions.Hardware,
+			Software:     v.Descriptions.Software,
+			Serial:       v.Descriptions.Serial,
+			Description:  v.Descriptions.Description,
+			NPorts:       uint32(v.NumPorts),
+			NTables:      uint32(v.NumTables),
+			FlowTableId:  uint32(v.FlowTableID),
+		})
+	}
+
+	return resp, nil
+}
+
+func (r *server) ListPorts(ctx context.Context, req *pb.ListPortsRequest) (*pb.ListPortsResponse, error) {
+	d := r.app.device(req.Dpid)
+	if d == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown device: %v", req.Dpid)
+	}
+
+	resp := &pb.ListPortsResponse{}
+	for _, v := range network.NewPortInfos(r.app.getFinder(), d) {
+		resp.Ports = append(resp.Ports, &pb.Port{
+			Id:       v.ID,
+			Number:   v.Number,
+			Name:     v.Name,
+			Mac:      v.MAC,
+			AdminUp:  v.AdminUp,
+			LinkUp:   v.LinkUp,
+			Speed:    v.Speed,
+			Edge:     v.Edge,
+			Disabled: v.Disabled,
+		})
+	}
+
+	return resp, nil
+}
+
+func (r *server) ListLinks(ctx context.Context, req *pb.ListLinksRequest) (*pb.ListLinksResponse, error) {
+	resp := &pb.ListLinksResponse{}
+	finder := r.app.getFinder()
+	if finder == nil {
+		return resp, nil
+	}
+	for _, v := range network.NewLinkInfos(finder) {
+		resp.Links = append(resp.Links, &pb.Link{Ports: v.Ports[:], Enabled: v.Enabled})
+	}
+
+	return resp, nil
+}
+
+func (r *server) ListHosts(ctx context.Context, req *pb.ListHostsRequest) (*pb.ListHostsResponse, error) {
+	// Zero limit means all the hosts.
+	hosts, err := r.app.db.Hosts(0, 0)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.ListHostsResponse{}
+	for _, v := range hosts {
+		id, err := strconv.ParseUint(v.ID, 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "invalid host ID: %v", v.ID)
+		}
+		resp.Hosts = append(resp.Hosts, &pb.Host{
+			Id:          id,
+			Ip:          v.IP,
+			Mac:         v.MAC,
+			Port:        v.Port,
+			Description: v.Description,
+			Stale:       v.Stale,
+		})
+	}
+
+	return resp, nil
+}
+
+func (r *server) AddHost(ctx context.Context, req *pb.AddHostRequest) (*pb.AddHostResponse, error) {
+	id, err := r.app.addHost(network.HostParam{IPID: req.IpId, MAC: req.Mac, Description: req.Description})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	logger.Infof("added a new host via gRPC: ID=%v, MAC=%v", id, req.Mac)
+
+	return &pb.AddHostResponse{Id: id}, nil
+}
+
+func (r *server) RemoveHost(ctx context.Context, req *pb.RemoveHostRequest) (*pb.RemoveHostResponse, error) {
+	ok, err := r.app.removeHost(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown host ID: %v", req.Id)
+	}
+	logger.Infof("removed the host via gRPC: ID=%v", req.Id)
+
+	return &pb.RemoveHostResponse{}, nil
+}
+
+func (r *server) ListFlows(ctx context.Context, req *pb.ListFlowsRequest) (*pb.ListFlowsResponse, error) {
+	d := r.app.device(req.Dpid)
+	if d == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown device: %v", req.Dpid)
+	}
+	flows, err := network.QueryFlows(d)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	resp := &pb.ListFlowsResponse{}
+	for _, v := range flows {
+		resp.Flows = append(resp.Flows, &pb.Flow{
+			TableId:     uint32(v.TableID),
+			Priority:    uint32(v.Priority),
+			Cookie:      v.Cookie,
+			IdleTimeout: uint32(v.IdleTimeout),
+			HardTimeout: uint32(v.HardTimeout),
+			Duration:    v.Duration,
+			PacketCount: v.PacketCount,
+			ByteCount:   v.ByteCount,
+			Match:       v.Match,
+		})
+	}
+
+	return resp, nil
+}
+
+func (r *server) RemoveFlows(ctx context.Context, req *pb.RemoveFlowsRequest) (*pb.RemoveFlowsResponse, error) {
+	d := r.app.device(req.Dpid)
+	if d == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown device: %v", req.Dpid)
+	}
+
+	var err error
+	if req.Mac == "" {
+		err = d.RemoveAllFlows()
+	} else {
+		mac, e := net.ParseMAC(req.Mac)
+		if e != nil {
+			return nil, status.Error(codes.InvalidArgument, e.Error())
+		}
+		err = d.RemoveFlowByMAC(mac)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return &pb.RemoveFlowsResponse{}, nil
+}
+
+func (r *server) WatchEvents(req *pb.WatchEventsRequest, stream pb.Cherry_WatchEventsServer) error {
+	types := make([]event.Type, 0, len(req.Types))
+	for _, v := range req.Types {
+		types = append(types, event.Type(v))
+	}
+
+	queue, unsubscribe := event.Channel(eventQueueSize, types...)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-queue:
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				logger.Errorf("failed to encode the event data: type=%v, err=%v", e.Type, err)
+				continue
+			}
+			msg := &pb.Event{
+				Type:      string(e.Type),
+				Timestamp: timestamppb.New(e.Timestamp),
+				Data:      string(data),
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package grpcapi
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+)
+
+// The telemetry tree served by gNMI, whose leaves are:
+//
+//	/controller/state/{devices,links}
+//	/devices/device[dpid=N]/state/{name,manufacturer,hardware,software,serial,n-ports,n-tables,flow-table-id,quirk}
+//	/devices/device[dpid=N]/ports/port[number=M]/state/{name,mac,admin-status,oper-status,speed}
+//	/devices/device[dpid=N]/ports/port[number=M]/state/counters/{in-octets,out-octets,in-pkts,out-pkts,in-discards,out-discards,in-errors,out-errors}
+//	/devices/device[dpid=N]/ports/port[number=M]/state/rates/{in-bps,out-bps,in-pps,out-pps}
+//	/links/link[dpid=N][port=M]/state/{peer-dpid,peer-port,enabled,latency,bps,pps,utilization}
+//
+// The counters are the ones polled by the controller every
+// default.port_stats_interval, so that the subscribers do not poll the
+// switches. A link has two leaves, one for each direction.
+
+const (
+	// Subscriptions are checked every telemetryTick, which is also the minimum
+	// sample interval.
+	telemetryTick = 1 * time.Second
+	// Default sample interval when the subscription does not have one.
+	defaultSampleInterval = 10 * time.Second
+)
+
+// pathElem is an element of a telemetry path. The keys of a subscription path
+// can be "*" that matches any value, and the ones not given also match any.
+// The name "*" matches any element, and "..." matches any number of elements.
+type pathElem struct {
+	name string
+	keys map[string]string
+}
+
+func (r pathElem) String() string {
+	if len(r.keys) == 0 {
+		return r.name
+	}
+
+	names := make([]string, 0, len(r.keys))
+	for k := range r.keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(r.name)
+	for _, k := range names {
+		b.WriteString("[" + k + "=" + r.keys[k] + "]")
+	}
+	return b.String()
+}
+
+func pathString(path []pathElem) string {
+	elems := make([]string, len(path))
+	for i, v := range path {
+		elems[i] = v.String()
+	}
+	return "/" + strings.Join(elems, "/")
+}
+
+// matchPath returns whether path is under pattern.
+func matchPath(pattern, path []pathElem) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	if pattern[0].name == "..." {
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if pattern[0].name != "*" && pattern[0].name != path[0].name {
+		return false
+	}
+	for k, v := range pattern[0].keys {
+		if v != "*" && path[0].keys[k] != v {
+			return false
+		}
+	}
+
+	return matchPath(pattern[1:], path[1:])
+}
+
+// telemetryLeaf is a leaf of the telemetry tree, whose value is a string,
+// uint64, float64 or bool.
+type telemetryLeaf struct {
+	path  []pathElem
+	value interface{}
+}
+
+// telemetrySnapshot returns all the leaves of the telemetry tree.
+func telemetrySnapshot(finder network.Finder) []telemetryLeaf {
+	leaves := []telemetryLeaf{}
+	add := func(value interface{}, path ...pathElem) {
+		leaves = append(leaves, telemetryLeaf{path: path, value: value})
+	}
+	elem := func(name string, kv ...string) pathElem {
+		v := pathElem{name: name}
+		if len(kv) > 0 {
+			v.keys = make(map[string]string)
+			for i := 0; i+1 < len(kv); i += 2 {
+				v.keys[kv[i]] = kv[i+1]
+			}
+		}
+		return v
+	}
+	state := elem("state")
+
+	devices := 0
+	for _, d := range finder.Devices() {
+		if d.ID() == "" {
+			// Not initialized yet.
+			continue
+		}
+		devices++
+		info := network.NewDeviceInfo(d)
+		root, device := elem("devices"), elem("device", "dpid", d.ID())
+		name := ""
+		if info.Alias != nil {
+			name = info.Alias.Name
+		}
+		for _, v := range []struct {
+			leaf  string
+			value interface{}
+		}{
+			{"name", name},
+			{"manufacturer", info.Descriptions.Manufacturer},
+			{"hardware", info.Descriptions.Hardware},
+			{"software", info.Descriptions.Software},
+			{"serial", info.Descriptions.Serial},
+			{"n-ports", uint64(info.NumPorts)},
+			{"n-tables", uint64(info.NumTables)},
+			{"flow-table-id", uint64(info.FlowTableID)},
+			{"quirk", info.Quirk},
+		} {
+			add(v.value, root, device, state, elem(v.leaf))
+		}
+
+		for _, p := range d.Ports() {
+			value := p.Value()
+			if value == nil {
+				continue
+			}
+			ports, port := elem("ports"), elem("port", "number", strconv.FormatUint(uint64(p.Number()), 10))
+			for _, v := range []struct {
+				leaf  string
+				value interface{}
+			}{
+				{"name", value.Name()},
+				{"mac", value.MAC().String()},
+				{"admin-status", portStatus(!value.IsPortDown())},
+				{"oper-status", portStatus(!value.IsLinkDown())},
+				{"speed", value.Speed()},
+			} {
+				add(v.value, root, device, ports, port, state, elem(v.leaf))
+			}
+
+			if c, _, ok := p.Counters(); ok {
+				counters := elem("counters")
+				for _, v := range []struct {
+					leaf  string
+					value uint64
+				}{
+					{"in-octets", c.RxBytes},
+					{"out-octets", c.TxBytes},
+					{"in-pkts", c.RxPackets},
+					{"out-pkts", c.TxPackets},
+					{"in-discards", c.RxDropped},
+					{"out-discards", c.TxDropped},
+					{"in-errors", c.RxErrors},
+					{"out-errors", c.TxErrors},
+				} {
+					add(v.value, root, device, ports, port, state, counters, elem(v.leaf))
+				}
+			}
+			if r, ok := p.Rates(); ok {
+				rates := elem("rates")
+				for _, v := range []struct {
+					leaf  string
+					value float64
+				}{
+					{"in-bps", r.RxBps},
+					{"out-bps", r.TxBps},
+					{"in-pps", r.RxPps},
+					{"out-pps", r.TxPps},
+				} {
+					add(v.value, root, device, ports, port, state, rates, elem(v.leaf))
+				}
+			}
+		}
+	}
+
+	links := finder.Links()
+	for _, v := range links {
+		enabled := finder.IsEnabledBySTP(v[0])
+		for _, dir := range [][2]*network.Port{{v[0], v[1]}, {v[1], v[0]}} {
+			p, peer := dir[0], dir[1]
+			root := elem("links")
+			link := elem("link", "dpid", p.Device().ID(), "port", strconv.FormatUint(uint64(p.Number()), 10))
+			add(peer.Device().ID(), root, link, state, elem("peer-dpid"))
+			add(uint64(peer.Number()), root, link, state, elem("peer-port"))
+			add(enabled, root, link, state, elem("enabled"))
+			// In nanoseconds, or zero if not measured yet.
+			add(uint64(finder.LinkLatency(p)), root, link, state, elem("latency"))
+			if t, ok := finder.LinkTraffic(p); ok {
+				add(t.Bps, root, link, state, elem("bps"))
+				add(t.Pps, root, link, state, elem("pps"))
+				add(t.Utilization, root, link, state, elem("utilization"))
+			}
+		}
+	}
+
+	controller := elem("controller")
+	add(uint64(devices), controller, state, elem("devices"))
+	add(uint64(len(links)), controller, state, elem("links"))
+
+	return leaves
+}
+
+func portStatus(up bool) string {
+	if up {
+		return "UP"
+	}
+	return "DOWN"
+}
+
+// selectLeaves returns the leaves under pattern.
+func selectLeaves(leaves []telemetryLeaf, pattern []pathElem) []telemetryLeaf {
+	v := []telemetryLeaf{}
+	for _, leaf := range leaves {
+		if matchPath(pattern, leaf.path) {
+			v = append(v, leaf)
+		}
+	}
+	return v
+}
+
+// telemetrySubscription tracks the leaves sent to a subscriber of path, so that
+// only the changed ones are sent if onChange or suppressRedundant.
+type telemetrySubscription struct {
+	path              []pathElem
+	onChange          bool
+	interval          time.Duration // Sample interval.
+	suppressRedundant bool
+	// The unchanged leaves are also sent every heartbeat if it is not zero.
+	heartbeat time.Duration
+
+	sent     map[string]telemetryLeaf // Key = path string.
+	next     time.Time                // When the next sample is due.
+	lastFull time.Time                // When all the leaves were sent last.
+}
+
+func newTelemetrySubscription(path []pathElem, onChange bool, interval time.Duration, suppressRedundant bool, heartbeat time.Duration) *telemetrySubscription {
+	if interval == 0 {
+		interval = defaultSampleInterval
+	}
+	if interval < telemetryTick {
+		interval = telemetryTick
+	}
+	if heartbeat != 0 && heartbeat < telemetryTick {
+		heartbeat = telemetryTick
+	}
+
+	return &telemetrySubscription{
+		path:              path,
+		onChange:          onChange,
+		interval:          interval,
+		suppressRedundant: suppressRedundant,
+		heartbeat:         heartbeat,
+		sent:              make(map[string]telemetryLeaf),
+	}
+}
+
+// due returns whether the subscription should be checked at now. On-change
+// subscriptions are checked every tick.
+func (r *telemetrySubscription) due(now time.Time) bool {
+	return r.onChange || !now.Before(r.next)
+}
+
+// changes returns the leaves to be sent and the paths of the leaves removed
+// since the last call, which should be called when due. The first call returns
+// all the leaves.
+func (r *telemetrySubscription) changes(leaves []telemetryLeaf, now time.Time) (updates []telemetryLeaf, deletes [][]pathElem) {
+	if !r.onChange {
+		r.next = now.Add(r.interval)
+	}
+	full := r.lastFull.IsZero() || (!r.onChange && !r.suppressRedundant) ||
+		(r.heartbeat != 0 && now.Sub(r.lastFull) >= r.heartbeat)
+	if full {
+		r.lastFull = now
+	}
+
+	current := make(map[string]telemetryLeaf)
+	for _, leaf := range selectLeaves(leaves, r.path) {
+		key := pathString(leaf.path)
+		current[key] = leaf
+		if prev, ok := r.sent[key]; full || !ok || prev.value != leaf.value {
+			updates = append(updates, leaf)
+		}
+	}
+	keys := []string{}
+	for k := range r.sent {
+		if _, ok := current[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		deletes = append(deletes, r.sent[k].path)
+	}
+	r.sent = current
+
+	return updates, deletes
+}
@@ -0,0 +1,104 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package grpcapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func portLeaf(dpid, port, leaf string, value interface{}) telemetryLeaf {
+	return telemetryLeaf{
+		path: []pathElem{
+			{name: "devices"},
+			{name: "device", keys: map[string]string{"dpid": dpid}},
+			{name: "ports"},
+			{name: "port", keys: map[string]string{"number": port}},
+			{name: "state"},
+			{name: leaf},
+		},
+		value: value,
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	leaf := portLeaf("1", "2", "oper-status", "UP")
+	if s := pathString(leaf.path); s != "/devices/device[dpid=1]/ports/port[number=2]/state/oper-status" {
+		t.Fatalf("unexpected path: %v", s)
+	}
+
+	for _, v := range []struct {
+		pattern []pathElem
+		match   bool
+	}{
+		{nil, true},
+		{[]pathElem{{name: "devices"}}, true},
+		{[]pathElem{{name: "devices"}, {name: "device", keys: map[string]string{"dpid": "1"}}}, true},
+		{[]pathElem{{name: "devices"}, {name: "device", keys: map[string]string{"dpid": "*"}}}, true},
+		{[]pathElem{{name: "devices"}, {name: "device", keys: map[string]string{"dpid": "2"}}}, false},
+		{[]pathElem{{name: "devices"}, {name: "*"}, {name: "ports"}}, true},
+		{[]pathElem{{name: "..."}, {name: "oper-status"}}, true},
+		{[]pathElem{{name: "..."}, {name: "admin-status"}}, false},
+		{[]pathElem{{name: "links"}}, false},
+	} {
+		if matchPath(v.pattern, leaf.path) != v.match {
+			t.Fatalf("unexpected match of %v: %v", pathString(v.pattern), !v.match)
+		}
+	}
+}
+
+func TestTelemetrySubscription(t *testing.T) {
+	now := time.Now()
+	up1, up2 := portLeaf("1", "1", "oper-status", "UP"), portLeaf("1", "2", "oper-status", "UP")
+	down2 := portLeaf("1", "2", "oper-status", "DOWN")
+
+	s := newTelemetrySubscription([]pathElem{{name: "devices"}}, true, 0, false, 0)
+	if updates, _ := s.changes([]telemetryLeaf{up1, up2}, now); len(updates) != 2 {
+		t.Fatalf("unexpected updates: %v", updates)
+	}
+	if updates, deletes := s.changes([]telemetryLeaf{up1, up2}, now.Add(time.Second)); len(updates) != 0 || len(deletes) != 0 {
+		t.Fatalf("unexpected changes: %v, %v", updates, deletes)
+	}
+	if updates, _ := s.changes([]telemetryLeaf{up1, down2}, now.Add(2*time.Second)); !reflect.DeepEqual(updates, []telemetryLeaf{down2}) {
+		t.Fatalf("unexpected updates: %v", updates)
+	}
+	if updates, deletes := s.changes([]telemetryLeaf{up1}, now.Add(3*time.Second)); len(updates) != 0 || !reflect.DeepEqual(deletes, [][]pathElem{down2.path}) {
+		t.Fatalf("unexpected changes: %v, %v", updates, deletes)
+	}
+
+	// Samples send all the leaves every interval.
+	s = newTelemetrySubscription([]pathElem{{name: "devices"}}, false, 5*time.Second, false, 0)
+	if !s.due(now) {
+		t.Fatal("the first sample is not due")
+	}
+	s.changes([]telemetryLeaf{up1, up2}, now)
+	if s.due(now.Add(4 * time.Second)) {
+		t.Fatal("the sample is due before the interval")
+	}
+	if !s.due(now.Add(5 * time.Second)) {
+		t.Fatal("the sample is not due after the interval")
+	}
+	if updates, _ := s.changes([]telemetryLeaf{up1, up2}, now.Add(5*time.Second)); len(updates) != 2 {
+		t.Fatalf("unexpected updates: %v", updates)
+	}
+}
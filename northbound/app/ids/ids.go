@@ -0,0 +1,336 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ids
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "IDS"
+
+var (
+	logger = logging.MustGetLogger("ids")
+)
+
+const (
+	// We use MSB of the cookie to mark the flows that should survive RemoveAllFlows().
+	flowCookie = 0x1<<63 | 0x1D5
+	// Priority of the block flows. It should be higher than the one of the L2 switching flows.
+	blockPriority = 30
+	// Default duration of the block flows.
+	defaultBlockDuration = 10 * time.Minute
+)
+
+// IDS copies the selected packet-in traffic to an IDS. The packets are
+// encapsulated in UDP datagrams that are delivered to a remote collector. The
+// encapsulation header consists of the 8-byte switch DPID and the 4-byte ingress
+// port number in network byte order.
+//
+// Note that only the packets delivered to the controller can be copied as the
+// flow actions do not support multiple outputs yet. All the packets of a port
+// can be copied to a tap port by the mirrors of the OVSDB application instead.
+type IDS struct {
+	app.BaseProcessor
+	conf      app.Config
+	selectors []*selector
+	collector *net.UDPConn
+	mutex     sync.Mutex
+	finder    network.Finder
+}
+
+func New(conf app.Config) *IDS {
+	return &IDS{conf: conf}
+}
+
+func (r *IDS) Init(ctx context.Context, s app.Services) error {
+	for _, v := range strings.Split(r.conf.GetString("selectors"), ";") {
+		if len(strings.TrimSpace(v)) == 0 {
+			continue
+		}
+		s, err := parseSelector(v)
+		if err != nil {
+			return errors.Wrap(err, "invalid ids.selectors in the config file")
+		}
+		r.selectors = append(r.selectors, s)
+	}
+
+	switch strings.ToLower(r.conf.GetString("mode")) {
+	case "port":
+		// Copying the packet-ins to a tap port misses the packets forwarded by the
+		// flows, which the IDS expects to see there.
+		return errors.New("ids.mode port is not supported: use the OVSDB mirrors to copy the packets to a tap port")
+	case "collector":
+		addr, err := net.ResolveUDPAddr("udp", r.conf.GetString("collector"))
+		if err != nil {
+			return errors.Wrap(err, "invalid ids.collector in the config file")
+		}
+		conn, err := net.DialUDP("udp", nil, addr)
+		if err != nil {
+			return errors.Wrap(err, "connecting to the IDS collector")
+		}
+		r.collector = conn
+	default:
+		return errors.New("invalid ids.mode in the config file")
+	}
+
+	return nil
+}
+
+func (r *IDS) Name() string {
+	return appName
+}
+
+func (r *IDS) String() string {
+	return fmt.Sprintf("%v: Collector=%v, Selectors=%v", r.Name(), r.collector.RemoteAddr(), len(r.selectors))
+}
+
+func (r *IDS) selected(eth *protocol.Ethernet) bool {
+	p := newPacket(eth)
+	for _, v := range r.selectors {
+		if v.matches(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *IDS) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	if r.selected(eth) {
+		if err := r.copyPacket(ingress, eth); err != nil {
+			logger.Errorf("failed to copy the packet to the IDS: %v", err)
+		}
+	}
+
+	return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+}
+
+func (r *IDS) copyPacket(ingress *network.Port, eth *protocol.Ethernet) error {
+	frame, err := eth.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	dpid, err := strconv.ParseUint(ingress.Device().ID(), 10, 64)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint64(header[0:8], dpid)
+	binary.BigEndian.PutUint32(header[8:12], ingress.Number())
+	_, err = r.collector.Write(append(header, frame...))
+
+	return err
+}
+
+func (r *IDS) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	// Remember the finder so that the REST handlers can use it.
+	r.mutex.Lock()
+	r.finder = finder
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+// Block installs the flows that drop the packets from the host specified by
+// mac and/or ip on all the switches for the duration.
+func (r *IDS) Block(mac net.HardwareAddr, ip net.IP, duration time.Duration) error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return errors.New("no connected switch")
+	}
+	for _, device := range finder.Devices() {
+		if err := installBlockFlow(device, mac, ip, duration); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("installing the block flow on %v", device.ID()))
+		}
+	}
+	event.NotifyHostQuarantined(event.Quarantine{MAC: mac, IP: ip, Duration: duration, Source: r.Name()})
+
+	return nil
+}
+
+// Pause removes the block flows from all the devices, so that the hosts blocked
+// by the IDS are released while the application is disabled.
+func (r *IDS) Pause() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder != nil {
+		removeBlockFlows(finder.Devices())
+	}
+
+	return nil
+}
+
+// Resume does nothing as the released hosts are blocked again by the next
+// verdicts of the IDS.
+func (r *IDS) Resume() error {
+	return nil
+}
+
+func removeBlockFlows(devices []*network.Device) {
+	for _, device := range devices {
+		if device.IsClosed() {
+			continue
+		}
+		f := device.Factory()
+		match, err := f.NewMatch()
+		if err != nil {
+			logger.Errorf("failed to create a match: %v", err)
+			continue
+		}
+		flow, err := f.NewFlowMod(openflow.FlowDelete)
+		if err != nil {
+			logger.Errorf("failed to create a flow mod: %v", err)
+			continue
+		}
+		flow.SetCookie(flowCookie)
+		flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+		flow.SetTableID(0xFF) // ALL
+		flow.SetFlowMatch(match)
+		if err := device.SendFlow(appName, flow); err != nil {
+			logger.Errorf("failed to remove the block flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+}
+
+func installBlockFlow(device *network.Device, mac net.HardwareAddr, ip net.IP, duration time.Duration) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	if mac != nil {
+		match.SetSrcMAC(mac)
+	}
+	if ip != nil {
+		match.SetEtherType(0x0800) // IPv4
+		match.SetSrcIP(&net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+	}
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(uint16(duration / time.Second))
+	flow.SetPriority(blockPriority)
+	flow.SetFlowMatch(match)
+	// No instruction means drop.
+
+	return device.SendFlow(appName, flow)
+}
+
+func (r *IDS) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Post("/api/v1/ids/verdict", r.addVerdict),
+	}
+}
+
+type verdictParam struct {
+	// Only "block" is supported currently.
+	Action string `json:"action"`
+	MAC    string `json:"mac"`
+	IP     string `json:"ip"`
+	// Duration in seconds. Zero means the default duration.
+	Duration uint16 `json:"duration"`
+}
+
+func (r *verdictParam) validate() (mac net.HardwareAddr, ip net.IP, duration time.Duration, err error) {
+	if strings.ToLower(r.Action) != "block" {
+		return nil, nil, 0, fmt.Errorf("unsupported action: %v", r.Action)
+	}
+	if len(r.MAC) == 0 && len(r.IP) == 0 {
+		return nil, nil, 0, errors.New("empty MAC and IP addresses")
+	}
+	if len(r.MAC) > 0 {
+		if mac, err = net.ParseMAC(r.MAC); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	if len(r.IP) > 0 {
+		if ip = net.ParseIP(r.IP).To4(); ip == nil {
+			return nil, nil, 0, fmt.Errorf("invalid IPv4 address: %v", r.IP)
+		}
+	}
+	duration = time.Duration(r.Duration) * time.Second
+	if duration == 0 {
+		duration = defaultBlockDuration
+	}
+
+	return mac, ip, duration, nil
+}
+
+func (r *IDS) addVerdict(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	param := verdictParam{}
+	if err := req.DecodeJsonPayload(&param); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	mac, ip, duration, err := param.validate()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logger.Warningf("blocking the host by the IDS verdict: MAC=%v, IP=%v, duration=%v", mac, ip, duration)
+	if err := r.Block(mac, ip, duration); err != nil {
+		logger.Errorf("failed to block the host: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
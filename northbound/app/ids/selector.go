@@ -0,0 +1,174 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ids
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/superkkt/cherry/protocol"
+)
+
+// selector chooses the packets that will be copied to the IDS. Zero (or nil)
+// fields are wildcards. The format of its string representation is a comma
+// separated list of key=value pairs, e.g., "eth_type=0x0800,ip_proto=6,dst_port=80".
+type selector struct {
+	etherType uint16
+	srcMAC    net.HardwareAddr
+	dstMAC    net.HardwareAddr
+	ipProto   uint8
+	srcIP     *net.IPNet
+	dstIP     *net.IPNet
+	srcPort   uint16
+	dstPort   uint16
+}
+
+func parseSelector(s string) (*selector, error) {
+	v := new(selector)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid selector field: %v", field)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		var err error
+		switch key {
+		case "eth_type":
+			var n uint64
+			n, err = strconv.ParseUint(value, 0, 16)
+			v.etherType = uint16(n)
+		case "src_mac":
+			v.srcMAC, err = net.ParseMAC(value)
+		case "dst_mac":
+			v.dstMAC, err = net.ParseMAC(value)
+		case "ip_proto":
+			var n uint64
+			n, err = strconv.ParseUint(value, 0, 8)
+			v.ipProto = uint8(n)
+		case "src_ip":
+			v.srcIP, err = parseCIDR(value)
+		case "dst_ip":
+			v.dstIP, err = parseCIDR(value)
+		case "src_port":
+			var n uint64
+			n, err = strconv.ParseUint(value, 0, 16)
+			v.srcPort = uint16(n)
+		case "dst_port":
+			var n uint64
+			n, err = strconv.ParseUint(value, 0, 16)
+			v.dstPort = uint16(n)
+		default:
+			return nil, fmt.Errorf("unknown selector field: %v", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector field: %v: %v", field, err)
+		}
+	}
+
+	return v, nil
+}
+
+// parseCIDR parses s as a CIDR notation, or a single IPv4 address.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		s += "/32"
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+// packet is a summary of the headers that can be selected.
+type packet struct {
+	eth     *protocol.Ethernet
+	ipProto uint8
+	srcIP   net.IP
+	dstIP   net.IP
+	srcPort uint16
+	dstPort uint16
+}
+
+func newPacket(eth *protocol.Ethernet) *packet {
+	v := &packet{eth: eth}
+	if eth.Type != 0x0800 {
+		return v
+	}
+
+	ip := new(protocol.IPv4)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+		return v
+	}
+	v.ipProto = ip.Protocol
+	v.srcIP = ip.SrcIP
+	v.dstIP = ip.DstIP
+
+	switch ip.Protocol {
+	case 6: // TCP
+		tcp := new(protocol.TCP)
+		if err := tcp.UnmarshalBinary(ip.Payload); err == nil {
+			v.srcPort, v.dstPort = tcp.SrcPort, tcp.DstPort
+		}
+	case 17: // UDP
+		udp := new(protocol.UDP)
+		if err := udp.UnmarshalBinary(ip.Payload); err == nil {
+			v.srcPort, v.dstPort = udp.SrcPort, udp.DstPort
+		}
+	}
+
+	return v
+}
+
+func (r *selector) matches(p *packet) bool {
+	if r.etherType != 0 && r.etherType != p.eth.Type {
+		return false
+	}
+	if r.srcMAC != nil && !bytes.Equal(r.srcMAC, p.eth.SrcMAC) {
+		return false
+	}
+	if r.dstMAC != nil && !bytes.Equal(r.dstMAC, p.eth.DstMAC) {
+		return false
+	}
+	if r.ipProto != 0 && r.ipProto != p.ipProto {
+		return false
+	}
+	if r.srcIP != nil && (p.srcIP == nil || !r.srcIP.Contains(p.srcIP)) {
+		return false
+	}
+	if r.dstIP != nil && (p.dstIP == nil || !r.dstIP.Contains(p.dstIP)) {
+		return false
+	}
+	if r.srcPort != 0 && r.srcPort != p.srcPort {
+		return false
+	}
+	if r.dstPort != 0 && r.dstPort != p.dstPort {
+		return false
+	}
+
+	return true
+}
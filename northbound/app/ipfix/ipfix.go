@@ -0,0 +1,371 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ipfix
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("ipfix")
+)
+
+const (
+	statsTimeout = 5 * time.Second
+	// Maximum number of the data records in a message.
+	maxRecords = 20
+)
+
+// IPFIX exports the flow records to an IPFIX collector. The records are made
+// from the periodic flow stats and the flow removed messages. The packets
+// sampled by the packet sampling of the controller are also exported as the
+// packet reports of PSAMP. Each switch is exported as an observation domain
+// whose ID is the lower 32 bits of its DPID.
+type IPFIX struct {
+	app.BaseProcessor
+	conf     app.Config
+	conn     *net.UDPConn
+	interval time.Duration
+	once     sync.Once
+	mutex    sync.Mutex
+	flows    map[string]*flowState // Key = Flow key.
+	sequence map[uint32]uint32     // Key = Observation domain ID.
+	// Whether the application has been disabled at runtime. The events are
+	// still delivered, so they should be ignored.
+	paused bool
+	// Stops the poller.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Cancel the subscriptions of the events.
+	unsubscribe []func()
+}
+
+// flowState is the counters of a flow that were exported last time.
+type flowState struct {
+	domainID uint32
+	bytes    uint64
+	packets  uint64
+	duration time.Duration
+	seen     bool
+}
+
+func New(conf app.Config) *IPFIX {
+	return &IPFIX{
+		flows:    make(map[string]*flowState),
+		sequence: make(map[uint32]uint32),
+		conf:     conf,
+	}
+}
+
+func (r *IPFIX) Init(ctx context.Context, s app.Services) error {
+	addr, err := net.ResolveUDPAddr("udp", r.conf.GetString("collector"))
+	if err != nil {
+		return errors.Wrap(err, "invalid ipfix.collector in the config file")
+	}
+	interval := r.conf.GetInt("interval")
+	if interval <= 0 {
+		return errors.New("invalid ipfix.interval in the config file")
+	}
+	r.interval = time.Duration(interval) * time.Second
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return errors.Wrap(err, "connecting to the IPFIX collector")
+	}
+	r.conn = conn
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	r.unsubscribe = []func(){
+		s.Events.Subscribe(r.onPacketSampled, network.EventPacketSampled),
+		// The FLOW_REMOVED event has the DPID of the device, which the processor
+		// chain does not pass.
+		s.Events.Subscribe(r.onFlowRemoved, network.EventFlowRemoved),
+	}
+
+	return nil
+}
+
+// Stop stops exporting the flows and the samples.
+func (r *IPFIX) Stop() {
+	for _, f := range r.unsubscribe {
+		f()
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// Pause stops exporting the flows and the samples while the application is
+// disabled.
+func (r *IPFIX) Pause() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.paused = true
+	return nil
+}
+
+// Resume starts exporting again. The traffic of the flows while the
+// application was disabled is exported by the next poll.
+func (r *IPFIX) Resume() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.paused = false
+	return nil
+}
+
+func (r *IPFIX) isPaused() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.paused
+}
+
+func (r *IPFIX) Name() string {
+	return "IPFIX"
+}
+
+func (r *IPFIX) String() string {
+	return fmt.Sprintf("%v: Collector=%v, Interval=%v", r.Name(), r.conn.RemoteAddr(), r.interval)
+}
+
+// flowKey returns the identifier of a flow of the device whose DPID is dpid.
+// The same flow is usually installed on several devices along its path.
+func flowKey(dpid uint64, tableID uint8, priority uint16, cookie uint64, match openflow.Match) (string, error) {
+	m, err := match.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v/%v/%v/%v/%v", dpid, tableID, priority, cookie, hex.EncodeToString(m)), nil
+}
+
+func (r *IPFIX) send(domainID uint32, records []record) error {
+	v := make([][]byte, len(records))
+	for i := range records {
+		v[i] = records[i].marshal()
+	}
+
+	return r.sendSet(domainID, templateID, v)
+}
+
+// sendSet sends the data records of the template setID.
+func (r *IPFIX) sendSet(domainID uint32, setID uint16, records [][]byte) error {
+	for len(records) > 0 {
+		n := len(records)
+		if n > maxRecords {
+			n = maxRecords
+		}
+
+		r.mutex.Lock()
+		sequence := r.sequence[domainID]
+		r.sequence[domainID] = sequence + uint32(n)
+		r.mutex.Unlock()
+
+		if _, err := r.conn.Write(makeMessage(domainID, sequence, setID, records[:n])); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+
+	return nil
+}
+
+func (r *IPFIX) onPacketSampled(e event.Event) {
+	v, ok := e.Data.(network.PacketSample)
+	if !ok || r.isPaused() {
+		return
+	}
+	sample := sampleRecord{
+		timestamp:   e.Timestamp,
+		inPort:      v.Port,
+		probability: 1 / float64(v.Rate),
+		frameLength: v.Length,
+		frame:       v.Frame,
+	}
+	if err := r.sendSet(uint32(v.DPID), sampleTemplateID, [][]byte{sample.marshal()}); err != nil {
+		logger.Errorf("failed to export the packet sample: %v", err)
+	}
+}
+
+func (r *IPFIX) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	r.once.Do(func() {
+		go r.poller(r.ctx, finder)
+	})
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *IPFIX) poller(ctx context.Context, finder network.Finder) {
+	logger.Debug("executed flow stats poller")
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if r.isPaused() {
+			continue
+		}
+
+		r.mutex.Lock()
+		for _, v := range r.flows {
+			v.seen = false
+		}
+		r.mutex.Unlock()
+
+		for _, device := range finder.Devices() {
+			if err := r.export(device); err != nil {
+				logger.Errorf("failed to export the flow records of %v: %v", device.ID(), err)
+				// Keep the counters of the device, otherwise the next poll
+				// exports the whole counters again as the new traffic.
+				r.keep(device.ID())
+				continue
+			}
+		}
+
+		// Remove the flows that do not exist anymore.
+		r.mutex.Lock()
+		for k, v := range r.flows {
+			if !v.seen {
+				delete(r.flows, k)
+			}
+		}
+		r.mutex.Unlock()
+	}
+}
+
+func (r *IPFIX) export(device *network.Device) error {
+	dpid, err := strconv.ParseUint(device.ID(), 10, 64)
+	if err != nil {
+		return err
+	}
+	domainID := uint32(dpid)
+
+	match, err := device.Factory().NewMatch()
+	if err != nil {
+		return err
+	}
+	stats, err := device.FlowStats(match, statsTimeout)
+	if err != nil {
+		return err
+	}
+
+	records := make([]record, 0)
+	for _, v := range stats {
+		key, err := flowKey(dpid, v.TableID, v.Priority, v.Cookie, v.Match)
+		if err != nil {
+			continue
+		}
+		duration := time.Duration(v.DurationSec)*time.Second + time.Duration(v.DurationNanoSec)
+		if rec, ok := r.update(key, domainID, v.ByteCount, v.PacketCount, duration); ok {
+			records = append(records, newRecord(v.Match, rec.bytes, rec.packets, rec.duration))
+		}
+	}
+
+	return r.send(domainID, records)
+}
+
+// keep marks the flows of the device whose ID is id as seen.
+func (r *IPFIX) keep(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prefix := id + "/"
+	for k, v := range r.flows {
+		if strings.HasPrefix(k, prefix) {
+			v.seen = true
+		}
+	}
+}
+
+// update updates the counters of the flow, and then returns the delta from the
+// last export. ok will be false if there is no new traffic.
+func (r *IPFIX) update(key string, domainID uint32, bytes, packets uint64, duration time.Duration) (delta flowState, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prev, exist := r.flows[key]
+	if !exist || bytes < prev.bytes || packets < prev.packets {
+		// New flow, or the flow has been re-installed.
+		prev = &flowState{}
+	}
+	delta = flowState{
+		domainID: domainID,
+		bytes:    bytes - prev.bytes,
+		packets:  packets - prev.packets,
+		duration: duration,
+	}
+	r.flows[key] = &flowState{domainID: domainID, bytes: bytes, packets: packets, duration: duration, seen: true}
+
+	return delta, delta.packets > 0
+}
+
+func (r *IPFIX) onFlowRemoved(e event.Event) {
+	v, ok := e.Data.(network.FlowRemovedEvent)
+	if !ok || v.Message == nil || r.isPaused() {
+		return
+	}
+	if err := r.exportRemoved(v.DPID, v.Message); err != nil {
+		logger.Errorf("failed to export the flow record of the removed flow: %v", err)
+	}
+}
+
+func (r *IPFIX) exportRemoved(dpid uint64, flow openflow.FlowRemoved) error {
+	key, err := flowKey(dpid, flow.TableID(), flow.Priority(), flow.Cookie(), flow.Match())
+	if err != nil {
+		return err
+	}
+	domainID := uint32(dpid)
+
+	duration := time.Duration(flow.DurationSec())*time.Second + time.Duration(flow.DurationNanoSec())
+	delta, ok := r.update(key, domainID, flow.ByteCount(), flow.PacketCount(), duration)
+
+	r.mutex.Lock()
+	delete(r.flows, key)
+	r.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return r.send(domainID, []record{newRecord(flow.Match(), delta.bytes, delta.packets, delta.duration)})
+}
@@ -0,0 +1,58 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ipfix
+
+import (
+	"net"
+	"testing"
+
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+func TestFlowStatePerDevice(t *testing.T) {
+	match, err := of13.NewFactory().NewMatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	match.SetDstMAC(net.HardwareAddr{0, 0, 0, 0, 0, 1})
+	r := New(nil)
+
+	// The same flow on two devices has its own counters.
+	k1, _ := flowKey(1, 0, 10, 7, match)
+	k2, _ := flowKey(2, 0, 10, 7, match)
+	r.update(k1, 1, 1000, 10, 0)
+	if delta, _ := r.update(k2, 2, 500, 5, 0); delta.packets != 5 {
+		t.Fatalf("unexpected delta of device 2: %+v", delta)
+	}
+	if delta, _ := r.update(k1, 1, 1500, 15, 0); delta.packets != 5 || delta.bytes != 500 {
+		t.Fatalf("unexpected delta of device 1: %+v", delta)
+	}
+
+	// The flows of a device whose poll has failed are kept.
+	for _, v := range r.flows {
+		v.seen = false
+	}
+	r.keep("1")
+	if !r.flows[k1].seen || r.flows[k2].seen {
+		t.Fatal("unexpected flows kept")
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+// IPFIX (RFC 7011)
+const (
+	ipfixVersion     = 10
+	templateSetID    = 2
+	templateID       = 256
+	sampleTemplateID = 257
+)
+
+// Information elements of our template (RFC 5102).
+var templateFields = []struct {
+	id, length uint16
+}{
+	{8, 4},   // sourceIPv4Address
+	{12, 4},  // destinationIPv4Address
+	{7, 2},   // sourceTransportPort
+	{11, 2},  // destinationTransportPort
+	{4, 1},   // protocolIdentifier
+	{56, 6},  // sourceMacAddress
+	{80, 6},  // destinationMacAddress
+	{256, 2}, // ethernetType
+	{10, 4},  // ingressInterface
+	{1, 8},   // octetDeltaCount
+	{2, 8},   // packetDeltaCount
+	{161, 4}, // flowDurationMilliseconds
+}
+
+// Length of a data record of our template.
+const recordLength = 4 + 4 + 2 + 2 + 1 + 6 + 6 + 2 + 4 + 8 + 8 + 4
+
+// Information elements of our template of the packet samples (RFC 5477).
+var sampleTemplateFields = []struct {
+	id, length uint16
+}{
+	{323, 8},      // observationTimeMilliseconds
+	{10, 4},       // ingressInterface
+	{311, 8},      // samplingProbability
+	{312, 2},      // dataLinkFrameSize
+	{315, 0xFFFF}, // dataLinkFrameSection (variable length)
+}
+
+// Maximum number of the bytes of a sampled frame in a data record, which is
+// shorter than 255 to encode its length in a byte.
+const maxFrameSection = 128
+
+type record struct {
+	srcIP, dstIP     net.IP
+	srcPort, dstPort uint16
+	protocol         uint8
+	srcMAC, dstMAC   net.HardwareAddr
+	etherType        uint16
+	inPort           uint32
+	bytes, packets   uint64
+	duration         time.Duration
+}
+
+// newRecord makes a record from the flow match fields. Wildcard fields are filled with zeros.
+func newRecord(match openflow.Match, bytes, packets uint64, duration time.Duration) record {
+	v := record{
+		bytes:    bytes,
+		packets:  packets,
+		duration: duration,
+	}
+	if ip := match.SrcIP(); ip != nil {
+		v.srcIP = ip.IP
+	}
+	if ip := match.DstIP(); ip != nil {
+		v.dstIP = ip.IP
+	}
+	if wildcard, port := match.SrcPort(); !wildcard {
+		v.srcPort = port
+	}
+	if wildcard, port := match.DstPort(); !wildcard {
+		v.dstPort = port
+	}
+	if wildcard, proto := match.IPProtocol(); !wildcard {
+		v.protocol = proto
+	}
+	if wildcard, mac := match.SrcMAC(); !wildcard {
+		v.srcMAC = mac
+	}
+	if wildcard, mac := match.DstMAC(); !wildcard {
+		v.dstMAC = mac
+	}
+	if wildcard, t := match.EtherType(); !wildcard {
+		v.etherType = t
+	}
+	if wildcard, port := match.InPort(); !wildcard {
+		v.inPort = port.Value()
+	}
+
+	return v
+}
+
+func (r *record) marshal() []byte {
+	v := make([]byte, recordLength)
+	if ip := r.srcIP.To4(); ip != nil {
+		copy(v[0:4], ip)
+	}
+	if ip := r.dstIP.To4(); ip != nil {
+		copy(v[4:8], ip)
+	}
+	binary.BigEndian.PutUint16(v[8:10], r.srcPort)
+	binary.BigEndian.PutUint16(v[10:12], r.dstPort)
+	v[12] = r.protocol
+	copy(v[13:19], r.srcMAC)
+	copy(v[19:25], r.dstMAC)
+	binary.BigEndian.PutUint16(v[25:27], r.etherType)
+	binary.BigEndian.PutUint32(v[27:31], r.inPort)
+	binary.BigEndian.PutUint64(v[31:39], r.bytes)
+	binary.BigEndian.PutUint64(v[39:47], r.packets)
+	binary.BigEndian.PutUint32(v[47:51], uint32(r.duration/time.Millisecond))
+
+	return v
+}
+
+type sampleRecord struct {
+	timestamp   time.Time
+	inPort      uint32
+	probability float64
+	frameLength uint16
+	frame       []byte
+}
+
+func (r *sampleRecord) marshal() []byte {
+	frame := r.frame
+	if len(frame) > maxFrameSection {
+		frame = frame[:maxFrameSection]
+	}
+
+	v := make([]byte, 23, 23+len(frame))
+	binary.BigEndian.PutUint64(v[0:8], uint64(r.timestamp.UnixNano()/int64(time.Millisecond)))
+	binary.BigEndian.PutUint32(v[8:12], r.inPort)
+	binary.BigEndian.PutUint64(v[12:20], math.Float64bits(r.probability))
+	binary.BigEndian.PutUint16(v[20:22], r.frameLength)
+	v[22] = uint8(len(frame))
+
+	return append(v, frame...)
+}
+
+func makeTemplateSet() []byte {
+	v := make([]byte, 4, 4+8+len(templateFields)*4+len(sampleTemplateFields)*4)
+	binary.BigEndian.PutUint16(v[0:2], templateSetID)
+	v = appendTemplate(v, templateID, templateFields)
+	v = appendTemplate(v, sampleTemplateID, sampleTemplateFields)
+	binary.BigEndian.PutUint16(v[2:4], uint16(len(v)))
+
+	return v
+}
+
+func appendTemplate(set []byte, id uint16, fields []struct{ id, length uint16 }) []byte {
+	v := make([]byte, 4+len(fields)*4)
+	binary.BigEndian.PutUint16(v[0:2], id)
+	binary.BigEndian.PutUint16(v[2:4], uint16(len(fields)))
+	for i, f := range fields {
+		binary.BigEndian.PutUint16(v[4+i*4:6+i*4], f.id)
+		binary.BigEndian.PutUint16(v[6+i*4:8+i*4], f.length)
+	}
+
+	return append(set, v...)
+}
+
+// makeMessage makes an IPFIX message that has the template set and a data set
+// of the records of the template setID. sequence is the number of the data
+// records sent before this message.
+func makeMessage(domainID, sequence uint32, setID uint16, records [][]byte) []byte {
+	template := makeTemplateSet()
+
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:2], setID)
+	for _, r := range records {
+		data = append(data, r...)
+	}
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+
+	v := make([]byte, 16, 16+len(template)+len(data))
+	binary.BigEndian.PutUint16(v[0:2], ipfixVersion)
+	binary.BigEndian.PutUint16(v[2:4], uint16(16+len(template)+len(data)))
+	binary.BigEndian.PutUint32(v[4:8], uint32(time.Now().Unix()))
+	binary.BigEndian.PutUint32(v[8:12], sequence)
+	binary.BigEndian.PutUint32(v[12:16], domainID)
+	v = append(v, template...)
+
+	return append(v, data...)
+}
@@ -0,0 +1,252 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package journal records the significant events, such as the device and port
+// status changes, the host movements, and the alarms, into the database, so
+// that an outage can be reconstructed after the fact.
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("journal")
+)
+
+const (
+	defaultRetention = 30 * 24 * time.Hour
+	pruneInterval    = 1 * time.Hour
+	queueSize        = 4096
+	maxBatchSize     = 256
+	defaultLimit     = 100
+	maxLimit         = 1000
+)
+
+type database interface {
+	// AddJournal records the entries. Their IDs are ignored.
+	AddJournal([]Entry) error
+	// Journal returns the entries recorded at or after since, whose type is
+	// eventType, in descending order of their IDs. Zero since and empty
+	// eventType match all the entries.
+	Journal(since time.Time, eventType string, limit uint16) ([]Entry, error)
+	// RemoveJournal removes the entries recorded before t, and then returns the number of the removed entries.
+	RemoveJournal(before time.Time) (n int64, err error)
+}
+
+type Entry struct {
+	ID        uint64    `json:"id"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Journal struct {
+	app.BaseProcessor
+	conf      app.Config
+	db        database
+	retention time.Duration // Zero means that the entries are never removed.
+	queue     chan Entry
+	// Cancels the subscription of the events.
+	unsubscribe func()
+}
+
+func New(db database, conf app.Config) *Journal {
+	return &Journal{
+		db:    db,
+		queue: make(chan Entry, queueSize),
+		conf:  conf,
+	}
+}
+
+func (r *Journal) Init(ctx context.Context, s app.Services) error {
+	r.retention = defaultRetention
+	if r.conf.IsSet("retention") {
+		days := r.conf.GetInt("retention")
+		if days < 0 {
+			return errors.New("invalid journal.retention in the config file")
+		}
+		r.retention = time.Duration(days) * 24 * time.Hour
+	}
+
+	go r.writer()
+	if r.retention > 0 {
+		go r.pruner(ctx)
+	}
+	r.unsubscribe = s.Events.Subscribe(r.onEvent)
+
+	return nil
+}
+
+// Stop stops recording the events.
+func (r *Journal) Stop() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+}
+
+func (r *Journal) Name() string {
+	return "Journal"
+}
+
+func (r *Journal) String() string {
+	return fmt.Sprintf("%v (retention=%v)", r.Name(), r.retention)
+}
+
+// record queues a new entry. It never blocks: the entry is dropped if the queue is full.
+func (r *Journal) record(t, msg string, timestamp time.Time) {
+	select {
+	case r.queue <- Entry{Type: t, Message: msg, Timestamp: timestamp}:
+	default:
+		logger.Warningf("dropping a journal entry due to the full queue: type=%v, message=%v", t, msg)
+	}
+}
+
+func (r *Journal) onEvent(e event.Event) {
+	// The flows are removed by their idle timeouts all the time, and the packets are sampled all the time,
+	// so that they are not significant.
+	if e.Type == network.EventFlowRemoved || e.Type == network.EventPacketSampled {
+		return
+	}
+	r.record(string(e.Type), message(e.Data), e.Timestamp)
+}
+
+// message returns the human readable description of v.
+func message(v interface{}) string {
+	switch m := v.(type) {
+	case nil:
+		return ""
+	case event.Alarm:
+		return fmt.Sprintf("%v: %v", m.Subject, m.Body)
+	case fmt.Stringer:
+		return m.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+
+	return string(b)
+}
+
+// writer writes the queued entries into the database in batches.
+func (r *Journal) writer() {
+	for e := range r.queue {
+		batch := []Entry{e}
+	drain:
+		for len(batch) < maxBatchSize {
+			select {
+			case v := <-r.queue:
+				batch = append(batch, v)
+			default:
+				break drain
+			}
+		}
+		if err := r.db.AddJournal(batch); err != nil {
+			logger.Errorf("failed to record %v journal entries: %v", len(batch), err)
+		}
+	}
+}
+
+func (r *Journal) pruner(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.db.RemoveJournal(time.Now().Add(-r.retention))
+		if err != nil {
+			logger.Errorf("failed to remove the old journal entries: %v", err)
+		} else if n > 0 {
+			logger.Infof("removed %v journal entries older than %v", n, r.retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Journal) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/api/v1/journal", r.listJournal),
+	}
+}
+
+// listJournal returns the recent entries. The query parameters are since (RFC
+// 3339 time), type, and limit (default 100, max 1000).
+func (r *Journal) listJournal(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query := req.URL.Query()
+	var since time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid since"))
+			return
+		}
+		since = t
+	}
+	limit := uint64(defaultLimit)
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || n == 0 || n > maxLimit {
+			writeError(w, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	entries, err := r.db.Journal(since, query.Get("type"), uint16(limit))
+	if err != nil {
+		logger.Errorf("failed to query the journal: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+
+	w.WriteJson(&struct {
+		Entries []Entry `json:"entries"`
+	}{entries})
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
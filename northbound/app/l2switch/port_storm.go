@@ -0,0 +1,119 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package l2switch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/openflow"
+)
+
+// portStormMonitor counts the broadcast and unknown-unicast packet-ins per
+// ingress port, and blocks the port for a while if its rate exceeds the threshold.
+type portStormMonitor struct {
+	mutex     sync.Mutex
+	threshold uint // Packets per second.
+	duration  time.Duration
+	counters  map[string]*portCounter // Key = Port ID.
+}
+
+type portCounter struct {
+	start   time.Time
+	count   uint
+	blocked time.Time // Expiration of the block. Zero means not blocked.
+}
+
+func newPortStormMonitor(threshold uint, duration time.Duration) *portStormMonitor {
+	return &portStormMonitor{
+		threshold: threshold,
+		duration:  duration,
+		counters:  make(map[string]*portCounter),
+	}
+}
+
+// exceeded increases the counter of port, and then returns true if the port should be blocked now.
+func (r *portStormMonitor) exceeded(port *network.Port) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	c, ok := r.counters[port.ID()]
+	if !ok {
+		c = &portCounter{start: now}
+		r.counters[port.ID()] = c
+	}
+	// Reset the counter every second.
+	if now.Sub(c.start) > 1*time.Second {
+		c.start = now
+		c.count = 0
+	}
+	c.count++
+
+	if c.count <= r.threshold || now.Before(c.blocked) {
+		return false
+	}
+	c.blocked = now.Add(r.duration)
+
+	return true
+}
+
+func (r *portStormMonitor) remove(port *network.Port) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.counters, port.ID())
+}
+
+// block installs a temporary flow that drops all packets from port, and then raises an alarm.
+func (r *portStormMonitor) block(port *network.Port) error {
+	logger.Warningf("broadcast storm detected: port=%v, threshold=%v/s, blocking for %v", port.ID(), r.threshold, r.duration)
+	event.RaisePortAlarm(port.Device().Features().DPID, port.Number(), "Cherry: broadcast storm detected!",
+		fmt.Sprintf("DPID: %v\r\nPort: %v\r\nThreshold: %v packets/s\r\nBlocked for %v", port.Device().ID(), port.Number(), r.threshold, r.duration))
+
+	device := port.Device()
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(port.Number())
+	match.SetInPort(inPort)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetTableID(device.FlowTableID())
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(uint16(r.duration / time.Second))
+	// Higher than the ARP sender flow not to receive ARP storms.
+	flow.SetPriority(200)
+	flow.SetFlowMatch(match)
+	// No instruction means drop.
+
+	return device.SendFlow(appName, flow)
+}
@@ -32,7 +32,7 @@ import (
 func TestStorm(t *testing.T) {
 	max := uint(100)
 	dummy := new(dummyFlooder)
-	storm := newStormController(max, new(dummyLogger), dummy)
+	storm := newStormController(max, dummy)
 	fmt.Printf("%v\n", time.Now())
 	for i := uint(0); i < max; i++ {
 		storm.broadcast(nil, nil)
@@ -60,7 +60,7 @@ func TestStorm(t *testing.T) {
 func TestPeriodicBroadcast(t *testing.T) {
 	max := uint(1)
 	dummy := new(dummyFlooder)
-	storm := newStormController(max, new(dummyLogger), dummy)
+	storm := newStormController(max, dummy)
 	for i := 0; i < 10; i++ {
 		fmt.Printf("Count: %v, Timestamp: %v\n", i, time.Now())
 		storm.broadcast(nil, nil)
@@ -74,7 +74,7 @@ func TestPeriodicBroadcast(t *testing.T) {
 func TestPeriodicStorm(t *testing.T) {
 	max := uint(1)
 	dummy := new(dummyFlooder)
-	storm := newStormController(max, new(dummyLogger), dummy)
+	storm := newStormController(max, dummy)
 	for i := 0; i < 10; i++ {
 		fmt.Printf("Count: %v, Timestamp: %v\n", i, time.Now())
 		storm.broadcast(nil, nil)
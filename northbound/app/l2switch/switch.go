@@ -23,6 +23,7 @@ package l2switch
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"strconv"
@@ -36,18 +37,21 @@ import (
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/pkg/errors"
 	"github.com/superkkt/go-logging"
-	"github.com/superkkt/viper"
 )
 
+const appName = "L2Switch"
+
 var (
 	logger = logging.MustGetLogger("l2switch")
 )
 
 type L2Switch struct {
 	app.BaseProcessor
+	conf      app.Config
 	vlanID    uint16
 	cache     *flowCache
 	stormCtrl *stormController
+	portStorm *portStormMonitor
 	db        Database
 }
 
@@ -96,11 +100,12 @@ type Database interface {
 	RemoveFlow(flowID uint64) error
 }
 
-func New(db Database) *L2Switch {
+func New(db Database, conf app.Config) *L2Switch {
 	return &L2Switch{
 		cache:     newFlowCache(),
 		stormCtrl: newStormController(100, new(flooder)),
 		db:        db,
+		conf:      conf,
 	}
 }
 
@@ -111,18 +116,52 @@ func (r *flooder) flood(ingress *network.Port, packet []byte) error {
 	return ingress.Device().Flood(ingress, packet)
 }
 
-func (r *L2Switch) Init() error {
-	vlanID := viper.GetInt("default.vlan_id")
+func (r *L2Switch) Init(ctx context.Context, s app.Services) error {
+	vlanID := r.conf.Defaults().GetInt("vlan_id")
 	if vlanID < 0 || vlanID > 4095 {
 		return errors.New("invalid default VLAN ID in the config file")
 	}
 	r.vlanID = uint16(vlanID)
 
+	threshold := r.conf.GetInt("storm_threshold")
+	if threshold < 0 {
+		return errors.New("invalid l2switch.storm_threshold in the config file")
+	}
+	duration := r.conf.GetInt("storm_block_duration")
+	if duration < 0 || duration > 0xFFFF {
+		return errors.New("invalid l2switch.storm_block_duration in the config file")
+	}
+	if duration == 0 {
+		duration = 30
+	}
+	// Zero threshold disables the per-port storm monitor.
+	if threshold > 0 {
+		r.portStorm = newPortStormMonitor(uint(threshold), time.Duration(duration)*time.Second)
+	}
+
 	return nil
 }
 
+// checkStorm returns true if the broadcast or unknown-unicast packet-in from
+// ingress should be dropped due to the broadcast storm.
+func (r *L2Switch) checkStorm(finder network.Finder, ingress *network.Port) bool {
+	if r.portStorm == nil || !r.portStorm.exceeded(ingress) {
+		return false
+	}
+	// Ports between switches are not blocked not to partition the network.
+	if finder.IsEdge(ingress) {
+		logger.Warningf("broadcast storm detected on the port between switches: %v", ingress.ID())
+		return false
+	}
+	if err := r.portStorm.block(ingress); err != nil {
+		logger.Errorf("failed to block the port: %v", err)
+	}
+
+	return true
+}
+
 func (r *L2Switch) Name() string {
-	return "L2Switch"
+	return appName
 }
 
 func isBroadcast(eth *protocol.Ethernet) bool {
@@ -143,18 +182,43 @@ func (r *flowParam) String() string {
 		r.device.ID(), r.etherType, r.inPort, r.outPort, r.srcMAC, r.dstMAC)
 }
 
-func (r *L2Switch) installFlow(p flowParam) error {
-	// Skip the installation if p is already installed
-	if r.cache.exist(p) {
-		logger.Debugf("skipping duplicated flow installation: deviceID=%v, dstMAC=%v, outPort=%v",
-			p.device.ID(), p.dstMAC, p.outPort)
-		return nil
+// installFlows installs the flows of params, which are the hops of a path toward
+// the same destination, with a single barrier per device.
+func (r *L2Switch) installFlows(params []flowParam) error {
+	batch := network.NewFlowBatch()
+	batch.SetApp(appName)
+	added := make([]flowParam, 0, len(params))
+	for _, p := range params {
+		// Skip the installation if p is already installed
+		if r.cache.exist(p) {
+			logger.Debugf("skipping duplicated flow installation: deviceID=%v, dstMAC=%v, outPort=%v",
+				p.device.ID(), p.dstMAC, p.outPort)
+			continue
+		}
+		flow, err := r.newFlow(p)
+		if err != nil {
+			return err
+		}
+		batch.Add(p.device, flow)
+		added = append(added, p)
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	for _, p := range added {
+		r.cache.add(p)
+		logger.Debugf("installed a flow rule: %v", &p)
 	}
 
+	return nil
+}
+
+func (r *L2Switch) newFlow(p flowParam) (openflow.FlowMod, error) {
 	f := p.device.Factory()
 	match, err := f.NewMatch()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	match.SetVLANID(r.vlanID)
 	match.SetDstMAC(p.dstMAC)
@@ -163,18 +227,18 @@ func (r *L2Switch) installFlow(p flowParam) error {
 	outPort.SetValue(p.outPort)
 	action, err := f.NewAction()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	action.SetOutPort(outPort)
 	inst, err := f.NewInstruction()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	inst.ApplyAction(action)
 
 	flow, err := f.NewFlowMod(openflow.FlowAdd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	flow.SetCookie(r.getFlowID(p))
 	flow.SetTableID(p.device.FlowTableID())
@@ -183,24 +247,16 @@ func (r *L2Switch) installFlow(p flowParam) error {
 	flow.SetFlowMatch(match)
 	flow.SetFlowInstruction(inst)
 
-	if err := p.device.SendMessage(flow); err != nil {
-		return err
-	}
-	barrier, err := f.NewBarrierRequest()
-	if err != nil {
-		return err
-	}
-	if err := p.device.SendMessage(barrier); err != nil {
-		return err
-	}
-
-	r.cache.add(p)
-	logger.Debugf("added a flow cache entry: deviceID=%v, dstMAC=%v, outPort=%v", p.device.ID(), p.dstMAC, p.outPort)
-
-	return nil
+	return flow, nil
 }
 
 func (r *L2Switch) getFlowID(p flowParam) uint64 {
+	// The flow is not installed in the dry run, so no FLOW_REMOVED would
+	// remove it from the database.
+	if p.device.IsDryRun(appName) {
+		return 0
+	}
+
 	dpid, err := strconv.ParseUint(p.device.ID(), 10, 64)
 	if err != nil {
 		logger.Errorf("failed to parse the switch DPID: %v", err)
@@ -219,30 +275,48 @@ func (r *L2Switch) getFlowID(p flowParam) uint64 {
 }
 
 type switchParam struct {
-	finder    network.Finder
-	ethernet  *protocol.Ethernet
-	ingress   *network.Port
-	egress    *network.Port
+	finder   network.Finder
+	ethernet *protocol.Ethernet
+	ingress  *network.Port
+	// path is the links from the ingress device to the device of dst, which
+	// is empty if they are the same device.
+	path      [][2]*network.Port
+	dst       *network.Port
 	rawPacket []byte
 }
 
 func (r *L2Switch) switching(p switchParam) error {
-	param := flowParam{
-		device:    p.ingress.Device(),
-		etherType: p.ethernet.Type,
-		inPort:    p.ingress.Number(),
-		outPort:   p.egress.Number(),
-		srcMAC:    p.ethernet.SrcMAC,
-		dstMAC:    p.ethernet.DstMAC,
-	}
-	if err := r.installFlow(param); err != nil {
+	// The flows along the whole path are installed at once, so that the packets
+	// do not come back to us from each hop of the path.
+	params := make([]flowParam, 0, len(p.path)+1)
+	ingress := p.ingress
+	for _, v := range p.path {
+		params = append(params, newFlowParam(p.ethernet, ingress, v[0]))
+		ingress = v[1]
+	}
+	params = append(params, newFlowParam(p.ethernet, ingress, p.dst))
+	if err := r.installFlows(params); err != nil {
 		return err
 	}
-	logger.Debugf("installed a flow rule: %v", param)
 
+	egress := p.dst
+	if len(p.path) > 0 {
+		egress = p.path[0][0]
+	}
 	// Send this ethernet packet directly to the destination node
-	logger.Debugf("sending a packet (Src=%v, Dst=%v) to egress port %v..", p.ethernet.SrcMAC, p.ethernet.DstMAC, p.egress.ID())
-	return r.PacketOut(p.egress, p.rawPacket)
+	logger.Debugf("sending a packet (Src=%v, Dst=%v) to egress port %v..", p.ethernet.SrcMAC, p.ethernet.DstMAC, egress.ID())
+	return r.PacketOut(egress, p.rawPacket)
+}
+
+func newFlowParam(eth *protocol.Ethernet, ingress, egress *network.Port) flowParam {
+	return flowParam{
+		device:    egress.Device(),
+		etherType: eth.Type,
+		inPort:    ingress.Number(),
+		outPort:   egress.Number(),
+		srcMAC:    eth.SrcMAC,
+		dstMAC:    eth.DstMAC,
+	}
 }
 
 func (r *L2Switch) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
@@ -264,6 +338,9 @@ func (r *L2Switch) processPacket(finder network.Finder, ingress *network.Port, e
 
 	// Broadcast?
 	if isBroadcast(eth) {
+		if r.checkStorm(finder, ingress) {
+			return true, nil
+		}
 		logger.Debugf("broadcasting.. SrcMAC=%v, DstMAC=%v", eth.SrcMAC, eth.DstMAC)
 		return true, r.stormCtrl.broadcast(ingress, packet)
 	}
@@ -275,6 +352,9 @@ func (r *L2Switch) processPacket(finder network.Finder, ingress *network.Port, e
 	}
 	if status != network.LocationDiscovered {
 		if status == network.LocationUndiscovered {
+			if r.checkStorm(finder, ingress) {
+				return true, nil
+			}
 			// Broadcast!
 			logger.Debugf("undiscovered node! broadcasting.. SrcMAC=%v, DstMAC=%v", eth.SrcMAC, eth.DstMAC)
 			return true, ingress.Device().Flood(ingress, packet)
@@ -295,17 +375,15 @@ func (r *L2Switch) processPacket(finder network.Finder, ingress *network.Port, e
 		return true, nil
 	}
 
-	param := switchParam{}
+	param := switchParam{
+		finder:    finder,
+		ethernet:  eth,
+		ingress:   ingress,
+		dst:       dstNode.Port(),
+		rawPacket: packet,
+	}
 	// Check whether src and dst nodes reside on a same switch device
-	if ingress.Device().ID() == dstNode.Port().Device().ID() {
-		param = switchParam{
-			finder:    finder,
-			ethernet:  eth,
-			ingress:   ingress,
-			egress:    dstNode.Port(),
-			rawPacket: packet,
-		}
-	} else {
+	if ingress.Device().ID() != dstNode.Port().Device().ID() {
 		path := finder.Path(ingress.Device().ID(), dstNode.Port().Device().ID())
 		if len(path) == 0 {
 			logger.Debugf("empty path.. dropping SrcMAC=%v, DstMAC=%v", eth.SrcMAC, eth.DstMAC)
@@ -317,14 +395,7 @@ func (r *L2Switch) processPacket(finder network.Finder, ingress *network.Port, e
 			logger.Debugf("ignore routing path that goes back to the ingress port (SrcMAC=%v, DstMAC=%v)", eth.SrcMAC, eth.DstMAC)
 			return true, nil
 		}
-
-		param = switchParam{
-			finder:    finder,
-			ethernet:  eth,
-			ingress:   ingress,
-			egress:    egress,
-			rawPacket: packet,
-		}
+		param.path = path
 	}
 
 	return true, r.switching(param)
@@ -363,6 +434,9 @@ func (r *L2Switch) String() string {
 
 func (r *L2Switch) OnPortDown(finder network.Finder, port *network.Port) error {
 	logger.Debugf("port down! removing all flows heading to that port (%v)..", port.ID())
+	if r.portStorm != nil {
+		r.portStorm.remove(port)
+	}
 
 	device := port.Device()
 	factory := device.Factory()
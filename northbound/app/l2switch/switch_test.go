@@ -0,0 +1,154 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package l2switch
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/emulator"
+)
+
+// networkDatabase is the database of network.Controller. Only the methods
+// called while a switch connects are implemented by testNetworkDB.
+type networkDatabase interface {
+	AddHost(network.HostParam) (hostID uint64, err error)
+	AddNetwork(net.IP, net.IPMask) (netID uint64, err error)
+	AddSwitch(network.SwitchParam) (swID uint64, err error)
+	AddVIP(network.VIPParam) (id uint64, cidr string, err error)
+	Host(hostID uint64) (host network.Host, ok bool, err error)
+	Hosts(limit, offset uint8) ([]network.Host, error)
+	IPAddrs(networkID uint64) ([]network.IP, error)
+	Location(mac net.HardwareAddr) (dpid string, port uint32, status network.LocationStatus, err error)
+	Network(net.IP) (n network.Network, ok bool, err error)
+	Networks(limit, offset uint8) ([]network.Network, error)
+	RemoveHost(id uint64) (ok bool, err error)
+	RemoveNetwork(id uint64) (ok bool, err error)
+	RemoveSwitch(id uint64) (ok bool, err error)
+	RemoveSwitchAlias(dpid uint64) (ok bool, err error)
+	RemoveVIP(id uint64) (ok bool, err error)
+	SetSwitchAlias(network.SwitchAlias) error
+	Switch(dpid uint64) (sw network.Switch, ok bool, err error)
+	SwitchAliases() ([]network.SwitchAlias, error)
+	Switches(limit, offset uint8) ([]network.Switch, error)
+	SwitchPorts(switchID uint64) ([]network.SwitchPort, error)
+	ToggleVIP(id uint64) (net.IP, net.HardwareAddr, error)
+	VIPs(limit, offset uint8) ([]network.VIP, error)
+	MaintenanceWindows() ([]network.MaintenanceWindow, error)
+	AddMaintenanceWindow(network.MaintenanceWindow) (id uint64, err error)
+	RemoveMaintenanceWindow(id uint64) (ok bool, err error)
+}
+
+type testNetworkDB struct {
+	networkDatabase
+}
+
+func (r *testNetworkDB) SwitchAliases() ([]network.SwitchAlias, error) {
+	return nil, nil
+}
+
+// testDB counts the flows added by L2Switch.
+type testDB struct {
+	mutex sync.Mutex
+	flows uint64
+}
+
+func (r *testDB) AddFlow(swDPID uint64, dstMAC net.HardwareAddr, outPort uint32) (uint64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.flows++
+	return r.flows, nil
+}
+
+func (r *testDB) RemoveFlow(flowID uint64) error {
+	return nil
+}
+
+func (r *testDB) count() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.flows
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout: %v", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInstallFlowsDryRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	controller := network.NewController(new(testNetworkDB))
+	controller.SetMaster(true)
+	controller.SetEventListener(new(app.BaseProcessor))
+	sw, err := emulator.New(emulator.Config{DPID: 1, Version: openflow.OF13_VERSION, Ports: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := net.Pipe()
+	go controller.AddConnection(ctx, c1)
+	go sw.Serve(ctx, c2)
+	waitFor(t, "connecting the switch", func() bool { return controller.Finder().Device("1") != nil })
+	device := controller.Finder().Device("1")
+	// Flows installed during the handshake.
+	waitFor(t, "installing the initial flows", func() bool { return len(sw.Flows()) > 0 })
+	initial := len(sw.Flows())
+
+	db := new(testDB)
+	l2 := &L2Switch{cache: newFlowCache(), db: db}
+	param := flowParam{device: device, outPort: 2, dstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}}
+
+	controller.SetDryRun(false, []string{appName})
+	if err := l2.installFlows([]flowParam{param}); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.count(); n != 0 {
+		t.Fatalf("the flow is added to the database in the dry run: %v", n)
+	}
+
+	controller.SetDryRun(false, nil)
+	param.dstMAC = net.HardwareAddr{0, 0, 0, 0, 0, 2}
+	if err := l2.installFlows([]flowParam{param}); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.count(); n != 1 {
+		t.Fatalf("unexpected number of the flows in the database: %v", n)
+	}
+	waitFor(t, "installing the flow", func() bool { return len(sw.Flows()) == initial+1 })
+	if flows := sw.Flows(); flows[len(flows)-1].Cookie != 1 {
+		t.Fatalf("unexpected cookie of the flow: %v", flows[len(flows)-1].Cookie)
+	}
+}
@@ -22,15 +22,16 @@
 package monitor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/superkkt/cherry/event"
 	"github.com/superkkt/cherry/network"
 	"github.com/superkkt/cherry/northbound/app"
 
 	"github.com/superkkt/go-logging"
-	"github.com/superkkt/viper"
 )
 
 var (
@@ -39,23 +40,58 @@ var (
 
 type Monitor struct {
 	app.BaseProcessor
-	email string
+	conf   app.Config
+	email  string
+	finder network.Finder
+	// Cancels the subscription of the alarms.
+	unsubscribe func()
 }
 
-func New() *Monitor {
-	return &Monitor{}
+func New(conf app.Config) *Monitor {
+	return &Monitor{conf: conf}
 }
 
-func (r *Monitor) Init() error {
-	email := viper.GetString("default.admin_email")
+func (r *Monitor) Init(ctx context.Context, s app.Services) error {
+	email := r.conf.Defaults().GetString("admin_email")
 	if len(email) == 0 || !strings.Contains(email, "@") {
 		return errors.New("invalid admin_email in the config file")
 	}
 	r.email = email
+	r.finder = s.Finder
+	r.unsubscribe = s.Events.Subscribe(r.onAlarm, event.AlarmRaised)
 
 	return nil
 }
 
+// Stop stops sending the alarm emails.
+func (r *Monitor) Stop() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+}
+
+func (r *Monitor) onAlarm(e event.Event) {
+	alarm, ok := e.Data.(event.Alarm)
+	if !ok {
+		return
+	}
+	if alarm.DPID != 0 && r.underMaintenance(alarm.DPID, alarm.Port) {
+		logger.Infof("suppressed the alarm of the switch under maintenance: %v", alarm.Subject)
+		return
+	}
+	go func() {
+		if err := r.sendAlarm(alarm.Subject, alarm.Body); err != nil {
+			logger.Errorf("failed to send an alarm email: %v", err)
+		}
+	}()
+}
+
+// underMaintenance returns whether the port of the switch whose DPID is dpid,
+// or the whole switch if port is zero, is in a maintenance window.
+func (r *Monitor) underMaintenance(dpid uint64, port uint32) bool {
+	return r.finder != nil && r.finder.UnderMaintenance(dpid, port)
+}
+
 func (r *Monitor) Name() string {
 	return "Monitor"
 }
@@ -65,27 +101,37 @@ func (r *Monitor) String() string {
 }
 
 func (r *Monitor) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	if r.underMaintenance(device.Features().DPID, 0) {
+		logger.Infof("switch device up under maintenance: DPID=%v", device.Label())
+		return r.BaseProcessor.OnDeviceUp(finder, device)
+	}
+
 	go func() {
 		subject := "Cherry: device is up!"
-		body := fmt.Sprintf("DPID: %v", device.ID())
+		body := fmt.Sprintf("DPID: %v", device.Label())
 		if err := r.sendAlarm(subject, body); err != nil {
 			logger.Errorf("failed to send an alarm email: %v", err)
 		}
 	}()
-	logger.Warningf("switch device up: DPID=%v", device.ID())
+	logger.Warningf("switch device up: DPID=%v", device.Label())
 
 	return r.BaseProcessor.OnDeviceUp(finder, device)
 }
 
 func (r *Monitor) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	if r.underMaintenance(device.Features().DPID, 0) {
+		logger.Infof("switch device down under maintenance: DPID=%v", device.Label())
+		return r.BaseProcessor.OnDeviceDown(finder, device)
+	}
+
 	go func() {
 		subject := "Cherry: device is down!"
-		body := fmt.Sprintf("DPID: %v", device.ID())
+		body := fmt.Sprintf("DPID: %v", device.Label())
 		if err := r.sendAlarm(subject, body); err != nil {
 			logger.Errorf("failed to send an alarm email: %v", err)
 		}
 	}()
-	logger.Warningf("switch device down: DPID=%v", device.ID())
+	logger.Warningf("switch device down: DPID=%v", device.Label())
 
 	return r.BaseProcessor.OnDeviceDown(finder, device)
 }
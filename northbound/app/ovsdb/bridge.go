@@ -0,0 +1,600 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ovsdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// remotePortKey is the key of the external IDs of a mirror, whose value is the
+// name of the output port added with the mirror.
+const remotePortKey = "cherry-remote-port"
+
+var (
+	errUnknownBridge = errors.New("unknown bridge of the DPID")
+	errUnknownPort   = errors.New("unknown port")
+	errUnknownMirror = errors.New("unknown mirror")
+)
+
+// tunnelTypes are the interface types of the tunnels that can be added.
+var tunnelTypes = map[string]bool{
+	"vxlan":  true,
+	"gre":    true,
+	"geneve": true,
+}
+
+// Bridge is the bridge of Open vSwitch whose datapath ID is the DPID of a
+// switch.
+type Bridge struct {
+	Name    string   `json:"name"`
+	Ports   []Port   `json:"ports"`
+	Mirrors []Mirror `json:"mirrors"`
+	uuid    string
+}
+
+func (r *Bridge) port(name string) *Port {
+	for i := range r.Ports {
+		if r.Ports[i].Name == name {
+			return &r.Ports[i]
+		}
+	}
+	return nil
+}
+
+func (r *Bridge) mirror(name string) *Mirror {
+	for i := range r.Mirrors {
+		if r.Mirrors[i].Name == name {
+			return &r.Mirrors[i]
+		}
+	}
+	return nil
+}
+
+// Port is a port of a bridge, whose type and options are the ones of its
+// first interface. Empty type means a network device of the system.
+type Port struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+	// OFPort is the OpenFlow port number, which is zero until it is assigned.
+	OFPort int64 `json:"ofport"`
+	QoS    *QoS  `json:"qos,omitempty"`
+	uuid   string
+}
+
+// QoS shapes the egress traffic of a port by its queues, which are selected by
+// the set_queue action of the flows. The rates are in bits per second, and
+// zero means no limit.
+type QoS struct {
+	// Type is linux-htb or linux-hfsc. Default is linux-htb.
+	Type    string  `json:"type"`
+	MaxRate uint64  `json:"max_rate,omitempty"`
+	Queues  []Queue `json:"queues"`
+	uuid    string
+}
+
+type Queue struct {
+	ID      uint32 `json:"id"`
+	MinRate uint64 `json:"min_rate,omitempty"`
+	MaxRate uint64 `json:"max_rate,omitempty"`
+	uuid    string
+}
+
+func (r *QoS) validate() error {
+	switch r.Type {
+	case "":
+		r.Type = "linux-htb"
+	case "linux-htb", "linux-hfsc":
+	default:
+		return fmt.Errorf("unsupported QoS type: %v", r.Type)
+	}
+	if len(r.Queues) == 0 {
+		return errors.New("empty queues")
+	}
+	ids := make(map[uint32]bool)
+	for _, v := range r.Queues {
+		if ids[v.ID] {
+			return fmt.Errorf("duplicated queue ID: %v", v.ID)
+		}
+		ids[v.ID] = true
+		if v.MaxRate != 0 && v.MinRate > v.MaxRate {
+			return fmt.Errorf("min_rate of queue %v exceeds its max_rate", v.ID)
+		}
+	}
+	return nil
+}
+
+// Tunnel is a port that encapsulates the packets to the remote IP address.
+type Tunnel struct {
+	Name string `json:"name"`
+	// Type is vxlan, gre or geneve.
+	Type     string `json:"type"`
+	RemoteIP string `json:"remote_ip"`
+	// Key is the VNI of vxlan and geneve, or the key of gre, or flow that
+	// means the tunnel_id of the flows. Optional.
+	Key string `json:"key,omitempty"`
+}
+
+func (r *Tunnel) validate() error {
+	// Maximum length of the interface names of Linux.
+	if len(r.Name) == 0 || len(r.Name) > 15 {
+		return errors.New("invalid tunnel name")
+	}
+	if !tunnelTypes[r.Type] {
+		return fmt.Errorf("unsupported tunnel type: %v", r.Type)
+	}
+	if net.ParseIP(r.RemoteIP) == nil {
+		return fmt.Errorf("invalid remote IP address: %v", r.RemoteIP)
+	}
+	if r.Key != "" && r.Key != "flow" {
+		if _, err := strconv.ParseUint(r.Key, 10, 32); err != nil {
+			return fmt.Errorf("invalid tunnel key: %v", r.Key)
+		}
+	}
+	return nil
+}
+
+// Mirror copies the packets sent and received by SelectPorts to OutputPort.
+type Mirror struct {
+	Name        string   `json:"name"`
+	SelectPorts []string `json:"select_ports"`
+	OutputPort  string   `json:"output_port"`
+	// Remote encapsulates the mirrored packets to a remote analyzer through
+	// OutputPort, which is a tunnel port added with the mirror and removed
+	// with it, so that the analyzer does not have to be attached to the
+	// switch.
+	Remote *RemoteAnalyzer `json:"remote,omitempty"`
+	uuid   string
+	// remotePort is the UUID of OutputPort if it has been added with Remote.
+	remotePort string
+}
+
+// RemoteAnalyzer is the remote end of the tunnel of a mirror.
+type RemoteAnalyzer struct {
+	// Type is gre or erspan.
+	Type     string `json:"type"`
+	RemoteIP string `json:"remote_ip"`
+	// Key is the GRE key, or the session ID of ERSPAN. Optional.
+	Key string `json:"key,omitempty"`
+	// Version is the ERSPAN version, 1 (type II) or 2 (type III). Default is 1.
+	Version int `json:"version,omitempty"`
+	// Index is the ERSPAN index of version 1, which identifies the source port
+	// of the packets to the analyzer. Optional.
+	Index uint32 `json:"index,omitempty"`
+}
+
+func (r *RemoteAnalyzer) validate() error {
+	switch r.Type {
+	case "gre":
+		if r.Version != 0 || r.Index != 0 {
+			return errors.New("version and index are only for erspan")
+		}
+	case "erspan":
+		if r.Version == 0 {
+			r.Version = 1
+		}
+		if r.Version != 1 && r.Version != 2 {
+			return fmt.Errorf("invalid ERSPAN version: %v", r.Version)
+		}
+		if r.Version == 2 && r.Index != 0 {
+			return errors.New("index is only for ERSPAN version 1")
+		}
+		// ERSPAN index is 20 bits.
+		if r.Index > 0xFFFFF {
+			return fmt.Errorf("invalid ERSPAN index: %v", r.Index)
+		}
+	default:
+		return fmt.Errorf("unsupported remote mirror type: %v", r.Type)
+	}
+	if net.ParseIP(r.RemoteIP) == nil {
+		return fmt.Errorf("invalid remote IP address: %v", r.RemoteIP)
+	}
+	if r.Key != "" {
+		// ERSPAN session ID is 10 bits.
+		max := 32
+		if r.Type == "erspan" {
+			max = 10
+		}
+		if _, err := strconv.ParseUint(r.Key, 10, max); err != nil {
+			return fmt.Errorf("invalid key of the remote mirror: %v", r.Key)
+		}
+	}
+	return nil
+}
+
+// options returns the options of the tunnel interface.
+func (r *RemoteAnalyzer) options() map[string]string {
+	v := map[string]string{"remote_ip": r.RemoteIP}
+	if r.Key != "" {
+		v["key"] = r.Key
+	}
+	if r.Type == "erspan" {
+		v["erspan_ver"] = strconv.Itoa(r.Version)
+		if r.Version == 1 && r.Index != 0 {
+			v["erspan_idx"] = strconv.FormatUint(uint64(r.Index), 16)
+		}
+	}
+	return v
+}
+
+// newRemoteAnalyzer returns the remote analyzer of the tunnel port p.
+func newRemoteAnalyzer(p *Port) *RemoteAnalyzer {
+	v := &RemoteAnalyzer{Type: p.Type, RemoteIP: p.Options["remote_ip"], Key: p.Options["key"]}
+	if p.Type == "erspan" {
+		v.Version = 1
+		if n, err := strconv.Atoi(p.Options["erspan_ver"]); err == nil {
+			v.Version = n
+		}
+		if n, err := strconv.ParseUint(p.Options["erspan_idx"], 16, 32); err == nil {
+			v.Index = uint32(n)
+		}
+	}
+	return v
+}
+
+func (r *Mirror) validate() error {
+	if len(r.Name) == 0 {
+		return errors.New("invalid mirror name")
+	}
+	if len(r.SelectPorts) == 0 {
+		return errors.New("empty select_ports")
+	}
+	if len(r.OutputPort) == 0 {
+		return errors.New("empty output_port")
+	}
+	for _, v := range r.SelectPorts {
+		if v == r.OutputPort {
+			return fmt.Errorf("output port %v is also selected", v)
+		}
+	}
+	if r.Remote != nil {
+		// Maximum length of the interface names of Linux.
+		if len(r.OutputPort) > 15 {
+			return errors.New("invalid output port name of the remote mirror")
+		}
+		if err := r.Remote.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func selectAll(table string, columns ...string) operation {
+	return operation{"op": "select", "table": table, "where": []interface{}{}, "columns": append(columns, "_uuid")}
+}
+
+// bridge returns the bridge whose datapath ID is dpid with its ports and
+// mirrors.
+func (r *client) bridge(ctx context.Context, dpid uint64) (*Bridge, error) {
+	results, err := r.transact(ctx,
+		operation{
+			"op":      "select",
+			"table":   "Bridge",
+			"where":   []interface{}{condition("datapath_id", fmt.Sprintf("%016x", dpid))},
+			"columns": []string{"_uuid", "name", "ports", "mirrors"},
+		},
+		selectAll("Port", "name", "interfaces", "qos"),
+		selectAll("Interface", "type", "options", "ofport"),
+		selectAll("QoS", "type", "other_config", "queues"),
+		selectAll("Queue", "other_config"),
+		selectAll("Mirror", "name", "select_src_port", "select_dst_port", "output_port", "external_ids"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(results[0].Rows) == 0 {
+		return nil, errUnknownBridge
+	}
+	row := results[0].Rows[0]
+	b := &Bridge{Name: stringValue(row["name"]), Ports: []Port{}, Mirrors: []Mirror{}, uuid: uuidValue(row["_uuid"])}
+
+	rows := func(i int) map[string]map[string]interface{} {
+		m := make(map[string]map[string]interface{})
+		for _, v := range results[i].Rows {
+			m[uuidValue(v["_uuid"])] = v
+		}
+		return m
+	}
+	ports, ifaces, qos, queues, mirrors := rows(1), rows(2), rows(3), rows(4), rows(5)
+
+	names := make(map[string]string) // Key = UUID of a port.
+	for _, id := range uuidSetValue(row["ports"]) {
+		p, ok := ports[id]
+		if !ok {
+			continue
+		}
+		v := Port{Name: stringValue(p["name"]), uuid: id}
+		names[id] = v.Name
+		if i := uuidSetValue(p["interfaces"]); len(i) > 0 {
+			iface := ifaces[i[0]]
+			v.Type = stringValue(iface["type"])
+			v.Options = stringMapValue(iface["options"])
+			v.OFPort = intValue(iface["ofport"])
+		}
+		if q := uuidSetValue(p["qos"]); len(q) > 0 && qos[q[0]] != nil {
+			v.QoS = newQoS(q[0], qos[q[0]], queues)
+		}
+		b.Ports = append(b.Ports, v)
+	}
+	sort.Slice(b.Ports, func(i, j int) bool { return b.Ports[i].Name < b.Ports[j].Name })
+
+	for _, id := range uuidSetValue(row["mirrors"]) {
+		m, ok := mirrors[id]
+		if !ok {
+			continue
+		}
+		v := Mirror{Name: stringValue(m["name"]), SelectPorts: []string{}, uuid: id}
+		selected := make(map[string]bool)
+		for _, p := range append(uuidSetValue(m["select_src_port"]), uuidSetValue(m["select_dst_port"])...) {
+			if name, ok := names[p]; ok && !selected[name] {
+				selected[name] = true
+				v.SelectPorts = append(v.SelectPorts, name)
+			}
+		}
+		sort.Strings(v.SelectPorts)
+		if p := uuidSetValue(m["output_port"]); len(p) > 0 {
+			v.OutputPort = names[p[0]]
+			if v.OutputPort != "" && v.OutputPort == stringMapValue(m["external_ids"])[remotePortKey] {
+				v.remotePort = p[0]
+				v.Remote = newRemoteAnalyzer(b.port(v.OutputPort))
+			}
+		}
+		b.Mirrors = append(b.Mirrors, v)
+	}
+	sort.Slice(b.Mirrors, func(i, j int) bool { return b.Mirrors[i].Name < b.Mirrors[j].Name })
+
+	return b, nil
+}
+
+func newQoS(id string, row map[string]interface{}, queues map[string]map[string]interface{}) *QoS {
+	config := stringMapValue(row["other_config"])
+	v := &QoS{Type: stringValue(row["type"]), MaxRate: parseRate(config["max-rate"]), Queues: []Queue{}, uuid: id}
+	for k, u := range mapValue(row["queues"]) {
+		queueID, ok := k.(float64)
+		if !ok {
+			continue
+		}
+		q := Queue{ID: uint32(queueID), uuid: uuidValue(u)}
+		if row, ok := queues[q.uuid]; ok {
+			config := stringMapValue(row["other_config"])
+			q.MinRate = parseRate(config["min-rate"])
+			q.MaxRate = parseRate(config["max-rate"])
+		}
+		v.Queues = append(v.Queues, q)
+	}
+	sort.Slice(v.Queues, func(i, j int) bool { return v.Queues[i].ID < v.Queues[j].ID })
+
+	return v
+}
+
+func parseRate(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v
+}
+
+func rateConfig(min, max uint64) map[string]string {
+	v := make(map[string]string)
+	if min > 0 {
+		v["min-rate"] = strconv.FormatUint(min, 10)
+	}
+	if max > 0 {
+		v["max-rate"] = strconv.FormatUint(max, 10)
+	}
+	return v
+}
+
+// mutateBridge returns the operation that inserts or deletes value into or from
+// column of the bridge.
+func mutateBridge(b *Bridge, column, mutator string, value interface{}) operation {
+	return operation{
+		"op":        "mutate",
+		"table":     "Bridge",
+		"where":     []interface{}{condition("_uuid", uuid(b.uuid))},
+		"mutations": []interface{}{[]interface{}{column, mutator, set(value)}},
+	}
+}
+
+// checkCount returns errUnknownBridge if the bridge has been removed before the
+// mutation of the last operation.
+func checkCount(results []result) error {
+	if results[len(results)-1].Count == 0 {
+		return errUnknownBridge
+	}
+	return nil
+}
+
+func (r *client) addTunnel(ctx context.Context, b *Bridge, t Tunnel) error {
+	options := map[string]string{"remote_ip": t.RemoteIP}
+	if t.Key != "" {
+		options["key"] = t.Key
+	}
+	results, err := r.transact(ctx,
+		operation{
+			"op":        "insert",
+			"table":     "Interface",
+			"row":       map[string]interface{}{"name": t.Name, "type": t.Type, "options": stringMap(options)},
+			"uuid-name": "iface",
+		},
+		operation{
+			"op":        "insert",
+			"table":     "Port",
+			"row":       map[string]interface{}{"name": t.Name, "interfaces": namedUUID("iface")},
+			"uuid-name": "port",
+		},
+		mutateBridge(b, "ports", "insert", namedUUID("port")),
+	)
+	if err != nil {
+		return err
+	}
+	return checkCount(results)
+}
+
+// removeTunnel removes the tunnel port, which is garbage-collected with its
+// interface by the database when the bridge does not refer to it.
+func (r *client) removeTunnel(ctx context.Context, b *Bridge, p *Port) error {
+	results, err := r.transact(ctx, mutateBridge(b, "ports", "delete", uuid(p.uuid)))
+	if err != nil {
+		return err
+	}
+	return checkCount(results)
+}
+
+func (r *client) setQoS(ctx context.Context, p *Port, q QoS) error {
+	ops := []operation{}
+	queues := []interface{}{}
+	for i, v := range q.Queues {
+		name := fmt.Sprintf("queue%v", i)
+		ops = append(ops, operation{
+			"op":        "insert",
+			"table":     "Queue",
+			"row":       map[string]interface{}{"other_config": stringMap(rateConfig(v.MinRate, v.MaxRate))},
+			"uuid-name": name,
+		})
+		queues = append(queues, []interface{}{v.ID, namedUUID(name)})
+	}
+	ops = append(ops,
+		operation{
+			"op":        "insert",
+			"table":     "QoS",
+			"row":       map[string]interface{}{"type": q.Type, "other_config": stringMap(rateConfig(0, q.MaxRate)), "queues": []interface{}{"map", queues}},
+			"uuid-name": "qos",
+		},
+		operation{
+			"op":    "update",
+			"table": "Port",
+			"where": []interface{}{condition("_uuid", uuid(p.uuid))},
+			"row":   map[string]interface{}{"qos": namedUUID("qos")},
+		},
+	)
+	results, err := r.transact(ctx, ops...)
+	if err != nil {
+		return err
+	}
+	if results[len(results)-1].Count == 0 {
+		return errUnknownPort
+	}
+	return nil
+}
+
+// removeQoS removes the QoS from the port, and then deletes it with its queues
+// unless another port still has it.
+func (r *client) removeQoS(ctx context.Context, p *Port) error {
+	_, err := r.transact(ctx, operation{
+		"op":    "update",
+		"table": "Port",
+		"where": []interface{}{condition("_uuid", uuid(p.uuid))},
+		"row":   map[string]interface{}{"qos": set()},
+	})
+	if err != nil {
+		return err
+	}
+
+	ops := []operation{{"op": "delete", "table": "QoS", "where": []interface{}{condition("_uuid", uuid(p.QoS.uuid))}}}
+	for _, v := range p.QoS.Queues {
+		ops = append(ops, operation{"op": "delete", "table": "Queue", "where": []interface{}{condition("_uuid", uuid(v.uuid))}})
+	}
+	_, err = r.transact(ctx, ops...)
+	if e, ok := err.(*Error); ok && e.Name == "referential integrity violation" {
+		return nil
+	}
+	return err
+}
+
+// addMirror adds the mirror, and also its output port if it has Remote.
+func (r *client) addMirror(ctx context.Context, b *Bridge, m Mirror) error {
+	selected := []interface{}{}
+	for _, name := range m.SelectPorts {
+		p := b.port(name)
+		if p == nil {
+			return fmt.Errorf("%v: %v", errUnknownPort, name)
+		}
+		selected = append(selected, uuid(p.uuid))
+	}
+
+	ops := []operation{}
+	row := map[string]interface{}{
+		"name":            m.Name,
+		"select_src_port": set(selected...),
+		"select_dst_port": set(selected...),
+	}
+	mutations := []interface{}{[]interface{}{"mirrors", "insert", set(namedUUID("mirror"))}}
+	if m.Remote != nil {
+		ops = append(ops,
+			operation{
+				"op":        "insert",
+				"table":     "Interface",
+				"row":       map[string]interface{}{"name": m.OutputPort, "type": m.Remote.Type, "options": stringMap(m.Remote.options())},
+				"uuid-name": "iface",
+			},
+			operation{
+				"op":        "insert",
+				"table":     "Port",
+				"row":       map[string]interface{}{"name": m.OutputPort, "interfaces": namedUUID("iface")},
+				"uuid-name": "port",
+			},
+		)
+		row["output_port"] = namedUUID("port")
+		row["external_ids"] = stringMap(map[string]string{remotePortKey: m.OutputPort})
+		mutations = append(mutations, []interface{}{"ports", "insert", set(namedUUID("port"))})
+	} else {
+		output := b.port(m.OutputPort)
+		if output == nil {
+			return fmt.Errorf("%v: %v", errUnknownPort, m.OutputPort)
+		}
+		row["output_port"] = uuid(output.uuid)
+	}
+	ops = append(ops,
+		operation{"op": "insert", "table": "Mirror", "row": row, "uuid-name": "mirror"},
+		operation{
+			"op":        "mutate",
+			"table":     "Bridge",
+			"where":     []interface{}{condition("_uuid", uuid(b.uuid))},
+			"mutations": mutations,
+		},
+	)
+
+	results, err := r.transact(ctx, ops...)
+	if err != nil {
+		return err
+	}
+	return checkCount(results)
+}
+
+// removeMirror removes the mirror, and also its output port if it has been
+// added with the mirror. They are garbage-collected by the database when the
+// bridge does not refer to them.
+func (r *client) removeMirror(ctx context.Context, b *Bridge, m *Mirror) error {
+	op := mutateBridge(b, "mirrors", "delete", uuid(m.uuid))
+	if m.remotePort != "" {
+		op["mutations"] = append(op["mutations"].([]interface{}), []interface{}{"ports", "delete", set(uuid(m.remotePort))})
+	}
+	results, err := r.transact(ctx, op)
+	if err != nil {
+		return err
+	}
+	return checkCount(results)
+}
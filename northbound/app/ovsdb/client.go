@@ -0,0 +1,281 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ovsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// database is the name of the Open vSwitch database.
+const database = "Open_vSwitch"
+
+// client is a client of the OVSDB management protocol (RFC 7047). It connects
+// to the database server for each transaction like ovs-vsctl, so that nothing
+// has to be kept while the server is restarted.
+type client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// newClient returns a client of addr, which is tcp:HOST:PORT or unix:PATH as
+// the remotes of ovsdb-server.
+func newClient(addr string, timeout time.Duration) (*client, error) {
+	i := strings.Index(addr, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid OVSDB address: %v", addr)
+	}
+	v := &client{network: addr[:i], address: addr[i+1:], timeout: timeout}
+	switch v.network {
+	case "tcp":
+		if _, _, err := net.SplitHostPort(v.address); err != nil {
+			return nil, fmt.Errorf("invalid OVSDB address: %v", addr)
+		}
+	case "unix":
+		if v.address == "" {
+			return nil, fmt.Errorf("invalid OVSDB address: %v", addr)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported OVSDB address: %v", addr)
+	}
+
+	return v, nil
+}
+
+func (r *client) String() string {
+	return r.network + ":" + r.address
+}
+
+// operation is an operation of a transaction, e.g., insert and select.
+type operation map[string]interface{}
+
+// condition returns the condition that column is equal to value.
+func condition(column string, value interface{}) []interface{} {
+	return []interface{}{column, "==", value}
+}
+
+func uuid(v string) []interface{} {
+	return []interface{}{"uuid", v}
+}
+
+func namedUUID(v string) []interface{} {
+	return []interface{}{"named-uuid", v}
+}
+
+func set(v ...interface{}) []interface{} {
+	if v == nil {
+		v = []interface{}{}
+	}
+	return []interface{}{"set", v}
+}
+
+func stringMap(m map[string]string) []interface{} {
+	pairs := []interface{}{}
+	for k, v := range m {
+		pairs = append(pairs, []interface{}{k, v})
+	}
+	return []interface{}{"map", pairs}
+}
+
+// result is the result of an operation.
+type result struct {
+	Count   int                      `json:"count"`
+	Rows    []map[string]interface{} `json:"rows"`
+	Error   string                   `json:"error"`
+	Details string                   `json:"details"`
+}
+
+// Error is the error of an operation or the transaction, e.g., constraint
+// violation.
+type Error struct {
+	Name    string
+	Details string
+}
+
+func (r *Error) Error() string {
+	if r.Details == "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%v: %v", r.Name, r.Details)
+}
+
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  interface{}     `json:"error"`
+}
+
+// transact commits ops as a transaction, and then returns their results. The
+// error is an *Error if any of the operations fails.
+func (r *client) transact(ctx context.Context, ops ...operation) ([]result, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, r.network, r.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	params := []interface{}{database}
+	for _, v := range ops {
+		params = append(params, v)
+	}
+	enc := json.NewEncoder(conn)
+	if err := enc.Encode(map[string]interface{}{"method": "transact", "params": params, "id": 0}); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			return nil, err
+		}
+		// The server may check whether we are alive while the transaction is processed.
+		if msg.Method == "echo" {
+			if err := enc.Encode(message{ID: msg.ID, Result: msg.Params}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if msg.Method != "" || string(msg.ID) != "0" {
+			continue
+		}
+		if msg.Error != nil {
+			return nil, fmt.Errorf("OVSDB transaction failed: %v", msg.Error)
+		}
+
+		return parseResults(msg.Result, len(ops))
+	}
+}
+
+func parseResults(data json.RawMessage, n int) ([]result, error) {
+	// The result of a failed operation is followed by nulls, and the error of
+	// the commit follows the results of the operations.
+	var results []*result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, err
+	}
+	for _, v := range results {
+		if v != nil && v.Error != "" {
+			return nil, &Error{Name: v.Error, Details: v.Details}
+		}
+	}
+	if len(results) < n {
+		return nil, errors.New("missing results of the OVSDB transaction")
+	}
+
+	v := make([]result, n)
+	for i := range v {
+		if results[i] == nil {
+			return nil, errors.New("missing results of the OVSDB transaction")
+		}
+		v[i] = *results[i]
+	}
+
+	return v, nil
+}
+
+// The values of the columns decoded from the rows, which are atoms, sets or maps.
+
+func uuidValue(v interface{}) string {
+	pair, ok := v.([]interface{})
+	if !ok || len(pair) != 2 || pair[0] != "uuid" {
+		return ""
+	}
+	s, _ := pair[1].(string)
+	return s
+}
+
+func setValue(v interface{}) []interface{} {
+	pair, ok := v.([]interface{})
+	if ok && len(pair) == 2 && pair[0] == "set" {
+		elems, _ := pair[1].([]interface{})
+		return elems
+	}
+	// A set of exactly one element is the element itself.
+	return []interface{}{v}
+}
+
+func uuidSetValue(v interface{}) []string {
+	uuids := []string{}
+	for _, e := range setValue(v) {
+		if s := uuidValue(e); s != "" {
+			uuids = append(uuids, s)
+		}
+	}
+	return uuids
+}
+
+func mapValue(v interface{}) map[interface{}]interface{} {
+	m := make(map[interface{}]interface{})
+	pair, ok := v.([]interface{})
+	if !ok || len(pair) != 2 || pair[0] != "map" {
+		return m
+	}
+	entries, _ := pair[1].([]interface{})
+	for _, e := range entries {
+		if kv, ok := e.([]interface{}); ok && len(kv) == 2 {
+			m[kv[0]] = kv[1]
+		}
+	}
+	return m
+}
+
+func stringMapValue(v interface{}) map[string]string {
+	m := make(map[string]string)
+	for k, v := range mapValue(v) {
+		key, ok1 := k.(string)
+		value, ok2 := v.(string)
+		if ok1 && ok2 {
+			m[key] = value
+		}
+	}
+	return m
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// intValue returns the first integer of v, which can be a set, e.g., ofport.
+func intValue(v interface{}) int64 {
+	for _, e := range setValue(v) {
+		if f, ok := e.(float64); ok {
+			return int64(f)
+		}
+	}
+	return 0
+}
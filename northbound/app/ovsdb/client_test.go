@@ -0,0 +1,190 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ovsdb
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeServer answers a transaction with result after an echo request, and then
+// sends the params of the transaction to the returned channel.
+func fakeServer(t *testing.T, result string) (*client, <-chan []interface{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := make(chan []interface{}, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		dec := json.NewDecoder(conn)
+		var req struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+			ID     interface{}   `json:"id"`
+		}
+		if err := dec.Decode(&req); err != nil || req.Method != "transact" {
+			return
+		}
+		conn.Write([]byte(`{"method":"echo","params":["ping"],"id":"echo"}`))
+		var echo map[string]interface{}
+		if err := dec.Decode(&echo); err != nil || echo["id"] != "echo" || !reflect.DeepEqual(echo["result"], []interface{}{"ping"}) {
+			return
+		}
+		conn.Write([]byte(`{"id":0,"error":null,"result":` + result + `}`))
+		params <- req.Params
+	}()
+
+	c, err := newClient("tcp:"+l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, params
+}
+
+func TestBridge(t *testing.T) {
+	c, params := fakeServer(t, `[
+		{"rows":[{"_uuid":["uuid","b"],"name":"br0","ports":["set",[["uuid","p1"],["uuid","p2"],["uuid","p3"],["uuid","p5"]]],"mirrors":["set",[["uuid","m"],["uuid","m2"]]]}]},
+		{"rows":[
+			{"_uuid":["uuid","p1"],"name":"eth1","interfaces":["uuid","i1"],"qos":["uuid","q"]},
+			{"_uuid":["uuid","p2"],"name":"vx1","interfaces":["uuid","i2"],"qos":["set",[]]},
+			{"_uuid":["uuid","p3"],"name":"eth3","interfaces":["uuid","i3"],"qos":["set",[]]},
+			{"_uuid":["uuid","p4"],"name":"other","interfaces":["uuid","i4"],"qos":["set",[]]},
+			{"_uuid":["uuid","p5"],"name":"rspan","interfaces":["uuid","i5"],"qos":["set",[]]}]},
+		{"rows":[
+			{"_uuid":["uuid","i1"],"type":"","options":["map",[]],"ofport":1},
+			{"_uuid":["uuid","i2"],"type":"vxlan","options":["map",[["key","100"],["remote_ip","10.0.0.2"]]],"ofport":["set",[]]},
+			{"_uuid":["uuid","i3"],"type":"","options":["map",[]],"ofport":3},
+			{"_uuid":["uuid","i5"],"type":"erspan","options":["map",[["erspan_ver","1"],["erspan_idx","1f"],["key","7"],["remote_ip","10.0.0.9"]]],"ofport":5}]},
+		{"rows":[{"_uuid":["uuid","q"],"type":"linux-htb","other_config":["map",[["max-rate","1000"]]],"queues":["map",[[1,["uuid","q1"]]]]}]},
+		{"rows":[{"_uuid":["uuid","q1"],"other_config":["map",[["min-rate","100"],["max-rate","500"]]]}]},
+		{"rows":[
+			{"_uuid":["uuid","m"],"name":"span1","select_src_port":["uuid","p1"],"select_dst_port":["uuid","p1"],"output_port":["uuid","p3"],"external_ids":["map",[]]},
+			{"_uuid":["uuid","m2"],"name":"span2","select_src_port":["uuid","p1"],"select_dst_port":["set",[]],"output_port":["uuid","p5"],"external_ids":["map",[["cherry-remote-port","rspan"]]]}]}
+	]`)
+
+	b, err := c.bridge(context.Background(), 0x1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Bridge{
+		Name: "br0",
+		Ports: []Port{
+			{Name: "eth1", Options: map[string]string{}, OFPort: 1, QoS: &QoS{Type: "linux-htb", MaxRate: 1000, Queues: []Queue{{ID: 1, MinRate: 100, MaxRate: 500, uuid: "q1"}}, uuid: "q"}, uuid: "p1"},
+			{Name: "eth3", Options: map[string]string{}, OFPort: 3, uuid: "p3"},
+			{Name: "rspan", Type: "erspan", Options: map[string]string{"erspan_ver": "1", "erspan_idx": "1f", "key": "7", "remote_ip": "10.0.0.9"}, OFPort: 5, uuid: "p5"},
+			{Name: "vx1", Type: "vxlan", Options: map[string]string{"key": "100", "remote_ip": "10.0.0.2"}, uuid: "p2"},
+		},
+		Mirrors: []Mirror{
+			{Name: "span1", SelectPorts: []string{"eth1"}, OutputPort: "eth3", uuid: "m"},
+			{Name: "span2", SelectPorts: []string{"eth1"}, OutputPort: "rspan", Remote: &RemoteAnalyzer{Type: "erspan", RemoteIP: "10.0.0.9", Key: "7", Version: 1, Index: 0x1f}, uuid: "m2", remotePort: "p5"},
+		},
+		uuid: "b",
+	}
+	if !reflect.DeepEqual(b, expected) {
+		t.Fatalf("unexpected bridge: %+v", b)
+	}
+
+	p := <-params
+	if len(p) != 7 || p[0] != database {
+		t.Fatalf("unexpected params: %v", p)
+	}
+	where := p[1].(map[string]interface{})["where"]
+	if !reflect.DeepEqual(where, []interface{}{[]interface{}{"datapath_id", "==", "0000000000001234"}}) {
+		t.Fatalf("unexpected condition: %v", where)
+	}
+}
+
+func TestTransactError(t *testing.T) {
+	c, _ := fakeServer(t, `[{"uuid":["uuid","i"]},{"uuid":["uuid","p"]},{"count":1},{"error":"constraint violation","details":"duplicated name"}]`)
+
+	err := c.addTunnel(context.Background(), &Bridge{uuid: "b"}, Tunnel{Name: "vx1", Type: "vxlan", RemoteIP: "10.0.0.2"})
+	if e, ok := err.(*Error); !ok || e.Name != "constraint violation" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAddRemoteMirror(t *testing.T) {
+	c, params := fakeServer(t, `[{"uuid":["uuid","i"]},{"uuid":["uuid","p"]},{"uuid":["uuid","m"]},{"count":1}]`)
+
+	m := Mirror{Name: "span1", SelectPorts: []string{"eth1"}, OutputPort: "rspan", Remote: &RemoteAnalyzer{Type: "erspan", RemoteIP: "10.0.0.9", Key: "7"}}
+	if err := m.validate(); err != nil {
+		t.Fatal(err)
+	}
+	b := &Bridge{Ports: []Port{{Name: "eth1", uuid: "p1"}}, uuid: "b"}
+	if err := c.addMirror(context.Background(), b, m); err != nil {
+		t.Fatal(err)
+	}
+
+	p := <-params
+	if len(p) != 5 {
+		t.Fatalf("unexpected params: %v", p)
+	}
+	iface := p[1].(map[string]interface{})["row"].(map[string]interface{})
+	options := mapValue(iface["options"])
+	if iface["type"] != "erspan" || options["remote_ip"] != "10.0.0.9" || options["key"] != "7" || options["erspan_ver"] != "1" {
+		t.Fatalf("unexpected interface: %v", iface)
+	}
+	mirror := p[3].(map[string]interface{})["row"].(map[string]interface{})
+	if !reflect.DeepEqual(mirror["output_port"], []interface{}{"named-uuid", "port"}) {
+		t.Fatalf("unexpected mirror: %v", mirror)
+	}
+
+	for _, v := range []RemoteAnalyzer{
+		{Type: "vxlan", RemoteIP: "10.0.0.9"},
+		{Type: "gre", RemoteIP: "10.0.0.9", Version: 1},
+		{Type: "erspan", RemoteIP: "10.0.0.9", Version: 3},
+		{Type: "erspan", RemoteIP: "10.0.0.9", Key: "1024"},
+		{Type: "erspan", RemoteIP: "invalid"},
+	} {
+		if err := v.validate(); err == nil {
+			t.Fatalf("expected an error: %+v", v)
+		}
+	}
+}
+
+func TestParseManagers(t *testing.T) {
+	clients, err := parseManagers("1,tcp:10.0.0.1:6640; 2,unix:/var/run/openvswitch/db.sock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 2 || clients[1].String() != "tcp:10.0.0.1:6640" || clients[2].String() != "unix:/var/run/openvswitch/db.sock" {
+		t.Fatalf("unexpected clients: %v", clients)
+	}
+
+	for _, v := range []string{"1", "x,tcp:10.0.0.1:6640", "1,ssl:10.0.0.1:6640", "1,tcp:10.0.0.1", "1,tcp:10.0.0.1:6640;1,tcp:10.0.0.2:6640"} {
+		if _, err := parseManagers(v, time.Second); err == nil {
+			t.Fatalf("expected an error: %v", v)
+		}
+	}
+}
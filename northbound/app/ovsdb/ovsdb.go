@@ -0,0 +1,395 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package ovsdb provisions the QoS queues, the tunnel ports and the mirrors on
+// the Open vSwitch instances through their OVSDB servers (RFC 7047), so that
+// they do not have to be provisioned by ovs-vsctl before the flows using them
+// are installed. The mirrors can also send the packets to a remote analyzer
+// through a GRE or ERSPAN tunnel. The bridge of a switch is the one whose
+// datapath ID is the DPID of the switch.
+package ovsdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superkkt/cherry/northbound/app"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("ovsdb")
+)
+
+const defaultTimeout = 5 * time.Second
+
+type OVSDB struct {
+	app.BaseProcessor
+	conf    app.Config
+	timeout time.Duration
+	// Key = DPID. It is not changed after Init.
+	clients map[uint64]*client
+}
+
+func New(conf app.Config) *OVSDB {
+	return &OVSDB{
+		conf:    conf,
+		clients: make(map[uint64]*client),
+	}
+}
+
+func (r *OVSDB) Init(ctx context.Context, s app.Services) error {
+	r.timeout = defaultTimeout
+	if r.conf.IsSet("timeout") {
+		timeout := r.conf.GetInt("timeout")
+		if timeout <= 0 {
+			return errors.New("invalid ovsdb.timeout in the config file")
+		}
+		r.timeout = time.Duration(timeout) * time.Second
+	}
+
+	clients, err := parseManagers(r.conf.GetString("managers"), r.timeout)
+	if err != nil {
+		return fmt.Errorf("invalid ovsdb.managers in the config file: %v", err)
+	}
+	r.clients = clients
+
+	return nil
+}
+
+// parseManagers parses s, which is the OVSDB addresses of the switches
+// separated by semicolon. Each one is the DPID in decimal and the address,
+// e.g., 1,tcp:10.0.0.1:6640.
+func parseManagers(s string, timeout time.Duration) (map[uint64]*client, error) {
+	clients := make(map[uint64]*client)
+	for _, v := range strings.Split(strings.Replace(s, " ", "", -1), ";") {
+		if v == "" {
+			continue
+		}
+		t := strings.SplitN(v, ",", 2)
+		if len(t) != 2 {
+			return nil, fmt.Errorf("invalid manager: %v", v)
+		}
+		dpid, err := strconv.ParseUint(t[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DPID: %v", t[0])
+		}
+		if _, ok := clients[dpid]; ok {
+			return nil, fmt.Errorf("duplicated DPID: %v", dpid)
+		}
+		c, err := newClient(t[1], timeout)
+		if err != nil {
+			return nil, err
+		}
+		clients[dpid] = c
+	}
+
+	return clients, nil
+}
+
+func (r *OVSDB) Name() string {
+	return "OVSDB"
+}
+
+func (r *OVSDB) String() string {
+	dpids := []uint64{}
+	for dpid := range r.clients {
+		dpids = append(dpids, dpid)
+	}
+	sort.Slice(dpids, func(i, j int) bool { return dpids[i] < dpids[j] })
+
+	managers := []string{}
+	for _, dpid := range dpids {
+		managers = append(managers, fmt.Sprintf("%v=%v", dpid, r.clients[dpid]))
+	}
+
+	return fmt.Sprintf("%v (managers=%v, timeout=%v)", r.Name(), strings.Join(managers, ", "), r.timeout)
+}
+
+func (r *OVSDB) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/api/v1/ovsdb/:dpid", r.showBridge),
+		rest.Post("/api/v1/ovsdb/:dpid/tunnel", r.addTunnel),
+		rest.Delete("/api/v1/ovsdb/:dpid/tunnel/:name", r.removeTunnel),
+		rest.Options("/api/v1/ovsdb/:dpid/tunnel/:name", r.allowOrigin),
+		rest.Put("/api/v1/ovsdb/:dpid/qos/:port", r.setQoS),
+		rest.Delete("/api/v1/ovsdb/:dpid/qos/:port", r.removeQoS),
+		rest.Options("/api/v1/ovsdb/:dpid/qos/:port", r.allowOrigin),
+		rest.Post("/api/v1/ovsdb/:dpid/mirror", r.addMirror),
+		rest.Delete("/api/v1/ovsdb/:dpid/mirror/:name", r.removeMirror),
+		rest.Options("/api/v1/ovsdb/:dpid/mirror/:name", r.allowOrigin),
+	}
+}
+
+func (r *OVSDB) allowOrigin(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PUT, DELETE")
+}
+
+// bridge returns the client and the bridge of the switch in the request. It
+// writes the error to w if it fails.
+func (r *OVSDB) bridge(w rest.ResponseWriter, req *rest.Request) (*client, *Bridge, bool) {
+	dpid, err := strconv.ParseUint(req.PathParam("dpid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid DPID"))
+		return nil, nil, false
+	}
+	c, ok := r.clients[dpid]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown OVSDB manager of the switch"))
+		return nil, nil, false
+	}
+	b, err := c.bridge(req.Context(), dpid)
+	if err != nil {
+		r.writeError(w, c, err)
+		return nil, nil, false
+	}
+
+	return c, b, true
+}
+
+// writeError writes err returned by c to w.
+func (r *OVSDB) writeError(w rest.ResponseWriter, c *client, err error) {
+	if err == errUnknownBridge || err == errUnknownPort {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if e, ok := err.(*Error); ok && e.Name == "constraint violation" {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	logger.Errorf("failed to query OVSDB %v: %v", c, err)
+	writeError(w, http.StatusBadGateway, err)
+}
+
+func (r *OVSDB) showBridge(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	_, b, ok := r.bridge(w, req)
+	if !ok {
+		return
+	}
+	w.WriteJson(b)
+}
+
+func (r *OVSDB) addTunnel(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	t := Tunnel{}
+	if err := req.DecodeJsonPayload(&t); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := t.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c, b, ok := r.bridge(w, req)
+	if !ok {
+		return
+	}
+	if b.port(t.Name) != nil {
+		writeError(w, http.StatusConflict, errors.New("duplicated port name"))
+		return
+	}
+	if err := c.addTunnel(req.Context(), b, t); err != nil {
+		r.writeError(w, c, err)
+		return
+	}
+	logger.Infof("added a tunnel to bridge %v: %+v", b.Name, t)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *OVSDB) removeTunnel(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	c, b, ok := r.bridge(w, req)
+	if !ok {
+		return
+	}
+	p := b.port(req.PathParam("name"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, errUnknownPort)
+		return
+	}
+	if !tunnelTypes[p.Type] {
+		writeError(w, http.StatusBadRequest, errors.New("not a tunnel port"))
+		return
+	}
+	for _, m := range b.Mirrors {
+		if m.remotePort == p.uuid {
+			writeError(w, http.StatusConflict, fmt.Errorf("the port is removed with remote mirror %v", m.Name))
+			return
+		}
+	}
+	if err := c.removeTunnel(req.Context(), b, p); err != nil {
+		r.writeError(w, c, err)
+		return
+	}
+	logger.Infof("removed the tunnel from bridge %v: %v", b.Name, p.Name)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *OVSDB) setQoS(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	q := QoS{}
+	if err := req.DecodeJsonPayload(&q); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := q.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c, b, ok := r.bridge(w, req)
+	if !ok {
+		return
+	}
+	p := b.port(req.PathParam("port"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, errUnknownPort)
+		return
+	}
+	// The QoS may be shared by the other ports, so it should be removed first.
+	if p.QoS != nil {
+		writeError(w, http.StatusConflict, errors.New("the port already has a QoS"))
+		return
+	}
+	if err := c.setQoS(req.Context(), p, q); err != nil {
+		r.writeError(w, c, err)
+		return
+	}
+	logger.Infof("set the QoS of port %v on bridge %v: %+v", p.Name, b.Name, q)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *OVSDB) removeQoS(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	c, b, ok := r.bridge(w, req)
+	if !ok {
+		return
+	}
+	p := b.port(req.PathParam("port"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, errUnknownPort)
+		return
+	}
+	if p.QoS == nil {
+		writeError(w, http.StatusNotFound, errors.New("the port has no QoS"))
+		return
+	}
+	if err := c.removeQoS(req.Context(), p); err != nil {
+		r.writeError(w, c, err)
+		return
+	}
+	logger.Infof("removed the QoS of port %v on bridge %v", p.Name, b.Name)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *OVSDB) addMirror(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	m := Mirror{}
+	if err := req.DecodeJsonPayload(&m); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := m.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c, b, ok := r.bridge(w, req)
+	if !ok {
+		return
+	}
+	if b.mirror(m.Name) != nil {
+		writeError(w, http.StatusConflict, errors.New("duplicated mirror name"))
+		return
+	}
+	for _, name := range m.SelectPorts {
+		if b.port(name) == nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%v: %v", errUnknownPort, name))
+			return
+		}
+	}
+	// The output port of a remote mirror is added with it.
+	switch exists := b.port(m.OutputPort) != nil; {
+	case m.Remote != nil && exists:
+		writeError(w, http.StatusConflict, errors.New("duplicated port name"))
+		return
+	case m.Remote == nil && !exists:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%v: %v", errUnknownPort, m.OutputPort))
+		return
+	}
+	if err := c.addMirror(req.Context(), b, m); err != nil {
+		r.writeError(w, c, err)
+		return
+	}
+	if m.Remote != nil {
+		logger.Infof("added a remote mirror to bridge %v: name=%v, select_ports=%v, output_port=%v, remote=%+v", b.Name, m.Name, m.SelectPorts, m.OutputPort, *m.Remote)
+	} else {
+		logger.Infof("added a mirror to bridge %v: name=%v, select_ports=%v, output_port=%v", b.Name, m.Name, m.SelectPorts, m.OutputPort)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *OVSDB) removeMirror(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	c, b, ok := r.bridge(w, req)
+	if !ok {
+		return
+	}
+	m := b.mirror(req.PathParam("name"))
+	if m == nil {
+		writeError(w, http.StatusNotFound, errUnknownMirror)
+		return
+	}
+	if err := c.removeMirror(req.Context(), b, m); err != nil {
+		r.writeError(w, c, err)
+		return
+	}
+	logger.Infof("removed the mirror from bridge %v: %v", b.Name, m.Name)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
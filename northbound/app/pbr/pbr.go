@@ -0,0 +1,553 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package pbr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "PBR"
+
+var (
+	logger = logging.MustGetLogger("pbr")
+)
+
+const (
+	// Range of the priorities of the policy flows. They should be higher than the
+	// one of the L2 switching flows, and lower than the ones of the restriction,
+	// redirection and access control flows.
+	maxPolicyPriority = 19
+	minPolicyPriority = 11
+	// Policy flows are removed with the L2 switching flows when the topology is
+	// changed, so the MSB of the cookie should not be set. The second MSB is set
+	// not to be confused with the flow IDs used as cookies by the L2 switch.
+	flowCookie = 0x1<<62 | 0x9B8
+)
+
+type database interface {
+	Policies() ([]Policy, error)
+	AddPolicy(Policy) (id uint64, err error)
+	RemovePolicy(id uint64) (ok bool, err error)
+}
+
+// Policy forwards the IPv4 packets matched with its fields to the egress port
+// specified by DPID and Port, instead of the destination decided by the L2
+// switch. Nil networks and zero protocol numbers are wildcards.
+type Policy struct {
+	ID       uint64
+	SrcNet   *net.IPNet
+	DstNet   *net.IPNet
+	Protocol uint8
+	DstPort  uint16
+	DPID     uint64
+	Port     uint32
+}
+
+func (r Policy) String() string {
+	return fmt.Sprintf("ID=%v, Src=%v, Dst=%v, Protocol=%v, DstPort=%v, DPID=%v, Port=%v", r.ID, r.SrcNet, r.DstNet, r.Protocol, r.DstPort, r.DPID, r.Port)
+}
+
+// packet is a summary of the IPv4 headers that are compared with the policies.
+type packet struct {
+	srcIP    net.IP
+	dstIP    net.IP
+	protocol uint8
+	dstPort  uint16
+}
+
+func newPacket(eth *protocol.Ethernet) (*packet, bool) {
+	if eth.Type != 0x0800 {
+		return nil, false
+	}
+	ip := new(protocol.IPv4)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+		return nil, false
+	}
+
+	v := &packet{srcIP: ip.SrcIP, dstIP: ip.DstIP, protocol: ip.Protocol}
+	switch ip.Protocol {
+	case 6: // TCP
+		tcp := new(protocol.TCP)
+		if err := tcp.UnmarshalBinary(ip.Payload); err == nil {
+			v.dstPort = tcp.DstPort
+		}
+	case 17: // UDP
+		udp := new(protocol.UDP)
+		if err := udp.UnmarshalBinary(ip.Payload); err == nil {
+			v.dstPort = udp.DstPort
+		}
+	}
+
+	return v, true
+}
+
+func (r Policy) matches(p *packet) bool {
+	if r.SrcNet != nil && !r.SrcNet.Contains(p.srcIP) {
+		return false
+	}
+	if r.DstNet != nil && !r.DstNet.Contains(p.dstIP) {
+		return false
+	}
+	if r.Protocol != 0 && r.Protocol != p.protocol {
+		return false
+	}
+	if r.DstPort != 0 && r.DstPort != p.dstPort {
+		return false
+	}
+
+	return true
+}
+
+type PBR struct {
+	app.BaseProcessor
+	db       database
+	mutex    sync.Mutex
+	policies []Policy // Sorted by the ID. The first matched one takes precedence.
+	finder   network.Finder
+}
+
+func New(db database) *PBR {
+	return &PBR{
+		db: db,
+	}
+}
+
+func (r *PBR) Init(ctx context.Context, s app.Services) error {
+	policies, err := r.db.Policies()
+	if err != nil {
+		return errors.Wrap(err, "loading routing policies")
+	}
+	r.policies = policies
+
+	return nil
+}
+
+func (r *PBR) Name() string {
+	return appName
+}
+
+func (r *PBR) String() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%v", r.Name()))
+	for _, v := range r.policies {
+		buf.WriteString(fmt.Sprintf("\n\t%v", v))
+	}
+
+	return buf.String()
+}
+
+// lookup returns the first policy matched with p and its index in the policies.
+func (r *PBR) lookup(p *packet) (policy Policy, index int, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, v := range r.policies {
+		if v.matches(p) {
+			return v, i, true
+		}
+	}
+
+	return Policy{}, 0, false
+}
+
+// policyPriority returns the priority of the flows of the policy at index, so
+// that the earlier policy also takes precedence on the switches when the matches
+// of the flows overlap. The policies beyond the range share the lowest priority.
+func policyPriority(index int) uint16 {
+	if index >= maxPolicyPriority-minPolicyPriority {
+		return minPolicyPriority
+	}
+
+	return uint16(maxPolicyPriority - index)
+}
+
+func (r *PBR) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	r.finder = finder
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *PBR) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	p, ok := newPacket(eth)
+	if !ok {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+	policy, index, ok := r.lookup(p)
+	if !ok {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	egress, err := nextHop(finder, ingress, policy)
+	if err != nil {
+		logger.Warningf("failed to route the packet (src=%v, dst=%v) by the policy (%v): %v", p.srcIP, p.dstIP, policy, err)
+		// Fallback to the default forwarding.
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+	// Drop this packet if it goes back to the ingress port to avoid the routing loop.
+	if egress.ID() == ingress.ID() {
+		logger.Debugf("ignore the routing path that goes back to the ingress port: %v", ingress.ID())
+		return nil
+	}
+
+	if err := installPolicyFlow(ingress.Device(), policy, policyPriority(index), egress.Number()); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("installing the policy flow on %v", ingress.Device().ID()))
+	}
+	logger.Debugf("installed the policy flow (%v) on %v", policy, ingress.Device().ID())
+
+	packet, err := eth.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	// This packet has been routed. Do not pass it to the next processors.
+	return r.PacketOut(egress, packet)
+}
+
+// nextHop returns the egress port on the ingress device toward the egress port of the policy.
+func nextHop(finder network.Finder, ingress *network.Port, policy Policy) (*network.Port, error) {
+	deviceID := strconv.FormatUint(policy.DPID, 10)
+	device := finder.Device(deviceID)
+	if device == nil {
+		return nil, fmt.Errorf("unknown device: %v", deviceID)
+	}
+	port := device.Port(policy.Port)
+	if port == nil {
+		return nil, fmt.Errorf("unknown port: %v:%v", deviceID, policy.Port)
+	}
+	if v := port.Value(); v.IsPortDown() || v.IsLinkDown() {
+		return nil, fmt.Errorf("disconnected port: %v", port.ID())
+	}
+	if ingress.Device().ID() == deviceID {
+		return port, nil
+	}
+
+	path := finder.Path(ingress.Device().ID(), deviceID)
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path from %v to %v", ingress.Device().ID(), deviceID)
+	}
+
+	return path[0][0], nil
+}
+
+func installPolicyFlow(device *network.Device, policy Policy, priority uint16, outPort uint32) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	match.SetEtherType(0x0800)
+	if policy.SrcNet != nil {
+		match.SetSrcIP(policy.SrcNet)
+	}
+	if policy.DstNet != nil {
+		match.SetDstIP(policy.DstNet)
+	}
+	if policy.Protocol != 0 {
+		match.SetIPProtocol(policy.Protocol)
+		if policy.DstPort != 0 {
+			match.SetDstPort(policy.DstPort)
+		}
+	}
+
+	port := openflow.NewOutPort()
+	port.SetValue(outPort)
+	action, err := f.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(port)
+	inst, err := f.NewInstruction()
+	if err != nil {
+		return err
+	}
+	inst.ApplyAction(action)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	flow.SetIdleTimeout(30)
+	flow.SetPriority(priority)
+	flow.SetFlowMatch(match)
+	flow.SetFlowInstruction(inst)
+
+	return device.SendFlow(appName, flow)
+}
+
+// Pause removes the policy flows from all the devices, so that the packets are
+// forwarded by the L2 switch while the application is disabled.
+func (r *PBR) Pause() error {
+	r.removePolicyFlows()
+	return nil
+}
+
+// Resume removes the flows installed while the application was disabled, so
+// that the packets are evaluated with the policies again.
+func (r *PBR) Resume() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return nil
+	}
+	for _, device := range finder.Devices() {
+		if err := device.RemoveAllFlows(); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+// removePolicyFlows removes all the policy flows so that the packets are
+// evaluated again with the updated policies.
+func (r *PBR) removePolicyFlows() {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return
+	}
+	for _, device := range finder.Devices() {
+		f := device.Factory()
+		match, err := f.NewMatch()
+		if err != nil {
+			logger.Errorf("failed to create a match: %v", err)
+			continue
+		}
+		flow, err := f.NewFlowMod(openflow.FlowDelete)
+		if err != nil {
+			logger.Errorf("failed to create a flow mod: %v", err)
+			continue
+		}
+		flow.SetCookie(flowCookie)
+		flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+		flow.SetTableID(0xFF) // ALL
+		flow.SetFlowMatch(match)
+		if err := device.SendFlow(appName, flow); err != nil {
+			logger.Errorf("failed to remove the policy flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+}
+
+func (r *PBR) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Get("/api/v1/pbr", r.listPolicy),
+		rest.Post("/api/v1/pbr", r.addPolicy),
+		rest.Delete("/api/v1/pbr/:id", r.removePolicy),
+		rest.Options("/api/v1/pbr/:id", r.allowOrigin),
+	}
+}
+
+func (r *PBR) allowOrigin(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE")
+}
+
+type policyParam struct {
+	ID       uint64 `json:"id"`
+	SrcNet   string `json:"src_net"`
+	DstNet   string `json:"dst_net"`
+	Protocol uint8  `json:"protocol"`
+	DstPort  uint16 `json:"dst_port"`
+	DPID     uint64 `json:"dpid"`
+	Port     uint32 `json:"port"`
+}
+
+// parseCIDR parses s as a CIDR notation, or a single IPv4 address. Empty s means any address.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	if !strings.Contains(s, "/") {
+		s += "/32"
+	}
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("not an IPv4 network: %v", s)
+	}
+
+	return n, nil
+}
+
+func (r *policyParam) toPolicy() (Policy, error) {
+	src, err := parseCIDR(r.SrcNet)
+	if err != nil {
+		return Policy{}, err
+	}
+	dst, err := parseCIDR(r.DstNet)
+	if err != nil {
+		return Policy{}, err
+	}
+	if r.DstPort != 0 && r.Protocol != 6 && r.Protocol != 17 {
+		return Policy{}, errors.New("destination port requires TCP or UDP protocol")
+	}
+	if r.DPID == 0 || r.Port == 0 {
+		return Policy{}, errors.New("egress DPID and port are required")
+	}
+
+	return Policy{
+		SrcNet:   src,
+		DstNet:   dst,
+		Protocol: r.Protocol,
+		DstPort:  r.DstPort,
+		DPID:     r.DPID,
+		Port:     r.Port,
+	}, nil
+}
+
+func newPolicyParam(policy Policy) policyParam {
+	v := policyParam{
+		ID:       policy.ID,
+		Protocol: policy.Protocol,
+		DstPort:  policy.DstPort,
+		DPID:     policy.DPID,
+		Port:     policy.Port,
+	}
+	if policy.SrcNet != nil {
+		v.SrcNet = policy.SrcNet.String()
+	}
+	if policy.DstNet != nil {
+		v.DstNet = policy.DstNet.String()
+	}
+
+	return v
+}
+
+func (r *PBR) listPolicy(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	r.mutex.Lock()
+	policies := []policyParam{}
+	for _, v := range r.policies {
+		policies = append(policies, newPolicyParam(v))
+	}
+	r.mutex.Unlock()
+
+	w.WriteJson(&struct {
+		Policies []policyParam `json:"policies"`
+	}{policies})
+}
+
+func (r *PBR) addPolicy(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	param := policyParam{}
+	if err := req.DecodeJsonPayload(&param); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	policy, err := param.toPolicy()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := r.db.AddPolicy(policy)
+	if err != nil {
+		logger.Errorf("failed to add a new routing policy: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	policy.ID = id
+	logger.Infof("added a new routing policy: %v", policy)
+
+	r.mutex.Lock()
+	r.policies = append(r.policies, policy)
+	r.mutex.Unlock()
+	r.removePolicyFlows()
+
+	w.WriteJson(&struct {
+		ID uint64 `json:"id"`
+	}{id})
+}
+
+func (r *PBR) removePolicy(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.ParseUint(req.PathParam("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid policy id"))
+		return
+	}
+
+	ok, err := r.db.RemovePolicy(id)
+	if err != nil {
+		logger.Errorf("failed to remove a routing policy: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown policy id"))
+		return
+	}
+	logger.Infof("removed the routing policy: id=%v", id)
+
+	r.mutex.Lock()
+	for i, v := range r.policies {
+		if v.ID == id {
+			r.policies = append(r.policies[:i], r.policies[i+1:]...)
+			break
+		}
+	}
+	r.mutex.Unlock()
+	r.removePolicyFlows()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,59 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package pbr
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPolicyPriority(t *testing.T) {
+	_, all, _ := net.ParseCIDR("10.0.0.0/8")
+	_, host, _ := net.ParseCIDR("10.0.0.1/32")
+	r := New(nil)
+	r.policies = []Policy{
+		{ID: 1, DstNet: host, Protocol: 6},
+		{ID: 2, DstNet: all},
+	}
+
+	p := &packet{srcIP: net.ParseIP("10.0.0.2"), dstIP: net.ParseIP("10.0.0.1"), protocol: 6}
+	policy, index, ok := r.lookup(p)
+	if !ok || policy.ID != 1 || index != 0 {
+		t.Fatalf("unexpected policy: %v, index=%v, ok=%v", policy, index, ok)
+	}
+	p.protocol = 17
+	policy, index, ok = r.lookup(p)
+	if !ok || policy.ID != 2 || index != 1 {
+		t.Fatalf("unexpected policy: %v, index=%v, ok=%v", policy, index, ok)
+	}
+
+	// The earlier policy should have the higher priority.
+	if policyPriority(0) <= policyPriority(1) {
+		t.Fatalf("unexpected priorities: %v, %v", policyPriority(0), policyPriority(1))
+	}
+	for i := 0; i < 100; i++ {
+		v := policyPriority(i)
+		if v < minPolicyPriority || v > maxPolicyPriority {
+			t.Fatalf("unexpected priority of the policy %v: %v", i, v)
+		}
+	}
+}
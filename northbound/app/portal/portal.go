@@ -0,0 +1,472 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package portal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "Portal"
+
+var (
+	logger = logging.MustGetLogger("portal")
+)
+
+const (
+	// We use MSB of the cookie to mark the flows that should survive RemoveAllFlows().
+	flowCookie = 0x1<<63 | 0x0080
+	// Priority of the redirection flows. It should be higher than the one of
+	// the L2 switching flows.
+	redirectPriority = 20
+)
+
+type Portal struct {
+	app.BaseProcessor
+	conf       app.Config
+	url        *url.URL
+	ip         net.IP
+	mutex      sync.Mutex
+	authorized map[string]bool          // Key = MAC address.
+	redirected map[string]*network.Port // Key = MAC address.
+	finder     network.Finder
+	// Cancels the subscription of the hosts authenticated by the other applications.
+	unsubscribe func()
+}
+
+func New(conf app.Config) *Portal {
+	return &Portal{
+		authorized: make(map[string]bool),
+		redirected: make(map[string]*network.Port),
+		conf:       conf,
+	}
+}
+
+func (r *Portal) Init(ctx context.Context, s app.Services) error {
+	u, err := url.Parse(r.conf.GetString("url"))
+	if err != nil || len(u.Host) == 0 {
+		return errors.New("invalid portal.url in the config file")
+	}
+	r.url = u
+
+	ip := net.ParseIP(r.conf.GetString("ip"))
+	if ip == nil || ip.To4() == nil {
+		return errors.New("invalid portal.ip in the config file")
+	}
+	r.ip = ip.To4()
+	// The hosts authenticated by the other applications, e.g., 802.1X by Auth, skip the portal.
+	r.unsubscribe = event.OnHostAuthenticated(r.onHostAuthenticated)
+
+	return nil
+}
+
+// Stop stops authorizing the hosts authenticated by the other applications.
+func (r *Portal) Stop() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+}
+
+func (r *Portal) onHostAuthenticated(v event.HostAuth) {
+	if v.Source == r.Name() {
+		return
+	}
+	if err := r.Authorize(v.MAC); err != nil {
+		logger.Errorf("failed to authorize the host authenticated by %v (MAC=%v): %v", v.Source, v.MAC, err)
+	}
+}
+
+func (r *Portal) Name() string {
+	return appName
+}
+
+func (r *Portal) String() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%v: URL=%v, IP=%v", r.Name(), r.url, r.ip))
+	for mac := range r.authorized {
+		buf.WriteString(fmt.Sprintf("\n\tAuthorized MAC=%v", mac))
+	}
+
+	return buf.String()
+}
+
+func (r *Portal) isAuthorized(mac net.HardwareAddr) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.authorized[mac.String()]
+}
+
+func (r *Portal) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	// Ports between switches are not subject to the redirection.
+	if finder.IsEdge(ingress) || r.isAuthorized(eth.SrcMAC) {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	if err := r.redirect(ingress, eth.SrcMAC); err != nil {
+		logger.Errorf("failed to install the redirection flow (MAC=%v): %v", eth.SrcMAC, err)
+	}
+
+	switch eth.Type {
+	case 0x0806: // ARP
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	case 0x0800: // IPv4
+		return r.handleIPv4(finder, ingress, eth)
+	default:
+		// Drop this packet.
+		return nil
+	}
+}
+
+func (r *Portal) handleIPv4(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	ip := new(protocol.IPv4)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+		return err
+	}
+	// Remove the Ethernet padding.
+	if n := int(ip.Length) - int(ip.IHL)*4; n >= 0 && n < len(ip.Payload) {
+		ip.Payload = ip.Payload[:n]
+	}
+
+	// Unauthorized hosts can access the portal server.
+	if ip.DstIP.Equal(r.ip) {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	switch ip.Protocol {
+	case 17: // UDP
+		udp := new(protocol.UDP)
+		if err := udp.UnmarshalBinary(ip.Payload); err != nil {
+			return err
+		}
+		switch udp.DstPort {
+		case 67: // DHCP
+			return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+		case 53: // DNS
+			return r.replyDNS(ingress, eth, ip, udp)
+		}
+	case 6: // TCP
+		tcp := new(protocol.TCP)
+		if err := tcp.UnmarshalBinary(ip.Payload); err != nil {
+			return err
+		}
+		if tcp.DstPort == 80 {
+			return r.replyHTTP(ingress, eth, ip, tcp)
+		}
+	}
+
+	// Drop this packet.
+	return nil
+}
+
+// redirect installs a flow that forwards all the packets from the unauthorized
+// host to the controller so that they cannot bypass the redirection using the
+// flows installed for other hosts.
+func (r *Portal) redirect(ingress *network.Port, mac net.HardwareAddr) error {
+	r.mutex.Lock()
+	if _, ok := r.redirected[mac.String()]; ok {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.redirected[mac.String()] = ingress
+	r.mutex.Unlock()
+
+	device := ingress.Device()
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(ingress.Number())
+	match.SetInPort(inPort)
+	match.SetSrcMAC(mac)
+
+	outPort := openflow.NewOutPort()
+	outPort.SetController()
+	action, err := f.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(outPort)
+	inst, err := f.NewInstruction()
+	if err != nil {
+		return err
+	}
+	inst.ApplyAction(action)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	// Permanent flow that will be removed when the host is authorized.
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(0)
+	flow.SetPriority(redirectPriority)
+	flow.SetFlowMatch(match)
+	flow.SetFlowInstruction(inst)
+	logger.Debugf("redirecting the unauthorized host: port=%v, MAC=%v", ingress.ID(), mac)
+
+	return device.SendFlow(appName, flow)
+}
+
+func removeRedirection(port *network.Port, mac net.HardwareAddr) error {
+	device := port.Device()
+	if device.IsClosed() {
+		return nil
+	}
+
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(port.Number())
+	match.SetInPort(inPort)
+	match.SetSrcMAC(mac)
+
+	flow, err := f.NewFlowMod(openflow.FlowDelete)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+	flow.SetTableID(0xFF) // ALL
+	flow.SetFlowMatch(match)
+
+	return device.SendFlow(appName, flow)
+}
+
+// Pause removes the redirection flows from all the devices, so that the
+// unauthorized hosts are not redirected while the application is disabled.
+func (r *Portal) Pause() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.redirected = make(map[string]*network.Port)
+	r.mutex.Unlock()
+
+	if finder != nil {
+		removeRedirections(finder.Devices())
+	}
+
+	return nil
+}
+
+// Resume removes the flows installed while the application was disabled, so
+// that the unauthorized hosts are redirected again.
+func (r *Portal) Resume() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+
+	if finder == nil {
+		return nil
+	}
+	for _, device := range finder.Devices() {
+		if err := device.RemoveAllFlows(); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+func removeRedirections(devices []*network.Device) {
+	for _, device := range devices {
+		if device.IsClosed() {
+			continue
+		}
+		f := device.Factory()
+		match, err := f.NewMatch()
+		if err != nil {
+			logger.Errorf("failed to create a match: %v", err)
+			continue
+		}
+		flow, err := f.NewFlowMod(openflow.FlowDelete)
+		if err != nil {
+			logger.Errorf("failed to create a flow mod: %v", err)
+			continue
+		}
+		flow.SetCookie(flowCookie)
+		flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+		flow.SetTableID(0xFF) // ALL
+		flow.SetFlowMatch(match)
+		if err := device.SendFlow(appName, flow); err != nil {
+			logger.Errorf("failed to remove the redirection flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+}
+
+// Authorize allows full access to the network for the host whose MAC address is mac.
+func (r *Portal) Authorize(mac net.HardwareAddr) error {
+	r.mutex.Lock()
+	r.authorized[mac.String()] = true
+	port, ok := r.redirected[mac.String()]
+	delete(r.redirected, mac.String())
+	r.mutex.Unlock()
+
+	logger.Infof("host authorized: MAC=%v", mac)
+	if !ok {
+		return nil
+	}
+
+	return removeRedirection(port, mac)
+}
+
+// Deauthorize revokes the access to the network for the host whose MAC address is mac.
+func (r *Portal) Deauthorize(finder network.Finder, mac net.HardwareAddr) {
+	r.mutex.Lock()
+	delete(r.authorized, mac.String())
+	r.mutex.Unlock()
+
+	logger.Infof("host deauthorized: MAC=%v", mac)
+	if finder == nil {
+		return
+	}
+	// Remove the flows heading to the host. The host will be redirected again
+	// when its packet is delivered to the controller.
+	for _, device := range finder.Devices() {
+		if err := device.RemoveFlowByMAC(mac); err != nil {
+			logger.Errorf("failed to remove flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+}
+
+func (r *Portal) OnPortDown(finder network.Finder, port *network.Port) error {
+	r.mutex.Lock()
+	for k, v := range r.redirected {
+		if v.ID() == port.ID() {
+			delete(r.redirected, k)
+		}
+	}
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnPortDown(finder, port)
+}
+
+func (r *Portal) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	for k, v := range r.redirected {
+		if v.Device().ID() == device.ID() {
+			delete(r.redirected, k)
+		}
+	}
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
+
+func (r *Portal) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	// Remember the finder so that the REST handlers can use it.
+	r.mutex.Lock()
+	r.finder = finder
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *Portal) Routes() []*rest.Route {
+	return []*rest.Route{
+		rest.Post("/api/v1/portal/host", r.authorizeHost),
+		rest.Delete("/api/v1/portal/host/:mac", r.deauthorizeHost),
+		rest.Options("/api/v1/portal/host/:mac", r.allowOrigin),
+	}
+}
+
+func (r *Portal) allowOrigin(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE")
+}
+
+func (r *Portal) authorizeHost(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	param := struct {
+		MAC string `json:"mac"`
+	}{}
+	if err := req.DecodeJsonPayload(&param); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	mac, err := net.ParseMAC(param.MAC)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := r.Authorize(mac); err != nil {
+		logger.Errorf("failed to authorize the host: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	event.NotifyHostAuthenticated(event.HostAuth{MAC: mac, Source: r.Name()})
+	w.WriteJson(&struct {
+		MAC string `json:"mac"`
+	}{mac.String()})
+}
+
+func (r *Portal) deauthorizeHost(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	mac, err := net.ParseMAC(req.PathParam("mac"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+	r.Deauthorize(finder, mac)
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
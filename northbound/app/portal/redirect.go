@@ -0,0 +1,185 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package portal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/protocol"
+)
+
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// replyDNS answers the DNS query with the portal IP address regardless of the queried name.
+func (r *Portal) replyDNS(ingress *network.Port, eth *protocol.Ethernet, ip *protocol.IPv4, udp *protocol.UDP) error {
+	answer, err := makeDNSAnswer(udp.Payload, r.ip)
+	if err != nil {
+		logger.Debugf("ignoring the invalid DNS query from %v: %v", ip.SrcIP, err)
+		return nil
+	}
+
+	reply := protocol.UDP{
+		SrcPort: udp.DstPort,
+		DstPort: udp.SrcPort,
+		Length:  uint16(8 + len(answer)),
+		Payload: answer,
+	}
+	reply.SetPseudoHeader(ip.DstIP, ip.SrcIP)
+	payload, err := reply.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return r.sendIPv4(ingress, eth, ip, 17, payload)
+}
+
+// makeDNSAnswer makes a DNS response of query that has an A record of ip. The
+// TTL of the record is one second as the host will be authorized soon.
+func makeDNSAnswer(query []byte, ip net.IP) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, errors.New("too short DNS message")
+	}
+	// Standard query?
+	if query[2]&0xF8 != 0 {
+		return nil, errors.New("not a standard query")
+	}
+	if binary.BigEndian.Uint16(query[4:6]) != 1 {
+		return nil, errors.New("unsupported number of questions")
+	}
+
+	// Find the end of the question name.
+	offset := 12
+	for {
+		if offset >= len(query) {
+			return nil, errors.New("invalid question name")
+		}
+		length := int(query[offset])
+		if length == 0 {
+			offset++
+			break
+		}
+		if length&0xC0 != 0 {
+			return nil, errors.New("compressed question name")
+		}
+		offset += length + 1
+	}
+	if offset+4 > len(query) {
+		return nil, errors.New("invalid question")
+	}
+	qtype := binary.BigEndian.Uint16(query[offset : offset+2])
+	qclass := binary.BigEndian.Uint16(query[offset+2 : offset+4])
+	question := query[12 : offset+4]
+
+	v := make([]byte, 12, 12+len(question)+16)
+	copy(v[0:2], query[0:2])              // ID
+	v[2] = 0x80 | query[2]&0x01           // QR and RD
+	v[3] = 0x80                           // RA
+	binary.BigEndian.PutUint16(v[4:6], 1) // QDCOUNT
+	v = append(v, question...)
+	// We only answer to the A record query. Other queries get an empty answer.
+	if qtype != 1 || qclass != 1 {
+		return v, nil
+	}
+	binary.BigEndian.PutUint16(v[6:8], 1) // ANCOUNT
+
+	rr := make([]byte, 16)
+	binary.BigEndian.PutUint16(rr[0:2], 0xC00C) // Pointer to the question name
+	binary.BigEndian.PutUint16(rr[2:4], 1)      // Type A
+	binary.BigEndian.PutUint16(rr[4:6], 1)      // Class IN
+	binary.BigEndian.PutUint32(rr[6:10], 1)     // TTL
+	binary.BigEndian.PutUint16(rr[10:12], 4)    // RDLENGTH
+	copy(rr[12:16], ip.To4())
+
+	return append(v, rr...), nil
+}
+
+// replyHTTP emulates the web server that the host tries to connect, and then
+// responds to the HTTP request with a redirection to the portal.
+func (r *Portal) replyHTTP(ingress *network.Port, eth *protocol.Ethernet, ip *protocol.IPv4, tcp *protocol.TCP) error {
+	reply := protocol.TCP{
+		SrcPort:    tcp.DstPort,
+		DstPort:    tcp.SrcPort,
+		WindowSize: 0xFFFF,
+	}
+
+	switch {
+	case tcp.Flags&tcpRST != 0:
+		return nil
+	case tcp.Flags&tcpSYN != 0:
+		reply.Flags = tcpSYN | tcpACK
+		reply.Sequence = rand.Uint32()
+		reply.Acknowledgment = tcp.Sequence + 1
+	case len(tcp.Payload) > 0:
+		reply.Flags = tcpPSH | tcpACK | tcpFIN
+		reply.Sequence = tcp.Acknowledgment
+		reply.Acknowledgment = tcp.Sequence + uint32(len(tcp.Payload))
+		reply.Payload = []byte(fmt.Sprintf("HTTP/1.1 302 Found\r\nLocation: %v\r\nContent-Length: 0\r\nCache-Control: no-cache\r\nConnection: close\r\n\r\n", r.url))
+	case tcp.Flags&tcpFIN != 0:
+		reply.Flags = tcpACK
+		reply.Sequence = tcp.Acknowledgment
+		reply.Acknowledgment = tcp.Sequence + 1
+	default:
+		// Pure ACK
+		return nil
+	}
+
+	reply.SetPseudoHeader(ip.DstIP, ip.SrcIP)
+	payload, err := reply.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return r.sendIPv4(ingress, eth, ip, 6, payload)
+}
+
+// sendIPv4 sends payload to the host in the reverse direction of the original packet.
+func (r *Portal) sendIPv4(ingress *network.Port, eth *protocol.Ethernet, ip *protocol.IPv4, protocolNum uint8, payload []byte) error {
+	reply := protocol.NewIPv4(ip.DstIP, ip.SrcIP, protocolNum, payload)
+	data, err := reply.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	frame := protocol.Ethernet{
+		SrcMAC:  eth.DstMAC,
+		DstMAC:  eth.SrcMAC,
+		Type:    0x0800,
+		Payload: data,
+	}
+	packet, err := frame.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return r.PacketOut(ingress, packet)
+}
@@ -22,18 +22,27 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/superkkt/cherry/network"
 	"github.com/superkkt/cherry/openflow"
 	"github.com/superkkt/cherry/protocol"
+
+	"github.com/ant0ine/go-json-rest/rest"
 )
 
 // Processor should prepare to be executed by multiple goroutines simultaneously.
 type Processor interface {
 	Dependencies() []string
 	fmt.Stringer
-	Init() error
+	// Init is called once when the application is enabled for the first time. ctx is
+	// cancelled when the controller is shutting down.
+	Init(ctx context.Context, s Services) error
+	// Stop is called when the controller is shutting down to release the resources of
+	// the application.
+	Stop()
 	// Name returns the application name that is globally unique
 	Name() string
 	network.EventListener
@@ -41,14 +50,60 @@ type Processor interface {
 	SetNext(Processor)
 }
 
+// RESTHandler is an optional interface for the applications that provide their own REST APIs.
+type RESTHandler interface {
+	// Routes returns REST routes that will be served by the REST server of the controller.
+	Routes() []*rest.Route
+}
+
+// Reloader is an optional interface for the applications that can apply the changes of the config file at runtime.
+type Reloader interface {
+	// Reload reads the config file again. The application should keep its current settings if it returns an error.
+	Reload() error
+}
+
+// Pauser is an optional interface for the applications that clean up when they are disabled at runtime.
+type Pauser interface {
+	// Pause is called after the application is removed from the processor chain. It should remove the flows
+	// installed by the application, as they are not maintained while it is disabled.
+	Pause() error
+	// Resume is called after the paused application is added to the processor chain again.
+	Resume() error
+}
+
+// PacketFilter is an optional interface for the applications that only process some PACKET_INs. The other
+// PACKET_INs skip the application, so that they are not parsed by it.
+type PacketFilter interface {
+	// Interests returns the packets processed by the application. Empty means all the packets.
+	Interests() []Interest
+}
+
+// Interest matches the packets by their headers. Zero fields match any value.
+type Interest struct {
+	EtherType uint16
+	// IP protocol number of an IPv4 or IPv6 packet, e.g., 6 for TCP.
+	IPProtocol uint8
+	// Destination port of a TCP or UDP packet.
+	Port uint16
+}
+
+// HealthChecker is an optional interface for the applications that can report their own health.
+type HealthChecker interface {
+	// Health returns nil if the application works properly.
+	Health() error
+}
+
 type BaseProcessor struct {
-	next Processor
+	mutex sync.RWMutex
+	next  Processor
 }
 
-func (r *BaseProcessor) Init() error {
+func (r *BaseProcessor) Init(ctx context.Context, s Services) error {
 	return nil
 }
 
+func (r *BaseProcessor) Stop() {}
+
 func (r *BaseProcessor) Name() string {
 	return "BaseProcessor"
 }
@@ -63,7 +118,10 @@ func (r *BaseProcessor) OnPacketIn(finder network.Finder, ingress *network.Port,
 	if !ok {
 		return nil
 	}
-	return next.OnPacketIn(finder, ingress, eth)
+	span := network.SpanOf(finder).StartChild(next.Name())
+	defer span.Finish()
+
+	return next.OnPacketIn(network.WithSpan(finder, span), ingress, eth)
 }
 
 func (r *BaseProcessor) OnDeviceUp(finder network.Finder, device *network.Device) error {
@@ -102,6 +160,24 @@ func (r *BaseProcessor) OnPortDown(finder network.Finder, port *network.Port) er
 	return next.OnPortDown(finder, port)
 }
 
+func (r *BaseProcessor) OnLinkUp(finder network.Finder, link [2]*network.Port) error {
+	// Do nothging and execute the next processor if it exists
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+	return next.OnLinkUp(finder, link)
+}
+
+func (r *BaseProcessor) OnLinkDown(finder network.Finder, link [2]*network.Port) error {
+	// Do nothging and execute the next processor if it exists
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+	return next.OnLinkDown(finder, link)
+}
+
 func (r *BaseProcessor) OnTopologyChange(finder network.Finder) error {
 	// Do nothging and execute the next processor if it exists
 	next, ok := r.Next()
@@ -121,6 +197,9 @@ func (r *BaseProcessor) OnFlowRemoved(finder network.Finder, flow openflow.FlowR
 }
 
 func (r *BaseProcessor) Next() (next Processor, ok bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	if r.next != nil {
 		return r.next, true
 	}
@@ -129,6 +208,9 @@ func (r *BaseProcessor) Next() (next Processor, ok bool) {
 }
 
 func (r *BaseProcessor) SetNext(next Processor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	r.next = next
 }
 
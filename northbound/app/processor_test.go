@@ -0,0 +1,77 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package app
+
+import (
+	"testing"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/protocol"
+	"github.com/superkkt/cherry/trace"
+)
+
+type benchmarkProcessor struct {
+	BaseProcessor
+	name string
+}
+
+func (r *benchmarkProcessor) Name() string {
+	return r.name
+}
+
+func (r *benchmarkProcessor) String() string {
+	return r.name
+}
+
+// BenchmarkProcessorChain measures passing a PACKET_IN through the chain of
+// the applications that do nothing, with and without the tracing.
+func BenchmarkProcessorChain(b *testing.B) {
+	const length = 10
+
+	head := &benchmarkProcessor{name: "head"}
+	var tail Processor = head
+	for i := 1; i < length; i++ {
+		v := &benchmarkProcessor{name: "app"}
+		tail.SetNext(v)
+		tail = v
+	}
+	eth := &protocol.Ethernet{Type: 0x0806}
+
+	for _, v := range []struct {
+		name string
+		rate float64
+	}{{"untraced", 0}, {"traced", 1}} {
+		b.Run(v.name, func(b *testing.B) {
+			trace.SetSampleRate(v.rate)
+			defer trace.SetSampleRate(0)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				span := trace.Start("PACKET_IN")
+				if err := head.OnPacketIn(network.WithSpan(nil, span), nil, eth); err != nil {
+					b.Fatal(err)
+				}
+				span.Finish()
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ package proxyarp
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 
@@ -54,7 +55,7 @@ func New(db database) *ProxyARP {
 	}
 }
 
-func (r *ProxyARP) Init() error {
+func (r *ProxyARP) Init(ctx context.Context, s app.Services) error {
 	return nil
 }
 
@@ -62,6 +63,10 @@ func (r *ProxyARP) Name() string {
 	return "ProxyARP"
 }
 
+func (r *ProxyARP) Interests() []app.Interest {
+	return []app.Interest{{EtherType: 0x0806}}
+}
+
 func (r *ProxyARP) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
 	// ARP?
 	if eth.Type != 0x0806 {
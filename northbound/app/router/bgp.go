@@ -0,0 +1,359 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package router
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// This is a minimal BGP-4 (RFC 4271) speaker that only learns the IPv4 unicast
+// routes from a single peer. It never advertises any route to the peer.
+
+const (
+	bgpMsgOpen         = 1
+	bgpMsgUpdate       = 2
+	bgpMsgNotification = 3
+	bgpMsgKeepalive    = 4
+
+	bgpHeaderLength = 19
+	bgpMaxLength    = 4096
+
+	bgpAttrNextHop = 3
+	// Extended length bit of the path attribute flags.
+	bgpAttrExtended = 0x10
+
+	bgpDefaultHoldTime = 90
+	bgpConnectTimeout  = 10 * time.Second
+	bgpRetryInterval   = 30 * time.Second
+)
+
+type bgpConfig struct {
+	localAS  uint16
+	routerID net.IP
+	peer     string // Address of the peer in host:port.
+	peerAS   uint16
+	holdTime uint16 // In seconds.
+}
+
+// bgpListener is notified whenever the routes are learned from the peer.
+type bgpListener interface {
+	// onBGPUpdate is called when the peer announces the routes in nlri via
+	// nextHop, or withdraws the routes in withdrawn.
+	onBGPUpdate(nlri []*net.IPNet, nextHop net.IP, withdrawn []*net.IPNet)
+	// onBGPDown is called when the session is closed, so that all the routes
+	// learned from the peer should be removed.
+	onBGPDown()
+}
+
+type bgpSpeaker struct {
+	config   bgpConfig
+	listener bgpListener
+}
+
+func newBGPSpeaker(config bgpConfig, listener bgpListener) *bgpSpeaker {
+	if config.holdTime == 0 {
+		config.holdTime = bgpDefaultHoldTime
+	}
+
+	return &bgpSpeaker{
+		config:   config,
+		listener: listener,
+	}
+}
+
+// run establishes the session with the peer, and re-establishes it whenever it is closed.
+func (r *bgpSpeaker) run() {
+	for {
+		err := r.session()
+		logger.Errorf("BGP session with %v has been closed: %v", r.config.peer, err)
+		r.listener.onBGPDown()
+		time.Sleep(bgpRetryInterval)
+	}
+}
+
+func (r *bgpSpeaker) session() error {
+	conn, err := net.DialTimeout("tcp", r.config.peer, bgpConnectTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s := &bgpSession{conn: conn}
+	if err := s.write(bgpMsgOpen, r.openMessage()); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(bgpConnectTimeout))
+	t, body, err := s.read()
+	if err != nil {
+		return err
+	}
+	if t != bgpMsgOpen {
+		return fmt.Errorf("unexpected BGP message type: %v", t)
+	}
+	holdTime, err := r.checkOpen(body)
+	if err != nil {
+		return err
+	}
+	if err := s.write(bgpMsgKeepalive, nil); err != nil {
+		return err
+	}
+	logger.Infof("BGP session with %v (AS%v) has been established: holdTime=%v", r.config.peer, r.config.peerAS, holdTime)
+
+	done := make(chan struct{})
+	defer close(done)
+	if holdTime > 0 {
+		go s.keepalive(holdTime/3, done)
+	}
+
+	for {
+		if holdTime > 0 {
+			conn.SetReadDeadline(time.Now().Add(holdTime))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		t, body, err := s.read()
+		if err != nil {
+			return err
+		}
+
+		switch t {
+		case bgpMsgKeepalive:
+			// Nothing to do.
+		case bgpMsgUpdate:
+			nlri, nextHop, withdrawn, err := parseUpdate(body)
+			if err != nil {
+				return errors.Wrap(err, "invalid BGP update message")
+			}
+			if len(nlri) > 0 || len(withdrawn) > 0 {
+				r.listener.onBGPUpdate(nlri, nextHop, withdrawn)
+			}
+		case bgpMsgNotification:
+			if len(body) < 2 {
+				return errors.New("invalid BGP notification message")
+			}
+			return fmt.Errorf("BGP notification from the peer: code=%v, subcode=%v", body[0], body[1])
+		default:
+			return fmt.Errorf("unexpected BGP message type: %v", t)
+		}
+	}
+}
+
+func (r *bgpSpeaker) openMessage() []byte {
+	v := make([]byte, 10)
+	v[0] = 4 // Version
+	binary.BigEndian.PutUint16(v[1:3], r.config.localAS)
+	binary.BigEndian.PutUint16(v[3:5], r.config.holdTime)
+	copy(v[5:9], r.config.routerID.To4())
+	// No optional parameters.
+	v[9] = 0
+
+	return v
+}
+
+// checkOpen validates the OPEN message from the peer, and then returns the negotiated hold time.
+func (r *bgpSpeaker) checkOpen(body []byte) (time.Duration, error) {
+	if len(body) < 10 {
+		return 0, errors.New("invalid BGP open message")
+	}
+	if body[0] != 4 {
+		return 0, fmt.Errorf("unsupported BGP version: %v", body[0])
+	}
+	if as := binary.BigEndian.Uint16(body[1:3]); as != r.config.peerAS {
+		return 0, fmt.Errorf("unexpected peer AS: expected=%v, actual=%v", r.config.peerAS, as)
+	}
+	holdTime := binary.BigEndian.Uint16(body[3:5])
+	if holdTime == 1 || holdTime == 2 {
+		return 0, fmt.Errorf("invalid BGP hold time: %v", holdTime)
+	}
+	if holdTime > r.config.holdTime {
+		holdTime = r.config.holdTime
+	}
+
+	return time.Duration(holdTime) * time.Second, nil
+}
+
+type bgpSession struct {
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+func (r *bgpSession) write(t uint8, body []byte) error {
+	msg := make([]byte, bgpHeaderLength+len(body))
+	// Marker
+	for i := 0; i < 16; i++ {
+		msg[i] = 0xFF
+	}
+	binary.BigEndian.PutUint16(msg[16:18], uint16(len(msg)))
+	msg[18] = t
+	copy(msg[bgpHeaderLength:], body)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, err := r.conn.Write(msg)
+
+	return err
+}
+
+func (r *bgpSession) read() (t uint8, body []byte, err error) {
+	header := make([]byte, bgpHeaderLength)
+	if _, err := io.ReadFull(r.conn, header); err != nil {
+		return 0, nil, err
+	}
+	if !bytes.Equal(header[:16], bytes.Repeat([]byte{0xFF}, 16)) {
+		return 0, nil, errors.New("invalid BGP marker")
+	}
+	length := binary.BigEndian.Uint16(header[16:18])
+	if length < bgpHeaderLength || length > bgpMaxLength {
+		return 0, nil, fmt.Errorf("invalid BGP message length: %v", length)
+	}
+
+	body = make([]byte, length-bgpHeaderLength)
+	if _, err := io.ReadFull(r.conn, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header[18], body, nil
+}
+
+func (r *bgpSession) keepalive(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := r.write(bgpMsgKeepalive, nil); err != nil {
+				logger.Errorf("failed to send the BGP keepalive: %v", err)
+				// Closing the connection makes the session loop return.
+				r.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// parseUpdate parses the body of an UPDATE message.
+func parseUpdate(body []byte) (nlri []*net.IPNet, nextHop net.IP, withdrawn []*net.IPNet, err error) {
+	if len(body) < 2 {
+		return nil, nil, nil, errors.New("too short withdrawn routes length")
+	}
+	length := int(binary.BigEndian.Uint16(body[0:2]))
+	body = body[2:]
+	if len(body) < length {
+		return nil, nil, nil, errors.New("too short withdrawn routes")
+	}
+	withdrawn, err = parsePrefixes(body[:length])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	body = body[length:]
+
+	if len(body) < 2 {
+		return nil, nil, nil, errors.New("too short path attributes length")
+	}
+	length = int(binary.BigEndian.Uint16(body[0:2]))
+	body = body[2:]
+	if len(body) < length {
+		return nil, nil, nil, errors.New("too short path attributes")
+	}
+	nextHop, err = parseNextHop(body[:length])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	nlri, err = parsePrefixes(body[length:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(nlri) > 0 && nextHop == nil {
+		return nil, nil, nil, errors.New("missing the next hop attribute")
+	}
+
+	return nlri, nextHop, withdrawn, nil
+}
+
+// parseNextHop returns the value of the NEXT_HOP attribute in attrs, or nil if there is no such attribute.
+func parseNextHop(attrs []byte) (net.IP, error) {
+	for len(attrs) > 0 {
+		if len(attrs) < 3 {
+			return nil, errors.New("too short path attribute")
+		}
+		flags, t := attrs[0], attrs[1]
+		var length, offset int
+		if flags&bgpAttrExtended != 0 {
+			if len(attrs) < 4 {
+				return nil, errors.New("too short path attribute")
+			}
+			length, offset = int(binary.BigEndian.Uint16(attrs[2:4])), 4
+		} else {
+			length, offset = int(attrs[2]), 3
+		}
+		if len(attrs) < offset+length {
+			return nil, errors.New("too short path attribute value")
+		}
+		value := attrs[offset : offset+length]
+		attrs = attrs[offset+length:]
+
+		if t != bgpAttrNextHop {
+			continue
+		}
+		if len(value) != 4 {
+			return nil, fmt.Errorf("invalid next hop length: %v", len(value))
+		}
+		return net.IPv4(value[0], value[1], value[2], value[3]).To4(), nil
+	}
+
+	return nil, nil
+}
+
+// parsePrefixes parses the list of the IPv4 prefixes encoded as the pairs of the length and the prefix.
+func parsePrefixes(b []byte) ([]*net.IPNet, error) {
+	result := []*net.IPNet{}
+	for len(b) > 0 {
+		length := int(b[0])
+		if length > 32 {
+			return nil, fmt.Errorf("invalid prefix length: %v", length)
+		}
+		n := (length + 7) / 8
+		if len(b) < 1+n {
+			return nil, errors.New("too short prefix")
+		}
+		ip := make(net.IP, 4)
+		copy(ip, b[1:1+n])
+		mask := net.CIDRMask(length, 32)
+		result = append(result, &net.IPNet{IP: ip.Mask(mask), Mask: mask})
+		b = b[1+n:]
+	}
+
+	return result, nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package router
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseUpdate(t *testing.T) {
+	body := []byte{
+		// Withdrawn routes: 172.16.0.0/12
+		0x00, 0x03, 12, 172, 16,
+		// Path attributes: ORIGIN=IGP, NEXT_HOP=10.0.1.254
+		0x00, 0x0B,
+		0x40, 0x01, 0x01, 0x00,
+		0x40, 0x03, 0x04, 10, 0, 1, 254,
+		// NLRI: 192.168.10.0/24, 0.0.0.0/0
+		24, 192, 168, 10,
+		0,
+	}
+
+	nlri, nextHop, withdrawn, err := parseUpdate(body)
+	if err != nil {
+		t.Fatalf("failed to parse the update message: %v", err)
+	}
+	if !nextHop.Equal(net.ParseIP("10.0.1.254")) {
+		t.Fatalf("unexpected next hop: %v", nextHop)
+	}
+	if len(withdrawn) != 1 || withdrawn[0].String() != "172.16.0.0/12" {
+		t.Fatalf("unexpected withdrawn routes: %v", withdrawn)
+	}
+	if len(nlri) != 2 || nlri[0].String() != "192.168.10.0/24" || nlri[1].String() != "0.0.0.0/0" {
+		t.Fatalf("unexpected NLRI: %v", nlri)
+	}
+
+	// Truncated NLRI.
+	if _, _, _, err := parseUpdate(body[:len(body)-3]); err == nil {
+		t.Fatal("expected an error for the truncated NLRI")
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package router
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+// Origin is where a route comes from. A lower value is preferred.
+type Origin int
+
+const (
+	OriginConnected Origin = iota
+	OriginStatic
+	OriginBGP
+)
+
+func (r Origin) String() string {
+	switch r {
+	case OriginConnected:
+		return "connected"
+	case OriginStatic:
+		return "static"
+	case OriginBGP:
+		return "bgp"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+// Route is an entry of the routing table. Nil NextHop means the network is directly connected.
+type Route struct {
+	Network *net.IPNet
+	NextHop net.IP
+	Origin  Origin
+}
+
+func (r Route) String() string {
+	if r.NextHop == nil {
+		return fmt.Sprintf("%v directly connected", r.Network)
+	}
+
+	return fmt.Sprintf("%v via %v (%v)", r.Network, r.NextHop, r.Origin)
+}
+
+func (r Route) prefixLength() int {
+	ones, _ := r.Network.Mask.Size()
+	return ones
+}
+
+// rib is a routing information base that finds a route using the longest prefix match.
+type rib struct {
+	mutex  sync.RWMutex
+	routes []Route // Sorted by the prefix length in descending order.
+}
+
+func newRIB() *rib {
+	return &rib{}
+}
+
+// add adds a new route, or replaces the existing one that has the same network
+// if the existing one is not preferred to the new one. It returns false if the
+// route has not been added.
+func (r *rib) add(route Route) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, v := range r.routes {
+		if v.Network.String() == route.Network.String() {
+			if v.Origin < route.Origin {
+				return false
+			}
+			r.routes[i] = route
+			return true
+		}
+	}
+	r.routes = append(r.routes, route)
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].prefixLength() > r.routes[j].prefixLength()
+	})
+
+	return true
+}
+
+// remove removes the route whose network is equal to n and that comes from
+// origin. It returns false if there is no such route.
+func (r *rib) remove(n *net.IPNet, origin Origin) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, v := range r.routes {
+		if v.Network.String() == n.String() && v.Origin == origin {
+			r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeOrigin removes all the routes that come from origin. It returns false if there is no such route.
+func (r *rib) removeOrigin(origin Origin) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	routes := make([]Route, 0, len(r.routes))
+	for _, v := range r.routes {
+		if v.Origin != origin {
+			routes = append(routes, v)
+		}
+	}
+	removed := len(routes) != len(r.routes)
+	r.routes = routes
+
+	return removed
+}
+
+// lookup returns the most specific route to ip.
+func (r *rib) lookup(ip net.IP) (Route, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, v := range r.routes {
+		if v.Network.Contains(ip) {
+			return v, true
+		}
+	}
+
+	return Route{}, false
+}
+
+func (r *rib) all() []Route {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	routes := make([]Route, len(r.routes))
+	copy(routes, r.routes)
+
+	return routes
+}
@@ -0,0 +1,80 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package router
+
+import (
+	"net"
+	"testing"
+)
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+func TestLongestPrefixMatch(t *testing.T) {
+	rib := newRIB()
+	rib.add(Route{Network: mustParseCIDR("0.0.0.0/0"), NextHop: net.ParseIP("10.0.1.254"), Origin: OriginStatic})
+	rib.add(Route{Network: mustParseCIDR("10.0.1.0/24"), Origin: OriginConnected})
+	rib.add(Route{Network: mustParseCIDR("192.168.0.0/16"), NextHop: net.ParseIP("10.0.1.253"), Origin: OriginBGP})
+	rib.add(Route{Network: mustParseCIDR("192.168.10.0/24"), NextHop: net.ParseIP("10.0.1.252"), Origin: OriginBGP})
+	// Static routes are preferred to the ones learned by BGP.
+	if rib.add(Route{Network: mustParseCIDR("0.0.0.0/0"), NextHop: net.ParseIP("10.0.1.1"), Origin: OriginBGP}) {
+		t.Fatal("BGP route replaced the static one")
+	}
+
+	tests := []struct {
+		ip      string
+		nextHop net.IP
+	}{
+		{"10.0.1.7", nil},
+		{"192.168.10.1", net.ParseIP("10.0.1.252")},
+		{"192.168.11.1", net.ParseIP("10.0.1.253")},
+		{"8.8.8.8", net.ParseIP("10.0.1.254")},
+	}
+	for _, v := range tests {
+		route, ok := rib.lookup(net.ParseIP(v.ip))
+		if !ok {
+			t.Fatalf("no route to %v", v.ip)
+		}
+		if !route.NextHop.Equal(v.nextHop) {
+			t.Fatalf("unexpected next hop for %v: expected=%v, got=%v", v.ip, v.nextHop, route.NextHop)
+		}
+	}
+
+	if !rib.remove(mustParseCIDR("0.0.0.0/0"), OriginStatic) {
+		t.Fatal("failed to remove the default route")
+	}
+	if _, ok := rib.lookup(net.ParseIP("8.8.8.8")); ok {
+		t.Fatal("unexpected route to 8.8.8.8")
+	}
+	if !rib.removeOrigin(OriginBGP) {
+		t.Fatal("failed to remove the BGP routes")
+	}
+	if route, _ := rib.lookup(net.ParseIP("192.168.10.1")); route.Origin == OriginBGP {
+		t.Fatalf("unexpected BGP route: %v", route)
+	}
+}
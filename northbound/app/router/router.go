@@ -0,0 +1,846 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+const appName = "Router"
+
+var (
+	logger = logging.MustGetLogger("router")
+)
+
+const (
+	// Routing flows are removed with the L2 switching flows when the topology is
+	// changed, so the MSB of the cookie should not be set. The second MSB is set
+	// not to be confused with the flow IDs used as cookies by the L2 switch.
+	flowCookie = 0x1<<62 | 0x3A7E
+	// Priority of the routing flows. It is same as the one of the L2 switching
+	// flows as they never overlap each other.
+	routePriority = 10
+
+	// Lifetime of the learned neighbors.
+	neighborTimeout = 5 * time.Minute
+	// Minimum interval between the ARP requests for a same next hop.
+	resolveInterval = 1 * time.Second
+)
+
+// gateway is a router interface that is the default gateway of a subnet.
+type gateway struct {
+	ip      net.IP
+	network *net.IPNet
+	mac     net.HardwareAddr
+}
+
+func (r gateway) String() string {
+	ones, _ := r.network.Mask.Size()
+	return fmt.Sprintf("%v/%v (%v)", r.ip, ones, r.mac)
+}
+
+// neighbor is a host or a router, which is directly connected to one of the gateways, learned by ARP.
+type neighbor struct {
+	mac       net.HardwareAddr
+	deviceID  string
+	port      uint32
+	timestamp time.Time
+}
+
+type Router struct {
+	app.BaseProcessor
+	conf     app.Config
+	gateways []gateway
+	rib      *rib
+
+	mutex     sync.Mutex
+	neighbors map[string]neighbor  // Key = IP address.
+	resolving map[string]time.Time // Key = IP address.
+	finder    network.Finder
+}
+
+func New(conf app.Config) *Router {
+	return &Router{
+		rib:       newRIB(),
+		neighbors: make(map[string]neighbor),
+		resolving: make(map[string]time.Time),
+		conf:      conf,
+	}
+}
+
+func (r *Router) Init(ctx context.Context, s app.Services) error {
+	gateways, err := parseInterfaces(r.conf.GetString("interfaces"))
+	if err != nil {
+		return errors.Wrap(err, "invalid router.interfaces in the config file")
+	}
+	if len(gateways) == 0 {
+		return errors.New("empty router.interfaces in the config file")
+	}
+	r.gateways = gateways
+	for _, v := range gateways {
+		r.rib.add(Route{Network: v.network, Origin: OriginConnected})
+	}
+
+	routes, err := parseRoutes(r.conf.GetString("routes"))
+	if err != nil {
+		return errors.Wrap(err, "invalid router.routes in the config file")
+	}
+	for _, v := range routes {
+		if r.gatewayByNetwork(v.NextHop) == nil {
+			return fmt.Errorf("unreachable next hop: %v", v)
+		}
+		r.rib.add(v)
+	}
+
+	config, err := parseBGPConfig(r.conf)
+	if err != nil {
+		return err
+	}
+	// BGP is disabled if the local AS number is not specified.
+	if config.localAS != 0 {
+		go newBGPSpeaker(config, r).run()
+	}
+
+	return nil
+}
+
+func parseBGPConfig(conf app.Config) (bgpConfig, error) {
+	localAS := conf.GetInt("bgp.local_as")
+	if localAS == 0 {
+		return bgpConfig{}, nil
+	}
+	if localAS < 0 || localAS > 0xFFFF {
+		return bgpConfig{}, errors.New("invalid router.bgp.local_as in the config file")
+	}
+	routerID := net.ParseIP(conf.GetString("bgp.router_id"))
+	if routerID == nil || routerID.To4() == nil {
+		return bgpConfig{}, errors.New("invalid router.bgp.router_id in the config file")
+	}
+	peer := conf.GetString("bgp.peer")
+	if _, _, err := net.SplitHostPort(peer); err != nil {
+		return bgpConfig{}, errors.New("invalid router.bgp.peer in the config file")
+	}
+	peerAS := conf.GetInt("bgp.peer_as")
+	if peerAS <= 0 || peerAS > 0xFFFF {
+		return bgpConfig{}, errors.New("invalid router.bgp.peer_as in the config file")
+	}
+	holdTime := conf.GetInt("bgp.hold_time")
+	if holdTime < 0 || holdTime == 1 || holdTime == 2 || holdTime > 0xFFFF {
+		return bgpConfig{}, errors.New("invalid router.bgp.hold_time in the config file")
+	}
+
+	return bgpConfig{
+		localAS:  uint16(localAS),
+		routerID: routerID.To4(),
+		peer:     peer,
+		peerAS:   uint16(peerAS),
+		holdTime: uint16(holdTime),
+	}, nil
+}
+
+// parseInterfaces parses s, which is a semicolon separated list of the
+// interfaces. Each interface consists of its IP address with the prefix
+// length and its MAC address, e.g., "10.0.1.1/24,02:00:00:00:01:01".
+func parseInterfaces(s string) ([]gateway, error) {
+	result := []gateway{}
+	for _, token := range strings.Split(s, ";") {
+		token = strings.TrimSpace(token)
+		if len(token) == 0 {
+			continue
+		}
+		fields := strings.Split(token, ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid interface: %v", token)
+		}
+		ip, n, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, err
+		}
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("not an IPv4 address: %v", fields[0])
+		}
+		mac, err := net.ParseMAC(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, gateway{ip: ip.To4(), network: n, mac: mac})
+	}
+
+	return result, nil
+}
+
+// parseRoutes parses s, which is a semicolon separated list of the static
+// routes. Each route consists of its destination network and the next hop
+// IP address, e.g., "0.0.0.0/0,10.0.1.254".
+func parseRoutes(s string) ([]Route, error) {
+	result := []Route{}
+	for _, token := range strings.Split(s, ";") {
+		token = strings.TrimSpace(token)
+		if len(token) == 0 {
+			continue
+		}
+		fields := strings.Split(token, ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid route: %v", token)
+		}
+		_, n, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, err
+		}
+		nextHop := net.ParseIP(strings.TrimSpace(fields[1]))
+		if nextHop == nil || nextHop.To4() == nil {
+			return nil, fmt.Errorf("invalid next hop: %v", fields[1])
+		}
+		result = append(result, Route{Network: n, NextHop: nextHop.To4(), Origin: OriginStatic})
+	}
+
+	return result, nil
+}
+
+func (r *Router) Name() string {
+	return appName
+}
+
+func (r *Router) Interests() []app.Interest {
+	return []app.Interest{{EtherType: 0x0806}, {EtherType: 0x0800}}
+}
+
+func (r *Router) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%v: Interfaces=%v", r.Name(), r.gateways))
+	for _, v := range r.rib.all() {
+		buf.WriteString(fmt.Sprintf("\n\t%v", v))
+	}
+
+	return buf.String()
+}
+
+func (r *Router) onBGPUpdate(nlri []*net.IPNet, nextHop net.IP, withdrawn []*net.IPNet) {
+	changed := false
+	for _, v := range withdrawn {
+		if r.rib.remove(v, OriginBGP) {
+			logger.Infof("BGP route to %v has been withdrawn", v)
+			changed = true
+		}
+	}
+
+	var gw *gateway
+	if len(nlri) > 0 {
+		// The next hop should be one of the neighbors directly connected to the gateways.
+		gw = r.gatewayByNetwork(nextHop)
+		if gw == nil {
+			logger.Warningf("ignore the BGP routes via the unreachable next hop %v: %v", nextHop, nlri)
+			nlri = nil
+		}
+	}
+	for _, v := range nlri {
+		route := Route{Network: v, NextHop: nextHop, Origin: OriginBGP}
+		if r.rib.add(route) {
+			logger.Infof("BGP route has been learned: %v", route)
+			changed = true
+		}
+	}
+
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+	if finder == nil || !changed {
+		return
+	}
+	// Remove the routing flows made with the previous routes so that they are installed again with the new ones.
+	removeRouteFlows(finder.Devices())
+	if gw != nil {
+		// Resolve the next hop in advance not to drop the first packets heading to the learned networks.
+		if err := r.resolve(finder, gw, nextHop); err != nil {
+			logger.Errorf("failed to resolve the next hop %v: %v", nextHop, err)
+		}
+	}
+}
+
+func (r *Router) onBGPDown() {
+	if !r.rib.removeOrigin(OriginBGP) {
+		return
+	}
+	logger.Infof("all the BGP routes have been removed")
+
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+	if finder != nil {
+		removeRouteFlows(finder.Devices())
+	}
+}
+
+// Pause removes the routing flows from all the devices, as they are not updated
+// with the routes and the neighbors while the application is disabled.
+func (r *Router) Pause() error {
+	r.mutex.Lock()
+	finder := r.finder
+	r.mutex.Unlock()
+	if finder != nil {
+		removeRouteFlows(finder.Devices())
+	}
+
+	return nil
+}
+
+// Resume forgets the neighbors learned before the application was disabled, so
+// that they are resolved again.
+func (r *Router) Resume() error {
+	r.forget(func(neighbor) bool { return true })
+	return nil
+}
+
+func (r *Router) gatewayByMAC(mac net.HardwareAddr) *gateway {
+	for i, v := range r.gateways {
+		if bytes.Equal(v.mac, mac) {
+			return &r.gateways[i]
+		}
+	}
+
+	return nil
+}
+
+func (r *Router) gatewayByIP(ip net.IP) *gateway {
+	for i, v := range r.gateways {
+		if v.ip.Equal(ip) {
+			return &r.gateways[i]
+		}
+	}
+
+	return nil
+}
+
+// gatewayByNetwork returns the gateway whose subnet includes ip.
+func (r *Router) gatewayByNetwork(ip net.IP) *gateway {
+	for i, v := range r.gateways {
+		if v.network.Contains(ip) {
+			return &r.gateways[i]
+		}
+	}
+
+	return nil
+}
+
+func (r *Router) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	switch eth.Type {
+	case 0x0806:
+		arp := new(protocol.ARP)
+		if err := arp.UnmarshalBinary(eth.Payload); err != nil {
+			return err
+		}
+		drop, err := r.processARP(finder, ingress, arp)
+		if drop || err != nil {
+			return err
+		}
+	case 0x0800:
+		if gw := r.gatewayByMAC(eth.DstMAC); gw != nil {
+			// This packet has been routed or dropped. Do not pass it to the next processors.
+			return r.route(finder, ingress, eth)
+		}
+	}
+
+	return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+}
+
+func (r *Router) processARP(finder network.Finder, ingress *network.Port, arp *protocol.ARP) (drop bool, err error) {
+	// Our ARP request that was propagated via an edge among switches?
+	if r.gatewayByMAC(arp.SHA) != nil {
+		return true, nil
+	}
+
+	switch arp.Operation {
+	case 1:
+		gw := r.gatewayByIP(arp.TPA)
+		if gw == nil {
+			return false, nil
+		}
+		// The gateways are active on every switch, so the request has been
+		// already answered by the switch that the host is connected to if it
+		// comes from another switch.
+		if finder.IsEdge(ingress) {
+			return true, nil
+		}
+		r.learn(finder, ingress, arp.SPA, arp.SHA)
+		logger.Debugf("ARP request for the gateway %v from %v", gw.ip, arp.SPA)
+
+		reply, err := makeARPReply(arp, gw.mac)
+		if err != nil {
+			return true, err
+		}
+		return true, r.PacketOut(ingress, reply)
+	case 2:
+		if r.gatewayByMAC(arp.THA) == nil {
+			return false, nil
+		}
+		r.learn(finder, ingress, arp.SPA, arp.SHA)
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// learn remembers the location of the neighbor whose IP and MAC addresses are ip and mac.
+func (r *Router) learn(finder network.Finder, ingress *network.Port, ip net.IP, mac net.HardwareAddr) {
+	// Ports between switches are not the locations of the neighbors.
+	if finder.IsEdge(ingress) || r.gatewayByNetwork(ip) == nil {
+		return
+	}
+
+	n := neighbor{
+		mac:       mac,
+		deviceID:  ingress.Device().ID(),
+		port:      ingress.Number(),
+		timestamp: time.Now(),
+	}
+	r.mutex.Lock()
+	prev, ok := r.neighbors[ip.String()]
+	r.neighbors[ip.String()] = n
+	delete(r.resolving, ip.String())
+	r.mutex.Unlock()
+
+	if ok && (!bytes.Equal(prev.mac, n.mac) || prev.deviceID != n.deviceID || prev.port != n.port) {
+		logger.Infof("neighbor %v has been changed: MAC=%v, location=%v:%v", ip, mac, n.deviceID, n.port)
+		// Remove the routing flows made with the previous neighbor.
+		removeRouteFlows(finder.Devices())
+	}
+}
+
+func (r *Router) neighbor(ip net.IP) (neighbor, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.neighbors[ip.String()]
+	if !ok || time.Since(v.timestamp) > neighborTimeout {
+		return neighbor{}, false
+	}
+
+	return v, true
+}
+
+func (r *Router) route(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	ip := new(protocol.IPv4)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+		return err
+	}
+	if ip.TTL <= 1 {
+		logger.Debugf("dropping the packet whose TTL is expired: src=%v, dst=%v", ip.SrcIP, ip.DstIP)
+		return nil
+	}
+	if r.gatewayByIP(ip.DstIP) != nil {
+		// We do not reply to the packets heading to the gateways.
+		return nil
+	}
+
+	route, ok := r.rib.lookup(ip.DstIP)
+	if !ok {
+		logger.Debugf("no route to %v", ip.DstIP)
+		return nil
+	}
+	nextHop := route.NextHop
+	if nextHop == nil {
+		nextHop = ip.DstIP
+	}
+	gw := r.gatewayByNetwork(nextHop)
+	if gw == nil {
+		logger.Warningf("unreachable next hop %v for %v", nextHop, ip.DstIP)
+		return nil
+	}
+
+	n, ok := r.neighbor(nextHop)
+	if !ok {
+		// Drop this packet and wait the ARP reply. The source host will retransmit it.
+		return r.resolve(finder, gw, nextHop)
+	}
+
+	return r.forward(finder, ingress, eth, ip.DstIP, gw, n)
+}
+
+// resolve sends an ARP request for ip to all the switches. Each switch sends
+// the request only to its own host ports, instead of flooding it through the
+// other switches, as the gateway is active on every switch.
+func (r *Router) resolve(finder network.Finder, gw *gateway, ip net.IP) error {
+	r.mutex.Lock()
+	last, ok := r.resolving[ip.String()]
+	if ok && time.Since(last) < resolveInterval {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.resolving[ip.String()] = time.Now()
+	r.mutex.Unlock()
+
+	request, err := makeARPRequest(gw, ip)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("resolving the next hop %v", ip)
+
+	for _, device := range finder.Devices() {
+		if device.IsClosed() {
+			continue
+		}
+		for _, port := range hostPorts(finder, device.Ports()) {
+			if err := r.PacketOut(port, request); err != nil {
+				logger.Errorf("failed to send the ARP request to %v: %v", port.ID(), err)
+				continue
+			}
+		}
+	}
+
+	return nil
+}
+
+// hostPorts returns the ports among ports that are up and not connected to the
+// other switches. The host ports are not in the spanning tree, so they should
+// not be filtered by it.
+func hostPorts(finder network.Finder, ports []*network.Port) []*network.Port {
+	result := make([]*network.Port, 0, len(ports))
+	for _, port := range ports {
+		if finder.IsEdge(port) {
+			continue
+		}
+		if v := port.Value(); v == nil || v.IsPortDown() || v.IsLinkDown() {
+			continue
+		}
+		result = append(result, port)
+	}
+
+	return result
+}
+
+// forward installs the flows that deliver the packets heading to dstIP to the
+// next hop n, and then sends the packet to the next hop.
+func (r *Router) forward(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet, dstIP net.IP, gw *gateway, n neighbor) error {
+	device := finder.Device(n.deviceID)
+	if device == nil || device.Port(n.port) == nil {
+		logger.Debugf("the next hop %v is disconnected", n.mac)
+		return nil
+	}
+
+	egress := device.Port(n.port)
+	if ingress.Device().ID() != n.deviceID {
+		path := finder.Path(ingress.Device().ID(), n.deviceID)
+		if len(path) == 0 {
+			logger.Debugf("empty path from %v to %v", ingress.Device().ID(), n.deviceID)
+			return nil
+		}
+		// Install the flows on the transit switches first.
+		for i, v := range path {
+			out := egress
+			if i+1 < len(path) {
+				out = path[i+1][0]
+			}
+			if err := installForwardFlow(v[1].Device(), n.mac, out.Number()); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("installing the forwarding flow on %v", v[1].Device().ID()))
+			}
+		}
+		egress = path[0][0]
+	}
+	// Drop this packet if it goes back to the ingress port to avoid the routing loop.
+	if egress.ID() == ingress.ID() {
+		logger.Debugf("ignore the routing path that goes back to the ingress port: %v", ingress.ID())
+		return nil
+	}
+
+	action, err := newRouteAction(ingress.Device(), gw, n, egress.Number())
+	if err != nil {
+		return err
+	}
+	if routedByController(ingress.Device()) {
+		packet, err := routedPacket(eth)
+		if err != nil {
+			return err
+		}
+		// Every packet is routed by the controller as there is no routing flow.
+		return packetOut(ingress.Device(), action, packet)
+	}
+	if err := installRouteFlow(ingress.Device(), gw, dstIP, action); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("installing the routing flow on %v", ingress.Device().ID()))
+	}
+	logger.Debugf("installed the routing flow for %v via %v on %v", dstIP, n.mac, ingress.Device().ID())
+
+	packet, err := eth.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return packetOut(ingress.Device(), action, packet)
+}
+
+// routedByController returns whether the packets routed by device should be
+// sent by the controller one by one, instead of installing the routing flow.
+// OpenFlow 1.0 has no action that decrements the TTL, so the controller
+// decrements it unless the quirk of the device says the TTL is not decremented.
+func routedByController(device *network.Device) bool {
+	return !device.Quirk().NoDecrementTTL && device.Factory().ProtocolVersion() == openflow.OF10_VERSION
+}
+
+// routedPacket returns a copy of eth whose IPv4 TTL is decremented.
+func routedPacket(eth *protocol.Ethernet) ([]byte, error) {
+	v := *eth
+	v.Payload = append([]byte(nil), eth.Payload...)
+	if err := decrementTTL(v.Payload); err != nil {
+		return nil, err
+	}
+
+	return v.MarshalBinary()
+}
+
+// decrementTTL decrements the TTL of the IPv4 packet, and then updates its
+// header checksum. The options of the header are kept as they are.
+func decrementTTL(packet []byte) error {
+	if len(packet) < 20 {
+		return errors.New("invalid IPv4 packet length")
+	}
+	length := int(packet[0]&0xF) * 4
+	if length < 20 || len(packet) < length {
+		return errors.New("invalid IPv4 header length")
+	}
+	packet[8]--
+
+	binary.BigEndian.PutUint16(packet[10:12], 0)
+	sum := uint32(0)
+	for i := 0; i < length; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(packet[i : i+2]))
+	}
+	for sum > 0xFFFF {
+		sum = sum>>16 + sum&0xFFFF
+	}
+	binary.BigEndian.PutUint16(packet[10:12], ^uint16(sum))
+
+	return nil
+}
+
+// newRouteAction makes an action that rewrites the MAC addresses, decrements the TTL unless the quirk
+// of the device says it is not supported, and then outputs to the port. The TTL of the packets routed
+// by the controller is not decremented by the action.
+func newRouteAction(device *network.Device, gw *gateway, n neighbor, port uint32) (openflow.Action, error) {
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(port)
+
+	action, err := device.Factory().NewAction()
+	if err != nil {
+		return nil, err
+	}
+	action.SetSrcMAC(gw.mac)
+	action.SetDstMAC(n.mac)
+	if !device.Quirk().NoDecrementTTL && !routedByController(device) {
+		action.SetDecrementTTL()
+	}
+	action.SetOutPort(outPort)
+
+	return action, nil
+}
+
+func installRouteFlow(device *network.Device, gw *gateway, dstIP net.IP, action openflow.Action) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	match.SetEtherType(0x0800)
+	match.SetDstMAC(gw.mac)
+	match.SetDstIP(&net.IPNet{IP: dstIP, Mask: net.CIDRMask(32, 32)})
+
+	inst, err := f.NewInstruction()
+	if err != nil {
+		return err
+	}
+	inst.ApplyAction(action)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	flow.SetIdleTimeout(30)
+	flow.SetPriority(routePriority)
+	flow.SetFlowMatch(match)
+	flow.SetFlowInstruction(inst)
+
+	return device.SendFlow(appName, flow)
+}
+
+func installForwardFlow(device *network.Device, mac net.HardwareAddr, port uint32) error {
+	f := device.Factory()
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	match.SetDstMAC(mac)
+
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(port)
+	action, err := f.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(outPort)
+	inst, err := f.NewInstruction()
+	if err != nil {
+		return err
+	}
+	inst.ApplyAction(action)
+
+	flow, err := f.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(flowCookie)
+	flow.SetTableID(device.FlowTableID())
+	flow.SetIdleTimeout(30)
+	flow.SetPriority(routePriority)
+	flow.SetFlowMatch(match)
+	flow.SetFlowInstruction(inst)
+
+	return device.SendFlow(appName, flow)
+}
+
+func packetOut(device *network.Device, action openflow.Action, packet []byte) error {
+	inPort := openflow.NewInPort()
+	inPort.SetController()
+
+	out, err := device.Factory().NewPacketOut()
+	if err != nil {
+		return err
+	}
+	out.SetInPort(inPort)
+	out.SetAction(action)
+	out.SetData(packet)
+
+	return device.SendMessage(out)
+}
+
+func removeRouteFlows(devices []*network.Device) {
+	for _, device := range devices {
+		if device.IsClosed() {
+			continue
+		}
+		f := device.Factory()
+		match, err := f.NewMatch()
+		if err != nil {
+			logger.Errorf("failed to create a match: %v", err)
+			continue
+		}
+		flow, err := f.NewFlowMod(openflow.FlowDelete)
+		if err != nil {
+			logger.Errorf("failed to create a flow mod: %v", err)
+			continue
+		}
+		flow.SetCookie(flowCookie)
+		flow.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+		flow.SetTableID(0xFF) // ALL
+		flow.SetFlowMatch(match)
+		if err := device.SendFlow(appName, flow); err != nil {
+			logger.Errorf("failed to remove the routing flows from %v: %v", device.ID(), err)
+			continue
+		}
+	}
+}
+
+func makeARPReply(request *protocol.ARP, mac net.HardwareAddr) ([]byte, error) {
+	v := protocol.NewARPReply(mac, request.SHA, request.TPA, request.SPA)
+	reply, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	eth := protocol.Ethernet{
+		SrcMAC:  mac,
+		DstMAC:  request.SHA,
+		Type:    0x0806,
+		Payload: reply,
+	}
+
+	return eth.MarshalBinary()
+}
+
+func makeARPRequest(gw *gateway, ip net.IP) ([]byte, error) {
+	v := protocol.NewARPRequest(gw.mac, gw.ip, ip)
+	request, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	eth := protocol.Ethernet{
+		SrcMAC:  gw.mac,
+		DstMAC:  net.HardwareAddr([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}),
+		Type:    0x0806,
+		Payload: request,
+	}
+
+	return eth.MarshalBinary()
+}
+
+// forget removes the neighbors that satisfy f, and then returns whether any neighbor has been removed.
+func (r *Router) forget(f func(neighbor) bool) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	removed := false
+	for k, v := range r.neighbors {
+		if f(v) {
+			delete(r.neighbors, k)
+			removed = true
+		}
+	}
+
+	return removed
+}
+
+func (r *Router) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	r.finder = finder
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *Router) OnPortDown(finder network.Finder, port *network.Port) error {
+	if r.forget(func(n neighbor) bool { return n.deviceID == port.Device().ID() && n.port == port.Number() }) {
+		removeRouteFlows(finder.Devices())
+	}
+
+	return r.BaseProcessor.OnPortDown(finder, port)
+}
+
+func (r *Router) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	if r.forget(func(n neighbor) bool { return n.deviceID == device.ID() }) {
+		removeRouteFlows(finder.Devices())
+	}
+
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
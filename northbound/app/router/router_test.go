@@ -0,0 +1,106 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package router
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+)
+
+type testFinder struct {
+	network.Finder
+	edges map[*network.Port]bool
+}
+
+func (r *testFinder) IsEdge(p *network.Port) bool {
+	return r.edges[p]
+}
+
+// The host ports are not in the spanning tree.
+func (r *testFinder) IsEnabledBySTP(p *network.Port) bool {
+	return r.edges[p]
+}
+
+type testPort struct {
+	openflow.Port
+	down bool
+}
+
+func (r *testPort) IsPortDown() bool {
+	return r.down
+}
+
+func (r *testPort) IsLinkDown() bool {
+	return false
+}
+
+func TestHostPorts(t *testing.T) {
+	edge, host, down := network.NewPort(nil, 1), network.NewPort(nil, 2), network.NewPort(nil, 3)
+	edge.SetValue(&testPort{})
+	host.SetValue(&testPort{})
+	down.SetValue(&testPort{down: true})
+	finder := &testFinder{edges: map[*network.Port]bool{edge: true}}
+
+	ports := hostPorts(finder, []*network.Port{edge, host, down, network.NewPort(nil, 4)})
+	if len(ports) != 1 || ports[0] != host {
+		t.Fatalf("unexpected ports to send the ARP request: %v", len(ports))
+	}
+}
+
+func TestDecrementTTL(t *testing.T) {
+	ip := &protocol.IPv4{
+		Version:  4,
+		IHL:      5,
+		Length:   20,
+		TTL:      64,
+		Protocol: 17,
+		SrcIP:    net.ParseIP("10.0.0.1"),
+		DstIP:    net.ParseIP("10.0.1.1"),
+	}
+	packet, err := ip.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decrementTTL(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	ip.TTL = 63
+	expected, err := ip.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packet, expected) {
+		t.Fatalf("unexpected packet: %x, expected %x", packet, expected)
+	}
+
+	// The header length is larger than the packet.
+	packet[0] = 0x46
+	if err := decrementTTL(packet); err == nil {
+		t.Fatal("expected an error for the truncated header")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package app
+
+import (
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/network"
+)
+
+// Services are the shared services of the controller given to the applications
+// when they are initialized. The database is given to their constructors.
+type Services struct {
+	// Finder looks up the current topology of the network. It is nil if the
+	// applications are only checked by cherry -check-config.
+	Finder  network.Finder
+	Events  EventBus
+	Metrics MetricRegistry
+}
+
+// EventBus publishes the events to the subscribers, e.g., the other applications.
+type EventBus interface {
+	Publish(t event.Type, data interface{})
+	// Subscribe returns a function that cancels the subscription.
+	Subscribe(l event.Listener, types ...event.Type) (unsubscribe func())
+}
+
+// MetricRegistry creates the metrics exported on /metrics.
+type MetricRegistry interface {
+	NewCounter(name, help string) *metrics.Counter
+	NewGauge(name, help string) *metrics.Gauge
+	NewCounterVec(name, help string, labels ...string) *metrics.CounterVec
+	NewHistogram(name, help string, bounds []float64) *metrics.Histogram
+}
+
+// NewServices returns the services backed by the event and the metrics
+// packages, and finder.
+func NewServices(finder network.Finder) Services {
+	return Services{
+		Finder:  finder,
+		Events:  eventBus{},
+		Metrics: metricRegistry{},
+	}
+}
+
+type eventBus struct{}
+
+func (eventBus) Publish(t event.Type, data interface{}) {
+	event.Publish(t, data)
+}
+
+func (eventBus) Subscribe(l event.Listener, types ...event.Type) (unsubscribe func()) {
+	return event.Subscribe(l, types...)
+}
+
+type metricRegistry struct{}
+
+func (metricRegistry) NewCounter(name, help string) *metrics.Counter {
+	return metrics.NewCounter(name, help)
+}
+
+func (metricRegistry) NewGauge(name, help string) *metrics.Gauge {
+	return metrics.NewGauge(name, help)
+}
+
+func (metricRegistry) NewCounterVec(name, help string, labels ...string) *metrics.CounterVec {
+	return metrics.NewCounterVec(name, help, labels...)
+}
+
+func (metricRegistry) NewHistogram(name, help string, bounds []float64) *metrics.Histogram {
+	return metrics.NewHistogram(name, help, bounds)
+}
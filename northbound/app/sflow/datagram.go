@@ -0,0 +1,139 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sflow
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+// sFlow version 5 (http://sflow.org/sflow_version_5.txt)
+const (
+	sflowVersion         = 5
+	addressTypeIPv4      = 1
+	sampleTypeFlow       = 1
+	sampleTypeCounter    = 2
+	recordTypeRawPacket  = 1
+	recordTypeGenericIf  = 1
+	headerProtocolEther  = 1
+	genericIfRecordSize  = 88
+	ifTypeEthernetCsmacd = 6
+)
+
+type flowSample struct {
+	sequence     uint32
+	port         uint32
+	samplingRate uint32
+	samplePool   uint32
+	frameLength  uint32
+	header       []byte
+}
+
+func (r *flowSample) marshal() []byte {
+	// Raw packet header record
+	headerLen := len(r.header)
+	padded := (headerLen + 3) &^ 3
+	record := make([]byte, 16+padded)
+	binary.BigEndian.PutUint32(record[0:4], headerProtocolEther)
+	binary.BigEndian.PutUint32(record[4:8], r.frameLength)
+	binary.BigEndian.PutUint32(record[8:12], r.frameLength-uint32(headerLen)) // Stripped
+	binary.BigEndian.PutUint32(record[12:16], uint32(headerLen))
+	copy(record[16:], r.header)
+
+	v := make([]byte, 40)
+	binary.BigEndian.PutUint32(v[0:4], sampleTypeFlow)
+	binary.BigEndian.PutUint32(v[4:8], uint32(32+8+len(record)))
+	binary.BigEndian.PutUint32(v[8:12], r.sequence)
+	binary.BigEndian.PutUint32(v[12:16], r.port) // Source ID: ifIndex class
+	binary.BigEndian.PutUint32(v[16:20], r.samplingRate)
+	binary.BigEndian.PutUint32(v[20:24], r.samplePool)
+	// v[24:28] is drops
+	binary.BigEndian.PutUint32(v[28:32], r.port) // Input interface
+	// v[32:36] is output interface, which is unknown
+	binary.BigEndian.PutUint32(v[36:40], 1) // Number of records
+
+	tag := make([]byte, 8)
+	binary.BigEndian.PutUint32(tag[0:4], recordTypeRawPacket)
+	binary.BigEndian.PutUint32(tag[4:8], uint32(len(record)))
+
+	return append(append(v, tag...), record...)
+}
+
+type counterSample struct {
+	sequence uint32
+	stats    openflow.PortStats
+	up       bool
+	speed    uint64 // Bits per second
+}
+
+func (r *counterSample) marshal() []byte {
+	v := make([]byte, 28+genericIfRecordSize)
+	binary.BigEndian.PutUint32(v[0:4], sampleTypeCounter)
+	binary.BigEndian.PutUint32(v[4:8], uint32(len(v)-8))
+	binary.BigEndian.PutUint32(v[8:12], r.sequence)
+	binary.BigEndian.PutUint32(v[12:16], r.stats.PortNumber) // Source ID: ifIndex class
+	binary.BigEndian.PutUint32(v[16:20], 1)                  // Number of records
+	binary.BigEndian.PutUint32(v[20:24], recordTypeGenericIf)
+	binary.BigEndian.PutUint32(v[24:28], genericIfRecordSize)
+
+	c := v[28:]
+	binary.BigEndian.PutUint32(c[0:4], r.stats.PortNumber)
+	binary.BigEndian.PutUint32(c[4:8], ifTypeEthernetCsmacd)
+	binary.BigEndian.PutUint64(c[8:16], r.speed)
+	binary.BigEndian.PutUint32(c[16:20], 1) // Full-duplex
+	if r.up {
+		binary.BigEndian.PutUint32(c[20:24], 0x3) // Admin and operational up
+	}
+	binary.BigEndian.PutUint64(c[24:32], r.stats.RxBytes)
+	binary.BigEndian.PutUint32(c[32:36], uint32(r.stats.RxPackets))
+	// c[36:44] is multicast and broadcast packets, which are unknown
+	binary.BigEndian.PutUint32(c[44:48], uint32(r.stats.RxDropped))
+	binary.BigEndian.PutUint32(c[48:52], uint32(r.stats.RxErrors))
+	// c[52:56] is unknown protocols
+	binary.BigEndian.PutUint64(c[56:64], r.stats.TxBytes)
+	binary.BigEndian.PutUint32(c[64:68], uint32(r.stats.TxPackets))
+	// c[68:76] is multicast and broadcast packets, which are unknown
+	binary.BigEndian.PutUint32(c[76:80], uint32(r.stats.TxDropped))
+	binary.BigEndian.PutUint32(c[80:84], uint32(r.stats.TxErrors))
+	// c[84:88] is promiscuous mode
+
+	return v
+}
+
+// makeDatagram makes an sFlow datagram that contains samples, which are already marshaled.
+func makeDatagram(agent net.IP, subAgentID, sequence, uptime uint32, samples [][]byte) []byte {
+	v := make([]byte, 28)
+	binary.BigEndian.PutUint32(v[0:4], sflowVersion)
+	binary.BigEndian.PutUint32(v[4:8], addressTypeIPv4)
+	copy(v[8:12], agent.To4())
+	binary.BigEndian.PutUint32(v[12:16], subAgentID)
+	binary.BigEndian.PutUint32(v[16:20], sequence)
+	binary.BigEndian.PutUint32(v[20:24], uptime)
+	binary.BigEndian.PutUint32(v[24:28], uint32(len(samples)))
+	for _, s := range samples {
+		v = append(v, s...)
+	}
+
+	return v
+}
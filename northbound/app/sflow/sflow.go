@@ -0,0 +1,368 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sflow
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/event"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/pkg/errors"
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("sflow")
+)
+
+const (
+	statsTimeout = 5 * time.Second
+	// Maximum number of the counter samples in a datagram.
+	maxCounterSamples = 10
+)
+
+// SFlow is an sFlow agent that exports the samples of the packet-ins and the
+// port counters of the switches. The packets sampled by the packet sampling of
+// the controller are also exported with its sampling rate. Each switch is
+// exported as a sub-agent whose ID is the lower 32 bits of its DPID, and the
+// port numbers are used as the interface indexes.
+type SFlow struct {
+	app.BaseProcessor
+	conf         app.Config
+	conn         *net.UDPConn
+	agent        net.IP
+	samplingRate uint32
+	interval     time.Duration
+	headerSize   int
+	started      time.Time
+	once         sync.Once
+	mutex        sync.Mutex
+	agents       map[string]*subAgent // Key = Device ID.
+	// Whether the application has been disabled at runtime. The sampled packets
+	// are still delivered, so they should be ignored.
+	paused bool
+	// Stops the poller.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Cancels the subscription of the sampled packets.
+	unsubscribe func()
+}
+
+type subAgent struct {
+	sequence        uint32 // Datagram sequence number
+	flowSequence    uint32
+	counterSequence uint32
+	pool            uint32 // Total number of the packet-ins
+}
+
+func New(conf app.Config) *SFlow {
+	return &SFlow{
+		agents: make(map[string]*subAgent),
+		conf:   conf,
+	}
+}
+
+func (r *SFlow) Init(ctx context.Context, s app.Services) error {
+	addr, err := net.ResolveUDPAddr("udp", r.conf.GetString("collector"))
+	if err != nil {
+		return errors.Wrap(err, "invalid sflow.collector in the config file")
+	}
+	agent := net.ParseIP(r.conf.GetString("agent_ip"))
+	if agent == nil || agent.To4() == nil {
+		return errors.New("invalid sflow.agent_ip in the config file")
+	}
+	r.agent = agent.To4()
+
+	// Zero rate disables the sampling of the packet-ins.
+	rate := r.conf.GetInt("sampling_rate")
+	if rate < 0 {
+		return errors.New("invalid sflow.sampling_rate in the config file")
+	}
+	r.samplingRate = uint32(rate)
+
+	interval := r.conf.GetInt("polling_interval")
+	if interval < 0 {
+		return errors.New("invalid sflow.polling_interval in the config file")
+	}
+	r.interval = time.Duration(interval) * time.Second
+
+	r.headerSize = r.conf.GetInt("header_size")
+	if r.headerSize <= 0 {
+		r.headerSize = 128
+	}
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return errors.Wrap(err, "connecting to the sFlow collector")
+	}
+	r.conn = conn
+	r.started = time.Now()
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	r.unsubscribe = s.Events.Subscribe(r.onPacketSampled, network.EventPacketSampled)
+
+	return nil
+}
+
+// Stop stops exporting the samples.
+func (r *SFlow) Stop() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// Pause stops exporting the samples while the application is disabled.
+func (r *SFlow) Pause() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.paused = true
+	return nil
+}
+
+// Resume starts exporting the samples again.
+func (r *SFlow) Resume() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.paused = false
+	return nil
+}
+
+func (r *SFlow) isPaused() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.paused
+}
+
+func (r *SFlow) Name() string {
+	return "SFlow"
+}
+
+func (r *SFlow) String() string {
+	return fmt.Sprintf("%v: Collector=%v, SamplingRate=%v, PollingInterval=%v", r.Name(), r.conn.RemoteAddr(), r.samplingRate, r.interval)
+}
+
+func (r *SFlow) uptime() uint32 {
+	return uint32(time.Since(r.started) / time.Millisecond)
+}
+
+// XXX: Caller should lock the mutex before they call this function.
+func (r *SFlow) getSubAgent(deviceID string) *subAgent {
+	v, ok := r.agents[deviceID]
+	if !ok {
+		v = new(subAgent)
+		r.agents[deviceID] = v
+	}
+
+	return v
+}
+
+func (r *SFlow) send(deviceID string, samples [][]byte) error {
+	dpid, err := strconv.ParseUint(deviceID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	agent := r.getSubAgent(deviceID)
+	agent.sequence++
+	datagram := makeDatagram(r.agent, uint32(dpid), agent.sequence, r.uptime(), samples)
+	r.mutex.Unlock()
+
+	_, err = r.conn.Write(datagram)
+	return err
+}
+
+func (r *SFlow) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	if err := r.sample(ingress, eth); err != nil {
+		logger.Errorf("failed to export the flow sample: %v", err)
+	}
+
+	return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+}
+
+func (r *SFlow) sample(ingress *network.Port, eth *protocol.Ethernet) error {
+	if r.samplingRate == 0 {
+		return nil
+	}
+	deviceID := ingress.Device().ID()
+
+	r.mutex.Lock()
+	agent := r.getSubAgent(deviceID)
+	agent.pool++
+	if agent.pool%r.samplingRate != 0 {
+		r.mutex.Unlock()
+		return nil
+	}
+	agent.flowSequence++
+	sample := flowSample{
+		sequence:     agent.flowSequence,
+		port:         ingress.Number(),
+		samplingRate: r.samplingRate,
+		samplePool:   agent.pool,
+	}
+	r.mutex.Unlock()
+
+	frame, err := eth.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return r.sendFlowSample(deviceID, sample, frame, len(frame))
+}
+
+func (r *SFlow) onPacketSampled(e event.Event) {
+	v, ok := e.Data.(network.PacketSample)
+	if !ok || r.isPaused() {
+		return
+	}
+	if err := r.exportPacketSample(v); err != nil {
+		logger.Errorf("failed to export the packet sample: %v", err)
+	}
+}
+
+func (r *SFlow) exportPacketSample(v network.PacketSample) error {
+	deviceID := strconv.FormatUint(v.DPID, 10)
+
+	r.mutex.Lock()
+	agent := r.getSubAgent(deviceID)
+	agent.flowSequence++
+	sample := flowSample{
+		sequence:     agent.flowSequence,
+		port:         v.Port,
+		samplingRate: v.Rate,
+		// Packets received by the port, which is the pool of the sampling.
+		samplePool: uint32(v.Pool),
+	}
+	r.mutex.Unlock()
+
+	return r.sendFlowSample(deviceID, sample, v.Frame, int(v.Length))
+}
+
+// sendFlowSample sends sample of the frame whose original length is length.
+func (r *SFlow) sendFlowSample(deviceID string, sample flowSample, frame []byte, length int) error {
+	sample.frameLength = uint32(length)
+	if len(frame) > r.headerSize {
+		frame = frame[:r.headerSize]
+	}
+	sample.header = frame
+
+	return r.send(deviceID, [][]byte{sample.marshal()})
+}
+
+func (r *SFlow) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	// Zero interval disables the counter sampling.
+	if r.interval > 0 {
+		r.once.Do(func() {
+			go r.poller(r.ctx, finder)
+		})
+	}
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *SFlow) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	delete(r.agents, device.ID())
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
+
+func (r *SFlow) poller(ctx context.Context, finder network.Finder) {
+	logger.Debug("executed port counter poller")
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if r.isPaused() {
+			continue
+		}
+
+		for _, device := range finder.Devices() {
+			if err := r.exportCounters(device); err != nil {
+				logger.Errorf("failed to export the port counters of %v: %v", device.ID(), err)
+				continue
+			}
+		}
+	}
+}
+
+func (r *SFlow) exportCounters(device *network.Device) error {
+	stats, err := device.PortStats(statsTimeout)
+	if err != nil {
+		return err
+	}
+
+	samples := make([][]byte, 0, len(stats))
+	r.mutex.Lock()
+	agent := r.getSubAgent(device.ID())
+	for _, v := range stats {
+		port := device.Port(v.PortNumber)
+		if port == nil || port.Value() == nil {
+			// Skip the local or unknown ports.
+			continue
+		}
+		value := port.Value()
+		agent.counterSequence++
+		sample := counterSample{
+			sequence: agent.counterSequence,
+			stats:    v,
+			up:       !value.IsPortDown() && !value.IsLinkDown(),
+			speed:    value.Speed() * 1000000,
+		}
+		samples = append(samples, sample.marshal())
+	}
+	r.mutex.Unlock()
+
+	// Split the samples not to make too large datagrams.
+	for len(samples) > 0 {
+		n := len(samples)
+		if n > maxCounterSamples {
+			n = maxCounterSamples
+		}
+		if err := r.send(device.ID(), samples[:n]); err != nil {
+			return err
+		}
+		samples = samples[n:]
+	}
+
+	return nil
+}
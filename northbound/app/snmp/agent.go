@@ -0,0 +1,243 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package snmp
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// SNMPv2c. SNMPv1 is not supported as it has no Counter64.
+	snmpVersion2c = 1
+
+	pduGetRequest     = 0xA0
+	pduGetNextRequest = 0xA1
+	pduResponse       = 0xA2
+	pduSetRequest     = 0xA3
+	pduGetBulkRequest = 0xA5
+
+	errNotWritable = 17
+
+	// Maximum size of the variable bindings in a response, which fits in a UDP datagram.
+	maxResponseSize = 60000
+	// Maximum number of the variable bindings in a request.
+	maxRequestBindings = 128
+)
+
+// handle returns the response of the request message in b. It returns an error
+// if the message is invalid or is not allowed, which should be silently discarded.
+func (r *SNMP) handle(b []byte) ([]byte, error) {
+	msg, _, err := expectTLV(b, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	v, msg, err := expectTLV(msg, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	version, err := decodeInt(v)
+	if err != nil {
+		return nil, err
+	}
+	if version != snmpVersion2c {
+		return nil, fmt.Errorf("unsupported SNMP version: %v", version)
+	}
+	community, msg, err := expectTLV(msg, tagOctetString)
+	if err != nil {
+		return nil, err
+	}
+	if !r.checkCommunity(community) {
+		return nil, errors.New("invalid community")
+	}
+
+	pduType, pdu, _, err := readTLV(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := parsePDU(pdu)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := response{requestID: req.requestID}
+	switch pduType {
+	case pduGetRequest:
+		resp.bindings = r.get(r.currentView(), req.oids)
+	case pduGetNextRequest:
+		resp.bindings = r.getNext(r.currentView(), req.oids)
+	case pduGetBulkRequest:
+		// The error status and index are the non-repeaters and the max-repetitions.
+		resp.bindings = r.getBulk(r.currentView(), req.oids, int(req.field1), int(req.field2))
+	case pduSetRequest:
+		resp.errorStatus, resp.errorIndex = errNotWritable, 1
+		for _, oid := range req.oids {
+			resp.bindings = append(resp.bindings, variable{oid, value{tag: tagNull}})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SNMP PDU type: %#x", pduType)
+	}
+
+	return resp.marshal(community), nil
+}
+
+type request struct {
+	requestID int64
+	field1    int64
+	field2    int64
+	oids      []OID
+}
+
+func parsePDU(b []byte) (*request, error) {
+	fields := make([]int64, 3)
+	for i := range fields {
+		v, rest, err := expectTLV(b, tagInteger)
+		if err != nil {
+			return nil, err
+		}
+		if fields[i], err = decodeInt(v); err != nil {
+			return nil, err
+		}
+		b = rest
+	}
+	req := &request{requestID: fields[0], field1: fields[1], field2: fields[2]}
+
+	bindings, _, err := expectTLV(b, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	for len(bindings) > 0 {
+		var binding []byte
+		binding, bindings, err = expectTLV(bindings, tagSequence)
+		if err != nil {
+			return nil, err
+		}
+		v, _, err := expectTLV(binding, tagOID)
+		if err != nil {
+			return nil, err
+		}
+		oid, err := decodeOID(v)
+		if err != nil {
+			return nil, err
+		}
+		req.oids = append(req.oids, oid)
+		if len(req.oids) > maxRequestBindings {
+			return nil, errors.New("too many variable bindings")
+		}
+	}
+
+	return req, nil
+}
+
+func (r *SNMP) get(view mibView, oids []OID) []variable {
+	result := make([]variable, 0, len(oids))
+	for _, oid := range oids {
+		v, ok := view.get(oid)
+		if !ok {
+			v = value{tag: tagNoSuchObject}
+			if len(oid) > 1 && view.hasPrefix(oid[:len(oid)-1]) {
+				v = value{tag: tagNoSuchInstance}
+			}
+		}
+		result = append(result, variable{oid, v})
+	}
+
+	return result
+}
+
+func (r *SNMP) getNext(view mibView, oids []OID) []variable {
+	result := make([]variable, 0, len(oids))
+	for _, oid := range oids {
+		v, ok := view.next(oid)
+		if !ok {
+			v = variable{oid, value{tag: tagEndOfMIBView}}
+		}
+		result = append(result, v)
+	}
+
+	return result
+}
+
+func (r *SNMP) getBulk(view mibView, oids []OID, nonRepeaters, maxRepetitions int) []variable {
+	if nonRepeaters < 0 {
+		nonRepeaters = 0
+	}
+	if nonRepeaters > len(oids) {
+		nonRepeaters = len(oids)
+	}
+	result := r.getNext(view, oids[:nonRepeaters])
+
+	repeaters := oids[nonRepeaters:]
+	size := 0
+	for i := 0; i < maxRepetitions && len(repeaters) > 0; i++ {
+		next := r.getNext(view, repeaters)
+		end := true
+		for j, v := range next {
+			size += len(v.marshal())
+			repeaters[j] = v.oid
+			if v.value.tag != tagEndOfMIBView {
+				end = false
+			}
+		}
+		if size > maxResponseSize {
+			break
+		}
+		result = append(result, next...)
+		if end {
+			break
+		}
+	}
+
+	return result
+}
+
+type response struct {
+	requestID   int64
+	errorStatus int64
+	errorIndex  int64
+	bindings    []variable
+}
+
+func (r *response) marshal(community []byte) []byte {
+	bindings := []byte{}
+	for _, v := range r.bindings {
+		bindings = append(bindings, v.marshal()...)
+	}
+
+	pdu := appendTLV(nil, tagInteger, encodeInt(r.requestID))
+	pdu = appendTLV(pdu, tagInteger, encodeInt(r.errorStatus))
+	pdu = appendTLV(pdu, tagInteger, encodeInt(r.errorIndex))
+	pdu = appendTLV(pdu, tagSequence, bindings)
+
+	msg := appendTLV(nil, tagInteger, encodeInt(snmpVersion2c))
+	msg = appendTLV(msg, tagOctetString, community)
+	msg = appendTLV(msg, pduResponse, pdu)
+
+	return appendTLV(nil, tagSequence, msg)
+}
+
+func (r variable) marshal() []byte {
+	b := appendTLV(nil, tagOID, encodeOID(r.oid))
+	b = appendTLV(b, r.value.tag, r.value.data)
+
+	return appendTLV(nil, tagSequence, b)
+}
@@ -0,0 +1,301 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file is a minimal BER (X.690) codec for the SNMP messages.
+
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+	tagIPAddress   = 0x40
+	tagCounter32   = 0x41
+	tagGauge32     = 0x42
+	tagTimeTicks   = 0x43
+	tagCounter64   = 0x46
+	// Exceptions of the SNMPv2 variable bindings.
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMIBView   = 0x82
+)
+
+var errTruncated = errors.New("truncated BER encoding")
+
+// readTLV reads a tag-length-value from b, and then returns the value and the remaining bytes.
+func readTLV(b []byte) (tag byte, value, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+	tag = b[0]
+	length := int(b[1])
+	offset := 2
+	if length&0x80 != 0 {
+		n := length & 0x7F
+		// Longer lengths than 3 bytes are not used by a UDP datagram.
+		if n == 0 || n > 3 || len(b) < 2+n {
+			return 0, nil, nil, errTruncated
+		}
+		length = 0
+		for _, v := range b[2 : 2+n] {
+			length = length<<8 | int(v)
+		}
+		offset += n
+	}
+	if len(b) < offset+length {
+		return 0, nil, nil, errTruncated
+	}
+
+	return tag, b[offset : offset+length], b[offset+length:], nil
+}
+
+// expectTLV reads a tag-length-value whose tag should be tag.
+func expectTLV(b []byte, tag byte) (value, rest []byte, err error) {
+	t, value, rest, err := readTLV(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t != tag {
+		return nil, nil, fmt.Errorf("unexpected BER tag: expected=%#x, actual=%#x", tag, t)
+	}
+
+	return value, rest, nil
+}
+
+func appendTLV(b []byte, tag byte, value []byte) []byte {
+	b = append(b, tag)
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xFF:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xFFFF:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	return append(b, value...)
+}
+
+func decodeInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, errors.New("invalid BER integer")
+	}
+	// Sign extension.
+	v := int64(int8(b[0]))
+	for _, x := range b[1:] {
+		v = v<<8 | int64(x)
+	}
+
+	return v, nil
+}
+
+// encodeInt returns the minimal two's complement encoding of v.
+func encodeInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for (v > 0x7F || v < -0x80) && len(b) < 8 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+
+	return b
+}
+
+// encodeUint returns the encoding of the unsigned v, which has a leading zero
+// byte if its most significant bit is set not to be negative.
+func encodeUint(v uint64) []byte {
+	b := []byte{byte(v)}
+	for v > 0xFF {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+
+	return b
+}
+
+// OID is an object identifier.
+type OID []uint32
+
+// ParseOID parses the dotted notation of an OID, e.g., 1.3.6.1.2.1.1.1.0.
+func ParseOID(s string) (OID, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), ".")
+	if s == "" {
+		return nil, errors.New("empty OID")
+	}
+	result := OID{}
+	for _, v := range strings.Split(s, ".") {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID: %v", s)
+		}
+		result = append(result, uint32(n))
+	}
+	if len(result) < 2 || result[0] > 2 || (result[0] < 2 && result[1] >= 40) {
+		return nil, fmt.Errorf("invalid OID: %v", s)
+	}
+
+	return result, nil
+}
+
+func (r OID) String() string {
+	v := make([]string, len(r))
+	for i, n := range r {
+		v[i] = strconv.FormatUint(uint64(n), 10)
+	}
+
+	return strings.Join(v, ".")
+}
+
+// Append returns a new OID that has the sub-identifiers of r followed by v.
+func (r OID) Append(v ...uint32) OID {
+	result := make(OID, 0, len(r)+len(v))
+	result = append(result, r...)
+
+	return append(result, v...)
+}
+
+// Compare returns -1, 0, or 1 if r is less than, equal to, or greater than v in the lexicographical order.
+func (r OID) Compare(v OID) int {
+	for i := 0; i < len(r) && i < len(v); i++ {
+		switch {
+		case r[i] < v[i]:
+			return -1
+		case r[i] > v[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(r) < len(v):
+		return -1
+	case len(r) > len(v):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func encodeOID(oid OID) []byte {
+	if len(oid) < 2 {
+		// Zero OID (0.0).
+		return []byte{0}
+	}
+	b := encodeBase128(nil, oid[0]*40+oid[1])
+	for _, v := range oid[2:] {
+		b = encodeBase128(b, v)
+	}
+
+	return b
+}
+
+func encodeBase128(b []byte, v uint32) []byte {
+	tmp := []byte{byte(v & 0x7F)}
+	for v >>= 7; v > 0; v >>= 7 {
+		tmp = append([]byte{byte(v&0x7F) | 0x80}, tmp...)
+	}
+
+	return append(b, tmp...)
+}
+
+func decodeOID(b []byte) (OID, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty BER OID")
+	}
+	values := []uint32{}
+	var v uint64
+	for i, x := range b {
+		v = v<<7 | uint64(x&0x7F)
+		if v > 0xFFFFFFFF {
+			return nil, errors.New("too large OID sub-identifier")
+		}
+		if x&0x80 == 0 {
+			values = append(values, uint32(v))
+			v = 0
+		} else if i == len(b)-1 {
+			return nil, errTruncated
+		}
+	}
+
+	// The first value has the first two sub-identifiers.
+	var result OID
+	switch first := values[0]; {
+	case first < 40:
+		result = OID{0, first}
+	case first < 80:
+		result = OID{1, first - 40}
+	default:
+		result = OID{2, first - 80}
+	}
+
+	return append(result, values[1:]...), nil
+}
+
+// value is the encoded value of a variable.
+type value struct {
+	tag  byte
+	data []byte
+}
+
+func integer(v int64) value {
+	return value{tagInteger, encodeInt(v)}
+}
+
+func octetString(v string) value {
+	return value{tagOctetString, []byte(v)}
+}
+
+func objectID(v OID) value {
+	return value{tagOID, encodeOID(v)}
+}
+
+// counter32 returns the lower 32 bits of v, which wraps around.
+func counter32(v uint64) value {
+	return value{tagCounter32, encodeUint(uint64(uint32(v)))}
+}
+
+// gauge32 returns v, which is saturated at the maximum 32-bit value.
+func gauge32(v uint64) value {
+	if v > 0xFFFFFFFF {
+		v = 0xFFFFFFFF
+	}
+	return value{tagGauge32, encodeUint(v)}
+}
+
+// timeTicks returns v in hundredths of a second.
+func timeTicks(v uint64) value {
+	return value{tagTimeTicks, encodeUint(uint64(uint32(v)))}
+}
+
+func counter64(v uint64) value {
+	return value{tagCounter64, encodeUint(v)}
+}
@@ -0,0 +1,195 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/superkkt/cherry/metrics"
+	"github.com/superkkt/cherry/network"
+)
+
+var (
+	mib2System = OID{1, 3, 6, 1, 2, 1, 1}
+	ifNumber   = OID{1, 3, 6, 1, 2, 1, 2, 1, 0}
+	ifEntry    = OID{1, 3, 6, 1, 2, 1, 2, 2, 1}
+	ifXEntry   = OID{1, 3, 6, 1, 2, 1, 31, 1, 1, 1}
+)
+
+// ifType of ethernetCsmacd.
+const ifTypeEthernet = 6
+
+type variable struct {
+	oid   OID
+	value value
+}
+
+// mibView is the snapshot of all the variables sorted by their OIDs.
+type mibView []variable
+
+func (r mibView) get(oid OID) (value, bool) {
+	i := sort.Search(len(r), func(i int) bool { return r[i].oid.Compare(oid) >= 0 })
+	if i < len(r) && r[i].oid.Compare(oid) == 0 {
+		return r[i].value, true
+	}
+
+	return value{}, false
+}
+
+// next returns the first variable whose OID is greater than oid.
+func (r mibView) next(oid OID) (variable, bool) {
+	i := sort.Search(len(r), func(i int) bool { return r[i].oid.Compare(oid) > 0 })
+	if i < len(r) {
+		return r[i], true
+	}
+
+	return variable{}, false
+}
+
+// hasPrefix returns whether there is a variable whose OID starts with prefix.
+func (r mibView) hasPrefix(prefix OID) bool {
+	v, ok := r.next(prefix)
+	return ok && len(v.oid) > len(prefix) && v.oid[:len(prefix)].Compare(prefix) == 0
+}
+
+// buildView returns the current MIB view, which consists of the system group
+// and the interfaces of MIB-II, the ifXTable of IF-MIB, and the private MIB of
+// the controller under the enterprise OID.
+func (r *SNMP) buildView() mibView {
+	view := mibView{}
+	add := func(oid OID, v value) { view = append(view, variable{oid, v}) }
+
+	hostname, _ := os.Hostname()
+	add(mib2System.Append(1, 0), octetString("Cherry OpenFlow Controller"))
+	add(mib2System.Append(2, 0), objectID(r.enterprise))
+	add(mib2System.Append(3, 0), timeTicks(uint64(time.Since(r.started)/(10*time.Millisecond))))
+	add(mib2System.Append(4, 0), octetString(r.conf.Defaults().GetString("admin_email")))
+	add(mib2System.Append(5, 0), octetString(hostname))
+	add(mib2System.Append(6, 0), octetString(r.location))
+	// Data link and network layers.
+	add(mib2System.Append(7, 0), integer(6))
+
+	devices, links, portsUp := 0, 0, 0
+	interfaces := 0
+	if finder := r.getFinder(); finder != nil {
+		links = len(finder.Links())
+		for _, d := range finder.Devices() {
+			if d.ID() == "" {
+				// Not initialized yet.
+				continue
+			}
+			devices++
+			for _, p := range network.NewPortInfos(finder, d) {
+				index, ok := r.ifIndex(d, p.Number)
+				if !ok {
+					continue
+				}
+				interfaces++
+				if p.AdminUp && p.LinkUp {
+					portsUp++
+				}
+				r.addInterface(add, index, d, p)
+			}
+		}
+	}
+	add(ifNumber, integer(int64(interfaces)))
+
+	health := r.enterprise.Append(1)
+	add(health.Append(1, 0), gauge32(uint64(devices)))
+	add(health.Append(2, 0), gauge32(uint64(links)))
+	add(health.Append(3, 0), gauge32(uint64(portsUp)))
+	add(health.Append(4, 0), counter64(metricValue("openflow_packet_ins_total")))
+	add(health.Append(5, 0), counter64(metricValue("openflow_flow_mods_total")))
+	add(health.Append(6, 0), counter64(metricValue("database_query_errors_total")))
+	add(health.Append(7, 0), gauge32(uint64(runtime.NumGoroutine())))
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	add(health.Append(8, 0), gauge32(mem.HeapAlloc))
+
+	sort.Slice(view, func(i, j int) bool { return view[i].oid.Compare(view[j].oid) < 0 })
+
+	return view
+}
+
+func (r *SNMP) addInterface(add func(OID, value), index uint32, d *network.Device, p network.PortInfo) {
+	stats, _ := r.portStats(d.ID(), p.Number)
+	status := func(up bool) value {
+		if up {
+			return integer(1)
+		}
+		return integer(2)
+	}
+	mac, _ := net.ParseMAC(p.MAC)
+
+	add(ifEntry.Append(1, index), integer(int64(index)))
+	add(ifEntry.Append(2, index), octetString(fmt.Sprintf("%v on DPID %v", p.Name, d.Features().DPID)))
+	add(ifEntry.Append(3, index), integer(ifTypeEthernet))
+	add(ifEntry.Append(5, index), gauge32(p.Speed*1000000))
+	add(ifEntry.Append(6, index), octetString(string(mac)))
+	add(ifEntry.Append(7, index), status(p.AdminUp))
+	add(ifEntry.Append(8, index), status(p.AdminUp && p.LinkUp))
+	// The unicast packets are the total packets as OpenFlow does not distinguish them.
+	add(ifEntry.Append(10, index), counter32(stats.RxBytes))
+	add(ifEntry.Append(11, index), counter32(stats.RxPackets))
+	add(ifEntry.Append(13, index), counter32(stats.RxDropped))
+	add(ifEntry.Append(14, index), counter32(stats.RxErrors))
+	add(ifEntry.Append(16, index), counter32(stats.TxBytes))
+	add(ifEntry.Append(17, index), counter32(stats.TxPackets))
+	add(ifEntry.Append(19, index), counter32(stats.TxDropped))
+	add(ifEntry.Append(20, index), counter32(stats.TxErrors))
+
+	add(ifXEntry.Append(1, index), octetString(p.Name))
+	add(ifXEntry.Append(6, index), counter64(stats.RxBytes))
+	add(ifXEntry.Append(7, index), counter64(stats.RxPackets))
+	add(ifXEntry.Append(10, index), counter64(stats.TxBytes))
+	add(ifXEntry.Append(11, index), counter64(stats.TxPackets))
+	add(ifXEntry.Append(15, index), gauge32(p.Speed))
+	add(ifXEntry.Append(18, index), octetString(p.ID))
+}
+
+// metricValue returns the value of the counter or the sum of the counter vector whose name is name.
+func metricValue(name string) uint64 {
+	for _, m := range metrics.All() {
+		if m.Name != name {
+			continue
+		}
+		switch v := m.Value.(type) {
+		case uint64:
+			return v
+		case []metrics.LabeledValue:
+			var sum uint64
+			for _, l := range v {
+				if n, ok := l.Value.(uint64); ok {
+					sum += n
+				}
+			}
+			return sum
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,273 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package snmp is an SNMPv2c agent that exposes the ports of the switches in
+// the ifTable of MIB-II and the ifXTable of IF-MIB, and the health of the
+// controller in a private MIB, so that the legacy network management systems
+// can monitor the fabric. The variables are read-only.
+package snmp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+
+	"github.com/superkkt/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("snmp")
+)
+
+const (
+	defaultPort     = 161
+	defaultInterval = 10 * time.Second
+	statsTimeout    = 5 * time.Second
+	// The MIB view is rebuilt at most once in this period, so that a walk sees a consistent view.
+	viewTTL = 1 * time.Second
+	// netSnmpPlaypen of NET-SNMP-MIB, which is the subtree for experiments.
+	// Set snmp.enterprise_oid to the OID under the private enterprise number of your organization.
+	defaultEnterprise = "1.3.6.1.4.1.8072.9999.9999"
+)
+
+type SNMP struct {
+	app.BaseProcessor
+	conf       app.Config
+	port       int
+	community  string
+	location   string
+	interval   time.Duration
+	enterprise OID
+	started    time.Time
+	once       sync.Once
+
+	mutex    sync.Mutex
+	finder   network.Finder                           // Nil until a device is connected.
+	indexes  map[uint64]uint32                        // Key = DPID, Value = device index.
+	stats    map[string]map[uint32]openflow.PortStats // Key = Device ID, and then port number.
+	view     mibView
+	viewTime time.Time
+}
+
+func New(conf app.Config) *SNMP {
+	return &SNMP{
+		indexes: make(map[uint64]uint32),
+		stats:   make(map[string]map[uint32]openflow.PortStats),
+		conf:    conf,
+	}
+}
+
+func (r *SNMP) Init(ctx context.Context, s app.Services) error {
+	r.port = defaultPort
+	if r.conf.IsSet("port") {
+		r.port = r.conf.GetInt("port")
+		if r.port <= 0 || r.port > 0xFFFF {
+			return errors.New("invalid snmp.port in the config file")
+		}
+	}
+	r.community = r.conf.GetString("community")
+	if r.community == "" {
+		return errors.New("invalid snmp.community in the config file")
+	}
+	r.location = r.conf.GetString("location")
+
+	r.interval = defaultInterval
+	if r.conf.IsSet("polling_interval") {
+		interval := r.conf.GetInt("polling_interval")
+		if interval <= 0 {
+			return errors.New("invalid snmp.polling_interval in the config file")
+		}
+		r.interval = time.Duration(interval) * time.Second
+	}
+
+	enterprise := defaultEnterprise
+	if r.conf.IsSet("enterprise_oid") {
+		enterprise = r.conf.GetString("enterprise_oid")
+	}
+	oid, err := ParseOID(enterprise)
+	if err != nil {
+		return errors.New("invalid snmp.enterprise_oid in the config file")
+	}
+	r.enterprise = oid
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: r.port})
+	if err != nil {
+		return err
+	}
+	r.started = time.Now()
+	go r.serve(ctx, conn)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	return nil
+}
+
+func (r *SNMP) Name() string {
+	return "SNMP"
+}
+
+func (r *SNMP) String() string {
+	return fmt.Sprintf("%v (port=%v, interval=%v, enterprise=%v)", r.Name(), r.port, r.interval, r.enterprise)
+}
+
+func (r *SNMP) getFinder() network.Finder {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.finder
+}
+
+func (r *SNMP) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	r.finder = finder
+	r.mutex.Unlock()
+	r.once.Do(func() {
+		go r.poller(finder)
+	})
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *SNMP) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	r.mutex.Lock()
+	delete(r.stats, device.ID())
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
+
+// poller caches the port counters of all the devices, so that an SNMP request
+// does not wait for the switches.
+func (r *SNMP) poller(finder network.Finder) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, device := range finder.Devices() {
+			if device.ID() == "" {
+				continue
+			}
+			stats, err := device.PortStats(statsTimeout)
+			if err != nil {
+				logger.Errorf("failed to query the port stats from %v: %v", device.ID(), err)
+				continue
+			}
+			ports := make(map[uint32]openflow.PortStats)
+			for _, v := range stats {
+				ports[v.PortNumber] = v
+			}
+			r.mutex.Lock()
+			r.stats[device.ID()] = ports
+			r.mutex.Unlock()
+		}
+		<-ticker.C
+	}
+}
+
+func (r *SNMP) portStats(deviceID string, port uint32) (openflow.PortStats, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.stats[deviceID][port]
+	return v, ok
+}
+
+// ifIndex returns the interface index of the port, which is the index of the
+// device in the upper 15 bits and the port number in the lower 16 bits. The
+// device indexes are assigned in the order that the devices are found, and they
+// are kept until the controller is restarted so that the NMS can track them.
+func (r *SNMP) ifIndex(d *network.Device, port uint32) (uint32, bool) {
+	if port == 0 || port > 0xFFFF {
+		return 0, false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	dpid := d.Features().DPID
+	index, ok := r.indexes[dpid]
+	if !ok {
+		index = uint32(len(r.indexes) + 1)
+		if index > 0x7FFF {
+			return 0, false
+		}
+		r.indexes[dpid] = index
+		logger.Infof("assigned the SNMP device index %v to DPID %v", index, dpid)
+	}
+
+	return index<<16 | port, true
+}
+
+// currentView returns the recent MIB view.
+func (r *SNMP) currentView() mibView {
+	r.mutex.Lock()
+	if r.view != nil && time.Since(r.viewTime) < viewTTL {
+		defer r.mutex.Unlock()
+		return r.view
+	}
+	r.mutex.Unlock()
+
+	// buildView locks the mutex.
+	view := r.buildView()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.view, r.viewTime = view, time.Now()
+
+	return view
+}
+
+func (r *SNMP) serve(ctx context.Context, conn *net.UDPConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The connection is closed on shutdown.
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("failed to read an SNMP request: %v", err)
+			continue
+		}
+		resp, err := r.handle(buf[:n])
+		if err != nil {
+			logger.Debugf("invalid SNMP request from %v: %v", addr, err)
+			continue
+		}
+		if _, err := conn.WriteToUDP(resp, addr); err != nil {
+			logger.Errorf("failed to send the SNMP response to %v: %v", addr, err)
+		}
+	}
+}
+
+func (r *SNMP) checkCommunity(community []byte) bool {
+	return subtle.ConstantTimeCompare(community, []byte(r.community)) == 1
+}
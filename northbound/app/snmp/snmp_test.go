@@ -0,0 +1,152 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package snmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/northbound/app"
+)
+
+// GetRequest of sysDescr.0 sent by "snmpget -v2c -c public".
+var getSysDescr = []byte{
+	0x30, 0x29, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+	0xA0, 0x1C, 0x02, 0x04, 0x12, 0x34, 0x56, 0x78, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+	0x30, 0x0E, 0x30, 0x0C, 0x06, 0x08, 0x2B, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+}
+
+func newTestAgent() *SNMP {
+	r := New(app.NewConfig("snmp"))
+	r.community = "public"
+	r.enterprise, _ = ParseOID(defaultEnterprise)
+	r.started = time.Now()
+
+	return r
+}
+
+// parseResponse returns the request ID and the variable bindings of a response.
+func parseResponse(t *testing.T, b []byte) (int64, []variable) {
+	msg, _, err := expectTLV(b, tagSequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, msg, _ = expectTLV(msg, tagInteger)
+	_, msg, _ = expectTLV(msg, tagOctetString)
+	pdu, _, err := expectTLV(msg, pduResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, pdu, _ := expectTLV(pdu, tagInteger)
+	id, _ := decodeInt(v)
+	_, pdu, _ = expectTLV(pdu, tagInteger)
+	_, pdu, _ = expectTLV(pdu, tagInteger)
+	bindings, _, err := expectTLV(pdu, tagSequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := []variable{}
+	for len(bindings) > 0 {
+		var binding []byte
+		binding, bindings, _ = expectTLV(bindings, tagSequence)
+		o, binding, _ := expectTLV(binding, tagOID)
+		oid, err := decodeOID(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, data, _, _ := readTLV(binding)
+		result = append(result, variable{oid, value{tag, data}})
+	}
+
+	return id, result
+}
+
+func TestGet(t *testing.T) {
+	r := newTestAgent()
+	resp, err := r.handle(getSysDescr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, vars := parseResponse(t, resp)
+	if id != 0x12345678 {
+		t.Fatalf("unexpected request ID: %#x", id)
+	}
+	if len(vars) != 1 || vars[0].oid.String() != "1.3.6.1.2.1.1.1.0" || string(vars[0].value.data) != "Cherry OpenFlow Controller" {
+		t.Fatalf("unexpected variables: %v", vars)
+	}
+
+	r.community = "private"
+	if _, err := r.handle(getSysDescr); err == nil {
+		t.Fatal("expected an error for the wrong community")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	r := newTestAgent()
+	view := r.currentView()
+
+	// Walk all the variables by GETNEXT.
+	oid := OID{1, 3}
+	n := 0
+	for {
+		v := r.getNext(view, []OID{oid})[0]
+		if v.value.tag == tagEndOfMIBView {
+			break
+		}
+		if v.oid.Compare(oid) <= 0 {
+			t.Fatalf("OIDs are not increasing: %v after %v", v.oid, oid)
+		}
+		oid = v.oid
+		n++
+	}
+	if n != len(view) {
+		t.Fatalf("unexpected number of the walked variables: expected=%v, actual=%v", len(view), n)
+	}
+
+	bulk := r.getBulk(view, []OID{{1, 3}}, 0, 5)
+	if len(bulk) != 5 || bulk[4].oid.Compare(view[4].oid) != 0 {
+		t.Fatalf("unexpected GETBULK result: %v", bulk)
+	}
+}
+
+func TestBER(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 0x12345678, -0x7FFFFFFF} {
+		n, err := decodeInt(encodeInt(v))
+		if err != nil || n != v {
+			t.Fatalf("integer round trip failed: %v != %v, err=%v", n, v, err)
+		}
+	}
+	for _, s := range []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.4.1.8072.9999.9999", "2.999.1"} {
+		oid, err := ParseOID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := decodeOID(encodeOID(oid))
+		if err != nil || v.String() != s {
+			t.Fatalf("OID round trip failed: %v != %v, err=%v", v, s, err)
+		}
+	}
+	if b := encodeUint(0xFFFFFFFF); len(b) != 5 || b[0] != 0 {
+		t.Fatalf("unexpected encoding of an unsigned value: %x", b)
+	}
+}
@@ -22,6 +22,7 @@
 package virtualip
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strconv"
@@ -62,7 +63,7 @@ func New(db database) *VirtualIP {
 	}
 }
 
-func (r *VirtualIP) Init() error {
+func (r *VirtualIP) Init(ctx context.Context, s app.Services) error {
 	return nil
 }
 
@@ -118,6 +119,10 @@ func (r *VirtualIP) OnPortDown(finder network.Finder, port *network.Port) error
 }
 
 func (r *VirtualIP) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	// The device is still alive under the new leader.
+	if device.IsHandedOver() {
+		return r.BaseProcessor.OnDeviceDown(finder, device)
+	}
 	logger.Debugf("device down! checking VIPs that belong to the device... (DPID=%v)", device.ID())
 
 	dpid, err := strconv.ParseUint(device.ID(), 10, 64)
@@ -0,0 +1,107 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"encoding/binary"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/protocol"
+)
+
+// filteredProcessor passes the PACKET_INs that do not match the interests of
+// the application to the next application without the application.
+type filteredProcessor struct {
+	app.Processor
+	interests []app.Interest
+}
+
+func (r *filteredProcessor) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	if interested(r.interests, eth) {
+		return r.Processor.OnPacketIn(finder, ingress, eth)
+	}
+	next, ok := r.Processor.Next()
+	if !ok {
+		return nil
+	}
+
+	return next.OnPacketIn(finder, ingress, eth)
+}
+
+func interested(interests []app.Interest, eth *protocol.Ethernet) bool {
+	var parsed bool
+	var proto uint8
+	var port uint16
+	for _, v := range interests {
+		if v.EtherType != 0 && v.EtherType != eth.Type {
+			continue
+		}
+		if v.IPProtocol == 0 && v.Port == 0 {
+			return true
+		}
+		if !parsed {
+			proto, port = transport(eth)
+			parsed = true
+		}
+		if v.IPProtocol != 0 && v.IPProtocol != proto {
+			continue
+		}
+		if v.Port != 0 && v.Port != port {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+// transport returns the IP protocol and the TCP or UDP destination port of
+// eth, which are zero if they are unknown. The IPv6 extension headers are not
+// followed.
+func transport(eth *protocol.Ethernet) (proto uint8, port uint16) {
+	b := eth.Payload
+	var offset int
+	switch eth.Type {
+	case 0x0800:
+		if len(b) < 20 {
+			return 0, 0
+		}
+		proto, offset = b[9], int(b[0]&0x0F)*4
+		// Only the first fragment has the ports.
+		if binary.BigEndian.Uint16(b[6:8])&0x1FFF != 0 {
+			return proto, 0
+		}
+	case 0x86DD:
+		if len(b) < 40 {
+			return 0, 0
+		}
+		proto, offset = b[6], 40
+	default:
+		return 0, 0
+	}
+	if (proto != 6 && proto != 17) || len(b) < offset+4 {
+		return proto, 0
+	}
+
+	return proto, binary.BigEndian.Uint16(b[offset+2 : offset+4])
+}
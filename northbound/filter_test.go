@@ -0,0 +1,65 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"testing"
+
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/protocol"
+)
+
+func newIPv4Packet(proto uint8, dstPort uint16, fragment uint16) *protocol.Ethernet {
+	payload := make([]byte, 28)
+	payload[0] = 0x45 // Version 4, IHL 5
+	payload[6], payload[7] = byte(fragment>>8), byte(fragment)
+	payload[9] = proto
+	payload[22], payload[23] = byte(dstPort>>8), byte(dstPort)
+
+	return &protocol.Ethernet{Type: 0x0800, Payload: payload}
+}
+
+func TestInterested(t *testing.T) {
+	dhcp := []app.Interest{{EtherType: 0x0806}, {EtherType: 0x0800, IPProtocol: 17, Port: 67}}
+	tests := []struct {
+		interests []app.Interest
+		eth       *protocol.Ethernet
+		expected  bool
+	}{
+		{dhcp, &protocol.Ethernet{Type: 0x0806}, true},
+		{dhcp, newIPv4Packet(17, 67, 0), true},
+		{dhcp, newIPv4Packet(17, 53, 0), false},
+		{dhcp, newIPv4Packet(6, 67, 0), false},
+		// Non-first fragment whose ports are unknown.
+		{dhcp, newIPv4Packet(17, 67, 10), false},
+		{dhcp, &protocol.Ethernet{Type: 0x0800, Payload: []byte{0x45}}, false},
+		{dhcp, &protocol.Ethernet{Type: 0x86DD}, false},
+		{[]app.Interest{{IPProtocol: 6}}, newIPv4Packet(6, 80, 0), true},
+		{[]app.Interest{{}}, &protocol.Ethernet{Type: 0x88CC}, true},
+	}
+
+	for i, v := range tests {
+		if result := interested(v.interests, v.eth); result != v.expected {
+			t.Errorf("#%v: expected=%v, actual=%v", i, v.expected, result)
+		}
+	}
+}
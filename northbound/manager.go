@@ -23,19 +23,37 @@ package northbound
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/superkkt/cherry/database"
 	"github.com/superkkt/cherry/network"
 	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/northbound/app/acl"
+	"github.com/superkkt/cherry/northbound/app/auth"
+	"github.com/superkkt/cherry/northbound/app/ddos"
 	"github.com/superkkt/cherry/northbound/app/discovery"
+	"github.com/superkkt/cherry/northbound/app/elephant"
+	"github.com/superkkt/cherry/northbound/app/grpcapi"
+	"github.com/superkkt/cherry/northbound/app/ids"
+	"github.com/superkkt/cherry/northbound/app/ipfix"
+	"github.com/superkkt/cherry/northbound/app/journal"
 	"github.com/superkkt/cherry/northbound/app/l2switch"
 	"github.com/superkkt/cherry/northbound/app/monitor"
+	"github.com/superkkt/cherry/northbound/app/ovsdb"
+	"github.com/superkkt/cherry/northbound/app/pbr"
+	"github.com/superkkt/cherry/northbound/app/portal"
 	"github.com/superkkt/cherry/northbound/app/proxyarp"
+	"github.com/superkkt/cherry/northbound/app/router"
+	"github.com/superkkt/cherry/northbound/app/sflow"
+	"github.com/superkkt/cherry/northbound/app/snmp"
 	"github.com/superkkt/cherry/northbound/app/virtualip"
 
+	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/pkg/errors"
 	"github.com/superkkt/go-logging"
 )
@@ -48,33 +66,155 @@ type EventSender interface {
 	SetEventListener(network.EventListener)
 }
 
+type RESTServer interface {
+	ServeREST(routes ...*rest.Route)
+}
+
+type HealthServer interface {
+	AddHealthCheck(network.HealthCheck)
+}
+
 type application struct {
-	instance app.Processor
-	enabled  bool
+	instance    app.Processor
+	enabled     bool
+	initialized bool
+	// Whether the application has been disabled at runtime after it was enabled.
+	paused bool
+}
+
+// XXX: Caller should lock the mutex before they call this function
+func (r *application) pause() {
+	r.paused = true
+	p, ok := r.instance.(app.Pauser)
+	if !ok {
+		return
+	}
+	if err := p.Pause(); err != nil {
+		logger.Errorf("failed to pause %v application: %v", r.instance.Name(), err)
+	}
+}
+
+// XXX: Caller should lock the mutex before they call this function
+func (r *application) resume() {
+	if !r.paused {
+		return
+	}
+	r.paused = false
+	p, ok := r.instance.(app.Pauser)
+	if !ok {
+		return
+	}
+	if err := p.Resume(); err != nil {
+		logger.Errorf("failed to resume %v application: %v", r.instance.Name(), err)
+	}
 }
 
 type Manager struct {
-	mutex      sync.Mutex
-	apps       map[string]*application // Registered applications
-	head, tail app.Processor
-	db         *database.MySQL
+	mutex sync.Mutex
+	apps  map[string]*application // Registered applications
+	// Names of the applications in the order they receive the events.
+	order []string
+	// root passes the events from the controller to the first enabled
+	// application, so that the applications can be enabled and disabled
+	// without replacing the event listener of the controller.
+	root     *app.BaseProcessor
+	db       database.Database
+	reloader func() error
+	// Devices processed by the applications. Key = application name in uppercase.
+	// The applications that are not in scopes process all the devices.
+	scopes map[string]scope
+	// Given to the applications when they are initialized.
+	ctx      context.Context
+	services app.Services
 }
 
-func NewManager(db *database.MySQL) (*Manager, error) {
+func NewManager(db database.Database) (*Manager, error) {
 	v := &Manager{
-		apps: make(map[string]*application),
-		db:   db,
+		apps:     make(map[string]*application),
+		root:     new(app.BaseProcessor),
+		db:       db,
+		ctx:      context.Background(),
+		services: app.NewServices(nil),
 	}
 	// Registering north-bound applications
-	v.register(discovery.New(db))
-	v.register(l2switch.New(db))
+	v.register(discovery.New(db, app.NewConfig("discovery")))
+	v.register(l2switch.New(db, app.NewConfig("l2switch")))
 	v.register(proxyarp.New(db))
-	v.register(monitor.New())
+	v.register(monitor.New(app.NewConfig("monitor")))
 	v.register(virtualip.New(db))
+	v.register(auth.New(app.NewConfig("auth")))
+	v.register(portal.New(app.NewConfig("portal")))
+	v.register(acl.New(db, app.NewConfig("acl")))
+	v.register(ids.New(app.NewConfig("ids")))
+	v.register(ddos.New(app.NewConfig("ddos")))
+	v.register(elephant.New(app.NewConfig("elephant")))
+	v.register(sflow.New(app.NewConfig("sflow")))
+	v.register(ipfix.New(app.NewConfig("ipfix")))
+	v.register(pbr.New(db))
+	v.register(router.New(app.NewConfig("router")))
+	v.register(journal.New(db, app.NewConfig("journal")))
+	v.register(grpcapi.New(db, app.NewConfig("grpc")))
+	v.register(snmp.New(app.NewConfig("snmp")))
+	v.register(ovsdb.New(app.NewConfig("ovsdb")))
+	// Applications added by Register.
+	for _, f := range registered() {
+		instance := f.create(db, app.NewConfig(f.section))
+		if _, ok := v.apps[strings.ToUpper(instance.Name())]; ok {
+			return nil, fmt.Errorf("duplicated application name: %v", instance.Name())
+		}
+		v.register(instance)
+	}
 
 	return v, nil
 }
 
+// IsRegistered returns whether there is the application named appName.
+func (r *Manager) IsRegistered(appName string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, ok := r.apps[strings.ToUpper(appName)]
+	return ok
+}
+
+// SetServices sets ctx and the shared services given to the applications when
+// they are initialized, which should be called before enabling them.
+func (r *Manager) SetServices(ctx context.Context, s app.Services) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ctx = ctx
+	r.services = s
+}
+
+// Stop stops the initialized applications in the reverse order of the chain.
+func (r *Manager) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stopped := make(map[string]bool)
+	for i := len(r.order) - 1; i >= 0; i-- {
+		r.stop(r.order[i])
+		stopped[r.order[i]] = true
+	}
+	for key := range r.apps {
+		if !stopped[key] {
+			r.stop(key)
+		}
+	}
+}
+
+// XXX: Caller should lock the mutex before they call this function
+func (r *Manager) stop(key string) {
+	v := r.apps[key]
+	if !v.initialized {
+		return
+	}
+	logger.Debugf("stopping %v application..", v.instance.Name())
+	v.instance.Stop()
+	v.initialized = false
+}
+
 func (r *Manager) register(app app.Processor) {
 	r.apps[strings.ToUpper(app.Name())] = &application{
 		instance: app,
@@ -100,19 +240,29 @@ func (r *Manager) checkDependencies(appNames []string) error {
 	return nil
 }
 
+// Enable adds the application at the end of the processor chain. An application
+// that has been disabled at runtime takes its previous position in the chain.
 func (r *Manager) Enable(appName string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	logger.Debugf("enabling %v application..", appName)
-	v, ok := r.apps[strings.ToUpper(appName)]
+	name := strings.ToUpper(appName)
+	v, ok := r.apps[name]
 	if !ok {
 		return fmt.Errorf("unknown application: %v", appName)
 	}
+	if v.enabled {
+		return nil
+	}
 	app := v.instance
 
-	if err := app.Init(); err != nil {
-		return errors.Wrap(err, "initializing application")
+	// Applications are initialized only once even if they are enabled again.
+	if !v.initialized {
+		if err := app.Init(r.ctx, r.services); err != nil {
+			return errors.Wrap(err, "initializing application")
+		}
+		v.initialized = true
 	}
 	if err := r.checkDependencies(app.Dependencies()); err != nil {
 		return errors.Wrap(err, "checking dependencies")
@@ -120,25 +270,320 @@ func (r *Manager) Enable(appName string) error {
 	v.enabled = true
 	logger.Debugf("enabled %v application", appName)
 
-	if r.head == nil {
-		r.head = app
-		r.tail = app
+	found := false
+	for _, n := range r.order {
+		if n == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		r.order = append(r.order, name)
+	}
+	r.relink()
+	v.resume()
+
+	return nil
+}
+
+// Disable removes the application from the processor chain, so that it does not
+// receive the events anymore. The applications that implement app.Pauser remove
+// their flows, and the flows installed by the others are kept.
+func (r *Manager) Disable(appName string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	logger.Debugf("disabling %v application..", appName)
+	v, ok := r.apps[strings.ToUpper(appName)]
+	if !ok {
+		return fmt.Errorf("unknown application: %v", appName)
+	}
+	if !v.enabled {
 		return nil
 	}
-	r.tail.SetNext(app)
-	r.tail = app
+	for _, a := range r.apps {
+		if !a.enabled {
+			continue
+		}
+		for _, d := range a.instance.Dependencies() {
+			if strings.EqualFold(d, appName) {
+				return fmt.Errorf("%v application depends on %v", a.instance.Name(), v.instance.Name())
+			}
+		}
+	}
+	v.enabled = false
+	r.relink()
+	v.pause()
+	logger.Infof("disabled %v application", appName)
+
+	return nil
+}
+
+// SetApplications enables the applications in names, which are linked in that
+// order, and disables the others.
+func (r *Manager) SetApplications(names []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	order, err := r.check(names)
+	if err != nil {
+		return err
+	}
+	enabled := make(map[string]bool)
+	for _, key := range order {
+		enabled[key] = true
+	}
+	for _, key := range order {
+		v := r.apps[key]
+		if v.initialized {
+			continue
+		}
+		if err := v.instance.Init(r.ctx, r.services); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("initializing %v application", v.instance.Name()))
+		}
+		v.initialized = true
+	}
+
+	// The disabled applications keep their positions for re-enabling.
+	for _, key := range r.order {
+		if !enabled[key] {
+			order = append(order, key)
+		}
+	}
+	toggled := []*application{}
+	for key, v := range r.apps {
+		if v.enabled != enabled[key] {
+			logger.Infof("%v application has been toggled: enabled=%v", v.instance.Name(), enabled[key])
+			toggled = append(toggled, v)
+		}
+		v.enabled = enabled[key]
+	}
+	r.order = order
+	r.relink()
+	for _, v := range toggled {
+		if v.enabled {
+			v.resume()
+		} else {
+			v.pause()
+		}
+	}
 
 	return nil
 }
 
+// Check returns an error if names, which are the applications in the order of
+// the config file, contain an unknown application or an application whose
+// dependencies do not precede it.
+func (r *Manager) Check(names []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, err := r.check(names)
+	return err
+}
+
+// XXX: Caller should lock the mutex before they call this function
+func (r *Manager) check(names []string) (order []string, err error) {
+	enabled := make(map[string]bool)
+	for _, name := range names {
+		key := strings.ToUpper(name)
+		v, ok := r.apps[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown application: %v", name)
+		}
+		// Dependencies should precede the application.
+		for _, d := range v.instance.Dependencies() {
+			if !enabled[strings.ToUpper(d)] {
+				return nil, fmt.Errorf("%v application requires %v application in front of it", name, d)
+			}
+		}
+		enabled[key] = true
+		order = append(order, key)
+	}
+
+	return order, nil
+}
+
+// Reload makes the enabled applications that implement app.Reloader apply the changes of the config file.
+func (r *Manager) Reload() error {
+	r.mutex.Lock()
+	reloaders := []app.Reloader{}
+	for _, key := range r.order {
+		v := r.apps[key]
+		if !v.enabled {
+			continue
+		}
+		if reloader, ok := v.instance.(app.Reloader); ok {
+			reloaders = append(reloaders, reloader)
+		}
+	}
+	r.mutex.Unlock()
+
+	failed := []string{}
+	for _, v := range reloaders {
+		if err := v.Reload(); err != nil {
+			name := v.(app.Processor).Name()
+			logger.Errorf("failed to reload %v application: %v", name, err)
+			failed = append(failed, fmt.Sprintf("%v: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to reload the applications: %v", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// SetReloader sets f that reloads the config file on POST /api/v1/config/reload.
+func (r *Manager) SetReloader(f func() error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reloader = f
+}
+
+// relink links the enabled applications in their order from the root.
+// XXX: Caller should lock the mutex before they call this function
+func (r *Manager) relink() {
+	// Linking from the tail never makes the chain skip an enabled application.
+	var next app.Processor
+	for i := len(r.order) - 1; i >= 0; i-- {
+		v := r.apps[r.order[i]]
+		if !v.enabled {
+			continue
+		}
+		var instance app.Processor = v.instance
+		if f, ok := v.instance.(app.PacketFilter); ok && len(f.Interests()) > 0 {
+			instance = &filteredProcessor{Processor: instance, interests: f.Interests()}
+		}
+		if s, ok := r.scopes[r.order[i]]; ok {
+			instance = &scopedProcessor{Processor: instance, scope: s}
+		}
+		instance.SetNext(next)
+		next = instance
+	}
+	r.root.SetNext(next)
+}
+
 func (r *Manager) AddEventSender(sender EventSender) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if r.head == nil {
-		return
+	sender.SetEventListener(r.root)
+}
+
+// AddRESTServer starts the REST server with the routes provided by the applications.
+// The routes of the disabled applications respond with 404 Not Found.
+func (r *Manager) AddRESTServer(server RESTServer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	routes := []*rest.Route{}
+	for name, v := range r.apps {
+		handler, ok := v.instance.(app.RESTHandler)
+		if !ok {
+			continue
+		}
+		for _, route := range handler.Routes() {
+			routes = append(routes, r.guardRoute(name, route))
+		}
 	}
-	sender.SetEventListener(r.head)
+	routes = append(routes,
+		rest.Get("/api/v1/app", r.listApp),
+		rest.Put("/api/v1/app/:name", r.toggleApp),
+		rest.Options("/api/v1/app/:name", allowOrigin),
+		rest.Post("/api/v1/config/reload", r.reloadConfig),
+	)
+	server.ServeREST(routes...)
+}
+
+// AddHealthServer adds the health check of the enabled applications to server.
+func (r *Manager) AddHealthServer(server HealthServer) {
+	server.AddHealthCheck(r.health)
+}
+
+func (r *Manager) health() map[string]error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result := make(map[string]error)
+	for _, v := range r.apps {
+		if !v.enabled {
+			continue
+		}
+		var err error
+		if checker, ok := v.instance.(app.HealthChecker); ok {
+			err = checker.Health()
+		}
+		result["app/"+strings.ToLower(v.instance.Name())] = err
+	}
+
+	return result
+}
+
+func (r *Manager) guardRoute(name string, route *rest.Route) *rest.Route {
+	f := route.Func
+	route.Func = func(w rest.ResponseWriter, req *rest.Request) {
+		r.mutex.Lock()
+		enabled := r.apps[name].enabled
+		r.mutex.Unlock()
+
+		if !enabled {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			writeError(w, http.StatusNotFound, fmt.Errorf("%v application is disabled", r.apps[name].instance.Name()))
+			return
+		}
+		f(w, req)
+	}
+
+	return route
+}
+
+type appStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Position in the processor chain that starts from 1. Zero if the application is disabled.
+	Order  int    `json:"order"`
+	Status string `json:"status"`
+}
+
+func (r *Manager) listApp(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	order := make(map[string]int)
+	for i, app := 1, r.first(); app != nil; i++ {
+		order[strings.ToUpper(app.Name())] = i
+		next, ok := app.Next()
+		if !ok {
+			break
+		}
+		app = next
+	}
+
+	apps := []appStatus{}
+	for k, v := range r.apps {
+		s := appStatus{Name: v.instance.Name(), Enabled: v.enabled, Order: order[k]}
+		if v.enabled {
+			s.Status = v.instance.String()
+		}
+		apps = append(apps, s)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Enabled != apps[j].Enabled {
+			return apps[i].Enabled
+		}
+		if apps[i].Enabled {
+			return apps[i].Order < apps[j].Order
+		}
+		return apps[i].Name < apps[j].Name
+	})
+
+	w.WriteJson(&struct {
+		Apps []appStatus `json:"apps"`
+	}{apps})
 }
 
 func (r *Manager) String() string {
@@ -146,7 +591,7 @@ func (r *Manager) String() string {
 	defer r.mutex.Unlock()
 
 	var buf bytes.Buffer
-	app := r.head
+	app := r.first()
 	for app != nil {
 		buf.WriteString(fmt.Sprintf("%v\n", app))
 		next, ok := app.Next()
@@ -158,3 +603,72 @@ func (r *Manager) String() string {
 
 	return buf.String()
 }
+
+// first returns the first application in the processor chain, or nil if there is no enabled application.
+func (r *Manager) first() app.Processor {
+	v, ok := r.root.Next()
+	if !ok {
+		return nil
+	}
+
+	return v
+}
+
+func (r *Manager) toggleApp(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p := struct {
+		Enabled bool `json:"enabled"`
+	}{}
+	if err := req.DecodeJsonPayload(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := req.PathParam("name")
+	var err error
+	if p.Enabled {
+		err = r.Enable(name)
+	} else {
+		err = r.Disable(name)
+	}
+	if err != nil {
+		logger.Errorf("failed to toggle %v application: %v", name, err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	logger.Infof("%v application has been toggled: enabled=%v", name, p.Enabled)
+
+	w.WriteJson(&struct{}{})
+}
+
+func (r *Manager) reloadConfig(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	r.mutex.Lock()
+	reloader := r.reloader
+	r.mutex.Unlock()
+
+	if reloader == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("reloading is not supported"))
+		return
+	}
+	if err := reloader(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteJson(&struct{}{})
+}
+
+func allowOrigin(w rest.ResponseWriter, req *rest.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PUT")
+}
+
+func writeError(w rest.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.WriteJson(&struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,80 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"plugin"
+	"sync"
+
+	"github.com/superkkt/cherry/database"
+	"github.com/superkkt/cherry/northbound/app"
+
+	"github.com/pkg/errors"
+)
+
+// Factory creates an application that uses db, which is nil if the
+// application is only checked by cherry -check-config, and reads its settings
+// from conf.
+type Factory func(db database.Database, conf app.Config) app.Processor
+
+type factory struct {
+	section string
+	create  Factory
+}
+
+var (
+	factoryMutex sync.Mutex
+	factories    []factory
+)
+
+// Register adds the application created by f to the managers created after
+// that. The site-specific applications call it in their init functions, so
+// that they are linked with the controller by a blank import, or are loaded
+// from the Go plugins by LoadPlugins, without changing the built-in ones.
+// section is the name of the section of the config file for the application.
+func Register(section string, f Factory) {
+	factoryMutex.Lock()
+	defer factoryMutex.Unlock()
+
+	factories = append(factories, factory{section: section, create: f})
+}
+
+func registered() []factory {
+	factoryMutex.Lock()
+	defer factoryMutex.Unlock()
+
+	return factories
+}
+
+// LoadPlugins opens the Go plugins (go build -buildmode=plugin), whose init
+// functions call Register. The plugins should be built with the same version
+// of the controller source and the Go toolchain.
+func LoadPlugins(paths []string) error {
+	for _, v := range paths {
+		if _, err := plugin.Open(v); err != nil {
+			return errors.Wrap(err, "loading the plugin "+v)
+		}
+		logger.Infof("loaded the plugin %v", v)
+	}
+
+	return nil
+}
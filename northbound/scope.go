@@ -0,0 +1,189 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/protocol"
+)
+
+// scope is the set of the device IDs processed by an application.
+type scope map[string]bool
+
+// covers returns whether all the devices in s are in r. Nil means all the devices.
+func (r scope) covers(s scope) bool {
+	if r == nil {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	for k := range s {
+		if !r[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseScopes parses the scopes of the applications, whose keys are the
+// application names and values are the DPIDs separated by comma.
+func ParseScopes(v map[string]string) (map[string][]uint64, error) {
+	result := make(map[string][]uint64)
+	for name, dpids := range v {
+		for _, s := range strings.Split(strings.Replace(dpids, " ", "", -1), ",") {
+			dpid, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DPID of %v application: %v", name, s)
+			}
+			result[name] = append(result[name], dpid)
+		}
+	}
+
+	return result, nil
+}
+
+// SetScopes restricts the applications in scopes to the events of the devices
+// whose DPIDs are in them. The events of the other devices bypass them. The
+// other applications process all the devices. A dependency of an application
+// should process all the devices of the application.
+func (r *Manager) SetScopes(scopes map[string][]uint64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result := make(map[string]scope)
+	for name, dpids := range scopes {
+		key := strings.ToUpper(name)
+		if _, ok := r.apps[key]; !ok {
+			return fmt.Errorf("unknown application: %v", name)
+		}
+		s := make(scope)
+		for _, v := range dpids {
+			// Device ID is its DPID in decimal.
+			s[strconv.FormatUint(v, 10)] = true
+		}
+		result[key] = s
+	}
+	for key, v := range r.apps {
+		for _, d := range v.instance.Dependencies() {
+			if !result[strings.ToUpper(d)].covers(result[key]) {
+				return fmt.Errorf("%v application should process all the switches of %v application", d, v.instance.Name())
+			}
+		}
+	}
+	r.scopes = result
+	r.relink()
+
+	return nil
+}
+
+// scopedProcessor passes the events of the devices out of its scope to the
+// next application without the application.
+type scopedProcessor struct {
+	app.Processor
+	scope scope
+
+	mutex sync.RWMutex
+	next  app.Processor
+}
+
+func (r *scopedProcessor) SetNext(next app.Processor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.next = next
+	r.Processor.SetNext(next)
+}
+
+func (r *scopedProcessor) Next() (next app.Processor, ok bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.next, r.next != nil
+}
+
+func (r *scopedProcessor) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	if r.scope[ingress.Device().ID()] {
+		return r.Processor.OnPacketIn(finder, ingress, eth)
+	}
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+
+	return next.OnPacketIn(finder, ingress, eth)
+}
+
+func (r *scopedProcessor) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	if r.scope[device.ID()] {
+		return r.Processor.OnDeviceUp(finder, device)
+	}
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+
+	return next.OnDeviceUp(finder, device)
+}
+
+func (r *scopedProcessor) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	if r.scope[device.ID()] {
+		return r.Processor.OnDeviceDown(finder, device)
+	}
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+
+	return next.OnDeviceDown(finder, device)
+}
+
+func (r *scopedProcessor) OnPortUp(finder network.Finder, port *network.Port) error {
+	if r.scope[port.Device().ID()] {
+		return r.Processor.OnPortUp(finder, port)
+	}
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+
+	return next.OnPortUp(finder, port)
+}
+
+func (r *scopedProcessor) OnPortDown(finder network.Finder, port *network.Port) error {
+	if r.scope[port.Device().ID()] {
+		return r.Processor.OnPortDown(finder, port)
+	}
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+
+	return next.OnPortDown(finder, port)
+}
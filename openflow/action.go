@@ -29,6 +29,8 @@ import (
 )
 
 type Action interface {
+	// DecrementTTL returns whether the IP TTL will be decremented.
+	DecrementTTL() bool
 	DstMAC() (ok bool, mac net.HardwareAddr)
 	encoding.BinaryMarshaler
 	encoding.BinaryUnmarshaler
@@ -36,6 +38,8 @@ type Action interface {
 	// Error() returns last error message
 	Error() error
 	OutPort() OutPort
+	// SetDecrementTTL makes the action decrement the IP TTL. Note that OpenFlow 1.0 does not support it, so the action fails to be marshaled.
+	SetDecrementTTL()
 	SetDstMAC(mac net.HardwareAddr)
 	SetQueue(queue uint32)
 	SetOutPort(port OutPort)
@@ -52,6 +56,7 @@ type BaseAction struct {
 	dstMAC *net.HardwareAddr
 	queue  int64
 	vlanID int32
+	decTTL bool
 }
 
 func NewBaseAction() *BaseAction {
@@ -93,6 +98,14 @@ func (r *BaseAction) OutPort() OutPort {
 	return r.output
 }
 
+func (r *BaseAction) SetDecrementTTL() {
+	r.decTTL = true
+}
+
+func (r *BaseAction) DecrementTTL() bool {
+	return r.decTTL
+}
+
 func (r *BaseAction) SetSrcMAC(mac net.HardwareAddr) {
 	if mac == nil || len(mac) < 6 {
 		r.err = errors.Wrap(ErrInvalidMACAddress, "SetSrcMAC")
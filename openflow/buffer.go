@@ -0,0 +1,57 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package openflow
+
+import (
+	"sync"
+)
+
+// Most of the messages, including the PACKET_OUTs of the full-sized frames,
+// fit in a pooled buffer. The larger ones are allocated as usual.
+const pooledBufferSize = 2048
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		v := make([]byte, pooledBufferSize)
+		return &v
+	},
+}
+
+// NewBuffer returns a byte slice whose length is n, which is taken from the
+// pool if possible. The returned slice is not zeroed.
+func NewBuffer(n int) []byte {
+	if n > pooledBufferSize {
+		return make([]byte, n)
+	}
+
+	return (*bufferPool.Get().(*[]byte))[:n]
+}
+
+// ReleaseBuffer puts b returned by NewBuffer back into the pool. b should not
+// be used after it is released.
+func ReleaseBuffer(b []byte) {
+	if cap(b) != pooledBufferSize {
+		return
+	}
+	b = b[:pooledBufferSize]
+	bufferPool.Put(&b)
+}
@@ -0,0 +1,228 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package capture records the raw OpenFlow byte streams of the device
+// connections, and exports them as pcap files in which each message is carried
+// by a TCP segment of the connection, so that they are decoded by the OpenFlow
+// dissector of Wireshark.
+package capture
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Largest payload of a synthesized TCP segment, which fits the IP packet.
+const maxSegment = 65000
+
+type direction uint8
+
+const (
+	received direction = iota
+	sent
+)
+
+type record struct {
+	time time.Time
+	conn *Conn
+	dir  direction
+	seq  uint32
+	ack  uint32
+	data []byte
+}
+
+// Ring keeps the most recent records of the connections whose total size is
+// limited. It is safe for concurrent use.
+type Ring struct {
+	mutex  sync.Mutex
+	size   int
+	length int
+	// Circular buffer of the records, which grows when it is full. The oldest
+	// record is at head, and count records follow it.
+	records []record
+	head    int
+	count   int
+}
+
+// NewRing returns a ring that keeps up to size bytes of the streams.
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		panic("non-positive ring size")
+	}
+
+	return &Ring{size: size}
+}
+
+// Size returns the maximum number of bytes kept in the ring.
+func (r *Ring) Size() int {
+	return r.size
+}
+
+// Len returns the number of bytes kept in the ring.
+func (r *Ring) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.length
+}
+
+func (r *Ring) add(v ...record) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, rec := range v {
+		if r.count == len(r.records) {
+			r.grow()
+		}
+		r.records[(r.head+r.count)%len(r.records)] = rec
+		r.count++
+		r.length += len(rec.data)
+	}
+	// Drop the oldest records.
+	for r.length > r.size && r.count > 0 {
+		r.length -= len(r.records[r.head].data)
+		// Release the data.
+		r.records[r.head] = record{}
+		r.head = (r.head + 1) % len(r.records)
+		r.count--
+	}
+}
+
+// XXX: Caller should lock the mutex before they call this function
+func (r *Ring) grow() {
+	n := 2 * len(r.records)
+	if n == 0 {
+		n = 16
+	}
+	v := make([]record, n)
+	r.copyTo(v)
+	r.records = v
+	r.head = 0
+}
+
+// XXX: Caller should lock the mutex before they call this function
+func (r *Ring) copyTo(v []record) {
+	for i := 0; i < r.count; i++ {
+		v[i] = r.records[(r.head+i)%len(r.records)]
+	}
+}
+
+func (r *Ring) snapshot() []record {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v := make([]record, r.count)
+	r.copyTo(v)
+
+	return v
+}
+
+// Conn records the stream of a connection to a ring. It implements the Capture
+// interface of the transceiver.
+type Conn struct {
+	local  *net.TCPAddr
+	remote *net.TCPAddr
+
+	mutex sync.Mutex
+	ring  *Ring
+	// Next sequence numbers of the local and remote endpoints.
+	localSeq  uint32
+	remoteSeq uint32
+}
+
+// NewConn returns the recorder of the connection between local and remote,
+// which records to ring. The addresses that are not TCP, e.g., of the pipes in
+// the tests, are replaced with the loopback address.
+func NewConn(local, remote net.Addr, ring *Ring) *Conn {
+	return &Conn{
+		local:  tcpAddr(local),
+		remote: tcpAddr(remote),
+		ring:   ring,
+		// Arbitrary initial sequence numbers.
+		localSeq:  1,
+		remoteSeq: 1,
+	}
+}
+
+func tcpAddr(addr net.Addr) *net.TCPAddr {
+	if v, ok := addr.(*net.TCPAddr); ok {
+		return v
+	}
+
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+// Attach moves the records of c to ring, and then makes c record to ring. A
+// nil ring drops the records and stops recording.
+func (r *Conn) Attach(ring *Ring) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if ring != nil && r.ring != nil && ring != r.ring {
+		ring.add(r.ring.snapshot()...)
+	}
+	r.ring = ring
+}
+
+// Received records p read from the remote endpoint.
+func (r *Conn) Received(p []byte) {
+	r.record(received, p)
+}
+
+// Sent records p written to the remote endpoint.
+func (r *Conn) Sent(p []byte) {
+	r.record(sent, p)
+}
+
+func (r *Conn) record(dir direction, p []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.ring == nil {
+		return
+	}
+
+	now := time.Now()
+	records := make([]record, 0, len(p)/maxSegment+1)
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxSegment {
+			n = maxSegment
+		}
+		v := record{
+			time: now,
+			conn: r,
+			dir:  dir,
+			data: append([]byte(nil), p[:n]...),
+		}
+		if dir == sent {
+			v.seq, v.ack = r.localSeq, r.remoteSeq
+			r.localSeq += uint32(n)
+		} else {
+			v.seq, v.ack = r.remoteSeq, r.localSeq
+			r.remoteSeq += uint32(n)
+		}
+		records = append(records, v)
+		p = p[n:]
+	}
+	r.ring.add(records...)
+}
@@ -0,0 +1,117 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	local := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6653}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 40000}
+	pending := NewRing(1024)
+	c := NewConn(local, remote, pending)
+	c.Received([]byte{4, 0, 0, 8, 0, 0, 0, 1})
+	c.Sent([]byte{4, 0, 0, 8, 0, 0, 0, 2})
+
+	// The records of the handshake move to the ring of the device.
+	ring := NewRing(24)
+	c.Attach(ring)
+	c.Sent(bytes.Repeat([]byte{0xFF}, 16))
+	if n := ring.Len(); n != 24 {
+		t.Fatalf("expected 24 bytes in the ring, got %v", n)
+	}
+	// The oldest record has been dropped.
+	records := ring.snapshot()
+	if len(records) != 2 || records[0].dir != sent {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	// Sequence numbers of the local endpoint.
+	if records[0].seq != 1 || records[1].seq != 9 || records[1].ack != 9 {
+		t.Fatalf("unexpected sequence numbers: %v/%v, %v/%v", records[0].seq, records[0].ack, records[1].seq, records[1].ack)
+	}
+
+	c.Attach(nil)
+	c.Sent([]byte{1})
+	if n := ring.Len(); n != 24 {
+		t.Fatalf("detached connection is still recorded: %v bytes in the ring", n)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := ring.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("expected %v bytes written, got %v", buf.Len(), n)
+	}
+	// Global header, and then the record header and the IPv4 and TCP headers of each packet.
+	if expected := 24 + 2*(16+40) + 24; buf.Len() != expected {
+		t.Fatalf("expected %v bytes of pcap, got %v", expected, buf.Len())
+	}
+	p := buf.Bytes()
+	if binary.LittleEndian.Uint32(p[0:4]) != 0xa1b2c3d4 || binary.LittleEndian.Uint32(p[20:24]) != linkTypeRaw {
+		t.Fatalf("invalid pcap header: %x", p[:24])
+	}
+	packet := p[24+16 : 24+16+48]
+	// Sent from the local endpoint.
+	if !net.IP(packet[12:16]).Equal(local.IP) || binary.BigEndian.Uint16(packet[20:22]) != 6653 {
+		t.Fatalf("unexpected source: %v:%v", net.IP(packet[12:16]), binary.BigEndian.Uint16(packet[20:22]))
+	}
+	sum := uint32(0)
+	for i := 0; i < ipv4Header; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(packet[i : i+2]))
+	}
+	for sum > 0xFFFF {
+		sum = sum>>16 + sum&0xFFFF
+	}
+	if sum != 0xFFFF {
+		t.Fatalf("invalid IPv4 checksum: %x", sum)
+	}
+}
+
+func TestRingWrapAround(t *testing.T) {
+	ring := NewRing(100)
+	c := NewConn(nil, nil, ring)
+	for i := 0; i < 1000; i++ {
+		c.Sent([]byte{byte(i), 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	}
+	if n := ring.Len(); n != 100 {
+		t.Fatalf("expected 100 bytes in the ring, got %v", n)
+	}
+	// The buffer should not grow beyond the records kept in the ring.
+	if n := len(ring.records); n != 16 {
+		t.Fatalf("unexpected capacity of the ring: %v", n)
+	}
+	records := ring.snapshot()
+	if len(records) != 10 {
+		t.Fatalf("unexpected number of the records: %v", len(records))
+	}
+	for i, v := range records {
+		if v.data[0] != byte(990+i) || v.seq != uint32(1+(990+i)*10) {
+			t.Fatalf("unexpected record %v: data=%v, seq=%v", i, v.data[0], v.seq)
+		}
+	}
+}
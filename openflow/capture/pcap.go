@@ -0,0 +1,146 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+)
+
+const (
+	// LINKTYPE_RAW: the packets begin with the IPv4 or IPv6 header.
+	linkTypeRaw = 101
+	snapLength  = 0xFFFF
+	tcpHeader   = 20
+	ipv4Header  = 20
+	ipv6Header  = 40
+	// TCP_PSH and TCP_ACK.
+	tcpFlags = 0x18
+)
+
+// WriteTo writes the records in the ring to w in the pcap format.
+func (r *Ring) WriteTo(w io.Writer) (n int64, err error) {
+	c := &countWriter{w: w}
+	buf := bufio.NewWriter(c)
+
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], snapLength)
+	binary.LittleEndian.PutUint32(header[20:24], linkTypeRaw)
+	if _, err := buf.Write(header); err != nil {
+		return c.n, err
+	}
+
+	for _, v := range r.snapshot() {
+		packet := v.packet()
+		header := make([]byte, 16)
+		binary.LittleEndian.PutUint32(header[0:4], uint32(v.time.Unix()))
+		binary.LittleEndian.PutUint32(header[4:8], uint32(v.time.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(header[8:12], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(header[12:16], uint32(len(packet)))
+		if _, err := buf.Write(header); err != nil {
+			return c.n, err
+		}
+		if _, err := buf.Write(packet); err != nil {
+			return c.n, err
+		}
+	}
+	err = buf.Flush()
+
+	return c.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (r *countWriter) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	r.n += int64(n)
+
+	return n, err
+}
+
+// packet returns the IP packet whose TCP segment carries the data of the record.
+func (r record) packet() []byte {
+	src, dst := r.conn.remote, r.conn.local
+	if r.dir == sent {
+		src, dst = dst, src
+	}
+
+	tcp := make([]byte, tcpHeader, tcpHeader+len(r.data))
+	binary.BigEndian.PutUint16(tcp[0:2], uint16(src.Port))
+	binary.BigEndian.PutUint16(tcp[2:4], uint16(dst.Port))
+	binary.BigEndian.PutUint32(tcp[4:8], r.seq)
+	binary.BigEndian.PutUint32(tcp[8:12], r.ack)
+	tcp[12] = (tcpHeader / 4) << 4
+	tcp[13] = tcpFlags
+	binary.BigEndian.PutUint16(tcp[14:16], 0xFFFF) // Window
+	// Zero checksum, which is not validated by Wireshark by default.
+	tcp = append(tcp, r.data...)
+
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		return append(ipv4(srcIP, dstIP, len(tcp)), tcp...)
+	}
+
+	return append(ipv6(src.IP.To16(), dst.IP.To16(), len(tcp)), tcp...)
+}
+
+func ipv4(src, dst net.IP, length int) []byte {
+	v := make([]byte, ipv4Header, ipv4Header+length)
+	v[0] = 0x45 // Version 4 without options.
+	binary.BigEndian.PutUint16(v[2:4], uint16(ipv4Header+length))
+	v[6] = 0x40 // Don't fragment.
+	v[8] = 64   // TTL
+	v[9] = 6    // TCP
+	copy(v[12:16], src)
+	copy(v[16:20], dst)
+
+	sum := uint32(0)
+	for i := 0; i < ipv4Header; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(v[i : i+2]))
+	}
+	for sum > 0xFFFF {
+		sum = sum>>16 + sum&0xFFFF
+	}
+	binary.BigEndian.PutUint16(v[10:12], ^uint16(sum))
+
+	return v
+}
+
+func ipv6(src, dst net.IP, length int) []byte {
+	v := make([]byte, ipv6Header, ipv6Header+length)
+	v[0] = 0x60
+	binary.BigEndian.PutUint16(v[4:6], uint16(length))
+	v[6] = 6  // TCP
+	v[7] = 64 // Hop limit
+	copy(v[8:24], src)
+	copy(v[24:40], dst)
+
+	return v
+}
@@ -0,0 +1,218 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package emulator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of10"
+)
+
+type of10Protocol struct {
+	match []byte
+}
+
+func (r *of10Protocol) version() uint8 {
+	return openflow.OF10_VERSION
+}
+
+func (r *of10Protocol) wildcard() []byte {
+	return r.match
+}
+
+func (r *of10Protocol) featuresReply(dpid uint64, ports uint32) []byte {
+	v := make([]byte, 24)
+	binary.BigEndian.PutUint64(v[0:8], dpid)
+	// No buffers.
+	binary.BigEndian.PutUint32(v[8:12], 0)
+	// Number of tables.
+	v[12] = 1
+	// OFPC_FLOW_STATS and OFPC_PORT_STATS.
+	binary.BigEndian.PutUint32(v[16:20], 1<<0|1<<2)
+	// All the actions from OFPAT_OUTPUT to OFPAT_SET_TP_DST.
+	binary.BigEndian.PutUint32(v[20:24], 1<<11-1)
+	for i := uint32(1); i <= ports; i++ {
+		v = append(v, r.port(dpid, i)...)
+	}
+
+	return v
+}
+
+// port returns the encoded ofp_phy_port structure of the port whose link is up.
+func (r *of10Protocol) port(dpid uint64, port uint32) []byte {
+	v := make([]byte, 48)
+	binary.BigEndian.PutUint16(v[0:2], uint16(port))
+	copy(v[2:8], portMAC(dpid, port))
+	copy(v[8:23], portName(port))
+	// OFPPF_1GB_FD and OFPPF_COPPER.
+	features := uint32(1<<5 | 1<<7)
+	binary.BigEndian.PutUint32(v[32:36], features)
+	binary.BigEndian.PutUint32(v[36:40], features)
+	binary.BigEndian.PutUint32(v[40:44], features)
+
+	return v
+}
+
+func (r *of10Protocol) request(s *Switch, msg *openflow.Message) error {
+	switch msg.Type() {
+	case of10.OFPT_BARRIER_REQUEST:
+		return s.send(of10.OFPT_BARRIER_REPLY, msg.TransactionID(), nil)
+	case of10.OFPT_STATS_REQUEST:
+		return r.stats(s, msg)
+	default:
+		return nil
+	}
+}
+
+func (r *of10Protocol) stats(s *Switch, msg *openflow.Message) error {
+	payload := msg.Payload()
+	if len(payload) < 4 {
+		return errors.New("invalid STATS_REQUEST length")
+	}
+	t := binary.BigEndian.Uint16(payload[0:2])
+
+	// The reply header has the same type without any flag.
+	reply := make([]byte, 4)
+	binary.BigEndian.PutUint16(reply[0:2], t)
+	switch t {
+	case of10.OFPST_DESC:
+		reply = append(reply, description()...)
+	case of10.OFPST_FLOW:
+		// All the flows regardless of the request.
+		reply = append(reply, r.flowStats(s.Flows())...)
+	case of10.OFPST_PORT:
+		// All the ports regardless of the request.
+		reply = append(reply, r.portStats(s.portCounters())...)
+	default:
+		// Empty statistics.
+	}
+	if err := s.send(of10.OFPT_STATS_REPLY, msg.TransactionID(), reply); err != nil {
+		return err
+	}
+	if t == of10.OFPST_DESC {
+		s.setDescribed()
+	}
+
+	return nil
+}
+
+func (r *of10Protocol) flowMod(payload []byte) (flowCommand, error) {
+	if len(payload) < 64 {
+		return flowCommand{}, errors.New("invalid FLOW_MOD length")
+	}
+
+	// OpenFlow 1.0 has a single table, and does not match the cookies on
+	// deleting the flows.
+	return flowCommand{
+		command: uint8(binary.BigEndian.Uint16(payload[48:50])),
+		flow: Flow{
+			Priority:     binary.BigEndian.Uint16(payload[54:56]),
+			Cookie:       binary.BigEndian.Uint64(payload[40:48]),
+			IdleTimeout:  binary.BigEndian.Uint16(payload[50:52]),
+			HardTimeout:  binary.BigEndian.Uint16(payload[52:54]),
+			Match:        append([]byte(nil), payload[0:40]...),
+			Instructions: append([]byte(nil), payload[64:]...),
+		},
+	}, nil
+}
+
+func (r *of10Protocol) flowStats(flows []Flow) []byte {
+	result := []byte{}
+	for _, f := range flows {
+		v := make([]byte, 88)
+		binary.BigEndian.PutUint16(v[0:2], uint16(88+len(f.Instructions)))
+		copy(v[4:44], f.Match)
+		binary.BigEndian.PutUint32(v[44:48], uint32(time.Since(f.Added)/time.Second))
+		binary.BigEndian.PutUint16(v[52:54], f.Priority)
+		binary.BigEndian.PutUint16(v[54:56], f.IdleTimeout)
+		binary.BigEndian.PutUint16(v[56:58], f.HardTimeout)
+		binary.BigEndian.PutUint64(v[64:72], f.Cookie)
+		// No packet and byte counts.
+		result = append(result, append(v, f.Instructions...)...)
+	}
+
+	return result
+}
+
+func (r *of10Protocol) portStats(counters []portCounters) []byte {
+	result := []byte{}
+	for i := 1; i < len(counters); i++ {
+		v := make([]byte, 104)
+		binary.BigEndian.PutUint16(v[0:2], uint16(i))
+		binary.BigEndian.PutUint64(v[8:16], counters[i].rxPackets)
+		binary.BigEndian.PutUint64(v[16:24], counters[i].txPackets)
+		binary.BigEndian.PutUint64(v[24:32], counters[i].rxBytes)
+		binary.BigEndian.PutUint64(v[32:40], counters[i].txBytes)
+		// No drops and errors.
+		result = append(result, v...)
+	}
+
+	return result
+}
+
+func (r *of10Protocol) packetOut(payload []byte, ports uint32) (PacketOut, error) {
+	if len(payload) < 8 {
+		return PacketOut{}, errors.New("invalid PACKET_OUT length")
+	}
+	inPort := uint32(binary.BigEndian.Uint16(payload[4:6]))
+	length := int(binary.BigEndian.Uint16(payload[6:8]))
+	if len(payload) < 8+length {
+		return PacketOut{}, fmt.Errorf("invalid PACKET_OUT actions length: %v", length)
+	}
+
+	result := PacketOut{
+		InPort: inPort,
+		Data:   append([]byte(nil), payload[8+length:]...),
+	}
+	actions := payload[8 : 8+length]
+	for len(actions) > 0 {
+		if len(actions) < 8 {
+			return PacketOut{}, errors.New("too short action")
+		}
+		t := binary.BigEndian.Uint16(actions[0:2])
+		n := int(binary.BigEndian.Uint16(actions[2:4]))
+		if n < 8 || len(actions) < n {
+			return PacketOut{}, fmt.Errorf("invalid action length: %v", n)
+		}
+		if t == of10.OFPAT_OUTPUT {
+			port := uint32(binary.BigEndian.Uint16(actions[4:6]))
+			result.OutPorts = append(result.OutPorts, expand(port, of10.OFPP_FLOOD, of10.OFPP_ALL, inPort, ports)...)
+		}
+		actions = actions[n:]
+	}
+
+	return result, nil
+}
+
+func (r *of10Protocol) packetIn(port uint32, data []byte) []byte {
+	v := make([]byte, 10)
+	binary.BigEndian.PutUint32(v[0:4], of10.OFP_NO_BUFFER)
+	binary.BigEndian.PutUint16(v[4:6], uint16(len(data)))
+	binary.BigEndian.PutUint16(v[6:8], uint16(port))
+	// OFPR_NO_MATCH.
+
+	return append(v, data...)
+}
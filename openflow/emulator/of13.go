@@ -0,0 +1,242 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package emulator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+type of13Protocol struct {
+	match []byte
+}
+
+func (r *of13Protocol) version() uint8 {
+	return openflow.OF13_VERSION
+}
+
+func (r *of13Protocol) wildcard() []byte {
+	return r.match
+}
+
+func (r *of13Protocol) featuresReply(dpid uint64, ports uint32) []byte {
+	v := make([]byte, 24)
+	binary.BigEndian.PutUint64(v[0:8], dpid)
+	// No buffers.
+	binary.BigEndian.PutUint32(v[8:12], 0)
+	// Number of tables.
+	v[12] = 254
+	// OFPC_FLOW_STATS and OFPC_PORT_STATS.
+	binary.BigEndian.PutUint32(v[16:20], 1<<0|1<<2)
+
+	return v
+}
+
+func (r *of13Protocol) request(s *Switch, msg *openflow.Message) error {
+	switch msg.Type() {
+	case of13.OFPT_BARRIER_REQUEST:
+		return s.send(of13.OFPT_BARRIER_REPLY, msg.TransactionID(), nil)
+	case of13.OFPT_ROLE_REQUEST:
+		// Accept any role requested.
+		return s.send(of13.OFPT_ROLE_REPLY, msg.TransactionID(), msg.Payload())
+	case of13.OFPT_MULTIPART_REQUEST:
+		return r.multipart(s, msg)
+	default:
+		return nil
+	}
+}
+
+func (r *of13Protocol) multipart(s *Switch, msg *openflow.Message) error {
+	payload := msg.Payload()
+	if len(payload) < 8 {
+		return errors.New("invalid MULTIPART_REQUEST length")
+	}
+	t := binary.BigEndian.Uint16(payload[0:2])
+
+	// The reply header has the same type without any flag.
+	reply := make([]byte, 8)
+	binary.BigEndian.PutUint16(reply[0:2], t)
+	switch t {
+	case of13.OFPMP_DESC:
+		reply = append(reply, description()...)
+	case of13.OFPMP_PORT_DESC:
+		for i := uint32(1); i <= s.config.Ports; i++ {
+			reply = append(reply, r.port(s.config.DPID, i)...)
+		}
+	case of13.OFPMP_FLOW:
+		// All the flows regardless of the request.
+		reply = append(reply, r.flowStats(s.Flows())...)
+	case of13.OFPMP_PORT_STATS:
+		// All the ports regardless of the request.
+		reply = append(reply, r.portStats(s.portCounters())...)
+	default:
+		// Empty statistics.
+	}
+	if err := s.send(of13.OFPT_MULTIPART_REPLY, msg.TransactionID(), reply); err != nil {
+		return err
+	}
+
+	switch t {
+	case of13.OFPMP_DESC:
+		s.setDescribed()
+	case of13.OFPMP_PORT_DESC:
+		s.setAnnounced()
+	}
+
+	return nil
+}
+
+// port returns the encoded ofp_port structure of the port whose link is up.
+func (r *of13Protocol) port(dpid uint64, port uint32) []byte {
+	v := make([]byte, 64)
+	binary.BigEndian.PutUint32(v[0:4], port)
+	copy(v[8:14], portMAC(dpid, port))
+	copy(v[16:31], portName(port))
+	binary.BigEndian.PutUint32(v[36:40], of13.OFPPS_LIVE)
+	// OFPPF_1GB_FD and OFPPF_COPPER.
+	features := uint32(1<<5 | 1<<11)
+	binary.BigEndian.PutUint32(v[40:44], features)
+	binary.BigEndian.PutUint32(v[44:48], features)
+	binary.BigEndian.PutUint32(v[48:52], features)
+	// Current and maximum speeds in kbps.
+	binary.BigEndian.PutUint32(v[56:60], 1000000)
+	binary.BigEndian.PutUint32(v[60:64], 1000000)
+
+	return v
+}
+
+func (r *of13Protocol) flowMod(payload []byte) (flowCommand, error) {
+	if len(payload) < 44 {
+		return flowCommand{}, errors.New("invalid FLOW_MOD length")
+	}
+	// The match is padded to be 64-bit aligned.
+	length := (int(binary.BigEndian.Uint16(payload[42:44])) + 7) / 8 * 8
+	if length < 8 || len(payload) < 40+length {
+		return flowCommand{}, fmt.Errorf("invalid FLOW_MOD match length: %v", length)
+	}
+
+	return flowCommand{
+		command:    payload[17],
+		cookieMask: binary.BigEndian.Uint64(payload[8:16]),
+		flow: Flow{
+			TableID:      payload[16],
+			Priority:     binary.BigEndian.Uint16(payload[22:24]),
+			Cookie:       binary.BigEndian.Uint64(payload[0:8]),
+			IdleTimeout:  binary.BigEndian.Uint16(payload[18:20]),
+			HardTimeout:  binary.BigEndian.Uint16(payload[20:22]),
+			Match:        append([]byte(nil), payload[40:40+length]...),
+			Instructions: append([]byte(nil), payload[40+length:]...),
+		},
+	}, nil
+}
+
+func (r *of13Protocol) flowStats(flows []Flow) []byte {
+	result := []byte{}
+	for _, f := range flows {
+		v := make([]byte, 48)
+		binary.BigEndian.PutUint16(v[0:2], uint16(48+len(f.Match)+len(f.Instructions)))
+		v[2] = f.TableID
+		binary.BigEndian.PutUint32(v[4:8], uint32(time.Since(f.Added)/time.Second))
+		binary.BigEndian.PutUint16(v[12:14], f.Priority)
+		binary.BigEndian.PutUint16(v[14:16], f.IdleTimeout)
+		binary.BigEndian.PutUint16(v[16:18], f.HardTimeout)
+		binary.BigEndian.PutUint64(v[24:32], f.Cookie)
+		// No packet and byte counts.
+		v = append(v, f.Match...)
+		result = append(result, append(v, f.Instructions...)...)
+	}
+
+	return result
+}
+
+func (r *of13Protocol) portStats(counters []portCounters) []byte {
+	result := []byte{}
+	for i := 1; i < len(counters); i++ {
+		v := make([]byte, 112)
+		binary.BigEndian.PutUint32(v[0:4], uint32(i))
+		binary.BigEndian.PutUint64(v[8:16], counters[i].rxPackets)
+		binary.BigEndian.PutUint64(v[16:24], counters[i].txPackets)
+		binary.BigEndian.PutUint64(v[24:32], counters[i].rxBytes)
+		binary.BigEndian.PutUint64(v[32:40], counters[i].txBytes)
+		// No drops and errors.
+		result = append(result, v...)
+	}
+
+	return result
+}
+
+func (r *of13Protocol) packetOut(payload []byte, ports uint32) (PacketOut, error) {
+	if len(payload) < 16 {
+		return PacketOut{}, errors.New("invalid PACKET_OUT length")
+	}
+	inPort := binary.BigEndian.Uint32(payload[4:8])
+	length := int(binary.BigEndian.Uint16(payload[8:10]))
+	if len(payload) < 16+length {
+		return PacketOut{}, fmt.Errorf("invalid PACKET_OUT actions length: %v", length)
+	}
+
+	result := PacketOut{
+		InPort: inPort,
+		Data:   append([]byte(nil), payload[16+length:]...),
+	}
+	actions := payload[16 : 16+length]
+	for len(actions) > 0 {
+		if len(actions) < 8 {
+			return PacketOut{}, errors.New("too short action")
+		}
+		t := binary.BigEndian.Uint16(actions[0:2])
+		n := int(binary.BigEndian.Uint16(actions[2:4]))
+		if n < 8 || len(actions) < n {
+			return PacketOut{}, fmt.Errorf("invalid action length: %v", n)
+		}
+		if t == of13.OFPAT_OUTPUT {
+			port := binary.BigEndian.Uint32(actions[4:8])
+			result.OutPorts = append(result.OutPorts, expand(port, of13.OFPP_FLOOD, of13.OFPP_ALL, inPort, ports)...)
+		}
+		actions = actions[n:]
+	}
+
+	return result, nil
+}
+
+func (r *of13Protocol) packetIn(port uint32, data []byte) []byte {
+	v := make([]byte, 16)
+	binary.BigEndian.PutUint32(v[0:4], of13.OFP_NO_BUFFER)
+	binary.BigEndian.PutUint16(v[4:6], uint16(len(data)))
+	// OFPR_NO_MATCH on table 0 without cookie.
+
+	match := []byte{
+		0x00, 0x01, 0x00, 0x0C, // OXM, length 12 without the padding
+		0x80, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, // in_port
+		0x00, 0x00, 0x00, 0x00, // padding
+	}
+	binary.BigEndian.PutUint32(match[8:12], port)
+	v = append(v, match...)
+	v = append(v, 0, 0) // padding
+
+	return append(v, data...)
+}
@@ -0,0 +1,598 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package emulator implements a software OpenFlow switch that speaks OpenFlow
+// 1.0 or 1.3 to the controller, so that the controller logic can be tested end
+// to end without Mininet or any hardware switch.
+//
+// The emulated switch answers the handshake and the queries of the controller,
+// keeps the flows installed by FLOW_MOD in its flow table, and records the
+// packets sent by PACKET_OUT. It never forwards the packets by itself: the
+// packets are injected into the controller as PACKET_IN by InjectPacketIn, or
+// by the PACKET_OUT to a port linked to another emulated switch by Link.
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of10"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+var (
+	ErrNotConnected = errors.New("not connected to the controller")
+)
+
+// Config is the configuration of an emulated switch.
+type Config struct {
+	DPID uint64
+	// Version is the OpenFlow version, which is either openflow.OF10_VERSION
+	// or openflow.OF13_VERSION.
+	Version uint8
+	// Ports is the number of the physical ports numbered from 1.
+	Ports uint32
+	// TLS makes Dial connect to the controller over TLS if it is not nil.
+	TLS *tls.Config
+	// MaxPacketOuts is the number of the PACKET_OUTs remembered by
+	// PacketOuts, e.g., for a long running emulation. The oldest ones are
+	// forgotten when exceeded. Zero means unlimited.
+	MaxPacketOuts int
+}
+
+// Flow is an entry of the flow table.
+type Flow struct {
+	TableID     uint8
+	Priority    uint16
+	Cookie      uint64
+	IdleTimeout uint16
+	HardTimeout uint16
+	// Match is the encoded ofp_match structure.
+	Match []byte
+	// Instructions is the encoded instructions for OpenFlow 1.3, or the
+	// encoded actions for OpenFlow 1.0.
+	Instructions []byte
+	// Added is when the flow was added, which gives the duration in the flow
+	// stats.
+	Added time.Time
+}
+
+// PacketOut is a packet sent by the controller using PACKET_OUT.
+type PacketOut struct {
+	InPort uint32
+	// OutPorts is the physical ports of the output actions. The flooding
+	// output is expanded into the ports except InPort.
+	OutPorts []uint32
+	Data     []byte
+}
+
+// portCounters count the packets sent out to a port by the PACKET_OUTs, and
+// the ones received from a port and sent to the controller.
+type portCounters struct {
+	rxPackets, txPackets uint64
+	rxBytes, txBytes     uint64
+}
+
+type flowCommand struct {
+	command    uint8
+	cookieMask uint64
+	flow       Flow
+}
+
+// protocol encodes and decodes the version specific messages.
+type protocol interface {
+	version() uint8
+	// wildcard returns the encoded match that matches all the packets.
+	wildcard() []byte
+	featuresReply(dpid uint64, ports uint32) []byte
+	// request answers the version specific requests, and ignores the unknown
+	// messages.
+	request(s *Switch, msg *openflow.Message) error
+	flowMod(payload []byte) (flowCommand, error)
+	// flowStats returns the encoded flow stats of flows.
+	flowStats(flows []Flow) []byte
+	// portStats returns the encoded port stats of the counters indexed by
+	// the port numbers.
+	portStats(counters []portCounters) []byte
+	packetOut(payload []byte, ports uint32) (PacketOut, error)
+	packetIn(port uint32, data []byte) []byte
+}
+
+type peer struct {
+	sw   *Switch
+	port uint32
+}
+
+// Switch is an emulated OpenFlow switch.
+type Switch struct {
+	config   Config
+	protocol protocol
+
+	mutex      sync.Mutex
+	conn       net.Conn
+	xid        uint32
+	flows      []Flow
+	packetOuts []PacketOut
+	peers      map[uint32]peer
+	// hosts receive the packets sent out to their ports.
+	hosts map[uint32]func(data []byte)
+	// counters are indexed by the port numbers.
+	counters []portCounters
+	// described and announced are true when the description and the ports
+	// of the switch have been replied, respectively.
+	described bool
+	announced bool
+	ready     chan struct{}
+}
+
+func New(c Config) (*Switch, error) {
+	if c.Ports == 0 {
+		return nil, errors.New("no ports")
+	}
+
+	var p protocol
+	switch c.Version {
+	case openflow.OF10_VERSION:
+		if c.Ports > of10.OFPP_MAX {
+			return nil, fmt.Errorf("too many ports: %v", c.Ports)
+		}
+		match, err := wildcardMatch(of10.NewFactory())
+		if err != nil {
+			return nil, err
+		}
+		p = &of10Protocol{match: match}
+	case openflow.OF13_VERSION:
+		if c.Ports > of13.OFPP_MAX {
+			return nil, fmt.Errorf("too many ports: %v", c.Ports)
+		}
+		match, err := wildcardMatch(of13.NewFactory())
+		if err != nil {
+			return nil, err
+		}
+		p = &of13Protocol{match: match}
+	default:
+		return nil, fmt.Errorf("unsupported OpenFlow version: %v", c.Version)
+	}
+
+	return &Switch{
+		config:   c,
+		protocol: p,
+		peers:    make(map[uint32]peer),
+		hosts:    make(map[uint32]func(data []byte)),
+		counters: make([]portCounters, c.Ports+1),
+		ready:    make(chan struct{}),
+	}, nil
+}
+
+func (r *Switch) DPID() uint64 {
+	return r.config.DPID
+}
+
+// Link connects port a of switch s to port b of switch t, so that the packet
+// sent out to one of them is received by the other as PACKET_IN.
+func Link(s *Switch, a uint32, t *Switch, b uint32) {
+	s.mutex.Lock()
+	s.peers[a] = peer{sw: t, port: b}
+	s.mutex.Unlock()
+
+	t.mutex.Lock()
+	t.peers[b] = peer{sw: s, port: a}
+	t.mutex.Unlock()
+}
+
+// Attach makes handler receive the packets sent out to port of the switch, e.g.,
+// to emulate a host connected to the port. handler is called by the goroutine
+// serving the controller, so it should not block.
+func (r *Switch) Attach(port uint32, handler func(data []byte)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.hosts[port] = handler
+}
+
+// Dial connects to the controller at addr, and then serves the connection
+// until ctx is canceled or the connection is closed.
+func (r *Switch) Dial(ctx context.Context, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if r.config.TLS != nil {
+		conn = tls.Client(conn, r.config.TLS)
+	}
+
+	return r.Serve(ctx, conn)
+}
+
+// Serve serves the controller connected to conn until ctx is canceled or the
+// connection is closed. conn is closed when Serve returns.
+func (r *Switch) Serve(ctx context.Context, conn net.Conn) error {
+	r.mutex.Lock()
+	if r.conn != nil {
+		r.mutex.Unlock()
+		return errors.New("already connected to the controller")
+	}
+	r.conn = conn
+	r.mutex.Unlock()
+
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		r.mutex.Lock()
+		r.conn = nil
+		r.mutex.Unlock()
+		conn.Close()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Closing the connection makes the read loop return.
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := r.send(of13.OFPT_HELLO, 0, nil); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := r.read(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := r.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Switch) read(conn net.Conn) (*openflow.Message, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header[2:4])
+	if length < 8 {
+		return nil, fmt.Errorf("invalid OpenFlow message length: %v", length)
+	}
+
+	packet := make([]byte, length)
+	copy(packet, header)
+	if _, err := io.ReadFull(conn, packet[8:]); err != nil {
+		return nil, err
+	}
+
+	msg := new(openflow.Message)
+	if err := msg.UnmarshalBinary(packet); err != nil {
+		return nil, err
+	}
+	if msg.Version() != r.protocol.version() {
+		return nil, fmt.Errorf("unexpected OpenFlow version: %v", msg.Version())
+	}
+
+	return msg, nil
+}
+
+// send writes the message whose type is t to the controller. A new
+// transaction ID is used if xid is zero.
+func (r *Switch) send(t uint8, xid uint32, payload []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.conn == nil {
+		return ErrNotConnected
+	}
+	if xid == 0 {
+		r.xid++
+		xid = r.xid
+	}
+	msg := openflow.NewMessage(r.protocol.version(), t, xid)
+	msg.SetPayload(payload)
+	packet, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.Write(packet)
+
+	return err
+}
+
+func (r *Switch) handle(msg *openflow.Message) error {
+	// The message types up to FLOW_MOD are common to OpenFlow 1.0 and 1.3.
+	switch msg.Type() {
+	case of13.OFPT_HELLO, of13.OFPT_ERROR, of13.OFPT_ECHO_REPLY, of13.OFPT_SET_CONFIG:
+		return nil
+	case of13.OFPT_ECHO_REQUEST:
+		return r.send(of13.OFPT_ECHO_REPLY, msg.TransactionID(), msg.Payload())
+	case of13.OFPT_FEATURES_REQUEST:
+		reply := r.protocol.featuresReply(r.config.DPID, r.config.Ports)
+		if err := r.send(of13.OFPT_FEATURES_REPLY, msg.TransactionID(), reply); err != nil {
+			return err
+		}
+		// OpenFlow 1.0 announces the ports in FEATURES_REPLY.
+		if r.protocol.version() == openflow.OF10_VERSION {
+			r.setAnnounced()
+		}
+		return nil
+	case of13.OFPT_GET_CONFIG_REQUEST:
+		// No special fragment handling, and 128 bytes of miss_send_len.
+		return r.send(of13.OFPT_GET_CONFIG_REPLY, msg.TransactionID(), []byte{0, 0, 0, 128})
+	case of13.OFPT_FLOW_MOD:
+		return r.handleFlowMod(msg.Payload())
+	case of13.OFPT_PACKET_OUT:
+		return r.handlePacketOut(msg.Payload())
+	}
+
+	return r.protocol.request(r, msg)
+}
+
+func (r *Switch) setDescribed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.described = true
+	r.checkReady()
+}
+
+func (r *Switch) setAnnounced() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.announced = true
+	r.checkReady()
+}
+
+// checkReady should be called with the lock held.
+func (r *Switch) checkReady() {
+	if !r.described || !r.announced {
+		return
+	}
+	select {
+	case <-r.ready:
+		// Already closed.
+	default:
+		close(r.ready)
+	}
+}
+
+// Ready returns a channel that is closed when the controller has learned the
+// description and the ports of the switch.
+func (r *Switch) Ready() <-chan struct{} {
+	return r.ready
+}
+
+func (r *Switch) handleFlowMod(payload []byte) error {
+	c, err := r.protocol.flowMod(payload)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch c.command {
+	case of13.OFPFC_ADD, of13.OFPFC_MODIFY, of13.OFPFC_MODIFY_STRICT:
+		c.flow.Added = time.Now()
+		for i, v := range r.flows {
+			if v.TableID == c.flow.TableID && v.Priority == c.flow.Priority && bytes.Equal(v.Match, c.flow.Match) {
+				r.flows[i] = c.flow
+				return nil
+			}
+		}
+		r.flows = append(r.flows, c.flow)
+	case of13.OFPFC_DELETE, of13.OFPFC_DELETE_STRICT:
+		strict := c.command == of13.OFPFC_DELETE_STRICT
+		flows := r.flows[:0]
+		for _, v := range r.flows {
+			if !r.deletes(c, strict, v) {
+				flows = append(flows, v)
+			}
+		}
+		r.flows = flows
+	default:
+		return fmt.Errorf("unknown FLOW_MOD command: %v", c.command)
+	}
+
+	return nil
+}
+
+// deletes returns whether the delete command c removes flow f. The matches are
+// compared as the encoded bytes, so a non-strict delete only removes the flows
+// whose match is exactly the same unless it is the wildcard.
+func (r *Switch) deletes(c flowCommand, strict bool, f Flow) bool {
+	if c.flow.TableID != 0xFF && c.flow.TableID != f.TableID {
+		return false
+	}
+	if c.flow.Cookie&c.cookieMask != f.Cookie&c.cookieMask {
+		return false
+	}
+	if strict {
+		return c.flow.Priority == f.Priority && bytes.Equal(c.flow.Match, f.Match)
+	}
+
+	return bytes.Equal(c.flow.Match, r.protocol.wildcard()) || bytes.Equal(c.flow.Match, f.Match)
+}
+
+func (r *Switch) handlePacketOut(payload []byte) error {
+	p, err := r.protocol.packetOut(payload, r.config.Ports)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.packetOuts = append(r.packetOuts, p)
+	// Trimmed once in a while rather than for every PACKET_OUT.
+	if max := r.config.MaxPacketOuts; max > 0 && len(r.packetOuts) >= 2*max {
+		r.packetOuts = append([]PacketOut(nil), r.packetOuts[len(r.packetOuts)-max:]...)
+	}
+	peers := []peer{}
+	hosts := []func(data []byte){}
+	for _, v := range p.OutPorts {
+		r.counters[v].txPackets++
+		r.counters[v].txBytes += uint64(len(p.Data))
+		if peer, ok := r.peers[v]; ok {
+			peers = append(peers, peer)
+		}
+		if h, ok := r.hosts[v]; ok {
+			hosts = append(hosts, h)
+		}
+	}
+	r.mutex.Unlock()
+
+	// The peers are called without the lock to avoid the deadlock between two
+	// linked switches sending the packets to each other.
+	for _, v := range peers {
+		if err := v.sw.InjectPacketIn(v.port, p.Data); err != nil && err != ErrNotConnected {
+			return err
+		}
+	}
+	for _, h := range hosts {
+		h(p.Data)
+	}
+
+	return nil
+}
+
+// InjectPacketIn sends data to the controller as PACKET_IN as if it was
+// received from port by the table-miss flow.
+func (r *Switch) InjectPacketIn(port uint32, data []byte) error {
+	if port == 0 || port > r.config.Ports {
+		return fmt.Errorf("invalid port number: %v", port)
+	}
+
+	r.mutex.Lock()
+	r.counters[port].rxPackets++
+	r.counters[port].rxBytes += uint64(len(data))
+	r.mutex.Unlock()
+
+	return r.send(of13.OFPT_PACKET_IN, 0, r.protocol.packetIn(port, data))
+}
+
+// Flows returns the flows installed by the controller.
+func (r *Switch) Flows() []Flow {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Flow(nil), r.flows...)
+}
+
+// SetFlows replaces the flow table of the switch, e.g., to emulate the flows
+// changed by others than the controller.
+func (r *Switch) SetFlows(flows []Flow) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.flows = append([]Flow(nil), flows...)
+}
+
+// portCounters returns a copy of the port counters.
+func (r *Switch) portCounters() []portCounters {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]portCounters(nil), r.counters...)
+}
+
+// PacketOuts returns the packets sent by the controller.
+func (r *Switch) PacketOuts() []PacketOut {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v := r.packetOuts
+	if max := r.config.MaxPacketOuts; max > 0 && len(v) > max {
+		v = v[len(v)-max:]
+	}
+
+	return append([]PacketOut(nil), v...)
+}
+
+// description returns the encoded ofp_desc structure, which is common to
+// OpenFlow 1.0 and 1.3.
+func description() []byte {
+	v := fixedString("Cherry", 256)
+	v = append(v, fixedString("Emulator", 256)...)
+	v = append(v, fixedString("Emulator", 256)...)
+	v = append(v, fixedString("None", 32)...)
+	v = append(v, fixedString("Emulated switch", 256)...)
+
+	return v
+}
+
+// wildcardMatch returns the encoded match of f that matches all the packets,
+// which is the same one used by the controller to remove all the flows.
+func wildcardMatch(f openflow.Factory) ([]byte, error) {
+	match, err := f.NewMatch()
+	if err != nil {
+		return nil, err
+	}
+
+	return match.MarshalBinary()
+}
+
+// portMAC returns the hardware address of port, which is derived from dpid.
+func portMAC(dpid uint64, port uint32) []byte {
+	return []byte{0x02, byte(dpid >> 16), byte(dpid >> 8), byte(dpid), byte(port >> 8), byte(port)}
+}
+
+func portName(port uint32) []byte {
+	return []byte(fmt.Sprintf("eth%v", port))
+}
+
+// fixedString returns s padded with the zeros into length bytes.
+func fixedString(s string, length int) []byte {
+	v := make([]byte, length)
+	copy(v[:length-1], s)
+
+	return v
+}
+
+// expand returns the physical ports of the output port, or nil for the others.
+func expand(port, flood, all, inPort, ports uint32) []uint32 {
+	if port != flood && port != all {
+		if port == 0 || port > ports {
+			return nil
+		}
+		return []uint32{port}
+	}
+
+	result := []uint32{}
+	for i := uint32(1); i <= ports; i++ {
+		if i != inPort {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
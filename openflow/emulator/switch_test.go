@@ -0,0 +1,208 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of10"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+// controller is the controller side of the connection to an emulated switch.
+type controller struct {
+	t       *testing.T
+	conn    net.Conn
+	f       openflow.Factory
+	barrier uint8 // Type of BARRIER_REPLY
+}
+
+func (r *controller) write(msg encoding.BinaryMarshaler) {
+	packet, err := msg.MarshalBinary()
+	if err != nil {
+		r.t.Fatalf("failed to marshal a message: %v", err)
+	}
+	if _, err := r.conn.Write(packet); err != nil {
+		r.t.Fatalf("failed to write a message: %v", err)
+	}
+}
+
+// read reads the next message whose type is t into v, skipping the others.
+func (r *controller) read(t uint8, v encoding.BinaryUnmarshaler) {
+	r.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r.conn, header); err != nil {
+			r.t.Fatalf("failed to read a message: %v", err)
+		}
+		packet := make([]byte, binary.BigEndian.Uint16(header[2:4]))
+		copy(packet, header)
+		if _, err := io.ReadFull(r.conn, packet[8:]); err != nil {
+			r.t.Fatalf("failed to read a message: %v", err)
+		}
+		if packet[1] != t {
+			continue
+		}
+		if err := v.UnmarshalBinary(packet); err != nil {
+			r.t.Fatalf("failed to unmarshal a message: %v", err)
+		}
+		return
+	}
+}
+
+// sync waits until the switch processes all the previous messages.
+func (r *controller) sync() {
+	req, _ := r.f.NewBarrierRequest()
+	r.write(req)
+	reply, _ := r.f.NewBarrierReply()
+	r.read(r.barrier, reply)
+}
+
+// connect starts sw connected to a new controller.
+func connect(t *testing.T, ctx context.Context, sw *Switch, f openflow.Factory, barrier uint8) *controller {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	go sw.Dial(ctx, l.Addr().String())
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+
+	return &controller{t: t, conn: conn, f: f, barrier: barrier}
+}
+
+func TestSwitch(t *testing.T) {
+	versions := []struct {
+		version uint8
+		factory func() openflow.Factory
+		barrier uint8
+	}{
+		{openflow.OF10_VERSION, of10.NewFactory, of10.OFPT_BARRIER_REPLY},
+		{openflow.OF13_VERSION, of13.NewFactory, of13.OFPT_BARRIER_REPLY},
+	}
+
+	for _, v := range versions {
+		ctx, cancel := context.WithCancel(context.Background())
+		testSwitch(t, ctx, v.version, v.factory(), v.barrier)
+		cancel()
+	}
+}
+
+func testSwitch(t *testing.T, ctx context.Context, version uint8, f openflow.Factory, barrier uint8) {
+	s1, err := New(Config{DPID: 1, Version: version, Ports: 4})
+	if err != nil {
+		t.Fatalf("failed to create a switch: %v", err)
+	}
+	s2, err := New(Config{DPID: 2, Version: version, Ports: 4})
+	if err != nil {
+		t.Fatalf("failed to create a switch: %v", err)
+	}
+	Link(s1, 2, s2, 3)
+	c1 := connect(t, ctx, s1, f, barrier)
+	c2 := connect(t, ctx, s2, f, barrier)
+
+	req, _ := f.NewFeaturesRequest()
+	c1.write(req)
+	// The types of FEATURES_REPLY and PACKET_IN are common to both versions.
+	features, _ := f.NewFeaturesReply()
+	c1.read(of13.OFPT_FEATURES_REPLY, features)
+	if features.DPID() != 1 {
+		t.Errorf("v%v: unexpected DPID: %v", version, features.DPID())
+	}
+
+	// Add two flows, and then remove all of them.
+	for _, port := range []uint32{1, 2} {
+		match, _ := f.NewMatch()
+		inPort := openflow.NewInPort()
+		inPort.SetValue(port)
+		match.SetInPort(inPort)
+		flow, _ := f.NewFlowMod(openflow.FlowAdd)
+		flow.SetFlowMatch(match)
+		flow.SetPriority(10)
+		c1.write(flow)
+	}
+	c1.sync()
+	if n := len(s1.Flows()); n != 2 {
+		t.Errorf("v%v: unexpected number of flows: expected=2, actual=%v", version, n)
+	}
+	match, _ := f.NewMatch()
+	flow, _ := f.NewFlowMod(openflow.FlowDelete)
+	flow.SetTableID(0xFF)
+	flow.SetFlowMatch(match)
+	c1.write(flow)
+	c1.sync()
+	if n := len(s1.Flows()); n != 0 {
+		t.Errorf("v%v: unexpected number of flows: expected=0, actual=%v", version, n)
+	}
+
+	// The packet sent out to the linked port is received by the peer.
+	data := bytes.Repeat([]byte{0xAB}, 60)
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(2)
+	action, _ := f.NewAction()
+	action.SetOutPort(outPort)
+	out, _ := f.NewPacketOut()
+	out.SetInPort(openflow.NewInPort())
+	out.SetAction(action)
+	out.SetData(data)
+	c1.write(out)
+	in, _ := f.NewPacketIn()
+	c2.read(of13.OFPT_PACKET_IN, in)
+	if in.InPort() != 3 || !bytes.Equal(in.Data(), data) {
+		t.Errorf("v%v: unexpected PACKET_IN: port=%v, data=%x", version, in.InPort(), in.Data())
+	}
+	if outs := s1.PacketOuts(); len(outs) != 1 || len(outs[0].OutPorts) != 1 || outs[0].OutPorts[0] != 2 {
+		t.Errorf("v%v: unexpected PACKET_OUTs: %+v", version, outs)
+	}
+
+	// The packet sent out to the port of a host is received by the host.
+	received := make(chan []byte, 1)
+	s1.Attach(1, func(data []byte) { received <- data })
+	outPort.SetValue(1)
+	action.SetOutPort(outPort)
+	out.SetAction(action)
+	c1.write(out)
+	select {
+	case v := <-received:
+		if !bytes.Equal(v, data) {
+			t.Errorf("v%v: unexpected packet received by the host: %x", version, v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("v%v: the host has not received the packet", version)
+	}
+
+	if err := s2.InjectPacketIn(5, data); err == nil {
+		t.Errorf("v%v: expected an error for the invalid port", version)
+	}
+}
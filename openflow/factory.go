@@ -55,7 +55,7 @@ type Factory interface {
 	NewFlowMod(cmd FlowModCmd) (FlowMod, error)
 	NewFlowRemoved() (FlowRemoved, error)
 	NewFlowStatsRequest() (FlowStatsRequest, error)
-	// TODO: NewFlowStatsReply() (FlowStatsReply, error)
+	NewFlowStatsReply() (FlowStatsReply, error)
 	NewGetConfigRequest() (GetConfigRequest, error)
 	NewGetConfigReply() (GetConfigReply, error)
 	NewHello() (Hello, error)
@@ -65,8 +65,12 @@ type Factory interface {
 	NewPacketOut() (PacketOut, error)
 	NewPortDescRequest() (PortDescRequest, error)
 	NewPortDescReply() (PortDescReply, error)
+	NewPortStatsRequest() (PortStatsRequest, error)
+	NewPortStatsReply() (PortStatsReply, error)
 	NewPortStatus() (PortStatus, error)
 	NewQueueGetConfigRequest() (QueueGetConfigRequest, error)
+	NewRoleRequest() (RoleRequest, error)
+	NewRoleReply() (RoleReply, error)
 	NewSetConfig() (SetConfig, error)
 	NewTableFeaturesRequest() (TableFeaturesRequest, error)
 	// TODO: NewTableFeaturesReply() (TableFeaturesReply, error)
@@ -31,9 +31,13 @@ const (
 	FlowAdd FlowModCmd = iota
 	FlowModify
 	FlowDelete
+	// FlowDeleteStrict only deletes the flow whose match and priority are
+	// exactly the same.
+	FlowDeleteStrict
 )
 
 type FlowMod interface {
+	Command() FlowModCmd
 	Cookie() uint64
 	CookieMask() uint64
 	encoding.BinaryMarshaler
@@ -47,6 +51,11 @@ type FlowMod interface {
 	Priority() uint16
 	SetCookie(cookie uint64)
 	SetCookieMask(mask uint64)
+	// SetCheckOverlap sets whether the device should reject the flow if it
+	// overlaps another one of the same priority, which is true by default.
+	// Disabling the check makes the flow replace the one whose match and
+	// priority are identical.
+	SetCheckOverlap(check bool)
 	SetFlowInstruction(action Instruction)
 	SetFlowMatch(match Match)
 	SetHardTimeout(timeout uint16)
@@ -32,12 +32,36 @@ type FlowStatsRequest interface {
 	Error() error
 	Header
 	Match() Match
+	// OutPort returns the port that the flows should output to, which is
+	// NONE, i.e., any port, by default.
+	OutPort() OutPort
 	SetCookie(cookie uint64)
 	SetCookieMask(mask uint64)
 	SetMatch(match Match)
+	// SetOutPort restricts the flows to the ones that output to port.
+	SetOutPort(port OutPort)
 	// 0xFF means all table
 	SetTableID(id uint8)
 	TableID() uint8
 }
 
-// TODO: Implement FlowStatsReply
+type FlowStats struct {
+	TableID         uint8
+	DurationSec     uint32
+	DurationNanoSec uint32
+	Priority        uint16
+	IdleTimeout     uint16
+	HardTimeout     uint16
+	Cookie          uint64
+	PacketCount     uint64
+	ByteCount       uint64
+	Match           Match
+}
+
+type FlowStatsReply interface {
+	Header
+	// More returns whether there are more replies that follow this reply.
+	More() bool
+	FlowStats() []FlowStats
+	encoding.BinaryUnmarshaler
+}
@@ -84,7 +84,8 @@ func (r *Message) MarshalBinary() ([]byte, error) {
 		length += uint16(len(r.payload))
 	}
 
-	v := make([]byte, length)
+	// The transceiver releases the buffer after writing it.
+	v := NewBuffer(int(length))
 	v[0] = r.version
 	v[1] = r.msgType
 	binary.BigEndian.PutUint16(v[2:4], length)
@@ -23,6 +23,7 @@ package of10
 
 import (
 	"encoding/binary"
+	"errors"
 	"net"
 
 	"github.com/superkkt/cherry/openflow"
@@ -138,6 +139,11 @@ func (r *Action) MarshalBinary() ([]byte, error) {
 		result = append(result, v...)
 	}
 
+	// OpenFlow 1.0 does not have an action that decrements the IP TTL.
+	if r.DecrementTTL() {
+		return nil, errors.New("of10 does not support the action that decrements the IP TTL")
+	}
+
 	ok, vlanID := r.VLANID()
 	if ok {
 		v, err := marshalVLANID(vlanID)
@@ -104,6 +104,8 @@ func getFlowModCmd(cmd openflow.FlowModCmd) uint16 {
 		c = OFPFC_MODIFY
 	case openflow.FlowDelete:
 		c = OFPFC_DELETE
+	case openflow.FlowDeleteStrict:
+		c = OFPFC_DELETE_STRICT
 	default:
 		panic(fmt.Sprintf("unexpected FlowModCmd: %v", cmd))
 	}
@@ -143,7 +145,17 @@ func (r *Factory) NewFlowStatsRequest() (openflow.FlowStatsRequest, error) {
 	return NewFlowStatsRequest(r.getTransactionID()), nil
 }
 
-// TODO: NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+func (r *Factory) NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+	return new(FlowStatsReply), nil
+}
+
+func (r *Factory) NewPortStatsRequest() (openflow.PortStatsRequest, error) {
+	return NewPortStatsRequest(r.getTransactionID()), nil
+}
+
+func (r *Factory) NewPortStatsReply() (openflow.PortStatsReply, error) {
+	return new(PortStatsReply), nil
+}
 
 func (r *Factory) NewPortDescRequest() (openflow.PortDescRequest, error) {
 	return nil, errors.New("of10 does not support PortDescRequest")
@@ -157,6 +169,14 @@ func (r *Factory) NewTableFeaturesRequest() (openflow.TableFeaturesRequest, erro
 	return nil, errors.New("of10 does not support TableFeaturesRequest")
 }
 
+func (r *Factory) NewRoleRequest() (openflow.RoleRequest, error) {
+	return nil, errors.New("of10 does not support RoleRequest")
+}
+
+func (r *Factory) NewRoleReply() (openflow.RoleReply, error) {
+	return nil, errors.New("of10 does not support RoleReply")
+}
+
 func (r *Factory) NewError() (openflow.Error, error) {
 	return new(openflow.BaseError), nil
 }
@@ -39,6 +39,8 @@ type FlowMod struct {
 	match       openflow.Match
 	instruction openflow.Instruction
 	outPort     openflow.OutPort
+	// noOverlapCheck clears OFPFF_CHECK_OVERLAP.
+	noOverlapCheck bool
 }
 
 func NewFlowMod(xid uint32, cmd uint16) openflow.FlowMod {
@@ -57,6 +59,19 @@ func (r *FlowMod) Error() error {
 	return r.err
 }
 
+func (r *FlowMod) Command() openflow.FlowModCmd {
+	switch r.command {
+	case OFPFC_ADD:
+		return openflow.FlowAdd
+	case OFPFC_MODIFY, OFPFC_MODIFY_STRICT:
+		return openflow.FlowModify
+	case OFPFC_DELETE_STRICT:
+		return openflow.FlowDeleteStrict
+	default:
+		return openflow.FlowDelete
+	}
+}
+
 func (r *FlowMod) Cookie() uint64 {
 	return r.cookie
 }
@@ -70,6 +85,10 @@ func (r *FlowMod) CookieMask() uint64 {
 	return 0
 }
 
+func (r *FlowMod) SetCheckOverlap(check bool) {
+	r.noOverlapCheck = !check
+}
+
 func (r *FlowMod) SetCookieMask(mask uint64) {
 	// OpenFlow 1.0 does not have the cookie mask
 }
@@ -159,7 +178,11 @@ func (r *FlowMod) MarshalBinary() ([]byte, error) {
 	// So, the flows will not work properly on very busy workload, and the controller will see repetitive PACKET_IN messages
 	// even if the ingress packet is matched with the installed flows on the switch. This is because the flows are fluctuated
 	// due to the consecutive flow installation requests without OFPFF_CHECK_OVERLAP flag.
-	binary.BigEndian.PutUint16(v[22:24], OFPFF_SEND_FLOW_REM|OFPFF_CHECK_OVERLAP)
+	flags := uint16(OFPFF_SEND_FLOW_REM | OFPFF_CHECK_OVERLAP)
+	if r.noOverlapCheck {
+		flags = OFPFF_SEND_FLOW_REM
+	}
+	binary.BigEndian.PutUint16(v[22:24], flags)
 
 	if r.match == nil {
 		return nil, errors.New("empty flow match")
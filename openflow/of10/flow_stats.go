@@ -33,11 +33,16 @@ type FlowStatsRequest struct {
 	openflow.Message
 	match   openflow.Match
 	tableID uint8
+	outPort openflow.OutPort
 }
 
 func NewFlowStatsRequest(xid uint32) openflow.FlowStatsRequest {
+	outPort := openflow.NewOutPort()
+	outPort.SetNone()
+
 	return &FlowStatsRequest{
 		Message: openflow.NewMessage(openflow.OF10_VERSION, OFPT_STATS_REQUEST, xid),
+		outPort: outPort,
 	}
 }
 
@@ -83,6 +88,14 @@ func (r *FlowStatsRequest) SetTableID(id uint8) {
 	r.tableID = id
 }
 
+func (r *FlowStatsRequest) OutPort() openflow.OutPort {
+	return r.outPort
+}
+
+func (r *FlowStatsRequest) SetOutPort(port openflow.OutPort) {
+	r.outPort = port
+}
+
 // TODO: Need testing
 func (r *FlowStatsRequest) MarshalBinary() ([]byte, error) {
 	if r.err != nil {
@@ -103,10 +116,73 @@ func (r *FlowStatsRequest) MarshalBinary() ([]byte, error) {
 	copy(v[4:44], match)
 	v[44] = r.tableID
 	// v[45] is padding
-	binary.BigEndian.PutUint16(v[46:48], OFPP_NONE)
+	if r.outPort.IsNone() {
+		binary.BigEndian.PutUint16(v[46:48], OFPP_NONE)
+	} else {
+		binary.BigEndian.PutUint16(v[46:48], uint16(r.outPort.Value()))
+	}
 	r.SetPayload(v)
 
 	return r.Message.MarshalBinary()
 }
 
-// TODO: Implement FlowStatsReply
+type FlowStatsReply struct {
+	openflow.Message
+	more  bool
+	stats []openflow.FlowStats
+}
+
+func (r FlowStatsReply) More() bool {
+	return r.more
+}
+
+func (r FlowStatsReply) FlowStats() []openflow.FlowStats {
+	return r.stats
+}
+
+func (r *FlowStatsReply) UnmarshalBinary(data []byte) error {
+	if err := r.Message.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	payload := r.Payload()
+	if payload == nil || len(payload) < 4 {
+		return openflow.ErrInvalidPacketLength
+	}
+	// payload[0:4] is type and flag of ofp_stats_reply
+	r.more = binary.BigEndian.Uint16(payload[2:4])&OFPSF_REPLY_MORE != 0
+	r.stats = make([]openflow.FlowStats, 0)
+
+	payload = payload[4:]
+	for len(payload) > 0 {
+		if len(payload) < 88 {
+			return openflow.ErrInvalidPacketLength
+		}
+		length := int(binary.BigEndian.Uint16(payload[0:2]))
+		if length < 88 || len(payload) < length {
+			return openflow.ErrInvalidPacketLength
+		}
+
+		match := NewMatch()
+		if err := match.UnmarshalBinary(payload[4:44]); err != nil {
+			return err
+		}
+		r.stats = append(r.stats, openflow.FlowStats{
+			TableID:         payload[2],
+			Match:           match,
+			DurationSec:     binary.BigEndian.Uint32(payload[44:48]),
+			DurationNanoSec: binary.BigEndian.Uint32(payload[48:52]),
+			Priority:        binary.BigEndian.Uint16(payload[52:54]),
+			IdleTimeout:     binary.BigEndian.Uint16(payload[54:56]),
+			HardTimeout:     binary.BigEndian.Uint16(payload[56:58]),
+			// payload[58:64] is padding
+			Cookie:      binary.BigEndian.Uint64(payload[64:72]),
+			PacketCount: binary.BigEndian.Uint64(payload[72:80]),
+			ByteCount:   binary.BigEndian.Uint64(payload[80:88]),
+		})
+
+		payload = payload[length:]
+	}
+
+	return nil
+}
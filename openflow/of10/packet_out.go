@@ -83,16 +83,16 @@ func (r *PacketOut) MarshalBinary() ([]byte, error) {
 	// XXX:
 	// Dell S4810 switch does not support OFPAT_SET_DL_SRC and
 	// OFPAT_SET_DL_DST actions on a packet out message
-	action := make([]byte, 0)
+	var action []byte
 	if r.action != nil {
 		a, err := r.action.MarshalBinary()
 		if err != nil {
 			return nil, err
 		}
-		action = append(action, a...)
+		action = a
 	}
 
-	v := make([]byte, 8)
+	v := make([]byte, 8, 8+len(action)+len(r.data))
 	binary.BigEndian.PutUint32(v[0:4], OFP_NO_BUFFER)
 	port := uint16(r.inPort.Value())
 	if r.inPort.IsController() {
@@ -101,9 +101,7 @@ func (r *PacketOut) MarshalBinary() ([]byte, error) {
 	binary.BigEndian.PutUint16(v[4:6], port)
 	binary.BigEndian.PutUint16(v[6:8], uint16(len(action)))
 	v = append(v, action...)
-	if r.data != nil && len(r.data) > 0 {
-		v = append(v, r.data...)
-	}
+	v = append(v, r.data...)
 
 	r.SetPayload(v)
 	return r.Message.MarshalBinary()
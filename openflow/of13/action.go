@@ -92,7 +92,23 @@ func marshalMAC(t uint8, mac net.HardwareAddr) ([]byte, error) {
 	return v, nil
 }
 
-// TODO: Marshal Enqueue
+func marshalDecNWTTL() []byte {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint16(v[0:2], OFPAT_DEC_NW_TTL)
+	binary.BigEndian.PutUint16(v[2:4], 8)
+	// v[4:8] is padding
+
+	return v
+}
+
+func marshalSetQueue(queue uint32) []byte {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint16(v[0:2], OFPAT_SET_QUEUE)
+	binary.BigEndian.PutUint16(v[2:4], 8)
+	binary.BigEndian.PutUint32(v[4:8], queue)
+
+	return v
+}
 
 // TODO: Marshal SetVLANVID
 
@@ -101,7 +117,8 @@ func (r *Action) MarshalBinary() ([]byte, error) {
 		return nil, err
 	}
 
-	result := make([]byte, 0)
+	// The set-field actions for the MAC addresses and the output action.
+	result := make([]byte, 0, 48)
 	if ok, srcMAC := r.SrcMAC(); ok {
 		v, err := marshalMAC(OFPXMT_OFB_ETH_SRC, srcMAC)
 		if err != nil {
@@ -116,6 +133,13 @@ func (r *Action) MarshalBinary() ([]byte, error) {
 		}
 		result = append(result, v...)
 	}
+	if r.DecrementTTL() {
+		result = append(result, marshalDecNWTTL()...)
+	}
+	// The queue is applied to the following output action.
+	if ok, queue := r.Queue(); ok {
+		result = append(result, marshalSetQueue(queue)...)
+	}
 
 	v, err := marshalOutput(r.OutPort())
 	if err != nil {
@@ -126,8 +150,6 @@ func (r *Action) MarshalBinary() ([]byte, error) {
 	return result, nil
 }
 
-// TODO: Unmarshal Enqueue
-
 // TODO: Unmarshal SetVLANVID
 
 func (r *Action) UnmarshalBinary(data []byte) error {
@@ -150,6 +172,13 @@ func (r *Action) UnmarshalBinary(data []byte) error {
 			if err := r.Error(); err != nil {
 				return err
 			}
+		case OFPAT_SET_QUEUE:
+			if len(buf) < 8 {
+				return openflow.ErrInvalidPacketLength
+			}
+			r.SetQueue(binary.BigEndian.Uint32(buf[4:8]))
+		case OFPAT_DEC_NW_TTL:
+			r.SetDecrementTTL()
 		case OFPAT_SET_FIELD:
 			if len(buf) < 8 {
 				return openflow.ErrInvalidPacketLength
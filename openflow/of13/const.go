@@ -65,8 +65,10 @@ const (
 )
 
 const (
-	OFPAT_OUTPUT    = 0
-	OFPAT_SET_FIELD = 25
+	OFPAT_OUTPUT     = 0
+	OFPAT_SET_QUEUE  = 21
+	OFPAT_DEC_NW_TTL = 24
+	OFPAT_SET_FIELD  = 25
 )
 
 const (
@@ -251,6 +253,10 @@ const (
 	OFPMP_EXPERIMENTER = 0xffff
 )
 
+const (
+	OFPMPF_REPLY_MORE = 1 << 0 /* More replies to follow. */
+)
+
 const (
 	OFPG_ANY = 0xffffffff
 )
@@ -277,3 +283,10 @@ const (
 	OFPIT_METER          = 6      /* Apply meter (rate limiter) */
 	OFPIT_EXPERIMENTER   = 0xFFFF /* Experimenter instruction */
 )
+
+const (
+	OFPCR_ROLE_NOCHANGE = 0 /* Don't change current role. */
+	OFPCR_ROLE_EQUAL    = 1 /* Default role, full access. */
+	OFPCR_ROLE_MASTER   = 2 /* Full access, at most one master. */
+	OFPCR_ROLE_SLAVE    = 3 /* Read-only access. */
+)
@@ -103,6 +103,8 @@ func getFlowModCmd(cmd openflow.FlowModCmd) uint8 {
 		c = OFPFC_MODIFY
 	case openflow.FlowDelete:
 		c = OFPFC_DELETE
+	case openflow.FlowDeleteStrict:
+		c = OFPFC_DELETE_STRICT
 	default:
 		panic(fmt.Sprintf("unexpected FlowModCmd: %v", cmd))
 	}
@@ -142,7 +144,17 @@ func (r *Factory) NewFlowStatsRequest() (openflow.FlowStatsRequest, error) {
 	return NewFlowStatsRequest(r.getTransactionID()), nil
 }
 
-// TODO: NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+func (r *Factory) NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+	return new(FlowStatsReply), nil
+}
+
+func (r *Factory) NewPortStatsRequest() (openflow.PortStatsRequest, error) {
+	return NewPortStatsRequest(r.getTransactionID()), nil
+}
+
+func (r *Factory) NewPortStatsReply() (openflow.PortStatsReply, error) {
+	return new(PortStatsReply), nil
+}
 
 func (r *Factory) NewPortDescRequest() (openflow.PortDescRequest, error) {
 	return NewPortDescRequest(r.getTransactionID()), nil
@@ -156,6 +168,14 @@ func (r *Factory) NewTableFeaturesRequest() (openflow.TableFeaturesRequest, erro
 	return NewTableFeaturesRequest(r.getTransactionID()), nil
 }
 
+func (r *Factory) NewRoleRequest() (openflow.RoleRequest, error) {
+	return NewRoleRequest(r.getTransactionID()), nil
+}
+
+func (r *Factory) NewRoleReply() (openflow.RoleReply, error) {
+	return new(RoleReply), nil
+}
+
 func (r *Factory) NewError() (openflow.Error, error) {
 	return new(openflow.BaseError), nil
 }
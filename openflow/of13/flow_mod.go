@@ -41,6 +41,8 @@ type FlowMod struct {
 	match       openflow.Match
 	instruction openflow.Instruction
 	outPort     openflow.OutPort
+	// noOverlapCheck clears OFPFF_CHECK_OVERLAP.
+	noOverlapCheck bool
 }
 
 func NewFlowMod(xid uint32, cmd uint8) openflow.FlowMod {
@@ -59,6 +61,19 @@ func (r *FlowMod) Error() error {
 	return r.err
 }
 
+func (r *FlowMod) Command() openflow.FlowModCmd {
+	switch r.command {
+	case OFPFC_ADD:
+		return openflow.FlowAdd
+	case OFPFC_MODIFY, OFPFC_MODIFY_STRICT:
+		return openflow.FlowModify
+	case OFPFC_DELETE_STRICT:
+		return openflow.FlowDeleteStrict
+	default:
+		return openflow.FlowDelete
+	}
+}
+
 func (r *FlowMod) Cookie() uint64 {
 	return r.cookie
 }
@@ -71,6 +86,10 @@ func (r *FlowMod) CookieMask() uint64 {
 	return r.cookieMask
 }
 
+func (r *FlowMod) SetCheckOverlap(check bool) {
+	r.noOverlapCheck = !check
+}
+
 func (r *FlowMod) SetCookieMask(mask uint64) {
 	r.cookieMask = mask
 }
@@ -142,7 +161,21 @@ func (r *FlowMod) MarshalBinary() ([]byte, error) {
 		return nil, r.err
 	}
 
-	v := make([]byte, 40)
+	if r.match == nil {
+		return nil, errors.New("empty flow match")
+	}
+	match, err := r.match.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var ins []byte
+	if r.instruction != nil {
+		if ins, err = r.instruction.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+
+	v := make([]byte, 40, 40+len(match)+len(ins))
 	binary.BigEndian.PutUint64(v[0:8], r.cookie)
 	binary.BigEndian.PutUint64(v[8:16], r.cookieMask)
 	v[16] = r.tableID
@@ -162,24 +195,15 @@ func (r *FlowMod) MarshalBinary() ([]byte, error) {
 	// So, the flows will not work properly on very busy workload, and the controller will see repetitive PACKET_IN messages
 	// even if the ingress packet is matched with the installed flows on the switch. This is because the flows are fluctuated
 	// due to the consecutive flow installation requests without OFPFF_CHECK_OVERLAP flag.
-	binary.BigEndian.PutUint16(v[36:38], OFPFF_SEND_FLOW_REM|OFPFF_CHECK_OVERLAP)
+	flags := uint16(OFPFF_SEND_FLOW_REM | OFPFF_CHECK_OVERLAP)
+	if r.noOverlapCheck {
+		flags = OFPFF_SEND_FLOW_REM
+	}
+	binary.BigEndian.PutUint16(v[36:38], flags)
 	// v[38:40] is padding
 
-	if r.match == nil {
-		return nil, errors.New("empty flow match")
-	}
-	match, err := r.match.MarshalBinary()
-	if err != nil {
-		return nil, err
-	}
 	v = append(v, match...)
-	if r.instruction != nil {
-		ins, err := r.instruction.MarshalBinary()
-		if err != nil {
-			return nil, err
-		}
-		v = append(v, ins...)
-	}
+	v = append(v, ins...)
 
 	r.SetPayload(v)
 	return r.Message.MarshalBinary()
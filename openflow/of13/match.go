@@ -22,10 +22,10 @@
 package of13
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 
 	"github.com/superkkt/cherry/openflow"
@@ -39,6 +39,8 @@ type Match struct {
 	m     map[uint]interface{}
 }
 
+var padding [8]byte
+
 // NewMatch returns a Match whose fields are all wildcarded
 func NewMatch() openflow.Match {
 	return &Match{
@@ -567,10 +569,19 @@ func (r *Match) MarshalBinary() ([]byte, error) {
 		return nil, r.err
 	}
 
-	data := make([]byte, 4)
+	// Enough for the most matches without growing.
+	data := make([]byte, 4, 64)
 	binary.BigEndian.PutUint16(data[0:2], OFPMT_OXM)
-	for k, v := range r.m {
-		tlv, err := marshalTLV(k, v)
+	// The prerequisite fields, e.g., eth_type for ip_proto, should precede the
+	// fields that depend on them, which are numbered in that order. It also
+	// makes the identical matches always marshaled into the same bytes.
+	fields := make([]uint, 0, len(r.m))
+	for k := range r.m {
+		fields = append(fields, k)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i] < fields[j] })
+	for _, k := range fields {
+		tlv, err := marshalTLV(k, r.m[k])
 		if err != nil {
 			return nil, err
 		}
@@ -581,7 +592,7 @@ func (r *Match) MarshalBinary() ([]byte, error) {
 	// Add padding to align as a multiple of 8
 	rem := len(data) % 8
 	if rem > 0 {
-		data = append(data, bytes.Repeat([]byte{0}, 8-rem)...)
+		data = append(data, padding[:8-rem]...)
 	}
 
 	return data, nil
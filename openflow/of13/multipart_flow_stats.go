@@ -34,11 +34,16 @@ type FlowStatsRequest struct {
 	tableID            uint8
 	cookie, cookieMask uint64
 	match              openflow.Match
+	outPort            openflow.OutPort
 }
 
 func NewFlowStatsRequest(xid uint32) openflow.FlowStatsRequest {
+	outPort := openflow.NewOutPort()
+	outPort.SetNone()
+
 	return &FlowStatsRequest{
 		Message: openflow.NewMessage(openflow.OF13_VERSION, OFPT_MULTIPART_REQUEST, xid),
+		outPort: outPort,
 	}
 }
 
@@ -82,6 +87,14 @@ func (r *FlowStatsRequest) SetTableID(id uint8) {
 	r.tableID = id
 }
 
+func (r *FlowStatsRequest) OutPort() openflow.OutPort {
+	return r.outPort
+}
+
+func (r *FlowStatsRequest) SetOutPort(port openflow.OutPort) {
+	r.outPort = port
+}
+
 func (r *FlowStatsRequest) MarshalBinary() ([]byte, error) {
 	if r.err != nil {
 		return nil, r.err
@@ -92,7 +105,11 @@ func (r *FlowStatsRequest) MarshalBinary() ([]byte, error) {
 	binary.BigEndian.PutUint16(v[0:2], OFPMP_FLOW)
 	v[8] = r.tableID
 	// v[9:12] is padding
-	binary.BigEndian.PutUint32(v[12:16], OFPP_ANY)
+	if r.outPort.IsNone() {
+		binary.BigEndian.PutUint32(v[12:16], OFPP_ANY)
+	} else {
+		binary.BigEndian.PutUint32(v[12:16], r.outPort.Value())
+	}
 	binary.BigEndian.PutUint32(v[16:20], OFPG_ANY)
 	// v[20:24] is padding
 	binary.BigEndian.PutUint64(v[24:32], r.cookie)
@@ -111,4 +128,64 @@ func (r *FlowStatsRequest) MarshalBinary() ([]byte, error) {
 	return r.Message.MarshalBinary()
 }
 
-// TODO: Implement FlowStatsReply
+type FlowStatsReply struct {
+	openflow.Message
+	more  bool
+	stats []openflow.FlowStats
+}
+
+func (r FlowStatsReply) More() bool {
+	return r.more
+}
+
+func (r FlowStatsReply) FlowStats() []openflow.FlowStats {
+	return r.stats
+}
+
+func (r *FlowStatsReply) UnmarshalBinary(data []byte) error {
+	if err := r.Message.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	payload := r.Payload()
+	if payload == nil || len(payload) < 8 {
+		return openflow.ErrInvalidPacketLength
+	}
+	// payload[0:8] is type, flags, and padding of ofp_multipart_reply
+	r.more = binary.BigEndian.Uint16(payload[2:4])&OFPMPF_REPLY_MORE != 0
+	r.stats = make([]openflow.FlowStats, 0)
+
+	payload = payload[8:]
+	for len(payload) > 0 {
+		if len(payload) < 56 {
+			return openflow.ErrInvalidPacketLength
+		}
+		length := int(binary.BigEndian.Uint16(payload[0:2]))
+		if length < 56 || len(payload) < length {
+			return openflow.ErrInvalidPacketLength
+		}
+
+		v := openflow.FlowStats{
+			TableID:         payload[2],
+			DurationSec:     binary.BigEndian.Uint32(payload[4:8]),
+			DurationNanoSec: binary.BigEndian.Uint32(payload[8:12]),
+			Priority:        binary.BigEndian.Uint16(payload[12:14]),
+			IdleTimeout:     binary.BigEndian.Uint16(payload[14:16]),
+			HardTimeout:     binary.BigEndian.Uint16(payload[16:18]),
+			// payload[18:24] is flags and padding
+			Cookie:      binary.BigEndian.Uint64(payload[24:32]),
+			PacketCount: binary.BigEndian.Uint64(payload[32:40]),
+			ByteCount:   binary.BigEndian.Uint64(payload[40:48]),
+		}
+		match := NewMatch()
+		if err := match.UnmarshalBinary(payload[48:length]); err != nil {
+			return err
+		}
+		v.Match = match
+		r.stats = append(r.stats, v)
+
+		payload = payload[length:]
+	}
+
+	return nil
+}
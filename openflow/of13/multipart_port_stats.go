@@ -0,0 +1,101 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package of13
+
+import (
+	"encoding/binary"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+type PortStatsRequest struct {
+	openflow.Message
+}
+
+func NewPortStatsRequest(xid uint32) openflow.PortStatsRequest {
+	return &PortStatsRequest{
+		Message: openflow.NewMessage(openflow.OF13_VERSION, OFPT_MULTIPART_REQUEST, xid),
+	}
+}
+
+func (r *PortStatsRequest) MarshalBinary() ([]byte, error) {
+	v := make([]byte, 16)
+	// Multipart port stats request
+	binary.BigEndian.PutUint16(v[0:2], OFPMP_PORT_STATS)
+	// v[2:8] is flags and padding
+	binary.BigEndian.PutUint32(v[8:12], OFPP_ANY)
+	// v[12:16] is padding
+	r.SetPayload(v)
+
+	return r.Message.MarshalBinary()
+}
+
+type PortStatsReply struct {
+	openflow.Message
+	more  bool
+	stats []openflow.PortStats
+}
+
+func (r PortStatsReply) More() bool {
+	return r.more
+}
+
+func (r PortStatsReply) PortStats() []openflow.PortStats {
+	return r.stats
+}
+
+func (r *PortStatsReply) UnmarshalBinary(data []byte) error {
+	if err := r.Message.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	payload := r.Payload()
+	if payload == nil || len(payload) < 8 || (len(payload)-8)%112 != 0 {
+		return openflow.ErrInvalidPacketLength
+	}
+	// payload[0:8] is type, flags, and padding of ofp_multipart_reply
+	r.more = binary.BigEndian.Uint16(payload[2:4])&OFPMPF_REPLY_MORE != 0
+	r.stats = make([]openflow.PortStats, 0)
+
+	for v := payload[8:]; len(v) > 0; v = v[112:] {
+		r.stats = append(r.stats, openflow.PortStats{
+			PortNumber: binary.BigEndian.Uint32(v[0:4]),
+			// v[4:8] is padding
+			RxPackets:       binary.BigEndian.Uint64(v[8:16]),
+			TxPackets:       binary.BigEndian.Uint64(v[16:24]),
+			RxBytes:         binary.BigEndian.Uint64(v[24:32]),
+			TxBytes:         binary.BigEndian.Uint64(v[32:40]),
+			RxDropped:       binary.BigEndian.Uint64(v[40:48]),
+			TxDropped:       binary.BigEndian.Uint64(v[48:56]),
+			RxErrors:        binary.BigEndian.Uint64(v[56:64]),
+			TxErrors:        binary.BigEndian.Uint64(v[64:72]),
+			RxFrameErr:      binary.BigEndian.Uint64(v[72:80]),
+			RxOverErr:       binary.BigEndian.Uint64(v[80:88]),
+			RxCRCErr:        binary.BigEndian.Uint64(v[88:96]),
+			Collisions:      binary.BigEndian.Uint64(v[96:104]),
+			DurationSec:     binary.BigEndian.Uint32(v[104:108]),
+			DurationNanoSec: binary.BigEndian.Uint32(v[108:112]),
+		})
+	}
+
+	return nil
+}
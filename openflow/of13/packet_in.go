@@ -23,6 +23,7 @@ package of13
 
 import (
 	"encoding/binary"
+	"errors"
 
 	"github.com/superkkt/cherry/openflow"
 )
@@ -81,12 +82,11 @@ func (r *PacketIn) UnmarshalBinary(data []byte) error {
 	r.tableID = payload[7]
 	r.cookie = binary.BigEndian.Uint64(payload[8:16])
 
-	match := NewMatch()
-	if err := match.UnmarshalBinary(payload[16:]); err != nil {
+	inPort, err := parseInPort(payload[16:])
+	if err != nil {
 		return err
 	}
-	_, inport := match.InPort()
-	r.inPort = inport.Value()
+	r.inPort = inPort
 
 	matchLength := binary.BigEndian.Uint16(payload[18:20])
 	// Calculate padding length
@@ -103,3 +103,42 @@ func (r *PacketIn) UnmarshalBinary(data []byte) error {
 
 	return nil
 }
+
+// parseInPort returns the value of the in_port field in the OXM match, which is
+// the only field we need from a PACKET_IN. It does not allocate a Match as the
+// PACKET_INs are the majority of the messages from the devices.
+func parseInPort(match []byte) (uint32, error) {
+	if len(match) < 4 {
+		return 0, openflow.ErrInvalidPacketLength
+	}
+	if binary.BigEndian.Uint16(match[0:2]) != OFPMT_OXM {
+		return 0, openflow.ErrUnsupportedMatchType
+	}
+	length := binary.BigEndian.Uint16(match[2:4])
+	if length < 4 || len(match) < int(length) {
+		return 0, openflow.ErrInvalidPacketLength
+	}
+
+	// TLV header length is 4 bytes
+	buf := match[4:length]
+	for len(buf) >= 4 {
+		header := binary.BigEndian.Uint32(buf[0:4])
+		if header>>16&0xFFFF != 0x8000 {
+			return 0, errors.New("unsupported TLV class")
+		}
+		tlvLength := int(header & 0xFF)
+		if len(buf) < 4+tlvLength {
+			return 0, openflow.ErrInvalidPacketLength
+		}
+		if header>>9&0x7F == OFPXMT_OFB_IN_PORT {
+			if tlvLength < 4 {
+				return 0, openflow.ErrInvalidPacketLength
+			}
+			return binary.BigEndian.Uint32(buf[4:8]), nil
+		}
+		buf = buf[4+tlvLength:]
+	}
+
+	// Wildcarded in_port.
+	return 0, nil
+}
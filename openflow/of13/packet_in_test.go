@@ -0,0 +1,110 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package of13
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+// newPacketIn returns a PACKET_IN whose match has the in_port field after the
+// eth_type field, which is followed by data.
+func newPacketIn(inPort uint32, data []byte) []byte {
+	match := []byte{
+		0x00, 0x01, 0x00, 0x12, // OXM, length 18 without the padding
+		0x80, 0x00, 0x0A, 0x02, 0x08, 0x00, // eth_type
+		0x80, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, // in_port
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // padding
+	}
+	binary.BigEndian.PutUint32(match[14:18], inPort)
+
+	body := make([]byte, 16)
+	binary.BigEndian.PutUint32(body[0:4], OFP_NO_BUFFER)
+	binary.BigEndian.PutUint16(body[4:6], uint16(len(data)))
+	body = append(body, match...)
+	body = append(body, 0, 0) // padding
+	body = append(body, data...)
+
+	msg := openflow.NewMessage(openflow.OF13_VERSION, OFPT_PACKET_IN, 1)
+	msg.SetPayload(body)
+	packet, err := msg.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	return packet
+}
+
+func TestPacketIn(t *testing.T) {
+	data := bytes.Repeat([]byte{0xAB}, 60)
+	v := new(PacketIn)
+	if err := v.UnmarshalBinary(newPacketIn(7, data)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.InPort() != 7 {
+		t.Errorf("unexpected in_port: expected=7, actual=%v", v.InPort())
+	}
+	if !bytes.Equal(v.Data(), data) {
+		t.Errorf("unexpected data: %x", v.Data())
+	}
+
+	// Broken TLV length.
+	packet := newPacketIn(7, data)
+	packet[8+16+13] = 0xFF
+	if err := new(PacketIn).UnmarshalBinary(packet); err == nil {
+		t.Errorf("expected an error for the invalid TLV length")
+	}
+}
+
+func BenchmarkPacketIn(b *testing.B) {
+	packet := newPacketIn(7, make([]byte, 60))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := new(PacketIn).UnmarshalBinary(packet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPacketOut(b *testing.B) {
+	data := make([]byte, 60)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		port := openflow.NewOutPort()
+		port.SetValue(3)
+		action := NewAction()
+		action.SetOutPort(port)
+		out := NewPacketOut(1)
+		out.SetAction(action)
+		out.SetData(data)
+
+		packet, err := out.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+		// As the transceiver does after writing it.
+		openflow.ReleaseBuffer(packet)
+	}
+}
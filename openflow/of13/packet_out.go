@@ -80,16 +80,16 @@ func (r *PacketOut) MarshalBinary() ([]byte, error) {
 		return nil, r.err
 	}
 
-	action := make([]byte, 0)
+	var action []byte
 	if r.action != nil {
 		a, err := r.action.MarshalBinary()
 		if err != nil {
 			return nil, err
 		}
-		action = append(action, a...)
+		action = a
 	}
 
-	v := make([]byte, 16)
+	v := make([]byte, 16, 16+len(action)+len(r.data))
 	binary.BigEndian.PutUint32(v[0:4], OFP_NO_BUFFER)
 	port := r.inPort.Value()
 	if r.inPort.IsController() {
@@ -99,9 +99,7 @@ func (r *PacketOut) MarshalBinary() ([]byte, error) {
 	binary.BigEndian.PutUint16(v[8:10], uint16(len(action)))
 	// v[10:16] is padding
 	v = append(v, action...)
-	if r.data != nil && len(r.data) > 0 {
-		v = append(v, r.data...)
-	}
+	v = append(v, r.data...)
 
 	r.SetPayload(v)
 	return r.Message.MarshalBinary()
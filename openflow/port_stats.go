@@ -0,0 +1,59 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package openflow
+
+import (
+	"encoding"
+)
+
+// PortStatsRequest queries the statistics of all the ports.
+type PortStatsRequest interface {
+	Header
+	encoding.BinaryMarshaler
+}
+
+type PortStats struct {
+	PortNumber uint32
+	RxPackets  uint64
+	TxPackets  uint64
+	RxBytes    uint64
+	TxBytes    uint64
+	RxDropped  uint64
+	TxDropped  uint64
+	RxErrors   uint64
+	TxErrors   uint64
+	RxFrameErr uint64
+	RxOverErr  uint64
+	RxCRCErr   uint64
+	Collisions uint64
+	// Durations are always zero on OpenFlow 1.0.
+	DurationSec     uint32
+	DurationNanoSec uint32
+}
+
+type PortStatsReply interface {
+	Header
+	// More returns whether there are more replies that follow this reply.
+	More() bool
+	PortStats() []PortStats
+	encoding.BinaryUnmarshaler
+}
@@ -0,0 +1,73 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package openflow
+
+import (
+	"encoding"
+	"fmt"
+)
+
+// ControllerRole is the role of a controller on a switch. A switch sends the
+// asynchronous messages, such as PACKET_IN, only to the master and the equal
+// controllers, and rejects the modifications from the slave controllers.
+type ControllerRole uint32
+
+const (
+	RoleNoChange ControllerRole = iota
+	RoleEqual
+	RoleMaster
+	RoleSlave
+)
+
+func (r ControllerRole) String() string {
+	switch r {
+	case RoleNoChange:
+		return "nochange"
+	case RoleEqual:
+		return "equal"
+	case RoleMaster:
+		return "master"
+	case RoleSlave:
+		return "slave"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint32(r))
+	}
+}
+
+type RoleRequest interface {
+	Header
+	Role() ControllerRole
+	SetRole(ControllerRole)
+	// GenerationID distinguishes the requests of the old masters from the new
+	// one. The switch rejects a master or slave request whose generation ID is
+	// older than the largest one it has seen.
+	GenerationID() uint64
+	SetGenerationID(uint64)
+	encoding.BinaryMarshaler
+}
+
+type RoleReply interface {
+	Header
+	Role() ControllerRole
+	GenerationID() uint64
+	encoding.BinaryUnmarshaler
+}
@@ -24,6 +24,8 @@ package transceiver
 import (
 	"bufio"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,6 +35,35 @@ type Stream struct {
 	reader       *bufio.Reader
 	readTimeout  time.Duration
 	writeTimeout time.Duration
+
+	// writeMutex protects the fields below, and serializes the writes to the channel.
+	writeMutex sync.Mutex
+	// Zero flushInterval disables the write buffering.
+	flushInterval  time.Duration
+	flushThreshold int
+	flushTimer     *time.Timer
+	// flushing is true while the flush timer is running.
+	flushing bool
+	writeBuf []byte
+	// writeErr is the error of the last flush, which is returned by all the next writes.
+	writeErr error
+
+	capture atomic.Value // captureHolder
+}
+
+// Capture records the raw bytes of a stream, e.g., for debugging the interop
+// issues with the devices. Its methods should not keep p.
+type Capture interface {
+	// Received is called with each message read by ReadN.
+	Received(p []byte)
+	// Sent is called with the bytes written to the underlying I/O channel,
+	// which may have several messages.
+	Sent(p []byte)
+}
+
+// captureHolder makes a nil Capture storable in atomic.Value.
+type captureHolder struct {
+	c Capture
 }
 
 type Deadline interface {
@@ -49,6 +80,17 @@ func NewStream(channel io.ReadWriteCloser) *Stream {
 	}
 }
 
+// SetCapture makes the stream record its bytes to c, which stops recording if
+// it is nil.
+func (r *Stream) SetCapture(c Capture) {
+	r.capture.Store(captureHolder{c})
+}
+
+func (r *Stream) getCapture() Capture {
+	v, _ := r.capture.Load().(captureHolder)
+	return v.c
+}
+
 // SetReadTimeout sets read timeout of the underlying I/O channel if the channel implements Deadline interface.
 func (r *Stream) SetReadTimeout(t time.Duration) {
 	r.readTimeout = t
@@ -107,12 +149,104 @@ func (r *Stream) ReadN(n int) (p []byte, err error) {
 	if err != nil {
 		return nil, err
 	}
+	if c := r.getCapture(); c != nil {
+		c.Received(p)
+	}
 
 	return p, nil
 }
 
-// Write is a wrapper function of net.Conn.Write().
+// SetWriteBuffering makes Write coalesce the small writes: p is copied into the
+// buffer, which is written to the underlying I/O channel when it has threshold
+// bytes, or interval after the first write into the empty buffer. The errors of
+// the delayed writes are returned by the next writes, and close the channel
+// so that the readers notice them. Zero interval disables the buffering.
+func (r *Stream) SetWriteBuffering(interval time.Duration, threshold int) {
+	r.writeMutex.Lock()
+	defer r.writeMutex.Unlock()
+
+	r.flushInterval = interval
+	r.flushThreshold = threshold
+	if interval == 0 {
+		r.flush()
+	}
+}
+
+// Write is a wrapper function of net.Conn.Write(), which may buffer p. See SetWriteBuffering.
 func (r *Stream) Write(p []byte) (n int, err error) {
+	r.writeMutex.Lock()
+	defer r.writeMutex.Unlock()
+
+	if r.writeErr != nil {
+		return 0, r.writeErr
+	}
+	if r.flushInterval == 0 {
+		return r.write(p)
+	}
+
+	r.writeBuf = append(r.writeBuf, p...)
+	if len(r.writeBuf) >= r.flushThreshold {
+		if err := r.flush(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if !r.flushing {
+		if r.flushTimer == nil {
+			r.flushTimer = time.AfterFunc(r.flushInterval, r.onFlushTimer)
+		} else {
+			r.flushTimer.Reset(r.flushInterval)
+		}
+		r.flushing = true
+	}
+
+	return len(p), nil
+}
+
+func (r *Stream) onFlushTimer() {
+	r.writeMutex.Lock()
+	defer r.writeMutex.Unlock()
+
+	r.flushing = false
+	if err := r.flush(); err != nil {
+		// Nobody waits for this write, so let the reader of the channel fail.
+		r.channel.Close()
+	}
+}
+
+// Flush writes the buffered data to the underlying I/O channel.
+func (r *Stream) Flush() error {
+	r.writeMutex.Lock()
+	defer r.writeMutex.Unlock()
+
+	return r.flush()
+}
+
+// XXX: Caller should lock the writeMutex
+func (r *Stream) flush() error {
+	if r.writeErr != nil {
+		return r.writeErr
+	}
+	if len(r.writeBuf) == 0 {
+		return nil
+	}
+
+	_, err := r.write(r.writeBuf)
+	// Do not keep the buffer grown by a burst.
+	if cap(r.writeBuf) > 4*r.flushThreshold {
+		r.writeBuf = nil
+	} else {
+		r.writeBuf = r.writeBuf[:0]
+	}
+	if err != nil {
+		r.writeErr = err
+	}
+
+	return err
+}
+
+// XXX: Caller should lock the writeMutex
+func (r *Stream) write(p []byte) (n int, err error) {
 	if r.writeTimeout > 0 {
 		d, ok := r.channel.(Deadline)
 		if ok {
@@ -121,10 +255,22 @@ func (r *Stream) Write(p []byte) (n int, err error) {
 		}
 	}
 
-	return r.channel.Write(p)
+	n, err = r.channel.Write(p)
+	if c := r.getCapture(); c != nil && n > 0 {
+		c.Sent(p[:n])
+	}
+
+	return n, err
 }
 
-// Close is a wrapper function of net.Conn.Close().
+// Close is a wrapper function of net.Conn.Close(), which writes the buffered data before closing.
 func (r *Stream) Close() error {
+	r.writeMutex.Lock()
+	if r.flushTimer != nil {
+		r.flushTimer.Stop()
+	}
+	r.flush()
+	r.writeMutex.Unlock()
+
 	return r.channel.Close()
 }
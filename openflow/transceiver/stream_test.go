@@ -0,0 +1,112 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package transceiver
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// channel records the writes.
+type channel struct {
+	mutex  sync.Mutex
+	writes [][]byte
+	err    error
+	closed bool
+}
+
+func (r *channel) Read(p []byte) (n int, err error) {
+	return 0, errors.New("not readable")
+}
+
+func (r *channel) Write(p []byte) (n int, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.writes = append(r.writes, append([]byte(nil), p...))
+
+	return len(p), nil
+}
+
+func (r *channel) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	return nil
+}
+
+func (r *channel) get() (writes [][]byte, closed bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.writes, r.closed
+}
+
+func TestStreamWriteBuffering(t *testing.T) {
+	c := new(channel)
+	s := NewStream(c)
+	s.SetWriteBuffering(50*time.Millisecond, 8)
+
+	// Buffered until the flush interval.
+	for _, v := range []string{"ab", "cd"} {
+		if _, err := s.Write([]byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if writes, _ := c.get(); len(writes) != 0 {
+		t.Fatalf("unexpected writes before the flush interval: %q", writes)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if writes, _ := c.get(); len(writes) != 1 || !bytes.Equal(writes[0], []byte("abcd")) {
+		t.Fatalf("unexpected writes after the flush interval: %q", writes)
+	}
+
+	// Written as soon as the threshold is reached.
+	if _, err := s.Write([]byte("012345678")); err != nil {
+		t.Fatal(err)
+	}
+	if writes, _ := c.get(); len(writes) != 2 || !bytes.Equal(writes[1], []byte("012345678")) {
+		t.Fatalf("unexpected writes after the threshold: %q", writes)
+	}
+
+	// The error of the delayed write closes the channel, and is returned by the next writes.
+	c.mutex.Lock()
+	c.err = errors.New("broken pipe")
+	c.mutex.Unlock()
+	if _, err := s.Write([]byte("ef")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, closed := c.get(); !closed {
+		t.Fatal("the channel is not closed by the failed write")
+	}
+	if _, err := s.Write([]byte("gh")); err == nil {
+		t.Fatal("expected the error of the failed write")
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"encoding"
 	"encoding/binary"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/superkkt/cherry/openflow"
@@ -64,6 +65,9 @@ type Transceiver struct {
 	factory     openflow.Factory
 	pingCounter uint
 	closed      bool
+	// rtt is the round trip time of the last echo in nanoseconds, which is
+	// accessed atomically.
+	rtt int64
 }
 
 type Handler interface {
@@ -75,7 +79,17 @@ type Handler interface {
 	OnPortDescReply(openflow.Factory, Writer, openflow.PortDescReply) error
 	OnPortStatus(openflow.Factory, Writer, openflow.PortStatus) error
 	OnFlowRemoved(openflow.Factory, Writer, openflow.FlowRemoved) error
+	OnFlowStatsReply(openflow.Factory, Writer, openflow.FlowStatsReply) error
+	OnPortStatsReply(openflow.Factory, Writer, openflow.PortStatsReply) error
 	OnPacketIn(openflow.Factory, Writer, openflow.PacketIn) error
+	OnRoleReply(openflow.Factory, Writer, openflow.RoleReply) error
+}
+
+// SentHandler is optionally implemented by a Handler to be notified of the
+// messages written to the stream, including the ones written by the handler
+// itself through the Writer passed to it.
+type SentHandler interface {
+	OnSent(msg encoding.BinaryMarshaler)
 }
 
 func NewTransceiver(stream *Stream, handler Handler) *Transceiver {
@@ -137,6 +151,32 @@ func (r *Transceiver) sendEchoRequest() error {
 	return nil
 }
 
+// Ping sends an echo request to the device at once without the write
+// buffering, and its reply updates RTT.
+func (r *Transceiver) Ping(f openflow.Factory) error {
+	echo, err := f.NewEchoRequest()
+	if err != nil {
+		return err
+	}
+	timestamp, err := time.Now().GobEncode()
+	if err != nil {
+		return err
+	}
+	echo.SetData(timestamp)
+
+	if err := r.Write(echo); err != nil {
+		return errors.Wrap(err, "failed to send ECHO_REQUEST message")
+	}
+
+	return r.stream.Flush()
+}
+
+// RTT returns the round trip time of the control channel measured by the last
+// echo, or zero if it has not been measured yet.
+func (r *Transceiver) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.rtt))
+}
+
 func (r *Transceiver) Run(ctx context.Context) error {
 	defer logger.Info("transceiver is closed")
 	r.stream.SetReadTimeout(readTimeout)
@@ -303,10 +343,52 @@ func (r *Transceiver) Write(msg encoding.BinaryMarshaler) error {
 	if err != nil {
 		return err
 	}
+	// The messages are marshaled into the pooled buffers.
+	defer openflow.ReleaseBuffer(packet)
 
 	if _, err := r.stream.Write(packet); err != nil {
 		return err
 	}
+	if v, ok := r.observer.(SentHandler); ok {
+		v.OnSent(msg)
+	}
+
+	return nil
+}
+
+// WriteBatch writes msgs at once, so that they are sent by a single system call
+// as long as the socket buffer has enough room.
+func (r *Transceiver) WriteBatch(msgs []encoding.BinaryMarshaler) error {
+	packets := make([][]byte, 0, len(msgs))
+	// The messages are marshaled into the pooled buffers.
+	defer func() {
+		for _, v := range packets {
+			openflow.ReleaseBuffer(v)
+		}
+	}()
+
+	length := 0
+	for _, msg := range msgs {
+		packet, err := msg.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		packets = append(packets, packet)
+		length += len(packet)
+	}
+
+	buf := make([]byte, 0, length)
+	for _, v := range packets {
+		buf = append(buf, v...)
+	}
+	if _, err := r.stream.Write(buf); err != nil {
+		return err
+	}
+	if v, ok := r.observer.(SentHandler); ok {
+		for _, msg := range msgs {
+			v.OnSent(msg)
+		}
+	}
 
 	return nil
 }
@@ -375,6 +457,10 @@ func (r *Transceiver) handleOF10Message(packet []byte) error {
 		switch binary.BigEndian.Uint16(packet[8:10]) {
 		case of10.OFPST_DESC:
 			return r.handleDescReply(packet)
+		case of10.OFPST_FLOW:
+			return r.handleFlowStatsReply(packet)
+		case of10.OFPST_PORT:
+			return r.handlePortStatsReply(packet)
 		default:
 			// Unsupported message. Do nothing.
 			return nil
@@ -407,6 +493,10 @@ func (r *Transceiver) handleOF13Message(packet []byte) error {
 			return r.handleDescReply(packet)
 		case of13.OFPMP_PORT_DESC:
 			return r.handlePortDescReply(packet)
+		case of13.OFPMP_FLOW:
+			return r.handleFlowStatsReply(packet)
+		case of13.OFPMP_PORT_STATS:
+			return r.handlePortStatsReply(packet)
 		default:
 			// Unsupported message. Do nothing.
 			return nil
@@ -417,6 +507,8 @@ func (r *Transceiver) handleOF13Message(packet []byte) error {
 		return r.handleFlowRemoved(packet)
 	case of13.OFPT_PACKET_IN:
 		return r.handlePacketIn(packet)
+	case of13.OFPT_ROLE_REPLY:
+		return r.handleRoleReply(packet)
 	default:
 		// Unsupported message. Do nothing.
 		return nil
@@ -461,7 +553,7 @@ func (r *Transceiver) handleEchoReply(packet []byte) error {
 	logger.Debug("received an ECHO_REPLY packet")
 
 	data := msg.Data()
-	if data == nil || len(data) != 8 {
+	if len(data) == 0 {
 		// I notice some broken switch sends an unexpected echo reply data.
 		// So, ignores the soft error to avoid switch disconnection.
 		logger.Debug("unexpected ECHO_REPLY data")
@@ -474,7 +566,9 @@ func (r *Transceiver) handleEchoReply(packet []byte) error {
 	}
 
 	// Network latency
-	logger.Debugf("transceiver latency: %v", time.Now().Sub(timestamp))
+	rtt := time.Now().Sub(timestamp)
+	logger.Debugf("transceiver latency: %v", rtt)
+	atomic.StoreInt64(&r.rtt, int64(rtt))
 	// Reset the ping counter
 	r.pingCounter = 0
 
@@ -577,6 +671,30 @@ func (r *Transceiver) handleFlowRemoved(packet []byte) error {
 	return r.observer.OnFlowRemoved(r.factory, r, msg)
 }
 
+func (r *Transceiver) handleFlowStatsReply(packet []byte) error {
+	msg, err := r.factory.NewFlowStatsReply()
+	if err != nil {
+		return err
+	}
+	if err := msg.UnmarshalBinary(packet); err != nil {
+		return err
+	}
+
+	return r.observer.OnFlowStatsReply(r.factory, r, msg)
+}
+
+func (r *Transceiver) handlePortStatsReply(packet []byte) error {
+	msg, err := r.factory.NewPortStatsReply()
+	if err != nil {
+		return err
+	}
+	if err := msg.UnmarshalBinary(packet); err != nil {
+		return err
+	}
+
+	return r.observer.OnPortStatsReply(r.factory, r, msg)
+}
+
 func (r *Transceiver) handlePacketIn(packet []byte) error {
 	msg, err := r.factory.NewPacketIn()
 	if err != nil {
@@ -589,6 +707,18 @@ func (r *Transceiver) handlePacketIn(packet []byte) error {
 	return r.observer.OnPacketIn(r.factory, r, msg)
 }
 
+func (r *Transceiver) handleRoleReply(packet []byte) error {
+	msg, err := r.factory.NewRoleReply()
+	if err != nil {
+		return err
+	}
+	if err := msg.UnmarshalBinary(packet); err != nil {
+		return err
+	}
+
+	return r.observer.OnRoleReply(r.factory, r, msg)
+}
+
 func (r *Transceiver) Close() error {
 	if r.closed {
 		return nil
@@ -0,0 +1,107 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"net"
+)
+
+const (
+	DHCPDiscover = 1
+	DHCPOffer    = 2
+	DHCPRequest  = 3
+	DHCPDecline  = 4
+	DHCPAck      = 5
+	DHCPNak      = 6
+	DHCPRelease  = 7
+	DHCPInform   = 8
+
+	dhcpOptPad           = 0
+	dhcpOptRequestedIP   = 50
+	dhcpOptMessageType   = 53
+	dhcpOptEnd           = 255
+	dhcpFixedFieldLength = 236
+)
+
+var dhcpMagicCookie = []byte{0x63, 0x82, 0x53, 0x63}
+
+// DHCP is a DHCP message (RFC 2131). Only the fields used by the controller are decoded.
+type DHCP struct {
+	Op          uint8
+	ClientIP    net.IP // ciaddr
+	YourIP      net.IP // yiaddr
+	ClientMAC   net.HardwareAddr
+	MessageType uint8
+	// Value of the requested IP address option. It is nil if the option does not exist.
+	RequestedIP net.IP
+}
+
+func (r *DHCP) UnmarshalBinary(data []byte) error {
+	if len(data) < dhcpFixedFieldLength+len(dhcpMagicCookie) {
+		return errors.New("invalid DHCP packet length")
+	}
+	// Ethernet?
+	if data[1] != 1 || data[2] != 6 {
+		return errors.New("unsupported DHCP hardware type")
+	}
+	if !bytes.Equal(data[dhcpFixedFieldLength:dhcpFixedFieldLength+4], dhcpMagicCookie) {
+		return errors.New("invalid DHCP magic cookie")
+	}
+
+	r.Op = data[0]
+	r.ClientIP = net.IP(data[12:16])
+	r.YourIP = net.IP(data[16:20])
+	r.ClientMAC = net.HardwareAddr(data[28:34])
+	r.MessageType = 0
+	r.RequestedIP = nil
+
+	options := data[dhcpFixedFieldLength+4:]
+	for len(options) > 0 {
+		code := options[0]
+		if code == dhcpOptEnd {
+			break
+		}
+		if code == dhcpOptPad {
+			options = options[1:]
+			continue
+		}
+		if len(options) < 2 || len(options) < 2+int(options[1]) {
+			return errors.New("invalid DHCP option length")
+		}
+		value := options[2 : 2+int(options[1])]
+		switch code {
+		case dhcpOptMessageType:
+			if len(value) == 1 {
+				r.MessageType = value[0]
+			}
+		case dhcpOptRequestedIP:
+			if len(value) == 4 {
+				r.RequestedIP = net.IP(value)
+			}
+		}
+		options = options[2+len(value):]
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	EAPOLPacket = 0
+	EAPOLStart  = 1
+	EAPOLLogoff = 2
+)
+
+// EAPOL represents an IEEE 802.1X EAP over LAN frame.
+type EAPOL struct {
+	Version uint8
+	Type    uint8
+	Body    []byte
+}
+
+func NewEAPOL(t uint8, body []byte) *EAPOL {
+	return &EAPOL{
+		Version: 2, // 802.1X-2004
+		Type:    t,
+		Body:    body,
+	}
+}
+
+func (r EAPOL) String() string {
+	return fmt.Sprintf("Version=%v, Type=%v, BodyLength=%v", r.Version, r.Type, len(r.Body))
+}
+
+func (r EAPOL) MarshalBinary() ([]byte, error) {
+	if len(r.Body) > 0xFFFF {
+		return nil, errors.New("too long EAPOL body")
+	}
+
+	v := make([]byte, 4+len(r.Body))
+	v[0] = r.Version
+	v[1] = r.Type
+	binary.BigEndian.PutUint16(v[2:4], uint16(len(r.Body)))
+	copy(v[4:], r.Body)
+
+	return v, nil
+}
+
+func (r *EAPOL) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("invalid EAPOL packet length")
+	}
+
+	r.Version = data[0]
+	r.Type = data[1]
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if len(data) < 4+length {
+		return errors.New("invalid EAPOL body length")
+	}
+	r.Body = data[4 : 4+length]
+
+	return nil
+}
+
+const (
+	EAPRequest  = 1
+	EAPResponse = 2
+	EAPSuccess  = 3
+	EAPFailure  = 4
+)
+
+// EAP represents an Extensible Authentication Protocol packet (RFC 3748).
+type EAP struct {
+	Code       uint8
+	Identifier uint8
+	// Type and Data are only meaningful for the request and response packets.
+	Type uint8
+	Data []byte
+}
+
+func (r EAP) String() string {
+	return fmt.Sprintf("Code=%v, Identifier=%v, Type=%v, DataLength=%v", r.Code, r.Identifier, r.Type, len(r.Data))
+}
+
+func (r EAP) MarshalBinary() ([]byte, error) {
+	length := 4
+	if r.Code == EAPRequest || r.Code == EAPResponse {
+		length += 1 + len(r.Data)
+	}
+	if length > 0xFFFF {
+		return nil, errors.New("too long EAP data")
+	}
+
+	v := make([]byte, length)
+	v[0] = r.Code
+	v[1] = r.Identifier
+	binary.BigEndian.PutUint16(v[2:4], uint16(length))
+	if length > 4 {
+		v[4] = r.Type
+		copy(v[5:], r.Data)
+	}
+
+	return v, nil
+}
+
+func (r *EAP) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("invalid EAP packet length")
+	}
+
+	r.Code = data[0]
+	r.Identifier = data[1]
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < 4 || len(data) < length {
+		return errors.New("invalid EAP length field")
+	}
+	r.Type = 0
+	r.Data = nil
+	if (r.Code == EAPRequest || r.Code == EAPResponse) && length > 4 {
+		r.Type = data[4]
+		r.Data = data[5:length]
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package protocol
+
+import (
+	"net"
+	"testing"
+)
+
+// BenchmarkARP measures parsing an ARP request in a PACKET_IN, which is the
+// most common packet sent to the controller.
+func BenchmarkARP(b *testing.B) {
+	sha, _ := net.ParseMAC("00:11:22:33:44:55")
+	arp, err := NewARPRequest(sha, net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	frame, err := Ethernet{SrcMAC: sha, DstMAC: net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, Type: 0x0806, Payload: arp}.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		eth := new(Ethernet)
+		if err := eth.UnmarshalBinary(frame); err != nil {
+			b.Fatal(err)
+		}
+		if err := new(ARP).UnmarshalBinary(eth.Payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+const (
+	ICMPv6NeighborSolicitation  = 135
+	ICMPv6NeighborAdvertisement = 136
+
+	// Flags of the neighbor advertisement.
+	NDFlagRouter    = 0x80
+	NDFlagSolicited = 0x40
+	NDFlagOverride  = 0x20
+
+	// Neighbor discovery option types.
+	ndOptSourceLinkAddr = 1
+	ndOptTargetLinkAddr = 2
+)
+
+// NeighborDiscovery is an ICMPv6 neighbor solicitation or advertisement message (RFC 4861).
+type NeighborDiscovery struct {
+	srcIP    net.IP
+	dstIP    net.IP
+	Type     uint8
+	Code     uint8
+	Checksum uint16
+	Flags    uint8 // Neighbor advertisement only.
+	Target   net.IP
+	// Source link-layer address of the solicitation, or the target link-layer
+	// address of the advertisement. It can be nil.
+	LinkAddr net.HardwareAddr
+}
+
+func NewNeighborSolicitation(target net.IP, sha net.HardwareAddr) *NeighborDiscovery {
+	return &NeighborDiscovery{
+		Type:     ICMPv6NeighborSolicitation,
+		Target:   target,
+		LinkAddr: sha,
+	}
+}
+
+func NewNeighborAdvertisement(target net.IP, tha net.HardwareAddr, flags uint8) *NeighborDiscovery {
+	return &NeighborDiscovery{
+		Type:     ICMPv6NeighborAdvertisement,
+		Flags:    flags,
+		Target:   target,
+		LinkAddr: tha,
+	}
+}
+
+// ICMPv6 checksum needs a pseudo header that has src and dst IPv6 addresses.
+func (r *NeighborDiscovery) SetPseudoHeader(src, dst net.IP) {
+	r.srcIP = src
+	r.dstIP = dst
+}
+
+func (r NeighborDiscovery) MarshalBinary() ([]byte, error) {
+	if r.Type != ICMPv6NeighborSolicitation && r.Type != ICMPv6NeighborAdvertisement {
+		return nil, errors.New("invalid neighbor discovery message type")
+	}
+	target := r.Target.To16()
+	if target == nil || r.Target.To4() != nil {
+		return nil, errors.New("target address is not an IPv6 address")
+	}
+
+	v := make([]byte, 24)
+	v[0] = r.Type
+	v[1] = r.Code
+	// v[2:4] is checksum
+	if r.Type == ICMPv6NeighborAdvertisement {
+		v[4] = r.Flags
+	}
+	copy(v[8:24], target)
+	if r.LinkAddr != nil {
+		if len(r.LinkAddr) != 6 {
+			return nil, errors.New("invalid link-layer address")
+		}
+		opt := ndOptSourceLinkAddr
+		if r.Type == ICMPv6NeighborAdvertisement {
+			opt = ndOptTargetLinkAddr
+		}
+		// Length is in units of 8 octets.
+		v = append(v, byte(opt), 1)
+		v = append(v, r.LinkAddr...)
+	}
+
+	if r.srcIP == nil || r.dstIP == nil {
+		return nil, errors.New("nil pseudo IP addresses")
+	}
+	pseudo := make([]byte, 40)
+	copy(pseudo[0:16], r.srcIP.To16())
+	copy(pseudo[16:32], r.dstIP.To16())
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(v)))
+	pseudo[39] = 58 // ICMPv6
+
+	checksum := calculateChecksum(append(pseudo, v...))
+	binary.BigEndian.PutUint16(v[2:4], checksum)
+
+	return v, nil
+}
+
+func (r *NeighborDiscovery) UnmarshalBinary(data []byte) error {
+	if len(data) < 24 {
+		return errors.New("invalid neighbor discovery message length")
+	}
+	if data[0] != ICMPv6NeighborSolicitation && data[0] != ICMPv6NeighborAdvertisement {
+		return errors.New("packet is not a neighbor discovery message")
+	}
+
+	r.Type = data[0]
+	r.Code = data[1]
+	r.Checksum = binary.BigEndian.Uint16(data[2:4])
+	r.Flags = 0
+	if r.Type == ICMPv6NeighborAdvertisement {
+		r.Flags = data[4]
+	}
+	r.Target = data[8:24]
+	r.LinkAddr = nil
+
+	options := data[24:]
+	for len(options) >= 2 {
+		length := int(options[1]) * 8
+		if length == 0 || len(options) < length {
+			return errors.New("invalid neighbor discovery option length")
+		}
+		if (options[0] == ndOptSourceLinkAddr || options[0] == ndOptTargetLinkAddr) && length >= 8 {
+			r.LinkAddr = net.HardwareAddr(options[2:8])
+		}
+		options = options[length:]
+	}
+
+	return nil
+}
+
+// SolicitedNodeAddress returns the solicited-node multicast address of ip, and its multicast MAC address.
+func SolicitedNodeAddress(ip net.IP) (net.IP, net.HardwareAddr) {
+	v := ip.To16()
+	addr := net.IP{0xFF, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0xFF, v[13], v[14], v[15]}
+	mac := net.HardwareAddr{0x33, 0x33, addr[12], addr[13], addr[14], addr[15]}
+
+	return addr, mac
+}
+
+// LinkLocalAddress returns the IPv6 link-local address made from mac using the modified EUI-64.
+func LinkLocalAddress(mac net.HardwareAddr) net.IP {
+	return net.IP{0xFE, 0x80, 0, 0, 0, 0, 0, 0, mac[0] ^ 0x02, mac[1], mac[2], 0xFF, 0xFE, mac[3], mac[4], mac[5]}
+}
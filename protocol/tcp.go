@@ -101,7 +101,7 @@ func (r *TCP) UnmarshalBinary(data []byte) error {
 	r.Sequence = binary.BigEndian.Uint32(data[4:8])
 	r.Acknowledgment = binary.BigEndian.Uint32(data[8:12])
 	offset := int((data[12] >> 4)) * 4
-	r.Flags = uint16((data[12]&0x1)<<8 | data[13])
+	r.Flags = uint16(data[12]&0x1)<<8 | uint16(data[13])
 	r.WindowSize = binary.BigEndian.Uint16(data[14:16])
 	r.Checksum = binary.BigEndian.Uint16(data[16:18])
 	r.Urgent = binary.BigEndian.Uint16(data[18:20])
@@ -0,0 +1,242 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package rbac authenticates the clients of the management APIs, which are the
+// REST and gRPC APIs, and authorizes their requests by the roles. A client is
+// identified by its bearer token or the common name of its TLS certificate.
+package rbac
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+)
+
+// Role is the permission of a client. A higher role is allowed everything
+// that the lower ones are allowed.
+type Role int
+
+const (
+	// RoleNone is allowed nothing. It is also the required role of the public resources.
+	RoleNone Role = iota
+	// RoleReader is allowed to read the state of the controller and the network.
+	RoleReader
+	// RoleOperator is also allowed to change the hosts, the flows and the ACLs.
+	RoleOperator
+	// RoleAdmin is also allowed to change the switches, the networks and the controller itself.
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleNone:
+		return "none"
+	case RoleReader:
+		return "reader"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+// ParseRole returns the role whose name is s: reader, operator or admin.
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "reader":
+		return RoleReader, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role: %v", s)
+	}
+}
+
+var (
+	// ErrUnauthenticated is returned when the client presents no valid credential.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden is returned when the role of the client is lower than the required one.
+	ErrForbidden = errors.New("permission denied")
+)
+
+// Identity is an authenticated client.
+type Identity struct {
+	Name string
+	Role Role
+}
+
+// Anonymous is the identity of all the clients if the authentication is disabled.
+var Anonymous = Identity{Name: "anonymous", Role: RoleAdmin}
+
+// Policy is the credentials of the clients and their roles.
+type Policy struct {
+	tokens    map[string]Identity // Keys are the tokens.
+	clients   map[string]Identity // Keys are the common names of the client certificates.
+	clientCAs *x509.CertPool
+}
+
+// NewPolicy returns a policy from tokens and clients separated by semicolon.
+// Each token is its name, the secret token and the role separated by comma,
+// e.g., "noc,Zm9vYmFy,reader". Each client is the common name of its
+// certificate and the role, e.g., "ops.example.com,operator". caFile is the PEM
+// file of the CAs that verify the client certificates, which is required if
+// there is a client. The authentication is disabled if both are empty.
+func NewPolicy(tokens, clients, caFile string) (*Policy, error) {
+	v := &Policy{
+		tokens:  make(map[string]Identity),
+		clients: make(map[string]Identity),
+	}
+
+	for _, token := range split(tokens) {
+		t := strings.Split(token, ",")
+		if len(t) != 3 || strings.TrimSpace(t[0]) == "" || strings.TrimSpace(t[1]) == "" {
+			// Not to show the secret token in the error message.
+			return nil, errors.New("invalid token: expected name,token,role")
+		}
+		role, err := ParseRole(t[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %v: %v", strings.TrimSpace(t[0]), err)
+		}
+		v.tokens[strings.TrimSpace(t[1])] = Identity{Name: strings.TrimSpace(t[0]), Role: role}
+	}
+
+	for _, client := range split(clients) {
+		t := strings.Split(client, ",")
+		if len(t) != 2 || strings.TrimSpace(t[0]) == "" {
+			return nil, fmt.Errorf("invalid client: %v: expected name,role", client)
+		}
+		role, err := ParseRole(t[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid client %v: %v", strings.TrimSpace(t[0]), err)
+		}
+		name := strings.TrimSpace(t[0])
+		v.clients[name] = Identity{Name: name, Role: role}
+	}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		v.clientCAs = x509.NewCertPool()
+		if !v.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %v", caFile)
+		}
+	}
+	if len(v.clients) > 0 && v.clientCAs == nil {
+		return nil, errors.New("CA file is required to verify the client certificates")
+	}
+
+	return v, nil
+}
+
+func split(s string) []string {
+	result := []string{}
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// Enabled returns whether the clients should be authenticated.
+func (r *Policy) Enabled() bool {
+	return len(r.tokens) > 0 || len(r.clients) > 0
+}
+
+// ClientCAs returns the CAs that verify the client certificates, or nil if the
+// client certificates are not used.
+func (r *Policy) ClientCAs() *x509.CertPool {
+	return r.clientCAs
+}
+
+// Authorize authenticates the client that presents token, which can be empty,
+// over the TLS connection whose state is state, which can be nil. It returns
+// ErrUnauthenticated or ErrForbidden if the client does not have the required role.
+func (r *Policy) Authorize(token string, state *tls.ConnectionState, required Role) (Identity, error) {
+	if !r.Enabled() {
+		return Anonymous, nil
+	}
+
+	id, ok := r.authenticate(token, state)
+	if !ok {
+		if required == RoleNone {
+			return Identity{}, nil
+		}
+		return Identity{}, ErrUnauthenticated
+	}
+	if id.Role < required {
+		return id, ErrForbidden
+	}
+
+	return id, nil
+}
+
+func (r *Policy) authenticate(token string, state *tls.ConnectionState) (Identity, bool) {
+	if token != "" {
+		// Compares all the tokens in constant time not to leak them by the timing.
+		var result Identity
+		found := false
+		for k, v := range r.tokens {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(token)) == 1 {
+				result, found = v, true
+			}
+		}
+		return result, found
+	}
+
+	// Only the certificates verified by the client CAs are trusted.
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return Identity{}, false
+	}
+	id, ok := r.clients[state.PeerCertificates[0].Subject.CommonName]
+
+	return id, ok
+}
+
+var current atomic.Value
+
+// SetPolicy replaces the current policy with p.
+func SetPolicy(p *Policy) {
+	current.Store(p)
+}
+
+// Current returns the current policy. The authentication is disabled until a
+// policy is set.
+func Current() *Policy {
+	p, ok := current.Load().(*Policy)
+	if !ok {
+		return &Policy{}
+	}
+
+	return p
+}
@@ -0,0 +1,73 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package rbac
+
+import (
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	p, err := NewPolicy("noc, s3cret, reader; ops,t0ken,operator", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Authorize("", nil, RoleReader); err != ErrUnauthenticated {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+	if _, err := p.Authorize("wrong", nil, RoleReader); err != ErrUnauthenticated {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+	if id, err := p.Authorize("s3cret", nil, RoleReader); err != nil || id.Name != "noc" {
+		t.Fatalf("unexpected result: id=%+v, err=%v", id, err)
+	}
+	if _, err := p.Authorize("s3cret", nil, RoleOperator); err != ErrForbidden {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	if _, err := p.Authorize("t0ken", nil, RoleAdmin); err != ErrForbidden {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	if _, err := p.Authorize("", nil, RoleNone); err != nil {
+		t.Fatalf("public resource is denied: %v", err)
+	}
+
+	open, err := NewPolicy("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := open.Authorize("", nil, RoleAdmin); err != nil || id != Anonymous {
+		t.Fatalf("unexpected result of the disabled authentication: id=%+v, err=%v", id, err)
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	invalid := [][2]string{
+		{"noc,s3cret", ""},
+		{"noc,s3cret,root", ""},
+		{"", "ops.example.com,operator"}, // No CA file.
+	}
+	for _, v := range invalid {
+		if _, err := NewPolicy(v[0], v[1], ""); err == nil {
+			t.Fatalf("expected an error: tokens=%q, clients=%q", v[0], v[1])
+		}
+	}
+}
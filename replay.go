@@ -0,0 +1,170 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/openflow/emulator"
+)
+
+// replay connects the emulated switches of the topology recorded in file to the
+// controller listening on port, and then feeds the recorded PACKET_INs to the
+// controller in order through the switches. speed scales the intervals between
+// the PACKET_INs, and zero replays them without any delay. It returns the exit
+// status of the program.
+func replay(ctx context.Context, port int, file string, speed float64, finder network.Finder) int {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return 1
+	}
+	topology, records, err := network.ReadPacketInRecords(f)
+	f.Close()
+	if err != nil {
+		fmt.Printf("FAIL: failed to read %v: %v\n", file, err)
+		return 1
+	}
+
+	switches := make(map[uint64]*emulator.Switch)
+	for _, v := range topology.Devices {
+		// The ports of the emulated switch are numbered from 1.
+		ports := uint32(1)
+		for _, p := range v.Ports {
+			if p > ports {
+				ports = p
+			}
+		}
+		sw, err := emulator.New(emulator.Config{DPID: v.DPID, Version: v.Version, Ports: ports})
+		if err != nil {
+			fmt.Printf("FAIL: failed to create the emulated switch %v: %v\n", v.DPID, err)
+			return 1
+		}
+		switches[v.DPID] = sw
+	}
+	for _, v := range topology.Links {
+		a, aPort, err := parsePortID(v.Ports[0], switches)
+		if err != nil {
+			fmt.Printf("FAIL: invalid link: %v\n", err)
+			return 1
+		}
+		b, bPort, err := parsePortID(v.Ports[1], switches)
+		if err != nil {
+			fmt.Printf("FAIL: invalid link: %v\n", err)
+			return 1
+		}
+		emulator.Link(a, aPort, b, bPort)
+	}
+
+	if !waitFor("listening on the OpenFlow port", func() bool { return atomic.LoadInt32(&listening) == 1 }) {
+		return 1
+	}
+	addr := fmt.Sprintf("127.0.0.1:%v", port)
+	for _, v := range topology.Devices {
+		go connectSwitch(ctx, switches[v.DPID], addr)
+	}
+	for _, v := range topology.Devices {
+		sw := switches[v.DPID]
+		ready := func() bool {
+			select {
+			case <-sw.Ready():
+				return true
+			default:
+				return false
+			}
+		}
+		if !waitFor(fmt.Sprintf("handshake with switch %v", sw.DPID()), ready) {
+			return 1
+		}
+	}
+	if !waitFor("discovering the links", func() bool { return len(finder.Links()) == len(topology.Links) }) {
+		return 1
+	}
+
+	fmt.Printf("replaying %v PACKET_INs\n", len(records))
+	for i, v := range records {
+		if i > 0 && speed > 0 {
+			time.Sleep(time.Duration(float64(v.Time.Sub(records[i-1].Time)) / speed))
+		}
+		sw, ok := switches[v.DPID]
+		if !ok {
+			fmt.Printf("FAIL: PACKET_IN %v: unknown switch %v\n", i+1, v.DPID)
+			return 1
+		}
+		// Already validated by ReadPacketInRecords.
+		frame, _ := hex.DecodeString(v.Frame)
+		if err := sw.InjectPacketIn(v.Port, frame); err != nil {
+			fmt.Printf("FAIL: PACKET_IN %v: %v\n", i+1, err)
+			return 1
+		}
+	}
+	// Let the controller finish the last PACKET_INs.
+	time.Sleep(time.Second)
+
+	for _, v := range topology.Devices {
+		sw := switches[v.DPID]
+		outs := 0
+		for _, p := range sw.PacketOuts() {
+			if !isLLDP(p.Data) {
+				outs++
+			}
+		}
+		fmt.Printf("switch %v: %v flows, %v PACKET_OUTs except LLDP\n", v.DPID, len(sw.Flows()), outs)
+	}
+	fmt.Println("DONE")
+
+	return 0
+}
+
+// parsePortID returns the switch and the port number of id, e.g., "1:3".
+func parsePortID(id string, switches map[uint64]*emulator.Switch) (*emulator.Switch, uint32, error) {
+	v := strings.SplitN(id, ":", 2)
+	if len(v) != 2 {
+		return nil, 0, fmt.Errorf("invalid port: %v", id)
+	}
+	dpid, err := strconv.ParseUint(v[0], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port: %v", id)
+	}
+	port, err := strconv.ParseUint(v[1], 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port: %v", id)
+	}
+	sw, ok := switches[dpid]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown switch: %v", id)
+	}
+
+	return sw, uint32(port), nil
+}
+
+func isLLDP(frame []byte) bool {
+	return len(frame) >= 14 && frame[12] == 0x88 && frame[13] == 0xCC
+}
@@ -0,0 +1,136 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/emulator"
+)
+
+const selfTestTimeout = 30 * time.Second
+
+// freePort returns a TCP port that is not used now, so that the self test does
+// not conflict with the controller already running on the same host.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// selfTest connects the emulated switches to the controller listening on
+// port, and then checks that the controller initializes them and discovers
+// the links among them. It returns the exit status of the program.
+func selfTest(ctx context.Context, port int, finder network.Finder) int {
+	// Two OpenFlow 1.3 switches and an OpenFlow 1.0 switch in a line:
+	// s1:1 - s2:1, s2:2 - s3:1.
+	configs := []emulator.Config{
+		{DPID: 1, Version: openflow.OF13_VERSION, Ports: 4},
+		{DPID: 2, Version: openflow.OF13_VERSION, Ports: 4},
+		{DPID: 3, Version: openflow.OF10_VERSION, Ports: 4},
+	}
+	switches := make([]*emulator.Switch, len(configs))
+	for i, v := range configs {
+		sw, err := emulator.New(v)
+		if err != nil {
+			fmt.Printf("FAIL: failed to create the emulated switch: %v\n", err)
+			return 1
+		}
+		switches[i] = sw
+	}
+	emulator.Link(switches[0], 1, switches[1], 1)
+	emulator.Link(switches[1], 2, switches[2], 1)
+
+	if !waitFor("listening on the OpenFlow port", func() bool { return atomic.LoadInt32(&listening) == 1 }) {
+		return 1
+	}
+	addr := fmt.Sprintf("127.0.0.1:%v", port)
+	for _, v := range switches {
+		go connectSwitch(ctx, v, addr)
+	}
+
+	for _, v := range switches {
+		sw := v
+		ready := func() bool {
+			select {
+			case <-sw.Ready():
+				return true
+			default:
+				return false
+			}
+		}
+		if !waitFor(fmt.Sprintf("handshake with switch %v", sw.DPID()), ready) {
+			return 1
+		}
+		if !waitFor(fmt.Sprintf("flows installed on switch %v", sw.DPID()), func() bool { return len(sw.Flows()) > 0 }) {
+			return 1
+		}
+	}
+	if !waitFor("discovering the links", func() bool { return len(finder.Links()) == 2 }) {
+		return 1
+	}
+	if !waitFor("path from switch 1 to switch 3", func() bool { return len(finder.Path("1", "3")) == 2 }) {
+		return 1
+	}
+
+	fmt.Println("PASS")
+	return 0
+}
+
+// connectSwitch connects sw to the controller at addr until ctx is done. It
+// reconnects as a real switch does, because the controller disconnects the
+// OpenFlow 1.0 switch until it becomes the master.
+func connectSwitch(ctx context.Context, sw *emulator.Switch, addr string) {
+	for {
+		err := sw.Dial(ctx, addr)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Infof("emulated switch (DPID=%v) has been disconnected: %v", sw.DPID(), err)
+		time.Sleep(time.Second)
+	}
+}
+
+// waitFor waits until cond is satisfied, and then reports the result.
+func waitFor(name string, cond func() bool) bool {
+	deadline := time.Now().Add(selfTestTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			fmt.Printf("FAIL: %v\n", name)
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Printf("ok: %v\n", name)
+
+	return true
+}
@@ -0,0 +1,431 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/database"
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/emulator"
+	"github.com/superkkt/cherry/protocol"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The simulation runs the controller with the emulated switches of a synthetic
+// topology, and the emulated hosts connected to them send the synthetic traffic
+// to each other, so that the whole processor chain works without any real
+// switch, e.g., for the development and the demos.
+
+const (
+	defaultTrafficInterval = time.Second
+	defaultTrafficPackets  = 3
+	// Long running simulation should not remember all the PACKET_OUTs.
+	simulatedPacketOuts     = 1000
+	simulationStatsInterval = time.Minute
+)
+
+// simulation is the topology file of -simulate.
+type simulation struct {
+	Switches []simulatedSwitch `yaml:"switches"`
+	// Links are the pairs of the ports, e.g., ["1:1", "2:1"].
+	Links [][]string `yaml:"links"`
+	// Networks are the IPv4 networks of the hosts in CIDR, e.g., 10.0.0.0/24,
+	// which are registered to the database with the switches and the hosts.
+	Networks []string         `yaml:"networks"`
+	Hosts    []*simulatedHost `yaml:"hosts"`
+	Traffic  struct {
+		// Milliseconds between the flows of the traffic, each of which is
+		// between two random hosts. Default is 1000.
+		Interval int `yaml:"interval"`
+		// Number of the UDP packets of a flow. Default is 3.
+		Packets int `yaml:"packets"`
+	} `yaml:"traffic"`
+
+	switches map[uint64]*emulator.Switch
+	links    [][2]string
+}
+
+type simulatedSwitch struct {
+	DPID uint64 `yaml:"dpid"`
+	// Name is the optional alias of the switch.
+	Name string `yaml:"name"`
+	// OpenFlow version, either 1.0 or 1.3. Default is 1.3.
+	Version string `yaml:"version"`
+	Ports   uint32 `yaml:"ports"`
+}
+
+type simulatedHost struct {
+	Name string `yaml:"name"`
+	MAC  string `yaml:"mac"`
+	IP   string `yaml:"ip"`
+	// Port of the switch that the host is connected to, e.g., "1:3".
+	Port string `yaml:"port"`
+
+	mac      net.HardwareAddr
+	ip       net.IP
+	sw       *emulator.Switch
+	port     uint32
+	received uint64
+}
+
+// readSimulation reads the topology file, and then creates its emulated
+// switches and hosts, which are not connected to the controller yet.
+func readSimulation(file string) (*simulation, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	v := new(simulation)
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	if err := v.build(); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (r *simulation) build() error {
+	if len(r.Switches) == 0 {
+		return errors.New("no switch")
+	}
+	r.switches = make(map[uint64]*emulator.Switch)
+	for _, v := range r.Switches {
+		if v.DPID == 0 {
+			return errors.New("switch without DPID")
+		}
+		if _, ok := r.switches[v.DPID]; ok {
+			return fmt.Errorf("duplicated switch: %v", v.DPID)
+		}
+		if _, err := strconv.ParseUint(v.Name, 10, 64); err == nil {
+			return fmt.Errorf("switch %v: number as the name: %v", v.DPID, v.Name)
+		}
+		version := uint8(openflow.OF13_VERSION)
+		switch v.Version {
+		case "", "1.3":
+		case "1.0":
+			version = openflow.OF10_VERSION
+		default:
+			return fmt.Errorf("switch %v: unsupported OpenFlow version: %v", v.DPID, v.Version)
+		}
+		sw, err := emulator.New(emulator.Config{DPID: v.DPID, Version: version, Ports: v.Ports, MaxPacketOuts: simulatedPacketOuts})
+		if err != nil {
+			return fmt.Errorf("switch %v: %v", v.DPID, err)
+		}
+		r.switches[v.DPID] = sw
+	}
+
+	used := make(map[string]bool)
+	use := func(id string) (*emulator.Switch, uint32, error) {
+		sw, port, err := parsePortID(id, r.switches)
+		if err != nil {
+			return nil, 0, err
+		}
+		id = fmt.Sprintf("%v:%v", sw.DPID(), port)
+		if used[id] {
+			return nil, 0, fmt.Errorf("port is used twice: %v", id)
+		}
+		used[id] = true
+
+		return sw, port, nil
+	}
+	for _, v := range r.Links {
+		if len(v) != 2 {
+			return fmt.Errorf("invalid link: %v", v)
+		}
+		a, aPort, err := use(v[0])
+		if err != nil {
+			return fmt.Errorf("invalid link: %v", err)
+		}
+		b, bPort, err := use(v[1])
+		if err != nil {
+			return fmt.Errorf("invalid link: %v", err)
+		}
+		emulator.Link(a, aPort, b, bPort)
+		r.links = append(r.links, [2]string{v[0], v[1]})
+	}
+
+	networks := []*net.IPNet{}
+	for _, v := range r.Networks {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil || n.IP.To4() == nil {
+			return fmt.Errorf("invalid network: %v", v)
+		}
+		networks = append(networks, n)
+	}
+	macs := make(map[string]bool)
+	ips := make(map[string]bool)
+	for _, v := range r.Hosts {
+		var err error
+		if v.mac, err = net.ParseMAC(v.MAC); err != nil {
+			return fmt.Errorf("host %v: invalid MAC address: %v", v.Name, v.MAC)
+		}
+		if v.ip = net.ParseIP(v.IP).To4(); v.ip == nil {
+			return fmt.Errorf("host %v: invalid IPv4 address: %v", v.Name, v.IP)
+		}
+		if macs[v.mac.String()] || ips[v.ip.String()] {
+			return fmt.Errorf("host %v: duplicated address: %v, %v", v.Name, v.MAC, v.IP)
+		}
+		macs[v.mac.String()], ips[v.ip.String()] = true, true
+		if !contains(networks, v.ip) {
+			return fmt.Errorf("host %v: %v is not in the networks", v.Name, v.IP)
+		}
+		if v.sw, v.port, err = use(v.Port); err != nil {
+			return fmt.Errorf("host %v: %v", v.Name, err)
+		}
+		h := v
+		v.sw.Attach(v.port, func(data []byte) { r.receive(h, data) })
+	}
+
+	if r.Traffic.Interval < 0 || r.Traffic.Packets < 0 {
+		return errors.New("invalid traffic")
+	}
+	if r.Traffic.Interval == 0 {
+		r.Traffic.Interval = int(defaultTrafficInterval / time.Millisecond)
+	}
+	if r.Traffic.Packets == 0 {
+		r.Traffic.Packets = defaultTrafficPackets
+	}
+
+	return nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, v := range networks {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// register adds the switches, the networks and the hosts of the simulation to
+// the empty database, so that the hosts are discovered by the applications.
+func (r *simulation) register(db database.Database) error {
+	for _, v := range r.Switches {
+		sw := network.SwitchParam{
+			DPID:             v.DPID,
+			NumPorts:         uint16(v.Ports),
+			FirstPort:        1,
+			FirstPrintedPort: 1,
+			Description:      v.Name,
+		}
+		if _, err := db.AddSwitch(sw); err != nil {
+			return fmt.Errorf("switch %v: %v", v.DPID, err)
+		}
+		if v.Name == "" {
+			continue
+		}
+		if err := db.SetSwitchAlias(network.SwitchAlias{DPID: v.DPID, Name: v.Name}); err != nil {
+			return fmt.Errorf("switch %v: %v", v.DPID, err)
+		}
+	}
+
+	// IDs of the IP addresses. Key = address.
+	addrs := make(map[string]uint64)
+	for _, v := range r.Networks {
+		_, n, _ := net.ParseCIDR(v)
+		id, err := db.AddNetwork(n.IP, n.Mask)
+		if err != nil {
+			return fmt.Errorf("network %v: %v", v, err)
+		}
+		ips, err := db.IPAddrs(id)
+		if err != nil {
+			return fmt.Errorf("network %v: %v", v, err)
+		}
+		for _, ip := range ips {
+			addrs[ip.Address] = ip.ID
+		}
+	}
+	for _, v := range r.Hosts {
+		id, ok := addrs[v.ip.String()]
+		if !ok {
+			// The network or the broadcast address.
+			return fmt.Errorf("host %v: unavailable IP address: %v", v.Name, v.IP)
+		}
+		if _, err := db.AddHost(network.HostParam{IPID: id, MAC: v.mac.String(), Description: v.Name}); err != nil {
+			return fmt.Errorf("host %v: %v", v.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// run connects the emulated switches to the controller listening on port, and
+// then sends the traffic of the hosts until ctx is done.
+func (r *simulation) run(ctx context.Context, port int, finder network.Finder) error {
+	if !waitFor("listening on the OpenFlow port", func() bool { return atomic.LoadInt32(&listening) == 1 }) {
+		return errors.New("controller is not listening")
+	}
+	addr := fmt.Sprintf("127.0.0.1:%v", port)
+	for _, sw := range r.switches {
+		go connectSwitch(ctx, sw, addr)
+	}
+	for _, v := range r.switches {
+		sw := v
+		ready := func() bool {
+			select {
+			case <-sw.Ready():
+				return true
+			default:
+				return false
+			}
+		}
+		if !waitFor(fmt.Sprintf("handshake with switch %v", sw.DPID()), ready) {
+			return fmt.Errorf("switch %v is not connected", sw.DPID())
+		}
+	}
+	if !waitFor("discovering the links", func() bool { return len(finder.Links()) == len(r.links) }) {
+		return errors.New("links are not discovered")
+	}
+	logger.Infof("simulating %v switches, %v links and %v hosts", len(r.switches), len(r.links), len(r.Hosts))
+
+	// The hosts announce themselves as they are connected.
+	for _, v := range r.Hosts {
+		r.send(v, protocol.NewARPRequest(v.mac, v.ip, v.ip), 0x0806, broadcastMAC)
+	}
+	if len(r.Hosts) < 2 {
+		<-ctx.Done()
+		return nil
+	}
+
+	traffic := time.NewTicker(time.Duration(r.Traffic.Interval) * time.Millisecond)
+	defer traffic.Stop()
+	stats := time.NewTicker(simulationStatsInterval)
+	defer stats.Stop()
+	var sent uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-traffic.C:
+			sent += r.sendFlow()
+		case <-stats.C:
+			r.showStats(sent)
+		}
+	}
+}
+
+var broadcastMAC = net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// sendFlow sends the ARP request and the UDP packets from a random host to
+// another one, and then returns the number of the sent packets.
+func (r *simulation) sendFlow() uint64 {
+	i := rand.Intn(len(r.Hosts))
+	j := rand.Intn(len(r.Hosts) - 1)
+	if j >= i {
+		j++
+	}
+	src, dst := r.Hosts[i], r.Hosts[j]
+
+	n := uint64(0)
+	if r.send(src, protocol.NewARPRequest(src.mac, src.ip, dst.ip), 0x0806, broadcastMAC) {
+		n++
+	}
+	port := uint16(1024 + rand.Intn(64512))
+	for k := 0; k < r.Traffic.Packets; k++ {
+		payload := []byte(fmt.Sprintf("cherry simulation %v", k))
+		udp := &protocol.UDP{SrcPort: port, DstPort: 9, Length: uint16(8 + len(payload)), Payload: payload}
+		udp.SetPseudoHeader(src.ip, dst.ip)
+		segment, err := udp.MarshalBinary()
+		if err != nil {
+			logger.Errorf("failed to make a UDP packet: %v", err)
+			return n
+		}
+		if r.send(src, protocol.NewIPv4(src.ip, dst.ip, 17, segment), 0x0800, dst.mac) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// send sends payload from host h to dst as if it is received by the switch of h.
+func (r *simulation) send(h *simulatedHost, payload encoding.BinaryMarshaler, etherType uint16, dst net.HardwareAddr) bool {
+	p, err := payload.MarshalBinary()
+	if err != nil {
+		logger.Errorf("failed to make a packet of host %v: %v", h.Name, err)
+		return false
+	}
+	frame, err := protocol.Ethernet{SrcMAC: h.mac, DstMAC: dst, Type: etherType, Payload: p}.MarshalBinary()
+	if err != nil {
+		logger.Errorf("failed to make a frame of host %v: %v", h.Name, err)
+		return false
+	}
+	if err := h.sw.InjectPacketIn(h.port, frame); err != nil {
+		logger.Debugf("failed to send a packet of host %v: %v", h.Name, err)
+		return false
+	}
+
+	return true
+}
+
+// receive is called when the controller sends data out to the port of host h,
+// which answers the ARP requests for its address.
+func (r *simulation) receive(h *simulatedHost, data []byte) {
+	eth := new(protocol.Ethernet)
+	if err := eth.UnmarshalBinary(data); err != nil {
+		return
+	}
+	if eth.DstMAC.String() != h.mac.String() && eth.DstMAC.String() != broadcastMAC.String() {
+		return
+	}
+	atomic.AddUint64(&h.received, 1)
+	if eth.Type != 0x0806 {
+		return
+	}
+	arp := new(protocol.ARP)
+	if err := arp.UnmarshalBinary(eth.Payload); err != nil {
+		return
+	}
+	if arp.Operation != 1 || !arp.TPA.Equal(h.ip) || arp.SPA.Equal(h.ip) {
+		return
+	}
+	// Not to block the switch reading the messages from the controller.
+	go r.send(h, protocol.NewARPReply(h.mac, arp.SHA, h.ip, arp.SPA), 0x0806, arp.SHA)
+}
+
+func (r *simulation) showStats(sent uint64) {
+	received := uint64(0)
+	for _, v := range r.Hosts {
+		received += atomic.LoadUint64(&v.received)
+	}
+	flows := 0
+	for _, sw := range r.switches {
+		flows += len(sw.Flows())
+	}
+	logger.Infof("simulation: %v packets sent by the hosts, %v packets received, %v flows on the switches", sent, received, flows)
+}
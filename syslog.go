@@ -22,29 +22,80 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	slog "log/syslog"
+	"net"
+	"os"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/superkkt/go-logging"
 )
 
+const (
+	// Maximum number of the log messages queued while the remote syslog server is unreachable.
+	remoteSyslogQueueSize = 4096
+	remoteSyslogTimeout   = 5 * time.Second
+	remoteSyslogRetry     = 5 * time.Second
+	// UDP messages longer than this are truncated as it is the maximum that all the receivers should accept (RFC 5426).
+	maxSyslogMessage = 2048
+)
+
+var syslogFacilities = map[string]slog.Priority{
+	"kern":     slog.LOG_KERN,
+	"user":     slog.LOG_USER,
+	"daemon":   slog.LOG_DAEMON,
+	"auth":     slog.LOG_AUTH,
+	"syslog":   slog.LOG_SYSLOG,
+	"authpriv": slog.LOG_AUTHPRIV,
+	"local0":   slog.LOG_LOCAL0,
+	"local1":   slog.LOG_LOCAL1,
+	"local2":   slog.LOG_LOCAL2,
+	"local3":   slog.LOG_LOCAL3,
+	"local4":   slog.LOG_LOCAL4,
+	"local5":   slog.LOG_LOCAL5,
+	"local6":   slog.LOG_LOCAL6,
+	"local7":   slog.LOG_LOCAL7,
+}
+
+// parseFacility returns the syslog facility whose name is s. Empty s means the kern facility for the compatibility.
+func parseFacility(s string) (slog.Priority, error) {
+	if s == "" {
+		return slog.LOG_KERN, nil
+	}
+	v, ok := syslogFacilities[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility: %v", s)
+	}
+
+	return v, nil
+}
+
 type syslog struct {
 	writer *slog.Writer
+	tid    bool // Append the goroutine ID to the lines?
 }
 
-func newSyslog(prefix string) (logging.Backend, error) {
-	w, err := slog.New(slog.LOG_CRIT, prefix)
+func newSyslog(prefix string, facility slog.Priority, tid bool) (logging.Backend, error) {
+	w, err := slog.New(slog.LOG_CRIT|facility, prefix)
 	if err != nil {
 		return nil, err
 	}
 
-	return &syslog{writer: w}, nil
+	return &syslog{writer: w, tid: tid}, nil
 }
 
 func (r *syslog) Log(level logging.Level, calldepth int, record *logging.Record) error {
-	line := fmt.Sprintf("%v (TID=%v)", record.Formatted(calldepth+1), getGoRoutineID())
+	line := record.Formatted(calldepth + 1)
+	if r.tid {
+		line = fmt.Sprintf("%v (TID=%v)", line, getGoRoutineID())
+	}
 	switch level {
 	case logging.CRITICAL:
 		return r.writer.Crit(line)
@@ -68,3 +119,164 @@ func getGoRoutineID() string {
 	n := runtime.Stack(buf[:], false)
 	return strings.Fields(strings.TrimPrefix(string(buf[:n]), "goroutine "))[0]
 }
+
+// remoteSyslog sends the log messages to a remote syslog server in the RFC 5424
+// format over UDP (RFC 5426), TCP (RFC 6587) or TLS (RFC 5425). The messages
+// are sent in background, and they are dropped if the server is unreachable
+// for a long time, so that logging never blocks the controller.
+type remoteSyslog struct {
+	network  string // udp, tcp or tls.
+	addr     string
+	tlsConf  *tls.Config
+	facility slog.Priority
+	hostname string
+	appName  string
+	queue    chan []byte
+	dropped  uint64
+}
+
+// newRemoteSyslog returns a backend that sends the messages to the server addr
+// (host:port) over network, which is udp, tcp or tls. caFile is the PEM file of
+// the CAs that verify the server certificate, or empty to use the system CAs.
+func newRemoteSyslog(network, addr, caFile string, facility slog.Priority, appName string) (logging.Backend, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+	v := &remoteSyslog{
+		network:  strings.ToLower(network),
+		addr:     addr,
+		facility: facility,
+		appName:  appName,
+		queue:    make(chan []byte, remoteSyslogQueueSize),
+	}
+	switch v.network {
+	case "", "udp":
+		v.network = "udp"
+	case "tcp":
+	case "tls":
+		host, _, _ := net.SplitHostPort(addr)
+		v.tlsConf = &tls.Config{ServerName: host}
+		if caFile != "" {
+			pem, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				return nil, err
+			}
+			v.tlsConf.RootCAs = x509.NewCertPool()
+			if !v.tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate in %v", caFile)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog protocol: %v", network)
+	}
+	v.hostname, _ = os.Hostname()
+	if v.hostname == "" {
+		v.hostname = "-"
+	}
+	go v.sender()
+
+	return v, nil
+}
+
+func (r *remoteSyslog) Log(level logging.Level, calldepth int, record *logging.Record) error {
+	msg := r.format(level, record.Module, record.Time, record.Formatted(calldepth+1))
+	select {
+	case r.queue <- msg:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+
+	return nil
+}
+
+// format returns the RFC 5424 message whose MSGID is the module name.
+func (r *remoteSyslog) format(level logging.Level, module string, t time.Time, line string) []byte {
+	if module == "" {
+		module = "-"
+	}
+	header := fmt.Sprintf("<%d>1 %v %v %v %d %v - ", int(r.facility)|int(severity(level)), t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		r.hostname, r.appName, os.Getpid(), module)
+
+	return []byte(header + line)
+}
+
+func severity(level logging.Level) slog.Priority {
+	switch level {
+	case logging.CRITICAL:
+		return slog.LOG_CRIT
+	case logging.ERROR:
+		return slog.LOG_ERR
+	case logging.WARNING:
+		return slog.LOG_WARNING
+	case logging.NOTICE:
+		return slog.LOG_NOTICE
+	case logging.INFO:
+		return slog.LOG_INFO
+	default:
+		return slog.LOG_DEBUG
+	}
+}
+
+func (r *remoteSyslog) sender() {
+	var conn net.Conn
+	for msg := range r.queue {
+		for {
+			if conn == nil {
+				c, err := r.dial()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to connect to the syslog server %v: %v\n", r.addr, err)
+					time.Sleep(remoteSyslogRetry)
+					continue
+				}
+				conn = c
+				if n := atomic.SwapUint64(&r.dropped, 0); n > 0 {
+					// Not to lose the fact that the messages have been dropped.
+					dropped := r.format(logging.WARNING, "main", time.Now(), fmt.Sprintf("dropped %v log messages while the syslog server is unreachable", n))
+					if err := r.write(conn, dropped); err != nil {
+						conn.Close()
+						conn = nil
+						continue
+					}
+				}
+			}
+			if err := r.write(conn, msg); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to send a log message to the syslog server %v: %v\n", r.addr, err)
+				conn.Close()
+				conn = nil
+				// UDP does not retry not to send a message twice.
+				if r.network == "udp" {
+					break
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (r *remoteSyslog) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: remoteSyslogTimeout}
+	if r.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", r.addr, r.tlsConf)
+	}
+
+	return dialer.Dial(r.network, r.addr)
+}
+
+func (r *remoteSyslog) write(conn net.Conn, msg []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(remoteSyslogTimeout))
+	if r.network == "udp" {
+		if len(msg) > maxSyslogMessage {
+			msg = msg[:maxSyslogMessage]
+		}
+	} else {
+		// Octet-counting framing.
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	n, err := conn.Write(msg)
+	if err == nil && n != len(msg) {
+		err = errors.New("short write")
+	}
+
+	return err
+}
@@ -0,0 +1,300 @@
+#!/usr/bin/env python
+#
+# Cherry - An OpenFlow Controller
+#
+# Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+# Kitae Kim <superkkt@sds.co.kr>
+#
+# This program is free software; you can redistribute it and/or modify
+# it under the terms of the GNU General Public License as published by
+# the Free Software Foundation; either version 2 of the License, or
+# any later version.
+#
+# This program is distributed in the hope that it will be useful,
+# but WITHOUT ANY WARRANTY; without even the implied warranty of
+# MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+# GNU General Public License for more details.
+#
+# You should have received a copy of the GNU General Public License along
+# with this program; if not, write to the Free Software Foundation, Inc.,
+# 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+
+"""Integration tests of Cherry on Mininet.
+
+Each test starts a new cherry daemon with the memory database, connects a
+Mininet topology of Open vSwitch switches to it, and then checks the behavior
+of the controller through the hosts and the REST API. It should run as root on
+a host that has Mininet and Open vSwitch:
+
+    $ go build -o /tmp/cherry github.com/superkkt/cherry
+    $ sudo python test/mininet/harness.py -cherry /tmp/cherry
+
+It exits with a non-zero status if any test fails.
+"""
+
+from __future__ import print_function
+
+import argparse
+import json
+import os
+import subprocess
+import sys
+import time
+import traceback
+
+try:
+    from urllib.request import Request, urlopen
+except ImportError:
+    from urllib2 import Request, urlopen
+
+from mininet.clean import cleanup
+from mininet.log import setLogLevel
+from mininet.net import Mininet
+from mininet.node import OVSSwitch, RemoteController
+from mininet.topo import LinearTopo, Topo
+
+HERE = os.path.dirname(os.path.abspath(__file__))
+OPENFLOW_PORT = 6653
+REST_URL = 'http://127.0.0.1:7070'
+# Addresses of the Mininet hosts, which are registered as a network of Cherry.
+NETWORK = '10.0.0.0'
+NETWORK_MASK = 24
+TIMEOUT = 60
+
+
+class OVS13(OVSSwitch):
+    """Open vSwitch that only speaks OpenFlow 1.3."""
+
+    def __init__(self, name, **params):
+        params['protocols'] = 'OpenFlow13'
+        OVSSwitch.__init__(self, name, **params)
+
+
+class RingTopo(Topo):
+    """Switches in a ring, each of which has a host. The spanning tree of the
+    controller blocks one of the links."""
+
+    def build(self, n=4):
+        switches = [self.addSwitch('s%d' % (i + 1)) for i in range(n)]
+        for i, s in enumerate(switches):
+            self.addLink(self.addHost('h%d' % (i + 1)), s)
+        for i in range(n):
+            self.addLink(switches[i], switches[(i + 1) % n])
+
+
+class TestFailure(Exception):
+    pass
+
+
+def check(cond, message):
+    if not cond:
+        raise TestFailure(message)
+
+
+def wait_for(message, cond, timeout=TIMEOUT):
+    deadline = time.time() + timeout
+    while not cond():
+        if time.time() > deadline:
+            raise TestFailure('timeout: %s' % message)
+        time.sleep(1)
+
+
+class Cherry(object):
+    """cherry daemon under the test."""
+
+    def __init__(self, binary, config, log):
+        self.binary = binary
+        self.config = config
+        self.log = log
+        self.proc = None
+
+    def start(self):
+        self.proc = subprocess.Popen([self.binary, '-config', self.config],
+                                     stdout=self.log, stderr=self.log)
+        wait_for('REST API of the controller', self.is_ready)
+
+    def stop(self):
+        if self.proc is None:
+            return
+        self.proc.terminate()
+        self.proc.wait()
+        self.proc = None
+
+    def restart(self):
+        self.stop()
+        self.start()
+
+    def is_ready(self):
+        try:
+            self.api('GET', '/readyz')
+            return True
+        except Exception:
+            return False
+
+    def api(self, method, path, body=None):
+        data = None
+        if body is not None:
+            data = json.dumps(body).encode('utf-8')
+        req = Request(REST_URL + path, data=data)
+        req.get_method = lambda: method
+        req.add_header('Content-Type', 'application/json')
+        resp = urlopen(req, timeout=10)
+        return json.loads(resp.read().decode('utf-8') or '{}')
+
+    def devices(self):
+        return self.api('GET', '/api/v1/device')['devices']
+
+    def links(self):
+        return self.api('GET', '/api/v1/link')['links']
+
+    def hosts(self):
+        return self.api('GET', '/api/v1/host')['hosts']
+
+
+def start_network(cherry, topo):
+    net = Mininet(topo=topo, switch=OVS13, controller=None, autoSetMacs=True,
+                  ipBase='%s/%d' % (NETWORK, NETWORK_MASK))
+    net.addController('c0', controller=RemoteController, ip='127.0.0.1', port=OPENFLOW_PORT)
+    net.start()
+    wait_for('connecting the switches',
+             lambda: len(cherry.devices()) == len(net.switches))
+    wait_for('discovering the links',
+             lambda: len(cherry.links()) == len(topo.links()) - len(net.hosts))
+
+    return net
+
+
+def ping_all(net):
+    # The first packets may be lost while the hosts are discovered.
+    for _ in range(3):
+        if net.pingAll(timeout=1) == 0:
+            return
+    raise TestFailure('hosts are not reachable')
+
+
+def register(cherry, net):
+    """Registers the switches and the hosts of net to the database, so that
+    Discovery finds their locations."""
+    for s in net.switches:
+        cherry.api('POST', '/api/v1/switch', {
+            'dpid': int(s.dpid, 16),
+            'n_ports': len(s.ports) - 1,
+            'first_port': 1,
+            'first_printed_port': 1,
+            'description': s.name,
+        })
+    netID = cherry.api('POST', '/api/v1/network',
+                       {'address': NETWORK, 'mask': NETWORK_MASK})['network_id']
+    addrs = cherry.api('GET', '/api/v1/ip/%d' % netID)['addresses']
+    ipIDs = dict((v['address'], v['id']) for v in addrs)
+    for h in net.hosts:
+        cherry.api('POST', '/api/v1/host',
+                   {'ip_id': ipIDs[h.IP()], 'mac': h.MAC(), 'description': h.name})
+
+
+def test_connectivity(cherry):
+    net = start_network(cherry, LinearTopo(k=3, n=2))
+    try:
+        ping_all(net)
+    finally:
+        net.stop()
+
+
+def test_host_discovery(cherry):
+    net = start_network(cherry, LinearTopo(k=2, n=2))
+    try:
+        register(cherry, net)
+        ping_all(net)
+
+        def located():
+            hosts = cherry.hosts()
+            return len(hosts) == len(net.hosts) and all(v['port'] for v in hosts)
+        wait_for('locating the hosts', located)
+    finally:
+        net.stop()
+
+
+def test_link_failover(cherry):
+    topo = RingTopo(n=4)
+    net = start_network(cherry, topo)
+    try:
+        check(len([v for v in cherry.links() if not v['enabled']]) == 1,
+              'spanning tree should block one link')
+        ping_all(net)
+
+        # Cut a link of the ring, and then the blocked one should carry the traffic.
+        net.configLinkStatus('s1', 's2', 'down')
+        wait_for('removing the link', lambda: len(cherry.links()) == 3)
+        wait_for('enabling all the remaining links',
+                 lambda: all(v['enabled'] for v in cherry.links()))
+        ping_all(net)
+
+        net.configLinkStatus('s1', 's2', 'up')
+        wait_for('adding the link again', lambda: len(cherry.links()) == 4)
+        ping_all(net)
+    finally:
+        net.stop()
+
+
+def test_controller_restart(cherry):
+    net = start_network(cherry, LinearTopo(k=2, n=1))
+    try:
+        ping_all(net)
+        cherry.restart()
+        wait_for('reconnecting the switches',
+                 lambda: len(cherry.devices()) == len(net.switches))
+        ping_all(net)
+    finally:
+        net.stop()
+
+
+TESTS = [
+    test_connectivity,
+    test_host_discovery,
+    test_link_failover,
+    test_controller_restart,
+]
+
+
+def main():
+    parser = argparse.ArgumentParser(description='Integration tests of Cherry on Mininet')
+    parser.add_argument('-cherry', default='cherry', help='path of the cherry binary')
+    parser.add_argument('-config', default=os.path.join(HERE, 'cherry.yaml'),
+                        help='configuration file of the controller')
+    parser.add_argument('-log', default='cherry-test.log', help='log file of the controller')
+    parser.add_argument('-run', default='', help='run only the tests whose names contain this')
+    args = parser.parse_args()
+
+    if os.geteuid() != 0:
+        print('harness.py should run as root for Mininet', file=sys.stderr)
+        return 2
+    setLogLevel('warning')
+
+    failed = []
+    with open(args.log, 'a') as log:
+        for test in TESTS:
+            if args.run not in test.__name__:
+                continue
+            cherry = Cherry(args.cherry, args.config, log)
+            try:
+                cherry.start()
+                test(cherry)
+                print('ok: %s' % test.__name__)
+            except Exception as e:
+                if not isinstance(e, TestFailure):
+                    traceback.print_exc()
+                print('FAIL: %s: %s' % (test.__name__, e))
+                failed.append(test.__name__)
+            finally:
+                cherry.stop()
+                cleanup()
+
+    if failed:
+        print('FAIL (%d tests, see %s)' % (len(failed), args.log))
+        return 1
+    print('PASS')
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,243 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/go-logging"
+)
+
+const (
+	// Number of the traces waiting to be exported. The traces are dropped if the
+	// collector falls behind.
+	otlpQueueSize = 1024
+	// Maximum number of the traces in a single export request.
+	otlpBatchSize     = 128
+	otlpFlushInterval = 5 * time.Second
+	otlpTimeout       = 10 * time.Second
+	// SPAN_KIND_INTERNAL of OTLP.
+	otlpSpanKindInternal = 1
+)
+
+var (
+	logger = logging.MustGetLogger("trace")
+)
+
+// otlpExporter sends the finished traces to an OpenTelemetry collector using
+// OTLP over HTTP with the JSON encoding, so that it does not need the
+// OpenTelemetry SDK. The spans keep their original trace and span IDs.
+type otlpExporter struct {
+	url     string
+	client  *http.Client
+	queue   chan *Span
+	dropped uint64
+}
+
+// NewOTLPExporter returns the exporter that sends the traces to the
+// OpenTelemetry collector at endpoint (host:port) using OTLP over HTTP. The
+// traces are sent in batches by a background goroutine.
+func NewOTLPExporter(endpoint string, insecure bool) (Exporter, error) {
+	if endpoint == "" {
+		return nil, errors.New("empty OTLP endpoint")
+	}
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	u, err := url.Parse(fmt.Sprintf("%v://%v/v1/traces", scheme, endpoint))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %v", endpoint)
+	}
+
+	r := &otlpExporter{
+		url:    u.String(),
+		client: &http.Client{Timeout: otlpTimeout},
+		queue:  make(chan *Span, otlpQueueSize),
+	}
+	go r.run()
+
+	return r, nil
+}
+
+func (r *otlpExporter) Export(root *Span) {
+	select {
+	case r.queue <- root:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+func (r *otlpExporter) run() {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, otlpBatchSize)
+	for {
+		select {
+		case v := <-r.queue:
+			batch = append(batch, v)
+			if len(batch) < otlpBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if n := atomic.SwapUint64(&r.dropped, 0); n > 0 {
+				logger.Warningf("dropped %v traces: the OTLP collector falls behind", n)
+			}
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := r.send(batch); err != nil {
+			logger.Errorf("failed to export %v traces to the OTLP collector: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+}
+
+func (r *otlpExporter) send(batch []*Span) error {
+	body, err := json.Marshal(newOTLPRequest(batch))
+	if err != nil {
+		return err
+	}
+	res, err := r.client.Post(r.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// Drain the body to reuse the connection.
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected OTLP response status: %v", res.Status)
+	}
+
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+// otlpSpan is a span of OTLP/JSON, whose IDs are hex strings and timestamps
+// are decimal strings of the nanoseconds since the Unix epoch.
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func newOTLPRequest(batch []*Span) otlpRequest {
+	spans := []otlpSpan{}
+	for _, v := range batch {
+		spans = appendOTLPSpans(spans, v, "")
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{{Key: "service.name", Value: otlpAnyValue{StringValue: "cherry"}}},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: "github.com/superkkt/cherry"},
+						Spans: spans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// appendOTLPSpans appends s and all its descendants to spans.
+func appendOTLPSpans(spans []otlpSpan, s *Span, parentID string) []otlpSpan {
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		attrs[i] = otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: s.Attributes[k]}}
+	}
+
+	spans = append(spans, otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      parentID,
+		Name:              s.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes:        attrs,
+	})
+	for _, v := range s.Children {
+		spans = appendOTLPSpans(spans, v, s.SpanID)
+	}
+
+	return spans
+}
@@ -0,0 +1,77 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package trace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOTLPExport(t *testing.T) {
+	var req otlpRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(strings.TrimPrefix(server.URL, "http://"), true)
+	if err != nil {
+		t.Fatalf("failed to create the exporter: %v", err)
+	}
+
+	start := time.Unix(1, 0)
+	root := &Span{TraceID: newID(16), SpanID: newID(8), Name: "root", Start: start, End: start.Add(time.Second)}
+	root.SetAttribute("dpid", "1")
+	child := &Span{TraceID: root.TraceID, SpanID: newID(8), Name: "child", Start: start, End: start.Add(time.Millisecond)}
+	root.Children = append(root.Children, child)
+	if err := exporter.(*otlpExporter).send([]*Span{root}); err != nil {
+		t.Fatalf("failed to export the trace: %v", err)
+	}
+
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatal("invalid OTLP request")
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("unexpected number of the exported spans: %v", len(spans))
+	}
+	if spans[0].SpanID != root.SpanID || spans[0].ParentSpanID != "" || spans[0].EndTimeUnixNano != "2000000000" {
+		t.Fatalf("invalid root span: %+v", spans[0])
+	}
+	if len(spans[0].Attributes) != 1 || spans[0].Attributes[0].Key != "dpid" || spans[0].Attributes[0].Value.StringValue != "1" {
+		t.Fatalf("invalid attributes of the root span: %+v", spans[0].Attributes)
+	}
+	if spans[1].TraceID != root.TraceID || spans[1].ParentSpanID != root.SpanID {
+		t.Fatalf("invalid child span: %+v", spans[1])
+	}
+}
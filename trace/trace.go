@@ -0,0 +1,191 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package trace records the spans of the PACKET_IN and FLOW_MOD processing, so
+// that the operators can see which application in the processor chain is slow.
+// The sampled traces are kept in memory, and also exported to an OpenTelemetry
+// collector using OTLP over HTTP.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+// Number of the recent traces kept in memory.
+const maxRecentTraces = 128
+
+// Span is a timed operation. A nil span is valid and does nothing, which is
+// returned when the trace is not sampled, so that the callers do not need to
+// check whether the tracing is enabled.
+//
+// The spans of a trace should be started and finished by a single goroutine.
+type Span struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Children   []*Span           `json:"children,omitempty"`
+	parent     *Span
+}
+
+// Exporter receives the finished root spans, whose children are also finished.
+type Exporter interface {
+	Export(root *Span)
+}
+
+var (
+	mutex      sync.Mutex
+	sampleRate float64 // From 0 (disabled) to 1 (all).
+	random     = mrand.New(mrand.NewSource(time.Now().UnixNano()))
+	exporters  []Exporter
+	recent     []*Span
+)
+
+// SetSampleRate sets the ratio of the sampled traces, which is from 0 to 1.
+// Zero disables the tracing.
+func SetSampleRate(rate float64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	sampleRate = math.Max(0, math.Min(1, rate))
+}
+
+// AddExporter adds e that receives all the sampled traces.
+func AddExporter(e Exporter) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	exporters = append(exporters, e)
+}
+
+func sampled() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if sampleRate == 0 {
+		return false
+	}
+
+	return sampleRate >= 1 || random.Float64() < sampleRate
+}
+
+// Start starts a new trace whose root span is name. It returns nil if the trace is not sampled.
+func Start(name string) *Span {
+	if !sampled() {
+		return nil
+	}
+
+	return &Span{
+		TraceID: newID(16),
+		SpanID:  newID(8),
+		Name:    name,
+		Start:   time.Now(),
+	}
+}
+
+// StartChild starts a new child span of r.
+func (r *Span) StartChild(name string) *Span {
+	if r == nil {
+		return nil
+	}
+
+	v := &Span{
+		TraceID: r.TraceID,
+		SpanID:  newID(8),
+		Name:    name,
+		Start:   time.Now(),
+		parent:  r,
+	}
+	r.Children = append(r.Children, v)
+
+	return v
+}
+
+func (r *Span) SetAttribute(key, value string) {
+	if r == nil {
+		return
+	}
+
+	if r.Attributes == nil {
+		r.Attributes = make(map[string]string)
+	}
+	r.Attributes[key] = value
+}
+
+// Finish ends r. The trace is exported when its root span is finished.
+func (r *Span) Finish() {
+	if r == nil {
+		return
+	}
+
+	r.End = time.Now()
+	if r.parent != nil {
+		return
+	}
+
+	mutex.Lock()
+	recent = append(recent, r)
+	if len(recent) > maxRecentTraces {
+		recent = recent[len(recent)-maxRecentTraces:]
+	}
+	e := make([]Exporter, len(exporters))
+	copy(e, exporters)
+	mutex.Unlock()
+
+	for _, v := range e {
+		v.Export(r)
+	}
+}
+
+func (r *Span) Duration() time.Duration {
+	if r == nil {
+		return 0
+	}
+
+	return r.End.Sub(r.Start)
+}
+
+// Recent returns the recently sampled traces in the order they have been finished.
+func Recent() []*Span {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	v := make([]*Span, len(recent))
+	copy(v, recent)
+
+	return v
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
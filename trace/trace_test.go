@@ -0,0 +1,60 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package trace
+
+import (
+	"testing"
+)
+
+func TestSampling(t *testing.T) {
+	SetSampleRate(0)
+	if v := Start("disabled"); v != nil {
+		t.Fatalf("unexpected span: %v", v.Name)
+	}
+	// Nil span should be safe to use.
+	var span *Span
+	span.StartChild("child").Finish()
+	span.Finish()
+
+	SetSampleRate(1)
+	defer SetSampleRate(0)
+
+	root := Start("root")
+	root.SetAttribute("dpid", "1")
+	child := root.StartChild("child")
+	child.Finish()
+	root.Finish()
+
+	traces := Recent()
+	if len(traces) == 0 || traces[len(traces)-1] != root {
+		t.Fatal("the finished trace is not recorded")
+	}
+	if len(root.Children) != 1 || root.Children[0] != child {
+		t.Fatal("invalid children of the root span")
+	}
+	if child.TraceID != root.TraceID || child.SpanID == root.SpanID {
+		t.Fatal("invalid span IDs")
+	}
+	if child.Duration() > root.Duration() {
+		t.Fatal("child span is longer than its parent")
+	}
+}